@@ -0,0 +1,179 @@
+// Package backoff provides the delay strategies shared by Ion components.
+//
+// A Strategy computes how long to wait before a retry. Strategies are plain
+// functions of the attempt number and the previous delay, so a single
+// Strategy value holds no state and can be shared by any number of retry
+// loops; each loop tracks its own position, or uses a Sequence to do so.
+//
+// Usage:
+//
+//	s := backoff.Cap(backoff.FullJitter(backoff.Exponential(100*time.Millisecond)), 10*time.Second)
+//
+//	seq := s.Sequence()
+//	for {
+//		if err := call(ctx); err == nil {
+//			break
+//		}
+//		time.Sleep(seq.Next())
+//	}
+//
+// Ion uses these strategies for retries in group, for growing the recovery
+// timeout of a circuit breaker that keeps failing, and for rate limiter wait
+// jitter.
+package backoff
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Strategy returns the delay before the given attempt, where attempt 1 is the
+// first retry and prev is the delay returned for the previous attempt (zero
+// for the first). Strategies must be safe for concurrent use.
+type Strategy func(attempt int, prev time.Duration) time.Duration
+
+// Constant waits d before every attempt.
+func Constant(d time.Duration) Strategy {
+	return func(int, time.Duration) time.Duration {
+		return d
+	}
+}
+
+// Linear waits base times the attempt number: base, 2*base, 3*base, ...
+func Linear(base time.Duration) Strategy {
+	return func(attempt int, _ time.Duration) time.Duration {
+		return saturate(float64(base) * float64(max(attempt, 1)))
+	}
+}
+
+// Exponential doubles the delay with every attempt: base, 2*base, 4*base, ...
+func Exponential(base time.Duration) Strategy {
+	return ExponentialFactor(base, 2)
+}
+
+// ExponentialFactor multiplies the delay by factor with every attempt.
+func ExponentialFactor(base time.Duration, factor float64) Strategy {
+	return func(attempt int, _ time.Duration) time.Duration {
+		return saturate(float64(base) * math.Pow(factor, float64(max(attempt, 1)-1)))
+	}
+}
+
+// Fibonacci grows the delay along the Fibonacci sequence: base, base,
+// 2*base, 3*base, 5*base, ... It grows more gently than Exponential.
+func Fibonacci(base time.Duration) Strategy {
+	return func(attempt int, _ time.Duration) time.Duration {
+		a, b := 1.0, 1.0
+		for i := 1; i < attempt && a < math.MaxInt64; i++ {
+			a, b = b, a+b
+		}
+		return saturate(float64(base) * a)
+	}
+}
+
+// DecorrelatedJitter picks each delay at random between base and three times
+// the previous delay, capped at limit. It spreads retries from many clients
+// well while still growing, as described in the AWS Architecture Blog post
+// "Exponential Backoff And Jitter".
+func DecorrelatedJitter(base, limit time.Duration) Strategy {
+	return func(_ int, prev time.Duration) time.Duration {
+		if prev < base {
+			prev = base
+		}
+		upper := saturate(float64(prev) * 3)
+		d := base + randDuration(upper-base)
+		return min(d, limit)
+	}
+}
+
+// Cap limits the delays of s to limit.
+func Cap(s Strategy, limit time.Duration) Strategy {
+	return func(attempt int, prev time.Duration) time.Duration {
+		return min(s(attempt, prev), limit)
+	}
+}
+
+// FullJitter picks each delay at random between zero and the delay of s.
+func FullJitter(s Strategy) Strategy {
+	return func(attempt int, prev time.Duration) time.Duration {
+		return randDuration(s(attempt, prev))
+	}
+}
+
+// EqualJitter keeps half of the delay of s and randomizes the other half.
+func EqualJitter(s Strategy) Strategy {
+	return func(attempt int, prev time.Duration) time.Duration {
+		d := s(attempt, prev)
+		return d/2 + randDuration(d-d/2)
+	}
+}
+
+// Jittered adds up to factor (between 0 and 1) of each delay of s at random.
+func Jittered(s Strategy, factor float64) Strategy {
+	return func(attempt int, prev time.Duration) time.Duration {
+		return AddJitter(s(attempt, prev), factor)
+	}
+}
+
+// AddJitter returns d plus a random amount of up to factor times d. Factors
+// outside 0 to 1 are clamped.
+func AddJitter(d time.Duration, factor float64) time.Duration {
+	factor = min(max(factor, 0), 1)
+	if factor == 0 || d <= 0 {
+		return d
+	}
+	return d + randDuration(saturate(float64(d)*factor))
+}
+
+// Sequence returns a new Sequence that walks s from the first attempt.
+func (s Strategy) Sequence() *Sequence {
+	return &Sequence{strategy: s}
+}
+
+// Sequence tracks the position of one retry loop in a Strategy. It is not
+// safe for concurrent use.
+type Sequence struct {
+	strategy Strategy
+	attempt  int
+	prev     time.Duration
+}
+
+// Next returns the delay before the next attempt.
+func (q *Sequence) Next() time.Duration {
+	q.attempt++
+	q.prev = q.strategy(q.attempt, q.prev)
+	return q.prev
+}
+
+// Attempt returns how many delays Next has returned.
+func (q *Sequence) Attempt() int {
+	return q.attempt
+}
+
+// Reset starts the sequence over.
+func (q *Sequence) Reset() {
+	q.attempt = 0
+	q.prev = 0
+}
+
+// saturate converts f to a duration, clamping instead of overflowing.
+func saturate(f float64) time.Duration {
+	if f >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	if f <= 0 {
+		return 0
+	}
+	return time.Duration(f)
+}
+
+// randDuration returns a random duration in [0, d].
+func randDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	if d == math.MaxInt64 {
+		return time.Duration(rand.Int64())
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
@@ -0,0 +1,115 @@
+package backoff_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+)
+
+func delays(s backoff.Strategy, n int) []time.Duration {
+	seq := s.Sequence()
+	out := make([]time.Duration, n)
+	for i := range out {
+		out[i] = seq.Next()
+	}
+	return out
+}
+
+func TestStrategies(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		s    backoff.Strategy
+		want []time.Duration
+	}{
+		{"constant", backoff.Constant(5 * ms), []time.Duration{5 * ms, 5 * ms, 5 * ms}},
+		{"linear", backoff.Linear(10 * ms), []time.Duration{10 * ms, 20 * ms, 30 * ms}},
+		{"exponential", backoff.Exponential(10 * ms), []time.Duration{10 * ms, 20 * ms, 40 * ms, 80 * ms}},
+		{"exponential factor", backoff.ExponentialFactor(10*ms, 3), []time.Duration{10 * ms, 30 * ms, 90 * ms}},
+		{"fibonacci", backoff.Fibonacci(10 * ms), []time.Duration{10 * ms, 10 * ms, 20 * ms, 30 * ms, 50 * ms, 80 * ms}},
+		{"capped", backoff.Cap(backoff.Exponential(10*ms), 25*ms), []time.Duration{10 * ms, 20 * ms, 25 * ms, 25 * ms}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := delays(tt.s, len(tt.want))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("attempt %d: expected %v, got %v", i+1, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	for _, s := range []backoff.Strategy{
+		backoff.Exponential(time.Second),
+		backoff.Fibonacci(time.Second),
+		backoff.Linear(time.Hour),
+	} {
+		if d := s(1<<40, 0); d != math.MaxInt64 {
+			t.Errorf("expected saturated delay, got %v", d)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	base := backoff.Constant(100 * time.Millisecond)
+
+	t.Run("full", func(t *testing.T) {
+		for _, d := range delays(backoff.FullJitter(base), 100) {
+			if d < 0 || d > 100*time.Millisecond {
+				t.Fatalf("delay %v out of range", d)
+			}
+		}
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		for _, d := range delays(backoff.EqualJitter(base), 100) {
+			if d < 50*time.Millisecond || d > 100*time.Millisecond {
+				t.Fatalf("delay %v out of range", d)
+			}
+		}
+	})
+
+	t.Run("jittered", func(t *testing.T) {
+		for _, d := range delays(backoff.Jittered(base, 0.2), 100) {
+			if d < 100*time.Millisecond || d > 120*time.Millisecond {
+				t.Fatalf("delay %v out of range", d)
+			}
+		}
+		if d := backoff.AddJitter(time.Second, 0); d != time.Second {
+			t.Errorf("expected no jitter, got %v", d)
+		}
+	})
+
+	t.Run("decorrelated", func(t *testing.T) {
+		s := backoff.DecorrelatedJitter(10*time.Millisecond, time.Second)
+		seq := s.Sequence()
+		prev := time.Duration(0)
+		for i := 0; i < 100; i++ {
+			d := seq.Next()
+			upper := max(prev, 10*time.Millisecond) * 3
+			if d < 10*time.Millisecond || d > min(upper, time.Second) {
+				t.Fatalf("attempt %d: delay %v out of range (prev %v)", i+1, d, prev)
+			}
+			prev = d
+		}
+	})
+}
+
+func TestSequenceReset(t *testing.T) {
+	seq := backoff.Exponential(time.Millisecond).Sequence()
+	seq.Next()
+	seq.Next()
+	if seq.Attempt() != 2 {
+		t.Errorf("expected attempt 2, got %d", seq.Attempt())
+	}
+	seq.Reset()
+	if d := seq.Next(); d != time.Millisecond {
+		t.Errorf("expected restart at base, got %v", d)
+	}
+}
@@ -0,0 +1,496 @@
+// Package batch provides a micro-batcher that collects individual items and
+// flushes them together once a size, byte or time threshold is reached.
+//
+// Each call to Add returns a Future that resolves with the per-item result
+// produced by the flush function, so callers keep request/response semantics
+// while the backend sees efficient bulk writes. Flushes run on a workerpool,
+// and Close flushes whatever is still buffered before returning.
+//
+// Usage:
+//
+//	b := batch.New(func(ctx context.Context, rows []Row) ([]int64, error) {
+//		return db.BulkInsert(ctx, rows)
+//	}, batch.WithMaxItems(500), batch.WithMaxWait(50*time.Millisecond))
+//	defer b.Close(context.Background())
+//
+//	id, err := b.Add(ctx, row).Wait(ctx)
+package batch
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// FlushFunc processes a batch of items. On success it must return exactly one
+// result per item, in the same order as items. A non-nil error fails every
+// item in the batch.
+type FlushFunc[T, R any] func(ctx context.Context, items []T) ([]R, error)
+
+// Batcher collects items and flushes them in batches.
+type Batcher[T, R any] struct {
+	// Configuration
+	name     string
+	flush    FlushFunc[T, R]
+	maxItems int
+	maxBytes int
+	maxWait  time.Duration
+	sizer    func(any) int
+	clock    clock.Clock
+
+	// Observability
+	obs *observe.Observability
+
+	// Execution
+	pool     *workerpool.Pool
+	ownsPool bool
+	baseCtx  context.Context
+	inflight sync.WaitGroup
+
+	// State
+	mu      sync.Mutex
+	pending []entry[T, R]
+	bytes   int
+	timer   clock.Timer
+	gen     uint64 // incremented on every take, guards stale timers
+	closed  bool
+
+	// Metrics
+	added   atomic.Uint64
+	flushes atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// entry pairs a buffered item with the future that will receive its result.
+type entry[T, R any] struct {
+	item   T
+	future *Future[R]
+}
+
+// Metrics holds a snapshot of batcher counters.
+type Metrics struct {
+	Pending int    // items currently buffered
+	Added   uint64 // total items accepted
+	Flushes uint64 // total flushes started
+	Failed  uint64 // total flushes that returned an error
+}
+
+// Option configures batcher behavior.
+type Option func(*config)
+
+type config struct {
+	name             string
+	maxItems         int
+	maxBytes         int
+	maxWait          time.Duration
+	sizer            func(any) int
+	pool             *workerpool.Pool
+	flushConcurrency int
+	baseCtx          context.Context
+	clock            clock.Clock
+	obs              *observe.Observability
+}
+
+// WithName sets the batcher name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithMaxItems sets the number of items that triggers a flush.
+func WithMaxItems(n int) Option {
+	return func(c *config) {
+		c.maxItems = n
+	}
+}
+
+// WithMaxBytes sets the accumulated byte size that triggers a flush.
+// It requires a sizer configured with WithSizer.
+func WithMaxBytes(n int) Option {
+	return func(c *config) {
+		c.maxBytes = n
+	}
+}
+
+// WithMaxWait sets the maximum time the oldest buffered item waits before a
+// flush is forced.
+func WithMaxWait(d time.Duration) Option {
+	return func(c *config) {
+		c.maxWait = d
+	}
+}
+
+// WithSizer sets the function used to compute the byte size of an item for
+// WithMaxBytes. T must match the item type of the batcher.
+func WithSizer[T any](sizeOf func(T) int) Option {
+	return func(c *config) {
+		c.sizer = func(v any) int { return sizeOf(v.(T)) }
+	}
+}
+
+// WithPool runs flushes on an existing worker pool. The batcher does not
+// close a pool it did not create.
+func WithPool(pool *workerpool.Pool) Option {
+	return func(c *config) {
+		c.pool = pool
+	}
+}
+
+// WithFlushConcurrency sets how many flushes may run concurrently when the
+// batcher creates its own pool.
+func WithFlushConcurrency(n int) Option {
+	return func(c *config) {
+		c.flushConcurrency = n
+	}
+}
+
+// WithBaseContext sets the context passed to flush functions.
+func WithBaseContext(ctx context.Context) Option {
+	return func(c *config) {
+		c.baseCtx = ctx
+	}
+}
+
+// WithClock sets the clock used for the max wait and flush durations. A pool
+// created by the batcher uses it too.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// New creates a new batcher that passes collected items to flush.
+func New[T, R any](flush FlushFunc[T, R], opts ...Option) *Batcher[T, R] {
+	if flush == nil {
+		panic("batch: flush function must not be nil")
+	}
+
+	cfg := &config{
+		name:             "",
+		maxItems:         100,
+		maxWait:          100 * time.Millisecond,
+		flushConcurrency: 1,
+		baseCtx:          context.Background(),
+		clock:            clock.Real(),
+		obs:              observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.maxItems <= 0 {
+		cfg.maxItems = 100
+	}
+	if cfg.flushConcurrency <= 0 {
+		cfg.flushConcurrency = 1
+	}
+
+	b := &Batcher[T, R]{
+		name:     cfg.name,
+		flush:    flush,
+		maxItems: cfg.maxItems,
+		maxBytes: cfg.maxBytes,
+		maxWait:  cfg.maxWait,
+		sizer:    cfg.sizer,
+		clock:    cfg.clock,
+		obs:      cfg.obs,
+		pool:     cfg.pool,
+		baseCtx:  cfg.baseCtx,
+	}
+
+	if b.pool == nil {
+		b.pool = workerpool.New(cfg.flushConcurrency, cfg.flushConcurrency,
+			workerpool.WithName(cfg.name+"_flush"),
+			workerpool.WithClock(cfg.clock),
+			workerpool.WithLogger(cfg.obs.Logger),
+			workerpool.WithMetrics(cfg.obs.Metrics),
+			workerpool.WithTracer(cfg.obs.Tracer),
+		)
+		b.ownsPool = true
+	}
+
+	b.obs.Logger.Info("batcher created",
+		"name", b.name,
+		"max_items", b.maxItems,
+		"max_bytes", b.maxBytes,
+		"max_wait", b.maxWait,
+	)
+
+	return b
+}
+
+// Add buffers an item for the next flush and returns a future for its result.
+// If the item completes a batch, the flush is handed to the pool before Add
+// returns, so Add blocks while the pool queue is full. If ctx is done while
+// it waits, every item of that batch fails with the context error. If the
+// batcher is closed the returned future is already failed.
+func (b *Batcher[T, R]) Add(ctx context.Context, item T) *Future[R] {
+	f := newFuture[R]()
+
+	if err := ctx.Err(); err != nil {
+		f.complete(*new(R), err)
+		return f
+	}
+
+	size := 0
+	if b.sizer != nil {
+		size = b.sizer(item)
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		f.complete(*new(R), NewBatcherClosedError(b.name))
+		return f
+	}
+
+	// Flush first if this item would overflow the byte budget.
+	var ready []entry[T, R]
+	if b.maxBytes > 0 && len(b.pending) > 0 && b.bytes+size > b.maxBytes {
+		ready = b.takeLocked()
+	}
+
+	b.pending = append(b.pending, entry[T, R]{item: item, future: f})
+	b.bytes += size
+	b.added.Add(1)
+
+	var full []entry[T, R]
+	if len(b.pending) >= b.maxItems || (b.maxBytes > 0 && b.bytes >= b.maxBytes) {
+		full = b.takeLocked()
+	} else if len(b.pending) == 1 && b.maxWait > 0 {
+		gen := b.gen
+		b.timer = b.clock.AfterFunc(b.maxWait, func() { b.flushOnTimer(gen) })
+	}
+	b.mu.Unlock()
+
+	b.dispatch(ctx, ready, "bytes")
+	b.dispatch(ctx, full, "size")
+
+	return f
+}
+
+// Flush immediately flushes any buffered items.
+func (b *Batcher[T, R]) Flush() {
+	b.mu.Lock()
+	ready := b.takeLocked()
+	b.mu.Unlock()
+
+	b.dispatch(b.baseCtx, ready, "manual")
+}
+
+// flushOnTimer flushes buffered items when the max wait elapses, unless the
+// batch the timer was started for has already been flushed.
+func (b *Batcher[T, R]) flushOnTimer(gen uint64) {
+	b.mu.Lock()
+	if gen != b.gen {
+		b.mu.Unlock()
+		return
+	}
+	ready := b.takeLocked()
+	b.mu.Unlock()
+
+	b.dispatch(b.baseCtx, ready, "time")
+}
+
+// takeLocked removes and returns the buffered items. A non-empty result must
+// be passed to dispatch. Must be called with b.mu held.
+func (b *Batcher[T, R]) takeLocked() []entry[T, R] {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	ready := b.pending
+	if len(ready) > 0 {
+		// Counted here rather than in dispatch so Close cannot miss a batch
+		// that was taken but not yet submitted.
+		b.inflight.Add(1)
+	}
+	b.pending = nil
+	b.bytes = 0
+	b.gen++
+	return ready
+}
+
+// dispatch hands a batch to the pool for flushing, waiting for room in the
+// queue until ctx is done. The flush itself runs with the base context: once
+// queued, it belongs to every item of the batch, not to the caller whose item
+// completed it.
+func (b *Batcher[T, R]) dispatch(ctx context.Context, ready []entry[T, R], reason string) {
+	if len(ready) == 0 {
+		return
+	}
+
+	b.flushes.Add(1)
+	obs := b.obs.WithContext(ctx)
+	obs.Metrics.Inc("ion_batch_flushes_total", "batcher_name", b.name, "reason", reason)
+	obs.Metrics.Histogram("ion_batch_size", float64(len(ready)), "batcher_name", b.name)
+
+	submitCtx, cancel := context.WithCancelCause(b.baseCtx)
+	stop := context.AfterFunc(ctx, func() { cancel(ctx.Err()) })
+	var started atomic.Bool
+	f := workerpool.SubmitFunc(b.pool, submitCtx, func(ctx context.Context) (struct{}, error) {
+		started.Store(true)
+		return struct{}{}, b.run(ctx, ready)
+	})
+	stop()
+
+	select {
+	case <-f.Done():
+		b.settle(submitCtx, cancel, f, ready, &started)
+	default:
+		go b.settle(submitCtx, cancel, f, ready, &started)
+	}
+}
+
+// settle waits for a submitted flush and fails the futures of its batch if
+// the pool never ran it: the submission failed, or the pool dropped the task
+// from its queue, when closed for instance.
+func (b *Batcher[T, R]) settle(submitCtx context.Context, cancel context.CancelCauseFunc,
+	f *workerpool.Future[struct{}], ready []entry[T, R], started *atomic.Bool) {
+	defer b.inflight.Done()
+	defer cancel(nil)
+
+	_, err := f.Wait(context.Background())
+	if started.Load() {
+		return
+	}
+	if cause := context.Cause(submitCtx); cause != nil && errors.Is(err, context.Canceled) {
+		err = cause
+	}
+
+	b.failed.Add(1)
+	for _, e := range ready {
+		e.future.complete(*new(R), err)
+	}
+	b.obs.WithContext(submitCtx).Logger.Error("batch flush could not be scheduled", err, "batcher_name", b.name)
+}
+
+// run executes the flush function and resolves the futures of a batch. If
+// the flush function panics, the futures fail with an error wrapping a
+// *workerpool.PanicError and the panic goes no further.
+func (b *Batcher[T, R]) run(ctx context.Context, ready []entry[T, R]) (err error) {
+	obs := b.obs.WithContext(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			err = NewFlushPanicError(b.name, r, debug.Stack())
+			b.failed.Add(1)
+			for _, e := range ready {
+				e.future.complete(*new(R), err)
+			}
+			obs.Logger.Error("batch flush panicked", err, "batcher_name", b.name)
+		}
+	}()
+
+	items := make([]T, len(ready))
+	for i, e := range ready {
+		items[i] = e.item
+	}
+
+	spanCtx, finish := obs.Tracer.Start(ctx, "batch.flush", "batcher_name", b.name, "items", len(items))
+	start := b.clock.Now()
+	results, err := b.flush(spanCtx, items)
+	if err == nil && len(results) != len(items) {
+		err = NewResultMismatchError(b.name, len(items), len(results))
+	}
+	finish(err)
+
+	obs.Metrics.Histogram("ion_batch_flush_duration_seconds", b.clock.Since(start).Seconds(),
+		"batcher_name", b.name)
+
+	if err != nil {
+		b.failed.Add(1)
+		for _, e := range ready {
+			e.future.complete(*new(R), err)
+		}
+		return err
+	}
+
+	for i, e := range ready {
+		e.future.complete(results[i], nil)
+	}
+	return nil
+}
+
+// Close stops accepting items, flushes anything still buffered and waits for
+// in-flight flushes to finish or ctx to expire. A pool created by the batcher
+// is closed as well, and the returned error joins the timeout with any error
+// from closing the pool.
+func (b *Batcher[T, R]) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	ready := b.takeLocked()
+	b.mu.Unlock()
+
+	obs := b.obs.WithContext(ctx)
+	obs.Logger.Info("closing batcher", "batcher_name", b.name, "pending", len(ready))
+	b.dispatch(ctx, ready, "close")
+
+	done := make(chan struct{})
+	go func() {
+		b.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		obs.Logger.Warn("batcher close timed out, some flushes may still be running",
+			"batcher_name", b.name, "error", ctx.Err())
+		err = NewCloseTimeoutError(b.name, ctx.Err())
+	}
+
+	if b.ownsPool {
+		err = errors.Join(err, b.pool.Close(ctx))
+	}
+
+	return err
+}
+
+// Metrics returns a snapshot of the batcher counters.
+func (b *Batcher[T, R]) Metrics() Metrics {
+	b.mu.Lock()
+	pending := len(b.pending)
+	b.mu.Unlock()
+
+	return Metrics{
+		Pending: pending,
+		Added:   b.added.Load(),
+		Flushes: b.flushes.Load(),
+		Failed:  b.failed.Load(),
+	}
+}
@@ -0,0 +1,296 @@
+package batch_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/batch"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/workerpool"
+)
+
+func double(ctx context.Context, items []int) ([]int, error) {
+	out := make([]int, len(items))
+	for i, v := range items {
+		out[i] = v * 2
+	}
+	return out, nil
+}
+
+func TestBatcherSizeThreshold(t *testing.T) {
+	var flushes atomic.Int64
+	b := batch.New(func(ctx context.Context, items []int) ([]int, error) {
+		flushes.Add(1)
+		return double(ctx, items)
+	}, batch.WithMaxItems(3), batch.WithMaxWait(time.Hour))
+	defer b.Close(context.Background())
+
+	futures := make([]*batch.Future[int], 3)
+	for i := range futures {
+		futures[i] = b.Add(context.Background(), i+1)
+	}
+
+	for i, f := range futures {
+		v, err := f.Wait(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v != (i+1)*2 {
+			t.Errorf("expected %d, got %d", (i+1)*2, v)
+		}
+	}
+	if flushes.Load() != 1 {
+		t.Errorf("expected 1 flush, got %d", flushes.Load())
+	}
+}
+
+func TestBatcherTimeThreshold(t *testing.T) {
+	b := batch.New(double, batch.WithMaxItems(100), batch.WithMaxWait(20*time.Millisecond))
+	defer b.Close(context.Background())
+
+	start := time.Now()
+	v, err := b.Add(context.Background(), 21).Wait(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != 42 {
+		t.Errorf("expected 42, got %d", v)
+	}
+	if time.Since(start) < 15*time.Millisecond {
+		t.Error("flush happened before max wait elapsed")
+	}
+}
+
+func TestBatcherTimeThresholdClock(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	b := batch.New(double, batch.WithClock(clk), batch.WithMaxItems(100), batch.WithMaxWait(time.Minute))
+	defer b.Close(context.Background())
+
+	f := b.Add(context.Background(), 21)
+	clk.Advance(time.Minute - time.Nanosecond)
+	select {
+	case <-f.Done():
+		t.Fatal("flush happened before max wait elapsed")
+	default:
+	}
+
+	clk.Advance(time.Nanosecond)
+	if v, err := f.Wait(context.Background()); err != nil || v != 42 {
+		t.Errorf("expected 42, got %d, %v", v, err)
+	}
+}
+
+func TestBatcherByteThreshold(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	b := batch.New(func(ctx context.Context, items []string) ([]int, error) {
+		mu.Lock()
+		sizes = append(sizes, len(items))
+		mu.Unlock()
+		out := make([]int, len(items))
+		for i, s := range items {
+			out[i] = len(s)
+		}
+		return out, nil
+	},
+		batch.WithMaxItems(100),
+		batch.WithMaxWait(time.Hour),
+		batch.WithMaxBytes(10),
+		batch.WithSizer(func(s string) int { return len(s) }),
+	)
+
+	f1 := b.Add(context.Background(), "aaaa")
+	f2 := b.Add(context.Background(), "bbbb")
+	f3 := b.Add(context.Background(), "cccc") // overflows, flushes first two
+
+	if _, err := f1.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f2.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if _, err := f3.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 1 {
+		t.Errorf("expected batches of [2 1], got %v", sizes)
+	}
+}
+
+func TestBatcherFlushError(t *testing.T) {
+	flushErr := errors.New("write failed")
+	b := batch.New(func(ctx context.Context, items []int) ([]int, error) {
+		return nil, flushErr
+	}, batch.WithMaxItems(2))
+	defer b.Close(context.Background())
+
+	f1 := b.Add(context.Background(), 1)
+	f2 := b.Add(context.Background(), 2)
+
+	for _, f := range []*batch.Future[int]{f1, f2} {
+		if _, err := f.Wait(context.Background()); !errors.Is(err, flushErr) {
+			t.Errorf("expected flush error, got %v", err)
+		}
+	}
+}
+
+func TestBatcherResultMismatch(t *testing.T) {
+	b := batch.New(func(ctx context.Context, items []int) ([]int, error) {
+		return []int{1}, nil
+	}, batch.WithMaxItems(2))
+	defer b.Close(context.Background())
+
+	b.Add(context.Background(), 1)
+	_, err := b.Add(context.Background(), 2).Wait(context.Background())
+
+	var batchErr *batch.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Errorf("expected BatchError, got %v", err)
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	b := batch.New(double, batch.WithName("close-test"), batch.WithMaxItems(100), batch.WithMaxWait(time.Hour))
+
+	f := b.Add(context.Background(), 5)
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+
+	select {
+	case <-f.Done():
+	default:
+		t.Fatal("expected pending item to be flushed on close")
+	}
+	if v, _ := f.Wait(context.Background()); v != 10 {
+		t.Errorf("expected 10, got %d", v)
+	}
+
+	_, err := b.Add(context.Background(), 1).Wait(context.Background())
+	var batchErr *batch.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Errorf("expected BatchError after close, got %v", err)
+	}
+}
+
+func TestBatcherFlushPanic(t *testing.T) {
+	b := batch.New(func(ctx context.Context, items []int) ([]int, error) {
+		panic("boom")
+	}, batch.WithMaxItems(2))
+	defer b.Close(context.Background())
+
+	f1 := b.Add(context.Background(), 1)
+	f2 := b.Add(context.Background(), 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, f := range []*batch.Future[int]{f1, f2} {
+		_, err := f.Wait(ctx)
+		if !errors.Is(err, workerpool.ErrTaskPanicked) {
+			t.Fatalf("expected panic error, got %v", err)
+		}
+		var panicErr *workerpool.PanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+			t.Errorf("expected panic value boom, got %v", err)
+		}
+	}
+	if m := b.Metrics(); m.Failed != 1 {
+		t.Errorf("expected 1 failed flush, got %d", m.Failed)
+	}
+}
+
+// blockPool returns a pool of one worker and one queue slot, both taken,
+// and a function that lets the tasks holding them finish.
+func blockPool(t *testing.T) (*workerpool.Pool, func()) {
+	t.Helper()
+	pool := workerpool.New(1, 1)
+	release := make(chan struct{})
+	running := make(chan struct{})
+	block := func(ctx context.Context) error {
+		select {
+		case running <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}
+	if err := pool.Submit(context.Background(), block); err != nil {
+		t.Fatalf("unexpected submit error: %v", err)
+	}
+	<-running
+	if err := pool.Submit(context.Background(), block); err != nil {
+		t.Fatalf("unexpected submit error: %v", err)
+	}
+	var once sync.Once
+	return pool, func() { once.Do(func() { close(release) }) }
+}
+
+func TestBatcherAddContextQueueFull(t *testing.T) {
+	pool, release := blockPool(t)
+	defer pool.Close(context.Background())
+	defer release()
+
+	b := batch.New(double, batch.WithPool(pool), batch.WithMaxItems(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	f := b.Add(ctx, 1)
+
+	select {
+	case <-f.Done():
+	default:
+		t.Fatal("expected future to be failed when Add returns")
+	}
+	if _, err := f.Wait(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	release()
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("unexpected close error: %v", err)
+	}
+}
+
+func TestBatcherFlushDroppedByPool(t *testing.T) {
+	pool := workerpool.New(1, 1)
+	release := make(chan struct{})
+	running := make(chan struct{})
+	pool.Submit(context.Background(), func(ctx context.Context) error {
+		close(running)
+		<-release
+		return nil
+	})
+	<-running
+
+	b := batch.New(double, batch.WithPool(pool), batch.WithMaxItems(1))
+	f := b.Add(context.Background(), 1) // queued behind the running task
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	pool.Close(closeCtx)
+	close(release)
+
+	// The worker may still pick up the queued flush as it stops; either way
+	// the future resolves and Close does not wait for a flush that never runs
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	if v, err := f.Wait(ctx); err != nil && !errors.Is(err, workerpool.ErrPoolClosed) {
+		t.Errorf("expected pool closed error, got %v", err)
+	} else if err == nil && v != 2 {
+		t.Errorf("expected 2, got %d", v)
+	}
+}
@@ -0,0 +1,64 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kolosys/ion/workerpool"
+)
+
+// BatchError represents batcher-specific errors with context
+type BatchError struct {
+	Op          string // operation that failed
+	BatcherName string // name of the batcher
+	Err         error  // underlying error
+}
+
+func (e *BatchError) Error() string {
+	if e.BatcherName != "" {
+		return fmt.Sprintf("ion: batcher %q %s: %v", e.BatcherName, e.Op, e.Err)
+	}
+	return fmt.Sprintf("ion: batcher %s: %v", e.Op, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// NewBatcherClosedError creates an error indicating the batcher is closed
+func NewBatcherClosedError(batcherName string) error {
+	return &BatchError{
+		Op:          "add",
+		BatcherName: batcherName,
+		Err:         errors.New("batcher is closed"),
+	}
+}
+
+// NewCloseTimeoutError creates an error indicating close gave up waiting for
+// in-flight flushes
+func NewCloseTimeoutError(batcherName string, err error) error {
+	return &BatchError{
+		Op:          "close",
+		BatcherName: batcherName,
+		Err:         fmt.Errorf("timed out waiting for flushes: %w", err),
+	}
+}
+
+// NewResultMismatchError creates an error indicating a flush returned the wrong number of results
+func NewResultMismatchError(batcherName string, items, results int) error {
+	return &BatchError{
+		Op:          "flush",
+		BatcherName: batcherName,
+		Err:         fmt.Errorf("flush returned %d results for %d items", results, items),
+	}
+}
+
+// NewFlushPanicError creates an error for a flush function that panicked
+// with value. It matches workerpool.ErrTaskPanicked
+func NewFlushPanicError(batcherName string, value any, stack []byte) error {
+	return &BatchError{
+		Op:          "flush",
+		BatcherName: batcherName,
+		Err:         &workerpool.PanicError{Value: value, Stack: stack},
+	}
+}
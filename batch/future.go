@@ -0,0 +1,38 @@
+package batch
+
+import "context"
+
+// Future is the pending result of an item added to a Batcher.
+type Future[R any] struct {
+	done  chan struct{}
+	value R
+	err   error
+}
+
+func newFuture[R any]() *Future[R] {
+	return &Future[R]{done: make(chan struct{})}
+}
+
+// complete resolves the future. It must be called exactly once.
+func (f *Future[R]) complete(value R, err error) {
+	f.value = value
+	f.err = err
+	close(f.done)
+}
+
+// Done returns a channel that is closed once the result is available.
+func (f *Future[R]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the item's batch has been flushed or ctx is canceled.
+// Canceling ctx does not remove the item from its batch.
+func (f *Future[R]) Wait(ctx context.Context) (R, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero R
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,501 @@
+// Package broadcast provides bounded, topic-based in-process publish/subscribe.
+//
+// A Broker fans every message published to a topic out to all subscribers of
+// that topic. Each subscriber has its own bounded buffer, so one slow
+// consumer never grows memory without bound; what happens when a buffer is
+// full is decided by the subscriber's Policy: drop the new message, drop the
+// oldest buffered message, disconnect the subscriber, or block the publisher.
+//
+// Usage:
+//
+//	b := broadcast.New[Order](broadcast.WithBufferSize(64))
+//
+//	sub, err := b.Subscribe(ctx, "orders")
+//	if err != nil {
+//		return err
+//	}
+//	go func() {
+//		for order := range sub.C() {
+//			process(order)
+//		}
+//	}()
+//
+//	b.Publish(ctx, "orders", order)
+//
+// A subscription ends when its context is done, when Close is called on it,
+// when the Disconnect policy drops it, or when the broker is closed; its
+// channel is then closed once the buffered messages have been received.
+package broadcast
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// Policy decides what happens to a message published to a subscriber whose
+// buffer is full.
+type Policy int
+
+const (
+	// Drop discards the new message. The publisher is never delayed.
+	Drop Policy = iota
+	// DropOldest discards the oldest buffered message to make room for the
+	// new one, so the subscriber always sees the most recent messages.
+	DropOldest
+	// Disconnect ends the subscription with ErrSlowConsumer. Messages already
+	// buffered are still delivered before its channel is closed.
+	Disconnect
+	// Block makes the publisher wait until the subscriber has room, the
+	// subscription ends, or the publish context is done. Delivery is lossless
+	// but a stalled subscriber stalls every publisher of its topic.
+	Block
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Drop:
+		return "drop"
+	case DropOldest:
+		return "drop_oldest"
+	case Disconnect:
+		return "disconnect"
+	case Block:
+		return "block"
+	default:
+		return "unknown"
+	}
+}
+
+// Option configures broker behavior.
+type Option func(*config)
+
+type config struct {
+	name       string
+	bufferSize int
+	policy     Policy
+	obs        *observe.Observability
+}
+
+// WithName sets the broker name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithBufferSize sets the default per-subscriber buffer size. The default is
+// 16.
+func WithBufferSize(n int) Option {
+	return func(c *config) {
+		c.bufferSize = n
+	}
+}
+
+// WithPolicy sets the default slow-consumer policy. The default is Drop.
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// SubscribeOption configures a single subscription.
+type SubscribeOption func(*subConfig)
+
+type subConfig struct {
+	bufferSize int
+	policy     Policy
+}
+
+// Buffer overrides the broker's buffer size for the subscription.
+func Buffer(n int) SubscribeOption {
+	return func(c *subConfig) {
+		c.bufferSize = n
+	}
+}
+
+// OnSlow overrides the broker's slow-consumer policy for the subscription.
+func OnSlow(p Policy) SubscribeOption {
+	return func(c *subConfig) {
+		c.policy = p
+	}
+}
+
+// Broker delivers messages of type T to topic subscribers.
+type Broker[T any] struct {
+	name       string
+	bufferSize int
+	policy     Policy
+	obs        *observe.Observability
+
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription[T]]struct{}
+	closed bool
+}
+
+// New creates a broker.
+func New[T any](opts ...Option) *Broker[T] {
+	cfg := &config{
+		name:       "",
+		bufferSize: 16,
+		policy:     Drop,
+		obs:        observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.bufferSize < 0 {
+		cfg.bufferSize = 0
+	}
+
+	b := &Broker[T]{
+		name:       cfg.name,
+		bufferSize: cfg.bufferSize,
+		policy:     cfg.policy,
+		obs:        cfg.obs,
+		topics:     make(map[string]map[*Subscription[T]]struct{}),
+	}
+
+	b.obs.Logger.Info("broker created",
+		"name", b.name,
+		"buffer_size", b.bufferSize,
+		"policy", b.policy.String(),
+	)
+
+	return b
+}
+
+// Name returns the broker name.
+func (b *Broker[T]) Name() string {
+	return b.name
+}
+
+// Subscribe registers a subscriber for topic. The subscription ends when ctx
+// is done or Close is called on it; use context.Background to subscribe until
+// then.
+func (b *Broker[T]) Subscribe(ctx context.Context, topic string, opts ...SubscribeOption) (*Subscription[T], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cfg := &subConfig{
+		bufferSize: b.bufferSize,
+		policy:     b.policy,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.bufferSize < 0 {
+		cfg.bufferSize = 0
+	}
+
+	s := &Subscription[T]{
+		broker: b,
+		topic:  topic,
+		policy: cfg.policy,
+		ch:     make(chan T, cfg.bufferSize),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, NewBrokerClosedError(b.name, "subscribe", topic)
+	}
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[*Subscription[T]]struct{})
+		b.topics[topic] = subs
+	}
+	subs[s] = struct{}{}
+	count := len(subs)
+	b.mu.Unlock()
+
+	obs := b.obs.WithContext(ctx)
+	obs.Metrics.Gauge("ion_broadcast_subscribers", float64(count), "broker_name", b.name, "topic", topic)
+	obs.Logger.Debug("subscribed", "broker_name", b.name, "topic", topic, "policy", s.policy.String())
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.end(ctx.Err())
+			case <-s.done:
+			}
+		}()
+	}
+
+	return s, nil
+}
+
+// Publish delivers msg to every current subscriber of topic and returns how
+// many received it. Messages dropped by a subscriber's policy are not
+// counted. An error is returned only if the broker is closed or ctx is done
+// while blocked on a subscriber using the Block policy; subscribers after it
+// do not receive the message.
+func (b *Broker[T]) Publish(ctx context.Context, topic string, msg T) (int, error) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return 0, NewBrokerClosedError(b.name, "publish", topic)
+	}
+	subs := make([]*Subscription[T], 0, len(b.topics[topic]))
+	for s := range b.topics[topic] {
+		subs = append(subs, s)
+	}
+	b.mu.RUnlock()
+
+	b.obs.WithContext(ctx).Metrics.Inc("ion_broadcast_published_total", "broker_name", b.name, "topic", topic)
+
+	delivered := 0
+	for _, s := range subs {
+		ok, err := s.deliver(ctx, msg)
+		if err != nil {
+			return delivered, NewPublishError(b.name, topic, err)
+		}
+		if ok {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// Subscribers returns the number of active subscribers of topic.
+func (b *Broker[T]) Subscribers(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic])
+}
+
+// Topics returns the topics that have at least one subscriber, sorted.
+func (b *Broker[T]) Topics() []string {
+	b.mu.RLock()
+	topics := make([]string, 0, len(b.topics))
+	for topic := range b.topics {
+		topics = append(topics, topic)
+	}
+	b.mu.RUnlock()
+
+	sort.Strings(topics)
+	return topics
+}
+
+// Close ends every subscription with ErrClosed and rejects further Publish
+// and Subscribe calls. It is safe to call more than once.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	var subs []*Subscription[T]
+	for _, topicSubs := range b.topics {
+		for s := range topicSubs {
+			subs = append(subs, s)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.end(ErrClosed)
+	}
+
+	b.obs.Logger.Info("broker closed", "name", b.name)
+}
+
+// remove unregisters s from its topic.
+func (b *Broker[T]) remove(s *Subscription[T]) {
+	b.mu.Lock()
+	subs := b.topics[s.topic]
+	delete(subs, s)
+	count := len(subs)
+	if count == 0 {
+		delete(b.topics, s.topic)
+	}
+	b.mu.Unlock()
+
+	b.obs.Metrics.Gauge("ion_broadcast_subscribers", float64(count), "broker_name", b.name, "topic", s.topic)
+}
+
+// Subscription receives the messages published to one topic.
+type Subscription[T any] struct {
+	broker *Broker[T]
+	topic  string
+	policy Policy
+
+	// sendMu serializes delivery with closing ch.
+	sendMu sync.Mutex
+	ch     chan T
+
+	once    sync.Once
+	done    chan struct{}
+	err     error
+	dropped atomic.Uint64
+}
+
+// C returns the channel on which messages are delivered. It is closed after
+// the subscription ends and the buffered messages have been received.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Topic returns the subscribed topic.
+func (s *Subscription[T]) Topic() string {
+	return s.topic
+}
+
+// Done returns a channel that is closed when the subscription ends.
+func (s *Subscription[T]) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription ended: the context error, ErrUnsubscribed,
+// ErrSlowConsumer or ErrClosed. It returns nil while the subscription is
+// active.
+func (s *Subscription[T]) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Dropped returns how many messages the subscription's policy has discarded.
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close ends the subscription with ErrUnsubscribed. It is safe to call more
+// than once.
+func (s *Subscription[T]) Close() {
+	s.end(ErrUnsubscribed)
+}
+
+// signal marks the subscription as ended and reports whether this call ended
+// it.
+func (s *Subscription[T]) signal(err error) bool {
+	ended := false
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+		ended = true
+	})
+	return ended
+}
+
+// end ends the subscription, closes its channel and unregisters it.
+func (s *Subscription[T]) end(err error) {
+	if !s.signal(err) {
+		return
+	}
+
+	s.sendMu.Lock()
+	close(s.ch)
+	s.sendMu.Unlock()
+
+	s.broker.remove(s)
+}
+
+// deliver offers msg to the subscriber according to its policy and reports
+// whether it was buffered. It only returns an error when the Block policy is
+// interrupted by ctx.
+func (s *Subscription[T]) deliver(ctx context.Context, msg T) (bool, error) {
+	s.sendMu.Lock()
+
+	select {
+	case <-s.done:
+		s.sendMu.Unlock()
+		return false, nil
+	default:
+	}
+
+	select {
+	case s.ch <- msg:
+		s.sendMu.Unlock()
+		return true, nil
+	default:
+	}
+
+	switch s.policy {
+	case DropOldest:
+		if cap(s.ch) == 0 {
+			// Nothing is buffered to make room, so the new message goes.
+			s.sendMu.Unlock()
+			s.drop(ctx)
+			return false, nil
+		}
+		for {
+			select {
+			case <-s.ch:
+				s.drop(ctx)
+			default:
+			}
+			select {
+			case s.ch <- msg:
+				s.sendMu.Unlock()
+				return true, nil
+			default:
+			}
+		}
+
+	case Disconnect:
+		s.sendMu.Unlock()
+		s.drop(ctx)
+		s.end(ErrSlowConsumer)
+
+		obs := s.broker.obs.WithContext(ctx)
+		obs.Metrics.Inc("ion_broadcast_disconnected_total", "broker_name", s.broker.name, "topic", s.topic)
+		obs.Logger.Warn("slow subscriber disconnected", "broker_name", s.broker.name, "topic", s.topic)
+		return false, nil
+
+	case Block:
+		defer s.sendMu.Unlock()
+		select {
+		case s.ch <- msg:
+			return true, nil
+		case <-s.done:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+
+	default:
+		s.sendMu.Unlock()
+		s.drop(ctx)
+		return false, nil
+	}
+}
+
+func (s *Subscription[T]) drop(ctx context.Context) {
+	s.dropped.Add(1)
+	s.broker.obs.WithContext(ctx).Metrics.Inc("ion_broadcast_dropped_total", "broker_name", s.broker.name, "topic", s.topic)
+}
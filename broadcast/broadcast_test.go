@@ -0,0 +1,207 @@
+package broadcast_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/broadcast"
+)
+
+func drain[T any](sub *broadcast.Subscription[T]) []T {
+	var got []T
+	for {
+		select {
+		case v, ok := <-sub.C():
+			if !ok {
+				return got
+			}
+			got = append(got, v)
+		default:
+			return got
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	t.Run("fans out to topic subscribers", func(t *testing.T) {
+		b := broadcast.New[int]()
+		defer b.Close()
+
+		a, _ := b.Subscribe(context.Background(), "orders")
+		c, _ := b.Subscribe(context.Background(), "orders")
+		other, _ := b.Subscribe(context.Background(), "payments")
+
+		n, err := b.Publish(context.Background(), "orders", 1)
+		if err != nil || n != 2 {
+			t.Fatalf("expected delivery to 2 subscribers, got %d, %v", n, err)
+		}
+		if got := drain(a); len(got) != 1 || got[0] != 1 {
+			t.Errorf("unexpected messages for first subscriber: %v", got)
+		}
+		if got := drain(c); len(got) != 1 {
+			t.Errorf("unexpected messages for second subscriber: %v", got)
+		}
+		if got := drain(other); len(got) != 0 {
+			t.Errorf("expected no messages on other topic, got %v", got)
+		}
+	})
+
+	t.Run("drop discards new messages", func(t *testing.T) {
+		b := broadcast.New[int](broadcast.WithBufferSize(2))
+		sub, _ := b.Subscribe(context.Background(), "t")
+
+		for i := 1; i <= 4; i++ {
+			b.Publish(context.Background(), "t", i)
+		}
+		if got := drain(sub); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+			t.Errorf("expected [1 2], got %v", got)
+		}
+		if sub.Dropped() != 2 {
+			t.Errorf("expected 2 dropped, got %d", sub.Dropped())
+		}
+	})
+
+	t.Run("drop oldest keeps latest messages", func(t *testing.T) {
+		b := broadcast.New[int](broadcast.WithBufferSize(2), broadcast.WithPolicy(broadcast.DropOldest))
+		sub, _ := b.Subscribe(context.Background(), "t")
+
+		for i := 1; i <= 4; i++ {
+			b.Publish(context.Background(), "t", i)
+		}
+		if got := drain(sub); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+			t.Errorf("expected [3 4], got %v", got)
+		}
+	})
+
+	t.Run("disconnect ends slow subscriber", func(t *testing.T) {
+		b := broadcast.New[int]()
+		slow, _ := b.Subscribe(context.Background(), "t", broadcast.Buffer(1), broadcast.OnSlow(broadcast.Disconnect))
+		fast, _ := b.Subscribe(context.Background(), "t", broadcast.Buffer(8))
+
+		b.Publish(context.Background(), "t", 1)
+		b.Publish(context.Background(), "t", 2)
+
+		if !errors.Is(slow.Err(), broadcast.ErrSlowConsumer) {
+			t.Errorf("expected slow consumer error, got %v", slow.Err())
+		}
+		if got := drain(slow); len(got) != 1 || got[0] != 1 {
+			t.Errorf("expected buffered message before close, got %v", got)
+		}
+		if _, ok := <-slow.C(); ok {
+			t.Error("expected channel to be closed")
+		}
+		if got := drain(fast); len(got) != 2 {
+			t.Errorf("expected fast subscriber to get both messages, got %v", got)
+		}
+		if b.Subscribers("t") != 1 {
+			t.Errorf("expected 1 subscriber left, got %d", b.Subscribers("t"))
+		}
+	})
+
+	t.Run("block waits for room", func(t *testing.T) {
+		b := broadcast.New[int](broadcast.WithBufferSize(1), broadcast.WithPolicy(broadcast.Block))
+		sub, _ := b.Subscribe(context.Background(), "t")
+
+		b.Publish(context.Background(), "t", 1)
+
+		published := make(chan error, 1)
+		go func() {
+			_, err := b.Publish(context.Background(), "t", 2)
+			published <- err
+		}()
+
+		select {
+		case <-published:
+			t.Fatal("expected publisher to block")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		if v := <-sub.C(); v != 1 {
+			t.Errorf("expected 1, got %d", v)
+		}
+		if err := <-published; err != nil {
+			t.Errorf("unexpected publish error: %v", err)
+		}
+		if v := <-sub.C(); v != 2 {
+			t.Errorf("expected 2, got %d", v)
+		}
+	})
+
+	t.Run("block honors publish context", func(t *testing.T) {
+		b := broadcast.New[int](broadcast.WithBufferSize(0), broadcast.WithPolicy(broadcast.Block))
+		b.Subscribe(context.Background(), "t")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := b.Publish(ctx, "t", 1); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	})
+}
+
+func TestSubscription(t *testing.T) {
+	t.Run("context ends subscription", func(t *testing.T) {
+		b := broadcast.New[string]()
+		ctx, cancel := context.WithCancel(context.Background())
+		sub, _ := b.Subscribe(ctx, "t")
+
+		cancel()
+		select {
+		case <-sub.Done():
+		case <-time.After(time.Second):
+			t.Fatal("subscription did not end")
+		}
+		if sub.Err() != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", sub.Err())
+		}
+		if b.Subscribers("t") != 0 {
+			t.Errorf("expected subscriber to be removed, got %d", b.Subscribers("t"))
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		b := broadcast.New[string]()
+		sub, _ := b.Subscribe(context.Background(), "t")
+		if sub.Err() != nil {
+			t.Errorf("expected nil error while active, got %v", sub.Err())
+		}
+
+		sub.Close()
+		sub.Close()
+		if !errors.Is(sub.Err(), broadcast.ErrUnsubscribed) {
+			t.Errorf("expected unsubscribed, got %v", sub.Err())
+		}
+		if n, _ := b.Publish(context.Background(), "t", "x"); n != 0 {
+			t.Errorf("expected no delivery after close, got %d", n)
+		}
+	})
+
+	t.Run("broker close", func(t *testing.T) {
+		b := broadcast.New[string](broadcast.WithName("events"))
+		sub, _ := b.Subscribe(context.Background(), "t")
+
+		b.Close()
+		if !errors.Is(sub.Err(), broadcast.ErrClosed) {
+			t.Errorf("expected closed, got %v", sub.Err())
+		}
+		if _, err := b.Publish(context.Background(), "t", "x"); !errors.Is(err, broadcast.ErrClosed) {
+			t.Errorf("expected publish to fail after close, got %v", err)
+		}
+		if _, err := b.Subscribe(context.Background(), "t"); !errors.Is(err, broadcast.ErrClosed) {
+			t.Errorf("expected subscribe to fail after close, got %v", err)
+		}
+	})
+
+	t.Run("topics", func(t *testing.T) {
+		b := broadcast.New[int]()
+		b.Subscribe(context.Background(), "b")
+		b.Subscribe(context.Background(), "a")
+
+		if got := b.Topics(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+			t.Errorf("expected [a b], got %v", got)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrClosed is returned (wrapped) by Publish and Subscribe after the broker
+	// has been closed, and reported by Err for subscriptions it ended.
+	ErrClosed = errors.New("broker is closed")
+
+	// ErrSlowConsumer is reported by Err for subscriptions disconnected by the
+	// Disconnect policy.
+	ErrSlowConsumer = errors.New("subscriber too slow")
+
+	// ErrUnsubscribed is reported by Err for subscriptions ended by Close.
+	ErrUnsubscribed = errors.New("unsubscribed")
+)
+
+// BrokerError represents broker errors with context
+type BrokerError struct {
+	Op         string // operation that failed
+	BrokerName string // name of the broker
+	Topic      string // topic involved
+	Err        error  // underlying error
+}
+
+func (e *BrokerError) Error() string {
+	if e.BrokerName != "" {
+		return fmt.Sprintf("ion: broadcast %q %s %q: %v", e.BrokerName, e.Op, e.Topic, e.Err)
+	}
+	return fmt.Sprintf("ion: broadcast %s %q: %v", e.Op, e.Topic, e.Err)
+}
+
+func (e *BrokerError) Unwrap() error {
+	return e.Err
+}
+
+// NewBrokerClosedError creates an error indicating the broker is closed
+func NewBrokerClosedError(brokerName, op, topic string) error {
+	return &BrokerError{
+		Op:         op,
+		BrokerName: brokerName,
+		Topic:      topic,
+		Err:        ErrClosed,
+	}
+}
+
+// NewPublishError creates an error for a publish that did not reach every subscriber
+func NewPublishError(brokerName, topic string, err error) error {
+	return &BrokerError{
+		Op:         "publish",
+		BrokerName: brokerName,
+		Topic:      topic,
+		Err:        err,
+	}
+}
@@ -0,0 +1,403 @@
+// Package cache provides a stale-while-revalidate cache for protecting slow
+// dependencies.
+//
+// Get serves a cached value while it is fresh. Once its TTL has passed the
+// value turns stale: Get still returns it immediately but refreshes it in the
+// background on a workerpool, so callers never wait for the dependency while
+// a usable value exists. Only when a value is missing or past its stale
+// window does Get load it synchronously. Concurrent loads and refreshes of
+// the same key are collapsed into a single call, so a popular key expiring
+// never stampedes the dependency.
+//
+// Usage:
+//
+//	c := cache.New[string, *Profile](cache.WithStaleTTL(time.Minute))
+//	defer c.Close(context.Background())
+//
+//	p, err := c.Get(ctx, userID, 10*time.Second, func(ctx context.Context) (*Profile, error) {
+//		return profiles.Fetch(ctx, userID)
+//	})
+package cache
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Option configures cache behavior.
+type Option func(*config)
+
+type config struct {
+	name        string
+	pool        *workerpool.Pool
+	staleTTL    time.Duration
+	maxEntries  int
+	loadTimeout time.Duration
+	clock       clock.Clock
+	obs         *observe.Observability
+}
+
+// WithName sets the cache name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithPool sets the workerpool that runs background refreshes. The cache
+// creates and owns a small pool if none is given.
+func WithPool(pool *workerpool.Pool) Option {
+	return func(c *config) {
+		c.pool = pool
+	}
+}
+
+// WithStaleTTL sets how long after its TTL a value may still be served while
+// it is refreshed. By default it equals the TTL passed to Get.
+func WithStaleTTL(d time.Duration) Option {
+	return func(c *config) {
+		c.staleTTL = d
+	}
+}
+
+// WithMaxEntries bounds the number of cached keys. When the cache is full,
+// expired entries are dropped first, then the entry closest to expiry. Zero,
+// the default, means no bound.
+func WithMaxEntries(n int) Option {
+	return func(c *config) {
+		c.maxEntries = n
+	}
+}
+
+// WithLoadTimeout bounds every load and refresh. Loads run detached from the
+// context of the caller that triggered them, so that one caller giving up
+// does not fail the others waiting on the same load. Zero, the default, means
+// no timeout.
+func WithLoadTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.loadTimeout = d
+	}
+}
+
+// WithClock sets the clock used for expiry.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+type entry[V any] struct {
+	value      V
+	freshUntil time.Time
+	staleUntil time.Time
+}
+
+// call is a load or refresh in progress, shared by every caller of its key.
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Cache is a stale-while-revalidate cache safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	name        string
+	pool        *workerpool.Pool
+	ownsPool    bool
+	staleTTL    time.Duration
+	maxEntries  int
+	loadTimeout time.Duration
+	clock       clock.Clock
+	obs         *observe.Observability
+
+	mu      sync.Mutex
+	entries map[K]*entry[V]
+	calls   map[K]*call[V]
+	closed  bool
+}
+
+// New creates a cache.
+func New[K comparable, V any](opts ...Option) *Cache[K, V] {
+	cfg := &config{
+		name:  "",
+		clock: clock.Real(),
+		obs:   observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	c := &Cache[K, V]{
+		name:        cfg.name,
+		pool:        cfg.pool,
+		staleTTL:    cfg.staleTTL,
+		maxEntries:  cfg.maxEntries,
+		loadTimeout: cfg.loadTimeout,
+		clock:       cfg.clock,
+		obs:         cfg.obs,
+		entries:     make(map[K]*entry[V]),
+		calls:       make(map[K]*call[V]),
+	}
+
+	if c.pool == nil {
+		c.pool = workerpool.New(runtime.GOMAXPROCS(0), 256,
+			workerpool.WithName(cfg.name),
+			workerpool.WithLogger(cfg.obs.Logger),
+			workerpool.WithMetrics(cfg.obs.Metrics),
+			workerpool.WithTracer(cfg.obs.Tracer),
+		)
+		c.ownsPool = true
+	}
+
+	c.obs.Logger.Info("cache created", "name", c.name, "max_entries", c.maxEntries)
+
+	return c
+}
+
+// Name returns the cache name.
+func (c *Cache[K, V]) Name() string {
+	return c.name
+}
+
+// Get returns the value cached for key, loading it with fn if needed. A fresh
+// value is returned as is. A stale value, one older than ttl but within the
+// stale window, is returned immediately and refreshed in the background. A
+// missing or expired value is loaded synchronously; concurrent callers for
+// the same key share one call to fn. Failed loads are not cached, and a failed
+// refresh leaves the stale value in place.
+func (c *Cache[K, V]) Get(ctx context.Context, key K, ttl time.Duration, fn func(context.Context) (V, error)) (V, error) {
+	obs := c.obs.WithContext(ctx)
+
+	var zero V
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return zero, NewCacheClosedError(c.name)
+	}
+
+	if e, ok := c.entries[key]; ok {
+		if now.Before(e.freshUntil) {
+			c.mu.Unlock()
+			obs.Metrics.Inc("ion_cache_requests_total", "cache_name", c.name, "result", "hit")
+			return e.value, nil
+		}
+		if now.Before(e.staleUntil) {
+			c.refreshLocked(ctx, key, ttl, fn)
+			c.mu.Unlock()
+			obs.Metrics.Inc("ion_cache_requests_total", "cache_name", c.name, "result", "stale")
+			return e.value, nil
+		}
+		delete(c.entries, key)
+	}
+
+	cl, ok := c.calls[key]
+	if !ok {
+		cl = c.startLocked(key)
+		go c.load(ctx, key, ttl, fn, cl)
+	}
+	c.mu.Unlock()
+
+	obs.Metrics.Inc("ion_cache_requests_total", "cache_name", c.name, "result", "miss")
+
+	select {
+	case <-cl.done:
+		if cl.err != nil {
+			return zero, NewLoadError(c.name, cl.err)
+		}
+		return cl.value, nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Peek returns the value cached for key without loading or refreshing it. It
+// reports false if there is no value or it is past its stale window.
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok && now.Before(e.staleUntil) {
+		return e.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores value for key with the given TTL.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storeLocked(now, key, value, ttl)
+}
+
+// Delete removes key. A load of key already in progress still stores its
+// result when it completes.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Len returns the number of cached keys, including stale ones.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Close stops the cache. Further calls to Get fail, background refreshes in
+// progress are allowed to finish, and the internal pool, if the cache owns
+// one, is closed.
+func (c *Cache[K, V]) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.obs.WithContext(ctx).Logger.Info("cache closed", "name", c.name)
+
+	if c.ownsPool {
+		return c.pool.Close(ctx)
+	}
+	return nil
+}
+
+// startLocked registers a call for key. Must be called with c.mu held.
+func (c *Cache[K, V]) startLocked(key K) *call[V] {
+	cl := &call[V]{done: make(chan struct{})}
+	c.calls[key] = cl
+	return cl
+}
+
+// refreshLocked refreshes key in the background unless a load or refresh is
+// already in progress. Must be called with c.mu held.
+func (c *Cache[K, V]) refreshLocked(ctx context.Context, key K, ttl time.Duration, fn func(context.Context) (V, error)) {
+	if _, ok := c.calls[key]; ok {
+		return
+	}
+
+	cl := c.startLocked(key)
+	err := c.pool.TrySubmit(func(context.Context) error {
+		c.load(ctx, key, ttl, fn, cl)
+		return nil
+	})
+	if err != nil {
+		// Keep serving the stale value; the next Get tries again.
+		delete(c.calls, key)
+		close(cl.done)
+		obs := c.obs.WithContext(ctx)
+		obs.Metrics.Inc("ion_cache_refreshes_skipped_total", "cache_name", c.name)
+		obs.Logger.Warn("cache refresh not scheduled", "cache_name", c.name, "error", err)
+	}
+}
+
+// load runs fn for key, stores a successful result and completes cl.
+func (c *Cache[K, V]) load(ctx context.Context, key K, ttl time.Duration, fn func(context.Context) (V, error), cl *call[V]) {
+	obs := c.obs.WithContext(ctx)
+
+	ctx = context.WithoutCancel(ctx)
+	if c.loadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.loadTimeout)
+		defer cancel()
+	}
+
+	spanCtx, finish := obs.Tracer.Start(ctx, "cache.load", "cache_name", c.name)
+	v, err := fn(spanCtx)
+	finish(err)
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if err == nil {
+		c.storeLocked(c.clock.Now(), key, v, ttl)
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		obs.Metrics.Inc("ion_cache_loads_total", "cache_name", c.name, "result", "error")
+		obs.Logger.Warn("cache load failed", "cache_name", c.name, "error", err)
+	} else {
+		obs.Metrics.Inc("ion_cache_loads_total", "cache_name", c.name, "result", "success")
+	}
+
+	cl.value, cl.err = v, err
+	close(cl.done)
+}
+
+// storeLocked caches value for key, evicting if the cache is full. Must be
+// called with c.mu held.
+func (c *Cache[K, V]) storeLocked(now time.Time, key K, value V, ttl time.Duration) {
+	stale := c.staleTTL
+	if stale <= 0 {
+		stale = ttl
+	}
+
+	if _, ok := c.entries[key]; !ok && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evictLocked(now)
+	}
+
+	c.entries[key] = &entry[V]{
+		value:      value,
+		freshUntil: now.Add(ttl),
+		staleUntil: now.Add(ttl + stale),
+	}
+}
+
+// evictLocked makes room for one entry. Must be called with c.mu held.
+func (c *Cache[K, V]) evictLocked(now time.Time) {
+	var victim K
+	var victimUntil time.Time
+	found := false
+
+	for k, e := range c.entries {
+		if !now.Before(e.staleUntil) {
+			delete(c.entries, k)
+			continue
+		}
+		if !found || e.staleUntil.Before(victimUntil) {
+			victim, victimUntil, found = k, e.staleUntil, true
+		}
+	}
+
+	if len(c.entries) >= c.maxEntries && found {
+		delete(c.entries, victim)
+		c.obs.Metrics.Inc("ion_cache_evictions_total", "cache_name", c.name)
+	}
+}
@@ -0,0 +1,216 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/cache"
+	"github.com/kolosys/ion/clock"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGet(t *testing.T) {
+	t.Run("caches fresh values", func(t *testing.T) {
+		c := cache.New[string, int]()
+		defer c.Close(context.Background())
+
+		var loads atomic.Int32
+		load := func(ctx context.Context) (int, error) {
+			return int(loads.Add(1)), nil
+		}
+
+		for i := 0; i < 3; i++ {
+			v, err := c.Get(context.Background(), "k", time.Minute, load)
+			if err != nil || v != 1 {
+				t.Fatalf("expected 1, got %d, %v", v, err)
+			}
+		}
+		if loads.Load() != 1 {
+			t.Errorf("expected a single load, got %d", loads.Load())
+		}
+	})
+
+	t.Run("serves stale while refreshing", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		c := cache.New[string, int](cache.WithClock(clk))
+		defer c.Close(context.Background())
+
+		var loads atomic.Int32
+		release := make(chan struct{})
+		load := func(ctx context.Context) (int, error) {
+			n := loads.Add(1)
+			if n > 1 {
+				<-release
+			}
+			return int(n), nil
+		}
+
+		c.Get(context.Background(), "k", time.Second, load)
+		clk.Advance(1500 * time.Millisecond)
+
+		for i := 0; i < 5; i++ {
+			v, err := c.Get(context.Background(), "k", time.Second, load)
+			if err != nil || v != 1 {
+				t.Fatalf("expected stale value 1, got %d, %v", v, err)
+			}
+		}
+
+		close(release)
+		waitFor(t, func() bool {
+			v, _ := c.Peek("k")
+			return v == 2
+		})
+		if loads.Load() != 2 {
+			t.Errorf("expected one collapsed refresh, got %d loads", loads.Load())
+		}
+	})
+
+	t.Run("expired values load synchronously", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		c := cache.New[string, int](cache.WithClock(clk), cache.WithStaleTTL(time.Second))
+		defer c.Close(context.Background())
+
+		var loads atomic.Int32
+		load := func(ctx context.Context) (int, error) {
+			return int(loads.Add(1)), nil
+		}
+
+		c.Get(context.Background(), "k", time.Second, load)
+		clk.Advance(3 * time.Second)
+
+		if _, ok := c.Peek("k"); ok {
+			t.Error("expected expired value not to be served")
+		}
+		if v, _ := c.Get(context.Background(), "k", time.Second, load); v != 2 {
+			t.Errorf("expected reloaded value 2, got %d", v)
+		}
+	})
+
+	t.Run("collapses concurrent loads", func(t *testing.T) {
+		c := cache.New[string, int]()
+		defer c.Close(context.Background())
+
+		var loads atomic.Int32
+		release := make(chan struct{})
+		load := func(ctx context.Context) (int, error) {
+			loads.Add(1)
+			<-release
+			return 42, nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v, err := c.Get(context.Background(), "k", time.Minute, load); v != 42 || err != nil {
+					t.Errorf("expected 42, got %d, %v", v, err)
+				}
+			}()
+		}
+
+		waitFor(t, func() bool { return loads.Load() == 1 })
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if loads.Load() != 1 {
+			t.Errorf("expected a single load, got %d", loads.Load())
+		}
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		c := cache.New[string, int](cache.WithName("profiles"))
+		defer c.Close(context.Background())
+
+		boom := errors.New("boom")
+		_, err := c.Get(context.Background(), "k", time.Minute, func(ctx context.Context) (int, error) {
+			return 0, boom
+		})
+		if !errors.Is(err, boom) {
+			t.Fatalf("expected load error, got %v", err)
+		}
+
+		v, err := c.Get(context.Background(), "k", time.Minute, func(ctx context.Context) (int, error) {
+			return 7, nil
+		})
+		if v != 7 || err != nil {
+			t.Errorf("expected retry to load 7, got %d, %v", v, err)
+		}
+	})
+
+	t.Run("caller cancellation does not fail the load", func(t *testing.T) {
+		c := cache.New[string, int]()
+		defer c.Close(context.Background())
+
+		release := make(chan struct{})
+		load := func(ctx context.Context) (int, error) {
+			select {
+			case <-release:
+				return 1, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := c.Get(ctx, "k", time.Minute, load); err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+
+		close(release)
+		waitFor(t, func() bool {
+			_, ok := c.Peek("k")
+			return ok
+		})
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		c := cache.New[string, int]()
+		c.Close(context.Background())
+
+		_, err := c.Get(context.Background(), "k", time.Minute, func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		if !errors.Is(err, cache.ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	})
+}
+
+func TestMaxEntries(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	c := cache.New[string, int](cache.WithClock(clk), cache.WithMaxEntries(2))
+	defer c.Close(context.Background())
+
+	c.Set("a", 1, time.Second)
+	c.Set("b", 2, time.Minute)
+	c.Set("c", 3, time.Minute)
+
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+	if _, ok := c.Peek("a"); ok {
+		t.Error("expected the entry closest to expiry to be evicted")
+	}
+
+	c.Delete("b")
+	if _, ok := c.Peek("b"); ok {
+		t.Error("expected deleted entry to be gone")
+	}
+}
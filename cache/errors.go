@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrClosed is returned (wrapped) by Get after Close has been called.
+var ErrClosed = errors.New("cache is closed")
+
+// CacheError represents cache errors with context
+type CacheError struct {
+	Op        string // operation that failed
+	CacheName string // name of the cache
+	Err       error  // underlying error
+}
+
+func (e *CacheError) Error() string {
+	if e.CacheName != "" {
+		return fmt.Sprintf("ion: cache %q %s: %v", e.CacheName, e.Op, e.Err)
+	}
+	return fmt.Sprintf("ion: cache %s: %v", e.Op, e.Err)
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// NewCacheClosedError creates an error indicating the cache is closed
+func NewCacheClosedError(cacheName string) error {
+	return &CacheError{
+		Op:        "get",
+		CacheName: cacheName,
+		Err:       ErrClosed,
+	}
+}
+
+// NewLoadError creates an error for a failed load of a missing or expired value
+func NewLoadError(cacheName string, err error) error {
+	return &CacheError{
+		Op:        "load",
+		CacheName: cacheName,
+		Err:       err,
+	}
+}
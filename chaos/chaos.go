@@ -0,0 +1,338 @@
+// Package chaos provides fault injection for resilience testing.
+//
+// An Injector wraps calls and injects latency, errors or panics according to
+// configured faults, each firing by probability, on every nth call, or during
+// a time window. Wrapping the calls protected by a circuit breaker, rate
+// limiter, retry loop or worker pool makes it possible to verify those
+// settings under failure before production does it for you.
+//
+// Usage:
+//
+//	inj := chaos.New(chaos.WithFaults(
+//		chaos.Latency(200*time.Millisecond, chaos.Probability(0.2)),
+//		chaos.Error(errUpstream, chaos.Probability(0.05)),
+//	))
+//
+//	err := breaker.Call(ctx, inj.Wrap(callUpstream))
+//
+// Injectors can be switched off at runtime with Disable, so they can stay
+// wired in and be enabled only in test or staging environments.
+package chaos
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Metrics holds a snapshot of injector counters.
+type Metrics struct {
+	Calls   uint64 // calls that passed through the injector
+	Latency uint64 // latency faults injected
+	Errors  uint64 // error faults injected
+	Panics  uint64 // panic faults injected
+}
+
+// Option configures injector behavior.
+type Option func(*config)
+
+type config struct {
+	name     string
+	faults   []Fault
+	seed     uint64
+	seeded   bool
+	disabled bool
+	clock    clock.Clock
+	obs      *observe.Observability
+}
+
+// WithName sets the injector name for observability.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithFaults adds faults to the injector. Faults are evaluated in order on
+// every call; latency is applied before an error or panic fault fires.
+func WithFaults(faults ...Fault) Option {
+	return func(c *config) {
+		c.faults = append(c.faults, faults...)
+	}
+}
+
+// WithSeed makes fault selection deterministic.
+func WithSeed(seed uint64) Option {
+	return func(c *config) {
+		c.seed = seed
+		c.seeded = true
+	}
+}
+
+// WithEnabled sets whether the injector starts enabled. The default is true.
+func WithEnabled(enabled bool) Option {
+	return func(c *config) {
+		c.disabled = !enabled
+	}
+}
+
+// WithClock sets the clock used for injected latency and time windows.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// Injector injects faults into the calls it wraps.
+type Injector struct {
+	name   string
+	faults []Fault
+	epoch  time.Time
+	clock  clock.Clock
+	obs    *observe.Observability
+
+	enabled atomic.Bool
+
+	mu      sync.Mutex
+	rng     *rand.Rand
+	counts  []uint64 // calls seen per fault, for EveryN
+	metrics Metrics
+}
+
+// New creates an injector.
+func New(opts ...Option) *Injector {
+	cfg := &config{
+		name:  "",
+		clock: clock.Real(),
+		obs:   observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	seed := cfg.seed
+	if !cfg.seeded {
+		seed = rand.Uint64()
+	}
+
+	inj := &Injector{
+		name:   cfg.name,
+		faults: cfg.faults,
+		epoch:  cfg.clock.Now(),
+		clock:  cfg.clock,
+		obs:    cfg.obs,
+		rng:    rand.New(rand.NewPCG(seed, seed)),
+		counts: make([]uint64, len(cfg.faults)),
+	}
+	inj.enabled.Store(!cfg.disabled)
+
+	inj.obs.Logger.Info("chaos injector created",
+		"name", inj.name,
+		"faults", len(inj.faults),
+		"enabled", !cfg.disabled,
+	)
+
+	return inj
+}
+
+// Enable turns fault injection on.
+func (inj *Injector) Enable() {
+	inj.enabled.Store(true)
+}
+
+// Disable turns fault injection off; wrapped calls pass straight through.
+func (inj *Injector) Disable() {
+	inj.enabled.Store(false)
+}
+
+// Enabled reports whether fault injection is on.
+func (inj *Injector) Enabled() bool {
+	return inj.enabled.Load()
+}
+
+// Name returns the injector name.
+func (inj *Injector) Name() string {
+	return inj.name
+}
+
+// Metrics returns a snapshot of the injector counters.
+func (inj *Injector) Metrics() Metrics {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	return inj.metrics
+}
+
+// Do runs fn after injecting any faults that fire. An error fault returns its
+// error without running fn; a panic fault panics.
+func (inj *Injector) Do(ctx context.Context, fn func(context.Context) error) error {
+	if err := inj.Inject(ctx); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
+
+// Wrap returns a function that runs fn through the injector. The result can be
+// passed to a circuit breaker's Call, submitted to a workerpool, or used
+// directly as a workerpool.WithTaskWrapper.
+func (inj *Injector) Wrap(fn workerpool.Task) workerpool.Task {
+	return func(ctx context.Context) error {
+		return inj.Do(ctx, fn)
+	}
+}
+
+// Call runs fn through inj and returns its result. It suits functions with a
+// result, such as those passed to a circuit breaker's Execute.
+func Call[T any](ctx context.Context, inj *Injector, fn func(context.Context) (T, error)) (T, error) {
+	if err := inj.Inject(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+	return fn(ctx)
+}
+
+// Inject applies the faults that fire for one call: it sleeps for latency
+// faults, panics for panic faults and returns the error of an error fault.
+// It returns the context error if ctx is done while sleeping.
+func (inj *Injector) Inject(ctx context.Context) error {
+	fired := inj.roll(ctx, false)
+	if len(fired) == 0 {
+		return nil
+	}
+
+	var delay time.Duration
+	for _, f := range fired {
+		if f.kind == kindLatency {
+			delay += f.latency + inj.jitter(f)
+		}
+	}
+	if delay > 0 {
+		timer := inj.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	for _, f := range fired {
+		switch f.kind {
+		case kindPanic:
+			panic(f.panicValue)
+		case kindError:
+			return f.err
+		}
+	}
+	return nil
+}
+
+// roll advances the call counters and returns the faults that fire for a
+// call under ctx. Latency faults are skipped when nonBlocking is set.
+func (inj *Injector) roll(ctx context.Context, nonBlocking bool) []*Fault {
+	if !inj.enabled.Load() || len(inj.faults) == 0 {
+		return nil
+	}
+
+	now := inj.clock.Now()
+
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	inj.metrics.Calls++
+
+	var fired []*Fault
+	for i := range inj.faults {
+		f := &inj.faults[i]
+		if !f.active(now, inj.epoch) {
+			continue
+		}
+		if nonBlocking && f.kind == kindLatency {
+			continue
+		}
+
+		inj.counts[i]++
+		if f.everyN > 0 && inj.counts[i]%f.everyN != 0 {
+			continue
+		}
+		if f.probability < 1 && inj.rng.Float64() >= f.probability {
+			continue
+		}
+
+		switch f.kind {
+		case kindLatency:
+			inj.metrics.Latency++
+		case kindError:
+			inj.metrics.Errors++
+		case kindPanic:
+			inj.metrics.Panics++
+		}
+		inj.obs.WithContext(ctx).Metrics.Inc("ion_chaos_faults_injected_total", "injector", inj.name, "kind", f.kind.String())
+		fired = append(fired, f)
+	}
+
+	return fired
+}
+
+func (inj *Injector) jitter(f *Fault) time.Duration {
+	if f.jitter <= 0 {
+		return 0
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	return time.Duration(inj.rng.Int64N(int64(f.jitter)))
+}
+
+// Limiter wraps a rate limiter. AllowN denies events when an error or panic
+// fault fires; WaitN applies latency and returns injected errors before
+// waiting on the underlying limiter.
+func (inj *Injector) Limiter(l ratelimit.Limiter) ratelimit.Limiter {
+	return &limiter{inj: inj, l: l}
+}
+
+type limiter struct {
+	inj *Injector
+	l   ratelimit.Limiter
+}
+
+func (c *limiter) AllowN(now time.Time, n int) bool {
+	if len(c.inj.roll(context.Background(), true)) > 0 {
+		return false
+	}
+	return c.l.AllowN(now, n)
+}
+
+func (c *limiter) WaitN(ctx context.Context, n int) error {
+	if err := c.inj.Inject(ctx); err != nil {
+		return err
+	}
+	return c.l.WaitN(ctx, n)
+}
@@ -0,0 +1,165 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/chaos"
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+func noop(ctx context.Context) error { return nil }
+
+func TestInjector(t *testing.T) {
+	t.Run("error fault", func(t *testing.T) {
+		boom := errors.New("boom")
+		inj := chaos.New(chaos.WithFaults(chaos.Error(boom)))
+
+		ran := false
+		err := inj.Do(context.Background(), func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+		if !errors.Is(err, boom) {
+			t.Errorf("expected injected error, got %v", err)
+		}
+		if ran {
+			t.Error("expected fn not to run")
+		}
+	})
+
+	t.Run("every nth call", func(t *testing.T) {
+		inj := chaos.New(chaos.WithFaults(chaos.Error(nil, chaos.EveryN(3))))
+
+		failures := 0
+		for i := 0; i < 9; i++ {
+			if err := inj.Do(context.Background(), noop); errors.Is(err, chaos.ErrInjected) {
+				failures++
+			}
+		}
+		if failures != 3 {
+			t.Errorf("expected 3 failures, got %d", failures)
+		}
+	})
+
+	t.Run("probability", func(t *testing.T) {
+		inj := chaos.New(chaos.WithSeed(42), chaos.WithFaults(chaos.Error(nil, chaos.Probability(0.25))))
+
+		for i := 0; i < 2000; i++ {
+			inj.Do(context.Background(), noop)
+		}
+		m := inj.Metrics()
+		if m.Calls != 2000 || m.Errors < 400 || m.Errors > 600 {
+			t.Errorf("expected about 500 errors out of 2000, got %+v", m)
+		}
+	})
+
+	t.Run("latency respects context", func(t *testing.T) {
+		inj := chaos.New(chaos.WithFaults(chaos.Latency(time.Second)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if err := inj.Do(ctx, noop); err != context.DeadlineExceeded {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Error("latency did not stop at context deadline")
+		}
+	})
+
+	t.Run("latency and windows on the injector clock", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		inj := chaos.New(chaos.WithClock(clk), chaos.WithFaults(
+			chaos.Latency(time.Minute),
+			chaos.Error(nil, chaos.Between(time.Unix(0, 0).Add(time.Minute), time.Time{})),
+		))
+
+		done := make(chan error, 1)
+		go func() { done <- inj.Do(context.Background(), noop) }()
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+		if err := <-done; err != nil {
+			t.Errorf("expected only latency before the window, got %v", err)
+		}
+
+		go func() { done <- inj.Do(context.Background(), noop) }()
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+		if err := <-done; err == nil {
+			t.Error("expected the error fault to fire inside its window")
+		}
+	})
+
+	t.Run("panic fault", func(t *testing.T) {
+		inj := chaos.New(chaos.WithFaults(chaos.Panic("kaboom")))
+
+		defer func() {
+			if r := recover(); r != "kaboom" {
+				t.Errorf("expected injected panic, got %v", r)
+			}
+		}()
+		inj.Do(context.Background(), noop)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		inj := chaos.New(chaos.WithFaults(chaos.Error(nil)), chaos.WithEnabled(false))
+		if err := inj.Do(context.Background(), noop); err != nil {
+			t.Errorf("expected disabled injector to pass through, got %v", err)
+		}
+
+		inj.Enable()
+		if err := inj.Do(context.Background(), noop); err == nil {
+			t.Error("expected enabled injector to inject")
+		}
+	})
+
+	t.Run("time window", func(t *testing.T) {
+		inj := chaos.New(chaos.WithFaults(chaos.Error(nil, chaos.Between(time.Now().Add(time.Hour), time.Time{}))))
+		if err := inj.Do(context.Background(), noop); err != nil {
+			t.Errorf("expected fault outside its window not to fire, got %v", err)
+		}
+	})
+
+	t.Run("trips circuit breaker", func(t *testing.T) {
+		inj := chaos.New(chaos.WithFaults(chaos.Error(nil)))
+		cb := circuit.New("upstream", circuit.WithFailureThreshold(3))
+
+		for i := 0; i < 3; i++ {
+			cb.Call(context.Background(), inj.Wrap(noop))
+		}
+		if cb.State() != circuit.Open {
+			t.Errorf("expected open circuit, got %v", cb.State())
+		}
+	})
+
+	t.Run("call with result", func(t *testing.T) {
+		inj := chaos.New()
+		v, err := chaos.Call(context.Background(), inj, func(ctx context.Context) (int, error) {
+			return 7, nil
+		})
+		if v != 7 || err != nil {
+			t.Errorf("expected 7, got %d, %v", v, err)
+		}
+	})
+
+	t.Run("limiter", func(t *testing.T) {
+		inj := chaos.New(chaos.WithFaults(chaos.Error(nil, chaos.EveryN(2))))
+		l := inj.Limiter(ratelimit.NewTokenBucket(ratelimit.PerSecond(1000), 1000))
+
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			if l.AllowN(time.Now(), 1) {
+				allowed++
+			}
+		}
+		if allowed != 5 {
+			t.Errorf("expected half the events denied, got %d allowed", allowed)
+		}
+	})
+}
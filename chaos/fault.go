@@ -0,0 +1,136 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInjected is the error returned by Error faults created with a nil error.
+var ErrInjected = errors.New("ion: chaos injected fault")
+
+// faultKind identifies what a fault does.
+type faultKind int
+
+const (
+	kindLatency faultKind = iota
+	kindError
+	kindPanic
+)
+
+// String returns the string representation of the fault kind.
+func (k faultKind) String() string {
+	switch k {
+	case kindLatency:
+		return "latency"
+	case kindError:
+		return "error"
+	case kindPanic:
+		return "panic"
+	default:
+		return fmt.Sprintf("faultKind(%d)", int(k))
+	}
+}
+
+// Fault describes one kind of failure to inject and when to inject it.
+// Without Probability or EveryN a fault fires on every call while active.
+type Fault struct {
+	kind        faultKind
+	latency     time.Duration
+	jitter      time.Duration
+	err         error
+	panicValue  any
+	probability float64
+	everyN      uint64
+	start, end  time.Time
+	on, off     time.Duration
+}
+
+// FaultOption configures when a fault fires.
+type FaultOption func(*Fault)
+
+// Probability makes the fault fire on a random fraction p (0 to 1) of calls.
+func Probability(p float64) FaultOption {
+	return func(f *Fault) {
+		f.probability = min(max(p, 0), 1)
+	}
+}
+
+// EveryN makes the fault fire on every nth call.
+func EveryN(n uint64) FaultOption {
+	return func(f *Fault) {
+		f.everyN = n
+	}
+}
+
+// Jitter adds a random extra delay of up to d to a Latency fault.
+func Jitter(d time.Duration) FaultOption {
+	return func(f *Fault) {
+		f.jitter = d
+	}
+}
+
+// Between restricts the fault to calls made between start and end. A zero
+// end leaves the window open.
+func Between(start, end time.Time) FaultOption {
+	return func(f *Fault) {
+		f.start = start
+		f.end = end
+	}
+}
+
+// Window makes the fault alternate between active for on and inactive for
+// off, starting active when the injector is created. It is useful for
+// simulating a dependency that fails in bursts.
+func Window(on, off time.Duration) FaultOption {
+	return func(f *Fault) {
+		f.on = on
+		f.off = off
+	}
+}
+
+// Latency delays calls by d.
+func Latency(d time.Duration, opts ...FaultOption) Fault {
+	return newFault(Fault{kind: kindLatency, latency: d}, opts)
+}
+
+// Error fails calls with err without running them. A nil err uses ErrInjected.
+func Error(err error, opts ...FaultOption) Fault {
+	if err == nil {
+		err = ErrInjected
+	}
+	return newFault(Fault{kind: kindError, err: err}, opts)
+}
+
+// Panic panics with v instead of running calls. A nil v uses a default message.
+func Panic(v any, opts ...FaultOption) Fault {
+	if v == nil {
+		v = "chaos: injected panic"
+	}
+	return newFault(Fault{kind: kindPanic, panicValue: v}, opts)
+}
+
+func newFault(f Fault, opts []FaultOption) Fault {
+	f.probability = 1
+	for _, opt := range opts {
+		opt(&f)
+	}
+	return f
+}
+
+// active reports whether the fault's time window includes now.
+func (f *Fault) active(now, epoch time.Time) bool {
+	if !f.start.IsZero() && now.Before(f.start) {
+		return false
+	}
+	if !f.end.IsZero() && !now.Before(f.end) {
+		return false
+	}
+	if f.on > 0 {
+		period := f.on + f.off
+		if now.Sub(epoch)%period >= f.on {
+			return false
+		}
+	}
+	return true
+}
@@ -153,7 +153,7 @@ func BenchmarkCircuitBreakerAllowRequest_Closed(b *testing.B) {
 
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			_ = cb.allowRequest()
+			_, _ = cb.allowRequest()
 		}
 	})
 }
@@ -172,7 +172,7 @@ func BenchmarkCircuitBreakerAllowRequest_Open(b *testing.B) {
 
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			_ = cb.allowRequest()
+			_, _ = cb.allowRequest()
 		}
 	})
 }
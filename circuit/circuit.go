@@ -27,9 +27,15 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/kolosys/ion/clock"
 	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
 )
 
+// logThrottleRate bounds how often the same warning is logged on the request
+// path, so a breaker rejecting heavy traffic logs it once per period.
+var logThrottleRate = ratelimit.Per(1, 10*time.Second)
+
 // CircuitBreaker represents a circuit breaker that controls access to a potentially
 // failing operation. It provides fast-fail behavior when the operation is failing
 // and automatic recovery testing when appropriate.
@@ -42,6 +48,11 @@ type CircuitBreaker interface {
 	// It's equivalent to Execute but discards the return value.
 	Call(ctx context.Context, fn func(context.Context) error) error
 
+	// ExecuteAttempt is like Execute but passes fn an Attempt describing the
+	// breaker at admission, so it can adapt, e.g. by using a cheaper query
+	// path while probing recovery.
+	ExecuteAttempt(ctx context.Context, fn func(context.Context, Attempt) (any, error)) (any, error)
+
 	// State returns the current state of the circuit breaker.
 	State() State
 
@@ -72,17 +83,27 @@ type circuitBreaker struct {
 	lastFailure     atomic.Int64 // unix nano timestamp
 	lastSuccess     atomic.Int64 // unix nano timestamp
 	lastStateChange atomic.Int64 // unix nano timestamp
+	trips           atomic.Int64 // consecutive trips without recovering to closed
+	openTimeout     atomic.Int64 // current open period, as a duration
+	lastErr         atomic.Value // errorValue of the last completed call
 
 	// Metrics (atomic access only)
 	totalRequests  atomic.Int64
 	totalFailures  atomic.Int64
 	totalSuccesses atomic.Int64
 	stateChanges   atomic.Int64
+	shadowRejects  atomic.Int64
+	outcomes       *outcomeRing // nil if the history is disabled
 
 	// Observability
-	obs *observe.Observability
+	obs       *observe.Observability
+	rejectLog observe.Logger // rejection warnings, throttled
 }
 
+// errorValue wraps an error, which may be nil, for storage in an
+// atomic.Value.
+type errorValue struct{ err error }
+
 // New creates a new circuit breaker with the given name and options.
 func New(name string, options ...Option) CircuitBreaker {
 	cb := &circuitBreaker{
@@ -96,15 +117,55 @@ func New(name string, options ...Option) CircuitBreaker {
 		option(cb.config, cb.obs)
 	}
 
+	return cb.init()
+}
+
+// NewFromConfig creates a circuit breaker from config, as loaded from a
+// configuration file. Zero thresholds and timeouts take their DefaultConfig
+// values. Options are applied after the configuration, so they can supply
+// what a configuration file cannot, such as a failure predicate or
+// observability hooks, or override configured values. The resulting
+// configuration is validated.
+func NewFromConfig(name string, config Config, options ...Option) (CircuitBreaker, error) {
+	config.SetDefaults()
+	cb := &circuitBreaker{
+		name:   name,
+		config: &config,
+		obs:    observe.New(),
+	}
+
+	for _, option := range options {
+		option(cb.config, cb.obs)
+	}
+
+	if err := cb.config.Validate(); err != nil {
+		return nil, &CircuitError{Op: "config", CircuitName: name, State: Closed.String(), Err: err}
+	}
+
+	return cb.init(), nil
+}
+
+// init completes a circuit breaker whose configuration and observability
+// hooks are set.
+func (cb *circuitBreaker) init() *circuitBreaker {
+	if cb.config.Clock == nil {
+		cb.config.Clock = clock.Real()
+	}
+	cb.outcomes = newOutcomeRing(cb.config.OutcomeHistory)
+	cb.rejectLog = ratelimit.NewThrottledLogger(cb.obs.Logger, logThrottleRate, 1,
+		ratelimit.WithClock(cb.config.Clock))
+
 	// Initialize state
 	cb.state.Store(int32(Closed))
-	now := time.Now().UnixNano()
+	now := cb.config.Clock.Now().UnixNano()
 	cb.lastStateChange.Store(now)
+	cb.openTimeout.Store(int64(cb.config.RecoveryTimeout))
 
 	cb.obs.Logger.Info("circuit breaker created",
-		"name", name,
+		"name", cb.name,
 		"failure_threshold", cb.config.FailureThreshold,
 		"recovery_timeout", cb.config.RecoveryTimeout,
+		"shadow", cb.config.Shadow,
 	)
 
 	return cb
@@ -112,42 +173,92 @@ func New(name string, options ...Option) CircuitBreaker {
 
 // Execute implements CircuitBreaker.Execute
 func (cb *circuitBreaker) Execute(ctx context.Context, fn func(context.Context) (any, error)) (any, error) {
+	return cb.ExecuteAttempt(ctx, func(ctx context.Context, _ Attempt) (any, error) {
+		return fn(ctx)
+	})
+}
+
+// ExecuteAttempt implements CircuitBreaker.ExecuteAttempt
+func (cb *circuitBreaker) ExecuteAttempt(ctx context.Context, fn func(context.Context, Attempt) (any, error)) (any, error) {
+	obs := cb.obs.WithContext(ctx)
+
 	// Fast path: check if we should allow the request
-	if !cb.allowRequest() {
-		cb.obs.Metrics.Inc("circuit.requests_rejected", "name", cb.name, "state", cb.State().String())
-		return nil, NewCircuitOpenError(cb.name)
+	state, allowed := cb.allowRequest()
+	shadowed := false
+	if !allowed {
+		if !cb.config.Shadow {
+			obs.Metrics.Inc("circuit.requests_rejected", "name", cb.name, "state", cb.State().String())
+			observe.CorrelatedLogger(ctx, cb.rejectLog).Warn("circuit breaker open, rejecting requests", "name", cb.name)
+			return nil, NewCircuitOpenError(cb.name)
+		}
+		// Shadow mode: let the call through but record that it would
+		// have been rejected
+		shadowed = true
+		cb.shadowRejects.Add(1)
+		obs.Metrics.Inc("circuit.requests_shadow_rejected", "name", cb.name, "state", state.String())
+		obs.Logger.Debug("circuit breaker would reject request", "name", cb.name, "state", state.String())
 	}
 
 	// Increment total requests
 	cb.totalRequests.Add(1)
-	cb.obs.Metrics.Inc("circuit.requests_total", "name", cb.name, "state", cb.State().String())
+	obs.Metrics.Inc("circuit.requests_total", "name", cb.name, "state", cb.State().String())
 
 	// Create tracing span
-	spanCtx, finish := cb.obs.Tracer.Start(ctx, "circuit.execute", "name", cb.name)
+	spanCtx, finish := obs.Tracer.Start(ctx, "circuit.execute", "name", cb.name)
 	defer func() { finish(nil) }()
 
-	// Execute the function
-	start := time.Now()
-	result, err := fn(spanCtx)
-	duration := time.Since(start)
+	attempt := Attempt{
+		Decision: Decision{
+			Name:     cb.name,
+			State:    state,
+			Probe:    state == HalfOpen && !shadowed,
+			Shadowed: shadowed,
+		},
+		ConsecutiveFailures: cb.failures.Load(),
+	}
+	if v, ok := cb.lastErr.Load().(errorValue); ok {
+		attempt.PrevErr = v.err
+	}
+	spanCtx = withDecision(spanCtx, attempt.Decision)
 
-	cb.obs.Metrics.Histogram("circuit.request_duration", duration.Seconds(), "name", cb.name)
+	// Execute the function
+	start := cb.config.Clock.Now()
+	result, err := fn(spanCtx, attempt)
+	duration := cb.config.Clock.Since(start)
+	cb.lastErr.Store(errorValue{err})
+
+	obs.Metrics.Histogram("circuit.request_duration", duration.Seconds(), "name", cb.name)
+
+	outcome := Outcome{
+		Time:     start,
+		Duration: duration,
+		Result:   ResultSuccess,
+		State:    state,
+		Shadowed: shadowed,
+	}
 
 	// Record the result
 	if err != nil {
+		outcome.Err = err.Error()
+
 		// Check if this error should count as a failure
 		isFailure := cb.config.IsFailure == nil || cb.config.IsFailure(err)
 		if isFailure {
-			cb.recordFailure()
-			cb.obs.Metrics.Inc("circuit.requests_failed", "name", cb.name)
+			outcome.Result = ResultFailure
+			cb.outcomes.add(outcome)
+			cb.record(false, shadowed)
+			obs.Metrics.Inc("circuit.requests_failed", "name", cb.name)
 		} else {
-			cb.recordSuccess()
-			cb.obs.Metrics.Inc("circuit.requests_succeeded", "name", cb.name)
+			outcome.Result = ResultIgnored
+			cb.outcomes.add(outcome)
+			cb.record(true, shadowed)
+			obs.Metrics.Inc("circuit.requests_succeeded", "name", cb.name)
 		}
-		cb.obs.Logger.Debug("circuit breaker request failed", "name", cb.name, "error", err, "counted_as_failure", isFailure)
+		obs.Logger.Debug("circuit breaker request failed", "name", cb.name, "error", err, "counted_as_failure", isFailure)
 	} else {
-		cb.recordSuccess()
-		cb.obs.Metrics.Inc("circuit.requests_succeeded", "name", cb.name)
+		cb.outcomes.add(outcome)
+		cb.record(true, shadowed)
+		obs.Metrics.Inc("circuit.requests_succeeded", "name", cb.name)
 	}
 
 	return result, err
@@ -176,9 +287,11 @@ func (cb *circuitBreaker) Metrics() CircuitMetrics {
 		TotalSuccesses:   cb.totalSuccesses.Load(),
 		ConsecutiveFails: cb.failures.Load(),
 		StateChanges:     cb.stateChanges.Load(),
+		ShadowRejections: cb.shadowRejects.Load(),
 		LastFailure:      time.Unix(0, cb.lastFailure.Load()),
 		LastSuccess:      time.Unix(0, cb.lastSuccess.Load()),
 		LastStateChange:  time.Unix(0, cb.lastStateChange.Load()),
+		RecentOutcomes:   cb.outcomes.snapshot(),
 	}
 }
 
@@ -197,41 +310,60 @@ func (cb *circuitBreaker) Close() error {
 	return nil
 }
 
-// allowRequest determines if a request should be allowed based on current state
-func (cb *circuitBreaker) allowRequest() bool {
+// allowRequest determines if a request should be allowed based on current state.
+// It returns the state the request is admitted in.
+func (cb *circuitBreaker) allowRequest() (State, bool) {
 	state := cb.State()
-	now := time.Now()
+	now := cb.config.Clock.Now()
 
 	switch state {
 	case Closed:
-		return true
+		return Closed, true
 
 	case Open:
 		// Check if recovery timeout has passed
 		lastStateChange := time.Unix(0, cb.lastStateChange.Load())
-		if now.Sub(lastStateChange) >= cb.config.RecoveryTimeout {
+		if now.Sub(lastStateChange) >= time.Duration(cb.openTimeout.Load()) {
 			// Transition to half-open for testing
 			if cb.setState(HalfOpen) {
 				cb.obs.Logger.Info("circuit breaker transitioning to half-open", "name", cb.name)
 			}
-			return true
+			return HalfOpen, true
 		}
-		return false
+		return Open, false
 
 	case HalfOpen:
 		// Allow limited requests in half-open state
 		successes := cb.successes.Load()
-		return successes < cb.config.HalfOpenMaxRequests
+		return HalfOpen, successes < cb.config.HalfOpenMaxRequests
+
+	default:
+		return state, false
+	}
+}
 
+// record records the outcome of an operation. A shadowed operation would
+// have been rejected outside of shadow mode, so it only counts towards the
+// totals and does not move the state machine.
+func (cb *circuitBreaker) record(success, shadowed bool) {
+	switch {
+	case !shadowed && success:
+		cb.recordSuccess()
+	case !shadowed:
+		cb.recordFailure()
+	case success:
+		cb.totalSuccesses.Add(1)
+		cb.lastSuccess.Store(cb.config.Clock.Now().UnixNano())
 	default:
-		return false
+		cb.totalFailures.Add(1)
+		cb.lastFailure.Store(cb.config.Clock.Now().UnixNano())
 	}
 }
 
 // recordSuccess records a successful operation
 func (cb *circuitBreaker) recordSuccess() {
 	cb.totalSuccesses.Add(1)
-	cb.lastSuccess.Store(time.Now().UnixNano())
+	cb.lastSuccess.Store(cb.config.Clock.Now().UnixNano())
 
 	state := cb.State()
 	switch state {
@@ -253,7 +385,7 @@ func (cb *circuitBreaker) recordSuccess() {
 // recordFailure records a failed operation
 func (cb *circuitBreaker) recordFailure() {
 	cb.totalFailures.Add(1)
-	cb.lastFailure.Store(time.Now().UnixNano())
+	cb.lastFailure.Store(cb.config.Clock.Now().UnixNano())
 
 	state := cb.State()
 	switch state {
@@ -282,9 +414,16 @@ func (cb *circuitBreaker) setState(newState State) bool {
 		// State changed - reset counters and update metrics
 		cb.failures.Store(0)
 		cb.successes.Store(0)
-		cb.lastStateChange.Store(time.Now().UnixNano())
+		cb.lastStateChange.Store(cb.config.Clock.Now().UnixNano())
 		cb.stateChanges.Add(1)
 
+		switch newState {
+		case Open:
+			cb.openTimeout.Store(int64(cb.nextOpenTimeout(cb.trips.Add(1))))
+		case Closed:
+			cb.trips.Store(0)
+		}
+
 		cb.obs.Metrics.Inc("circuit.state_changes",
 			"name", cb.name,
 			"from", oldState.String(),
@@ -299,3 +438,18 @@ func (cb *circuitBreaker) setState(newState State) bool {
 	}
 	return false
 }
+
+// nextOpenTimeout returns the open period for the given consecutive trip.
+func (cb *circuitBreaker) nextOpenTimeout(trip int64) time.Duration {
+	if cb.config.RecoveryBackoff == nil {
+		return cb.config.RecoveryTimeout
+	}
+	prev := time.Duration(0)
+	if trip > 1 {
+		prev = time.Duration(cb.openTimeout.Load())
+	}
+	if d := cb.config.RecoveryBackoff(int(trip), prev); d > 0 {
+		return d
+	}
+	return cb.config.RecoveryTimeout
+}
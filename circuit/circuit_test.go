@@ -8,6 +8,10 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
 )
 
 func TestCircuitBreakerBasicFunctionality(t *testing.T) {
@@ -379,6 +383,77 @@ func TestCircuitBreakerHalfOpenTransition(t *testing.T) {
 	}
 }
 
+func TestCircuitBreakerWithFakeClock(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	cb := New("test-circuit",
+		WithFailureThreshold(1),
+		WithRecoveryTimeout(time.Minute),
+		WithHalfOpenSuccessThreshold(1),
+		WithClock(clk),
+	)
+
+	ctx := context.Background()
+	cb.Call(ctx, func(ctx context.Context) error { return errors.New("failure") })
+
+	clk.Advance(59 * time.Second)
+	if err := cb.Call(ctx, func(ctx context.Context) error { return nil }); err == nil {
+		t.Error("expected circuit to stay open before the recovery timeout")
+	}
+
+	clk.Advance(time.Second)
+	if err := cb.Call(ctx, func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("expected request after recovery timeout to pass, got %v", err)
+	}
+	if cb.State() != Closed {
+		t.Errorf("expected state to be Closed after recovery, got %v", cb.State())
+	}
+	if got := cb.Metrics().LastStateChange; !got.Equal(clk.Now()) {
+		t.Errorf("expected state change at fake time %v, got %v", clk.Now(), got)
+	}
+}
+
+func TestCircuitBreakerRecoveryBackoff(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	cb := New("test-circuit",
+		WithFailureThreshold(1),
+		WithRecoveryTimeout(time.Second),
+		WithRecoveryBackoff(backoff.Exponential(time.Second)),
+		WithHalfOpenSuccessThreshold(1),
+		WithClock(clk),
+	)
+
+	ctx := context.Background()
+	fail := func(ctx context.Context) error { return errors.New("failure") }
+	succeed := func(ctx context.Context) error { return nil }
+
+	// Each failed recovery test doubles the open period: 1s, 2s, 4s.
+	cb.Call(ctx, fail)
+	for _, open := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		clk.Advance(open - time.Millisecond)
+		if err := cb.Call(ctx, succeed); err == nil {
+			t.Fatalf("expected circuit to stay open before %v", open)
+		}
+		clk.Advance(time.Millisecond)
+		if open < 4*time.Second {
+			cb.Call(ctx, fail)
+		}
+	}
+
+	if err := cb.Call(ctx, succeed); err != nil {
+		t.Fatalf("expected recovery test to pass, got %v", err)
+	}
+	if cb.State() != Closed {
+		t.Fatalf("expected state to be Closed, got %v", cb.State())
+	}
+
+	// Recovering resets the backoff.
+	cb.Call(ctx, fail)
+	clk.Advance(time.Second)
+	if err := cb.Call(ctx, succeed); err != nil {
+		t.Errorf("expected backoff to restart after recovery, got %v", err)
+	}
+}
+
 func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
 	cb := New("test-circuit",
 		WithFailureThreshold(1),
@@ -456,6 +531,277 @@ func TestCircuitBreakerHalfOpenMaxRequests(t *testing.T) {
 	}
 }
 
+func TestCircuitBreakerDecisionContext(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	cb := New("payments",
+		WithFailureThreshold(1),
+		WithRecoveryTimeout(time.Second),
+		WithClock(clk),
+	)
+
+	var got Decision
+	var ok bool
+	capture := func(ctx context.Context) error {
+		got, ok = DecisionFromContext(ctx)
+		return nil
+	}
+
+	if _, found := DecisionFromContext(context.Background()); found {
+		t.Error("expected no decision outside of a call")
+	}
+
+	cb.Call(context.Background(), capture)
+	if !ok || got != (Decision{Name: "payments", State: Closed}) {
+		t.Errorf("unexpected closed decision %+v (found %v)", got, ok)
+	}
+
+	cb.Call(context.Background(), func(ctx context.Context) error { return errors.New("failure") })
+	clk.Advance(time.Second)
+
+	cb.Call(context.Background(), capture)
+	if !ok || got != (Decision{Name: "payments", State: HalfOpen, Probe: true}) {
+		t.Errorf("expected a half-open probe, got %+v (found %v)", got, ok)
+	}
+}
+
+func TestCircuitBreakerExecuteAttempt(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	cb := New("db",
+		WithFailureThreshold(2),
+		WithRecoveryTimeout(time.Second),
+		WithClock(clk),
+	)
+	boom := errors.New("boom")
+
+	var attempts []Attempt
+	run := func(err error) {
+		cb.ExecuteAttempt(context.Background(), func(ctx context.Context, a Attempt) (any, error) {
+			attempts = append(attempts, a)
+			return nil, err
+		})
+	}
+
+	run(nil)
+	run(boom)
+	run(boom) // trips the circuit
+	clk.Advance(time.Second)
+	run(nil) // half-open probe
+
+	want := []Attempt{
+		{Decision: Decision{Name: "db", State: Closed}},
+		{Decision: Decision{Name: "db", State: Closed}},
+		{Decision: Decision{Name: "db", State: Closed}, ConsecutiveFailures: 1, PrevErr: boom},
+		{Decision: Decision{Name: "db", State: HalfOpen, Probe: true}, PrevErr: boom},
+	}
+	if len(attempts) != len(want) {
+		t.Fatalf("expected %d attempts, got %d", len(want), len(attempts))
+	}
+	for i := range want {
+		if attempts[i] != want[i] {
+			t.Errorf("attempt %d: expected %+v, got %+v", i, want[i], attempts[i])
+		}
+	}
+}
+
+func TestCircuitBreakerCorrelationID(t *testing.T) {
+	logger := &fieldLogger{}
+	tracer := &fieldTracer{}
+	cb := New("db",
+		WithFailureThreshold(1),
+		WithLogger(logger),
+		WithTracer(tracer),
+	)
+	ctx := observe.WithCorrelationID(context.Background(), "req-42")
+
+	cb.Execute(ctx, func(ctx context.Context) (any, error) {
+		return nil, errors.New("boom")
+	})
+	cb.Execute(ctx, func(ctx context.Context) (any, error) {
+		return nil, nil
+	})
+
+	for _, msg := range []string{"circuit breaker request failed", "circuit breaker open, rejecting requests"} {
+		if got := logger.fields[msg]["correlation_id"]; got != "req-42" {
+			t.Errorf("%q: expected correlation_id req-42, got %v", msg, got)
+		}
+	}
+	if got := tracer.fields["circuit.execute"]["correlation_id"]; got != "req-42" {
+		t.Errorf("span: expected correlation_id req-42, got %v", got)
+	}
+
+	// Without a correlation ID no field is added
+	logger.fields = nil
+	cb.Reset()
+	cb.Execute(context.Background(), func(ctx context.Context) (any, error) {
+		return nil, errors.New("boom")
+	})
+	if _, ok := logger.fields["circuit breaker request failed"]["correlation_id"]; ok {
+		t.Error("expected no correlation_id without one in the context")
+	}
+}
+
+// fieldLogger records the fields of the last line logged for each message.
+type fieldLogger struct {
+	observe.NopLogger
+	mu     sync.Mutex
+	fields map[string]map[any]any
+}
+
+func (l *fieldLogger) record(msg string, kv []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fields == nil {
+		l.fields = make(map[string]map[any]any)
+	}
+	l.fields[msg] = fieldMap(kv)
+}
+
+func (l *fieldLogger) Debug(msg string, kv ...any) { l.record(msg, kv) }
+func (l *fieldLogger) Warn(msg string, kv ...any)  { l.record(msg, kv) }
+
+// fieldTracer records the attributes of the last span started for each name.
+type fieldTracer struct {
+	mu     sync.Mutex
+	fields map[string]map[any]any
+}
+
+func (t *fieldTracer) Start(ctx context.Context, name string, kv ...any) (context.Context, func(error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fields == nil {
+		t.fields = make(map[string]map[any]any)
+	}
+	t.fields[name] = fieldMap(kv)
+	return ctx, func(error) {}
+}
+
+func fieldMap(kv []any) map[any]any {
+	m := make(map[any]any, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		m[kv[i]] = kv[i+1]
+	}
+	return m
+}
+
+func TestCircuitBreakerRecentOutcomes(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	ignored := errors.New("not found")
+	var atTrip []Outcome
+	var cb CircuitBreaker
+	cb = New("db",
+		WithFailureThreshold(2),
+		WithOutcomeHistory(3),
+		WithFailurePredicate(func(err error) bool { return !errors.Is(err, ignored) }),
+		WithStateChangeCallback(func(from, to State) {
+			if to == Open {
+				atTrip = cb.Metrics().RecentOutcomes
+			}
+		}),
+		WithClock(clk),
+	)
+
+	call := func(d time.Duration, err error) {
+		cb.Execute(context.Background(), func(ctx context.Context) (any, error) {
+			clk.Advance(d)
+			return nil, err
+		})
+	}
+	call(time.Millisecond, nil)
+	call(2*time.Millisecond, ignored)
+	call(3*time.Millisecond, errors.New("timeout"))
+	call(4*time.Millisecond, errors.New("connection refused")) // trips the circuit
+	call(0, nil)                                               // rejected, not recorded
+
+	want := []struct {
+		result   Result
+		duration time.Duration
+		err      string
+	}{
+		{ResultIgnored, 2 * time.Millisecond, "not found"},
+		{ResultFailure, 3 * time.Millisecond, "timeout"},
+		{ResultFailure, 4 * time.Millisecond, "connection refused"},
+	}
+	got := cb.Metrics().RecentOutcomes
+	if len(got) != len(want) {
+		t.Fatalf("expected %d outcomes, got %d: %+v", len(want), len(got), got)
+	}
+	for i, w := range want {
+		if got[i].Result != w.result || got[i].Duration != w.duration || got[i].Err != w.err || got[i].State != Closed {
+			t.Errorf("outcome %d: expected %v %v %q, got %+v", i, w.result, w.duration, w.err, got[i])
+		}
+	}
+	if !got[0].Time.Before(got[1].Time) {
+		t.Error("expected outcomes oldest first")
+	}
+	if len(atTrip) != 3 || atTrip[2].Err != "connection refused" {
+		t.Errorf("expected the tripping failure to be visible on state change, got %+v", atTrip)
+	}
+
+	disabled := New("db", WithOutcomeHistory(0))
+	disabled.Call(context.Background(), func(ctx context.Context) error { return nil })
+	if got := disabled.Metrics().RecentOutcomes; got != nil {
+		t.Errorf("expected no outcomes with the history disabled, got %+v", got)
+	}
+}
+
+func TestCircuitBreakerShadowMode(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	var transitions []State
+	cb := New("shadow",
+		WithFailureThreshold(2),
+		WithRecoveryTimeout(time.Second),
+		WithHalfOpenMaxRequests(1),
+		WithHalfOpenSuccessThreshold(1),
+		WithShadowMode(),
+		WithClock(clk),
+		WithStateChangeCallback(func(from, to State) { transitions = append(transitions, to) }),
+	)
+	fail := func(ctx context.Context) error { return errors.New("failure") }
+
+	cb.Call(context.Background(), fail)
+	cb.Call(context.Background(), fail)
+	if cb.State() != Open {
+		t.Fatalf("expected the circuit to trip, got %v", cb.State())
+	}
+
+	var calls int
+	var decision Decision
+	err := cb.Call(context.Background(), func(ctx context.Context) error {
+		calls++
+		decision, _ = DecisionFromContext(ctx)
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("expected the call to run, got err=%v calls=%d", err, calls)
+	}
+	if !decision.Shadowed || decision.State != Open {
+		t.Errorf("expected a shadowed decision in open state, got %+v", decision)
+	}
+	if cb.State() != Open {
+		t.Errorf("shadowed success must not move the state, got %v", cb.State())
+	}
+
+	// Recovery still goes through half-open
+	clk.Advance(time.Second)
+	cb.Call(context.Background(), func(ctx context.Context) error { return nil })
+	if cb.State() != Closed {
+		t.Errorf("expected the probe to close the circuit, got %v", cb.State())
+	}
+
+	want := []State{Open, HalfOpen, Closed}
+	if fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Errorf("expected transitions %v, got %v", want, transitions)
+	}
+
+	m := cb.Metrics()
+	if m.ShadowRejections != 1 {
+		t.Errorf("expected 1 shadow rejection, got %d", m.ShadowRejections)
+	}
+	if m.TotalRequests != 4 || m.TotalFailures != 2 || m.TotalSuccesses != 2 {
+		t.Errorf("unexpected totals %+v", m)
+	}
+}
+
 func TestCircuitBreakerConfigValidation(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,51 @@
+package circuit
+
+import "context"
+
+// Decision describes how the circuit breaker admitted a call. Execute stores
+// it in the context passed to fn so that downstream logging and middleware
+// can annotate requests, for example as circuit probes.
+type Decision struct {
+	// Name is the name of the circuit breaker.
+	Name string
+
+	// State is the state of the circuit when the call was admitted.
+	State State
+
+	// Probe reports whether the call is a half-open recovery probe.
+	Probe bool
+
+	// Shadowed reports whether the call would have been rejected and was
+	// let through only because the circuit breaker is in shadow mode.
+	Shadowed bool
+}
+
+// Attempt describes the breaker to a function run through ExecuteAttempt.
+type Attempt struct {
+	// Decision is how the breaker admitted the call.
+	Decision
+
+	// ConsecutiveFailures is the number of consecutive failures recorded in
+	// the current state when the call was admitted.
+	ConsecutiveFailures int64
+
+	// PrevErr is the error returned by the previous call through the
+	// breaker, or nil if it succeeded or there was none.
+	PrevErr error
+}
+
+// decisionKey is the context key for the Decision of the current call.
+type decisionKey struct{}
+
+// DecisionFromContext returns the circuit breaker decision for the call ctx
+// belongs to. The boolean is false outside of a call made through Execute or
+// Call. With nested breakers the innermost decision is returned.
+func DecisionFromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(Decision)
+	return d, ok
+}
+
+// withDecision returns a copy of ctx carrying d.
+func withDecision(ctx context.Context, d Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, d)
+}
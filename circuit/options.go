@@ -3,6 +3,8 @@ package circuit
 import (
 	"time"
 
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/clock"
 	"github.com/kolosys/ion/observe"
 )
 
@@ -23,6 +25,15 @@ func WithRecoveryTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithRecoveryBackoff grows the open period with each consecutive trip that
+// happens without a full recovery. The strategy receives the trip count and
+// the previous open period; RecoveryTimeout is used when it is not set.
+func WithRecoveryBackoff(strategy backoff.Strategy) Option {
+	return func(config *Config, obs *observe.Observability) {
+		config.RecoveryBackoff = strategy
+	}
+}
+
 // WithHalfOpenMaxRequests sets the maximum number of requests allowed in half-open state.
 func WithHalfOpenMaxRequests(maxRequests int64) Option {
 	return func(config *Config, obs *observe.Observability) {
@@ -53,6 +64,30 @@ func WithStateChangeCallback(callback func(from, to State)) Option {
 	}
 }
 
+// WithShadowMode runs the circuit breaker in observe-only mode: it tracks
+// state as usual but lets every call through. Calls that would have been
+// rejected are counted in the circuit.requests_shadow_rejected metric.
+func WithShadowMode() Option {
+	return func(config *Config, obs *observe.Observability) {
+		config.Shadow = true
+	}
+}
+
+// WithOutcomeHistory sets how many recent call outcomes are kept for
+// CircuitMetrics.RecentOutcomes. Zero disables the history.
+func WithOutcomeHistory(size int) Option {
+	return func(config *Config, obs *observe.Observability) {
+		config.OutcomeHistory = size
+	}
+}
+
+// WithClock sets a custom clock implementation (useful for testing).
+func WithClock(clk clock.Clock) Option {
+	return func(config *Config, obs *observe.Observability) {
+		config.Clock = clk
+	}
+}
+
 // WithObservability sets the observability hooks for logging, metrics, and tracing.
 func WithObservability(observability *observe.Observability) Option {
 	return func(config *Config, obs *observe.Observability) {
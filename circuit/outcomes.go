@@ -0,0 +1,110 @@
+package circuit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Result classifies the outcome of a call made through a circuit breaker.
+type Result int
+
+const (
+	// ResultSuccess indicates the call returned no error.
+	ResultSuccess Result = iota
+
+	// ResultFailure indicates the call returned an error that counted as a
+	// failure towards tripping the circuit.
+	ResultFailure
+
+	// ResultIgnored indicates the call returned an error that the failure
+	// predicate did not count as a failure.
+	ResultIgnored
+)
+
+// String returns the string representation of the result.
+func (r Result) String() string {
+	switch r {
+	case ResultSuccess:
+		return "success"
+	case ResultFailure:
+		return "failure"
+	case ResultIgnored:
+		return "ignored"
+	default:
+		return fmt.Sprintf("Result(%d)", int(r))
+	}
+}
+
+// Outcome records one call made through a circuit breaker.
+type Outcome struct {
+	// Time is when the call started
+	Time time.Time
+
+	// Duration is how long the call ran
+	Duration time.Duration
+
+	// Result classifies the call
+	Result Result
+
+	// State is the state the call was admitted in
+	State State
+
+	// Shadowed reports whether the call would have been rejected outside
+	// of shadow mode
+	Shadowed bool
+
+	// Err is the error message returned by the call, empty on success
+	Err string
+}
+
+// outcomeRing keeps the most recent outcomes, overwriting the oldest.
+type outcomeRing struct {
+	mu       sync.Mutex
+	outcomes []Outcome
+	next     int  // index of the slot to write next
+	full     bool // every slot has been written
+}
+
+// newOutcomeRing returns a ring holding up to size outcomes, or nil if size
+// is not positive.
+func newOutcomeRing(size int) *outcomeRing {
+	if size <= 0 {
+		return nil
+	}
+	return &outcomeRing{outcomes: make([]Outcome, size)}
+}
+
+// add records an outcome. It is a no-op on a nil ring.
+func (r *outcomeRing) add(o Outcome) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.outcomes[r.next] = o
+	r.next++
+	if r.next == len(r.outcomes) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// snapshot returns the recorded outcomes, oldest first.
+func (r *outcomeRing) snapshot() []Outcome {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]Outcome(nil), r.outcomes[:r.next]...)
+	}
+	out := make([]Outcome, 0, len(r.outcomes))
+	out = append(out, r.outcomes[r.next:]...)
+	return append(out, r.outcomes[:r.next]...)
+}
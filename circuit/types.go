@@ -3,6 +3,9 @@ package circuit
 import (
 	"fmt"
 	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/clock"
 )
 
 // State represents the current state of a circuit breaker.
@@ -59,6 +62,10 @@ type CircuitMetrics struct {
 	// StateChanges is the total number of state transitions
 	StateChanges int64
 
+	// ShadowRejections is the number of requests that would have been rejected
+	// but were let through because the circuit breaker is in shadow mode
+	ShadowRejections int64
+
 	// LastFailure is the timestamp of the last failure
 	LastFailure time.Time
 
@@ -67,6 +74,11 @@ type CircuitMetrics struct {
 
 	// LastStateChange is the timestamp of the last state change
 	LastStateChange time.Time
+
+	// RecentOutcomes holds the most recent calls, oldest first, so the
+	// failures that tripped the circuit can be inspected. Rejected calls are
+	// not included. Its length is bounded by Config.OutcomeHistory
+	RecentOutcomes []Outcome
 }
 
 // FailureRate returns the failure rate as a percentage (0.0 to 1.0).
@@ -91,30 +103,52 @@ func (m CircuitMetrics) IsHealthy() bool {
 type Config struct {
 	// FailureThreshold is the number of consecutive failures required to trip the circuit.
 	// Default: 5
-	FailureThreshold int64
+	FailureThreshold int64 `json:"failure_threshold" yaml:"failure_threshold"`
 
 	// RecoveryTimeout is the duration to wait in the open state before transitioning
 	// to half-open for recovery testing.
 	// Default: 30 seconds
-	RecoveryTimeout time.Duration
+	RecoveryTimeout time.Duration `json:"recovery_timeout" yaml:"recovery_timeout"`
+
+	// RecoveryBackoff, if set, computes the open period instead of RecoveryTimeout
+	// from the number of consecutive trips without a full recovery, so a
+	// dependency that keeps failing its recovery test is probed less and less often.
+	// Default: nil (always RecoveryTimeout)
+	RecoveryBackoff backoff.Strategy `json:"-" yaml:"-"`
 
 	// HalfOpenMaxRequests is the maximum number of requests allowed in half-open state.
 	// Default: 3
-	HalfOpenMaxRequests int64
+	HalfOpenMaxRequests int64 `json:"half_open_max_requests" yaml:"half_open_max_requests"`
 
 	// HalfOpenSuccessThreshold is the number of successful requests required in
 	// half-open state to transition back to closed.
 	// Default: 2
-	HalfOpenSuccessThreshold int64
+	HalfOpenSuccessThreshold int64 `json:"half_open_success_threshold" yaml:"half_open_success_threshold"`
 
 	// IsFailure is a predicate function that determines if an error should be
 	// counted as a failure for circuit breaker purposes. If nil, all non-nil
 	// errors are considered failures.
-	IsFailure func(error) bool
+	IsFailure func(error) bool `json:"-" yaml:"-"`
 
 	// OnStateChange is called whenever the circuit breaker changes state.
 	// This is useful for logging or metrics collection.
-	OnStateChange func(from, to State)
+	OnStateChange func(from, to State) `json:"-" yaml:"-"`
+
+	// Clock is the time source used for recovery timeouts and timestamps.
+	// Default: the real clock
+	Clock clock.Clock `json:"-" yaml:"-"`
+
+	// Shadow runs the circuit breaker in observe-only mode. Outcomes are
+	// recorded and state transitions, metrics and callbacks happen as usual,
+	// but calls are never rejected. This is useful to validate thresholds
+	// against production traffic before enforcing them.
+	// Default: false
+	Shadow bool `json:"shadow,omitempty" yaml:"shadow,omitempty"`
+
+	// OutcomeHistory is the number of recent call outcomes kept for
+	// CircuitMetrics.RecentOutcomes. Zero disables the history.
+	// Default: 20
+	OutcomeHistory int `json:"outcome_history" yaml:"outcome_history"`
 }
 
 // DefaultConfig returns a Config with sensible defaults.
@@ -126,6 +160,30 @@ func DefaultConfig() *Config {
 		HalfOpenSuccessThreshold: 2,
 		IsFailure:                nil, // nil means all errors are failures
 		OnStateChange:            nil, // nil means no callback
+		Clock:                    clock.Real(),
+		OutcomeHistory:           20,
+	}
+}
+
+// SetDefaults replaces zero thresholds and timeouts, which are never valid,
+// with their DefaultConfig values. OutcomeHistory is left alone, as zero
+// disables the history.
+func (c *Config) SetDefaults() {
+	defaults := DefaultConfig()
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = defaults.FailureThreshold
+	}
+	if c.RecoveryTimeout == 0 {
+		c.RecoveryTimeout = defaults.RecoveryTimeout
+	}
+	if c.HalfOpenMaxRequests == 0 {
+		c.HalfOpenMaxRequests = defaults.HalfOpenMaxRequests
+	}
+	if c.HalfOpenSuccessThreshold == 0 {
+		c.HalfOpenSuccessThreshold = defaults.HalfOpenSuccessThreshold
+	}
+	if c.Clock == nil {
+		c.Clock = defaults.Clock
 	}
 }
 
@@ -147,6 +205,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("half-open success threshold must be positive, got %d", c.HalfOpenSuccessThreshold)
 	}
 
+	if c.OutcomeHistory < 0 {
+		return fmt.Errorf("outcome history cannot be negative, got %d", c.OutcomeHistory)
+	}
+
 	if c.HalfOpenSuccessThreshold > c.HalfOpenMaxRequests {
 		return fmt.Errorf("half-open success threshold (%d) cannot exceed max requests (%d)",
 			c.HalfOpenSuccessThreshold, c.HalfOpenMaxRequests)
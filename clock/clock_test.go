@@ -0,0 +1,161 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClock(t *testing.T) {
+	t.Run("timers fire in deadline order", func(t *testing.T) {
+		clk := clock.NewFake(epoch)
+
+		var order []int
+		var seen []time.Time
+		clk.AfterFunc(30*time.Millisecond, func() { order = append(order, 3); seen = append(seen, clk.Now()) })
+		clk.AfterFunc(10*time.Millisecond, func() { order = append(order, 1); seen = append(seen, clk.Now()) })
+		clk.AfterFunc(20*time.Millisecond, func() { order = append(order, 2); seen = append(seen, clk.Now()) })
+
+		clk.Advance(25 * time.Millisecond)
+		if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+			t.Fatalf("expected timers 1 and 2 to fire in order, got %v", order)
+		}
+		if !seen[1].Equal(epoch.Add(20 * time.Millisecond)) {
+			t.Errorf("expected Now to report the deadline while firing, got %v", seen[1])
+		}
+		if got := clk.Now(); !got.Equal(epoch.Add(25 * time.Millisecond)) {
+			t.Errorf("expected clock at +25ms, got %v", got)
+		}
+
+		clk.Advance(10 * time.Millisecond)
+		if len(order) != 3 {
+			t.Errorf("expected third timer to fire, got %v", order)
+		}
+	})
+
+	t.Run("stop and reset", func(t *testing.T) {
+		clk := clock.NewFake(epoch)
+
+		fired := false
+		timer := clk.AfterFunc(time.Second, func() { fired = true })
+		if !timer.Stop() {
+			t.Error("expected Stop to report an active timer")
+		}
+		if timer.Stop() {
+			t.Error("expected second Stop to report false")
+		}
+		clk.Advance(2 * time.Second)
+		if fired {
+			t.Error("stopped timer fired")
+		}
+
+		if timer.Reset(time.Second) {
+			t.Error("expected Reset of a stopped timer to report false")
+		}
+		clk.Advance(time.Second)
+		if !fired {
+			t.Error("reset timer did not fire")
+		}
+	})
+
+	t.Run("channel timers", func(t *testing.T) {
+		clk := clock.NewFake(epoch)
+
+		ch := clk.After(time.Minute)
+		select {
+		case <-ch:
+			t.Fatal("timer fired early")
+		default:
+		}
+
+		clk.Advance(time.Minute)
+		select {
+		case now := <-ch:
+			if !now.Equal(epoch.Add(time.Minute)) {
+				t.Errorf("unexpected tick time %v", now)
+			}
+		default:
+			t.Fatal("timer did not fire")
+		}
+	})
+
+	t.Run("ticker", func(t *testing.T) {
+		clk := clock.NewFake(epoch)
+		ticker := clk.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		ticks := 0
+		for i := 0; i < 5; i++ {
+			clk.Advance(10 * time.Millisecond)
+			select {
+			case <-ticker.C():
+				ticks++
+			default:
+			}
+		}
+		if ticks != 5 {
+			t.Errorf("expected 5 ticks, got %d", ticks)
+		}
+
+		ticker.Reset(time.Second)
+		clk.Advance(500 * time.Millisecond)
+		select {
+		case <-ticker.C():
+			t.Error("expected no tick before the new period")
+		default:
+		}
+	})
+
+	t.Run("sleep and block until", func(t *testing.T) {
+		clk := clock.NewFake(epoch)
+
+		done := make(chan struct{})
+		go func() {
+			clk.Sleep(time.Hour)
+			close(done)
+		}()
+
+		clk.BlockUntil(1)
+		clk.Advance(time.Hour)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("sleeper was not woken")
+		}
+		if clk.Waiters() != 0 {
+			t.Errorf("expected no waiters, got %d", clk.Waiters())
+		}
+	})
+
+	t.Run("next", func(t *testing.T) {
+		clk := clock.NewFake(epoch)
+
+		if _, ok := clk.Next(); ok {
+			t.Error("expected no pending deadline")
+		}
+		clk.NewTimer(2 * time.Second)
+		clk.NewTimer(time.Second)
+		if next, ok := clk.Next(); !ok || !next.Equal(epoch.Add(time.Second)) {
+			t.Errorf("expected the earliest deadline, got %v, %v", next, ok)
+		}
+	})
+}
+
+func TestRealClock(t *testing.T) {
+	clk := clock.Real()
+
+	start := clk.Now()
+	timer := clk.NewTimer(time.Millisecond)
+	<-timer.C()
+	if clk.Since(start) < time.Millisecond {
+		t.Error("expected at least 1ms to elapse")
+	}
+
+	done := make(chan struct{})
+	clk.AfterFunc(time.Millisecond, func() { close(done) })
+	<-done
+}
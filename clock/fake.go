@@ -0,0 +1,254 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock whose time only moves when told to. Timers, tickers,
+// sleepers and AfterFunc callbacks fire during Advance, in deadline order, with
+// Now reporting each event's deadline while it fires. AfterFunc callbacks run
+// synchronously on the goroutine calling Advance.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+	seq     uint64
+}
+
+// NewFake creates a fake clock set to start.
+func NewFake(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the fake time elapsed since t.
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep blocks until the clock has been advanced by at least d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// After returns a channel that receives the fake time once the clock has
+// been advanced by at least d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer creates a timer that fires once the clock has been advanced by at
+// least d.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	c.schedule(t, d)
+	return t
+}
+
+// AfterFunc calls f once the clock has been advanced by at least d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &fakeTimer{clock: c, fn: f}
+	c.schedule(t, d)
+	return t
+}
+
+// NewTicker creates a ticker that ticks every d of fake time.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1), period: d}
+	c.schedule(t, d)
+	return &fakeTicker{t}
+}
+
+// Advance moves the clock forward by d, firing every timer, ticker and
+// sleeper that becomes due, in deadline order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	c.advanceTo(target)
+}
+
+// Set moves the clock to t. Moving forward fires due events as Advance does;
+// moving backward fires nothing.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	if !t.After(c.now) {
+		c.now = t
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.advanceTo(t)
+}
+
+// Waiters returns the number of pending timers, tickers and sleepers.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Next returns the deadline of the earliest pending timer, ticker or sleeper,
+// or false if there is none.
+func (c *FakeClock) Next() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiters) == 0 {
+		return time.Time{}, false
+	}
+	return c.waiters[0].deadline, true
+}
+
+// BlockUntil blocks until at least n timers, tickers or sleepers are pending.
+// It lets a test wait for a goroutine to start waiting on the clock before
+// advancing it.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) advanceTo(target time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.waiters) == 0 || c.waiters[0].deadline.After(target) {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+
+		t := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		t.active = false
+		if t.deadline.After(c.now) {
+			c.now = t.deadline
+		}
+		now := c.now
+		if t.period > 0 {
+			c.insertLocked(t, now.Add(t.period))
+		}
+		c.mu.Unlock()
+
+		t.fire(now)
+	}
+}
+
+// schedule arms t to fire after d.
+func (c *FakeClock) schedule(t *fakeTimer, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insertLocked(t, c.now.Add(d))
+}
+
+// insertLocked adds t to the waiters, kept sorted by deadline and then by
+// creation order. Must be called with c.mu held.
+func (c *FakeClock) insertLocked(t *fakeTimer, deadline time.Time) {
+	c.seq++
+	t.deadline = deadline
+	t.seq = c.seq
+	t.active = true
+
+	i := sort.Search(len(c.waiters), func(i int) bool {
+		w := c.waiters[i]
+		return w.deadline.After(deadline) || (w.deadline.Equal(deadline) && w.seq > t.seq)
+	})
+	c.waiters = append(c.waiters, nil)
+	copy(c.waiters[i+1:], c.waiters[i:])
+	c.waiters[i] = t
+
+	c.cond.Broadcast()
+}
+
+// removeLocked takes t out of the waiters. Must be called with c.mu held.
+func (c *FakeClock) removeLocked(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	t.active = false
+	return true
+}
+
+// fakeTimer backs fake timers, tickers and AfterFunc callbacks. Its
+// scheduling fields are guarded by the clock's mutex.
+type fakeTimer struct {
+	clock    *FakeClock
+	ch       chan time.Time
+	fn       func()
+	period   time.Duration
+	deadline time.Time
+	seq      uint64
+	active   bool
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	// Like the runtime, drop the tick if the previous one was not received.
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.removeLocked(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.clock.removeLocked(t)
+	t.clock.insertLocked(t, t.clock.now.Add(d))
+	return active
+}
+
+// fakeTicker adapts fakeTimer to the Ticker interface.
+type fakeTicker struct{ t *fakeTimer }
+
+func (t *fakeTicker) C() <-chan time.Time { return t.t.ch }
+func (t *fakeTicker) Stop()               { t.t.Stop() }
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+	t.t.clock.mu.Lock()
+	defer t.t.clock.mu.Unlock()
+
+	t.t.clock.removeLocked(t.t)
+	t.t.period = d
+	t.t.clock.insertLocked(t.t, t.t.clock.now.Add(d))
+}
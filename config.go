@@ -0,0 +1,284 @@
+// Package ion declares the components of an application, worker pools, rate
+// limiters, semaphores and circuit breakers, from one configuration and
+// constructs them wired to shared observability.
+package ion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/semaphore"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Config declares components by name. A component whose own Name is empty
+// is named after its key.
+//
+// The struct carries JSON and YAML tags. LoadConfig reads JSON, where
+// durations are duration strings like "30s" or, for compatibility, numbers
+// of nanoseconds; YAML decoders such as gopkg.in/yaml.v3 accept duration
+// strings too.
+//
+// Usage:
+//
+//	cfg, err := ion.LoadConfig("ion.json")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	components, err := cfg.Build(observe.New().WithLogger(logger))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer components.Close(context.Background())
+//	pool := components.Pools["ingest"]
+type Config struct {
+	Pools      map[string]workerpool.Config `json:"pools,omitempty" yaml:"pools,omitempty"`
+	Limiters   map[string]ratelimit.Config  `json:"limiters,omitempty" yaml:"limiters,omitempty"`
+	Semaphores map[string]semaphore.Config  `json:"semaphores,omitempty" yaml:"semaphores,omitempty"`
+	Breakers   map[string]circuit.Config    `json:"breakers,omitempty" yaml:"breakers,omitempty"`
+}
+
+// LoadConfig reads a JSON configuration file. Unknown fields are rejected,
+// so typos do not silently fall back to defaults.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ion: load config: %w", err)
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig decodes a JSON configuration. Unknown fields are rejected.
+// Durations are read from duration strings such as "30s", as
+// time.ParseDuration reads them, or from numbers of nanoseconds.
+func ParseConfig(data []byte) (*Config, error) {
+	var raw struct {
+		Pools      map[string]json.RawMessage `json:"pools"`
+		Limiters   map[string]json.RawMessage `json:"limiters"`
+		Semaphores map[string]json.RawMessage `json:"semaphores"`
+		Breakers   map[string]json.RawMessage `json:"breakers"`
+	}
+	if err := decodeStrict(data, &raw); err != nil {
+		return nil, fmt.Errorf("ion: parse config: %w", err)
+	}
+
+	var cfg Config
+	var err error
+	if cfg.Pools, err = decodeSection[workerpool.Config]("pools", raw.Pools); err != nil {
+		return nil, err
+	}
+	if cfg.Limiters, err = decodeSection[ratelimit.Config]("limiters", raw.Limiters); err != nil {
+		return nil, err
+	}
+	if cfg.Semaphores, err = decodeSection[semaphore.Config]("semaphores", raw.Semaphores); err != nil {
+		return nil, err
+	}
+	if cfg.Breakers, err = decodeSection[circuit.Config]("breakers", raw.Breakers); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// decodeSection decodes the components of a section, reading their
+// time.Duration fields from duration strings or numbers of nanoseconds.
+func decodeSection[C any](section string, raw map[string]json.RawMessage) (map[string]C, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	durations := durationFields(reflect.TypeFor[C]())
+	components := make(map[string]C, len(raw))
+	for name, data := range raw {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("ion: parse config: %s.%s: %w", section, name, err)
+		}
+		converted := false
+		for key, value := range fields {
+			if !durations[key] || len(value) == 0 || value[0] != '"' {
+				continue
+			}
+			var str string
+			if err := json.Unmarshal(value, &str); err != nil {
+				return nil, fmt.Errorf("ion: parse config: %s.%s.%s: %w", section, name, key, err)
+			}
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				return nil, fmt.Errorf("ion: parse config: %s.%s.%s: %w", section, name, key, err)
+			}
+			fields[key] = json.RawMessage(strconv.FormatInt(int64(d), 10))
+			converted = true
+		}
+		if converted {
+			data, _ = json.Marshal(fields)
+		}
+
+		var cfg C
+		if err := decodeStrict(data, &cfg); err != nil {
+			return nil, fmt.Errorf("ion: parse config: %s.%s: %w", section, name, err)
+		}
+		components[name] = cfg
+	}
+	return components, nil
+}
+
+// durationFields returns the JSON names of the time.Duration fields of a
+// config struct.
+func durationFields(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Type != reflect.TypeFor[time.Duration]() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// decodeStrict decodes data into v, rejecting unknown fields.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Validate checks every declared component and returns the errors of all
+// invalid ones, each prefixed with its section and key.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, name := range sortedKeys(c.Pools) {
+		cfg := c.Pools[name]
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("pools.%s: %w", name, err))
+		}
+	}
+	for _, name := range sortedKeys(c.Limiters) {
+		cfg := c.Limiters[name]
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("limiters.%s: %w", name, err))
+		}
+	}
+	for _, name := range sortedKeys(c.Semaphores) {
+		cfg := c.Semaphores[name]
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("semaphores.%s: %w", name, err))
+		}
+	}
+	for _, name := range sortedKeys(c.Breakers) {
+		cfg := c.Breakers[name]
+		cfg.SetDefaults()
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("breakers.%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Components holds the components built from a Config, keyed like the
+// Config.
+type Components struct {
+	Pools      map[string]*workerpool.Pool
+	Limiters   map[string]ratelimit.Limiter
+	Semaphores map[string]semaphore.Semaphore
+	Breakers   map[string]circuit.CircuitBreaker
+}
+
+// Build validates the configuration and constructs every component with
+// the logger, metrics and tracer of obs, which may be nil for no-op hooks.
+// Nothing is constructed if the configuration is invalid.
+func (c *Config) Build(obs *observe.Observability) (*Components, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if obs == nil {
+		obs = observe.New()
+	}
+
+	components := &Components{
+		Pools:      make(map[string]*workerpool.Pool, len(c.Pools)),
+		Limiters:   make(map[string]ratelimit.Limiter, len(c.Limiters)),
+		Semaphores: make(map[string]semaphore.Semaphore, len(c.Semaphores)),
+		Breakers:   make(map[string]circuit.CircuitBreaker, len(c.Breakers)),
+	}
+
+	// Validation passed, so the constructors below cannot fail
+	for name, cfg := range c.Pools {
+		if cfg.Name == "" {
+			cfg.Name = name
+		}
+		components.Pools[name], _ = workerpool.NewFromConfig(cfg,
+			workerpool.WithLogger(obs.Logger),
+			workerpool.WithMetrics(obs.Metrics),
+			workerpool.WithTracer(obs.Tracer),
+		)
+	}
+	for name, cfg := range c.Limiters {
+		if cfg.Name == "" {
+			cfg.Name = name
+		}
+		components.Limiters[name], _ = ratelimit.NewFromConfig(cfg,
+			ratelimit.WithLogger(obs.Logger),
+			ratelimit.WithMetrics(obs.Metrics),
+			ratelimit.WithTracer(obs.Tracer),
+		)
+	}
+	for name, cfg := range c.Semaphores {
+		if cfg.Name == "" {
+			cfg.Name = name
+		}
+		components.Semaphores[name], _ = semaphore.NewFromConfig(cfg,
+			semaphore.WithLogger(obs.Logger),
+			semaphore.WithMetrics(obs.Metrics),
+			semaphore.WithTracer(obs.Tracer),
+		)
+	}
+	for name, cfg := range c.Breakers {
+		components.Breakers[name], _ = circuit.NewFromConfig(name, cfg,
+			circuit.WithObservability(obs),
+		)
+	}
+
+	return components, nil
+}
+
+// Close closes every worker pool, waiting for running tasks until ctx is
+// done, and returns the errors of all pools that failed to close cleanly.
+func (c *Components) Close(ctx context.Context) error {
+	var errs []error
+	for _, name := range sortedKeys(c.Pools) {
+		if err := c.Pools[name].Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortedKeys returns the keys of m in order, for deterministic errors.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,238 @@
+package ion_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion"
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/semaphore"
+	"github.com/kolosys/ion/sim"
+	"github.com/kolosys/ion/workerpool"
+)
+
+const testConfig = `{
+	"pools": {
+		"ingest": {"size": 2, "queue_size": 8, "drain_timeout": 5000000000, "overflow": "caller_runs"}
+	},
+	"limiters": {
+		"api": {"rate": 100, "per": 60000000000, "burst": 10, "fairness": "lifo"},
+		"egress": {"algorithm": "leaky_bucket", "rate": 5, "burst": 5, "leaky_mode": "queue"}
+	},
+	"semaphores": {
+		"db": {"name": "postgres", "capacity": 4, "fairness": "None"}
+	},
+	"breakers": {
+		"payments": {"failure_threshold": 2, "outcome_history": 5}
+	}
+}`
+
+func TestConfig(t *testing.T) {
+	t.Run("ParseAndBuild", func(t *testing.T) {
+		cfg, err := ion.ParseConfig([]byte(testConfig))
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+		if got := cfg.Limiters["api"].Fairness; got != ratelimit.LIFO {
+			t.Errorf("expected LIFO fairness, got %v", got)
+		}
+		if got := cfg.Semaphores["db"].Fairness; got != semaphore.None {
+			t.Errorf("expected None fairness, got %v", got)
+		}
+		if got := cfg.Pools["ingest"].Overflow; got != workerpool.OverflowCallerRuns {
+			t.Errorf("expected caller_runs overflow, got %v", got)
+		}
+
+		rec := sim.NewRecorder()
+		components, err := cfg.Build(observe.New().WithMetrics(rec))
+		if err != nil {
+			t.Fatalf("unexpected build error: %v", err)
+		}
+		defer components.Close(context.Background())
+
+		pool := components.Pools["ingest"]
+		if pool.GetName() != "ingest" || pool.GetSize() != 2 || pool.GetQueueSize() != 8 {
+			t.Errorf("unexpected pool %q size %d queue %d", pool.GetName(), pool.GetSize(), pool.GetQueueSize())
+		}
+
+		if _, ok := components.Limiters["api"].(*ratelimit.TokenBucket); !ok {
+			t.Errorf("expected a token bucket, got %T", components.Limiters["api"])
+		}
+		if _, ok := components.Limiters["egress"].(*ratelimit.LeakyBucket); !ok {
+			t.Errorf("expected a leaky bucket, got %T", components.Limiters["egress"])
+		}
+
+		if got := components.Semaphores["db"].Current(); got != 4 {
+			t.Errorf("expected 4 permits, got %d", got)
+		}
+
+		cb := components.Breakers["payments"]
+		for range 2 {
+			cb.Execute(context.Background(), func(context.Context) (any, error) {
+				return nil, errors.New("declined")
+			})
+		}
+		if cb.State() != circuit.Open {
+			t.Errorf("expected breaker to open after 2 failures, got %v", cb.State())
+		}
+		if got := len(cb.Metrics().RecentOutcomes); got != 2 {
+			t.Errorf("expected 2 recent outcomes, got %d", got)
+		}
+		if rec.Count("circuit.requests_failed", "name", "payments") != 2 {
+			t.Error("expected the breaker to report to the shared recorder")
+		}
+	})
+
+	t.Run("LoadConfig", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ion.json")
+		if err := os.WriteFile(path, []byte(testConfig), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := ion.LoadConfig(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := cfg.Pools["ingest"].DrainTimeout; got != 5*time.Second {
+			t.Errorf("expected 5s drain timeout, got %v", got)
+		}
+
+		if _, err := ion.LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("expected an error for a missing file")
+		}
+	})
+
+	t.Run("DurationStrings", func(t *testing.T) {
+		cfg, err := ion.ParseConfig([]byte(`{
+			"pools": {"ingest": {"drain_timeout": "30s", "task_timeout": 2000000000, "priority_aging": "1m"}},
+			"limiters": {"api": {"rate": 100, "per": "1m", "burst": 10, "warmup": "10s"}},
+			"semaphores": {"db": {"capacity": 4, "acquire_timeout": "250ms", "reservation_ttl": "1h"}},
+			"breakers": {"payments": {"recovery_timeout": "30s"}}
+		}`))
+		if err != nil {
+			t.Fatalf("unexpected parse error: %v", err)
+		}
+
+		for _, tt := range []struct {
+			name      string
+			got, want time.Duration
+		}{
+			{"pools.ingest.drain_timeout", cfg.Pools["ingest"].DrainTimeout, 30 * time.Second},
+			{"pools.ingest.task_timeout", cfg.Pools["ingest"].TaskTimeout, 2 * time.Second},
+			{"pools.ingest.priority_aging", cfg.Pools["ingest"].PriorityAging, time.Minute},
+			{"limiters.api.per", cfg.Limiters["api"].Per, time.Minute},
+			{"limiters.api.warmup", cfg.Limiters["api"].Warmup, 10 * time.Second},
+			{"semaphores.db.acquire_timeout", cfg.Semaphores["db"].AcquireTimeout, 250 * time.Millisecond},
+			{"semaphores.db.reservation_ttl", cfg.Semaphores["db"].ReservationTTL, time.Hour},
+			{"breakers.payments.recovery_timeout", cfg.Breakers["payments"].RecoveryTimeout, 30 * time.Second},
+		} {
+			if tt.got != tt.want {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, tt.got)
+			}
+		}
+
+		_, err = ion.ParseConfig([]byte(`{"pools": {"ingest": {"drain_timeout": "soon"}}}`))
+		if err == nil || !strings.Contains(err.Error(), "pools.ingest.drain_timeout") {
+			t.Errorf("expected an invalid duration error naming the field, got %v", err)
+		}
+		_, err = ion.ParseConfig([]byte(`{"pools": {"ingest": {"drain_timeout": "30s", "sise": 2}}}`))
+		if err == nil || !strings.Contains(err.Error(), "sise") {
+			t.Errorf("expected unknown fields to be rejected alongside strings, got %v", err)
+		}
+	})
+
+	t.Run("UnknownFields", func(t *testing.T) {
+		_, err := ion.ParseConfig([]byte(`{"pools": {"ingest": {"sise": 2}}}`))
+		if err == nil || !strings.Contains(err.Error(), "sise") {
+			t.Errorf("expected an unknown field error, got %v", err)
+		}
+
+		_, err = ion.ParseConfig([]byte(`{"semaphores": {"db": {"capacity": 1, "fairness": "random"}}}`))
+		if err == nil {
+			t.Error("expected an error for an unknown fairness")
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		cfg := &ion.Config{
+			Pools:      map[string]workerpool.Config{"ingest": {QueueSize: -1}},
+			Limiters:   map[string]ratelimit.Config{"api": {Rate: 10, Burst: 0}},
+			Semaphores: map[string]semaphore.Config{"db": {Capacity: 1}},
+			Breakers:   map[string]circuit.Config{"payments": {HalfOpenMaxRequests: 1, HalfOpenSuccessThreshold: 2}},
+		}
+
+		err := cfg.Validate()
+		if err == nil {
+			t.Fatal("expected validation errors")
+		}
+		for _, want := range []string{"pools.ingest", "limiters.api", "breakers.payments"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error to mention %s, got %v", want, err)
+			}
+		}
+		if strings.Contains(err.Error(), "semaphores.db") {
+			t.Errorf("expected the valid semaphore to pass, got %v", err)
+		}
+
+		if _, err := cfg.Build(nil); err == nil {
+			t.Error("expected Build to fail on an invalid config")
+		}
+	})
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Run("Semaphore", func(t *testing.T) {
+		_, err := semaphore.NewFromConfig(semaphore.Config{Name: "db"})
+		var semErr *semaphore.SemaphoreError
+		if !errors.As(err, &semErr) || semErr.Op != "config" {
+			t.Errorf("expected a config SemaphoreError, got %v", err)
+		}
+	})
+
+	t.Run("Workerpool", func(t *testing.T) {
+		_, err := workerpool.NewFromConfig(workerpool.Config{Name: "ingest", Size: -1})
+		var poolErr *workerpool.PoolError
+		if !errors.As(err, &poolErr) || poolErr.Op != "config" {
+			t.Errorf("expected a config PoolError, got %v", err)
+		}
+	})
+
+	t.Run("Ratelimit", func(t *testing.T) {
+		_, err := ratelimit.NewFromConfig(ratelimit.Config{Name: "api", Burst: 1, Jitter: 2})
+		var rlErr *ratelimit.RateLimitError
+		if !errors.As(err, &rlErr) || rlErr.Op != "config" {
+			t.Errorf("expected a config RateLimitError, got %v", err)
+		}
+
+		limiter, err := ratelimit.NewFromConfig(ratelimit.Config{Rate: 60, Per: time.Minute, Burst: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		now := time.Now()
+		if !limiter.AllowN(now, 1) || limiter.AllowN(now, 1) {
+			t.Error("expected exactly the burst to be allowed")
+		}
+	})
+
+	t.Run("Circuit", func(t *testing.T) {
+		cb, err := circuit.NewFromConfig("payments", circuit.Config{})
+		if err != nil {
+			t.Fatalf("expected zero values to take defaults, got %v", err)
+		}
+		if cb.State() != circuit.Closed {
+			t.Errorf("expected closed breaker, got %v", cb.State())
+		}
+
+		_, err = circuit.NewFromConfig("payments", circuit.Config{}, circuit.WithOutcomeHistory(-1))
+		var cbErr *circuit.CircuitError
+		if !errors.As(err, &cbErr) || cbErr.Op != "config" {
+			t.Errorf("expected a config CircuitError, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,220 @@
+// Package debounce provides debounce and throttle wrappers for functions.
+//
+// Debounce collapses a burst of calls into a single invocation once the calls
+// stop for a quiet period; Throttle limits how often a function runs while
+// calls keep arriving. Both support leading and trailing edge invocation and
+// have per-key variants so unrelated keys (for example, config files or cache
+// entries) do not interfere with each other.
+//
+// Timing is driven by a clock.Clock, so tests can substitute a
+// controllable clock instead of sleeping.
+//
+// Usage:
+//
+//	reload := debounce.New(500*time.Millisecond, func() {
+//		cfg.Reload()
+//	})
+//	watcher.OnChange(reload.Call)
+package debounce
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+// Option configures debounce and throttle behavior.
+type Option func(*config)
+
+type config struct {
+	leading  bool
+	trailing bool
+	maxWait  time.Duration
+	clock    clock.Clock
+}
+
+// WithLeading invokes the function on the leading edge of a burst.
+func WithLeading(leading bool) Option {
+	return func(c *config) {
+		c.leading = leading
+	}
+}
+
+// WithTrailing invokes the function on the trailing edge of a burst.
+// Trailing invocation is enabled by default.
+func WithTrailing(trailing bool) Option {
+	return func(c *config) {
+		c.trailing = trailing
+	}
+}
+
+// WithMaxWait bounds how long a continuous burst can postpone a debounced
+// invocation. Without it, a steady stream of calls defers the function
+// indefinitely.
+func WithMaxWait(d time.Duration) Option {
+	return func(c *config) {
+		c.maxWait = d
+	}
+}
+
+// WithClock sets a custom clock implementation (useful for testing).
+func WithClock(clock clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+func newConfig(leading bool, opts ...Option) *config {
+	cfg := &config{
+		leading:  leading,
+		trailing: true,
+		clock:    clock.Real(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// Debouncer delays invocations of a function until calls stop arriving for a
+// quiet period.
+type Debouncer struct {
+	wait time.Duration
+	fn   func()
+	cfg  *config
+
+	mu         sync.Mutex
+	timer      clock.Timer
+	burstStart time.Time
+	pending    bool // a trailing invocation is owed
+	inBurst    bool
+	gen        uint64
+
+	onIdle func() // called after a burst ends, used by KeyedDebouncer
+}
+
+// New creates a Debouncer that runs fn once calls have stopped for wait.
+func New(wait time.Duration, fn func(), opts ...Option) *Debouncer {
+	if fn == nil {
+		panic("debounce: function must not be nil")
+	}
+
+	return &Debouncer{
+		wait: wait,
+		fn:   fn,
+		cfg:  newConfig(false, opts...),
+	}
+}
+
+// Call registers a call. Depending on the edge options, fn runs immediately
+// (leading), after the quiet period (trailing), or both.
+func (d *Debouncer) Call() {
+	if d.call() {
+		d.fn()
+	}
+}
+
+// call records a call and reports whether fn must run on the leading edge.
+func (d *Debouncer) call() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.cfg.clock.Now()
+	runNow := false
+
+	if !d.inBurst {
+		d.inBurst = true
+		d.burstStart = now
+		if d.cfg.leading {
+			runNow = true
+		} else {
+			d.pending = true
+		}
+	} else {
+		d.pending = true
+	}
+
+	delay := d.wait
+	if d.cfg.maxWait > 0 {
+		if remaining := d.cfg.maxWait - now.Sub(d.burstStart); remaining < delay {
+			delay = max(remaining, 0)
+		}
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.gen++
+	gen := d.gen
+	d.timer = d.cfg.clock.AfterFunc(delay, func() { d.fire(gen) })
+
+	return runNow
+}
+
+// fire ends a burst and runs the trailing invocation if one is owed.
+func (d *Debouncer) fire(gen uint64) {
+	d.mu.Lock()
+	if gen != d.gen {
+		d.mu.Unlock()
+		return
+	}
+	run := d.pending && d.cfg.trailing
+	d.pending = false
+	d.inBurst = false
+	d.timer = nil
+	d.mu.Unlock()
+
+	if run {
+		d.fn()
+	}
+	if d.onIdle != nil {
+		d.onIdle()
+	}
+}
+
+// Flush runs a pending trailing invocation immediately.
+func (d *Debouncer) Flush() {
+	d.mu.Lock()
+	run := d.pending && d.cfg.trailing
+	d.reset()
+	d.mu.Unlock()
+
+	if run {
+		d.fn()
+	}
+}
+
+// Cancel discards a pending invocation.
+func (d *Debouncer) Cancel() {
+	d.mu.Lock()
+	d.reset()
+	d.mu.Unlock()
+}
+
+// Pending reports whether a trailing invocation is scheduled.
+func (d *Debouncer) Pending() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending && d.cfg.trailing
+}
+
+// idle reports whether no burst is in progress.
+func (d *Debouncer) idle() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.inBurst
+}
+
+// reset clears the burst state. Must be called with d.mu held.
+func (d *Debouncer) reset() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.gen++
+	d.pending = false
+	d.inBurst = false
+}
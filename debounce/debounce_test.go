@@ -0,0 +1,179 @@
+package debounce_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/debounce"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+func TestDebouncer(t *testing.T) {
+	t.Run("trailing edge", func(t *testing.T) {
+		clock := newFakeClock()
+		var calls atomic.Int64
+		d := debounce.New(100*time.Millisecond, func() { calls.Add(1) }, debounce.WithClock(clock))
+
+		for i := 0; i < 5; i++ {
+			d.Call()
+			clock.Advance(50 * time.Millisecond)
+		}
+		if calls.Load() != 0 {
+			t.Fatalf("expected no calls during burst, got %d", calls.Load())
+		}
+
+		clock.Advance(100 * time.Millisecond)
+		if calls.Load() != 1 {
+			t.Errorf("expected 1 trailing call, got %d", calls.Load())
+		}
+	})
+
+	t.Run("leading edge only", func(t *testing.T) {
+		clock := newFakeClock()
+		var calls atomic.Int64
+		d := debounce.New(100*time.Millisecond, func() { calls.Add(1) },
+			debounce.WithClock(clock),
+			debounce.WithLeading(true),
+			debounce.WithTrailing(false),
+		)
+
+		d.Call()
+		d.Call()
+		d.Call()
+		if calls.Load() != 1 {
+			t.Fatalf("expected 1 leading call, got %d", calls.Load())
+		}
+
+		clock.Advance(200 * time.Millisecond)
+		if calls.Load() != 1 {
+			t.Errorf("expected no trailing call, got %d", calls.Load())
+		}
+
+		d.Call()
+		if calls.Load() != 2 {
+			t.Errorf("expected new burst to call again, got %d", calls.Load())
+		}
+	})
+
+	t.Run("max wait", func(t *testing.T) {
+		clock := newFakeClock()
+		var calls atomic.Int64
+		d := debounce.New(100*time.Millisecond, func() { calls.Add(1) },
+			debounce.WithClock(clock),
+			debounce.WithMaxWait(250*time.Millisecond),
+		)
+
+		for i := 0; i < 6; i++ {
+			d.Call()
+			clock.Advance(50 * time.Millisecond)
+		}
+		if calls.Load() != 1 {
+			t.Errorf("expected max wait to force 1 call, got %d", calls.Load())
+		}
+	})
+
+	t.Run("flush and cancel", func(t *testing.T) {
+		clock := newFakeClock()
+		var calls atomic.Int64
+		d := debounce.New(time.Second, func() { calls.Add(1) }, debounce.WithClock(clock))
+
+		d.Call()
+		if !d.Pending() {
+			t.Fatal("expected pending call")
+		}
+		d.Flush()
+		if calls.Load() != 1 {
+			t.Fatalf("expected flush to call, got %d", calls.Load())
+		}
+
+		d.Call()
+		d.Cancel()
+		clock.Advance(2 * time.Second)
+		if calls.Load() != 1 {
+			t.Errorf("expected canceled call not to run, got %d", calls.Load())
+		}
+	})
+}
+
+func TestThrottler(t *testing.T) {
+	t.Run("leading and trailing", func(t *testing.T) {
+		clock := newFakeClock()
+		var calls atomic.Int64
+		th := debounce.NewThrottle(ratelimit.PerSecond(10), func() { calls.Add(1) }, debounce.WithClock(clock))
+
+		th.Call() // leading
+		th.Call()
+		th.Call()
+		if calls.Load() != 1 {
+			t.Fatalf("expected 1 leading call, got %d", calls.Load())
+		}
+
+		clock.Advance(100 * time.Millisecond) // trailing
+		if calls.Load() != 2 {
+			t.Fatalf("expected trailing call, got %d", calls.Load())
+		}
+
+		clock.Advance(100 * time.Millisecond) // nothing pending, goes idle
+		th.Call()
+		if calls.Load() != 3 {
+			t.Errorf("expected leading call after idle, got %d", calls.Load())
+		}
+	})
+
+	t.Run("steady calls run once per interval", func(t *testing.T) {
+		clock := newFakeClock()
+		var calls atomic.Int64
+		th := debounce.NewThrottleInterval(100*time.Millisecond, func() { calls.Add(1) }, debounce.WithClock(clock))
+
+		for i := 0; i < 100; i++ {
+			th.Call()
+			clock.Advance(10 * time.Millisecond)
+		}
+		if got := calls.Load(); got < 10 || got > 11 {
+			t.Errorf("expected about 10 calls over 1s, got %d", got)
+		}
+	})
+}
+
+func TestKeyed(t *testing.T) {
+	t.Run("debouncer isolates keys and cleans up", func(t *testing.T) {
+		clock := newFakeClock()
+		counts := map[string]int{}
+		k := debounce.NewKeyed(100*time.Millisecond, func(key string) { counts[key]++ }, debounce.WithClock(clock))
+
+		k.Call("a")
+		k.Call("b")
+		k.Call("a")
+		if k.Len() != 2 {
+			t.Fatalf("expected 2 active keys, got %d", k.Len())
+		}
+
+		clock.Advance(100 * time.Millisecond)
+		if counts["a"] != 1 || counts["b"] != 1 {
+			t.Errorf("expected one call per key, got %v", counts)
+		}
+		if k.Len() != 0 {
+			t.Errorf("expected idle keys to be removed, got %d", k.Len())
+		}
+	})
+
+	t.Run("throttler isolates keys", func(t *testing.T) {
+		clock := newFakeClock()
+		counts := map[int]int{}
+		k := debounce.NewKeyedThrottle(ratelimit.PerSecond(1), func(key int) { counts[key]++ },
+			debounce.WithClock(clock), debounce.WithTrailing(false))
+
+		k.Call(1)
+		k.Call(1)
+		k.Call(2)
+		if counts[1] != 1 || counts[2] != 1 {
+			t.Errorf("expected one leading call per key, got %v", counts)
+		}
+
+		clock.Advance(time.Second)
+		if k.Len() != 0 {
+			t.Errorf("expected idle keys to be removed, got %d", k.Len())
+		}
+	})
+}
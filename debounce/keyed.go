@@ -0,0 +1,168 @@
+package debounce
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/ratelimit"
+)
+
+// KeyedDebouncer debounces calls independently per key. Per-key state is
+// removed once a key's burst has ended, so memory is bounded by the number of
+// keys with activity inside the quiet period.
+type KeyedDebouncer[K comparable] struct {
+	wait time.Duration
+	fn   func(K)
+	opts []Option
+
+	mu      sync.Mutex
+	entries map[K]*Debouncer
+}
+
+// NewKeyed creates a KeyedDebouncer that runs fn(key) once calls for that key
+// have stopped for wait.
+func NewKeyed[K comparable](wait time.Duration, fn func(K), opts ...Option) *KeyedDebouncer[K] {
+	if fn == nil {
+		panic("debounce: function must not be nil")
+	}
+
+	return &KeyedDebouncer[K]{
+		wait:    wait,
+		fn:      fn,
+		opts:    opts,
+		entries: make(map[K]*Debouncer),
+	}
+}
+
+// Call registers a call for key.
+func (k *KeyedDebouncer[K]) Call(key K) {
+	k.mu.Lock()
+	d, ok := k.entries[key]
+	if !ok {
+		d = New(k.wait, func() { k.fn(key) }, k.opts...)
+		d.onIdle = func() { k.evict(key, d) }
+		k.entries[key] = d
+	}
+	runNow := d.call()
+	k.mu.Unlock()
+
+	if runNow {
+		d.fn()
+	}
+}
+
+// Flush runs the pending invocation for key immediately.
+func (k *KeyedDebouncer[K]) Flush(key K) {
+	k.mu.Lock()
+	d, ok := k.entries[key]
+	delete(k.entries, key)
+	k.mu.Unlock()
+
+	if ok {
+		d.Flush()
+	}
+}
+
+// Cancel discards the pending invocation for key.
+func (k *KeyedDebouncer[K]) Cancel(key K) {
+	k.mu.Lock()
+	d, ok := k.entries[key]
+	delete(k.entries, key)
+	k.mu.Unlock()
+
+	if ok {
+		d.Cancel()
+	}
+}
+
+// Len returns the number of keys with an active burst.
+func (k *KeyedDebouncer[K]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.entries)
+}
+
+// evict removes an idle debouncer.
+func (k *KeyedDebouncer[K]) evict(key K, d *Debouncer) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.entries[key] == d && d.idle() {
+		delete(k.entries, key)
+	}
+}
+
+// KeyedThrottler throttles calls independently per key. Per-key state is
+// removed once a key's interval ends with no pending call.
+type KeyedThrottler[K comparable] struct {
+	interval time.Duration
+	fn       func(K)
+	opts     []Option
+
+	mu      sync.Mutex
+	entries map[K]*Throttler
+}
+
+// NewKeyedThrottle creates a KeyedThrottler that runs fn(key) at most once per
+// interval implied by rate for each key.
+func NewKeyedThrottle[K comparable](rate ratelimit.Rate, fn func(K), opts ...Option) *KeyedThrottler[K] {
+	if rate.TokensPerSec <= 0 {
+		panic("debounce: throttle rate must be positive")
+	}
+	if fn == nil {
+		panic("debounce: function must not be nil")
+	}
+
+	return &KeyedThrottler[K]{
+		interval: time.Duration(float64(time.Second) / rate.TokensPerSec),
+		fn:       fn,
+		opts:     opts,
+		entries:  make(map[K]*Throttler),
+	}
+}
+
+// Call registers a call for key.
+func (k *KeyedThrottler[K]) Call(key K) {
+	k.mu.Lock()
+	t, ok := k.entries[key]
+	if !ok {
+		t = NewThrottleInterval(k.interval, func() { k.fn(key) }, k.opts...)
+		t.onIdle = func() { k.evict(key, t) }
+		k.entries[key] = t
+	}
+	runNow := t.call()
+	k.mu.Unlock()
+
+	if runNow {
+		t.fn()
+	}
+}
+
+// Cancel discards the pending invocation for key.
+func (k *KeyedThrottler[K]) Cancel(key K) {
+	k.mu.Lock()
+	t, ok := k.entries[key]
+	delete(k.entries, key)
+	k.mu.Unlock()
+
+	if ok {
+		t.Cancel()
+	}
+}
+
+// Len returns the number of keys with an active interval.
+func (k *KeyedThrottler[K]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.entries)
+}
+
+// evict removes an idle throttler.
+func (k *KeyedThrottler[K]) evict(key K, t *Throttler) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.entries[key] == t && t.idle() {
+		delete(k.entries, key)
+	}
+}
@@ -0,0 +1,134 @@
+package debounce
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+// Throttler limits how often a function runs while calls keep arriving.
+// At most one invocation happens per interval; calls made during an interval
+// are collapsed into a single trailing invocation at its end.
+type Throttler struct {
+	interval time.Duration
+	fn       func()
+	cfg      *config
+
+	mu      sync.Mutex
+	timer   clock.Timer
+	active  bool // an interval is in progress
+	pending bool // a trailing invocation is owed
+	gen     uint64
+
+	onIdle func() // called after an interval ends with nothing pending
+}
+
+// NewThrottle creates a Throttler that runs fn at most once per interval
+// implied by rate. Leading and trailing invocation are both enabled by default.
+func NewThrottle(rate ratelimit.Rate, fn func(), opts ...Option) *Throttler {
+	if rate.TokensPerSec <= 0 {
+		panic("debounce: throttle rate must be positive")
+	}
+
+	return NewThrottleInterval(time.Duration(float64(time.Second)/rate.TokensPerSec), fn, opts...)
+}
+
+// NewThrottleInterval creates a Throttler that runs fn at most once per interval.
+func NewThrottleInterval(interval time.Duration, fn func(), opts ...Option) *Throttler {
+	if fn == nil {
+		panic("debounce: function must not be nil")
+	}
+
+	return &Throttler{
+		interval: interval,
+		fn:       fn,
+		cfg:      newConfig(true, opts...),
+	}
+}
+
+// Call registers a call. If no interval is in progress, fn runs immediately
+// (when leading is enabled) and a new interval starts; otherwise the call is
+// deferred to the end of the current interval (when trailing is enabled).
+func (t *Throttler) Call() {
+	if t.call() {
+		t.fn()
+	}
+}
+
+// call records a call and reports whether fn must run on the leading edge.
+func (t *Throttler) call() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.active {
+		t.pending = true
+		return false
+	}
+
+	t.active = true
+	t.startLocked()
+
+	if t.cfg.leading {
+		return true
+	}
+	t.pending = true
+	return false
+}
+
+// endInterval runs a trailing invocation if one is owed and starts the next
+// interval, or goes idle.
+func (t *Throttler) endInterval(gen uint64) {
+	t.mu.Lock()
+	if !t.active || gen != t.gen {
+		t.mu.Unlock()
+		return
+	}
+
+	run := t.pending && t.cfg.trailing
+	t.pending = false
+	if run {
+		t.startLocked()
+	} else {
+		t.active = false
+		t.timer = nil
+	}
+	t.mu.Unlock()
+
+	if run {
+		t.fn()
+		return
+	}
+	if t.onIdle != nil {
+		t.onIdle()
+	}
+}
+
+// startLocked schedules the end of a new interval. Must be called with t.mu held.
+func (t *Throttler) startLocked() {
+	t.gen++
+	gen := t.gen
+	t.timer = t.cfg.clock.AfterFunc(t.interval, func() { t.endInterval(gen) })
+}
+
+// Cancel discards a pending trailing invocation and ends the current interval.
+func (t *Throttler) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.gen++
+	t.active = false
+	t.pending = false
+}
+
+// idle reports whether no interval is in progress.
+func (t *Throttler) idle() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.active
+}
@@ -0,0 +1,30 @@
+package fanout
+
+import "fmt"
+
+// ItemError reports the failure of a single item in a fan-out operation
+type ItemError struct {
+	Name  string // name of the fan-out operation
+	Index int    // position of the failed input item
+	Err   error  // underlying error
+}
+
+func (e *ItemError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("ion: fanout %q item %d: %v", e.Name, e.Index, e.Err)
+	}
+	return fmt.Sprintf("ion: fanout item %d: %v", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// NewItemError creates an error for a failed item
+func NewItemError(name string, index int, err error) error {
+	return &ItemError{
+		Name:  name,
+		Index: index,
+		Err:   err,
+	}
+}
@@ -0,0 +1,367 @@
+// Package fanout provides bounded fan-out and fan-in helpers.
+//
+// The helpers distribute a slice or channel of inputs across a fixed number
+// of worker goroutines, collect results either in input order or as they
+// complete, and always release their goroutines when the context is canceled
+// or the input is exhausted. Failures are collected per item instead of
+// aborting the whole operation, unless fail-fast mode is requested.
+//
+// Usage:
+//
+//	users, err := fanout.Map(ctx, ids, 8, func(ctx context.Context, id string) (*User, error) {
+//		return client.GetUser(ctx, id)
+//	})
+//	// users[i] corresponds to ids[i]; err joins every *ItemError
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// Result is the outcome of processing a single input item.
+type Result[R any] struct {
+	Index int // position of the input item
+	Value R
+	Err   error
+}
+
+// Option configures fan-out behavior.
+type Option func(*config)
+
+type config struct {
+	name     string
+	failFast bool
+	obs      *observe.Observability
+}
+
+// WithName sets the operation name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithFailFast cancels the remaining work as soon as one item fails.
+// By default every item is processed and all failures are collected.
+func WithFailFast() Option {
+	return func(c *config) {
+		c.failFast = true
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+func newConfig(opts ...Option) *config {
+	cfg := &config{
+		name: "",
+		obs:  observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// record emits per-item metrics for an item processed under ctx.
+func (c *config) record(ctx context.Context, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	c.obs.WithContext(ctx).Metrics.Inc("ion_fanout_items_total", "name", c.name, "result", result)
+}
+
+// Map applies fn to every item using at most workers goroutines and returns
+// the results in input order. Items that fail leave the zero value in their
+// slot; the returned error joins an *ItemError for each failure. If ctx is
+// canceled, unprocessed items fail with the context error.
+func Map[T, R any](ctx context.Context, items []T, workers int, fn func(context.Context, T) (R, error), opts ...Option) ([]R, error) {
+	cfg := newConfig(opts...)
+	results := make([]R, len(items))
+	errs := make([]error, len(items))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < clampWorkers(workers, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				v, err := fn(ctx, items[i])
+				cfg.record(ctx, err)
+				if err != nil {
+					errs[i] = NewItemError(cfg.name, i, err)
+					if cfg.failFast {
+						cancel()
+					}
+					continue
+				}
+				results[i] = v
+			}
+		}()
+	}
+
+	sent := 0
+feed:
+	for ; sent < len(items); sent++ {
+		select {
+		case indexes <- sent:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i := sent; i < len(items); i++ {
+		errs[i] = NewItemError(cfg.name, i, ctx.Err())
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// ForEach applies fn to every item using at most workers goroutines. The
+// returned error joins an *ItemError for each failure.
+func ForEach[T any](ctx context.Context, items []T, workers int, fn func(context.Context, T) error, opts ...Option) error {
+	_, err := Map(ctx, items, workers, func(ctx context.Context, item T) (struct{}, error) {
+		return struct{}{}, fn(ctx, item)
+	}, opts...)
+	return err
+}
+
+// Stream applies fn to every item received from in using workers goroutines
+// and delivers results as they complete, in no particular order. The output
+// channel is closed after in is closed and all work has finished, or after
+// ctx is canceled.
+func Stream[T, R any](ctx context.Context, in <-chan T, workers int, fn func(context.Context, T) (R, error), opts ...Option) <-chan Result[R] {
+	cfg := newConfig(opts...)
+	out := make(chan Result[R], clampWorkers(workers, workers))
+
+	ctx, cancel := context.WithCancel(ctx)
+	indexed := enumerate(ctx, in)
+
+	var wg sync.WaitGroup
+	for w := 0; w < clampWorkers(workers, workers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range indexed {
+				v, err := fn(ctx, item.value)
+				cfg.record(ctx, err)
+				if err != nil {
+					err = NewItemError(cfg.name, item.index, err)
+					if cfg.failFast {
+						cancel()
+					}
+				}
+				select {
+				case out <- Result[R]{Index: item.index, Value: v, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+
+	return out
+}
+
+// StreamOrdered is like Stream but delivers results in the order the inputs
+// were received. Results that complete early are buffered until every earlier
+// result has been delivered; at most workers results are in flight at once.
+func StreamOrdered[T, R any](ctx context.Context, in <-chan T, workers int, fn func(context.Context, T) (R, error), opts ...Option) <-chan Result[R] {
+	workers = clampWorkers(workers, workers)
+	out := make(chan Result[R])
+
+	// Each input gets a single-slot channel; the slots are queued in input
+	// order and drained in the same order.
+	slots := make(chan chan Result[R], workers)
+	ctx, cancel := context.WithCancel(ctx)
+	sem := make(chan struct{}, workers)
+	cfg := newConfig(opts...)
+
+	go func() {
+		defer close(slots)
+		index := 0
+		for {
+			var item T
+			var ok bool
+			select {
+			case item, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			slot := make(chan Result[R], 1)
+			select {
+			case slots <- slot:
+			case <-ctx.Done():
+				<-sem
+				return
+			}
+
+			go func(index int, item T) {
+				defer func() { <-sem }()
+				v, err := fn(ctx, item)
+				cfg.record(ctx, err)
+				if err != nil {
+					err = NewItemError(cfg.name, index, err)
+					if cfg.failFast {
+						cancel()
+					}
+				}
+				slot <- Result[R]{Index: index, Value: v, Err: err}
+			}(index, item)
+			index++
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		defer cancel()
+		for slot := range slots {
+			var r Result[R]
+			select {
+			case r = <-slot:
+			case <-ctx.Done():
+				continue
+			}
+			select {
+			case out <- r:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return out
+}
+
+// Merge fans in several channels into one. The returned channel is closed
+// once every input is closed or ctx is canceled.
+func Merge[T any](ctx context.Context, inputs ...<-chan T) <-chan T {
+	out := make(chan T)
+
+	var wg sync.WaitGroup
+	for _, in := range inputs {
+		wg.Add(1)
+		go func(in <-chan T) {
+			defer wg.Done()
+			for {
+				select {
+				case v, ok := <-in:
+					if !ok {
+						return
+					}
+					select {
+					case out <- v:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(in)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// Collect drains a result channel into values and a joined error.
+func Collect[R any](results <-chan Result[R]) ([]R, error) {
+	var values []R
+	var errs []error
+	for r := range results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+			continue
+		}
+		values = append(values, r.Value)
+	}
+	return values, errors.Join(errs...)
+}
+
+// indexedItem pairs an input with its position in the stream.
+type indexedItem[T any] struct {
+	index int
+	value T
+}
+
+// enumerate forwards items from in tagged with their position.
+func enumerate[T any](ctx context.Context, in <-chan T) <-chan indexedItem[T] {
+	out := make(chan indexedItem[T])
+	go func() {
+		defer close(out)
+		for index := 0; ; index++ {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- indexedItem[T]{index: index, value: v}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// clampWorkers bounds the worker count to [1, max(n, 1)].
+func clampWorkers(workers, n int) int {
+	if n < 1 {
+		n = 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	return workers
+}
@@ -0,0 +1,180 @@
+package fanout_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/fanout"
+)
+
+func TestMap(t *testing.T) {
+	t.Run("ordered results", func(t *testing.T) {
+		items := []int{5, 4, 3, 2, 1}
+		got, err := fanout.Map(context.Background(), items, 3, func(ctx context.Context, n int) (int, error) {
+			time.Sleep(time.Duration(n) * time.Millisecond)
+			return n * 10, nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, n := range items {
+			if got[i] != n*10 {
+				t.Errorf("index %d: expected %d, got %d", i, n*10, got[i])
+			}
+		}
+	})
+
+	t.Run("bounded concurrency", func(t *testing.T) {
+		var current, peak atomic.Int64
+		items := make([]int, 20)
+		_, err := fanout.Map(context.Background(), items, 4, func(ctx context.Context, _ int) (int, error) {
+			n := current.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			current.Add(-1)
+			return 0, nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if peak.Load() > 4 {
+			t.Errorf("expected at most 4 concurrent workers, got %d", peak.Load())
+		}
+	})
+
+	t.Run("partial failures", func(t *testing.T) {
+		boom := errors.New("boom")
+		got, err := fanout.Map(context.Background(), []int{1, 2, 3, 4}, 2, func(ctx context.Context, n int) (int, error) {
+			if n%2 == 0 {
+				return 0, boom
+			}
+			return n, nil
+		}, fanout.WithName("partial"))
+
+		if !errors.Is(err, boom) {
+			t.Fatalf("expected boom, got %v", err)
+		}
+		if got[0] != 1 || got[2] != 3 {
+			t.Errorf("expected successful results to be kept, got %v", got)
+		}
+
+		var itemErr *fanout.ItemError
+		if !errors.As(err, &itemErr) || itemErr.Index%2 != 1 {
+			t.Errorf("expected ItemError for an even item, got %v", err)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		var calls atomic.Int64
+		items := make([]int, 100)
+		_, err := fanout.Map(context.Background(), items, 1, func(ctx context.Context, _ int) (int, error) {
+			calls.Add(1)
+			return 0, errors.New("fail")
+		}, fanout.WithFailFast())
+
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if calls.Load() >= 100 {
+			t.Errorf("expected fail fast to stop early, got %d calls", calls.Load())
+		}
+	})
+}
+
+func TestStream(t *testing.T) {
+	in := make(chan int)
+	go func() {
+		for i := 0; i < 10; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	values, err := fanout.Collect(fanout.Stream(context.Background(), in, 3, func(ctx context.Context, n int) (int, error) {
+		return n * n, nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Ints(values)
+	if len(values) != 10 || values[9] != 81 {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
+
+func TestStreamOrdered(t *testing.T) {
+	in := make(chan int)
+	go func() {
+		for i := 0; i < 10; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+
+	results := fanout.StreamOrdered(context.Background(), in, 4, func(ctx context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(10-n) * time.Millisecond)
+		return n, nil
+	})
+
+	expected := 0
+	for r := range results {
+		if r.Index != expected || r.Value != expected {
+			t.Errorf("expected result %d, got index %d value %d", expected, r.Index, r.Value)
+		}
+		expected++
+	}
+	if expected != 10 {
+		t.Errorf("expected 10 results, got %d", expected)
+	}
+}
+
+func TestStreamCancellation(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan int)
+	out := fanout.Stream(ctx, in, 4, func(ctx context.Context, n int) (int, error) {
+		return n, nil
+	})
+	cancel()
+
+	for range out {
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: before %d, after %d", before, after)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := make(chan int)
+	b := make(chan int)
+	go func() {
+		a <- 1
+		close(a)
+	}()
+	go func() {
+		b <- 2
+		close(b)
+	}()
+
+	sum := 0
+	for v := range fanout.Merge(context.Background(), a, b) {
+		sum += v
+	}
+	if sum != 3 {
+		t.Errorf("expected sum 3, got %d", sum)
+	}
+}
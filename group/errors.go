@@ -0,0 +1,51 @@
+package group
+
+import "fmt"
+
+// TaskError reports the failure of a single task in a group
+type TaskError struct {
+	GroupName string // name of the group
+	Task      string // task name, if set with Named
+	Index     int    // position of the task in submission order
+	Attempts  int    // attempts made before giving up
+	Err       error  // error from the last attempt
+}
+
+func (e *TaskError) Error() string {
+	task := fmt.Sprintf("task %d", e.Index)
+	if e.Task != "" {
+		task = fmt.Sprintf("task %q", e.Task)
+	}
+	attempts := ""
+	if e.Attempts > 1 {
+		attempts = fmt.Sprintf(" after %d attempts", e.Attempts)
+	}
+	if e.GroupName != "" {
+		return fmt.Sprintf("ion: group %q %s failed%s: %v", e.GroupName, task, attempts, e.Err)
+	}
+	return fmt.Sprintf("ion: group %s failed%s: %v", task, attempts, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// NewTaskError creates an error for a failed task
+func NewTaskError(groupName, task string, index, attempts int, err error) error {
+	return &TaskError{
+		GroupName: groupName,
+		Task:      task,
+		Index:     index,
+		Attempts:  attempts,
+		Err:       err,
+	}
+}
+
+// PanicError wraps a value recovered from a panicking task
+type PanicError struct {
+	Value any // value passed to panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
@@ -0,0 +1,376 @@
+// Package group runs related tasks concurrently and collects their errors.
+//
+// A Group is like golang.org/x/sync/errgroup with Ion's resilience built in:
+// a concurrency limit, per-task retries with backoff, and optional routing of
+// every attempt through a circuit breaker and a rate limiter. Panics are
+// recovered into errors, and Wait returns every task failure joined with
+// errors.Join instead of only the first.
+//
+// Usage:
+//
+//	g := group.New(ctx,
+//		group.WithLimit(8),
+//		group.WithRetries(2),
+//		group.WithCircuit(breaker),
+//	)
+//	for _, id := range ids {
+//		g.Go(func(ctx context.Context) error {
+//			return sync(ctx, id)
+//		})
+//	}
+//	if err := g.Wait(); err != nil {
+//		// err joins a *TaskError for each failed task
+//	}
+package group
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+// Option configures group behavior.
+type Option func(*config)
+
+type config struct {
+	name     string
+	limit    int
+	retries  int
+	backoff  backoff.Strategy
+	retryIf  func(error) bool
+	failFast bool
+	circuit  circuit.CircuitBreaker
+	limiter  ratelimit.Limiter
+	clock    clock.Clock
+	obs      *observe.Observability
+}
+
+// WithName sets the group name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithLimit caps the number of tasks running at once; Go blocks while the
+// limit is reached. A limit of zero or less means no limit, the default.
+func WithLimit(n int) Option {
+	return func(c *config) {
+		c.limit = n
+	}
+}
+
+// WithRetries sets how many times a failed task is retried. The default is 0.
+func WithRetries(n int) Option {
+	return func(c *config) {
+		c.retries = n
+	}
+}
+
+// WithBackoff sets the wait between retries. The default is exponential
+// from 100ms, capped at 5s, with full jitter.
+func WithBackoff(b backoff.Strategy) Option {
+	return func(c *config) {
+		c.backoff = b
+	}
+}
+
+// WithRetryIf sets which errors are retried. By default every error is
+// retried except context cancellation and open-circuit rejections.
+func WithRetryIf(retryIf func(error) bool) Option {
+	return func(c *config) {
+		c.retryIf = retryIf
+	}
+}
+
+// WithFailFast cancels the group context as soon as one task fails for good,
+// so the remaining tasks can stop early. By default every task runs to
+// completion.
+func WithFailFast() Option {
+	return func(c *config) {
+		c.failFast = true
+	}
+}
+
+// WithCircuit runs every attempt through the circuit breaker.
+func WithCircuit(cb circuit.CircuitBreaker) Option {
+	return func(c *config) {
+		c.circuit = cb
+	}
+}
+
+// WithLimiter waits on the rate limiter before every attempt.
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(c *config) {
+		c.limiter = l
+	}
+}
+
+// WithClock sets the clock used for retry backoff.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// TaskOption configures a single task.
+type TaskOption func(*task)
+
+// Named names the task for observability and error reporting.
+func Named(name string) TaskOption {
+	return func(t *task) {
+		t.name = name
+	}
+}
+
+// Retries overrides the group's retry count for the task.
+func Retries(n int) TaskOption {
+	return func(t *task) {
+		t.retries = n
+	}
+}
+
+type task struct {
+	fn      func(context.Context) error
+	name    string
+	index   int
+	retries int
+}
+
+// Group runs tasks concurrently. A Group must be created with New and must
+// not be reused after Wait returns.
+type Group struct {
+	name     string
+	retries  int
+	backoff  backoff.Strategy
+	retryIf  func(error) bool
+	failFast bool
+	circuit  circuit.CircuitBreaker
+	limiter  ratelimit.Limiter
+	clock    clock.Clock
+	obs      *observe.Observability
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	next int
+	errs []*TaskError
+}
+
+// New creates a group. Tasks receive a context derived from ctx, which is
+// canceled when Wait returns or, with WithFailFast, when a task fails.
+func New(ctx context.Context, opts ...Option) *Group {
+	cfg := &config{
+		name:    "",
+		backoff: backoff.Cap(backoff.FullJitter(backoff.Exponential(100*time.Millisecond)), 5*time.Second),
+		retryIf: defaultRetryIf,
+		clock:   clock.Real(),
+		obs:     observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	g := &Group{
+		name:     cfg.name,
+		retries:  max(cfg.retries, 0),
+		backoff:  cfg.backoff,
+		retryIf:  cfg.retryIf,
+		failFast: cfg.failFast,
+		circuit:  cfg.circuit,
+		limiter:  cfg.limiter,
+		clock:    cfg.clock,
+		obs:      cfg.obs.WithContext(ctx), // every task runs under ctx
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	if cfg.limit > 0 {
+		g.sem = make(chan struct{}, cfg.limit)
+	}
+
+	return g
+}
+
+// defaultRetryIf retries everything except cancellation and open circuits.
+func defaultRetryIf(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var ce *circuit.CircuitError
+	if errors.As(err, &ce) && ce.IsCircuitOpen() {
+		return false
+	}
+	return true
+}
+
+// Context returns the context passed to tasks.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn in a new goroutine, blocking first while the concurrency limit
+// is reached.
+func (g *Group) Go(fn func(context.Context) error, opts ...TaskOption) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start(fn, opts)
+}
+
+// TryGo runs fn in a new goroutine only if the concurrency limit allows it
+// right away, and reports whether it did.
+func (g *Group) TryGo(fn func(context.Context) error, opts ...TaskOption) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(fn, opts)
+	return true
+}
+
+// Wait blocks until every task has returned, cancels the group context and
+// returns the task failures joined with errors.Join, in submission order.
+// Each failure is a *TaskError.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	slices.SortFunc(g.errs, func(a, b *TaskError) int {
+		return a.Index - b.Index
+	})
+	errs := make([]error, len(g.errs))
+	for i, err := range g.errs {
+		errs[i] = err
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Group) start(fn func(context.Context) error, opts []TaskOption) {
+	g.mu.Lock()
+	t := &task{fn: fn, index: g.next, retries: g.retries}
+	g.next++
+	g.mu.Unlock()
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+
+		err := g.run(t)
+		if err == nil {
+			g.obs.Metrics.Inc("ion_group_tasks_total", "group_name", g.name, "result", "success")
+			return
+		}
+
+		g.obs.Metrics.Inc("ion_group_tasks_total", "group_name", g.name, "result", "error")
+		g.obs.Logger.Warn("task failed", "group_name", g.name, "task", t.name, "index", t.index, "error", err)
+
+		g.mu.Lock()
+		g.errs = append(g.errs, err)
+		g.mu.Unlock()
+
+		if g.failFast {
+			g.cancel()
+		}
+	}()
+}
+
+// run executes t with retries and returns a *TaskError if it fails for good.
+func (g *Group) run(t *task) *TaskError {
+	ctx, finish := g.obs.Tracer.Start(g.ctx, "group.task", "group_name", g.name, "task", t.name)
+	delays := g.backoff.Sequence()
+
+	for attempt := 1; ; attempt++ {
+		err := g.attempt(ctx, t.fn)
+		if err == nil {
+			finish(nil)
+			return nil
+		}
+
+		if attempt > t.retries || ctx.Err() != nil || !g.retryIf(err) {
+			finish(err)
+			return &TaskError{GroupName: g.name, Task: t.name, Index: t.index, Attempts: attempt, Err: err}
+		}
+
+		g.obs.Metrics.Inc("ion_group_retries_total", "group_name", g.name)
+		g.obs.Logger.Debug("retrying task", "group_name", g.name, "task", t.name, "attempt", attempt, "error", err)
+
+		timer := g.clock.NewTimer(delays.Next())
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			finish(err)
+			return &TaskError{GroupName: g.name, Task: t.name, Index: t.index, Attempts: attempt, Err: err}
+		}
+	}
+}
+
+// attempt runs fn once through the limiter and circuit breaker.
+func (g *Group) attempt(ctx context.Context, fn func(context.Context) error) error {
+	if g.limiter != nil {
+		if err := g.limiter.WaitN(ctx, 1); err != nil {
+			return err
+		}
+	}
+
+	safe := func(ctx context.Context) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r}
+			}
+		}()
+		return fn(ctx)
+	}
+
+	if g.circuit != nil {
+		return g.circuit.Call(ctx, safe)
+	}
+	return safe(ctx)
+}
@@ -0,0 +1,210 @@
+package group_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/group"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+func TestGroup(t *testing.T) {
+	t.Run("runs all tasks", func(t *testing.T) {
+		g := group.New(context.Background())
+
+		var ran atomic.Int32
+		for i := 0; i < 10; i++ {
+			g.Go(func(ctx context.Context) error {
+				ran.Add(1)
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ran.Load() != 10 {
+			t.Errorf("expected 10 tasks to run, got %d", ran.Load())
+		}
+	})
+
+	t.Run("joins all errors in order", func(t *testing.T) {
+		g := group.New(context.Background(), group.WithName("sync"))
+
+		errA := errors.New("a")
+		errB := errors.New("b")
+		g.Go(func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return errA
+		})
+		g.Go(func(ctx context.Context) error { return nil })
+		g.Go(func(ctx context.Context) error { return errB }, group.Named("second"))
+
+		err := g.Wait()
+		if !errors.Is(err, errA) || !errors.Is(err, errB) {
+			t.Fatalf("expected both errors, got %v", err)
+		}
+
+		joined, ok := err.(interface{ Unwrap() []error })
+		if !ok {
+			t.Fatalf("expected a joined error, got %T", err)
+		}
+		errs := joined.Unwrap()
+		var first, second *group.TaskError
+		if len(errs) != 2 || !errors.As(errs[0], &first) || !errors.As(errs[1], &second) {
+			t.Fatalf("expected two task errors, got %v", errs)
+		}
+		if first.Index != 0 || second.Task != "second" {
+			t.Errorf("unexpected task errors: %+v, %+v", first, second)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		g := group.New(context.Background(), group.WithLimit(2))
+
+		var running, peak atomic.Int32
+		for i := 0; i < 8; i++ {
+			g.Go(func(ctx context.Context) error {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+		}
+		g.Wait()
+
+		if peak.Load() > 2 {
+			t.Errorf("expected at most 2 concurrent tasks, got %d", peak.Load())
+		}
+	})
+
+	t.Run("try go", func(t *testing.T) {
+		g := group.New(context.Background(), group.WithLimit(1))
+
+		release := make(chan struct{})
+		g.Go(func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+		if g.TryGo(func(ctx context.Context) error { return nil }) {
+			t.Error("expected TryGo to fail at the limit")
+		}
+		close(release)
+		g.Wait()
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		g := group.New(context.Background(),
+			group.WithRetries(2),
+			group.WithBackoff(backoff.Constant(time.Millisecond)),
+		)
+
+		var attempts atomic.Int32
+		g.Go(func(ctx context.Context) error {
+			if attempts.Add(1) < 3 {
+				return errors.New("transient")
+			}
+			return nil
+		})
+		if err := g.Wait(); err != nil {
+			t.Fatalf("expected success after retries, got %v", err)
+		}
+		if attempts.Load() != 3 {
+			t.Errorf("expected 3 attempts, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("per-task retries", func(t *testing.T) {
+		g := group.New(context.Background(),
+			group.WithRetries(5),
+			group.WithBackoff(backoff.Constant(0)),
+		)
+
+		var attempts atomic.Int32
+		g.Go(func(ctx context.Context) error {
+			attempts.Add(1)
+			return errors.New("permanent")
+		}, group.Retries(1))
+
+		var te *group.TaskError
+		if err := g.Wait(); !errors.As(err, &te) || te.Attempts != 2 {
+			t.Fatalf("expected failure after 2 attempts, got %v", err)
+		}
+		if attempts.Load() != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		g := group.New(context.Background(), group.WithFailFast())
+
+		g.Go(func(ctx context.Context) error { return errors.New("boom") })
+		g.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		err := g.Wait()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the blocked task to be canceled, got %v", err)
+		}
+	})
+
+	t.Run("panics become errors", func(t *testing.T) {
+		g := group.New(context.Background())
+		g.Go(func(ctx context.Context) error { panic("oops") })
+
+		var pe *group.PanicError
+		if err := g.Wait(); !errors.As(err, &pe) || pe.Value != "oops" {
+			t.Errorf("expected panic error, got %v", err)
+		}
+	})
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		cb := circuit.New("upstream", circuit.WithFailureThreshold(2))
+		g := group.New(context.Background(),
+			group.WithCircuit(cb),
+			group.WithRetries(5),
+			group.WithBackoff(backoff.Constant(0)),
+		)
+
+		var attempts atomic.Int32
+		g.Go(func(ctx context.Context) error {
+			attempts.Add(1)
+			return errors.New("down")
+		})
+
+		var ce *circuit.CircuitError
+		if err := g.Wait(); !errors.As(err, &ce) || !ce.IsCircuitOpen() {
+			t.Fatalf("expected open circuit error, got %v", err)
+		}
+		if attempts.Load() != 2 {
+			t.Errorf("expected retries to stop once the circuit opened, got %d attempts", attempts.Load())
+		}
+	})
+
+	t.Run("limiter", func(t *testing.T) {
+		limiter := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		g := group.New(ctx, group.WithLimiter(limiter))
+
+		for i := 0; i < 2; i++ {
+			g.Go(func(ctx context.Context) error { return nil })
+		}
+
+		if err := g.Wait(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the second task to wait out the deadline, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package health
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// CircuitChecker reports a circuit breaker as unhealthy while it is open.
+// Register it non-critical when the service can keep serving without the
+// protected dependency.
+func CircuitChecker(cb circuit.CircuitBreaker) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if cb.State() == circuit.Open {
+			return errors.New("circuit is open")
+		}
+		return nil
+	})
+}
+
+// PoolChecker reports a worker pool as unhealthy once it is closed or draining.
+func PoolChecker(pool *workerpool.Pool) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if pool.IsClosed() {
+			return errors.New("pool is closed")
+		}
+		if pool.IsDraining() {
+			return errors.New("pool is draining")
+		}
+		return nil
+	})
+}
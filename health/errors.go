@@ -0,0 +1,48 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RegistryError represents health registry errors with context
+type RegistryError struct {
+	Op           string // operation that failed
+	RegistryName string // name of the registry
+	Check        string // check involved, if any
+	Err          error  // underlying error
+}
+
+func (e *RegistryError) Error() string {
+	op := e.Op
+	if e.Check != "" {
+		op = fmt.Sprintf("%s %q", e.Op, e.Check)
+	}
+	if e.RegistryName != "" {
+		return fmt.Sprintf("ion: health %q %s: %v", e.RegistryName, op, e.Err)
+	}
+	return fmt.Sprintf("ion: health %s: %v", op, e.Err)
+}
+
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
+// NewRegistryClosedError creates an error indicating the registry is closed
+func NewRegistryClosedError(registryName string) error {
+	return &RegistryError{
+		Op:           "register",
+		RegistryName: registryName,
+		Err:          errors.New("registry is closed"),
+	}
+}
+
+// NewDuplicateCheckError creates an error indicating a check name is taken
+func NewDuplicateCheckError(registryName, check string) error {
+	return &RegistryError{
+		Op:           "register",
+		RegistryName: registryName,
+		Check:        check,
+		Err:          errors.New("check already registered"),
+	}
+}
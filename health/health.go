@@ -0,0 +1,567 @@
+// Package health provides a registry of health checks with aggregated status
+// and ready-made liveness and readiness HTTP handlers.
+//
+// Components and application code register checks by name. Each check runs
+// with its own timeout, either periodically in the background or on demand
+// with a short result cache so frequent probes do not hammer dependencies.
+// Checks execute on a workerpool, which bounds how many run at once. A failing
+// critical check makes the service Down; a failing non-critical check only
+// makes it Degraded.
+//
+// Usage:
+//
+//	reg := health.New(health.WithName("api"))
+//	defer reg.Close(context.Background())
+//
+//	reg.Register("postgres", health.CheckerFunc(db.PingContext), health.Timeout(time.Second))
+//	reg.Register("cache", health.CheckerFunc(cache.Ping), health.Critical(false))
+//
+//	http.Handle("/livez", reg.LivenessHandler())
+//	http.Handle("/readyz", reg.ReadinessHandler())
+package health
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Status is the health of a check or of the whole service.
+type Status int
+
+const (
+	// StatusUp means the check passed.
+	StatusUp Status = iota
+	// StatusDegraded means a non-critical check failed.
+	StatusDegraded
+	// StatusDown means a critical check failed.
+	StatusDown
+)
+
+// String returns the string representation of the status.
+func (s Status) String() string {
+	switch s {
+	case StatusUp:
+		return "up"
+	case StatusDegraded:
+		return "degraded"
+	case StatusDown:
+		return "down"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Checker reports whether a dependency or component is healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface.
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Kind selects which probes a check contributes to.
+type Kind int
+
+const (
+	// KindReadiness checks only affect readiness (default).
+	KindReadiness Kind = iota
+	// KindLiveness checks affect both liveness and readiness.
+	KindLiveness
+)
+
+// String returns the string representation of the kind.
+func (k Kind) String() string {
+	switch k {
+	case KindReadiness:
+		return "readiness"
+	case KindLiveness:
+		return "liveness"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status    Status        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Critical  bool          `json:"critical"`
+}
+
+// Report is the aggregated outcome of a set of checks.
+type Report struct {
+	Status    Status            `json:"status"`
+	Checks    map[string]Result `json:"checks"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Option configures registry behavior.
+type Option func(*config)
+
+type config struct {
+	name           string
+	pool           *workerpool.Pool
+	defaultTimeout time.Duration
+	cacheTTL       time.Duration
+	clock          clock.Clock
+	obs            *observe.Observability
+}
+
+// WithName sets the registry name for observability.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithPool runs checks on an existing worker pool. The registry does not
+// close a pool it did not create.
+func WithPool(pool *workerpool.Pool) Option {
+	return func(c *config) {
+		c.pool = pool
+	}
+}
+
+// WithDefaultTimeout sets the timeout for checks registered without one.
+// The default is 5 seconds.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.defaultTimeout = d
+		}
+	}
+}
+
+// WithCacheTTL sets how long the result of an on-demand check is reused.
+// The default is one second; zero runs on-demand checks on every request.
+func WithCacheTTL(d time.Duration) Option {
+	return func(c *config) {
+		c.cacheTTL = d
+	}
+}
+
+// WithClock sets the clock used for check intervals, timeouts, result
+// caching and timestamps.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// CheckOption configures a single check.
+type CheckOption func(*check)
+
+// Critical marks whether a failure of the check makes the service Down
+// (true, the default) or only Degraded.
+func Critical(critical bool) CheckOption {
+	return func(c *check) {
+		c.critical = critical
+	}
+}
+
+// Timeout bounds each run of the check.
+func Timeout(d time.Duration) CheckOption {
+	return func(c *check) {
+		c.timeout = d
+	}
+}
+
+// Interval runs the check in the background every d and serves its cached
+// result. Without it, the check runs on demand.
+func Interval(d time.Duration) CheckOption {
+	return func(c *check) {
+		c.interval = d
+	}
+}
+
+// OfKind sets which probes the check contributes to.
+func OfKind(kind Kind) CheckOption {
+	return func(c *check) {
+		c.kind = kind
+	}
+}
+
+// check is a registered checker and its latest result.
+type check struct {
+	name     string
+	checker  Checker
+	critical bool
+	timeout  time.Duration
+	interval time.Duration
+	kind     Kind
+
+	mu      sync.Mutex
+	result  Result
+	checked bool
+	running chan struct{} // non-nil while a run is in progress
+	stop    chan struct{}
+}
+
+// Registry holds health checks and aggregates their results.
+type Registry struct {
+	name     string
+	pool     *workerpool.Pool
+	ownsPool bool
+	timeout  time.Duration
+	cacheTTL time.Duration
+	clock    clock.Clock
+	obs      *observe.Observability
+
+	mu     sync.RWMutex
+	checks map[string]*check
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New creates a health check registry.
+func New(opts ...Option) *Registry {
+	cfg := &config{
+		name:           "",
+		defaultTimeout: 5 * time.Second,
+		cacheTTL:       time.Second,
+		clock:          clock.Real(),
+		obs:            observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	r := &Registry{
+		name:     cfg.name,
+		pool:     cfg.pool,
+		timeout:  cfg.defaultTimeout,
+		cacheTTL: cfg.cacheTTL,
+		clock:    cfg.clock,
+		obs:      cfg.obs,
+		checks:   make(map[string]*check),
+	}
+
+	if r.pool == nil {
+		r.pool = workerpool.New(runtime.GOMAXPROCS(0), 64,
+			workerpool.WithName(cfg.name),
+			workerpool.WithClock(cfg.clock),
+			workerpool.WithLogger(cfg.obs.Logger),
+			workerpool.WithMetrics(cfg.obs.Metrics),
+			workerpool.WithTracer(cfg.obs.Tracer),
+		)
+		r.ownsPool = true
+	}
+
+	r.obs.Logger.Info("health registry created", "name", r.name)
+
+	return r
+}
+
+// Register adds a named check. Names must be unique.
+func (r *Registry) Register(name string, checker Checker, opts ...CheckOption) error {
+	c := &check{
+		name:     name,
+		checker:  checker,
+		critical: true,
+		timeout:  r.timeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeout <= 0 {
+		c.timeout = r.timeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return NewRegistryClosedError(r.name)
+	}
+	if _, ok := r.checks[name]; ok {
+		return NewDuplicateCheckError(r.name, name)
+	}
+	r.checks[name] = c
+
+	if c.interval > 0 {
+		c.stop = make(chan struct{})
+		r.wg.Add(1)
+		go r.loop(c)
+	}
+
+	return nil
+}
+
+// Unregister removes a check and reports whether it existed.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	c, ok := r.checks[name]
+	delete(r.checks, name)
+	r.mu.Unlock()
+
+	if ok && c.stop != nil {
+		close(c.stop)
+	}
+	return ok
+}
+
+// Names returns the names of all registered checks in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check runs every registered check that is not fresh and returns the
+// aggregated report.
+func (r *Registry) Check(ctx context.Context) Report {
+	return r.report(ctx, KindReadiness)
+}
+
+// Liveness returns the aggregated report of liveness checks only.
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.report(ctx, KindLiveness)
+}
+
+// report aggregates checks of the given kind. Readiness includes every check.
+func (r *Registry) report(ctx context.Context, kind Kind) Report {
+	r.mu.RLock()
+	checks := make([]*check, 0, len(r.checks))
+	for _, c := range r.checks {
+		if kind == KindReadiness || c.kind == kind {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.resultOf(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:    StatusUp,
+		Checks:    make(map[string]Result, len(checks)),
+		Timestamp: r.clock.Now(),
+	}
+	for i, c := range checks {
+		res := results[i]
+		report.Checks[c.name] = res
+		if res.Status > report.Status {
+			report.Status = res.Status
+		}
+	}
+
+	return report
+}
+
+// resultOf returns a cached result for c or runs it.
+func (r *Registry) resultOf(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	if c.checked && (c.interval > 0 || r.clock.Since(c.result.CheckedAt) < r.cacheTTL) {
+		res := c.result
+		c.mu.Unlock()
+		return res
+	}
+	c.mu.Unlock()
+
+	return r.run(ctx, c)
+}
+
+// loop runs c every interval until it is unregistered or the registry closes.
+func (r *Registry) loop(c *check) {
+	defer r.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stop
+		cancel()
+	}()
+
+	r.run(ctx, c)
+
+	ticker := r.clock.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			r.run(ctx, c)
+		}
+	}
+}
+
+// run executes c on the pool, sharing the outcome with concurrent callers.
+func (r *Registry) run(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	if c.running != nil {
+		done := c.running
+		c.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return failed(c, r.clock.Now(), 0, ctx.Err())
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.result
+	}
+	done := make(chan struct{})
+	c.running = done
+	c.mu.Unlock()
+
+	// The check itself is detached from the caller's cancellation so an
+	// impatient probe does not cache a spurious failure for everyone else.
+	runCtx := context.WithoutCancel(ctx)
+	finished := make(chan Result, 1)
+
+	var res Result
+	err := r.pool.Submit(ctx, func(context.Context) error {
+		finished <- r.execute(runCtx, c)
+		return nil
+	})
+	if err != nil {
+		res = failed(c, r.clock.Now(), 0, err)
+	} else {
+		select {
+		case res = <-finished:
+		case <-ctx.Done():
+			res = failed(c, r.clock.Now(), 0, ctx.Err())
+		}
+	}
+
+	c.mu.Lock()
+	c.result = res
+	c.checked = true
+	c.running = nil
+	c.mu.Unlock()
+	close(done)
+
+	return res
+}
+
+// execute runs the checker with its timeout.
+func (r *Registry) execute(ctx context.Context, c *check) Result {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := r.clock.AfterFunc(c.timeout, func() { cancel(context.DeadlineExceeded) })
+	defer timer.Stop()
+
+	obs := r.obs.WithContext(ctx)
+	spanCtx, finish := obs.Tracer.Start(ctx, "health.check", "registry", r.name, "check", c.name)
+	start := r.clock.Now()
+
+	err := c.checker.Check(spanCtx)
+	if err == nil && ctx.Err() != nil {
+		err = context.Cause(ctx)
+	}
+	finish(err)
+	elapsed := r.clock.Since(start)
+
+	status := "up"
+	if err != nil {
+		status = "down"
+		obs.Logger.Warn("health check failed", "registry", r.name, "check", c.name, "error", err)
+	}
+	obs.Metrics.Inc("ion_health_checks_total", "registry", r.name, "check", c.name, "status", status)
+	obs.Metrics.Histogram("ion_health_check_duration_seconds", elapsed.Seconds(), "registry", r.name, "check", c.name)
+
+	if err != nil {
+		return failed(c, start, elapsed, err)
+	}
+	return Result{Status: StatusUp, Duration: elapsed, CheckedAt: start, Critical: c.critical}
+}
+
+// failed builds the result of a failed check.
+func failed(c *check, at time.Time, elapsed time.Duration, err error) Result {
+	status := StatusDown
+	if !c.critical {
+		status = StatusDegraded
+	}
+	return Result{
+		Status:    status,
+		Error:     err.Error(),
+		Duration:  elapsed,
+		CheckedAt: at,
+		Critical:  c.critical,
+	}
+}
+
+// Close stops background checks. If the registry owns its pool, the pool is
+// closed too.
+func (r *Registry) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	for _, c := range r.checks {
+		if c.stop != nil {
+			close(c.stop)
+		}
+	}
+	r.checks = make(map[string]*check)
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	if r.ownsPool {
+		return r.pool.Close(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/health"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func TestRegistry(t *testing.T) {
+	t.Run("aggregates status", func(t *testing.T) {
+		reg := health.New()
+		defer reg.Close(context.Background())
+
+		reg.Register("db", health.CheckerFunc(ok))
+		reg.Register("cache", health.CheckerFunc(func(ctx context.Context) error {
+			return errors.New("unreachable")
+		}), health.Critical(false))
+
+		rep := reg.Check(context.Background())
+		if rep.Status != health.StatusDegraded {
+			t.Errorf("expected degraded, got %v", rep.Status)
+		}
+		if rep.Checks["cache"].Error != "unreachable" {
+			t.Errorf("expected cache error, got %+v", rep.Checks["cache"])
+		}
+
+		reg.Register("queue", health.CheckerFunc(func(ctx context.Context) error {
+			return errors.New("down")
+		}))
+		if rep := reg.Check(context.Background()); rep.Status != health.StatusDown {
+			t.Errorf("expected down, got %v", rep.Status)
+		}
+	})
+
+	t.Run("duplicate names", func(t *testing.T) {
+		reg := health.New()
+		defer reg.Close(context.Background())
+
+		if err := reg.Register("db", health.CheckerFunc(ok)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var re *health.RegistryError
+		if err := reg.Register("db", health.CheckerFunc(ok)); !errors.As(err, &re) {
+			t.Errorf("expected RegistryError, got %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		reg := health.New()
+		defer reg.Close(context.Background())
+
+		reg.Register("slow", health.CheckerFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}), health.Timeout(10*time.Millisecond))
+
+		rep := reg.Check(context.Background())
+		if rep.Status != health.StatusDown {
+			t.Errorf("expected down after timeout, got %v", rep.Status)
+		}
+	})
+
+	t.Run("on-demand results are cached", func(t *testing.T) {
+		reg := health.New(health.WithCacheTTL(time.Hour))
+		defer reg.Close(context.Background())
+
+		var calls atomic.Int64
+		reg.Register("db", health.CheckerFunc(func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		}))
+
+		for i := 0; i < 5; i++ {
+			reg.Check(context.Background())
+		}
+		if calls.Load() != 1 {
+			t.Errorf("expected 1 run, got %d", calls.Load())
+		}
+	})
+
+	t.Run("cache expires on the registry clock", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		reg := health.New(health.WithClock(clk), health.WithCacheTTL(time.Minute))
+		defer reg.Close(context.Background())
+
+		var calls atomic.Int64
+		reg.Register("db", health.CheckerFunc(func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		}))
+
+		reg.Check(context.Background())
+		reg.Check(context.Background())
+		clk.Advance(time.Minute)
+		rep := reg.Check(context.Background())
+
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 runs, got %d", calls.Load())
+		}
+		if !rep.Timestamp.Equal(clk.Now()) {
+			t.Errorf("expected report timestamp from the fake clock, got %v", rep.Timestamp)
+		}
+	})
+
+	t.Run("periodic checks", func(t *testing.T) {
+		reg := health.New()
+
+		var calls atomic.Int64
+		reg.Register("db", health.CheckerFunc(func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		}), health.Interval(5*time.Millisecond))
+
+		time.Sleep(50 * time.Millisecond)
+		reg.Check(context.Background())
+		if err := reg.Close(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		n := calls.Load()
+		if n < 3 {
+			t.Errorf("expected several background runs, got %d", n)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if calls.Load() != n {
+			t.Error("expected background checks to stop after close")
+		}
+	})
+
+	t.Run("liveness only includes liveness checks", func(t *testing.T) {
+		reg := health.New()
+		defer reg.Close(context.Background())
+
+		reg.Register("process", health.CheckerFunc(ok), health.OfKind(health.KindLiveness))
+		reg.Register("db", health.CheckerFunc(func(ctx context.Context) error {
+			return errors.New("down")
+		}))
+
+		if rep := reg.Liveness(context.Background()); rep.Status != health.StatusUp || len(rep.Checks) != 1 {
+			t.Errorf("unexpected liveness report: %+v", rep)
+		}
+		if rep := reg.Check(context.Background()); rep.Status != health.StatusDown || len(rep.Checks) != 2 {
+			t.Errorf("unexpected readiness report: %+v", rep)
+		}
+	})
+
+	t.Run("circuit checker", func(t *testing.T) {
+		reg := health.New()
+		defer reg.Close(context.Background())
+
+		cb := circuit.New("payments", circuit.WithFailureThreshold(1))
+		reg.Register("payments", health.CircuitChecker(cb), health.Critical(false))
+
+		cb.Call(context.Background(), func(ctx context.Context) error { return errors.New("boom") })
+
+		if rep := reg.Check(context.Background()); rep.Status != health.StatusDegraded {
+			t.Errorf("expected degraded with open circuit, got %v", rep.Status)
+		}
+	})
+}
+
+func TestHandlers(t *testing.T) {
+	reg := health.New(health.WithCacheTTL(0))
+	defer reg.Close(context.Background())
+
+	var failing atomic.Bool
+	reg.Register("db", health.CheckerFunc(func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("down")
+		}
+		return nil
+	}))
+
+	rec := httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Status != "up" {
+		t.Errorf("unexpected body %q: %v", rec.Body.String(), err)
+	}
+
+	failing.Store(true)
+	rec = httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	reg.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected liveness to ignore readiness checks, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// LivenessHandler returns an http.Handler that reports the liveness checks.
+// It responds 200 while the service is up or degraded and 503 when it is down.
+func (r *Registry) LivenessHandler() http.Handler {
+	return reportHandler(r.Liveness)
+}
+
+// ReadinessHandler returns an http.Handler that reports every check. It
+// responds 200 while the service is up or degraded and 503 when it is down.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return reportHandler(r.Check)
+}
+
+func reportHandler(report func(context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rep := report(req.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if rep.Status == StatusDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+
+		if req.Method != http.MethodHead {
+			_ = json.NewEncoder(w).Encode(rep)
+		}
+	})
+}
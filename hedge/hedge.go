@@ -0,0 +1,385 @@
+// Package hedge provides hedged requests for cutting tail latency.
+//
+// A hedged call starts a primary attempt and, if it has not completed after a
+// delay, starts a backup attempt of the same idempotent operation. The first
+// attempt to succeed wins and the others are canceled. The delay is either
+// fixed or derived from a percentile of recently observed latency, so only the
+// slowest calls are hedged, and the extra load can be capped with a rate
+// limiter acting as a hedging budget.
+//
+// Usage:
+//
+//	h := hedge.New(
+//		hedge.WithPercentile(0.95),
+//		hedge.WithBudget(ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 10)),
+//	)
+//
+//	user, err := hedge.Call(ctx, h, func(ctx context.Context) (*User, error) {
+//		return client.GetUser(ctx, id)
+//	})
+//
+// Only hedge operations that are safe to run more than once.
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/stats"
+)
+
+// Metrics holds a snapshot of hedger counters.
+type Metrics struct {
+	Calls        uint64        // hedged calls started
+	Hedges       uint64        // backup attempts started
+	HedgeWins    uint64        // calls won by a backup attempt
+	BudgetDenied uint64        // backup attempts skipped because the budget was exhausted
+	Delay        time.Duration // current hedging delay
+}
+
+// Option configures hedger behavior.
+type Option func(*config)
+
+type config struct {
+	name       string
+	delay      time.Duration
+	maxHedges  int
+	percentile float64
+	window     int
+	minSamples int
+	budget     ratelimit.Limiter
+	clock      clock.Clock
+	obs        *observe.Observability
+}
+
+// WithName sets the hedger name for observability.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithDelay sets how long to wait for an attempt before starting the next
+// one. With WithPercentile it is the delay used until enough latency samples
+// have been collected. The default is 100ms.
+func WithDelay(d time.Duration) Option {
+	return func(c *config) {
+		c.delay = d
+	}
+}
+
+// WithMaxHedges sets the maximum number of backup attempts per call. The
+// default is 1.
+func WithMaxHedges(n int) Option {
+	return func(c *config) {
+		c.maxHedges = n
+	}
+}
+
+// WithPercentile derives the hedging delay from the given percentile (between
+// 0 and 1) of recently observed latency, e.g. 0.95 hedges roughly the slowest
+// 5% of calls.
+func WithPercentile(p float64) Option {
+	return func(c *config) {
+		c.percentile = p
+	}
+}
+
+// WithWindowSize sets how many recent latency samples the percentile is
+// computed over. The default is 1000.
+func WithWindowSize(n int) Option {
+	return func(c *config) {
+		c.window = n
+	}
+}
+
+// WithMinSamples sets how many latency samples are needed before the
+// percentile replaces the fixed delay. The default is 20.
+func WithMinSamples(n int) Option {
+	return func(c *config) {
+		c.minSamples = n
+	}
+}
+
+// WithBudget caps backup attempts with a rate limiter: each hedge consumes one
+// token and is skipped when none is available. The primary attempt is never
+// limited.
+func WithBudget(l ratelimit.Limiter) Option {
+	return func(c *config) {
+		c.budget = l
+	}
+}
+
+// WithClock sets the clock used for hedging delays and latency measurement.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// Hedger runs hedged calls. It is safe for concurrent use and is meant to be
+// shared by all calls to the same operation so its latency window reflects
+// that operation.
+type Hedger struct {
+	// Configuration
+	name       string
+	delay      time.Duration
+	maxHedges  int
+	percentile float64
+	minSamples int
+	budget     ratelimit.Limiter
+	clock      clock.Clock
+
+	// Observability
+	obs *observe.Observability
+
+	// State
+	mu      sync.Mutex
+	latency *stats.SampleWindow
+	metrics Metrics
+}
+
+// New creates a hedger.
+func New(opts ...Option) *Hedger {
+	cfg := &config{
+		name:       "",
+		delay:      100 * time.Millisecond,
+		maxHedges:  1,
+		window:     1000,
+		minSamples: 20,
+		clock:      clock.Real(),
+		obs:        observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.maxHedges < 0 {
+		cfg.maxHedges = 0
+	}
+	if cfg.window < 1 {
+		cfg.window = 1
+	}
+	if cfg.minSamples < 1 {
+		cfg.minSamples = 1
+	}
+	if cfg.percentile < 0 || cfg.percentile > 1 {
+		cfg.percentile = 0
+	}
+
+	h := &Hedger{
+		name:       cfg.name,
+		delay:      cfg.delay,
+		maxHedges:  cfg.maxHedges,
+		percentile: cfg.percentile,
+		minSamples: cfg.minSamples,
+		budget:     cfg.budget,
+		clock:      cfg.clock,
+		obs:        cfg.obs,
+		latency:    stats.NewSampleWindow(cfg.window),
+	}
+
+	h.obs.Logger.Info("hedger created",
+		"name", h.name,
+		"delay", h.delay,
+		"max_hedges", h.maxHedges,
+		"percentile", h.percentile,
+	)
+
+	return h
+}
+
+// Name returns the hedger name.
+func (h *Hedger) Name() string {
+	return h.name
+}
+
+// Delay returns the delay currently used before starting a backup attempt.
+func (h *Hedger) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delayLocked()
+}
+
+// Metrics returns a snapshot of the hedger counters.
+func (h *Hedger) Metrics() Metrics {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.metrics
+	m.Delay = h.delayLocked()
+	return m
+}
+
+// Do runs fn as a hedged call. See Call.
+func (h *Hedger) Do(ctx context.Context, fn func(context.Context) error) error {
+	_, err := Call(ctx, h, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Call runs fn as a hedged call and returns the result of the first attempt to
+// succeed. Each attempt receives its own context, which is canceled once the
+// call returns, so losing attempts are abandoned. Hedging is not retrying: a
+// failed attempt does not start a new one, and if every started attempt fails
+// Call returns their errors joined. If ctx is done first, Call returns its
+// error without waiting for the attempts.
+func Call[T any](ctx context.Context, h *Hedger, fn func(context.Context) (T, error)) (T, error) {
+	obs := h.obs.WithContext(ctx)
+
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	spanCtx, finish := obs.Tracer.Start(ctx, "hedge.call", "name", h.name)
+	attemptCtx, cancel := context.WithCancel(spanCtx)
+	defer cancel()
+
+	type result struct {
+		value   T
+		err     error
+		attempt int
+		latency time.Duration
+	}
+	results := make(chan result, h.maxHedges+1)
+	launch := func(attempt int) {
+		go func() {
+			start := h.clock.Now()
+			v, err := fn(attemptCtx)
+			results <- result{value: v, err: err, attempt: attempt, latency: h.clock.Since(start)}
+		}()
+	}
+
+	delay := h.start()
+	launch(0)
+	launched, inFlight := 1, 1
+
+	var hedgeC <-chan time.Time
+	if h.maxHedges > 0 {
+		timer := h.clock.NewTimer(delay)
+		defer timer.Stop()
+		hedgeC = timer.C()
+	}
+
+	var errs []error
+	for {
+		select {
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				h.finish(r.attempt, r.latency)
+				finish(nil)
+				return r.value, nil
+			}
+			errs = append(errs, r.err)
+			if inFlight == 0 {
+				err := errors.Join(errs...)
+				finish(err)
+				return zero, err
+			}
+
+		case <-hedgeC:
+			hedgeC = nil
+			if !h.allowHedge() {
+				continue
+			}
+			launch(launched)
+			launched++
+			inFlight++
+			if launched <= h.maxHedges {
+				timer := h.clock.NewTimer(delay)
+				defer timer.Stop()
+				hedgeC = timer.C()
+			}
+
+		case <-ctx.Done():
+			finish(ctx.Err())
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// start records a new call and returns the hedging delay to use for it.
+func (h *Hedger) start() time.Duration {
+	h.mu.Lock()
+	h.metrics.Calls++
+	delay := h.delayLocked()
+	h.mu.Unlock()
+
+	h.obs.Metrics.Inc("ion_hedge_calls_total", "name", h.name)
+	return delay
+}
+
+// allowHedge reports whether a backup attempt may start, consuming budget.
+func (h *Hedger) allowHedge() bool {
+	if h.budget != nil && !h.budget.AllowN(h.clock.Now(), 1) {
+		h.mu.Lock()
+		h.metrics.BudgetDenied++
+		h.mu.Unlock()
+
+		h.obs.Metrics.Inc("ion_hedge_budget_denied_total", "name", h.name)
+		h.obs.Logger.Debug("hedge skipped, budget exhausted", "name", h.name)
+		return false
+	}
+
+	h.mu.Lock()
+	h.metrics.Hedges++
+	h.mu.Unlock()
+
+	h.obs.Metrics.Inc("ion_hedge_attempts_total", "name", h.name)
+	return true
+}
+
+// finish records the winning attempt of a call.
+func (h *Hedger) finish(attempt int, latency time.Duration) {
+	h.mu.Lock()
+	h.latency.RecordDuration(latency)
+	if attempt > 0 {
+		h.metrics.HedgeWins++
+	}
+	h.mu.Unlock()
+
+	winner := "primary"
+	if attempt > 0 {
+		winner = "hedge"
+	}
+	h.obs.Metrics.Inc("ion_hedge_wins_total", "name", h.name, "winner", winner)
+	h.obs.Metrics.Histogram("ion_hedge_latency_seconds", latency.Seconds(), "name", h.name)
+}
+
+// delayLocked returns the current hedging delay. Must be called with h.mu
+// held.
+func (h *Hedger) delayLocked() time.Duration {
+	if h.percentile > 0 && h.latency.Len() >= h.minSamples {
+		return h.latency.QuantileDuration(h.percentile)
+	}
+	return h.delay
+}
@@ -0,0 +1,200 @@
+package hedge_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/hedge"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+type callResult struct {
+	value string
+	err   error
+}
+
+// callAsync runs a hedged call in the background and returns its result
+// channel.
+func callAsync(h *hedge.Hedger, fn func(context.Context) (string, error)) <-chan callResult {
+	out := make(chan callResult, 1)
+	go func() {
+		v, err := hedge.Call(context.Background(), h, fn)
+		out <- callResult{v, err}
+	}()
+	return out
+}
+
+func receive(t *testing.T, ch <-chan callResult) callResult {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for hedged call")
+		return callResult{}
+	}
+}
+
+func TestCall(t *testing.T) {
+	t.Run("fast primary is not hedged", func(t *testing.T) {
+		h := hedge.New()
+
+		v, err := hedge.Call(context.Background(), h, func(ctx context.Context) (string, error) {
+			return "ok", nil
+		})
+		if v != "ok" || err != nil {
+			t.Fatalf("expected ok, got %q, %v", v, err)
+		}
+		if m := h.Metrics(); m.Calls != 1 || m.Hedges != 0 {
+			t.Errorf("expected one call and no hedges, got %+v", m)
+		}
+	})
+
+	t.Run("hedge wins and primary is canceled", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		h := hedge.New(hedge.WithDelay(50*time.Millisecond), hedge.WithClock(clk))
+
+		var attempts atomic.Int32
+		primaryStarted := make(chan struct{})
+		primaryCanceled := make(chan struct{})
+		out := callAsync(h, func(ctx context.Context) (string, error) {
+			if attempts.Add(1) == 1 {
+				close(primaryStarted)
+				<-ctx.Done()
+				close(primaryCanceled)
+				return "", ctx.Err()
+			}
+			return "backup", nil
+		})
+
+		<-primaryStarted
+		clk.BlockUntil(1)
+		clk.Advance(50 * time.Millisecond)
+
+		r := receive(t, out)
+		if r.value != "backup" || r.err != nil {
+			t.Fatalf("expected backup result, got %+v", r)
+		}
+		select {
+		case <-primaryCanceled:
+		case <-time.After(time.Second):
+			t.Fatal("primary attempt was not canceled")
+		}
+		if m := h.Metrics(); m.Hedges != 1 || m.HedgeWins != 1 {
+			t.Errorf("expected one winning hedge, got %+v", m)
+		}
+	})
+
+	t.Run("budget caps hedges", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		budget := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 1, ratelimit.WithClock(clk))
+		h := hedge.New(hedge.WithDelay(10*time.Millisecond), hedge.WithBudget(budget), hedge.WithClock(clk))
+
+		for i := 0; i < 2; i++ {
+			release := make(chan struct{})
+			out := callAsync(h, func(ctx context.Context) (string, error) {
+				select {
+				case <-release:
+					return "ok", nil
+				case <-ctx.Done():
+					return "", ctx.Err()
+				}
+			})
+
+			clk.BlockUntil(1)
+			clk.Advance(10 * time.Millisecond)
+			close(release)
+			if r := receive(t, out); r.err != nil {
+				t.Fatalf("call %d: unexpected error %v", i, r.err)
+			}
+		}
+
+		if m := h.Metrics(); m.Hedges != 1 || m.BudgetDenied != 1 {
+			t.Errorf("expected one hedge and one denial, got %+v", m)
+		}
+	})
+
+	t.Run("failures are joined", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		h := hedge.New(hedge.WithDelay(10*time.Millisecond), hedge.WithClock(clk))
+
+		errPrimary := errors.New("primary")
+		errBackup := errors.New("backup")
+		release := make(chan struct{})
+		primaryStarted := make(chan struct{})
+		var attempts atomic.Int32
+		out := callAsync(h, func(ctx context.Context) (string, error) {
+			if attempts.Add(1) == 1 {
+				close(primaryStarted)
+				<-release
+				return "", errPrimary
+			}
+			close(release)
+			return "", errBackup
+		})
+
+		<-primaryStarted
+		clk.BlockUntil(1)
+		clk.Advance(10 * time.Millisecond)
+
+		r := receive(t, out)
+		if !errors.Is(r.err, errPrimary) || !errors.Is(r.err, errBackup) {
+			t.Errorf("expected both attempt errors, got %v", r.err)
+		}
+	})
+
+	t.Run("failure does not start a hedge", func(t *testing.T) {
+		h := hedge.New()
+
+		var attempts atomic.Int32
+		_, err := hedge.Call(context.Background(), h, func(ctx context.Context) (string, error) {
+			attempts.Add(1)
+			return "", errors.New("boom")
+		})
+		if err == nil || attempts.Load() != 1 {
+			t.Errorf("expected a single failed attempt, got %d attempts, err %v", attempts.Load(), err)
+		}
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		h := hedge.New(hedge.WithDelay(time.Hour))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := h.Do(ctx, func(ctx context.Context) error { return nil })
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestPercentileDelay(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	h := hedge.New(
+		hedge.WithDelay(time.Second),
+		hedge.WithPercentile(0.5),
+		hedge.WithMinSamples(3),
+		hedge.WithClock(clk),
+	)
+
+	for _, d := range []time.Duration{10, 30, 20} {
+		err := h.Do(context.Background(), func(ctx context.Context) error {
+			clk.Advance(d * time.Millisecond)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if h.Metrics().Hedges != 0 {
+			t.Fatal("expected no hedges")
+		}
+	}
+
+	if got := h.Delay(); got != 20*time.Millisecond {
+		t.Errorf("expected median delay of 20ms, got %v", got)
+	}
+}
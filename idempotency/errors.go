@@ -0,0 +1,37 @@
+package idempotency
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPanicked is returned (wrapped) to callers that waited on a call whose
+// function panicked
+var ErrPanicked = errors.New("function panicked")
+
+// TrackerError represents idempotency tracker errors with context
+type TrackerError struct {
+	Op          string // operation that failed
+	TrackerName string // name of the tracker
+	Err         error  // underlying error
+}
+
+func (e *TrackerError) Error() string {
+	if e.TrackerName != "" {
+		return fmt.Sprintf("ion: idempotency %q %s: %v", e.TrackerName, e.Op, e.Err)
+	}
+	return fmt.Sprintf("ion: idempotency %s: %v", e.Op, e.Err)
+}
+
+func (e *TrackerError) Unwrap() error {
+	return e.Err
+}
+
+// NewPanicError creates an error for a call whose function panicked with value
+func NewPanicError(trackerName string, value any) error {
+	return &TrackerError{
+		Op:          "do",
+		TrackerName: trackerName,
+		Err:         fmt.Errorf("%w: %v", ErrPanicked, value),
+	}
+}
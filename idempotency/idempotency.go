@@ -0,0 +1,323 @@
+// Package idempotency runs a function at most once per key within a TTL.
+//
+// A Tracker remembers which keys it has processed. The first call for a key
+// runs the function; calls for the same key while it is running wait for it
+// and share its result; calls after it completed replay the recorded result
+// until the record expires. This turns at-least-once delivery, such as
+// webhook retries or redelivered queue messages, into effectively-once
+// processing within a single process.
+//
+// Usage:
+//
+//	t := idempotency.New[string, Receipt](24*time.Hour, idempotency.WithName("webhooks"))
+//
+//	receipt, outcome, err := t.Do(ctx, event.ID, func(ctx context.Context) (Receipt, error) {
+//		return process(ctx, event)
+//	})
+//	if outcome == idempotency.Replayed {
+//		log.Printf("duplicate delivery of %s", event.ID)
+//	}
+//
+// Failed calls are not recorded by default, so a redelivery retries them.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+)
+
+// Outcome describes how a call to Do was served.
+type Outcome int
+
+const (
+	// Executed means the call ran the function.
+	Executed Outcome = iota
+	// Coalesced means the call waited for a concurrent call with the same key.
+	Coalesced
+	// Replayed means the call returned the recorded result of an earlier call.
+	Replayed
+)
+
+// String returns the string representation of the outcome.
+func (o Outcome) String() string {
+	switch o {
+	case Executed:
+		return "executed"
+	case Coalesced:
+		return "coalesced"
+	case Replayed:
+		return "replayed"
+	default:
+		return "unknown"
+	}
+}
+
+// Metrics holds a snapshot of tracker counters.
+type Metrics struct {
+	Keys      int    // recorded or in-flight keys, including expired records not yet swept
+	Executed  uint64 // calls that ran the function
+	Coalesced uint64 // calls that waited for an in-flight call
+	Replayed  uint64 // calls served from a completion record
+}
+
+// Option configures tracker behavior.
+type Option func(*config)
+
+type config struct {
+	name         string
+	recordErrors bool
+	clock        clock.Clock
+	obs          *observe.Observability
+}
+
+// WithName sets the tracker name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithRecordErrors records failed calls as well, so their error is replayed
+// until the TTL expires instead of the function running again. Calls that
+// failed because their context was canceled or timed out are never recorded.
+func WithRecordErrors() Option {
+	return func(c *config) {
+		c.recordErrors = true
+	}
+}
+
+// WithClock sets the clock used for record expiry.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// record is an in-flight or completed call for one key.
+type record[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	expires time.Time // zero while in flight
+}
+
+// minSweep is the number of keys below which expired records are only
+// removed lazily.
+const minSweep = 64
+
+// Tracker runs functions at most once per key within a TTL. It is safe for
+// concurrent use.
+type Tracker[K comparable, V any] struct {
+	name         string
+	ttl          time.Duration
+	recordErrors bool
+	clock        clock.Clock
+	obs          *observe.Observability
+
+	mu      sync.Mutex
+	records map[K]*record[V]
+	sweepAt int
+	metrics Metrics
+}
+
+// New creates a tracker that keeps completion records for ttl.
+func New[K comparable, V any](ttl time.Duration, opts ...Option) *Tracker[K, V] {
+	cfg := &config{
+		name:  "",
+		clock: clock.Real(),
+		obs:   observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	t := &Tracker[K, V]{
+		name:         cfg.name,
+		ttl:          ttl,
+		recordErrors: cfg.recordErrors,
+		clock:        cfg.clock,
+		obs:          cfg.obs,
+		records:      make(map[K]*record[V]),
+		sweepAt:      minSweep,
+	}
+
+	t.obs.Logger.Info("idempotency tracker created", "name", t.name, "ttl", ttl)
+
+	return t
+}
+
+// Name returns the tracker name.
+func (t *Tracker[K, V]) Name() string {
+	return t.name
+}
+
+// Do runs fn for key unless it already ran within the TTL. If a call for key
+// is in flight, Do waits for it and returns its result; if one completed and
+// was recorded, Do returns the recorded result without running fn. The
+// returned Outcome tells which of these happened.
+//
+// fn runs with the context of the call that executes it. Callers waiting on
+// it stop waiting when their own context is done. If fn panics, waiting
+// callers receive an error wrapping ErrPanicked, nothing is recorded, and the
+// panic is propagated to the executing caller.
+func (t *Tracker[K, V]) Do(ctx context.Context, key K, fn func(context.Context) (V, error)) (V, Outcome, error) {
+	obs := t.obs.WithContext(ctx)
+
+	var zero V
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	if r, ok := t.records[key]; ok {
+		if r.expires.IsZero() {
+			t.metrics.Coalesced++
+			t.mu.Unlock()
+			obs.Metrics.Inc("ion_idempotency_calls_total", "name", t.name, "outcome", "coalesced")
+
+			select {
+			case <-r.done:
+				return r.value, Coalesced, r.err
+			case <-ctx.Done():
+				return zero, Coalesced, ctx.Err()
+			}
+		}
+		if now.Before(r.expires) {
+			t.metrics.Replayed++
+			t.mu.Unlock()
+			obs.Metrics.Inc("ion_idempotency_calls_total", "name", t.name, "outcome", "replayed")
+			return r.value, Replayed, r.err
+		}
+	}
+
+	r := &record[V]{done: make(chan struct{})}
+	t.records[key] = r
+	t.metrics.Executed++
+	t.sweepLocked(now)
+	t.mu.Unlock()
+
+	obs.Metrics.Inc("ion_idempotency_calls_total", "name", t.name, "outcome", "executed")
+
+	spanCtx, finish := obs.Tracer.Start(ctx, "idempotency.do", "name", t.name)
+	completed := false
+	defer func() {
+		if !completed {
+			v := recover()
+			t.complete(key, r, zero, NewPanicError(t.name, v))
+			finish(r.err)
+			panic(v)
+		}
+	}()
+
+	v, err := fn(spanCtx)
+	completed = true
+	t.complete(key, r, v, err)
+	finish(err)
+
+	return v, Executed, err
+}
+
+// Seen reports whether key has a call in flight or an unexpired record.
+func (t *Tracker[K, V]) Seen(key K) bool {
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.records[key]
+	return ok && (r.expires.IsZero() || now.Before(r.expires))
+}
+
+// Forget removes the record for key, so the next call runs fn again. A call in
+// flight is not affected and still records its result when it completes.
+func (t *Tracker[K, V]) Forget(key K) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if r, ok := t.records[key]; ok && !r.expires.IsZero() {
+		delete(t.records, key)
+	}
+}
+
+// Len returns the number of keys in flight or recorded, including expired
+// records that have not been removed yet.
+func (t *Tracker[K, V]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.records)
+}
+
+// Metrics returns a snapshot of the tracker counters.
+func (t *Tracker[K, V]) Metrics() Metrics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := t.metrics
+	m.Keys = len(t.records)
+	return m
+}
+
+// complete publishes the result of r to waiting callers and records it or
+// drops it according to the error policy.
+func (t *Tracker[K, V]) complete(key K, r *record[V], v V, err error) {
+	keep := err == nil || (t.recordErrors && !isContextError(err) && !errors.Is(err, ErrPanicked))
+
+	t.mu.Lock()
+	r.value, r.err = v, err
+	if keep {
+		r.expires = t.clock.Now().Add(t.ttl)
+	} else if t.records[key] == r {
+		delete(t.records, key)
+	}
+	t.mu.Unlock()
+
+	close(r.done)
+
+	if err != nil {
+		t.obs.Logger.Debug("idempotent call failed", "name", t.name, "recorded", keep, "error", err)
+	}
+}
+
+// sweepLocked removes expired records once the number of keys has doubled
+// since the last sweep, keeping memory bounded by the keys seen within one
+// TTL. Must be called with t.mu held.
+func (t *Tracker[K, V]) sweepLocked(now time.Time) {
+	if len(t.records) < t.sweepAt {
+		return
+	}
+
+	for k, r := range t.records {
+		if !r.expires.IsZero() && !now.Before(r.expires) {
+			delete(t.records, k)
+		}
+	}
+	t.sweepAt = max(2*len(t.records), minSweep)
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
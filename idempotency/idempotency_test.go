@@ -0,0 +1,228 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/idempotency"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDo(t *testing.T) {
+	t.Run("replays completed calls", func(t *testing.T) {
+		tr := idempotency.New[string, int](time.Minute)
+
+		var runs atomic.Int32
+		fn := func(ctx context.Context) (int, error) {
+			return int(runs.Add(1)), nil
+		}
+
+		v, outcome, err := tr.Do(context.Background(), "evt-1", fn)
+		if v != 1 || outcome != idempotency.Executed || err != nil {
+			t.Fatalf("expected executed 1, got %d, %v, %v", v, outcome, err)
+		}
+		v, outcome, err = tr.Do(context.Background(), "evt-1", fn)
+		if v != 1 || outcome != idempotency.Replayed || err != nil {
+			t.Fatalf("expected replayed 1, got %d, %v, %v", v, outcome, err)
+		}
+		if runs.Load() != 1 {
+			t.Errorf("expected a single run, got %d", runs.Load())
+		}
+	})
+
+	t.Run("coalesces in-flight calls", func(t *testing.T) {
+		tr := idempotency.New[string, int](time.Minute)
+
+		var runs atomic.Int32
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (int, error) {
+			runs.Add(1)
+			<-release
+			return 42, nil
+		}
+
+		var coalesced atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, outcome, err := tr.Do(context.Background(), "evt", fn)
+				if v != 42 || err != nil {
+					t.Errorf("expected 42, got %d, %v", v, err)
+				}
+				if outcome == idempotency.Coalesced {
+					coalesced.Add(1)
+				}
+			}()
+		}
+
+		waitFor(t, func() bool { return tr.Metrics().Coalesced == 9 })
+		close(release)
+		wg.Wait()
+
+		if runs.Load() != 1 || coalesced.Load() != 9 {
+			t.Errorf("expected 1 run and 9 coalesced calls, got %d and %d", runs.Load(), coalesced.Load())
+		}
+	})
+
+	t.Run("records expire", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		tr := idempotency.New[string, int](time.Minute, idempotency.WithClock(clk))
+
+		var runs atomic.Int32
+		fn := func(ctx context.Context) (int, error) {
+			return int(runs.Add(1)), nil
+		}
+
+		tr.Do(context.Background(), "evt", fn)
+		clk.Advance(59 * time.Second)
+		if !tr.Seen("evt") {
+			t.Error("expected key to be seen within the TTL")
+		}
+		clk.Advance(time.Second)
+		if tr.Seen("evt") {
+			t.Error("expected record to expire after the TTL")
+		}
+		if v, outcome, _ := tr.Do(context.Background(), "evt", fn); v != 2 || outcome != idempotency.Executed {
+			t.Errorf("expected a second run, got %d, %v", v, outcome)
+		}
+	})
+
+	t.Run("failures are retried", func(t *testing.T) {
+		tr := idempotency.New[string, int](time.Minute)
+
+		boom := errors.New("boom")
+		if _, _, err := tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+			return 0, boom
+		}); !errors.Is(err, boom) {
+			t.Fatalf("expected boom, got %v", err)
+		}
+		v, outcome, err := tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+			return 7, nil
+		})
+		if v != 7 || outcome != idempotency.Executed || err != nil {
+			t.Errorf("expected the failed call to run again, got %d, %v, %v", v, outcome, err)
+		}
+	})
+
+	t.Run("record errors", func(t *testing.T) {
+		tr := idempotency.New[string, int](time.Minute, idempotency.WithRecordErrors())
+
+		boom := errors.New("boom")
+		tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+			return 0, boom
+		})
+		_, outcome, err := tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+			return 7, nil
+		})
+		if outcome != idempotency.Replayed || !errors.Is(err, boom) {
+			t.Errorf("expected the error to be replayed, got %v, %v", outcome, err)
+		}
+
+		tr.Do(context.Background(), "canceled", func(ctx context.Context) (int, error) {
+			return 0, context.Canceled
+		})
+		if tr.Seen("canceled") {
+			t.Error("expected context errors not to be recorded")
+		}
+	})
+
+	t.Run("forget", func(t *testing.T) {
+		tr := idempotency.New[string, int](time.Minute)
+
+		tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) { return 1, nil })
+		tr.Forget("evt")
+		if _, outcome, _ := tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+			return 2, nil
+		}); outcome != idempotency.Executed {
+			t.Errorf("expected forgotten key to run again, got %v", outcome)
+		}
+	})
+
+	t.Run("panics release waiters", func(t *testing.T) {
+		tr := idempotency.New[string, int](time.Minute, idempotency.WithName("webhooks"))
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		go func() {
+			defer func() { recover() }()
+			tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+				close(started)
+				<-release
+				panic("oops")
+			})
+		}()
+
+		<-started
+		errc := make(chan error, 1)
+		go func() {
+			_, _, err := tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+				return 1, nil
+			})
+			errc <- err
+		}()
+
+		waitFor(t, func() bool { return tr.Metrics().Coalesced == 1 })
+		close(release)
+		if err := <-errc; !errors.Is(err, idempotency.ErrPanicked) {
+			t.Errorf("expected ErrPanicked, got %v", err)
+		}
+		if tr.Seen("evt") {
+			t.Error("expected panicked call not to be recorded")
+		}
+	})
+
+	t.Run("waiter cancellation", func(t *testing.T) {
+		tr := idempotency.New[string, int](time.Minute)
+
+		release := make(chan struct{})
+		defer close(release)
+		go tr.Do(context.Background(), "evt", func(ctx context.Context) (int, error) {
+			<-release
+			return 1, nil
+		})
+		waitFor(t, func() bool { return tr.Seen("evt") })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, _, err := tr.Do(ctx, "evt", func(ctx context.Context) (int, error) {
+			return 2, nil
+		}); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestSweep(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	tr := idempotency.New[int, int](time.Second, idempotency.WithClock(clk))
+
+	fn := func(ctx context.Context) (int, error) { return 0, nil }
+	for i := 0; i < 100; i++ {
+		tr.Do(context.Background(), i, fn)
+	}
+	clk.Advance(time.Second)
+	for i := 100; i < 200; i++ {
+		tr.Do(context.Background(), i, fn)
+	}
+
+	if n := tr.Len(); n > 150 {
+		t.Errorf("expected expired records to be swept, got %d keys", n)
+	}
+}
@@ -0,0 +1,341 @@
+// Package keylock provides per-key and striped mutual exclusion.
+//
+// KeyLock hands out an exclusive lock per key, creating lock state on demand
+// and removing it as soon as no goroutine holds or waits for the key, so
+// memory is bounded by the number of keys in use. Striped maps keys onto a
+// fixed set of locks for workloads with an unbounded key space where
+// occasional false sharing is acceptable. Both support context-aware
+// acquisition and report hold-time metrics.
+//
+// Usage:
+//
+//	locks := keylock.New[string](keylock.WithName("accounts"))
+//
+//	if err := locks.Lock(ctx, accountID); err != nil {
+//		return err
+//	}
+//	defer locks.Unlock(accountID)
+package keylock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+)
+
+// Metrics holds a snapshot of lock counters.
+type Metrics struct {
+	ActiveKeys int           // keys currently held or waited on
+	Waiting    int64         // goroutines blocked in Lock
+	Acquired   uint64        // total successful acquisitions
+	Contended  uint64        // acquisitions that had to wait
+	Canceled   uint64        // Lock calls abandoned due to context cancellation
+	MaxHold    time.Duration // longest observed hold time
+}
+
+// Option configures lock behavior.
+type Option func(*config)
+
+type config struct {
+	name  string
+	clock clock.Clock
+	obs   *observe.Observability
+}
+
+// WithName sets the lock name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithClock sets the clock used to measure wait and hold times.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+func newConfig(opts ...Option) *config {
+	cfg := &config{
+		name:  "",
+		clock: clock.Real(),
+		obs:   observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// chanMutex is a mutex that can be acquired with a context.
+type chanMutex struct {
+	ch       chan struct{}
+	lockedAt time.Time
+}
+
+func newChanMutex() *chanMutex {
+	return &chanMutex{ch: make(chan struct{}, 1)}
+}
+
+// stats tracks counters shared by KeyLock and Striped.
+type stats struct {
+	name  string
+	clock clock.Clock
+	obs   *observe.Observability
+
+	mu        sync.Mutex
+	waiting   int64
+	acquired  uint64
+	contended uint64
+	canceled  uint64
+	maxHold   time.Duration
+}
+
+// lock acquires m, honoring ctx while waiting.
+func (s *stats) lock(ctx context.Context, m *chanMutex) error {
+	obs := s.obs.WithContext(ctx)
+
+	select {
+	case m.ch <- struct{}{}:
+		s.onAcquired(obs, m, false, time.Time{})
+		return nil
+	default:
+	}
+
+	if err := ctx.Err(); err != nil {
+		s.onCanceled(obs)
+		return err
+	}
+
+	s.mu.Lock()
+	s.waiting++
+	s.mu.Unlock()
+
+	spanCtx, finish := obs.Tracer.Start(ctx, "keylock.wait", "lock_name", s.name)
+	start := s.clock.Now()
+
+	select {
+	case m.ch <- struct{}{}:
+		finish(nil)
+		s.mu.Lock()
+		s.waiting--
+		s.mu.Unlock()
+		s.onAcquired(obs, m, true, start)
+		return nil
+
+	case <-spanCtx.Done():
+		err := ctx.Err()
+		finish(err)
+		s.mu.Lock()
+		s.waiting--
+		s.mu.Unlock()
+		s.onCanceled(obs)
+		return err
+	}
+}
+
+// tryLock acquires m without blocking.
+func (s *stats) tryLock(m *chanMutex) bool {
+	select {
+	case m.ch <- struct{}{}:
+		s.onAcquired(s.obs, m, false, time.Time{})
+		return true
+	default:
+		return false
+	}
+}
+
+// unlock releases m and records the hold time.
+func (s *stats) unlock(m *chanMutex) {
+	held := s.clock.Since(m.lockedAt)
+
+	select {
+	case <-m.ch:
+	default:
+		panic("keylock: unlock of unlocked key")
+	}
+
+	s.mu.Lock()
+	if held > s.maxHold {
+		s.maxHold = held
+	}
+	s.mu.Unlock()
+
+	s.obs.Metrics.Histogram("ion_keylock_hold_duration_seconds", held.Seconds(), "lock_name", s.name)
+}
+
+func (s *stats) onAcquired(obs *observe.Observability, m *chanMutex, contended bool, waitStart time.Time) {
+	m.lockedAt = s.clock.Now()
+
+	s.mu.Lock()
+	s.acquired++
+	if contended {
+		s.contended++
+	}
+	s.mu.Unlock()
+
+	result := "immediate"
+	if contended {
+		result = "waited"
+		obs.Metrics.Histogram("ion_keylock_wait_duration_seconds", s.clock.Since(waitStart).Seconds(),
+			"lock_name", s.name)
+	}
+	obs.Metrics.Inc("ion_keylock_acquisitions_total", "lock_name", s.name, "result", result)
+}
+
+func (s *stats) onCanceled(obs *observe.Observability) {
+	s.mu.Lock()
+	s.canceled++
+	s.mu.Unlock()
+
+	obs.Metrics.Inc("ion_keylock_acquisitions_total", "lock_name", s.name, "result", "canceled")
+}
+
+func (s *stats) snapshot(activeKeys int) Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Metrics{
+		ActiveKeys: activeKeys,
+		Waiting:    s.waiting,
+		Acquired:   s.acquired,
+		Contended:  s.contended,
+		Canceled:   s.canceled,
+		MaxHold:    s.maxHold,
+	}
+}
+
+// KeyLock provides an exclusive lock per key.
+type KeyLock[K comparable] struct {
+	stats
+
+	mu      sync.Mutex
+	entries map[K]*keyEntry
+}
+
+// keyEntry is the reference-counted lock state for one key.
+type keyEntry struct {
+	m    *chanMutex
+	refs int // holders plus waiters
+}
+
+// New creates a per-key lock.
+func New[K comparable](opts ...Option) *KeyLock[K] {
+	cfg := newConfig(opts...)
+
+	return &KeyLock[K]{
+		stats:   stats{name: cfg.name, clock: cfg.clock, obs: cfg.obs},
+		entries: make(map[K]*keyEntry),
+	}
+}
+
+// Lock blocks until the lock for key is acquired or ctx is canceled.
+func (l *KeyLock[K]) Lock(ctx context.Context, key K) error {
+	e := l.ref(key)
+
+	if err := l.stats.lock(ctx, e.m); err != nil {
+		l.unref(key, e)
+		return err
+	}
+	return nil
+}
+
+// TryLock acquires the lock for key without blocking and reports whether it succeeded.
+func (l *KeyLock[K]) TryLock(key K) bool {
+	e := l.ref(key)
+
+	if !l.stats.tryLock(e.m) {
+		l.unref(key, e)
+		return false
+	}
+	return true
+}
+
+// Unlock releases the lock for key. It panics if key is not locked.
+func (l *KeyLock[K]) Unlock(key K) {
+	l.mu.Lock()
+	e, ok := l.entries[key]
+	l.mu.Unlock()
+
+	if !ok {
+		panic("keylock: unlock of unlocked key")
+	}
+
+	l.stats.unlock(e.m)
+	l.unref(key, e)
+}
+
+// IsLocked reports whether key is currently held.
+func (l *KeyLock[K]) IsLocked(key K) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	return ok && len(e.m.ch) == 1
+}
+
+// Len returns the number of keys currently held or waited on.
+func (l *KeyLock[K]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// Metrics returns a snapshot of the lock counters.
+func (l *KeyLock[K]) Metrics() Metrics {
+	return l.stats.snapshot(l.Len())
+}
+
+// ref returns the entry for key, creating it if needed, and takes a reference.
+func (l *KeyLock[K]) ref(key K) *keyEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		e = &keyEntry{m: newChanMutex()}
+		l.entries[key] = e
+		l.obs.Metrics.Gauge("ion_keylock_active_keys", float64(len(l.entries)), "lock_name", l.name)
+	}
+	e.refs++
+	return e
+}
+
+// unref drops a reference and removes the entry once it is idle.
+func (l *KeyLock[K]) unref(key K, e *keyEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.refs--
+	if e.refs == 0 {
+		delete(l.entries, key)
+		l.obs.Metrics.Gauge("ion_keylock_active_keys", float64(len(l.entries)), "lock_name", l.name)
+	}
+}
@@ -0,0 +1,169 @@
+package keylock_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/keylock"
+	"github.com/kolosys/ion/observe"
+)
+
+// spanTracer records the attributes of each span and signals its start.
+type spanTracer struct {
+	started chan []any
+}
+
+func (t *spanTracer) Start(ctx context.Context, name string, kv ...any) (context.Context, func(err error)) {
+	t.started <- kv
+	return ctx, func(err error) {}
+}
+
+func TestKeyLock(t *testing.T) {
+	t.Run("mutual exclusion per key", func(t *testing.T) {
+		locks := keylock.New[string]()
+
+		var inside atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := locks.Lock(context.Background(), "k"); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				if n := inside.Add(1); n != 1 {
+					t.Errorf("expected exclusive access, got %d holders", n)
+				}
+				time.Sleep(100 * time.Microsecond)
+				inside.Add(-1)
+				locks.Unlock("k")
+			}()
+		}
+		wg.Wait()
+
+		if locks.Len() != 0 {
+			t.Errorf("expected idle keys to be cleaned up, got %d", locks.Len())
+		}
+		if m := locks.Metrics(); m.Acquired != 20 {
+			t.Errorf("expected 20 acquisitions, got %d", m.Acquired)
+		}
+	})
+
+	t.Run("hold time on the lock clock", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		locks := keylock.New[string](keylock.WithClock(clk))
+
+		locks.Lock(context.Background(), "k")
+		clk.Advance(time.Minute)
+		locks.Unlock("k")
+
+		if m := locks.Metrics(); m.MaxHold != time.Minute {
+			t.Errorf("expected max hold of 1m, got %v", m.MaxHold)
+		}
+	})
+
+	t.Run("independent keys", func(t *testing.T) {
+		locks := keylock.New[int]()
+
+		if !locks.TryLock(1) {
+			t.Fatal("expected to lock key 1")
+		}
+		if !locks.TryLock(2) {
+			t.Fatal("expected to lock key 2 while key 1 is held")
+		}
+		if locks.TryLock(1) {
+			t.Fatal("expected key 1 to be held")
+		}
+		if !locks.IsLocked(1) {
+			t.Error("expected IsLocked(1)")
+		}
+
+		locks.Unlock(1)
+		locks.Unlock(2)
+		if locks.Len() != 0 {
+			t.Errorf("expected no active keys, got %d", locks.Len())
+		}
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		locks := keylock.New[string](keylock.WithName("cancel"))
+		locks.TryLock("k")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := locks.Lock(ctx, "k"); err != context.DeadlineExceeded {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+		if m := locks.Metrics(); m.Canceled != 1 || m.Waiting != 0 {
+			t.Errorf("expected 1 canceled and 0 waiting, got %+v", m)
+		}
+
+		locks.Unlock("k")
+		if locks.Len() != 0 {
+			t.Errorf("expected cleanup after cancel, got %d keys", locks.Len())
+		}
+	})
+
+	t.Run("wait span carries the correlation ID", func(t *testing.T) {
+		tracer := &spanTracer{started: make(chan []any, 1)}
+		locks := keylock.New[string](keylock.WithTracer(tracer))
+		locks.TryLock("k")
+
+		done := make(chan error, 1)
+		go func() {
+			done <- locks.Lock(observe.WithCorrelationID(context.Background(), "req-5"), "k")
+		}()
+
+		kv := <-tracer.started
+		locks.Unlock("k")
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		locks.Unlock("k")
+
+		if len(kv) < 2 || kv[len(kv)-2] != observe.CorrelationKey || kv[len(kv)-1] != "req-5" {
+			t.Errorf("expected correlation_id req-5 on the wait span, got %v", kv)
+		}
+	})
+
+	t.Run("unlock of unlocked key panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		keylock.New[string]().Unlock("missing")
+	})
+}
+
+func TestStriped(t *testing.T) {
+	s := keylock.NewStriped[string](1)
+
+	if err := s.Lock(context.Background(), "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A single stripe means every key shares the lock.
+	if s.TryLock("b") {
+		t.Fatal("expected shared stripe to be held")
+	}
+	if m := s.Metrics(); m.ActiveKeys != 1 {
+		t.Errorf("expected 1 held stripe, got %d", m.ActiveKeys)
+	}
+	s.Unlock("a")
+
+	if !s.TryLock("b") {
+		t.Fatal("expected stripe to be free")
+	}
+	s.Unlock("b")
+
+	many := keylock.NewStriped[int](64)
+	if many.Stripes() != 64 {
+		t.Errorf("expected 64 stripes, got %d", many.Stripes())
+	}
+}
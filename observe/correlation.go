@@ -0,0 +1,121 @@
+package observe
+
+import "context"
+
+// CorrelationKey is the log field and span attribute under which components
+// report the correlation ID of an operation.
+const CorrelationKey = "correlation_id"
+
+// correlationKey is the context key for the correlation ID.
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying id as the correlation or
+// request ID of the operation. Ion components that receive ctx include it in
+// their log lines, metric exemplars and span attributes.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, if any.
+func CorrelationID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(correlationKey{}).(string)
+	return id, ok && id != ""
+}
+
+// ExemplarMetrics is implemented by Metrics recorders whose backend supports
+// exemplars. Recorders returned by WithContext use it to attach the
+// correlation ID to counter and histogram samples instead of adding it as a
+// label, which would explode metric cardinality.
+type ExemplarMetrics interface {
+	AddWithExemplar(name string, v float64, exemplar map[string]string, kv ...any)
+	HistogramWithExemplar(name string, v float64, exemplar map[string]string, kv ...any)
+}
+
+// WithContext returns hooks for an operation running under ctx. If ctx
+// carries a correlation ID, log lines get a correlation_id field, spans get
+// a correlation_id attribute and, when the recorder implements
+// ExemplarMetrics, counters and histograms get it as an exemplar. Otherwise
+// o is returned unchanged.
+func (o *Observability) WithContext(ctx context.Context) *Observability {
+	id, ok := CorrelationID(ctx)
+	if !ok {
+		return o
+	}
+
+	metrics := o.Metrics
+	if em, ok := metrics.(ExemplarMetrics); ok {
+		metrics = exemplarMetrics{Metrics: metrics, em: em, exemplar: map[string]string{CorrelationKey: id}}
+	}
+
+	return &Observability{
+		Logger:  CorrelatedLogger(ctx, o.Logger),
+		Metrics: metrics,
+		Tracer:  correlatedTracer{Tracer: o.Tracer, id: id},
+	}
+}
+
+// CorrelatedLogger returns a logger that adds the correlation ID carried by
+// ctx to every log line, or logger itself if ctx carries none. It is useful
+// for loggers kept outside of an Observability, such as throttled ones.
+func CorrelatedLogger(ctx context.Context, logger Logger) Logger {
+	id, ok := CorrelationID(ctx)
+	if !ok {
+		return logger
+	}
+	return correlatedLogger{Logger: logger, id: id}
+}
+
+// correlatedLogger adds the correlation ID to every log line.
+type correlatedLogger struct {
+	Logger
+	id string
+}
+
+func (l correlatedLogger) Debug(msg string, kv ...any) {
+	l.Logger.Debug(msg, append(kv, CorrelationKey, l.id)...)
+}
+
+func (l correlatedLogger) Info(msg string, kv ...any) {
+	l.Logger.Info(msg, append(kv, CorrelationKey, l.id)...)
+}
+
+func (l correlatedLogger) Warn(msg string, kv ...any) {
+	l.Logger.Warn(msg, append(kv, CorrelationKey, l.id)...)
+}
+
+func (l correlatedLogger) Error(msg string, err error, kv ...any) {
+	l.Logger.Error(msg, err, append(kv, CorrelationKey, l.id)...)
+}
+
+// correlatedTracer adds the correlation ID to every span.
+type correlatedTracer struct {
+	Tracer
+	id string
+}
+
+func (t correlatedTracer) Start(ctx context.Context, name string, kv ...any) (context.Context, func(err error)) {
+	return t.Tracer.Start(ctx, name, append(kv, CorrelationKey, t.id)...)
+}
+
+// exemplarMetrics records counters and histograms with the correlation ID
+// as an exemplar.
+type exemplarMetrics struct {
+	Metrics
+	em       ExemplarMetrics
+	exemplar map[string]string
+}
+
+func (m exemplarMetrics) Inc(name string, kv ...any) {
+	m.em.AddWithExemplar(name, 1, m.exemplar, kv...)
+}
+
+func (m exemplarMetrics) Add(name string, v float64, kv ...any) {
+	m.em.AddWithExemplar(name, v, m.exemplar, kv...)
+}
+
+func (m exemplarMetrics) Histogram(name string, v float64, kv ...any) {
+	m.em.HistogramWithExemplar(name, v, m.exemplar, kv...)
+}
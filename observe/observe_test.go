@@ -0,0 +1,190 @@
+package observe_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// entry is one recorded log line, metric sample or span.
+type entry struct {
+	name     string
+	kv       []any
+	exemplar map[string]string
+}
+
+// field returns the value recorded under key, if any.
+func (e entry) field(key string) (any, bool) {
+	for i := 0; i+1 < len(e.kv); i += 2 {
+		if e.kv[i] == key {
+			return e.kv[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// recorder implements Logger, Metrics and Tracer by recording every call.
+type recorder struct {
+	entries []entry
+}
+
+func (r *recorder) record(name string, kv []any) {
+	r.entries = append(r.entries, entry{name: name, kv: kv})
+}
+
+func (r *recorder) Debug(msg string, kv ...any)            { r.record(msg, kv) }
+func (r *recorder) Info(msg string, kv ...any)             { r.record(msg, kv) }
+func (r *recorder) Warn(msg string, kv ...any)             { r.record(msg, kv) }
+func (r *recorder) Error(msg string, err error, kv ...any) { r.record(msg, kv) }
+
+func (r *recorder) Inc(name string, kv ...any)                  { r.record(name, kv) }
+func (r *recorder) Add(name string, v float64, kv ...any)       { r.record(name, kv) }
+func (r *recorder) Gauge(name string, v float64, kv ...any)     { r.record(name, kv) }
+func (r *recorder) Histogram(name string, v float64, kv ...any) { r.record(name, kv) }
+
+func (r *recorder) Start(ctx context.Context, name string, kv ...any) (context.Context, func(err error)) {
+	r.record(name, kv)
+	return ctx, func(err error) {}
+}
+
+// exemplarRecorder is a recorder whose backend supports exemplars.
+type exemplarRecorder struct {
+	recorder
+}
+
+func (r *exemplarRecorder) AddWithExemplar(name string, v float64, exemplar map[string]string, kv ...any) {
+	r.entries = append(r.entries, entry{name: name, kv: kv, exemplar: exemplar})
+}
+
+func (r *exemplarRecorder) HistogramWithExemplar(name string, v float64, exemplar map[string]string, kv ...any) {
+	r.entries = append(r.entries, entry{name: name, kv: kv, exemplar: exemplar})
+}
+
+func TestCorrelationID(t *testing.T) {
+	t.Run("round trips through the context", func(t *testing.T) {
+		ctx := observe.WithCorrelationID(context.Background(), "req-1")
+		if id, ok := observe.CorrelationID(ctx); !ok || id != "req-1" {
+			t.Errorf("expected req-1, got %q, %v", id, ok)
+		}
+	})
+
+	t.Run("inner IDs replace outer ones", func(t *testing.T) {
+		ctx := observe.WithCorrelationID(context.Background(), "outer")
+		ctx = observe.WithCorrelationID(ctx, "inner")
+		if id, _ := observe.CorrelationID(ctx); id != "inner" {
+			t.Errorf("expected inner, got %q", id)
+		}
+	})
+
+	t.Run("missing or empty IDs are not reported", func(t *testing.T) {
+		if _, ok := observe.CorrelationID(context.Background()); ok {
+			t.Error("expected no ID in a bare context")
+		}
+		if _, ok := observe.CorrelationID(observe.WithCorrelationID(context.Background(), "")); ok {
+			t.Error("expected an empty ID not to be reported")
+		}
+		if _, ok := observe.CorrelationID(nil); ok {
+			t.Error("expected no ID in a nil context")
+		}
+	})
+}
+
+func TestObservabilityWithContext(t *testing.T) {
+	t.Run("returns the hooks unchanged without an ID", func(t *testing.T) {
+		obs := observe.New()
+		if got := obs.WithContext(context.Background()); got != obs {
+			t.Error("expected the same hooks without a correlation ID")
+		}
+	})
+
+	t.Run("tags log lines and spans", func(t *testing.T) {
+		var rec recorder
+		obs := observe.New().WithLogger(&rec).WithTracer(&rec).WithContext(
+			observe.WithCorrelationID(context.Background(), "req-7"))
+
+		obs.Logger.Debug("debug", "k", "v")
+		obs.Logger.Info("info")
+		obs.Logger.Warn("warn")
+		obs.Logger.Error("error", errors.New("boom"))
+		obs.Tracer.Start(context.Background(), "span", "k", "v")
+
+		if len(rec.entries) != 5 {
+			t.Fatalf("expected 5 entries, got %d", len(rec.entries))
+		}
+		for _, e := range rec.entries {
+			if got, _ := e.field(observe.CorrelationKey); got != "req-7" {
+				t.Errorf("%s: expected correlation_id req-7, got %v", e.name, got)
+			}
+		}
+		if got, _ := rec.entries[0].field("k"); got != "v" {
+			t.Errorf("expected the caller's fields to be kept, got %v", rec.entries[0].kv)
+		}
+	})
+
+	t.Run("leaves metric labels alone without exemplar support", func(t *testing.T) {
+		var rec recorder
+		obs := observe.New().WithMetrics(&rec).WithContext(
+			observe.WithCorrelationID(context.Background(), "req-7"))
+
+		obs.Metrics.Inc("requests_total", "route", "/a")
+		if len(rec.entries) != 1 {
+			t.Fatalf("expected 1 sample, got %d", len(rec.entries))
+		}
+		if _, ok := rec.entries[0].field(observe.CorrelationKey); ok {
+			t.Error("expected no correlation_id label")
+		}
+	})
+}
+
+func TestExemplarMetrics(t *testing.T) {
+	var rec exemplarRecorder
+	obs := observe.New().WithMetrics(&rec).WithContext(
+		observe.WithCorrelationID(context.Background(), "req-9"))
+
+	obs.Metrics.Inc("requests_total", "route", "/a")
+	obs.Metrics.Add("bytes_total", 512, "route", "/a")
+	obs.Metrics.Histogram("latency_seconds", 0.2, "route", "/a")
+	obs.Metrics.Gauge("inflight", 3, "route", "/a")
+
+	if len(rec.entries) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(rec.entries))
+	}
+	for _, e := range rec.entries[:3] {
+		if got := e.exemplar[observe.CorrelationKey]; got != "req-9" {
+			t.Errorf("%s: expected exemplar req-9, got %v", e.name, e.exemplar)
+		}
+		if _, ok := e.field(observe.CorrelationKey); ok {
+			t.Errorf("%s: expected the ID as an exemplar, not a label", e.name)
+		}
+		if got, _ := e.field("route"); got != "/a" {
+			t.Errorf("%s: expected the caller's labels to be kept, got %v", e.name, e.kv)
+		}
+	}
+	if gauge := rec.entries[3]; gauge.exemplar != nil {
+		t.Errorf("expected gauges without an exemplar, got %v", gauge.exemplar)
+	}
+}
+
+func TestCorrelatedLogger(t *testing.T) {
+	t.Run("adds the ID to every line", func(t *testing.T) {
+		var rec recorder
+		logger := observe.CorrelatedLogger(observe.WithCorrelationID(context.Background(), "req-3"), &rec)
+
+		logger.Warn("throttled", "attempt", 2)
+		if got, _ := rec.entries[0].field(observe.CorrelationKey); got != "req-3" {
+			t.Errorf("expected correlation_id req-3, got %v", rec.entries[0].kv)
+		}
+		if got, _ := rec.entries[0].field("attempt"); got != 2 {
+			t.Errorf("expected the caller's fields to be kept, got %v", rec.entries[0].kv)
+		}
+	})
+
+	t.Run("returns the logger itself without an ID", func(t *testing.T) {
+		var rec recorder
+		if got := observe.CorrelatedLogger(context.Background(), &rec); got != observe.Logger(&rec) {
+			t.Error("expected the logger to be returned unchanged")
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PipelineError represents pipeline-specific errors with context
+type PipelineError struct {
+	Op           string // operation that failed
+	PipelineName string // name of the pipeline
+	Stage        string // stage where the failure occurred
+	Err          error  // underlying error
+}
+
+func (e *PipelineError) Error() string {
+	op := e.Op
+	if e.Stage != "" {
+		op = fmt.Sprintf("%s %q", e.Op, e.Stage)
+	}
+	if e.PipelineName != "" {
+		return fmt.Sprintf("ion: pipeline %q %s: %v", e.PipelineName, op, e.Err)
+	}
+	return fmt.Sprintf("ion: pipeline %s: %v", op, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// NewStageError creates an error for a failure inside a stage, source or sink
+func NewStageError(pipelineName, stage string, err error) error {
+	return &PipelineError{
+		Op:           "stage",
+		PipelineName: pipelineName,
+		Stage:        stage,
+		Err:          err,
+	}
+}
+
+// NewNoSourceError creates an error indicating Run was called without a source
+func NewNoSourceError(pipelineName string) error {
+	return &PipelineError{
+		Op:           "run",
+		PipelineName: pipelineName,
+		Err:          errors.New("pipeline has no source"),
+	}
+}
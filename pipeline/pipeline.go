@@ -0,0 +1,526 @@
+// Package pipeline provides bounded, context-aware multi-stage pipelines.
+//
+// A pipeline reads items from a Source, passes them through any number of
+// Stages and delivers the results to a Sink. Every stage runs on its own
+// workerpool with a configurable number of workers, and stages are connected
+// by bounded buffers so a slow stage applies backpressure all the way to the
+// source instead of accumulating items in memory.
+//
+// To run typed channel stages on an existing, shared workerpool.Pool
+// instead, see the workerpool/pipeline package; its package documentation
+// lists how the two differ in execution, error handling and metrics.
+//
+// Usage:
+//
+//	p := pipeline.New(pipeline.WithName("thumbnails")).
+//		From(pipeline.FromSlice(paths)).
+//		Then(pipeline.NewStage("load", loadImage, pipeline.Workers(4))).
+//		Then(pipeline.NewStage("resize", resize, pipeline.Workers(8))).
+//		To(pipeline.ToFunc(store))
+//
+//	if err := p.Run(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// ErrSkip can be returned by a stage function to drop an item without
+// treating it as a failure. It is how filters are expressed.
+var ErrSkip = errors.New("ion: pipeline skip item")
+
+// ErrorPolicy controls how a pipeline reacts to stage or sink failures.
+type ErrorPolicy int
+
+const (
+	// StopOnError cancels the pipeline on the first failure and returns it (default).
+	StopOnError ErrorPolicy = iota
+	// ContinueOnError drops the failed item, keeps processing and returns all
+	// failures joined together once the pipeline finishes.
+	ContinueOnError
+)
+
+// String returns the string representation of the error policy.
+func (p ErrorPolicy) String() string {
+	switch p {
+	case StopOnError:
+		return "StopOnError"
+	case ContinueOnError:
+		return "ContinueOnError"
+	default:
+		return fmt.Sprintf("ErrorPolicy(%d)", int(p))
+	}
+}
+
+// Source produces the items of a pipeline by calling emit for each one. emit
+// returns an error once the pipeline is canceled; sources should stop and
+// return it.
+type Source func(ctx context.Context, emit func(item any) error) error
+
+// Sink consumes the items that leave the last stage. It is called from a
+// single goroutine.
+type Sink func(ctx context.Context, item any) error
+
+// FromSlice creates a source that emits every element of items.
+func FromSlice[T any](items []T) Source {
+	return func(ctx context.Context, emit func(any) error) error {
+		for _, item := range items {
+			if err := emit(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// FromChannel creates a source that emits items received from ch until it is closed.
+func FromChannel[T any](ch <-chan T) Source {
+	return func(ctx context.Context, emit func(any) error) error {
+		for {
+			select {
+			case item, ok := <-ch:
+				if !ok {
+					return nil
+				}
+				if err := emit(item); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// ToFunc creates a sink that passes each item to fn.
+func ToFunc[T any](fn func(ctx context.Context, item T) error) Sink {
+	return func(ctx context.Context, item any) error {
+		return fn(ctx, item.(T))
+	}
+}
+
+// ToChannel creates a sink that sends each item to ch. The channel is not
+// closed when the pipeline finishes.
+func ToChannel[T any](ch chan<- T) Sink {
+	return func(ctx context.Context, item any) error {
+		select {
+		case ch <- item.(T):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Stage is a processing step in a pipeline.
+type Stage struct {
+	name    string
+	fn      func(ctx context.Context, item any) (any, error)
+	workers int
+	buffer  int
+
+	processed atomic.Uint64
+	failed    atomic.Uint64
+	skipped   atomic.Uint64
+}
+
+// StageOption configures a stage.
+type StageOption func(*Stage)
+
+// Workers sets the number of items a stage processes concurrently.
+func Workers(n int) StageOption {
+	return func(s *Stage) {
+		s.workers = n
+	}
+}
+
+// Buffer sets the size of the bounded buffer feeding the next stage.
+func Buffer(n int) StageOption {
+	return func(s *Stage) {
+		s.buffer = n
+	}
+}
+
+// NewStage creates a stage that transforms items of type In into items of type Out.
+func NewStage[In, Out any](name string, fn func(ctx context.Context, in In) (Out, error), opts ...StageOption) *Stage {
+	s := &Stage{
+		name: name,
+		fn: func(ctx context.Context, item any) (any, error) {
+			return fn(ctx, item.(In))
+		},
+		workers: 1,
+		buffer:  1,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.workers <= 0 {
+		s.workers = 1
+	}
+	if s.buffer < 0 {
+		s.buffer = 0
+	}
+
+	return s
+}
+
+// Filter creates a stage that forwards only the items for which keep returns true.
+func Filter[T any](name string, keep func(ctx context.Context, item T) bool, opts ...StageOption) *Stage {
+	return NewStage(name, func(ctx context.Context, item T) (T, error) {
+		if !keep(ctx, item) {
+			return item, ErrSkip
+		}
+		return item, nil
+	}, opts...)
+}
+
+// Name returns the stage name.
+func (s *Stage) Name() string {
+	return s.name
+}
+
+// StageMetrics holds counters for a single stage.
+type StageMetrics struct {
+	Name      string
+	Processed uint64 // items that completed the stage successfully
+	Failed    uint64 // items that returned an error
+	Skipped   uint64 // items dropped via ErrSkip
+}
+
+// Metrics holds counters for a pipeline across all runs.
+type Metrics struct {
+	Emitted uint64 // items produced by the source
+	Sunk    uint64 // items accepted by the sink
+	Failed  uint64 // items rejected by the sink
+	Stages  []StageMetrics
+}
+
+// Pipeline connects a source, stages and a sink.
+type Pipeline struct {
+	name   string
+	policy ErrorPolicy
+	onErr  func(stage string, item any, err error)
+	obs    *observe.Observability
+
+	source Source
+	stages []*Stage
+	sink   Sink
+
+	emitted    atomic.Uint64
+	sunk       atomic.Uint64
+	sinkFailed atomic.Uint64
+}
+
+// Option configures pipeline behavior.
+type Option func(*config)
+
+type config struct {
+	name   string
+	policy ErrorPolicy
+	onErr  func(stage string, item any, err error)
+	obs    *observe.Observability
+}
+
+// WithName sets the pipeline name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithErrorPolicy sets how the pipeline reacts to failures.
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(c *config) {
+		c.policy = policy
+	}
+}
+
+// WithErrorHandler sets a callback invoked for every failed item, regardless
+// of the error policy.
+func WithErrorHandler(fn func(stage string, item any, err error)) Option {
+	return func(c *config) {
+		c.onErr = fn
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// New creates an empty pipeline.
+func New(opts ...Option) *Pipeline {
+	cfg := &config{
+		name:   "",
+		policy: StopOnError,
+		obs:    observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return &Pipeline{
+		name:   cfg.name,
+		policy: cfg.policy,
+		onErr:  cfg.onErr,
+		obs:    cfg.obs,
+	}
+}
+
+// From sets the pipeline source.
+func (p *Pipeline) From(source Source) *Pipeline {
+	p.source = source
+	return p
+}
+
+// Then appends a stage to the pipeline.
+func (p *Pipeline) Then(stage *Stage) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// To sets the pipeline sink. Without a sink, items leaving the last stage are discarded.
+func (p *Pipeline) To(sink Sink) *Pipeline {
+	p.sink = sink
+	return p
+}
+
+// run holds the state of a single pipeline execution.
+type run struct {
+	p      *Pipeline
+	ctx    context.Context
+	cancel context.CancelFunc
+	obs    *observe.Observability // p.obs for the caller's ctx
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// fail records a failure and applies the error policy.
+func (r *run) fail(stage string, item any, err error) {
+	err = NewStageError(r.p.name, stage, err)
+
+	if r.p.onErr != nil {
+		r.p.onErr(stage, item, err)
+	}
+	r.obs.Logger.Debug("pipeline item failed", "pipeline", r.p.name, "stage", stage, "error", err)
+
+	r.mu.Lock()
+	if r.p.policy == StopOnError {
+		if len(r.errs) == 0 {
+			r.errs = append(r.errs, err)
+		}
+		r.mu.Unlock()
+		r.cancel()
+		return
+	}
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+}
+
+// Run executes the pipeline until the source is exhausted and every item has
+// left the sink, or until ctx is canceled. It returns the first failure under
+// StopOnError, all failures joined under ContinueOnError, or the context error
+// if ctx ended the run.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if p.source == nil {
+		return NewNoSourceError(p.name)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	obs := p.obs.WithContext(ctx)
+	spanCtx, finish := obs.Tracer.Start(runCtx, "pipeline.run", "pipeline", p.name)
+	r := &run{p: p, ctx: spanCtx, cancel: cancel, obs: obs}
+
+	obs.Logger.Info("pipeline started", "pipeline", p.name, "stages", len(p.stages))
+
+	firstBuffer := 1
+	if len(p.stages) > 0 {
+		firstBuffer = p.stages[0].buffer
+	}
+	src := make(chan any, firstBuffer)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(src)
+		err := p.source(r.ctx, func(item any) error {
+			select {
+			case src <- item:
+				p.emitted.Add(1)
+				return nil
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			}
+		})
+		if err != nil && r.ctx.Err() == nil {
+			r.fail("source", nil, err)
+		}
+	}()
+
+	var in <-chan any = src
+	for i, stage := range p.stages {
+		buffer := 1
+		if i+1 < len(p.stages) {
+			buffer = p.stages[i+1].buffer
+		}
+		out := make(chan any, buffer)
+
+		wg.Add(1)
+		go func(stage *Stage, in <-chan any, out chan<- any) {
+			defer wg.Done()
+			r.runStage(stage, in, out)
+		}(stage, in, out)
+
+		in = out
+	}
+
+	// The sink runs on the calling goroutine.
+	for item := range in {
+		if r.ctx.Err() != nil {
+			continue
+		}
+		if p.sink == nil {
+			continue
+		}
+		if err := p.sink(r.ctx, item); err != nil {
+			p.sinkFailed.Add(1)
+			r.fail("sink", item, err)
+			continue
+		}
+		p.sunk.Add(1)
+		obs.Metrics.Inc("ion_pipeline_items_total", "pipeline", p.name, "stage", "sink", "result", "success")
+	}
+
+	wg.Wait()
+
+	r.mu.Lock()
+	err := errors.Join(r.errs...)
+	r.mu.Unlock()
+
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	finish(err)
+
+	if err != nil {
+		obs.Logger.Warn("pipeline finished with errors", "pipeline", p.name, "error", err)
+	} else {
+		obs.Logger.Info("pipeline finished", "pipeline", p.name)
+	}
+
+	return err
+}
+
+// runStage feeds items from in to the stage's workerpool and closes out once
+// every submitted item has been processed.
+func (r *run) runStage(stage *Stage, in <-chan any, out chan<- any) {
+	defer close(out)
+
+	pool := workerpool.New(stage.workers, stage.buffer,
+		workerpool.WithName(r.p.name+"_"+stage.name),
+		workerpool.WithLogger(r.p.obs.Logger),
+		workerpool.WithMetrics(r.p.obs.Metrics),
+		workerpool.WithTracer(r.p.obs.Tracer),
+	)
+	defer pool.Close(context.Background())
+
+	var pending sync.WaitGroup
+	for item := range in {
+		if r.ctx.Err() != nil {
+			// Keep draining so upstream stages can finish.
+			continue
+		}
+
+		item := item
+		pending.Add(1)
+		err := pool.Submit(r.ctx, func(ctx context.Context) error {
+			defer pending.Done()
+			r.process(ctx, stage, item, out)
+			return nil
+		})
+		if err != nil {
+			pending.Done()
+		}
+	}
+
+	pending.Wait()
+}
+
+// process runs a stage function for a single item.
+func (r *run) process(ctx context.Context, stage *Stage, item any, out chan<- any) {
+	result, err := stage.fn(ctx, item)
+
+	switch {
+	case errors.Is(err, ErrSkip):
+		stage.skipped.Add(1)
+		r.obs.Metrics.Inc("ion_pipeline_items_total", "pipeline", r.p.name, "stage", stage.name, "result", "skipped")
+		return
+
+	case err != nil:
+		stage.failed.Add(1)
+		r.obs.Metrics.Inc("ion_pipeline_items_total", "pipeline", r.p.name, "stage", stage.name, "result", "error")
+		r.fail(stage.name, item, err)
+		return
+	}
+
+	stage.processed.Add(1)
+	r.obs.Metrics.Inc("ion_pipeline_items_total", "pipeline", r.p.name, "stage", stage.name, "result", "success")
+
+	select {
+	case out <- result:
+	case <-ctx.Done():
+	}
+}
+
+// Metrics returns a snapshot of the pipeline counters.
+func (p *Pipeline) Metrics() Metrics {
+	m := Metrics{
+		Emitted: p.emitted.Load(),
+		Sunk:    p.sunk.Load(),
+		Failed:  p.sinkFailed.Load(),
+		Stages:  make([]StageMetrics, len(p.stages)),
+	}
+
+	for i, s := range p.stages {
+		m.Stages[i] = StageMetrics{
+			Name:      s.name,
+			Processed: s.processed.Load(),
+			Failed:    s.failed.Load(),
+			Skipped:   s.skipped.Load(),
+		}
+	}
+
+	return m
+}
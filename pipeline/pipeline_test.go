@@ -0,0 +1,149 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/kolosys/ion/pipeline"
+)
+
+func TestPipelineRun(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+
+	p := pipeline.New(pipeline.WithName("test")).
+		From(pipeline.FromSlice([]int{1, 2, 3, 4, 5, 6})).
+		Then(pipeline.NewStage("square", func(ctx context.Context, n int) (int, error) {
+			return n * n, nil
+		}, pipeline.Workers(3))).
+		Then(pipeline.Filter("even", func(ctx context.Context, n int) bool {
+			return n%2 == 0
+		})).
+		Then(pipeline.NewStage("format", func(ctx context.Context, n int) (string, error) {
+			return strconv.Itoa(n), nil
+		}, pipeline.Workers(2), pipeline.Buffer(4))).
+		To(pipeline.ToFunc(func(ctx context.Context, s string) error {
+			mu.Lock()
+			got = append(got, s)
+			mu.Unlock()
+			return nil
+		}))
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sort.Strings(got)
+	want := []string{"16", "36", "4"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, got)
+			break
+		}
+	}
+
+	m := p.Metrics()
+	if m.Emitted != 6 || m.Sunk != 3 {
+		t.Errorf("expected 6 emitted and 3 sunk, got %d and %d", m.Emitted, m.Sunk)
+	}
+	if m.Stages[1].Skipped != 3 {
+		t.Errorf("expected 3 skipped by filter, got %d", m.Stages[1].Skipped)
+	}
+}
+
+func TestPipelineStopOnError(t *testing.T) {
+	boom := errors.New("boom")
+
+	p := pipeline.New().
+		From(pipeline.FromSlice([]int{1, 2, 3, 4, 5})).
+		Then(pipeline.NewStage("fail", func(ctx context.Context, n int) (int, error) {
+			if n == 3 {
+				return 0, boom
+			}
+			return n, nil
+		}))
+
+	err := p.Run(context.Background())
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected boom, got %v", err)
+	}
+
+	var pipeErr *pipeline.PipelineError
+	if !errors.As(err, &pipeErr) || pipeErr.Stage != "fail" {
+		t.Errorf("expected PipelineError for stage fail, got %v", err)
+	}
+}
+
+func TestPipelineContinueOnError(t *testing.T) {
+	var handled sync.Map
+
+	p := pipeline.New(
+		pipeline.WithErrorPolicy(pipeline.ContinueOnError),
+		pipeline.WithErrorHandler(func(stage string, item any, err error) {
+			handled.Store(item, stage)
+		}),
+	).
+		From(pipeline.FromSlice([]int{1, 2, 3, 4})).
+		Then(pipeline.NewStage("odd", func(ctx context.Context, n int) (int, error) {
+			if n%2 == 1 {
+				return 0, errors.New("odd")
+			}
+			return n, nil
+		}, pipeline.Workers(2)))
+
+	out := make(chan int, 4)
+	p.To(pipeline.ToChannel(out))
+
+	err := p.Run(context.Background())
+	if err == nil {
+		t.Fatal("expected joined error")
+	}
+	close(out)
+
+	count := 0
+	for range out {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected 2 items delivered, got %d", count)
+	}
+	if _, ok := handled.Load(1); !ok {
+		t.Error("expected error handler to be called for item 1")
+	}
+}
+
+func TestPipelineCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	src := make(chan int)
+
+	p := pipeline.New().
+		From(pipeline.FromChannel(src)).
+		Then(pipeline.NewStage("id", func(ctx context.Context, n int) (int, error) {
+			return n, nil
+		}))
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	src <- 1
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPipelineNoSource(t *testing.T) {
+	err := pipeline.New(pipeline.WithName("empty")).Run(context.Background())
+	var pipeErr *pipeline.PipelineError
+	if !errors.As(err, &pipeErr) {
+		t.Errorf("expected PipelineError, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is the cause of the context passed to fn when the policy
+// timeout expires, and is returned (wrapped) by the call. It wraps
+// context.DeadlineExceeded
+var ErrTimeout = fmt.Errorf("policy timeout: %w", context.DeadlineExceeded)
+
+// PolicyError represents policy errors with context
+type PolicyError struct {
+	Op         string // stage that failed: "timeout", "rate limit" or "bulkhead"
+	PolicyName string // name of the policy
+	Err        error  // underlying error
+}
+
+func (e *PolicyError) Error() string {
+	if e.PolicyName != "" {
+		return fmt.Sprintf("ion: policy %q %s: %v", e.PolicyName, e.Op, e.Err)
+	}
+	return fmt.Sprintf("ion: policy %s: %v", e.Op, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// NewTimeoutError creates an error for a call that exceeded the policy
+// timeout, keeping the error of the last attempt
+func NewTimeoutError(policyName string, timeout time.Duration, last error) error {
+	err := fmt.Errorf("%w after %v", ErrTimeout, timeout)
+	if last != nil && last != ErrTimeout {
+		err = fmt.Errorf("%w after %v: %w", ErrTimeout, timeout, last)
+	}
+	return &PolicyError{
+		Op:         "timeout",
+		PolicyName: policyName,
+		Err:        err,
+	}
+}
+
+// NewLimiterError creates an error for an attempt that could not get a rate
+// limiter token
+func NewLimiterError(policyName string, err error) error {
+	return &PolicyError{
+		Op:         "rate limit",
+		PolicyName: policyName,
+		Err:        err,
+	}
+}
+
+// NewBulkheadError creates an error for an attempt that could not get a
+// bulkhead permit
+func NewBulkheadError(policyName string, err error) error {
+	return &PolicyError{
+		Op:         "bulkhead",
+		PolicyName: policyName,
+		Err:        err,
+	}
+}
@@ -0,0 +1,362 @@
+// Package policy composes Ion's resilience primitives into a single call.
+//
+// A Policy wraps an operation in a fixed chain, from the outside in:
+//
+//	timeout → retry → circuit breaker → rate limit → bulkhead → fn
+//
+// The timeout bounds the whole call including retries and waits. Each retry
+// attempt goes through the circuit breaker, so failures are counted per
+// attempt and an open circuit stops the retries. Inside the breaker every
+// attempt waits for a rate limiter token and then for a bulkhead permit, so
+// both bound the load actually reaching the dependency. Every stage is
+// optional; a Policy with no options simply calls fn.
+//
+// Usage:
+//
+//	p := policy.New(
+//		policy.WithName("payments"),
+//		policy.WithTimeout(2*time.Second),
+//		policy.WithRetries(3),
+//		policy.WithCircuit(circuit.New("payments")),
+//		policy.WithLimiter(ratelimit.NewTokenBucket(ratelimit.PerSecond(100), 20)),
+//		policy.WithBulkhead(semaphore.NewWeighted(16)),
+//	)
+//
+//	receipt, err := policy.Call(ctx, p, func(ctx context.Context) (*Receipt, error) {
+//		return client.Charge(ctx, order)
+//	})
+package policy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/semaphore"
+)
+
+// Option configures policy behavior.
+type Option func(*config)
+
+type config struct {
+	name     string
+	timeout  time.Duration
+	retries  int
+	backoff  backoff.Strategy
+	retryIf  func(error) bool
+	circuit  circuit.CircuitBreaker
+	limiter  ratelimit.Limiter
+	bulkhead semaphore.Semaphore
+	clock    clock.Clock
+	obs      *observe.Observability
+}
+
+// WithName sets the policy name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithTimeout bounds the whole call, retries and waits included. When it
+// expires the context passed to fn is canceled with ErrTimeout as its cause
+// and the call fails with an error wrapping ErrTimeout. Zero, the default,
+// means no timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithRetries sets how many times a failed attempt is retried. The default is
+// 0.
+func WithRetries(n int) Option {
+	return func(c *config) {
+		c.retries = n
+	}
+}
+
+// WithBackoff sets the wait between retries. The default is exponential
+// from 100ms, capped at 5s, with full jitter.
+func WithBackoff(b backoff.Strategy) Option {
+	return func(c *config) {
+		c.backoff = b
+	}
+}
+
+// WithRetryIf sets which errors are retried. By default every error is
+// retried except context cancellation and open-circuit rejections.
+func WithRetryIf(retryIf func(error) bool) Option {
+	return func(c *config) {
+		c.retryIf = retryIf
+	}
+}
+
+// WithCircuit runs every attempt through the circuit breaker.
+func WithCircuit(cb circuit.CircuitBreaker) Option {
+	return func(c *config) {
+		c.circuit = cb
+	}
+}
+
+// WithLimiter waits on the rate limiter before every attempt.
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(c *config) {
+		c.limiter = l
+	}
+}
+
+// WithBulkhead holds one permit of the semaphore for the duration of every
+// attempt, capping how many attempts run at once.
+func WithBulkhead(sem semaphore.Semaphore) Option {
+	return func(c *config) {
+		c.bulkhead = sem
+	}
+}
+
+// WithClock sets the clock used for the timeout, retry backoff and latency
+// measurement.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// Policy runs operations through a chain of resilience stages. It is safe for
+// concurrent use and holds no per-call state, so one Policy is meant to be
+// shared by every call to the same dependency.
+type Policy struct {
+	name     string
+	timeout  time.Duration
+	retries  int
+	backoff  backoff.Strategy
+	retryIf  func(error) bool
+	circuit  circuit.CircuitBreaker
+	limiter  ratelimit.Limiter
+	bulkhead semaphore.Semaphore
+	clock    clock.Clock
+	obs      *observe.Observability
+}
+
+// New creates a policy.
+func New(opts ...Option) *Policy {
+	cfg := &config{
+		name:    "",
+		backoff: backoff.Cap(backoff.FullJitter(backoff.Exponential(100*time.Millisecond)), 5*time.Second),
+		retryIf: defaultRetryIf,
+		clock:   clock.Real(),
+		obs:     observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.retries < 0 {
+		cfg.retries = 0
+	}
+
+	p := &Policy{
+		name:     cfg.name,
+		timeout:  cfg.timeout,
+		retries:  cfg.retries,
+		backoff:  cfg.backoff,
+		retryIf:  cfg.retryIf,
+		circuit:  cfg.circuit,
+		limiter:  cfg.limiter,
+		bulkhead: cfg.bulkhead,
+		clock:    cfg.clock,
+		obs:      cfg.obs,
+	}
+
+	p.obs.Logger.Info("policy created",
+		"name", p.name,
+		"timeout", p.timeout,
+		"retries", p.retries,
+		"circuit", p.circuit != nil,
+		"limiter", p.limiter != nil,
+		"bulkhead", p.bulkhead != nil,
+	)
+
+	return p
+}
+
+// Name returns the policy name.
+func (p *Policy) Name() string {
+	return p.name
+}
+
+// Execute runs fn through the policy. See Call.
+func (p *Policy) Execute(ctx context.Context, fn func(context.Context) error) error {
+	_, err := Call(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Call runs fn through the policy and returns the result of the first
+// successful attempt. If every attempt fails, Call returns the error of the
+// last one; failures of the rate limit and bulkhead stages are wrapped in a
+// *PolicyError naming the stage.
+func Call[T any](ctx context.Context, p *Policy, fn func(context.Context) (T, error)) (T, error) {
+	obs := p.obs.WithContext(ctx)
+
+	var zero T
+	start := p.clock.Now()
+
+	spanCtx, finish := obs.Tracer.Start(ctx, "policy.execute", "policy_name", p.name)
+
+	callCtx := spanCtx
+	if p.timeout > 0 {
+		var cancel context.CancelCauseFunc
+		callCtx, cancel = context.WithCancelCause(spanCtx)
+		timer := p.clock.AfterFunc(p.timeout, func() { cancel(ErrTimeout) })
+		defer func() {
+			timer.Stop()
+			cancel(nil)
+		}()
+	}
+
+	v, attempts, err := retry(callCtx, p, fn)
+	if err != nil && context.Cause(callCtx) == ErrTimeout && ctx.Err() == nil {
+		err = NewTimeoutError(p.name, p.timeout, err)
+	}
+
+	result := resultOf(err)
+	obs.Metrics.Inc("ion_policy_executions_total", "policy_name", p.name, "result", result)
+	obs.Metrics.Histogram("ion_policy_duration_seconds", p.clock.Since(start).Seconds(),
+		"policy_name", p.name, "result", result)
+	if err != nil {
+		obs.Logger.Debug("policy execution failed",
+			"policy_name", p.name, "attempts", attempts, "result", result, "error", err)
+		finish(err)
+		return zero, err
+	}
+
+	finish(nil)
+	return v, nil
+}
+
+// retry runs attempts until one succeeds, the error is not retryable or the
+// retries are used up. It returns the number of attempts made.
+func retry[T any](ctx context.Context, p *Policy, fn func(context.Context) (T, error)) (T, int, error) {
+	obs := p.obs.WithContext(ctx)
+
+	var zero T
+	delays := p.backoff.Sequence()
+
+	for attempt := 1; ; attempt++ {
+		v, err := attemptOnce(ctx, p, fn)
+		if err == nil {
+			return v, attempt, nil
+		}
+
+		if attempt > p.retries || ctx.Err() != nil || !p.retryIf(err) {
+			return zero, attempt, err
+		}
+
+		obs.Metrics.Inc("ion_policy_retries_total", "policy_name", p.name)
+
+		timer := p.clock.NewTimer(delays.Next())
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, attempt, err
+		}
+	}
+}
+
+// attemptOnce runs fn once through the circuit breaker, rate limiter and
+// bulkhead.
+func attemptOnce[T any](ctx context.Context, p *Policy, fn func(context.Context) (T, error)) (T, error) {
+	var v T
+	guarded := func(ctx context.Context) error {
+		if p.limiter != nil {
+			if err := p.limiter.WaitN(ctx, 1); err != nil {
+				return NewLimiterError(p.name, err)
+			}
+		}
+		if p.bulkhead != nil {
+			if err := p.bulkhead.Acquire(ctx, 1); err != nil {
+				return NewBulkheadError(p.name, err)
+			}
+			defer p.bulkhead.Release(1)
+		}
+
+		var err error
+		v, err = fn(ctx)
+		return err
+	}
+
+	var err error
+	if p.circuit != nil {
+		err = p.circuit.Call(ctx, guarded)
+	} else {
+		err = guarded(ctx)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+func defaultRetryIf(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var ce *circuit.CircuitError
+	if errors.As(err, &ce) && ce.IsCircuitOpen() {
+		return false
+	}
+	return true
+}
+
+// resultOf classifies the outcome of a call for metrics.
+func resultOf(err error) string {
+	var ce *circuit.CircuitError
+	var pe *PolicyError
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case errors.As(err, &ce) && ce.IsCircuitOpen():
+		return "circuit_open"
+	case errors.As(err, &pe) && pe.Op == "rate limit":
+		return "rate_limited"
+	case errors.As(err, &pe) && pe.Op == "bulkhead":
+		return "bulkhead_rejected"
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	default:
+		return "failure"
+	}
+}
@@ -0,0 +1,210 @@
+package policy_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/policy"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/semaphore"
+	"github.com/kolosys/ion/sim"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Run("no stages", func(t *testing.T) {
+		p := policy.New()
+
+		v, err := policy.Call(context.Background(), p, func(ctx context.Context) (int, error) {
+			return 42, nil
+		})
+		if v != 42 || err != nil {
+			t.Errorf("expected 42, got %d, %v", v, err)
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		p := policy.New(policy.WithRetries(2), policy.WithBackoff(backoff.Constant(0)))
+
+		var attempts atomic.Int32
+		err := p.Execute(context.Background(), func(ctx context.Context) error {
+			if attempts.Add(1) < 3 {
+				return errors.New("transient")
+			}
+			return nil
+		})
+		if err != nil || attempts.Load() != 3 {
+			t.Errorf("expected success on the third attempt, got %v after %d", err, attempts.Load())
+		}
+	})
+
+	t.Run("retry if", func(t *testing.T) {
+		permanent := errors.New("permanent")
+		p := policy.New(
+			policy.WithRetries(5),
+			policy.WithBackoff(backoff.Constant(0)),
+			policy.WithRetryIf(func(err error) bool { return !errors.Is(err, permanent) }),
+		)
+
+		var attempts atomic.Int32
+		err := p.Execute(context.Background(), func(ctx context.Context) error {
+			attempts.Add(1)
+			return permanent
+		})
+		if !errors.Is(err, permanent) || attempts.Load() != 1 {
+			t.Errorf("expected a single attempt, got %v after %d", err, attempts.Load())
+		}
+	})
+
+	t.Run("open circuit stops retries", func(t *testing.T) {
+		p := policy.New(
+			policy.WithCircuit(circuit.New("upstream", circuit.WithFailureThreshold(2))),
+			policy.WithRetries(5),
+			policy.WithBackoff(backoff.Constant(0)),
+		)
+
+		var attempts atomic.Int32
+		err := p.Execute(context.Background(), func(ctx context.Context) error {
+			attempts.Add(1)
+			return errors.New("down")
+		})
+
+		var ce *circuit.CircuitError
+		if !errors.As(err, &ce) || !ce.IsCircuitOpen() {
+			t.Fatalf("expected open circuit error, got %v", err)
+		}
+		if attempts.Load() != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		rec := sim.NewRecorder()
+		p := policy.New(
+			policy.WithName("payments"),
+			policy.WithTimeout(time.Second),
+			policy.WithClock(clk),
+			policy.WithMetrics(rec),
+		)
+
+		var cause error
+		errc := make(chan error, 1)
+		go func() {
+			errc <- p.Execute(context.Background(), func(ctx context.Context) error {
+				<-ctx.Done()
+				cause = context.Cause(ctx)
+				return ctx.Err()
+			})
+		}()
+
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+
+		err := <-errc
+		if !errors.Is(err, policy.ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a timeout error, got %v", err)
+		}
+		if cause != policy.ErrTimeout {
+			t.Errorf("expected fn to see ErrTimeout as the cause, got %v", cause)
+		}
+		if rec.Count("ion_policy_executions_total", "result", "timeout") != 1 {
+			t.Error("expected the timeout to be recorded")
+		}
+	})
+
+	t.Run("timeout covers retries", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		p := policy.New(
+			policy.WithTimeout(time.Second),
+			policy.WithRetries(10),
+			policy.WithBackoff(backoff.Constant(400*time.Millisecond)),
+			policy.WithClock(clk),
+		)
+
+		boom := errors.New("boom")
+		var attempts atomic.Int32
+		errc := make(chan error, 1)
+		go func() {
+			errc <- p.Execute(context.Background(), func(ctx context.Context) error {
+				attempts.Add(1)
+				return boom
+			})
+		}()
+
+		for i := 0; i < 3; i++ {
+			clk.BlockUntil(2) // the timeout and a backoff timer
+			clk.Advance(400 * time.Millisecond)
+		}
+
+		err := <-errc
+		if !errors.Is(err, policy.ErrTimeout) || !errors.Is(err, boom) {
+			t.Errorf("expected a timeout wrapping the last error, got %v", err)
+		}
+		if attempts.Load() != 3 {
+			t.Errorf("expected 3 attempts before the timeout, got %d", attempts.Load())
+		}
+	})
+
+	t.Run("bulkhead", func(t *testing.T) {
+		p := policy.New(policy.WithBulkhead(semaphore.NewWeighted(2)))
+
+		var running, peak atomic.Int32
+		done := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			go func() {
+				defer func() { done <- struct{}{} }()
+				p.Execute(context.Background(), func(ctx context.Context) error {
+					n := running.Add(1)
+					for {
+						cur := peak.Load()
+						if n <= cur || peak.CompareAndSwap(cur, n) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					running.Add(-1)
+					return nil
+				})
+			}()
+		}
+		for i := 0; i < 8; i++ {
+			<-done
+		}
+
+		if peak.Load() > 2 {
+			t.Errorf("expected at most 2 concurrent attempts, got %d", peak.Load())
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		rec := sim.NewRecorder()
+		p := policy.New(
+			policy.WithName("api"),
+			policy.WithLimiter(ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 1)),
+			policy.WithMetrics(rec),
+		)
+
+		fn := func(ctx context.Context) error { return nil }
+		if err := p.Execute(context.Background(), fn); err != nil {
+			t.Fatalf("expected the first call to pass, got %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := p.Execute(ctx, fn)
+
+		var pe *policy.PolicyError
+		if !errors.As(err, &pe) || pe.Op != "rate limit" || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a rate limit error, got %v", err)
+		}
+		if rec.Count("ion_policy_executions_total", "result", "rate_limited") != 1 {
+			t.Error("expected the rejection to be recorded")
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrClosed is returned (wrapped) by Push after Close, and by Pop once the
+	// queue is closed and empty.
+	ErrClosed = errors.New("queue is closed")
+
+	// ErrFull is returned (wrapped) by TryPush when the queue has no room.
+	ErrFull = errors.New("queue is full")
+)
+
+// QueueError represents queue errors with context
+type QueueError struct {
+	Op        string // operation that failed
+	QueueName string // name of the queue
+	Err       error  // underlying error
+}
+
+func (e *QueueError) Error() string {
+	if e.QueueName != "" {
+		return fmt.Sprintf("ion: queue %q %s: %v", e.QueueName, e.Op, e.Err)
+	}
+	return fmt.Sprintf("ion: queue %s: %v", e.Op, e.Err)
+}
+
+func (e *QueueError) Unwrap() error {
+	return e.Err
+}
+
+// NewQueueClosedError creates an error indicating the queue is closed
+func NewQueueClosedError(queueName, op string) error {
+	return &QueueError{
+		Op:        op,
+		QueueName: queueName,
+		Err:       ErrClosed,
+	}
+}
+
+// NewQueueFullError creates an error indicating the queue is full
+func NewQueueFullError(queueName string) error {
+	return &QueueError{
+		Op:        "push",
+		QueueName: queueName,
+		Err:       ErrFull,
+	}
+}
@@ -0,0 +1,261 @@
+// Package queue provides a generic bounded multi-producer, multi-consumer
+// queue.
+//
+// A Queue is a FIFO with a fixed capacity that any number of goroutines may
+// push to and pop from. It offers blocking, context-aware operations alongside
+// non-blocking ones, and well-defined close semantics: once closed, pushes
+// fail while pops keep draining the remaining items before reporting
+// ErrClosed, so no accepted item is ever lost.
+//
+// Usage:
+//
+//	q := queue.New[Job](128)
+//
+//	// producer
+//	if err := q.Push(ctx, job); err != nil {
+//		return err
+//	}
+//
+//	// consumer
+//	for job := range q.All(ctx) {
+//		handle(job)
+//	}
+//
+// The queue is built on a buffered channel, which the Go runtime already
+// implements as a lock-efficient MPMC ring buffer; Queue adds close semantics
+// that are safe with concurrent producers, context cancellation and
+// introspection.
+package queue
+
+import (
+	"context"
+	"iter"
+	"sync"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// Option configures queue behavior.
+type Option func(*config)
+
+type config struct {
+	name string
+	obs  *observe.Observability
+}
+
+// WithName sets the queue name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// Queue is a bounded FIFO queue safe for concurrent use.
+type Queue[T any] struct {
+	name  string
+	obs   *observe.Observability
+	items chan T
+
+	// closeMu lets Close wait for pushes that are in progress, so that no
+	// push succeeds after Close returns. Pushes hold it for reading.
+	closeMu sync.RWMutex
+	done    chan struct{} // closed when Close starts; fails new pushes
+	sealed  chan struct{} // closed once no push can succeed; ends pops
+	once    sync.Once
+}
+
+// New creates a queue holding at most capacity items. A capacity below 1 is
+// treated as 1.
+func New[T any](capacity int, opts ...Option) *Queue[T] {
+	cfg := &config{
+		name: "",
+		obs:  observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	q := &Queue[T]{
+		name:   cfg.name,
+		obs:    cfg.obs,
+		items:  make(chan T, capacity),
+		done:   make(chan struct{}),
+		sealed: make(chan struct{}),
+	}
+
+	q.obs.Logger.Info("queue created", "name", q.name, "capacity", capacity)
+
+	return q
+}
+
+// Name returns the queue name.
+func (q *Queue[T]) Name() string {
+	return q.name
+}
+
+// Push adds v to the queue, blocking while it is full. It returns an error
+// wrapping ErrClosed if the queue is closed, or the context error if ctx is
+// done first.
+func (q *Queue[T]) Push(ctx context.Context, v T) error {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+
+	if q.isClosed() {
+		return NewQueueClosedError(q.name, "push")
+	}
+
+	select {
+	case q.items <- v:
+		return nil
+	default:
+	}
+
+	select {
+	case q.items <- v:
+		return nil
+	case <-q.done:
+		return NewQueueClosedError(q.name, "push")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryPush adds v to the queue without blocking. It returns an error wrapping
+// ErrFull if there is no room, or ErrClosed if the queue is closed.
+func (q *Queue[T]) TryPush(v T) error {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+
+	if q.isClosed() {
+		return NewQueueClosedError(q.name, "push")
+	}
+
+	select {
+	case q.items <- v:
+		return nil
+	default:
+		q.obs.Metrics.Inc("ion_queue_rejected_total", "queue_name", q.name)
+		return NewQueueFullError(q.name)
+	}
+}
+
+// Pop removes and returns the oldest item, blocking while the queue is
+// empty. Once the queue is closed, Pop keeps returning the remaining items
+// and then an error wrapping ErrClosed. It returns the context error if ctx
+// is done first.
+func (q *Queue[T]) Pop(ctx context.Context) (T, error) {
+	select {
+	case v := <-q.items:
+		return v, nil
+	default:
+	}
+
+	select {
+	case v := <-q.items:
+		return v, nil
+	case <-q.sealed:
+		if v, ok := q.TryPop(); ok {
+			return v, nil
+		}
+		var zero T
+		return zero, NewQueueClosedError(q.name, "pop")
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// TryPop removes and returns the oldest item without blocking. It reports
+// false if the queue is empty.
+func (q *Queue[T]) TryPop() (T, bool) {
+	select {
+	case v := <-q.items:
+		return v, true
+	default:
+		var zero T
+		return zero, false
+	}
+}
+
+// All returns an iterator that pops items until the queue is closed and
+// drained or ctx is done.
+func (q *Queue[T]) All(ctx context.Context) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for {
+			v, err := q.Pop(ctx)
+			if err != nil || !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of items in the queue.
+func (q *Queue[T]) Len() int {
+	return len(q.items)
+}
+
+// Cap returns the queue capacity.
+func (q *Queue[T]) Cap() int {
+	return cap(q.items)
+}
+
+// Close stops the queue from accepting items and wakes blocked producers and
+// consumers. Items already in the queue can still be popped. When Close
+// returns no further push can succeed. It is safe to call more than once.
+func (q *Queue[T]) Close() {
+	closed := false
+	q.once.Do(func() {
+		close(q.done)
+		closed = true
+	})
+	if !closed {
+		return
+	}
+
+	// Wait out pushes that raced with close(q.done) before letting pops
+	// report the queue as drained.
+	q.closeMu.Lock()
+	close(q.sealed)
+	q.closeMu.Unlock()
+
+	q.obs.Logger.Info("queue closed", "name", q.name, "remaining", len(q.items))
+}
+
+// Closed reports whether Close has been called.
+func (q *Queue[T]) Closed() bool {
+	return q.isClosed()
+}
+
+// Done returns a channel that is closed when the queue is closed.
+func (q *Queue[T]) Done() <-chan struct{} {
+	return q.sealed
+}
+
+func (q *Queue[T]) isClosed() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,164 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/queue"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("fifo", func(t *testing.T) {
+		q := queue.New[int](3)
+		for i := 1; i <= 3; i++ {
+			if err := q.Push(context.Background(), i); err != nil {
+				t.Fatalf("push %d: %v", i, err)
+			}
+		}
+		if q.Len() != 3 || q.Cap() != 3 {
+			t.Errorf("expected len 3 cap 3, got %d %d", q.Len(), q.Cap())
+		}
+		for i := 1; i <= 3; i++ {
+			v, err := q.Pop(context.Background())
+			if err != nil || v != i {
+				t.Errorf("expected %d, got %d, %v", i, v, err)
+			}
+		}
+	})
+
+	t.Run("non-blocking", func(t *testing.T) {
+		q := queue.New[int](1)
+		if _, ok := q.TryPop(); ok {
+			t.Error("expected TryPop on empty queue to fail")
+		}
+		if err := q.TryPush(1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := q.TryPush(2); !errors.Is(err, queue.ErrFull) {
+			t.Errorf("expected ErrFull, got %v", err)
+		}
+		if v, ok := q.TryPop(); !ok || v != 1 {
+			t.Errorf("expected 1, got %d, %v", v, ok)
+		}
+	})
+
+	t.Run("push blocks until room", func(t *testing.T) {
+		q := queue.New[int](1)
+		q.Push(context.Background(), 1)
+
+		pushed := make(chan error, 1)
+		go func() { pushed <- q.Push(context.Background(), 2) }()
+
+		select {
+		case <-pushed:
+			t.Fatal("expected push to block")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		q.Pop(context.Background())
+		if err := <-pushed; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		q := queue.New[int](1)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := q.Pop(ctx); err != context.DeadlineExceeded {
+			t.Errorf("expected deadline exceeded on pop, got %v", err)
+		}
+		q.Push(context.Background(), 1)
+		if err := q.Push(ctx, 2); err != context.DeadlineExceeded {
+			t.Errorf("expected deadline exceeded on push, got %v", err)
+		}
+	})
+
+	t.Run("close drains remaining items", func(t *testing.T) {
+		q := queue.New[int](4, queue.WithName("jobs"))
+		q.Push(context.Background(), 1)
+		q.Push(context.Background(), 2)
+		q.Close()
+		q.Close()
+
+		if !q.Closed() {
+			t.Error("expected queue to report closed")
+		}
+		if err := q.Push(context.Background(), 3); !errors.Is(err, queue.ErrClosed) {
+			t.Errorf("expected ErrClosed on push, got %v", err)
+		}
+
+		var got []int
+		for v := range q.All(context.Background()) {
+			got = append(got, v)
+		}
+		if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+			t.Errorf("expected [1 2], got %v", got)
+		}
+		if _, err := q.Pop(context.Background()); !errors.Is(err, queue.ErrClosed) {
+			t.Errorf("expected ErrClosed on drained pop, got %v", err)
+		}
+	})
+
+	t.Run("close wakes blocked callers", func(t *testing.T) {
+		q := queue.New[int](1)
+		q.Push(context.Background(), 1)
+
+		pushed := make(chan error, 1)
+		go func() { pushed <- q.Push(context.Background(), 2) }()
+		time.Sleep(10 * time.Millisecond)
+		q.Close()
+
+		select {
+		case err := <-pushed:
+			if !errors.Is(err, queue.ErrClosed) {
+				t.Errorf("expected ErrClosed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("blocked push was not woken")
+		}
+	})
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	q := queue.New[int](8)
+	const producers, perProducer = 4, 500
+
+	var pwg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		pwg.Add(1)
+		go func() {
+			defer pwg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Push(context.Background(), 1)
+			}
+		}()
+	}
+
+	var mu sync.Mutex
+	total := 0
+	var cwg sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for v := range q.All(context.Background()) {
+				mu.Lock()
+				total += v
+				mu.Unlock()
+			}
+		}()
+	}
+
+	pwg.Wait()
+	q.Close()
+	cwg.Wait()
+
+	if total != producers*perProducer {
+		t.Errorf("expected %d items, got %d", producers*perProducer, total)
+	}
+}
@@ -22,6 +22,44 @@ func BenchmarkTokenBucketAllowN(b *testing.B) {
 	})
 }
 
+// BenchmarkTokenBucketAllowNParallel measures the lock-free path: every
+// goroutine takes tokens from a bucket that refills faster than they drain it.
+func BenchmarkTokenBucketAllowNParallel(b *testing.B) {
+	tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1e9), 1_000_000)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tb.AllowN(time.Now(), 1)
+		}
+	})
+}
+
+// BenchmarkTokenBucketAllowNParallelWithUpdates mixes AllowN with SetRate and
+// SetBurst, which hold the bucket lock and send concurrent takers to the
+// locked fallback until the fast path is republished.
+func BenchmarkTokenBucketAllowNParallelWithUpdates(b *testing.B) {
+	for _, every := range []int{1000, 100, 10} {
+		b.Run(fmt.Sprintf("update_every_%d", every), func(b *testing.B) {
+			tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1e9), 1_000_000)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					switch {
+					case i%(2*every) == 0:
+						tb.SetRate(ratelimit.PerSecond(1e9))
+					case i%every == 0:
+						tb.SetBurst(1_000_000)
+					default:
+						tb.AllowN(time.Now(), 1)
+					}
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkTokenBucketAllowN_Uncontended(b *testing.B) {
 	tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1000), 1000) // Large burst to avoid contention
 	now := time.Now()
@@ -0,0 +1,35 @@
+// Package chilimit provides chi middleware for Ion rate limiters.
+//
+// chi middleware is plain net/http middleware, so Middleware is
+// ratelimit.Middleware; the package adds key extractors that read chi's
+// routing context. It is a separate module so that the core ion module does
+// not depend on chi.
+//
+// Usage:
+//
+//	guard := ratelimit.NewKeyedHTTPGuard(chilimit.KeyByURLParam("tenant"), tenantLimiter)
+//	r := chi.NewRouter()
+//	r.With(chilimit.Middleware(guard)).Get("/{tenant}/orders", listOrders)
+package chilimit
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+// Middleware returns chi middleware that rate limits requests with guard.
+func Middleware(guard *ratelimit.HTTPGuard) func(http.Handler) http.Handler {
+	return ratelimit.Middleware(guard)
+}
+
+// KeyByURLParam keys requests by the value of a chi URL parameter, such as
+// a tenant or account ID. URL parameters are only known once the request
+// is routed, so use it with middleware added by With or inside a Route
+// group, not with Use on the root router.
+func KeyByURLParam(name string) ratelimit.KeyFunc {
+	return func(r *http.Request) string {
+		return chi.URLParam(r, name)
+	}
+}
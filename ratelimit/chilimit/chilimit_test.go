@@ -0,0 +1,45 @@
+package chilimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/ratelimit/chilimit"
+)
+
+func TestMiddleware(t *testing.T) {
+	limiters := map[string]ratelimit.Limiter{}
+	guard := ratelimit.NewKeyedHTTPGuard(chilimit.KeyByURLParam("tenant"), func(key string) ratelimit.Limiter {
+		if _, ok := limiters[key]; !ok {
+			limiters[key] = ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1)
+		}
+		return limiters[key]
+	})
+
+	r := chi.NewRouter()
+	r.With(chilimit.Middleware(guard)).Get("/{tenant}/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	if code := get("/acme/orders"); code != http.StatusNoContent {
+		t.Errorf("first acme request: expected 204, got %d", code)
+	}
+	if code := get("/acme/orders"); code != http.StatusTooManyRequests {
+		t.Errorf("second acme request: expected 429, got %d", code)
+	}
+	if code := get("/globex/orders"); code != http.StatusNoContent {
+		t.Errorf("first globex request: expected 204, got %d", code)
+	}
+	if _, ok := limiters["acme"]; !ok {
+		t.Errorf("expected a limiter keyed by tenant, got %v", limiters)
+	}
+}
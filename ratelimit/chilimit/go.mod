@@ -0,0 +1,10 @@
+module github.com/kolosys/ion/ratelimit/chilimit
+
+go 1.24
+
+require (
+	github.com/go-chi/chi/v5 v5.3.2
+	github.com/kolosys/ion v0.0.0
+)
+
+replace github.com/kolosys/ion => ../..
@@ -0,0 +1,211 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reservable is a limiter whose tokens can be checked without taking them,
+// and reserved and then committed or canceled, as TokenBucket does. It lets
+// composite limiters take tokens from all their parts or none.
+type reservable interface {
+	Limiter
+	delayN(n int) (time.Duration, error)
+	reserveN(now time.Time, n int) bool
+	commitN(n int)
+	cancelN(n int)
+}
+
+// returner is a limiter that can give back tokens it granted, as
+// TokenBucket.ReturnN and LeakyBucket.ReturnN do.
+type returner interface {
+	ReturnN(n int)
+}
+
+// takeAll takes n tokens from every limiter or from none, and returns the
+// index of the limiter that denied them, or -1 if all allowed them.
+// Reservable limiters are reserved first and committed only once all
+// limiters have allowed the request. The others are charged after them and
+// refunded with ReturnN if a later one denies; limiters that support
+// neither keep what they granted.
+func takeAll(now time.Time, limiters []Limiter, n int) int {
+	reserved := make([]reservable, 0, len(limiters))
+	charged := make([]Limiter, 0, len(limiters))
+	undo := func() {
+		for _, r := range reserved {
+			r.cancelN(n)
+		}
+		refund(charged, n)
+	}
+
+	for i, l := range limiters {
+		r, ok := l.(reservable)
+		if !ok {
+			continue
+		}
+		if !r.reserveN(now, n) {
+			undo()
+			return i
+		}
+		reserved = append(reserved, r)
+	}
+
+	for i, l := range limiters {
+		if _, ok := l.(reservable); ok {
+			continue
+		}
+		if !l.AllowN(now, n) {
+			undo()
+			return i
+		}
+		charged = append(charged, l)
+	}
+
+	for _, r := range reserved {
+		r.commitN(n)
+	}
+	return -1
+}
+
+// refund gives n tokens back to each limiter that supports it.
+func refund(limiters []Limiter, n int) {
+	for _, l := range limiters {
+		if r, ok := l.(returner); ok {
+			r.ReturnN(n)
+		}
+	}
+}
+
+// Chain returns a limiter that allows an event only if every one of
+// limiters allows it, such as a per-user limiter and a global one. It is
+// the same as All.
+func Chain(limiters ...Limiter) Limiter {
+	return All(limiters...)
+}
+
+// All returns a limiter that allows an event only if every one of limiters
+// allows it. AllowN takes tokens from all limiters or none: a denial by one
+// leaves the others as they were. WaitN waits on the limiters in order and,
+// if one fails, as when ctx is canceled, gives back what the earlier ones
+// granted. Put the limiter that most often makes callers wait first, so
+// that tokens of the others are not held while waiting on it.
+//
+// Tokens are given back only by limiters with a ReturnN method, such as
+// TokenBucket and LeakyBucket; other limiters keep what they granted.
+func All(limiters ...Limiter) Limiter {
+	return &allLimiter{limiters: limiters}
+}
+
+// allLimiter is the limiter returned by All.
+type allLimiter struct {
+	limiters []Limiter
+}
+
+// AllowN implements Limiter.AllowN
+func (a *allLimiter) AllowN(now time.Time, n int) bool {
+	if n <= 0 {
+		return true
+	}
+	return takeAll(now, a.limiters, n) < 0
+}
+
+// WaitN implements Limiter.WaitN
+func (a *allLimiter) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	for i, l := range a.limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			refund(a.limiters[:i], n)
+			return err
+		}
+	}
+	return nil
+}
+
+// ReturnN gives n tokens back to every limiter that supports it.
+func (a *allLimiter) ReturnN(n int) {
+	refund(a.limiters, n)
+}
+
+// Any returns a limiter that allows an event if at least one of limiters
+// allows it, taking tokens from that one only, such as a dedicated quota
+// with a shared overflow pool. AllowN tries the limiters in order. WaitN
+// waits on all of them at once and takes the first grant; grants that race
+// with it are given back where the limiter supports ReturnN, so prefer
+// limiters that do. WaitN fails
+// only when every limiter failed, returning their errors joined, or when
+// ctx is done.
+func Any(limiters ...Limiter) Limiter {
+	return &anyLimiter{limiters: limiters}
+}
+
+// anyLimiter is the limiter returned by Any.
+type anyLimiter struct {
+	limiters []Limiter
+}
+
+// AllowN implements Limiter.AllowN
+func (a *anyLimiter) AllowN(now time.Time, n int) bool {
+	if n <= 0 {
+		return true
+	}
+
+	for _, l := range a.limiters {
+		if l.AllowN(now, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitN implements Limiter.WaitN
+func (a *anyLimiter) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if len(a.limiters) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var won atomic.Bool
+	results := make(chan error, len(a.limiters))
+	var wg sync.WaitGroup
+	for _, l := range a.limiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := l.WaitN(waitCtx, n)
+			if err == nil && !won.CompareAndSwap(false, true) {
+				// Granted after another limiter won
+				refund([]Limiter{l}, n)
+				err = context.Canceled
+			}
+			results <- err
+		}()
+	}
+
+	var errs []error
+	for range a.limiters {
+		err := <-results
+		if err == nil {
+			cancel()
+			wg.Wait()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
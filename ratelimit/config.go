@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Algorithm selects the limiter implementation built from a Config.
+type Algorithm string
+
+const (
+	// AlgorithmTokenBucket builds a TokenBucket (default)
+	AlgorithmTokenBucket Algorithm = "token_bucket"
+	// AlgorithmLeakyBucket builds a LeakyBucket
+	AlgorithmLeakyBucket Algorithm = "leaky_bucket"
+	// AlgorithmGCRA builds a GCRA limiter, which requires a positive rate
+	AlgorithmGCRA Algorithm = "gcra"
+)
+
+// Config declares a rate limiter, as an alternative to functional options
+// for limiters loaded from configuration files. Zero values select the same
+// defaults as the corresponding options.
+type Config struct {
+	// Name identifies the limiter in logs, metrics and errors
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Algorithm is "token_bucket", "leaky_bucket" or "gcra".
+	// Default: token_bucket
+	Algorithm Algorithm `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+
+	// Rate is the number of tokens added, or leaked, every Per
+	Rate float64 `json:"rate" yaml:"rate"`
+
+	// Per is the period Rate is measured over. Default: 1 second
+	Per time.Duration `json:"per,omitempty" yaml:"per,omitempty"`
+
+	// Burst is the token bucket burst or the leaky bucket capacity. It must
+	// be positive
+	Burst int `json:"burst" yaml:"burst"`
+
+	// Jitter is the jitter factor for WaitN, from 0 to 1. Default: 0
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+
+	// Fairness is the order in which blocked WaitN callers are served,
+	// "FIFO" or "LIFO". Default: FIFO
+	Fairness Fairness `json:"fairness,omitempty" yaml:"fairness,omitempty"`
+
+	// LeakyMode is how a leaky bucket admits requests, "meter" or "queue".
+	// Default: meter
+	LeakyMode LeakyMode `json:"leaky_mode,omitempty" yaml:"leaky_mode,omitempty"`
+
+	// SplitWaits lets WaitN take requests larger than Burst in chunks, as
+	// WithSplitWaits does. Default: false
+	SplitWaits bool `json:"split_waits,omitempty" yaml:"split_waits,omitempty"`
+
+	// Warmup is how long a token bucket takes to ramp up to Rate, as
+	// WithWarmup sets. Default: 0, no warm-up
+	Warmup time.Duration `json:"warmup,omitempty" yaml:"warmup,omitempty"`
+}
+
+// Validate checks if the configuration is valid and returns an error if not.
+func (c *Config) Validate() error {
+	switch c.Algorithm {
+	case "", AlgorithmTokenBucket, AlgorithmLeakyBucket, AlgorithmGCRA:
+	default:
+		return fmt.Errorf("unknown algorithm %q", c.Algorithm)
+	}
+
+	if c.Rate < 0 {
+		return fmt.Errorf("rate cannot be negative, got %v", c.Rate)
+	}
+
+	if c.Algorithm == AlgorithmGCRA && c.Rate == 0 {
+		return fmt.Errorf("rate must be positive for gcra, got %v", c.Rate)
+	}
+
+	if c.Per < 0 {
+		return fmt.Errorf("per cannot be negative, got %v", c.Per)
+	}
+
+	if c.Burst <= 0 {
+		return fmt.Errorf("burst must be positive, got %d", c.Burst)
+	}
+
+	if c.Warmup < 0 {
+		return fmt.Errorf("warmup cannot be negative, got %v", c.Warmup)
+	}
+
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1, got %v", c.Jitter)
+	}
+
+	switch c.Fairness {
+	case FIFO, LIFO:
+	default:
+		return fmt.Errorf("unknown fairness %v", c.Fairness)
+	}
+
+	switch c.LeakyMode {
+	case LeakyMeter, LeakyQueue:
+	default:
+		return fmt.Errorf("unknown leaky mode %d", int(c.LeakyMode))
+	}
+
+	return nil
+}
+
+// rate returns the configured rate.
+func (c *Config) rate() Rate {
+	per := c.Per
+	if per == 0 {
+		per = time.Second
+	}
+	return Rate{TokensPerSec: c.Rate / per.Seconds()}
+}
+
+// NewFromConfig creates a TokenBucket, LeakyBucket or GCRA from cfg.
+// Options are applied after the configuration, so they can supply what a
+// configuration file cannot, such as a clock or observability hooks, or
+// override configured values.
+func NewFromConfig(cfg Config, opts ...Option) (Limiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, &RateLimitError{Op: "config", LimiterName: cfg.Name, Err: err}
+	}
+
+	base := []Option{
+		WithName(cfg.Name),
+		WithJitter(cfg.Jitter),
+		WithFairness(cfg.Fairness),
+		WithLeakyMode(cfg.LeakyMode),
+		WithWarmup(cfg.Warmup),
+	}
+	if cfg.SplitWaits {
+		base = append(base, WithSplitWaits())
+	}
+	opts = append(base, opts...)
+
+	switch cfg.Algorithm {
+	case AlgorithmLeakyBucket:
+		return NewLeakyBucket(cfg.rate(), cfg.Burst, opts...), nil
+	case AlgorithmGCRA:
+		return NewGCRA(cfg.rate(), cfg.Burst, opts...), nil
+	default:
+		return NewTokenBucket(cfg.rate(), cfg.Burst, opts...), nil
+	}
+}
+
+// MarshalText encodes the fairness mode as its name.
+func (f Fairness) MarshalText() ([]byte, error) {
+	switch f {
+	case FIFO, LIFO:
+		return []byte(f.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown fairness %v", f)
+	}
+}
+
+// UnmarshalText decodes a fairness mode from its name, ignoring case.
+func (f *Fairness) UnmarshalText(text []byte) error {
+	for _, mode := range []Fairness{FIFO, LIFO} {
+		if strings.EqualFold(string(text), mode.String()) {
+			*f = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown fairness %q", text)
+}
+
+// MarshalText encodes the leaky mode as its name.
+func (m LeakyMode) MarshalText() ([]byte, error) {
+	switch m {
+	case LeakyMeter, LeakyQueue:
+		return []byte(m.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown leaky mode %d", int(m))
+	}
+}
+
+// UnmarshalText decodes a leaky mode from its name, ignoring case.
+func (m *LeakyMode) UnmarshalText(text []byte) error {
+	for _, mode := range []LeakyMode{LeakyMeter, LeakyQueue} {
+		if strings.EqualFold(string(text), mode.String()) {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown leaky mode %q", text)
+}
@@ -0,0 +1,31 @@
+// Package echolimit provides echo middleware for Ion rate limiters.
+//
+// It is a separate module so that the core ion module does not depend on
+// echo. Keying, header emission and 429 rendering are shared with the other
+// adapters through ratelimit.HTTPGuard.
+//
+// Usage:
+//
+//	limiter := ratelimit.NewTokenBucket(ratelimit.PerSecond(100), 200)
+//	e := echo.New()
+//	e.Use(echolimit.Middleware(ratelimit.NewHTTPGuard(limiter)))
+package echolimit
+
+import (
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware returns echo middleware that rate limits requests with guard.
+// Rejected requests are rendered by the guard and the next handler is not
+// called.
+func Middleware(guard *ratelimit.HTTPGuard) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !guard.Serve(c.Response(), c.Request()) {
+				return nil
+			}
+			return next(c)
+		}
+	}
+}
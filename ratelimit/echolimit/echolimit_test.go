@@ -0,0 +1,37 @@
+package echolimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/ratelimit/echolimit"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	limiter := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1)
+	e := echo.New()
+	e.Use(echolimit.Middleware(ratelimit.NewHTTPGuard(limiter)))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	if rec := get(); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	rec := get()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("expected rate limit headers, got %v", rec.Header())
+	}
+}
@@ -0,0 +1,22 @@
+module github.com/kolosys/ion/ratelimit/echolimit
+
+go 1.24.0
+
+require (
+	github.com/kolosys/ion v0.0.0
+	github.com/labstack/echo/v4 v4.15.1
+)
+
+require (
+	github.com/labstack/gommon v0.5.0 // indirect
+	github.com/mattn/go-colorable v0.1.15 // indirect
+	github.com/mattn/go-isatty v0.0.22 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.2 // indirect
+	golang.org/x/crypto v0.48.0 // indirect
+	golang.org/x/net v0.50.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
+	golang.org/x/text v0.34.0 // indirect
+)
+
+replace github.com/kolosys/ion => ../..
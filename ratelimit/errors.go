@@ -19,11 +19,14 @@ type RateLimitError struct {
 }
 
 func (e *RateLimitError) Error() string {
+	msg := fmt.Sprintf("ion: rate limiter %s: %v", e.Op, e.Err)
 	if e.LimiterName != "" {
-		return fmt.Sprintf("ion: rate limiter %q %s: %v (retry after: %v)",
-			e.LimiterName, e.Op, e.Err, e.RetryAfter)
+		msg = fmt.Sprintf("ion: rate limiter %q %s: %v", e.LimiterName, e.Op, e.Err)
 	}
-	return fmt.Sprintf("ion: rate limiter %s: %v (retry after: %v)", e.Op, e.Err, e.RetryAfter)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after: %v)", e.RetryAfter)
+	}
+	return msg
 }
 
 func (e *RateLimitError) Unwrap() error {
@@ -68,3 +71,24 @@ func NewBucketLimitError(limiterName, bucket string, remaining, limit int, retry
 		Limit:       limit,
 	}
 }
+
+// NewBurstExceededError creates an error indicating that a request for n
+// tokens can never be granted because it exceeds the burst of the limiter
+func NewBurstExceededError(limiterName string, n, burst int) error {
+	return &RateLimitError{
+		Op:          "wait",
+		LimiterName: limiterName,
+		Err:         fmt.Errorf("requested %d exceeds burst %d", n, burst),
+		Limit:       burst,
+	}
+}
+
+// NewQueueFullError creates an error indicating that a request could not
+// wait because queueSize requests were already queued
+func NewQueueFullError(limiterName string, queueSize int) error {
+	return &RateLimitError{
+		Op:          "wait",
+		LimiterName: limiterName,
+		Err:         fmt.Errorf("wait queue full (%d queued)", queueSize),
+	}
+}
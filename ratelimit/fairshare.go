@@ -0,0 +1,420 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FairShareGroup paces several named consumers that share one rate and
+// burst, each with a weighted minimum share. A consumer can always use its
+// share of the rate and borrows whatever the others leave unused, so
+// background jobs with a 20% share run at the full rate while interactive
+// traffic is idle, and still get their 20% once it is not.
+//
+// Each consumer holds a reserve of its share of the burst, refilled at its
+// share of the rate. A consumer may take any of the group's tokens except
+// those in the other consumers' reserves: one with tokens in its reserve
+// is never denied, and it can take at most its share of the burst at once.
+//
+// Usage:
+//
+//	group := ratelimit.NewFairShareGroup(ratelimit.PerSecond(100), 100, map[string]float64{
+//		"interactive": 0.8,
+//		"background":  0.2,
+//	})
+//
+//	background := group.Consumer("background")
+//	if err := background.WaitN(ctx, 1); err != nil {
+//		return err
+//	}
+type FairShareGroup struct {
+	// Configuration
+	rate  Rate
+	burst int
+	cfg   *config
+
+	// State
+	mu          sync.Mutex
+	tokens      float64
+	lastRefill  time.Time
+	initialized bool
+	consumers   map[string]*FairShareConsumer
+	order       []*FairShareConsumer // by name, so dispatch is deterministic
+}
+
+// FairShareConsumer is the limiter of one consumer of a FairShareGroup.
+type FairShareConsumer struct {
+	group *FairShareGroup
+	name  string
+	share float64 // fraction of the group's rate and burst
+	burst int     // most tokens the consumer can take at once
+
+	// Guarded by group.mu
+	reserve float64
+	waiters waitQueue
+}
+
+// NewFairShareGroup creates a group of consumers sharing rate and burst.
+// shares maps each consumer's name to its weight; a consumer's share is its
+// weight over the sum of the weights. Every share of the burst must be at
+// least one token.
+func NewFairShareGroup(rate Rate, burst int, shares map[string]float64, opts ...Option) *FairShareGroup {
+	if burst <= 0 {
+		panic("ratelimit: burst must be positive")
+	}
+	if rate.TokensPerSec < 0 {
+		panic("ratelimit: rate cannot be negative")
+	}
+	if len(shares) == 0 {
+		panic("ratelimit: fair share group needs a consumer")
+	}
+
+	total := 0.0
+	for _, weight := range shares {
+		if weight <= 0 {
+			panic("ratelimit: share must be positive")
+		}
+		total += weight
+	}
+
+	cfg := newConfig(opts...)
+
+	g := &FairShareGroup{
+		rate:      rate,
+		burst:     burst,
+		cfg:       cfg,
+		tokens:    float64(burst), // Start with full reserves
+		consumers: make(map[string]*FairShareConsumer, len(shares)),
+	}
+	for _, name := range sortedKeys(shares) {
+		share := shares[name] / total
+		reserve := share * float64(burst)
+		// Tolerate rounding, as 0.8 × 10 = 7.999...
+		consumerBurst := int(math.Floor(reserve + 1e-9))
+		if consumerBurst < 1 {
+			panic(fmt.Sprintf("ratelimit: share of consumer %q is less than one token of the burst", name))
+		}
+
+		c := &FairShareConsumer{
+			group:   g,
+			name:    name,
+			share:   share,
+			burst:   consumerBurst,
+			reserve: reserve,
+		}
+		c.waiters = waitQueue{
+			fairness: cfg.fairness,
+			clock:    cfg.clock,
+			jitter:   cfg.jitterFn,
+			take:     c.takeLocked,
+			wake: func() {
+				g.mu.Lock()
+				defer g.mu.Unlock()
+				c.waiters.dispatchLocked()
+			},
+		}
+		g.consumers[name] = c
+		g.order = append(g.order, c)
+	}
+
+	g.cfg.obs.Logger.Info("fair share group created",
+		"name", cfg.name,
+		"rate", rate.String(),
+		"burst", burst,
+		"consumers", len(shares),
+	)
+
+	return g
+}
+
+// Consumer returns the limiter of the named consumer. It panics if the
+// group has no such consumer.
+func (g *FairShareGroup) Consumer(name string) *FairShareConsumer {
+	c, ok := g.consumers[name]
+	if !ok {
+		panic(fmt.Sprintf("ratelimit: unknown fair share consumer %q", name))
+	}
+	return c
+}
+
+// Tokens returns the tokens of the group, including those in reserves.
+func (g *FairShareGroup) Tokens() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.refillLocked(g.cfg.clock.Now())
+	return g.tokens
+}
+
+// refillLocked adds tokens to the group and the reserves based on elapsed
+// time. Must be called with g.mu held.
+func (g *FairShareGroup) refillLocked(now time.Time) {
+	if !g.initialized {
+		g.lastRefill = now
+		g.initialized = true
+		return
+	}
+
+	elapsed := now.Sub(g.lastRefill).Seconds()
+	if elapsed <= 0 || g.rate.TokensPerSec <= 0 {
+		return
+	}
+
+	added := g.rate.TokensPerSec * elapsed
+	g.tokens = math.Min(g.tokens+added, float64(g.burst))
+	for _, c := range g.order {
+		c.reserve = math.Min(c.reserve+c.share*added, c.full())
+	}
+	g.lastRefill = now
+}
+
+// reservedLocked returns the tokens in the reserves of consumers other
+// than c. Must be called with g.mu held.
+func (g *FairShareGroup) reservedLocked(c *FairShareConsumer) float64 {
+	reserved := 0.0
+	for _, o := range g.order {
+		if o != c {
+			reserved += o.reserve
+		}
+	}
+	return reserved
+}
+
+// Name returns the name of the consumer.
+func (c *FairShareConsumer) Name() string {
+	return c.name
+}
+
+// Share returns the fraction of the group's rate and burst guaranteed to
+// the consumer.
+func (c *FairShareConsumer) Share() float64 {
+	return c.share
+}
+
+// Burst returns the most tokens the consumer can take at once.
+func (c *FairShareConsumer) Burst() int {
+	return c.burst
+}
+
+// full returns the size of the consumer's reserve.
+func (c *FairShareConsumer) full() float64 {
+	return c.share * float64(c.group.burst)
+}
+
+// AllowN reports whether the consumer can take n tokens at time now.
+// It returns true if the tokens were taken, false otherwise. Tokens are
+// never taken ahead of the consumer's callers blocked in WaitN, so AllowN
+// fails while any are queued.
+func (c *FairShareConsumer) AllowN(now time.Time, n int) bool {
+	return c.AllowNWithInfo(now, n).Allowed
+}
+
+// AllowNWithInfo is AllowN, also reporting the consumer's burst, the
+// tokens available to it and, if the tokens were not taken, how long until
+// they may be, if the other consumers take none meanwhile.
+func (c *FairShareConsumer) AllowNWithInfo(now time.Time, n int) Decision {
+	g := c.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.refillLocked(now)
+
+	d := Decision{Allowed: true, Limit: c.burst}
+	switch {
+	case n <= 0:
+	case c.waiters.len() == 0 && n <= c.burst && c.availableLocked() >= float64(n):
+		c.consumeLocked(n)
+		c.record("allowed")
+	default:
+		c.record("denied")
+		d.Allowed = false
+		d.RetryAfter = -1
+		if n <= c.burst {
+			// Queued waiters are served first
+			d.RetryAfter = c.delayLocked(min(n+c.waiters.tokens(), c.burst))
+		}
+	}
+	d.Remaining = max(int(c.availableLocked()), 0)
+	return d
+}
+
+// WaitN blocks until the consumer can take n tokens or the context is
+// canceled. Blocked callers of a consumer are queued and served one at a
+// time in the order set by WithFairness, FIFO by default. Requests larger
+// than the consumer's burst fail.
+func (c *FairShareConsumer) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	// Fast path: try to get tokens immediately
+	g := c.group
+	if c.AllowN(g.cfg.clock.Now(), n) {
+		return nil
+	}
+
+	// Slow path: wait for tokens
+	obs := g.cfg.obs.WithContext(ctx)
+
+	g.mu.Lock()
+	if n > c.burst {
+		g.mu.Unlock()
+		return NewBurstExceededError(g.cfg.name, n, c.burst)
+	}
+
+	w := c.waiters.push(n)
+	c.waiters.dispatchLocked()
+	queued := c.waiters.len()
+	g.mu.Unlock()
+
+	obs.Logger.Debug("fair share consumer waiting",
+		"limiter_name", g.cfg.name,
+		"consumer", c.name,
+		"requested", n,
+		"queued", queued,
+	)
+
+	start := g.cfg.clock.Now()
+
+	select {
+	case <-ctx.Done():
+		g.mu.Lock()
+		if !c.waiters.remove(w) && w.err == nil {
+			// Granted as ctx was canceled; hand the tokens to the next waiter
+			c.giveBackLocked(n)
+		}
+		c.waiters.dispatchLocked()
+		g.mu.Unlock()
+
+		c.record("canceled")
+		return ctx.Err()
+
+	case <-w.ready:
+		if w.err != nil {
+			return w.err
+		}
+		obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
+			g.cfg.clock.Since(start).Seconds(), "limiter_name", g.cfg.name, "consumer", c.name)
+		return nil
+	}
+}
+
+// ReturnN gives back n tokens taken by AllowN or WaitN for an operation
+// that failed before consuming the guarded resource. They go back to the
+// consumer's reserve as far as it has room.
+func (c *FairShareConsumer) ReturnN(n int) {
+	if n <= 0 {
+		return
+	}
+
+	g := c.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.refillLocked(g.cfg.clock.Now())
+	c.giveBackLocked(n)
+
+	g.cfg.obs.Metrics.Add("ion_ratelimit_tokens_returned_total",
+		float64(n), "limiter_name", g.cfg.name, "consumer", c.name)
+
+	// Every consumer may now have tokens available
+	for _, o := range g.order {
+		o.waiters.dispatchLocked()
+	}
+}
+
+// takeLocked takes n tokens for a queued waiter. See takeFunc.
+// Must be called with group.mu held.
+func (c *FairShareConsumer) takeLocked(n int) (time.Duration, error) {
+	g := c.group
+	g.refillLocked(g.cfg.clock.Now())
+
+	if c.availableLocked() >= float64(n) {
+		c.consumeLocked(n)
+		c.record("allowed")
+		return 0, nil
+	}
+	return c.delayLocked(n), nil
+}
+
+// availableLocked returns the tokens the consumer may take: all of the
+// group's but those in the other consumers' reserves.
+// Must be called with group.mu held.
+func (c *FairShareConsumer) availableLocked() float64 {
+	return c.group.tokens - c.group.reservedLocked(c)
+}
+
+// consumeLocked takes n tokens from the group, drawing on the consumer's
+// reserve first. Must be called with group.mu held.
+func (c *FairShareConsumer) consumeLocked(n int) {
+	c.group.tokens -= float64(n)
+	c.reserve -= math.Min(float64(n), c.reserve)
+}
+
+// giveBackLocked returns n tokens to the group and as many as the group
+// can back to the consumer's reserve. Must be called with group.mu held.
+func (c *FairShareConsumer) giveBackLocked(n int) {
+	g := c.group
+	g.tokens = math.Min(g.tokens+float64(n), float64(g.burst))
+	unreserved := g.tokens - g.reservedLocked(nil)
+	c.reserve += math.Max(math.Min(float64(n), math.Min(c.full()-c.reserve, unreserved)), 0)
+}
+
+// delayLocked returns how long until the consumer can take n tokens if no
+// other consumer takes any meanwhile, or -1 if never at a zero rate. n must
+// not exceed the consumer's burst. Must be called with group.mu held.
+func (c *FairShareConsumer) delayLocked(n int) time.Duration {
+	g := c.group
+	need := float64(n) - c.availableLocked()
+	if need <= 0 {
+		return 0
+	}
+	rate := g.rate.TokensPerSec
+	if rate <= 0 {
+		return -1
+	}
+
+	// The available tokens grow at the group rate until the group is full,
+	// less the rates of the other reserves until each is full. Step
+	// through the times at which they fill.
+	type fill struct {
+		at    float64 // seconds from now
+		slope float64 // change in growth once full
+	}
+	fills := []fill{{(float64(g.burst) - g.tokens) / rate, -rate}}
+	slope := rate
+	for _, o := range g.order {
+		if o == c || o.reserve >= o.full() {
+			continue
+		}
+		r := o.share * rate
+		slope -= r
+		fills = append(fills, fill{(o.full() - o.reserve) / r, r})
+	}
+	sort.Slice(fills, func(i, j int) bool {
+		return fills[i].at < fills[j].at
+	})
+
+	elapsed := 0.0
+	for _, f := range fills {
+		if slope > 0 && elapsed+need/slope <= f.at {
+			elapsed += need / slope
+			break
+		}
+		need -= slope * (f.at - elapsed)
+		elapsed = f.at
+		slope += f.slope
+	}
+	// Once all are full, the consumer has its whole reserve available
+	return max(time.Duration(math.Ceil(elapsed*float64(time.Second))), 1)
+}
+
+// record reports a request outcome to metrics.
+func (c *FairShareConsumer) record(result string) {
+	c.group.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+		"limiter_name", c.group.cfg.name, "consumer", c.name, "result", result)
+}
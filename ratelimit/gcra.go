@@ -0,0 +1,297 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// GCRA implements the Generic Cell Rate Algorithm. Rather than counting
+// tokens, it tracks the theoretical arrival time (TAT) of the next request:
+// each admitted request pushes the TAT forward by the emission interval,
+// and a request is allowed as long as the TAT stays within the burst
+// tolerance of now. Admission matches a token bucket of the same rate and
+// burst, but the state is a single timestamp in integer nanoseconds, so it
+// does not accumulate floating point drift under very high rates, and
+// waiters are paced exactly one emission interval apart.
+type GCRA struct {
+	// Configuration
+	rate     Rate
+	burst    int
+	interval time.Duration // emission interval between requests
+	cfg      *config
+
+	// State
+	mu      sync.Mutex
+	tat     time.Time // theoretical arrival time of the next request
+	waiters waitQueue
+}
+
+// NewGCRA creates a new GCRA rate limiter.
+// rate determines the sustained request rate and must be positive.
+// burst is the number of requests that may arrive back to back.
+func NewGCRA(rate Rate, burst int, opts ...Option) *GCRA {
+	if burst <= 0 {
+		panic("ratelimit: burst must be positive")
+	}
+	if rate.TokensPerSec <= 0 {
+		panic("ratelimit: rate must be positive")
+	}
+
+	cfg := newConfig(opts...)
+
+	g := &GCRA{
+		rate:     rate,
+		burst:    burst,
+		interval: emissionInterval(rate),
+		cfg:      cfg,
+	}
+	g.waiters = waitQueue{
+		fairness: cfg.fairness,
+		clock:    cfg.clock,
+		jitter:   cfg.jitterFn,
+		take:     g.takeLocked,
+		wake: func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.waiters.dispatchLocked()
+		},
+	}
+
+	g.cfg.obs.Logger.Info("gcra limiter created",
+		"name", cfg.name,
+		"rate", rate.String(),
+		"burst", burst,
+		"emission_interval", g.interval,
+	)
+
+	return g
+}
+
+// emissionInterval returns the time between requests at rate, at least one
+// nanosecond.
+func emissionInterval(rate Rate) time.Duration {
+	return max(time.Duration(math.Round(float64(time.Second)/rate.TokensPerSec)), 1)
+}
+
+// AllowN reports whether n requests conform at time now.
+// It returns true if the requests were admitted, false otherwise. Requests
+// are never admitted ahead of callers blocked in WaitN, so AllowN fails
+// while any are queued.
+func (g *GCRA) AllowN(now time.Time, n int) bool {
+	return g.AllowNWithInfo(now, n).Allowed
+}
+
+// AllowNWithInfo is AllowN, also reporting the burst, the requests that
+// still conform and, if the requests were not admitted, how long until
+// they conform.
+func (g *GCRA) AllowNWithInfo(now time.Time, n int) Decision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	d := Decision{Allowed: true, Limit: g.burst}
+	switch {
+	case n <= 0:
+	case g.waiters.len() == 0 && g.delayLocked(now, n) == 0:
+		g.admitLocked(now, n)
+	default:
+		g.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", g.cfg.name, "result", "denied")
+		d.Allowed = false
+		d.RetryAfter = -1
+		if n <= g.burst {
+			// Queued waiters are admitted first
+			d.RetryAfter = g.delayLocked(now, n+g.waiters.tokens())
+		}
+	}
+	d.Remaining = g.remainingLocked(now)
+	return d
+}
+
+// WaitN blocks until n requests conform or the context is canceled.
+// Blocked callers are queued and served one at a time in the order set by
+// WithFairness, FIFO by default.
+func (g *GCRA) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	// Fast path: try to admit the requests immediately
+	if g.AllowN(g.cfg.clock.Now(), n) {
+		return nil
+	}
+
+	// Slow path: wait for the TAT to come within tolerance
+	return g.waitSlow(ctx, n)
+}
+
+// waitSlow queues the request and blocks until the queue grants it.
+func (g *GCRA) waitSlow(ctx context.Context, n int) error {
+	obs := g.cfg.obs.WithContext(ctx)
+
+	g.mu.Lock()
+	if n > g.burst {
+		g.mu.Unlock()
+		return NewBurstExceededError(g.cfg.name, n, g.burst)
+	}
+
+	w := g.waiters.push(n)
+	g.waiters.dispatchLocked()
+	queued := g.waiters.len()
+	g.mu.Unlock()
+
+	obs.Logger.Debug("gcra limiter waiting",
+		"limiter_name", g.cfg.name,
+		"requested", n,
+		"queued", queued,
+	)
+
+	start := g.cfg.clock.Now()
+
+	select {
+	case <-ctx.Done():
+		g.mu.Lock()
+		if !g.waiters.remove(w) && w.err == nil {
+			// Granted as ctx was canceled; give the slots to the next waiter
+			g.tat = g.tat.Add(-time.Duration(n) * g.interval)
+		}
+		g.waiters.dispatchLocked()
+		g.mu.Unlock()
+
+		obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", g.cfg.name, "result", "canceled")
+		return ctx.Err()
+
+	case <-w.ready:
+		if w.err != nil {
+			return w.err
+		}
+		obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
+			g.cfg.clock.Since(start).Seconds(), "limiter_name", g.cfg.name)
+		return nil
+	}
+}
+
+// takeLocked admits n requests for a queued waiter. See takeFunc.
+// Must be called with g.mu held.
+func (g *GCRA) takeLocked(n int) (time.Duration, error) {
+	if n > g.burst {
+		// The burst shrank while the request was queued
+		return 0, NewBurstExceededError(g.cfg.name, n, g.burst)
+	}
+
+	now := g.cfg.clock.Now()
+	if delay := g.delayLocked(now, n); delay > 0 {
+		return delay, nil
+	}
+	g.admitLocked(now, n)
+	return 0, nil
+}
+
+// delayLocked returns how long until n requests conform, 0 if they do now.
+// Must be called with g.mu held.
+func (g *GCRA) delayLocked(now time.Time, n int) time.Duration {
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	// The requests conform once the new TAT is within burst intervals of now
+	allowAt := tat.Add(time.Duration(n-g.burst) * g.interval)
+	return max(allowAt.Sub(now), 0)
+}
+
+// admitLocked moves the TAT forward for n admitted requests.
+// Must be called with g.mu held.
+func (g *GCRA) admitLocked(now time.Time, n int) {
+	if g.tat.Before(now) {
+		g.tat = now
+	}
+	g.tat = g.tat.Add(time.Duration(n) * g.interval)
+
+	g.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+		"limiter_name", g.cfg.name, "result", "allowed")
+}
+
+// Remaining returns how many requests conform now.
+func (g *GCRA) Remaining() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.remainingLocked(g.cfg.clock.Now())
+}
+
+// remainingLocked returns how many requests conform at now.
+// Must be called with g.mu held.
+func (g *GCRA) remainingLocked(now time.Time) int {
+	backlog := max(g.tat.Sub(now), 0)
+	used := int((backlog + g.interval - 1) / g.interval)
+	return max(g.burst-used, 0)
+}
+
+// Rate returns the sustained request rate.
+func (g *GCRA) Rate() Rate {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rate
+}
+
+// Burst returns the number of requests that may arrive back to back.
+func (g *GCRA) Burst() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.burst
+}
+
+// EmissionInterval returns the time between requests at the sustained rate.
+func (g *GCRA) EmissionInterval() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.interval
+}
+
+// SetRate updates the sustained request rate dynamically. Requests already
+// admitted ahead of now are respaced at the new rate. Rates that are not
+// positive are ignored.
+func (g *GCRA) SetRate(rate Rate) {
+	if rate.TokensPerSec <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	interval := emissionInterval(rate)
+	now := g.cfg.clock.Now()
+	if backlog := g.tat.Sub(now); backlog > 0 {
+		// Keep the same number of requests in the backlog
+		g.tat = now.Add(time.Duration(float64(backlog) * float64(interval) / float64(g.interval)))
+	}
+	g.rate = rate
+	g.interval = interval
+
+	g.cfg.obs.Logger.Debug("rate updated",
+		"limiter_name", g.cfg.name,
+		"new_rate", rate.String(),
+	)
+
+	g.waiters.dispatchLocked()
+}
+
+// SetBurst updates the number of requests that may arrive back to back.
+func (g *GCRA) SetBurst(burst int) {
+	if burst <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.burst = burst
+
+	g.cfg.obs.Logger.Debug("burst updated",
+		"limiter_name", g.cfg.name,
+		"new_burst", burst,
+	)
+
+	g.waiters.dispatchLocked()
+}
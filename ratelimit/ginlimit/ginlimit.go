@@ -0,0 +1,30 @@
+// Package ginlimit provides gin middleware for Ion rate limiters.
+//
+// It is a separate module so that the core ion module does not depend on
+// gin. Keying, header emission and 429 rendering are shared with the other
+// adapters through ratelimit.HTTPGuard.
+//
+// Usage:
+//
+//	limiter := ratelimit.NewTokenBucket(ratelimit.PerSecond(100), 200)
+//	router := gin.New()
+//	router.Use(ginlimit.Middleware(ratelimit.NewHTTPGuard(limiter)))
+package ginlimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kolosys/ion/ratelimit"
+)
+
+// Middleware returns gin middleware that rate limits requests with guard.
+// Rejected requests are rendered by the guard and the handler chain is
+// aborted.
+func Middleware(guard *ratelimit.HTTPGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !guard.Serve(c.Writer, c.Request) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
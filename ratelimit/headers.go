@@ -0,0 +1,237 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderInfo is the rate limit state an upstream API reports in its
+// response headers.
+type HeaderInfo struct {
+	Limit      int           // requests allowed per window, 0 if not reported
+	Window     time.Duration // length of the window, 0 if not reported
+	Remaining  int           // requests left in the current window, -1 if not reported
+	ResetAfter time.Duration // until the window resets, 0 if not reported
+	Global     bool          // the limit covers every route, not just this one
+	Bucket     string        // upstream bucket or resource name, if reported
+}
+
+// HeaderScheme parses the rate limit headers of one family of APIs. Set
+// MultiTierConfig.HeaderScheme to the scheme of the upstream API; the
+// default is XRateLimitHeaders.
+type HeaderScheme interface {
+	// ParseHeaders returns the rate limit state reported in h as of now,
+	// or false if h carries no rate limit headers of this scheme.
+	ParseHeaders(h http.Header, now time.Time) (HeaderInfo, bool)
+}
+
+// HeaderSchemeFunc adapts a function to a HeaderScheme.
+type HeaderSchemeFunc func(h http.Header, now time.Time) (HeaderInfo, bool)
+
+// ParseHeaders implements HeaderScheme.ParseHeaders
+func (f HeaderSchemeFunc) ParseHeaders(h http.Header, now time.Time) (HeaderInfo, bool) {
+	return f(h, now)
+}
+
+// Built-in header schemes.
+var (
+	// XRateLimitHeaders reads the common X-RateLimit-Limit, -Remaining,
+	// -Reset-After and -Bucket headers. X-RateLimit-Reset is read as a
+	// Unix time if it is one, and as seconds otherwise. X-RateLimit-Global:
+	// true or X-RateLimit-Scope: global marks a global limit.
+	XRateLimitHeaders HeaderScheme = HeaderSchemeFunc(func(h http.Header, now time.Time) (HeaderInfo, bool) {
+		return parseXRateLimit(h, now, false)
+	})
+
+	// DiscordHeaders reads Discord's X-RateLimit-* headers, where
+	// X-RateLimit-Reset is always a Unix time and X-RateLimit-Bucket names
+	// the bucket shared by several routes.
+	DiscordHeaders HeaderScheme = HeaderSchemeFunc(func(h http.Header, now time.Time) (HeaderInfo, bool) {
+		return parseXRateLimit(h, now, true)
+	})
+
+	// GitHubHeaders reads GitHub's x-ratelimit-limit, -remaining, -reset
+	// (a Unix time) and -resource headers. GitHub limits apply to the whole
+	// account, so they are reported as global; the resource, such as
+	// "core" or "search", is reported as the bucket.
+	GitHubHeaders HeaderScheme = HeaderSchemeFunc(parseGitHub)
+
+	// StripeHeaders reads the Stripe-Rate-Limited-Reason header Stripe sets
+	// on 429 responses. Reasons starting with "global" are reported as
+	// global limits. Stripe reports no remaining count or reset time.
+	StripeHeaders HeaderScheme = HeaderSchemeFunc(parseStripe)
+
+	// AWSHeaders reads the x-amzn-ErrorType header of AWS APIs and reports
+	// ThrottlingException and TooManyRequestsException as an exhausted
+	// limit. The reset time comes from Retry-After where AWS sends it.
+	AWSHeaders HeaderScheme = HeaderSchemeFunc(parseAWS)
+
+	// IETFHeaders reads the headers of the IETF RateLimit header fields
+	// draft: the combined RateLimit and RateLimit-Policy fields
+	// (`"default";r=50;t=30` and `"default";q=100;w=60`), and the separate
+	// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset fields of
+	// earlier drafts. Only the first policy of each field is used.
+	IETFHeaders HeaderScheme = HeaderSchemeFunc(parseIETF)
+)
+
+// epochThreshold separates Unix times from delays in seconds in
+// X-RateLimit-Reset; a delay of over 30 years is not expected.
+const epochThreshold = 1e9
+
+func parseXRateLimit(h http.Header, now time.Time, epochReset bool) (HeaderInfo, bool) {
+	info := HeaderInfo{Remaining: -1}
+	found := false
+
+	if v, ok := headerInt(h, "X-RateLimit-Limit"); ok {
+		info.Limit, found = v, true
+	}
+	if v, ok := headerInt(h, "X-RateLimit-Remaining"); ok {
+		info.Remaining, found = v, true
+	}
+	if v, ok := headerFloat(h, "X-RateLimit-Reset-After"); ok {
+		info.ResetAfter, found = secondsToDuration(v), true
+	} else if v, ok := headerFloat(h, "X-RateLimit-Reset"); ok {
+		if epochReset || v > epochThreshold {
+			info.ResetAfter = untilUnix(v, now)
+		} else {
+			info.ResetAfter = secondsToDuration(v)
+		}
+		found = true
+	}
+	if v := h.Get("X-RateLimit-Bucket"); v != "" {
+		info.Bucket, found = v, true
+	}
+	if h.Get("X-RateLimit-Global") == "true" || h.Get("X-RateLimit-Scope") == "global" {
+		info.Global, found = true, true
+	}
+
+	return info, found
+}
+
+func parseGitHub(h http.Header, now time.Time) (HeaderInfo, bool) {
+	info := HeaderInfo{Remaining: -1, Global: true}
+	found := false
+
+	if v, ok := headerInt(h, "X-RateLimit-Limit"); ok {
+		info.Limit, found = v, true
+	}
+	if v, ok := headerInt(h, "X-RateLimit-Remaining"); ok {
+		info.Remaining, found = v, true
+	}
+	if v, ok := headerFloat(h, "X-RateLimit-Reset"); ok {
+		info.ResetAfter, found = untilUnix(v, now), true
+	}
+	if v := h.Get("X-RateLimit-Resource"); v != "" {
+		info.Bucket, found = v, true
+	}
+
+	return info, found
+}
+
+func parseStripe(h http.Header, _ time.Time) (HeaderInfo, bool) {
+	reason := h.Get("Stripe-Rate-Limited-Reason")
+	if reason == "" {
+		return HeaderInfo{Remaining: -1}, false
+	}
+	return HeaderInfo{
+		Remaining: 0,
+		Global:    strings.HasPrefix(reason, "global"),
+	}, true
+}
+
+func parseAWS(h http.Header, now time.Time) (HeaderInfo, bool) {
+	errorType := h.Get("X-Amzn-ErrorType")
+	if !strings.HasPrefix(errorType, "ThrottlingException") &&
+		!strings.HasPrefix(errorType, "TooManyRequestsException") {
+		return HeaderInfo{Remaining: -1}, false
+	}
+
+	info := HeaderInfo{Remaining: 0}
+	if d, ok := headerRetryAfter(h, now); ok {
+		info.ResetAfter = max(d, 0)
+	}
+	return info, true
+}
+
+func parseIETF(h http.Header, _ time.Time) (HeaderInfo, bool) {
+	info := HeaderInfo{Remaining: -1}
+	found := false
+
+	if v, ok := headerInt(h, "RateLimit-Limit"); ok {
+		info.Limit, found = v, true
+	}
+	if v, ok := headerInt(h, "RateLimit-Remaining"); ok {
+		info.Remaining, found = v, true
+	}
+	if v, ok := headerFloat(h, "RateLimit-Reset"); ok {
+		info.ResetAfter, found = secondsToDuration(v), true
+	}
+
+	if name, params, ok := firstPolicy(h.Get("RateLimit")); ok {
+		found = true
+		if name != "" {
+			info.Bucket = name
+		}
+		if v, err := strconv.Atoi(params["r"]); err == nil {
+			info.Remaining = v
+		}
+		if v, err := strconv.ParseFloat(params["t"], 64); err == nil {
+			info.ResetAfter = secondsToDuration(v)
+		}
+	}
+	if name, params, ok := firstPolicy(h.Get("RateLimit-Policy")); ok {
+		found = true
+		if info.Bucket == "" {
+			info.Bucket = name
+		}
+		if v, err := strconv.Atoi(params["q"]); err == nil {
+			info.Limit = v
+		} else if v, err := strconv.Atoi(name); err == nil {
+			// Earlier drafts lead with the quota: 100;w=60
+			info.Limit, info.Bucket = v, ""
+		}
+		if v, err := strconv.ParseFloat(params["w"], 64); err == nil {
+			info.Window = secondsToDuration(v)
+		}
+	}
+
+	return info, found
+}
+
+// firstPolicy splits the first member of a RateLimit or RateLimit-Policy
+// field, such as `"default";r=50;t=30`, into its name and parameters.
+func firstPolicy(field string) (string, map[string]string, bool) {
+	member, _, _ := strings.Cut(field, ",")
+	member = strings.TrimSpace(member)
+	if member == "" {
+		return "", nil, false
+	}
+
+	parts := strings.Split(member, ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if key, value, ok := strings.Cut(strings.TrimSpace(p), "="); ok {
+			params[key] = strings.Trim(value, `"`)
+		}
+	}
+	return strings.Trim(strings.TrimSpace(parts[0]), `"`), params, true
+}
+
+func headerInt(h http.Header, key string) (int, bool) {
+	v, err := strconv.Atoi(strings.TrimSpace(h.Get(key)))
+	return v, err == nil
+}
+
+func headerFloat(h http.Header, key string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(h.Get(key)), 64)
+	return v, err == nil
+}
+
+// untilUnix returns the time from now until the Unix time in seconds, or
+// zero if it has passed.
+func untilUnix(seconds float64, now time.Time) time.Duration {
+	at := time.Unix(0, int64(seconds*float64(time.Second)))
+	return max(at.Sub(now), 0)
+}
@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc extracts the rate limit key of an HTTP request, such as the
+// client IP or API key. Requests with the same key share a limiter.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP keys requests by the client IP taken from RemoteAddr. Behind a
+// proxy, use KeyByHeader with the header the proxy sets instead.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader keys requests by the value of the given header, such as
+// "X-API-Key" or "X-Real-IP". Requests without the header share the empty
+// key.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RejectFunc renders the response to a request that exceeded its rate
+// limit. The rate limit headers are already set when it is called.
+type RejectFunc func(w http.ResponseWriter, r *http.Request, d HTTPDecision)
+
+// WithRejectHandler sets how an HTTPGuard renders rejected requests. The
+// default responds 429 Too Many Requests with a plain text body. It has no
+// effect on limiters.
+func WithRejectHandler(reject RejectFunc) Option {
+	return func(c *config) {
+		c.rejectHandler = reject
+	}
+}
+
+// HTTPDecision is the outcome of checking an HTTP request against its
+// limiter.
+type HTTPDecision struct {
+	Allowed    bool          // the request may proceed
+	Key        string        // rate limit key of the request
+	Limit      int           // capacity of the limiter, -1 if unknown
+	Remaining  int           // requests left before the limit applies, -1 if unknown
+	RetryAfter time.Duration // when a rejected request may be retried, 0 if unknown
+}
+
+// HTTPGuard applies rate limits to HTTP requests. It holds the logic shared
+// by every HTTP integration, so the net/http Middleware and the gin, echo
+// and chi adapter modules key, count, annotate and reject requests the same
+// way.
+//
+// Usage:
+//
+//	limiters := ratelimit.NewKeyedLimiter(func(string) ratelimit.Limiter {
+//		return ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 20)
+//	})
+//	guard := ratelimit.NewKeyedHTTPGuard(ratelimit.KeyByIP, limiters.Limiter)
+//	http.Handle("/", ratelimit.Middleware(guard)(handler))
+type HTTPGuard struct {
+	key        KeyFunc
+	limiterFor func(key string) Limiter
+	reject     RejectFunc
+	cfg        *config
+}
+
+// NewHTTPGuard creates a guard that checks every request against one
+// shared limiter. Only the WithName, WithClock, WithRejectHandler and
+// observability options apply.
+func NewHTTPGuard(limiter Limiter, opts ...Option) *HTTPGuard {
+	return NewKeyedHTTPGuard(func(*http.Request) string { return "" },
+		func(string) Limiter { return limiter }, opts...)
+}
+
+// NewKeyedHTTPGuard creates a guard that checks each request against the
+// limiter returned by limiterFor for its key. limiterFor must return the
+// same limiter for the same key; KeyedLimiter.Limiter does, and keeps the
+// number of limiters bounded.
+func NewKeyedHTTPGuard(key KeyFunc, limiterFor func(key string) Limiter, opts ...Option) *HTTPGuard {
+	cfg := newConfig(opts...)
+	reject := cfg.rejectHandler
+	if reject == nil {
+		reject = defaultReject
+	}
+
+	return &HTTPGuard{
+		key:        key,
+		limiterFor: limiterFor,
+		reject:     reject,
+		cfg:        cfg,
+	}
+}
+
+// Check takes one request from the limiter of r and reports the outcome.
+func (g *HTTPGuard) Check(r *http.Request) HTTPDecision {
+	key := g.key(r)
+	limiter := g.limiterFor(key)
+
+	d := HTTPDecision{Key: key, Limit: -1, Remaining: -1}
+	if il, ok := limiter.(InfoLimiter); ok {
+		info := il.AllowNWithInfo(g.cfg.clock.Now(), 1)
+		d.Allowed, d.Limit, d.Remaining = info.Allowed, info.Limit, info.Remaining
+		d.RetryAfter = max(info.RetryAfter, 0)
+	} else {
+		d.Allowed = limiter.AllowN(g.cfg.clock.Now(), 1)
+	}
+
+	if !d.Allowed {
+		g.cfg.obs.WithContext(r.Context()).Logger.Debug("http request rate limited",
+			"limiter_name", g.cfg.name,
+			"key", key,
+			"retry_after", d.RetryAfter,
+		)
+	}
+	return d
+}
+
+// WriteHeaders sets the X-RateLimit-Limit and X-RateLimit-Remaining
+// headers, when known, and Retry-After on rejected requests.
+func (g *HTTPGuard) WriteHeaders(h http.Header, d HTTPDecision) {
+	if d.Limit >= 0 {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	}
+	if d.Remaining >= 0 {
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	}
+	if !d.Allowed {
+		secs := max(int(math.Ceil(d.RetryAfter.Seconds())), 1)
+		h.Set("Retry-After", strconv.Itoa(secs))
+	}
+}
+
+// Reject renders the response to a rejected request with the configured
+// reject handler, 429 Too Many Requests by default.
+func (g *HTTPGuard) Reject(w http.ResponseWriter, r *http.Request, d HTTPDecision) {
+	g.reject(w, r, d)
+}
+
+// Serve checks r, sets the rate limit headers and, if the request is
+// rejected, renders the rejection. It reports whether the request may
+// proceed, so adapters only need to continue or abort their chain.
+func (g *HTTPGuard) Serve(w http.ResponseWriter, r *http.Request) bool {
+	d := g.Check(r)
+	g.WriteHeaders(w.Header(), d)
+	if !d.Allowed {
+		g.Reject(w, r, d)
+	}
+	return d.Allowed
+}
+
+// Middleware returns net/http middleware that rate limits requests with
+// guard. It fits any router built on http.Handler, including chi.
+func Middleware(guard *HTTPGuard) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if guard.Serve(w, r) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// defaultReject responds 429 Too Many Requests with a plain text body.
+func defaultReject(w http.ResponseWriter, r *http.Request, d HTTPDecision) {
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
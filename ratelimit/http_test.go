@@ -0,0 +1,173 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/ratelimit"
+)
+
+func TestHTTPGuard(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	get := func(h http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("shared limiter", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 2, ratelimit.WithClock(clock))
+		h := ratelimit.Middleware(ratelimit.NewHTTPGuard(tb, ratelimit.WithClock(clock)))(ok)
+
+		rec := get(h, "10.0.0.1:1234")
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", rec.Code)
+		}
+		if rec.Header().Get("X-RateLimit-Limit") != "2" || rec.Header().Get("X-RateLimit-Remaining") != "1" {
+			t.Errorf("unexpected rate limit headers: %v", rec.Header())
+		}
+
+		get(h, "10.0.0.2:1234")
+		rec = get(h, "10.0.0.3:1234")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %d", rec.Code)
+		}
+		if rec.Header().Get("Retry-After") != "1" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+			t.Errorf("unexpected rejection headers: %v", rec.Header())
+		}
+	})
+
+	t.Run("keyed limiters", func(t *testing.T) {
+		limiters := map[string]*ratelimit.TokenBucket{}
+		guard := ratelimit.NewKeyedHTTPGuard(ratelimit.KeyByIP, func(key string) ratelimit.Limiter {
+			if _, ok := limiters[key]; !ok {
+				limiters[key] = ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1)
+			}
+			return limiters[key]
+		})
+		h := ratelimit.Middleware(guard)(ok)
+
+		if rec := get(h, "10.0.0.1:1234"); rec.Code != http.StatusNoContent {
+			t.Errorf("first request from a client: expected 204, got %d", rec.Code)
+		}
+		if rec := get(h, "10.0.0.1:5678"); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("second request from the same client: expected 429, got %d", rec.Code)
+		}
+		if rec := get(h, "10.0.0.2:1234"); rec.Code != http.StatusNoContent {
+			t.Errorf("first request from another client: expected 204, got %d", rec.Code)
+		}
+	})
+
+	t.Run("custom rejection", func(t *testing.T) {
+		tb := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1)
+		tb.AllowN(time.Now(), 1)
+		guard := ratelimit.NewHTTPGuard(tb, ratelimit.WithRejectHandler(
+			func(w http.ResponseWriter, r *http.Request, d ratelimit.HTTPDecision) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+
+		rec := get(ratelimit.Middleware(guard)(ok), "10.0.0.1:1234")
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", rec.Code)
+		}
+		if rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected Retry-After 60, got %q", rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("key by header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", "secret")
+		if got := ratelimit.KeyByHeader("X-API-Key")(req); got != "secret" {
+			t.Errorf("expected key secret, got %q", got)
+		}
+	})
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransport(t *testing.T) {
+	respond := func(code int, body string) roundTripFunc {
+		return func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: code,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    r,
+			}, nil
+		}
+	}
+	newLimiter := func() *ratelimit.MultiTierLimiter {
+		config := ratelimit.DefaultMultiTierConfig()
+		config.RoutePatterns = map[string]ratelimit.RouteConfig{
+			"GET:/search": {Rate: ratelimit.PerMinute(1), Burst: 1},
+		}
+		return ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(newTestClock(time.Unix(0, 0))))
+	}
+
+	t.Run("waits on the route", func(t *testing.T) {
+		transport := ratelimit.NewTransport(newLimiter(), respond(http.StatusOK, ""))
+
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/search?q=a", nil)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req = httptest.NewRequestWithContext(ctx, http.MethodGet, "https://api.example.com/search?q=b", nil)
+		if _, err := transport.RoundTrip(req); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the exhausted route to wait until canceled, got %v", err)
+		}
+	})
+
+	t.Run("applies responses", func(t *testing.T) {
+		limiter := newLimiter()
+		transport := ratelimit.NewTransport(limiter, respond(http.StatusTooManyRequests, `{"retry_after": 5, "global": true}`))
+
+		resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "https://api.example.com/items", nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if body, _ := io.ReadAll(resp.Body); len(body) == 0 {
+			t.Error("expected the body to stay readable")
+		}
+		if !limiter.IsPaused() {
+			t.Error("expected a global 429 to pause the limiter")
+		}
+	})
+
+	t.Run("request func", func(t *testing.T) {
+		var got *ratelimit.Request
+		transport := ratelimit.NewTransport(newLimiter(), respond(http.StatusOK, ""),
+			ratelimit.WithRequestFunc(func(r *http.Request) *ratelimit.Request {
+				got = &ratelimit.Request{Method: r.Method, Endpoint: r.URL.Path, ResourceID: r.Header.Get("X-Org")}
+				return got
+			}))
+
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/items", nil)
+		req.Header.Set("X-Org", "42")
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got == nil || got.ResourceID != "42" || got.Context == nil {
+			t.Errorf("expected the mapped request with the request context, got %+v", got)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+)
+
+// JitterFunc randomizes how long a blocked WaitN caller sleeps before the
+// limiter checks again, given the wait computed from the rate. Returning
+// less than the wait is safe: the limiter checks, finds the tokens not yet
+// available and sleeps again.
+type JitterFunc func(wait time.Duration) time.Duration
+
+// UniformJitter adds up to factor (between 0 and 1) of each wait at random.
+// This is the strategy WithJitter selects.
+func UniformJitter(factor float64) JitterFunc {
+	return func(wait time.Duration) time.Duration {
+		return backoff.AddJitter(wait, factor)
+	}
+}
+
+// FullJitter picks each wait at random between zero and the computed wait.
+func FullJitter() JitterFunc {
+	return func(wait time.Duration) time.Duration {
+		return randDuration(wait)
+	}
+}
+
+// EqualJitter keeps half of each wait and randomizes the other half.
+func EqualJitter() JitterFunc {
+	return func(wait time.Duration) time.Duration {
+		return wait/2 + randDuration(wait-wait/2)
+	}
+}
+
+// DecorrelatedJitter picks each wait at random between the computed wait
+// and three times the previous jittered wait, capped at limit, so that
+// callers woken together drift further apart on every retry. It keeps the
+// previous wait, so it spreads the waiters of every limiter it is passed
+// to together.
+func DecorrelatedJitter(limit time.Duration) JitterFunc {
+	var prev atomic.Int64
+	return func(wait time.Duration) time.Duration {
+		if wait <= 0 || wait >= limit {
+			return wait
+		}
+		upper := max(3*time.Duration(prev.Load()), wait)
+		d := min(wait+randDuration(upper-wait), limit)
+		prev.Store(int64(d))
+		return d
+	}
+}
+
+// randDuration returns a random duration in [0, d].
+func randDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
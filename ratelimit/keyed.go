@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultMaxKeys bounds a KeyedLimiter when WithMaxKeys is not given.
+const defaultMaxKeys = 10000
+
+// KeyedLimiter manages one limiter per key, such as a client IP, API key or
+// tenant. Limiters are created on first use and evicted least recently used
+// first once more than the maximum number of keys are active, or once idle
+// for longer than the key TTL, so memory stays bounded however many keys are
+// seen. An evicted key starts over with a fresh limiter, and callers still
+// waiting on the evicted limiter are unaffected.
+//
+// Usage:
+//
+//	limiters := ratelimit.NewKeyedLimiter(func(string) ratelimit.Limiter {
+//		return ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 20)
+//	}, ratelimit.WithMaxKeys(50000), ratelimit.WithKeyTTL(10*time.Minute))
+//
+//	if !limiters.AllowKey(clientIP, 1) {
+//		return errTooManyRequests
+//	}
+type KeyedLimiter struct {
+	newLimiter func(key string) Limiter
+	cfg        *config
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List // of *keyedEntry, most recently used first
+}
+
+// keyedEntry is the limiter of one key.
+type keyedEntry struct {
+	key      string
+	limiter  Limiter
+	lastUsed time.Time
+}
+
+// WithMaxKeys bounds how many keys a KeyedLimiter keeps limiters for. The
+// least recently used key is evicted to make room for a new one. The
+// default is 10000. It has no effect on limiters.
+func WithMaxKeys(n int) Option {
+	return func(c *config) {
+		c.maxKeys = n
+	}
+}
+
+// WithKeyTTL evicts the limiter of a key once it has not been used for ttl.
+// A key idle that long has usually refilled to its burst, so evicting it
+// loses nothing. The default is 0, keys never expire. It has no effect on
+// limiters.
+func WithKeyTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.keyTTL = ttl
+	}
+}
+
+// NewKeyedLimiter creates a keyed limiter that calls newLimiter to create
+// the limiter of each new key. Only the WithName, WithClock, WithMaxKeys,
+// WithKeyTTL and observability options apply; options for the per-key
+// limiters are given to their constructors in newLimiter.
+func NewKeyedLimiter(newLimiter func(key string) Limiter, opts ...Option) *KeyedLimiter {
+	cfg := newConfig(opts...)
+	if cfg.maxKeys <= 0 {
+		cfg.maxKeys = defaultMaxKeys
+	}
+
+	kl := &KeyedLimiter{
+		newLimiter: newLimiter,
+		cfg:        cfg,
+		keys:       make(map[string]*list.Element),
+		order:      list.New(),
+	}
+
+	kl.cfg.obs.Logger.Info("keyed limiter created",
+		"name", cfg.name,
+		"max_keys", cfg.maxKeys,
+		"key_ttl", cfg.keyTTL,
+	)
+
+	return kl
+}
+
+// AllowKey reports whether n events may happen now for key, consuming them
+// from the limiter of key if so.
+func (kl *KeyedLimiter) AllowKey(key string, n int) bool {
+	return kl.Limiter(key).AllowN(kl.cfg.clock.Now(), n)
+}
+
+// WaitKey blocks until n events are allowed for key or ctx is done.
+func (kl *KeyedLimiter) WaitKey(ctx context.Context, key string, n int) error {
+	return kl.Limiter(key).WaitN(ctx, n)
+}
+
+// Limiter returns the limiter of key, creating it if needed, and marks key
+// as recently used. It fits NewKeyedHTTPGuard:
+//
+//	guard := ratelimit.NewKeyedHTTPGuard(ratelimit.KeyByIP, limiters.Limiter)
+func (kl *KeyedLimiter) Limiter(key string) Limiter {
+	now := kl.cfg.clock.Now()
+
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	kl.expireLocked(now)
+
+	if el, ok := kl.keys[key]; ok {
+		entry := el.Value.(*keyedEntry)
+		entry.lastUsed = now
+		kl.order.MoveToFront(el)
+		return entry.limiter
+	}
+
+	for kl.order.Len() >= kl.cfg.maxKeys {
+		kl.evictLocked(kl.order.Back(), "capacity")
+	}
+
+	entry := &keyedEntry{key: key, limiter: kl.newLimiter(key), lastUsed: now}
+	kl.keys[key] = kl.order.PushFront(entry)
+	kl.cfg.obs.Metrics.Gauge("ion_ratelimit_active_keys",
+		float64(kl.order.Len()), "limiter_name", kl.cfg.name)
+
+	return entry.limiter
+}
+
+// Remove evicts the limiter of key, if any.
+func (kl *KeyedLimiter) Remove(key string) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	if el, ok := kl.keys[key]; ok {
+		kl.evictLocked(el, "removed")
+	}
+}
+
+// Len returns the number of keys with a limiter, after evicting expired
+// ones.
+func (kl *KeyedLimiter) Len() int {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	kl.expireLocked(kl.cfg.clock.Now())
+	return kl.order.Len()
+}
+
+// expireLocked evicts keys idle for longer than the key TTL. Keys are
+// ordered by last use, so expired ones are at the back.
+// Must be called with kl.mu held.
+func (kl *KeyedLimiter) expireLocked(now time.Time) {
+	if kl.cfg.keyTTL <= 0 {
+		return
+	}
+
+	for el := kl.order.Back(); el != nil; el = kl.order.Back() {
+		if now.Sub(el.Value.(*keyedEntry).lastUsed) < kl.cfg.keyTTL {
+			return
+		}
+		kl.evictLocked(el, "ttl")
+	}
+}
+
+// evictLocked drops the limiter of el for the given reason.
+// Must be called with kl.mu held.
+func (kl *KeyedLimiter) evictLocked(el *list.Element, reason string) {
+	entry := kl.order.Remove(el).(*keyedEntry)
+	delete(kl.keys, entry.key)
+
+	kl.cfg.obs.Metrics.Inc("ion_ratelimit_key_evictions_total",
+		"limiter_name", kl.cfg.name, "reason", reason)
+	kl.cfg.obs.Metrics.Gauge("ion_ratelimit_active_keys",
+		float64(kl.order.Len()), "limiter_name", kl.cfg.name)
+}
@@ -2,20 +2,52 @@ package ratelimit
 
 import (
 	"context"
-	"fmt"
 	"math"
-	"math/rand"
 	"sync"
 	"time"
 )
 
+// LeakyMode selects how a LeakyBucket admits requests.
+type LeakyMode int
+
+const (
+	// LeakyMeter admits requests while the bucket level stays within
+	// capacity. Admitted requests proceed at once, so up to capacity requests
+	// can pass back to back before the rate applies. This is the default.
+	LeakyMeter LeakyMode = iota
+
+	// LeakyQueue treats the bucket as a FIFO queue drained at the rate.
+	// WaitN joins the queue and returns only when the request drains, so
+	// admitted requests are spaced exactly by the rate with no burst.
+	// Capacity bounds how much may be queued, and AllowN only admits a
+	// request that would drain immediately, with nothing queued ahead of it.
+	LeakyQueue
+)
+
+// String returns a string representation of the mode.
+func (m LeakyMode) String() string {
+	switch m {
+	case LeakyMeter:
+		return "meter"
+	case LeakyQueue:
+		return "queue"
+	default:
+		return "unknown"
+	}
+}
+
+// leakEpsilon absorbs floating point error when checking for an empty bucket.
+const leakEpsilon = 1e-9
+
 // LeakyBucket implements a leaky bucket rate limiter.
 // Requests are added to the bucket, and the bucket leaks at a constant rate.
-// If the bucket is full, requests are denied or must wait.
+// If the bucket is full, requests are denied or must wait. See LeakyMode for
+// the difference between metering and queueing admission.
 type LeakyBucket struct {
 	// Configuration
 	rate     Rate
 	capacity int
+	mode     LeakyMode
 	cfg      *config
 
 	// State
@@ -23,6 +55,13 @@ type LeakyBucket struct {
 	level       float64 // Current level in the bucket
 	lastLeak    time.Time
 	initialized bool
+	waiters     waitQueue // LeakyMeter waiters
+
+	// Temporary limit support; originalBurst holds the capacity
+	tempLimit *temporaryLimit
+
+	// Request outcomes, for Snapshot
+	results resultCounts
 }
 
 // NewLeakyBucket creates a new leaky bucket rate limiter.
@@ -41,52 +80,112 @@ func NewLeakyBucket(rate Rate, capacity int, opts ...Option) *LeakyBucket {
 	lb := &LeakyBucket{
 		rate:     rate,
 		capacity: capacity,
+		mode:     cfg.leakyMode,
 		cfg:      cfg,
 		level:    0, // Start with empty bucket
 	}
+	lb.waiters = waitQueue{
+		fairness: cfg.fairness,
+		clock:    cfg.clock,
+		jitter:   cfg.jitterFn,
+		take:     lb.takeLocked,
+		wake: func() {
+			lb.mu.Lock()
+			defer lb.mu.Unlock()
+			lb.waiters.dispatchLocked()
+		},
+	}
 
 	lb.cfg.obs.Logger.Info("leaky bucket created",
 		"name", cfg.name,
 		"rate", rate.String(),
 		"capacity", capacity,
+		"mode", cfg.leakyMode.String(),
 	)
 
 	return lb
 }
 
 // AllowN reports whether n requests can be added to the bucket at time now.
-// It returns true if the requests were accepted, false otherwise.
+// It returns true if the requests were accepted, false otherwise. Requests
+// are never admitted ahead of callers blocked in WaitN, so AllowN fails
+// while any are queued.
 func (lb *LeakyBucket) AllowN(now time.Time, n int) bool {
-	if n <= 0 {
-		return true
-	}
+	return lb.AllowNWithInfo(now, n).Allowed
+}
 
+// AllowNWithInfo is AllowN, also reporting the capacity, the room left
+// and, if the requests were not admitted, how long until they may be.
+func (lb *LeakyBucket) AllowNWithInfo(now time.Time, n int) Decision {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
 	lb.leakLocked(now)
 
-	// Check if we can add n requests to the bucket
-	if lb.level+float64(n) <= float64(lb.capacity) {
+	d := Decision{Allowed: true, Limit: lb.capacity}
+	switch {
+	case n <= 0:
+	case lb.admitLocked(n):
 		lb.level += float64(n)
-		lb.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
-			"limiter_name", lb.cfg.name, "result", "allowed")
+		lb.results.record(lb.cfg.obs.Metrics, lb.cfg.name, "allowed")
 		lb.cfg.obs.Metrics.Gauge("ion_ratelimit_bucket_level",
 			lb.level, "limiter_name", lb.cfg.name)
-		return true
+	default:
+		lb.results.record(lb.cfg.obs.Metrics, lb.cfg.name, "denied")
+		d.Allowed = false
+		d.RetryAfter = lb.retryAfterLocked(n)
 	}
+	d.Remaining = max(int(float64(lb.capacity)-lb.level), 0)
+	return d
+}
 
-	lb.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
-		"limiter_name", lb.cfg.name, "result", "denied")
-	return false
+// retryAfterLocked returns how long until n requests may be admitted
+// behind the queued waiters, or -1 if never at the current rate and
+// capacity. Must be called with lb.mu held.
+func (lb *LeakyBucket) retryAfterLocked(n int) time.Duration {
+	if n > lb.capacity || lb.rate.TokensPerSec <= 0 {
+		return -1
+	}
+	if lb.mode == LeakyQueue {
+		// Admitted once everything queued has drained
+		return lb.leakDuration(lb.level)
+	}
+	excess := lb.level + float64(n+lb.waiters.tokens()) - float64(lb.capacity)
+	return lb.leakDuration(math.Max(excess, 0))
+}
+
+// admitLocked reports whether n requests can be added to the bucket now.
+// Must be called with lb.mu held.
+func (lb *LeakyBucket) admitLocked(n int) bool {
+	if lb.mode == LeakyQueue {
+		// Only a request with nothing queued ahead of it drains immediately
+		return lb.level < leakEpsilon && n <= lb.capacity
+	}
+	return lb.waiters.len() == 0 && lb.level+float64(n) <= float64(lb.capacity)
 }
 
 // WaitN blocks until n requests can be added to the bucket or the context is canceled.
+// In LeakyMeter mode blocked callers are served one at a time in the order
+// set by WithFairness, FIFO by default. In LeakyQueue mode it blocks until
+// the requests have drained from the queue. Requests larger than the
+// capacity fail unless WithSplitWaits is set.
 func (lb *LeakyBucket) WaitN(ctx context.Context, n int) error {
+	if lb.cfg.split && n > lb.Capacity() {
+		return waitSplit(ctx, n, lb.Capacity, lb.waitN, lb.ReturnN)
+	}
+	return lb.waitN(ctx, n)
+}
+
+// waitN waits to add n requests at once.
+func (lb *LeakyBucket) waitN(ctx context.Context, n int) error {
 	if n <= 0 {
 		return nil
 	}
 
+	if lb.mode == LeakyQueue {
+		return lb.waitQueued(ctx, n)
+	}
+
 	// Fast path: try to add requests immediately
 	now := lb.cfg.clock.Now()
 	if lb.AllowN(now, n) {
@@ -97,67 +196,163 @@ func (lb *LeakyBucket) WaitN(ctx context.Context, n int) error {
 	return lb.waitSlow(ctx, n, now)
 }
 
-// waitSlow handles the blocking wait for bucket space.
+// waitSlow queues the request and blocks until the queue grants it.
 func (lb *LeakyBucket) waitSlow(ctx context.Context, n int, now time.Time) error {
+	obs := lb.cfg.obs.WithContext(ctx)
+
 	lb.mu.Lock()
 	lb.leakLocked(now)
 
 	if n > lb.capacity {
 		lb.mu.Unlock()
-		return fmt.Errorf("ratelimit: requested %d requests exceeds bucket capacity %d", n, lb.capacity)
+		return NewBurstExceededError(lb.cfg.name, n, lb.capacity)
 	}
 
-	needed := lb.level + float64(n) - float64(lb.capacity)
-	var waitDuration time.Duration
-	if needed > 0 && lb.rate.TokensPerSec > 0 {
-		waitDuration = time.Duration(needed / lb.rate.TokensPerSec * float64(time.Second))
-	} else if lb.rate.TokensPerSec <= 0 {
-		// Rate is zero, bucket never leaks
+	w := lb.waiters.push(n)
+	lb.waiters.dispatchLocked()
+	queued := lb.waiters.len()
+	lb.mu.Unlock()
+
+	obs.Logger.Debug("leaky bucket waiting",
+		"limiter_name", lb.cfg.name,
+		"requested", n,
+		"queued", queued,
+	)
+
+	start := lb.cfg.clock.Now()
+
+	select {
+	case <-ctx.Done():
+		lb.mu.Lock()
+		if !lb.waiters.remove(w) && w.err == nil {
+			// Admitted as ctx was canceled; make room for the next waiter
+			lb.level = math.Max(0, lb.level-float64(n))
+		}
+		lb.waiters.dispatchLocked()
 		lb.mu.Unlock()
-		<-ctx.Done()
+
+		lb.results.record(obs.Metrics, lb.cfg.name, "canceled")
 		return ctx.Err()
-	}
 
-	if lb.cfg.jitter > 0 && waitDuration > 0 {
-		jitter := rand.Float64() * lb.cfg.jitter * waitDuration.Seconds()
-		waitDuration += time.Duration(jitter * float64(time.Second))
+	case <-w.ready:
+		if w.err != nil {
+			return w.err
+		}
+		obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
+			lb.cfg.clock.Since(start).Seconds(), "limiter_name", lb.cfg.name)
+		return nil
 	}
+}
 
-	lb.mu.Unlock()
+// takeLocked admits n requests for a queued waiter. See takeFunc.
+// Must be called with lb.mu held.
+func (lb *LeakyBucket) takeLocked(n int) (time.Duration, error) {
+	lb.leakLocked(lb.cfg.clock.Now())
+
+	if lb.level+float64(n) <= float64(lb.capacity) {
+		lb.level += float64(n)
+		lb.results.record(lb.cfg.obs.Metrics, lb.cfg.name, "allowed")
+		lb.cfg.obs.Metrics.Gauge("ion_ratelimit_bucket_level",
+			lb.level, "limiter_name", lb.cfg.name)
+		return 0, nil
+	}
 
-	if waitDuration <= 0 {
-		return lb.WaitN(ctx, n)
+	if lb.rate.TokensPerSec <= 0 {
+		return -1, nil
 	}
+	return lb.leakDuration(lb.level + float64(n) - float64(lb.capacity)), nil
+}
 
-	lb.cfg.obs.Logger.Debug("leaky bucket waiting",
-		"limiter_name", lb.cfg.name,
-		"requested", n,
-		"wait_duration", waitDuration,
-	)
+// waitQueued joins the queue once it has room for n requests and blocks
+// until everything queued ahead has drained. Jitter is not applied, as it
+// would break the exact spacing the queue provides.
+func (lb *LeakyBucket) waitQueued(ctx context.Context, n int) error {
+	obs := lb.cfg.obs.WithContext(ctx)
+
+	if capacity := lb.Capacity(); n > capacity {
+		return NewBurstExceededError(lb.cfg.name, n, capacity)
+	}
 
 	start := lb.cfg.clock.Now()
+	for {
+		lb.mu.Lock()
+		lb.leakLocked(lb.cfg.clock.Now())
+		ahead := lb.level
+		if ahead < leakEpsilon {
+			ahead = 0
+		}
+
+		if ahead > 0 && lb.rate.TokensPerSec <= 0 {
+			// Rate is zero, the queue never drains
+			lb.mu.Unlock()
+			<-ctx.Done()
+			lb.results.record(obs.Metrics, lb.cfg.name, "canceled")
+			return ctx.Err()
+		}
+
+		if ahead+float64(n) > float64(lb.capacity) {
+			// Queue is full, wait until there is room for n requests
+			wait := lb.leakDuration(ahead + float64(n) - float64(lb.capacity))
+			lb.mu.Unlock()
+
+			if err := lb.sleep(ctx, wait); err != nil {
+				lb.results.record(obs.Metrics, lb.cfg.name, "canceled")
+				return err
+			}
+			continue
+		}
+
+		lb.level += float64(n)
+		obs.Metrics.Gauge("ion_ratelimit_bucket_level",
+			lb.level, "limiter_name", lb.cfg.name)
+		var wait time.Duration
+		if ahead > 0 {
+			wait = lb.leakDuration(ahead)
+		}
+		lb.mu.Unlock()
 
-	timer := lb.cfg.clock.AfterFunc(waitDuration, func() {})
+		if wait > 0 {
+			obs.Logger.Debug("leaky bucket queued",
+				"limiter_name", lb.cfg.name,
+				"requested", n,
+				"wait_duration", wait,
+			)
+
+			if err := lb.sleep(ctx, wait); err != nil {
+				// Give up our place; everything ahead of us is still queued
+				lb.mu.Lock()
+				lb.leakLocked(lb.cfg.clock.Now())
+				lb.level = math.Max(0, lb.level-float64(n))
+				lb.mu.Unlock()
+
+				lb.results.record(obs.Metrics, lb.cfg.name, "canceled")
+				return err
+			}
+		}
+
+		lb.results.record(obs.Metrics, lb.cfg.name, "allowed")
+		obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
+			lb.cfg.clock.Since(start).Seconds(), "limiter_name", lb.cfg.name)
+		return nil
+	}
+}
+
+// leakDuration returns how long the bucket takes to leak amount, rounded up
+// so that the amount has fully leaked when it elapses.
+func (lb *LeakyBucket) leakDuration(amount float64) time.Duration {
+	return time.Duration(math.Ceil(amount / lb.rate.TokensPerSec * float64(time.Second)))
+}
+
+// sleep waits for d on the bucket's clock or until ctx is done.
+func (lb *LeakyBucket) sleep(ctx context.Context, d time.Duration) error {
+	timer := lb.cfg.clock.NewTimer(d)
 	defer timer.Stop()
 
 	select {
 	case <-ctx.Done():
-		lb.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
-			"limiter_name", lb.cfg.name, "result", "canceled")
 		return ctx.Err()
-
-	case <-time.After(waitDuration):
-		// Try to add requests again
-		now = lb.cfg.clock.Now()
-		if lb.AllowN(now, n) {
-			duration := lb.cfg.clock.Now().Sub(start)
-			lb.cfg.obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
-				duration.Seconds(), "limiter_name", lb.cfg.name)
-			return nil
-		}
-
-		// Shouldn't happen with correct implementation, but handle gracefully
-		return fmt.Errorf("ratelimit: bucket space not available after wait")
+	case <-timer.C():
+		return nil
 	}
 }
 
@@ -187,6 +382,29 @@ func (lb *LeakyBucket) leakLocked(now time.Time) {
 		lb.level, "limiter_name", lb.cfg.name)
 }
 
+// ReturnN credits the bucket with n requests admitted by AllowN or WaitN for
+// an operation that failed before consuming the guarded resource, lowering
+// the level as if they had already leaked out. The level never drops below
+// empty.
+func (lb *LeakyBucket) ReturnN(n int) {
+	if n <= 0 {
+		return
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.leakLocked(lb.cfg.clock.Now())
+	lb.level = math.Max(0, lb.level-float64(n))
+
+	lb.cfg.obs.Metrics.Add("ion_ratelimit_tokens_returned_total",
+		float64(n), "limiter_name", lb.cfg.name)
+	lb.cfg.obs.Metrics.Gauge("ion_ratelimit_bucket_level",
+		lb.level, "limiter_name", lb.cfg.name)
+
+	lb.waiters.dispatchLocked()
+}
+
 // Level returns the current level of the bucket.
 func (lb *LeakyBucket) Level() float64 {
 	lb.mu.Lock()
@@ -198,11 +416,20 @@ func (lb *LeakyBucket) Level() float64 {
 
 // Rate returns the current leak rate.
 func (lb *LeakyBucket) Rate() Rate {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
 	return lb.rate
 }
 
+// Mode returns the admission mode of the bucket.
+func (lb *LeakyBucket) Mode() LeakyMode {
+	return lb.mode
+}
+
 // Capacity returns the bucket capacity.
 func (lb *LeakyBucket) Capacity() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
 	return lb.capacity
 }
 
@@ -214,3 +441,152 @@ func (lb *LeakyBucket) Available() int {
 	lb.leakLocked(lb.cfg.clock.Now())
 	return int(math.Max(0, float64(lb.capacity)-lb.level))
 }
+
+// SetRate updates the leak rate dynamically. In LeakyQueue mode, callers
+// already queued keep the drain time computed when they joined.
+func (lb *LeakyBucket) SetRate(rate Rate) {
+	if rate.TokensPerSec < 0 {
+		return
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.leakLocked(lb.cfg.clock.Now())
+	lb.rate = rate
+
+	lb.cfg.obs.Logger.Debug("rate updated",
+		"limiter_name", lb.cfg.name,
+		"new_rate", rate.String(),
+	)
+
+	lb.waiters.dispatchLocked()
+}
+
+// SetCapacity updates the bucket capacity dynamically. If the bucket holds
+// more than the new capacity, nothing is admitted until it has leaked below
+// it.
+func (lb *LeakyBucket) SetCapacity(capacity int) {
+	if capacity <= 0 {
+		return
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.capacity = capacity
+
+	lb.cfg.obs.Logger.Debug("capacity updated",
+		"limiter_name", lb.cfg.name,
+		"new_capacity", capacity,
+	)
+
+	lb.waiters.dispatchLocked()
+}
+
+// SetBurst updates the bucket capacity dynamically, as SetCapacity does.
+func (lb *LeakyBucket) SetBurst(burst int) {
+	lb.SetCapacity(burst)
+}
+
+// DrainTo sets the bucket level, the number of requests it holds, to a
+// specific value between empty and capacity. This is useful for syncing with
+// external rate limit state.
+func (lb *LeakyBucket) DrainTo(level int) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if level < 0 {
+		level = 0
+	}
+	if level > lb.capacity {
+		level = lb.capacity
+	}
+
+	lb.level = float64(level)
+	lb.lastLeak = lb.cfg.clock.Now()
+	lb.initialized = true
+
+	lb.cfg.obs.Logger.Debug("level drained to",
+		"limiter_name", lb.cfg.name,
+		"level", level,
+	)
+	lb.cfg.obs.Metrics.Gauge("ion_ratelimit_bucket_level",
+		lb.level, "limiter_name", lb.cfg.name)
+
+	lb.waiters.dispatchLocked()
+}
+
+// SetTemporaryLimit applies a temporary leak rate and capacity that revert
+// after duration, for example to slow processing down during an incident.
+func (lb *LeakyBucket) SetTemporaryLimit(rate Rate, capacity int, duration time.Duration) {
+	if capacity <= 0 || duration <= 0 || rate.TokensPerSec < 0 {
+		return
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if lb.tempLimit != nil && lb.tempLimit.timer != nil {
+		lb.tempLimit.timer.Stop()
+	}
+
+	if lb.tempLimit == nil {
+		lb.tempLimit = &temporaryLimit{
+			originalRate:  lb.rate,
+			originalBurst: lb.capacity,
+		}
+	}
+
+	lb.leakLocked(lb.cfg.clock.Now())
+	lb.rate = rate
+	lb.capacity = capacity
+
+	lb.cfg.obs.Logger.Info("temporary limit applied",
+		"limiter_name", lb.cfg.name,
+		"temp_rate", rate.String(),
+		"temp_capacity", capacity,
+		"duration", duration,
+	)
+
+	lb.tempLimit.timer = lb.cfg.clock.AfterFunc(duration, func() {
+		lb.revertTemporaryLimit()
+	})
+
+	lb.waiters.dispatchLocked()
+}
+
+// revertTemporaryLimit restores the original rate and capacity.
+func (lb *LeakyBucket) revertTemporaryLimit() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if lb.tempLimit == nil {
+		return
+	}
+
+	lb.leakLocked(lb.cfg.clock.Now())
+	lb.rate = lb.tempLimit.originalRate
+	lb.capacity = lb.tempLimit.originalBurst
+	lb.tempLimit = nil
+
+	lb.cfg.obs.Logger.Info("temporary limit reverted",
+		"limiter_name", lb.cfg.name,
+		"rate", lb.rate.String(),
+		"capacity", lb.capacity,
+	)
+
+	lb.waiters.dispatchLocked()
+}
+
+// ClearTemporaryLimit cancels any active temporary limit and restores original values.
+func (lb *LeakyBucket) ClearTemporaryLimit() {
+	lb.mu.Lock()
+
+	if lb.tempLimit != nil && lb.tempLimit.timer != nil {
+		lb.tempLimit.timer.Stop()
+	}
+	lb.mu.Unlock()
+
+	lb.revertTemporaryLimit()
+}
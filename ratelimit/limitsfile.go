@@ -0,0 +1,366 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// LimitsFile declares the limits of a MultiTierLimiter, for keeping dozens
+// of route patterns in a file rather than in Go literals. Limits left out
+// keep the values of DefaultMultiTierConfig.
+//
+// The struct carries JSON and YAML tags. LoadConfig reads JSON, where
+// durations are strings such as "1m" or numbers of nanoseconds; to read
+// YAML, decode into a LimitsFile with a YAML library such as
+// gopkg.in/yaml.v3 and call MultiTierConfig.
+//
+// Usage:
+//
+//	{
+//	  "global": {"rate": 100, "burst": 100},
+//	  "route": {"rate": 50, "burst": 50},
+//	  "routes": {
+//	    "GET:/api/v1/search": {"rate": 5, "burst": 5},
+//	    "POST:/orgs/{id}/jobs": {"rate": 1, "per": "1m", "burst": 2, "major_parameters": ["org_id"]}
+//	  },
+//	  "resources": {"org:": {"rate": 200, "burst": 200}},
+//	  "users": {"premium-7": {"rate": 100, "burst": 100}}
+//	}
+type LimitsFile struct {
+	// Global is the limit shared by all requests
+	Global *LimitSpec `json:"global,omitempty" yaml:"global,omitempty"`
+
+	// Route and Resource are the limits of routes and resources that match
+	// no pattern
+	Route    *LimitSpec `json:"route,omitempty" yaml:"route,omitempty"`
+	Resource *LimitSpec `json:"resource,omitempty" yaml:"resource,omitempty"`
+
+	// Routes, Resources and Users are MultiTierConfig.RoutePatterns,
+	// MultiTierConfig.ResourcePatterns and MultiTierConfig.UserOverrides
+	Routes    map[string]RouteSpec `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Resources map[string]LimitSpec `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Users     map[string]LimitSpec `json:"users,omitempty" yaml:"users,omitempty"`
+}
+
+// LimitSpec is one limit in a LimitsFile.
+type LimitSpec struct {
+	// Rate is the number of tokens added every Per
+	Rate float64 `json:"rate" yaml:"rate"`
+
+	// Per is the period Rate is measured over. Default: 1 second
+	Per time.Duration `json:"per,omitempty" yaml:"per,omitempty"`
+
+	// Burst is the bucket capacity. It must be positive
+	Burst int `json:"burst" yaml:"burst"`
+}
+
+// UnmarshalJSON decodes a limit whose per is a duration string such as
+// "1m" or a number of nanoseconds. Unknown fields are rejected.
+func (s *LimitSpec) UnmarshalJSON(data []byte) error {
+	var spec struct {
+		Rate  float64      `json:"rate"`
+		Per   jsonDuration `json:"per"`
+		Burst int          `json:"burst"`
+	}
+	if err := decodeStrict(data, &spec); err != nil {
+		return err
+	}
+
+	*s = LimitSpec{Rate: spec.Rate, Per: time.Duration(spec.Per), Burst: spec.Burst}
+	return nil
+}
+
+// RouteSpec is a route pattern in a LimitsFile.
+type RouteSpec struct {
+	LimitSpec `yaml:",inline"`
+
+	// MajorParameters are the request parameters that get their own bucket
+	MajorParameters []string `json:"major_parameters,omitempty" yaml:"major_parameters,omitempty"`
+}
+
+// UnmarshalJSON decodes a route pattern like LimitSpec.UnmarshalJSON, which
+// it would otherwise inherit and which knows nothing of major_parameters.
+func (s *RouteSpec) UnmarshalJSON(data []byte) error {
+	var spec struct {
+		Rate            float64      `json:"rate"`
+		Per             jsonDuration `json:"per"`
+		Burst           int          `json:"burst"`
+		MajorParameters []string     `json:"major_parameters"`
+	}
+	if err := decodeStrict(data, &spec); err != nil {
+		return err
+	}
+
+	*s = RouteSpec{
+		LimitSpec:       LimitSpec{Rate: spec.Rate, Per: time.Duration(spec.Per), Burst: spec.Burst},
+		MajorParameters: spec.MajorParameters,
+	}
+	return nil
+}
+
+// jsonDuration is a time.Duration read from a JSON duration string or
+// number of nanoseconds.
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		parsed, err := time.ParseDuration(str)
+		if err != nil {
+			return fmt.Errorf("per: %w", err)
+		}
+		*d = jsonDuration(parsed)
+		return nil
+	}
+
+	var ns int64
+	if err := json.Unmarshal(data, &ns); err != nil {
+		return fmt.Errorf("per must be a duration string such as \"1m\" or a number of nanoseconds, got %s", data)
+	}
+	*d = jsonDuration(ns)
+	return nil
+}
+
+// decodeStrict decodes data into v, rejecting unknown fields, which the
+// decoder of LoadConfig does not check inside custom unmarshalers.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// LoadConfig reads a JSON LimitsFile from r and returns the MultiTierConfig
+// it describes. Unknown fields are rejected, so typos do not silently fall
+// back to defaults.
+func LoadConfig(r io.Reader) (*MultiTierConfig, error) {
+	f, err := decodeLimitsFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return f.MultiTierConfig(), nil
+}
+
+// decodeLimitsFile reads and validates a JSON LimitsFile.
+func decodeLimitsFile(r io.Reader) (*LimitsFile, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var f LimitsFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("ratelimit: parse config: %w", err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("ratelimit: invalid config: %w", err)
+	}
+	return &f, nil
+}
+
+// Validate checks every limit and returns the errors of all invalid ones,
+// each prefixed with its section and key.
+func (f *LimitsFile) Validate() error {
+	var errs []error
+	check := func(name string, spec *LimitSpec) {
+		if spec == nil {
+			return
+		}
+		if err := spec.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	check("global", f.Global)
+	check("route", f.Route)
+	check("resource", f.Resource)
+	for _, pattern := range sortedKeys(f.Routes) {
+		spec := f.Routes[pattern].LimitSpec
+		check("routes."+pattern, &spec)
+	}
+	for _, pattern := range sortedKeys(f.Resources) {
+		spec := f.Resources[pattern]
+		check("resources."+pattern, &spec)
+	}
+	for _, userID := range sortedKeys(f.Users) {
+		spec := f.Users[userID]
+		check("users."+userID, &spec)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks if the limit is valid and returns an error if not.
+func (s *LimitSpec) Validate() error {
+	if s.Rate < 0 {
+		return fmt.Errorf("rate cannot be negative, got %v", s.Rate)
+	}
+	if s.Per < 0 {
+		return fmt.Errorf("per cannot be negative, got %v", s.Per)
+	}
+	if s.Burst <= 0 {
+		return fmt.Errorf("burst must be positive, got %d", s.Burst)
+	}
+	return nil
+}
+
+// rate returns the configured rate.
+func (s *LimitSpec) rate() Rate {
+	per := s.Per
+	if per == 0 {
+		per = time.Second
+	}
+	return Rate{TokensPerSec: s.Rate / per.Seconds()}
+}
+
+// MultiTierConfig returns DefaultMultiTierConfig with the limits of f.
+// It does not validate f.
+func (f *LimitsFile) MultiTierConfig() *MultiTierConfig {
+	config := DefaultMultiTierConfig()
+	if f.Global != nil {
+		config.GlobalRate, config.GlobalBurst = f.Global.rate(), f.Global.Burst
+	}
+	if f.Route != nil {
+		config.DefaultRouteRate, config.DefaultRouteBurst = f.Route.rate(), f.Route.Burst
+	}
+	if f.Resource != nil {
+		config.DefaultResourceRate, config.DefaultResourceBurst = f.Resource.rate(), f.Resource.Burst
+	}
+	config.RoutePatterns = f.routePatterns()
+	config.ResourcePatterns = f.resourcePatterns()
+	config.UserOverrides = f.userOverrides()
+	return config
+}
+
+func (f *LimitsFile) routePatterns() map[string]RouteConfig {
+	patterns := make(map[string]RouteConfig, len(f.Routes))
+	for pattern, spec := range f.Routes {
+		patterns[pattern] = RouteConfig{
+			Rate:            spec.rate(),
+			Burst:           spec.Burst,
+			MajorParameters: spec.MajorParameters,
+		}
+	}
+	return patterns
+}
+
+func (f *LimitsFile) resourcePatterns() map[string]ResourceConfig {
+	return resourceConfigs(f.Resources)
+}
+
+func (f *LimitsFile) userOverrides() map[string]ResourceConfig {
+	return resourceConfigs(f.Users)
+}
+
+func resourceConfigs(specs map[string]LimitSpec) map[string]ResourceConfig {
+	configs := make(map[string]ResourceConfig, len(specs))
+	for key, spec := range specs {
+		configs[key] = ResourceConfig{Rate: spec.rate(), Burst: spec.Burst}
+	}
+	return configs
+}
+
+// WatchConfig reloads the route and resource patterns and user overrides
+// of the limiter from the JSON LimitsFile at path whenever the file
+// changes, checking every interval on the limiter's clock, until ctx is
+// done. Existing route and resource limiters pick up their new limits in
+// place. The global and
+// default limits are not reloaded. A file that fails to parse is logged
+// and skipped, keeping the current patterns; only a failure to read it
+// initially, or an interval that is not positive, is returned. It returns
+// ctx.Err() once ctx is done.
+func (mtl *MultiTierLimiter) WatchConfig(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("ratelimit: watch config: interval must be positive, got %v", interval)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("ratelimit: watch config: %w", err)
+	}
+	if err := mtl.reloadConfig(path); err != nil {
+		return err
+	}
+
+	ticker := mtl.cfg.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+
+		next, err := os.Stat(path)
+		if err != nil {
+			mtl.cfg.obs.WithContext(ctx).Logger.Warn("rate limit config unreadable",
+				"limiter_name", mtl.cfg.name,
+				"path", path,
+				"error", err,
+			)
+			continue
+		}
+		if next.ModTime().Equal(stat.ModTime()) && next.Size() == stat.Size() {
+			continue
+		}
+		stat = next
+
+		if err := mtl.reloadConfig(path); err != nil {
+			mtl.cfg.obs.WithContext(ctx).Logger.Warn("rate limit config not reloaded",
+				"limiter_name", mtl.cfg.name,
+				"path", path,
+				"error", err,
+			)
+		}
+	}
+}
+
+// reloadConfig replaces the route and resource patterns and user overrides
+// with those of the file at path.
+func (mtl *MultiTierLimiter) reloadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("ratelimit: watch config: %w", err)
+	}
+	f, err := decodeLimitsFile(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	mtl.mu.Lock()
+	mtl.routePatterns = f.routePatterns()
+	mtl.routeMatcher = compileRoutes(mtl.routePatterns)
+	mtl.resourcePatterns = f.resourcePatterns()
+	mtl.userOverrides = f.userOverrides()
+	mtl.mu.Unlock()
+
+	mtl.cfg.obs.Logger.Info("rate limit config reloaded",
+		"limiter_name", mtl.cfg.name,
+		"path", path,
+		"routes", len(f.Routes),
+		"resources", len(f.Resources),
+		"users", len(f.Users),
+	)
+
+	mtl.reconfigureRoutes()
+	mtl.reconfigureResources()
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, for deterministic errors.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// maxThrottleKeys bounds the number of message keys a ThrottledLogger tracks.
+// Idle keys are evicted once the bound is reached.
+const maxThrottleKeys = 1024
+
+// ThrottledLogger wraps a logger and rate-limits log emission per message key,
+// so a misbehaving dependency cannot flood the logs with the same warning.
+// A key is the log message plus the values of the fields selected with
+// WithThrottleKeys. Each key gets its own token bucket; messages that find
+// their bucket empty are dropped and counted, and the next message emitted
+// for the key carries the number dropped in a "suppressed" field.
+//
+// Usage:
+//
+//	logger := ratelimit.NewThrottledLogger(base, ratelimit.Per(1, 10*time.Second), 1,
+//		ratelimit.WithThrottleKeys("name"),
+//	)
+//	logger.Warn("circuit open", "name", "payments") // at most once per 10s per breaker
+type ThrottledLogger struct {
+	logger observe.Logger
+	rate   Rate
+	burst  int
+	cfg    *config
+
+	mu   sync.Mutex
+	keys map[string]*throttleEntry
+}
+
+type throttleEntry struct {
+	bucket     *TokenBucket
+	suppressed int
+}
+
+// NewThrottledLogger creates a logger that emits at most burst messages per
+// key at once and rate messages per key over time through logger. Only the
+// WithClock and WithThrottleKeys options apply.
+func NewThrottledLogger(logger observe.Logger, rate Rate, burst int, opts ...Option) *ThrottledLogger {
+	if burst <= 0 {
+		panic("ratelimit: burst must be positive")
+	}
+	if logger == nil {
+		logger = observe.NopLogger{}
+	}
+
+	return &ThrottledLogger{
+		logger: logger,
+		rate:   rate,
+		burst:  burst,
+		cfg:    newConfig(opts...),
+		keys:   make(map[string]*throttleEntry),
+	}
+}
+
+// Debug logs at debug level if the message key is within its rate.
+func (l *ThrottledLogger) Debug(msg string, kv ...any) {
+	if kv, ok := l.allow(msg, kv); ok {
+		l.logger.Debug(msg, kv...)
+	}
+}
+
+// Info logs at info level if the message key is within its rate.
+func (l *ThrottledLogger) Info(msg string, kv ...any) {
+	if kv, ok := l.allow(msg, kv); ok {
+		l.logger.Info(msg, kv...)
+	}
+}
+
+// Warn logs at warn level if the message key is within its rate.
+func (l *ThrottledLogger) Warn(msg string, kv ...any) {
+	if kv, ok := l.allow(msg, kv); ok {
+		l.logger.Warn(msg, kv...)
+	}
+}
+
+// Error logs at error level if the message key is within its rate.
+func (l *ThrottledLogger) Error(msg string, err error, kv ...any) {
+	if kv, ok := l.allow(msg, kv); ok {
+		l.logger.Error(msg, err, kv...)
+	}
+}
+
+// Suppressed returns the number of messages dropped for the key of msg and
+// kv since one was last emitted.
+func (l *ThrottledLogger) Suppressed(msg string, kv ...any) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.keys[l.key(msg, kv)]; ok {
+		return e.suppressed
+	}
+	return 0
+}
+
+// allow reports whether a message may be emitted and returns its fields,
+// extended with the count of messages suppressed before it.
+func (l *ThrottledLogger) allow(msg string, kv []any) ([]any, bool) {
+	key := l.key(msg, kv)
+	now := l.cfg.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.keys[key]
+	if !ok {
+		if len(l.keys) >= maxThrottleKeys {
+			l.evictIdleLocked(now)
+		}
+		e = &throttleEntry{
+			bucket: NewTokenBucket(l.rate, l.burst, WithClock(l.cfg.clock)),
+		}
+		l.keys[key] = e
+	}
+
+	if !e.bucket.AllowN(now, 1) {
+		e.suppressed++
+		return nil, false
+	}
+
+	if e.suppressed > 0 {
+		kv = append(kv[:len(kv):len(kv)], "suppressed", e.suppressed)
+		e.suppressed = 0
+	}
+	return kv, true
+}
+
+// evictIdleLocked removes keys whose bucket has refilled and that have no
+// suppressed messages to report, as they behave exactly like new keys.
+func (l *ThrottledLogger) evictIdleLocked(now time.Time) {
+	for key, e := range l.keys {
+		if e.suppressed > 0 {
+			continue
+		}
+		e.bucket.mu.Lock()
+		e.bucket.refillLocked(now)
+		full := e.bucket.tokens >= float64(e.bucket.burst)
+		e.bucket.mu.Unlock()
+		if full {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// key builds the throttle key of a message from the message and the values
+// of the configured key fields.
+func (l *ThrottledLogger) key(msg string, kv []any) string {
+	if len(l.cfg.throttleKeys) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, field := range l.cfg.throttleKeys {
+		b.WriteByte(0)
+		for i := 0; i+1 < len(kv); i += 2 {
+			if kv[i] == field {
+				fmt.Fprint(&b, kv[i+1])
+				break
+			}
+		}
+	}
+	return b.String()
+}
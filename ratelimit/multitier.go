@@ -2,12 +2,13 @@ package ratelimit
 
 import (
 	"context"
-	"crypto/md5"
 	"fmt"
+	"hash/fnv"
+	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,13 +22,19 @@ type MultiTierLimiter struct {
 	global Limiter
 
 	// Route limiters for specific API endpoints
-	routes sync.Map // map[string]Limiter
+	routes sync.Map // map[string]*bucketEntry
 
 	// Resource limiters for specific resources (organizations, projects, etc.)
-	resources sync.Map // map[string]Limiter
+	resources sync.Map // map[string]*bucketEntry
 
-	// Bucket mapping for API-style rate limit buckets
-	bucketMap sync.Map // map[string]string
+	// Idle bucket eviction, see sweepBuckets
+	sweepMu   sync.Mutex
+	nextSweep time.Time
+
+	// Bucket mapping for API-style rate limit buckets: routes reported to
+	// share an upstream bucket share one limiter, stored in routes under
+	// bucketKey(bucket)
+	bucketMap sync.Map // map[string]string, route key to bucket
 
 	// Configuration
 	config *MultiTierConfig
@@ -35,10 +42,23 @@ type MultiTierLimiter struct {
 
 	// Metrics and observability
 	metrics *MultiTierMetrics
-
-	// Pause state
-	pausedUntil time.Time
-	pauseTimer  Timer
+	hitLog  *ThrottledLogger // rate limit hit warnings, throttled per endpoint
+
+	// Pause state. pauseChanged is closed and replaced whenever the pause
+	// changes, waking callers in waitForPause.
+	pausedUntil  time.Time
+	pauseTimer   Timer
+	pauseChanged chan struct{}
+
+	// Blocked WaitN callers, ordered by priority for the global tier
+	gate *priorityGate
+
+	// Route and resource patterns, guarded by mu so they can change at
+	// runtime
+	routePatterns    map[string]RouteConfig
+	routeMatcher     routeMatcher // compiled routePatterns
+	resourcePatterns map[string]ResourceConfig
+	userOverrides    map[string]ResourceConfig
 }
 
 // MultiTierConfig holds configuration for multi-tier rate limiting.
@@ -53,16 +73,103 @@ type MultiTierConfig struct {
 	DefaultResourceRate  Rate
 	DefaultResourceBurst int
 
-	// Queue configuration for request management
-	QueueSize        int
+	// Queue configuration for request management. QueueSize bounds how
+	// many WaitN callers may queue for the global tier; more are rejected.
+	// Zero means unbounded.
+	QueueSize int
+	// EnablePreemptive takes tokens from all tiers at once, only when every
+	// tier can grant them, instead of from each tier in turn. A request
+	// denied by its route or resource tier then leaves the global tier's
+	// tokens for others.
 	EnablePreemptive bool
 
-	// Bucket management
+	// PriorityAging raises the priority of a queued WaitN caller by one
+	// level for every interval it has waited, so low priority requests are
+	// eventually served under sustained high priority load. Zero disables
+	// aging.
+	PriorityAging time.Duration
+
+	// Bucket management. Route and resource limiters unused for BucketTTL
+	// are evicted once they have refilled, so memory does not grow with
+	// every route and resource ever seen. Zero keeps them forever.
 	EnableBucketMapping bool
 	BucketTTL           time.Duration
 
-	// Route pattern matching
+	// CostFunc returns the tokens a request takes from each tier in Allow
+	// and Wait, so that expensive endpoints or large payloads count for
+	// more. Costs below one count as one. Nil means every request costs
+	// one. AllowN and WaitN take the tokens they are given.
+	CostFunc CostFunc
+
+	// RouteKeyFunc returns the key of a request's route limiter; requests
+	// with the same key share one. Nil means DefaultRouteKey.
+	RouteKeyFunc RouteKeyFunc
+
+	// HeaderScheme parses the rate limit headers of the upstream API for
+	// UpdateRateLimitFromHeaders and UpdateFromResponse. Nil means
+	// XRateLimitHeaders.
+	HeaderScheme HeaderScheme
+
+	// OnPauseChange is called whenever the limiter is paused, its pause is
+	// changed, or it resumes, with paused false and a zero until. It is
+	// called without locks held, so it may call the limiter.
+	OnPauseChange func(paused bool, until time.Time)
+
+	// Route pattern matching. Keys are a method, a colon and a path, such
+	// as "GET:/orgs/{org}/repos/{repo}"; the method "*" matches any. In
+	// the path, "{name}" and "*" match any one segment and a trailing "**"
+	// any number of segments. When several patterns match, the most
+	// specific wins: segments are compared from the left, a literal
+	// beating a parameter and a parameter beating "**". All requests
+	// matching a pattern share its route limiter, split by the pattern's
+	// major parameters. Other requests get a limiter per endpoint, with
+	// digit runs replaced by {id}.
 	RoutePatterns map[string]RouteConfig
+
+	// Resource pattern matching. Keys are matched against the resource
+	// identifier ("org:42") and against the resource key the limiter derives
+	// from the request ("user:7" for a UserID): an exact match wins, then the
+	// longest matching prefix, so "org:" configures a whole resource class.
+	ResourcePatterns map[string]ResourceConfig
+
+	// UserOverrides gives users, by UserID, their own resource tier limits
+	// in place of the default resource rate and resource patterns, so
+	// premium users can be allowed more than the default. Requests of a
+	// user with an override are counted in the user's resource bucket even
+	// when they name a ResourceID or SubResourceID.
+	UserOverrides map[string]ResourceConfig
+
+	// Interval metrics. Counters are also kept per MetricsInterval (default
+	// one minute) for the last MetricsHistory intervals (default 60).
+	MetricsInterval time.Duration
+	MetricsHistory  int
+}
+
+// CostFunc returns the number of tokens a request costs.
+type CostFunc func(req *Request) int
+
+// RouteKeyFunc returns the key of the route limiter of a request, given
+// its route: the route pattern it matches, or its normalized endpoint if
+// it matches none.
+type RouteKeyFunc func(route string, req *Request) string
+
+// DefaultRouteKey is the default RouteKeyFunc. It appends to the route an
+// FNV-1a hash of the request's major parameters, sorted by name, so that
+// requests with the same route and parameters always share a limiter.
+func DefaultRouteKey(route string, req *Request) string {
+	if len(req.MajorParameters) == 0 {
+		return route
+	}
+
+	h := fnv.New64a()
+	for _, key := range sortedKeys(req.MajorParameters) {
+		// Separators keep {"a": "bc"} and {"ab": "c"} apart
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(req.MajorParameters[key]))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s_%016x", route, h.Sum64())
 }
 
 // RouteConfig defines rate limiting for specific route patterns.
@@ -73,6 +180,12 @@ type RouteConfig struct {
 	MajorParameters []string
 }
 
+// ResourceConfig defines rate limiting for specific resource patterns.
+type ResourceConfig struct {
+	Rate  Rate
+	Burst int
+}
+
 // MultiTierMetrics tracks metrics for multi-tier rate limiting.
 type MultiTierMetrics struct {
 	mu sync.RWMutex
@@ -86,6 +199,81 @@ type MultiTierMetrics struct {
 	AvgWaitTime       time.Duration
 	MaxWaitTime       time.Duration
 	BucketsActive     int64
+	BucketsEvicted    int64
+
+	// Intervals holds the counters per metrics interval, oldest first. The
+	// last entry is the current, still open interval. Intervals without
+	// traffic are included with zero counts.
+	Intervals []IntervalMetrics
+
+	interval time.Duration
+	history  int
+}
+
+// IntervalMetrics holds the multi-tier counters for one metrics interval.
+type IntervalMetrics struct {
+	Start time.Time
+	End   time.Time
+
+	Requests          int64
+	GlobalLimitHits   int64
+	RouteLimitHits    int64
+	ResourceLimitHits int64
+	DroppedRequests   int64
+}
+
+// RequestsPerSecond returns the average rate of allowed requests over the
+// interval.
+func (im IntervalMetrics) RequestsPerSecond() float64 {
+	if d := im.End.Sub(im.Start).Seconds(); d > 0 {
+		return float64(im.Requests) / d
+	}
+	return 0
+}
+
+// LimitHits returns the number of requests limited by any tier.
+func (im IntervalMetrics) LimitHits() int64 {
+	return im.GlobalLimitHits + im.RouteLimitHits + im.ResourceLimitHits
+}
+
+// totals returns the lifetime counters in interval form.
+func (m *MultiTierMetrics) totals() IntervalMetrics {
+	return IntervalMetrics{
+		Requests:          m.TotalRequests,
+		GlobalLimitHits:   m.GlobalLimitHits,
+		RouteLimitHits:    m.RouteLimitHits,
+		ResourceLimitHits: m.ResourceLimitHits,
+		DroppedRequests:   m.DroppedRequests,
+	}
+}
+
+// currentInterval returns the interval containing now, opening it and any
+// empty intervals before it as needed. Must be called with m.mu held.
+func (m *MultiTierMetrics) currentInterval(now time.Time) *IntervalMetrics {
+	start := now.Truncate(m.interval)
+
+	if n := len(m.Intervals); n > 0 {
+		last := m.Intervals[n-1].Start
+		if !start.After(last) {
+			return &m.Intervals[n-1]
+		}
+
+		// Fill the gap with empty intervals, at most a history's worth
+		next := last.Add(m.interval)
+		if oldest := start.Add(-time.Duration(m.history-1) * m.interval); next.Before(oldest) {
+			next = oldest
+		}
+		for ; next.Before(start); next = next.Add(m.interval) {
+			m.Intervals = append(m.Intervals, IntervalMetrics{Start: next, End: next.Add(m.interval)})
+		}
+	}
+
+	m.Intervals = append(m.Intervals, IntervalMetrics{Start: start, End: start.Add(m.interval)})
+	if n := len(m.Intervals); n > m.history {
+		m.Intervals = append(m.Intervals[:0], m.Intervals[n-m.history:]...)
+	}
+
+	return &m.Intervals[len(m.Intervals)-1]
 }
 
 // Request represents a request for rate limiting evaluation.
@@ -102,7 +290,8 @@ type Request struct {
 	// Major parameters for bucket identification
 	MajorParameters map[string]string
 
-	// Request metadata
+	// Request metadata. When WaitN callers queue for the global tier,
+	// higher priorities are served first.
 	Priority int
 	Context  context.Context
 }
@@ -119,9 +308,14 @@ func DefaultMultiTierConfig() *MultiTierConfig {
 		DefaultResourceBurst: 20,
 		QueueSize:            1000,
 		EnablePreemptive:     true,
+		PriorityAging:        time.Second,
 		EnableBucketMapping:  true,
 		BucketTTL:            time.Hour,
 		RoutePatterns:        make(map[string]RouteConfig), // No default patterns
+		ResourcePatterns:     make(map[string]ResourceConfig),
+		UserOverrides:        make(map[string]ResourceConfig),
+		MetricsInterval:      time.Minute,
+		MetricsHistory:       60,
 	}
 }
 
@@ -136,18 +330,46 @@ func NewMultiTierLimiter(config *MultiTierConfig, opts ...Option) *MultiTierLimi
 	globalLimiter := NewTokenBucket(config.GlobalRate, config.GlobalBurst,
 		WithName(cfg.name+"_global"),
 		WithClock(cfg.clock),
-		WithJitter(cfg.jitter),
+		WithJitterStrategy(cfg.jitterFn),
 		WithLogger(cfg.obs.Logger),
 		WithMetrics(cfg.obs.Metrics),
 		WithTracer(cfg.obs.Tracer),
 	)
 
+	metrics := &MultiTierMetrics{
+		interval: config.MetricsInterval,
+		history:  config.MetricsHistory,
+	}
+	if metrics.interval <= 0 {
+		metrics.interval = time.Minute
+	}
+	if metrics.history <= 0 {
+		metrics.history = 60
+	}
+
 	mtl := &MultiTierLimiter{
-		global:  globalLimiter,
-		config:  config,
-		cfg:     cfg,
-		metrics: &MultiTierMetrics{},
+		global:           globalLimiter,
+		config:           config,
+		cfg:              cfg,
+		metrics:          metrics,
+		routePatterns:    make(map[string]RouteConfig, len(config.RoutePatterns)),
+		resourcePatterns: make(map[string]ResourceConfig, len(config.ResourcePatterns)),
+		userOverrides:    make(map[string]ResourceConfig, len(config.UserOverrides)),
+		gate:             &priorityGate{clock: cfg.clock, aging: config.PriorityAging},
+		pauseChanged:     make(chan struct{}),
+	}
+	for pattern, rc := range config.RoutePatterns {
+		mtl.routePatterns[pattern] = rc
 	}
+	mtl.routeMatcher = compileRoutes(mtl.routePatterns)
+	for pattern, rc := range config.ResourcePatterns {
+		mtl.resourcePatterns[pattern] = rc
+	}
+	for userID, rc := range config.UserOverrides {
+		mtl.userOverrides[userID] = rc
+	}
+	mtl.hitLog = NewThrottledLogger(cfg.obs.Logger, Per(1, 10*time.Second), 1,
+		WithClock(cfg.clock), WithThrottleKeys("endpoint"))
 
 	cfg.obs.Logger.Info("multi-tier rate limiter created",
 		"name", cfg.name,
@@ -159,46 +381,30 @@ func NewMultiTierLimiter(config *MultiTierConfig, opts ...Option) *MultiTierLimi
 	return mtl
 }
 
-// Allow checks if a request is allowed without blocking.
+// Allow checks if a request is allowed without blocking. It takes the
+// request's cost, one unless the config sets a CostFunc.
 func (mtl *MultiTierLimiter) Allow(req *Request) bool {
-	return mtl.AllowN(req, 1)
+	return mtl.AllowN(req, mtl.cost(req))
 }
 
-// AllowN checks if n requests are allowed without blocking.
+// AllowN checks if n requests are allowed without blocking. Global tokens
+// are never taken ahead of WaitN callers queued for them, so AllowN fails
+// while any are queued. With EnablePreemptive, acquisition is all or
+// nothing: tokens are reserved on every tier and committed only if all of
+// them allow the request.
 func (mtl *MultiTierLimiter) AllowN(req *Request, n int) bool {
 	now := mtl.cfg.clock.Now()
 
-	if mtl.IsPaused() {
-		mtl.updateMetrics(func(m *MultiTierMetrics) {
-			m.GlobalLimitHits++
-		})
+	if mtl.IsPaused() || mtl.gate.busy() {
+		mtl.recordLimitHit("global")
 		return false
 	}
 
-	if !mtl.global.AllowN(now, n) {
-		mtl.updateMetrics(func(m *MultiTierMetrics) {
-			m.GlobalLimitHits++
-		})
-		return false
-	}
-
-	routeLimiter := mtl.getOrCreateRouteLimiter(req)
-	if !routeLimiter.AllowN(now, n) {
-		mtl.updateMetrics(func(m *MultiTierMetrics) {
-			m.RouteLimitHits++
-		})
+	if denied := mtl.takeTiers(now, mtl.tiers(req), n, mtl.config.EnablePreemptive); denied != "" {
+		mtl.recordLimitHit(denied)
 		return false
 	}
 
-	if resourceLimiter := mtl.getResourceLimiter(req); resourceLimiter != nil {
-		if !resourceLimiter.AllowN(now, n) {
-			mtl.updateMetrics(func(m *MultiTierMetrics) {
-				m.ResourceLimitHits++
-			})
-			return false
-		}
-	}
-
 	mtl.updateMetrics(func(m *MultiTierMetrics) {
 		m.TotalRequests += int64(n)
 	})
@@ -206,12 +412,32 @@ func (mtl *MultiTierLimiter) AllowN(req *Request, n int) bool {
 	return true
 }
 
-// Wait blocks until the request is allowed or context is canceled.
+// Wait blocks until the request is allowed or context is canceled. It
+// takes the request's cost, one unless the config sets a CostFunc.
 func (mtl *MultiTierLimiter) Wait(req *Request) error {
-	return mtl.WaitN(req, 1)
+	return mtl.WaitN(req, mtl.cost(req))
+}
+
+// cost returns the tokens req takes in Allow and Wait.
+func (mtl *MultiTierLimiter) cost(req *Request) int {
+	if mtl.config.CostFunc == nil {
+		return 1
+	}
+	return max(mtl.config.CostFunc(req), 1)
 }
 
 // WaitN blocks until n requests are allowed or context is canceled.
+// Callers that cannot proceed at once queue for the global tier, which
+// serves them one at a time by Request.Priority, highest first. If
+// QueueSize callers are already queued, WaitN fails at once.
+//
+// By default the caller at the head of the queue waits until every tier can
+// grant n tokens and then takes them from all tiers at once, so no tier's
+// tokens are held while another tier is waited for. While its route or
+// resource tier holds it back, it leaves the queue so that requests for
+// other routes are not blocked, and queues again once that tier is ready.
+// Without EnablePreemptive, the head waits for the global tier only and
+// then waits for its route and resource tiers in turn.
 func (mtl *MultiTierLimiter) WaitN(req *Request, n int) error {
 	ctx := req.Context
 	if ctx == nil {
@@ -229,31 +455,15 @@ func (mtl *MultiTierLimiter) WaitN(req *Request, n int) error {
 		return nil
 	}
 
-	// Slow path: wait for each tier
-	limiters := []struct {
-		limiter Limiter
-		name    string
-	}{
-		{mtl.global, "global"},
-		{mtl.getOrCreateRouteLimiter(req), "route"},
-	}
-
-	if resourceLimiter := mtl.getResourceLimiter(req); resourceLimiter != nil {
-		limiters = append(limiters, struct {
-			limiter Limiter
-			name    string
-		}{resourceLimiter, "resource"})
+	// Slow path: queue for the global tier by priority
+	var err error
+	if mtl.config.EnablePreemptive {
+		err = mtl.waitPreemptive(ctx, req, n)
+	} else {
+		err = mtl.waitSequential(ctx, req, n)
 	}
-
-	for _, l := range limiters {
-		if err := l.limiter.WaitN(ctx, n); err != nil {
-			mtl.cfg.obs.Logger.Debug("rate limit wait failed",
-				"limiter_name", mtl.cfg.name,
-				"tier", l.name,
-				"error", err,
-			)
-			return err
-		}
+	if err != nil {
+		return err
 	}
 
 	waitTime := mtl.cfg.clock.Now().Sub(start)
@@ -272,184 +482,792 @@ func (mtl *MultiTierLimiter) WaitN(req *Request, n int) error {
 	return nil
 }
 
+// limiterTier is one tier a request is limited by.
+type limiterTier struct {
+	limiter Limiter
+	name    string // "global", "route" or "resource"
+}
+
+// tiers returns the limiters of the tiers that apply to req, global first.
+func (mtl *MultiTierLimiter) tiers(req *Request) []limiterTier {
+	tiers := []limiterTier{
+		{mtl.global, "global"},
+		{mtl.getOrCreateRouteLimiter(req), "route"},
+	}
+	if resourceLimiter := mtl.getResourceLimiter(req); resourceLimiter != nil {
+		tiers = append(tiers, limiterTier{resourceLimiter, "resource"})
+	}
+	return tiers
+}
+
+// takeTiers takes n tokens from the tiers and returns the name of the tier
+// that denied them, or "" if all allowed them. Without atomic, each tier is
+// charged in turn and tiers charged before a denial keep their tokens. With
+// atomic, the tiers are charged all or nothing, as by takeAll.
+func (mtl *MultiTierLimiter) takeTiers(now time.Time, tiers []limiterTier, n int, atomic bool) string {
+	if !atomic {
+		for _, t := range tiers {
+			if !t.limiter.AllowN(now, n) {
+				return t.name
+			}
+		}
+		return ""
+	}
+
+	limiters := make([]Limiter, len(tiers))
+	for i, t := range tiers {
+		limiters[i] = t.limiter
+	}
+	if i := takeAll(now, limiters, n); i >= 0 {
+		return tiers[i].name
+	}
+	return ""
+}
+
+// delayTiers returns how long until every tier can grant n tokens, and the
+// tier that is furthest from it. A negative delay means a tier never will.
+func (mtl *MultiTierLimiter) delayTiers(tiers []limiterTier, n int) (time.Duration, string, error) {
+	var delay time.Duration
+	var slowest string
+	for _, t := range tiers {
+		p, ok := t.limiter.(reservable)
+		if !ok {
+			continue
+		}
+		d, err := p.delayN(n)
+		if err != nil {
+			return 0, t.name, err
+		}
+		if d < 0 {
+			return -1, t.name, nil
+		}
+		if d > delay {
+			delay, slowest = d, t.name
+		}
+	}
+	return delay, slowest, nil
+}
+
+// recordLimitHit counts a request denied by the named tier.
+func (mtl *MultiTierLimiter) recordLimitHit(tier string) {
+	mtl.updateMetrics(func(m *MultiTierMetrics) {
+		switch tier {
+		case "global":
+			m.GlobalLimitHits++
+		case "route":
+			m.RouteLimitHits++
+		case "resource":
+			m.ResourceLimitHits++
+		}
+	})
+}
+
+// waitSequential queues for the global tier and waits for it, then waits
+// for the route and resource tiers in turn.
+func (mtl *MultiTierLimiter) waitSequential(ctx context.Context, req *Request, n int) error {
+	w, err := mtl.enqueue(ctx, req)
+	if err != nil {
+		return mtl.waitFailed(req, "global", err)
+	}
+	err = mtl.global.WaitN(ctx, n)
+	mtl.dequeue(w)
+	if err != nil {
+		return mtl.waitFailed(req, "global", err)
+	}
+	mtl.recordPriorityWait(ctx, req, w.enqueued)
+
+	for _, t := range mtl.tiers(req)[1:] {
+		if err := t.limiter.WaitN(ctx, n); err != nil {
+			return mtl.waitFailed(req, t.name, err)
+		}
+	}
+	return nil
+}
+
+// waitPreemptive queues for the global tier and, at the head, waits until
+// every tier can grant n tokens, then takes them from all tiers at once.
+// While the route or resource tier is the slowest, it waits outside the
+// queue and queues again once that tier is ready.
+func (mtl *MultiTierLimiter) waitPreemptive(ctx context.Context, req *Request, n int) error {
+	tiers := mtl.tiers(req)
+	start := mtl.cfg.clock.Now()
+
+	for {
+		w, err := mtl.enqueue(ctx, req)
+		if err != nil {
+			return mtl.waitFailed(req, "global", err)
+		}
+
+		for w != nil {
+			delay, slowest, err := mtl.delayTiers(tiers, n)
+			if err != nil {
+				mtl.dequeue(w)
+				return mtl.waitFailed(req, slowest, err)
+			}
+			if delay == 0 {
+				if denied := mtl.takeTiers(mtl.cfg.clock.Now(), tiers, n, true); denied == "" {
+					mtl.dequeue(w)
+					mtl.recordPriorityWait(ctx, req, start)
+					return nil
+				}
+				// Another caller of a route or resource tier took the
+				// tokens first; the next delay accounts for it
+				continue
+			}
+
+			if slowest != "global" && slowest != "" {
+				mtl.dequeue(w)
+				w = nil
+			}
+			if err := mtl.sleep(ctx, delay); err != nil {
+				if w != nil {
+					mtl.dequeue(w)
+				}
+				return mtl.waitFailed(req, slowest, err)
+			}
+		}
+	}
+}
+
+// enqueue queues the request for the global tier and blocks until it is
+// at the head of the queue.
+func (mtl *MultiTierLimiter) enqueue(ctx context.Context, req *Request) (*priorityWaiter, error) {
+	w := mtl.gate.push(req.Priority, mtl.config.QueueSize)
+	if w == nil {
+		mtl.updateMetrics(func(m *MultiTierMetrics) {
+			m.DroppedRequests++
+		})
+		mtl.cfg.obs.WithContext(ctx).Metrics.Inc("ion_ratelimit_priority_dropped_total",
+			"limiter_name", mtl.cfg.name, "priority", priorityLabel(req.Priority))
+		return nil, NewQueueFullError(mtl.cfg.name, mtl.config.QueueSize)
+	}
+	mtl.recordQueued(req.Priority)
+
+	select {
+	case <-ctx.Done():
+		mtl.dequeue(w)
+		return nil, ctx.Err()
+	case <-w.ready:
+		mtl.recordQueued(req.Priority)
+		return w, nil
+	}
+}
+
+// dequeue leaves the queue for the global tier, admitting the next waiter
+// if w was at the head.
+func (mtl *MultiTierLimiter) dequeue(w *priorityWaiter) {
+	mtl.gate.done(w)
+	mtl.recordQueued(w.priority)
+}
+
+// sleep blocks for d, or until ctx is done if d is negative.
+func (mtl *MultiTierLimiter) sleep(ctx context.Context, d time.Duration) error {
+	if d < 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	timer := mtl.cfg.clock.NewTimer(mtl.cfg.jitterFn(d))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// waitFailed logs a failed wait on the named tier and returns err.
+func (mtl *MultiTierLimiter) waitFailed(req *Request, tier string, err error) error {
+	mtl.cfg.obs.Logger.Debug("rate limit wait failed",
+		"limiter_name", mtl.cfg.name,
+		"tier", tier,
+		"priority", req.Priority,
+		"error", err,
+	)
+	return err
+}
+
+// recordPriorityWait reports how long a request waited since start, by
+// priority.
+func (mtl *MultiTierLimiter) recordPriorityWait(ctx context.Context, req *Request, start time.Time) {
+	mtl.cfg.obs.WithContext(ctx).Metrics.Histogram("ion_ratelimit_priority_wait_seconds",
+		mtl.cfg.clock.Since(start).Seconds(),
+		"limiter_name", mtl.cfg.name, "priority", priorityLabel(req.Priority))
+}
+
+// recordQueued reports the number of callers queued for the global tier,
+// in total and at the given priority.
+func (mtl *MultiTierLimiter) recordQueued(priority int) {
+	counts := mtl.gate.queued()
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+
+	mtl.cfg.obs.Metrics.Gauge("ion_ratelimit_priority_queued", float64(counts[priority]),
+		"limiter_name", mtl.cfg.name, "priority", priorityLabel(priority))
+	mtl.updateMetrics(func(m *MultiTierMetrics) {
+		m.QueuedRequests = int64(total)
+	})
+}
+
 // getOrCreateRouteLimiter gets or creates a route-specific limiter.
 func (mtl *MultiTierLimiter) getOrCreateRouteLimiter(req *Request) Limiter {
 	routeKey := mtl.generateRouteKey(req)
+	if bucket, ok := mtl.bucketMap.Load(routeKey); ok {
+		routeKey = bucketKey(bucket.(string))
+	}
+	now := mtl.cfg.clock.Now()
+	mtl.sweepBuckets(now)
 
-	if limiter, ok := mtl.routes.Load(routeKey); ok {
-		return limiter.(Limiter)
+	return mtl.routeEntry(routeKey, req.Method, req.Endpoint, now).use(now)
+}
+
+// routeEntry gets or creates the route limiter stored under key, for
+// requests with the method and endpoint.
+func (mtl *MultiTierLimiter) routeEntry(key, method, endpoint string, now time.Time) *bucketEntry {
+	if entry, ok := mtl.routes.Load(key); ok {
+		return entry.(*bucketEntry)
 	}
 
-	routeConfig := mtl.findRouteConfig(req.Method, req.Endpoint)
+	mtl.mu.RLock()
+	_, routeConfig := mtl.findRouteLocked(method, endpoint)
+	mtl.mu.RUnlock()
 
 	limiter := NewTokenBucket(
 		routeConfig.Rate,
 		routeConfig.Burst,
-		WithName(fmt.Sprintf("%s_route_%s", mtl.cfg.name, routeKey)),
+		WithName(fmt.Sprintf("%s_route_%s", mtl.cfg.name, key)),
 		WithClock(mtl.cfg.clock),
-		WithJitter(mtl.cfg.jitter),
+		WithJitterStrategy(mtl.cfg.jitterFn),
 		WithLogger(mtl.cfg.obs.Logger),
 		WithMetrics(mtl.cfg.obs.Metrics),
 		WithTracer(mtl.cfg.obs.Tracer),
 	)
 
-	actual, loaded := mtl.routes.LoadOrStore(routeKey, limiter)
-	if loaded {
-		return actual.(Limiter)
+	actual, loaded := mtl.routes.LoadOrStore(key, &bucketEntry{limiter: limiter, method: method, endpoint: endpoint})
+	entry := actual.(*bucketEntry)
+	if !loaded {
+		// Mark it used before the sweep can see it
+		entry.use(now)
+		mtl.updateMetrics(func(m *MultiTierMetrics) {
+			m.BucketsActive++
+		})
 	}
-
-	mtl.updateMetrics(func(m *MultiTierMetrics) {
-		m.BucketsActive++
-	})
-
-	return limiter
+	return entry
 }
 
 // getResourceLimiter gets a resource-specific limiter if applicable.
 func (mtl *MultiTierLimiter) getResourceLimiter(req *Request) Limiter {
-	var resourceKey string
-
-	if req.ResourceID != "" {
-		resourceKey = "resource:" + req.ResourceID
-	} else if req.SubResourceID != "" {
-		resourceKey = "subresource:" + req.SubResourceID
-	} else if req.UserID != "" {
-		resourceKey = "user:" + req.UserID
-	} else {
+	mtl.mu.RLock()
+	resourceKey, resourceID := mtl.resourceKeyLocked(req)
+	mtl.mu.RUnlock()
+	if resourceKey == "" {
 		return nil // No resource limiting needed
 	}
 
-	if limiter, ok := mtl.resources.Load(resourceKey); ok {
-		return limiter.(Limiter)
+	now := mtl.cfg.clock.Now()
+	mtl.sweepBuckets(now)
+
+	return mtl.resourceEntry(resourceKey, resourceID, now).use(now)
+}
+
+// resourceEntry gets or creates the limiter of the resource with the key
+// and identifier.
+func (mtl *MultiTierLimiter) resourceEntry(key, id string, now time.Time) *bucketEntry {
+	if entry, ok := mtl.resources.Load(key); ok {
+		return entry.(*bucketEntry)
 	}
 
+	mtl.mu.RLock()
+	rc := mtl.findResourceConfigLocked(key, id)
+	mtl.mu.RUnlock()
+
 	limiter := NewTokenBucket(
-		mtl.config.DefaultResourceRate,
-		mtl.config.DefaultResourceBurst,
-		WithName(fmt.Sprintf("%s_resource_%s", mtl.cfg.name, resourceKey)),
+		rc.Rate,
+		rc.Burst,
+		WithName(fmt.Sprintf("%s_resource_%s", mtl.cfg.name, key)),
 		WithClock(mtl.cfg.clock),
-		WithJitter(mtl.cfg.jitter),
+		WithJitterStrategy(mtl.cfg.jitterFn),
 		WithLogger(mtl.cfg.obs.Logger),
 		WithMetrics(mtl.cfg.obs.Metrics),
 		WithTracer(mtl.cfg.obs.Tracer),
 	)
 
-	actual, loaded := mtl.resources.LoadOrStore(resourceKey, limiter)
-	if loaded {
-		return actual.(Limiter)
+	actual, loaded := mtl.resources.LoadOrStore(key, &bucketEntry{limiter: limiter})
+	entry := actual.(*bucketEntry)
+	if !loaded {
+		// Mark it used before the sweep can see it
+		entry.use(now)
+		mtl.updateMetrics(func(m *MultiTierMetrics) {
+			m.BucketsActive++
+		})
 	}
+	return entry
+}
 
-	mtl.updateMetrics(func(m *MultiTierMetrics) {
-		m.BucketsActive++
+// bucketEntry is a route or resource limiter and when it was last used.
+type bucketEntry struct {
+	limiter  *TokenBucket
+	method   string       // method and endpoint of the request a route
+	endpoint string       // limiter was created for, to match it again
+	lastUsed atomic.Int64 // unix nanoseconds
+}
+
+// use marks the entry as used at now and returns its limiter.
+func (e *bucketEntry) use(now time.Time) Limiter {
+	e.lastUsed.Store(now.UnixNano())
+	return e.limiter
+}
+
+// sweepBuckets evicts route and resource limiters idle for at least
+// BucketTTL. It runs from the request path, at most once per tenth of the
+// TTL, so no background goroutine is needed.
+func (mtl *MultiTierLimiter) sweepBuckets(now time.Time) {
+	ttl := mtl.config.BucketTTL
+	if ttl <= 0 || !mtl.sweepMu.TryLock() {
+		return
+	}
+	defer mtl.sweepMu.Unlock()
+
+	if now.Before(mtl.nextSweep) {
+		return
+	}
+	mtl.nextSweep = now.Add(ttl / 10)
+
+	mtl.evictIdle(&mtl.routes, "route", now, ttl)
+	mtl.evictIdle(&mtl.resources, "resource", now, ttl)
+}
+
+// evictIdle removes the limiters in buckets idle for at least ttl. A
+// limiter that has not refilled yet is kept, since a fresh one would grant
+// its full burst again.
+func (mtl *MultiTierLimiter) evictIdle(buckets *sync.Map, tier string, now time.Time, ttl time.Duration) {
+	buckets.Range(func(key, value any) bool {
+		entry := value.(*bucketEntry)
+		if now.Sub(time.Unix(0, entry.lastUsed.Load())) < ttl {
+			return true
+		}
+		if entry.limiter.Tokens() < float64(entry.limiter.Burst()) {
+			return true
+		}
+		if !buckets.CompareAndDelete(key, entry) {
+			return true
+		}
+
+		mtl.updateMetrics(func(m *MultiTierMetrics) {
+			m.BucketsActive--
+			m.BucketsEvicted++
+		})
+		mtl.cfg.obs.Metrics.Inc("ion_ratelimit_buckets_evicted_total",
+			"limiter_name", mtl.cfg.name, "tier", tier)
+		return true
 	})
+}
 
-	return limiter
+// resourceKeyLocked returns the resource key and identifier for a request,
+// or empty strings if the request names no resource. Must be called with
+// mtl.mu held.
+func (mtl *MultiTierLimiter) resourceKeyLocked(req *Request) (key, id string) {
+	if req.UserID != "" {
+		if _, ok := mtl.userOverrides[req.UserID]; ok {
+			return "user:" + req.UserID, req.UserID
+		}
+	}
+
+	switch {
+	case req.ResourceID != "":
+		return "resource:" + req.ResourceID, req.ResourceID
+	case req.SubResourceID != "":
+		return "subresource:" + req.SubResourceID, req.SubResourceID
+	case req.UserID != "":
+		return "user:" + req.UserID, req.UserID
+	default:
+		return "", ""
+	}
 }
 
-// generateRouteKey creates a unique key for route identification.
-func (mtl *MultiTierLimiter) generateRouteKey(req *Request) string {
-	pattern := mtl.normalizeRoute(req.Method, req.Endpoint)
+// resourceIDOf returns the resource identifier of a resource key.
+func resourceIDOf(resourceKey string) string {
+	return resourceKey[strings.IndexByte(resourceKey, ':')+1:]
+}
 
-	if len(req.MajorParameters) == 0 {
-		return pattern
+// findResourceConfigLocked finds the configuration for a resource. Must be
+// called with mtl.mu held.
+func (mtl *MultiTierLimiter) findResourceConfigLocked(resourceKey, resourceID string) ResourceConfig {
+	if userID, ok := strings.CutPrefix(resourceKey, "user:"); ok {
+		if rc, ok := mtl.userOverrides[userID]; ok {
+			return rc
+		}
+	}
+	if rc, ok := mtl.resourcePatterns[resourceID]; ok {
+		return rc
+	}
+	if rc, ok := mtl.resourcePatterns[resourceKey]; ok {
+		return rc
 	}
 
-	h := md5.New()
-	h.Write([]byte(pattern))
-	for key, value := range req.MajorParameters {
-		h.Write([]byte(key + ":" + value))
+	best, found := "", false
+	for pattern := range mtl.resourcePatterns {
+		if len(pattern) <= len(best) {
+			continue
+		}
+		if strings.HasPrefix(resourceID, pattern) || strings.HasPrefix(resourceKey, pattern) {
+			best, found = pattern, true
+		}
+	}
+	if found {
+		return mtl.resourcePatterns[best]
+	}
+
+	return ResourceConfig{
+		Rate:  mtl.config.DefaultResourceRate,
+		Burst: mtl.config.DefaultResourceBurst,
+	}
+}
+
+// SetResourcePattern configures the rate for resources matching pattern, as
+// in MultiTierConfig.ResourcePatterns. Existing resource limiters that now
+// match it are updated in place, keeping their current tokens.
+func (mtl *MultiTierLimiter) SetResourcePattern(pattern string, rc ResourceConfig) {
+	mtl.mu.Lock()
+	mtl.resourcePatterns[pattern] = rc
+	mtl.mu.Unlock()
+
+	mtl.cfg.obs.Logger.Debug("resource pattern set",
+		"limiter_name", mtl.cfg.name,
+		"pattern", pattern,
+		"rate", rc.Rate.String(),
+		"burst", rc.Burst,
+	)
+
+	mtl.reconfigureResources()
+}
+
+// RemoveResourcePattern removes a resource pattern. Existing resource
+// limiters that matched it fall back to the next matching pattern or the
+// default resource rate.
+func (mtl *MultiTierLimiter) RemoveResourcePattern(pattern string) {
+	mtl.mu.Lock()
+	delete(mtl.resourcePatterns, pattern)
+	mtl.mu.Unlock()
+
+	mtl.cfg.obs.Logger.Debug("resource pattern removed",
+		"limiter_name", mtl.cfg.name,
+		"pattern", pattern,
+	)
+
+	mtl.reconfigureResources()
+}
+
+// ResourcePatterns returns a copy of the current resource patterns.
+func (mtl *MultiTierLimiter) ResourcePatterns() map[string]ResourceConfig {
+	mtl.mu.RLock()
+	defer mtl.mu.RUnlock()
+
+	patterns := make(map[string]ResourceConfig, len(mtl.resourcePatterns))
+	for pattern, rc := range mtl.resourcePatterns {
+		patterns[pattern] = rc
+	}
+	return patterns
+}
+
+// SetUserOverride gives the user with the given UserID its own resource
+// tier limits, as in MultiTierConfig.UserOverrides. An existing limiter of
+// the user is updated in place, keeping its current tokens.
+func (mtl *MultiTierLimiter) SetUserOverride(userID string, rc ResourceConfig) {
+	mtl.mu.Lock()
+	mtl.userOverrides[userID] = rc
+	mtl.mu.Unlock()
+
+	mtl.cfg.obs.Logger.Debug("user override set",
+		"limiter_name", mtl.cfg.name,
+		"user_id", userID,
+		"rate", rc.Rate.String(),
+		"burst", rc.Burst,
+	)
+
+	mtl.reconfigureResources()
+}
+
+// RemoveUserOverride removes the override of a user. The user's requests
+// are counted against the resources they name again, and an existing
+// limiter of the user falls back to the matching resource pattern or the
+// default resource rate.
+func (mtl *MultiTierLimiter) RemoveUserOverride(userID string) {
+	mtl.mu.Lock()
+	delete(mtl.userOverrides, userID)
+	mtl.mu.Unlock()
+
+	mtl.cfg.obs.Logger.Debug("user override removed",
+		"limiter_name", mtl.cfg.name,
+		"user_id", userID,
+	)
+
+	mtl.reconfigureResources()
+}
+
+// UserOverrides returns a copy of the current user overrides.
+func (mtl *MultiTierLimiter) UserOverrides() map[string]ResourceConfig {
+	mtl.mu.RLock()
+	defer mtl.mu.RUnlock()
+
+	overrides := make(map[string]ResourceConfig, len(mtl.userOverrides))
+	for userID, rc := range mtl.userOverrides {
+		overrides[userID] = rc
+	}
+	return overrides
+}
+
+// AdjustRoute sets the rate and burst of routes matching pattern, as in
+// MultiTierConfig.RoutePatterns, keeping the pattern's major parameters.
+// Existing route limiters are updated in place to the limits of the
+// patterns they now match, keeping their current tokens, so limits can be
+// tuned at runtime, as from an admin API.
+func (mtl *MultiTierLimiter) AdjustRoute(pattern string, rate Rate, burst int) {
+	mtl.mu.Lock()
+	rc := mtl.routePatterns[pattern]
+	rc.Rate, rc.Burst = rate, burst
+	mtl.routePatterns[pattern] = rc
+	mtl.routeMatcher = compileRoutes(mtl.routePatterns)
+	mtl.mu.Unlock()
+
+	mtl.cfg.obs.Logger.Debug("route pattern adjusted",
+		"limiter_name", mtl.cfg.name,
+		"pattern", pattern,
+		"rate", rate.String(),
+		"burst", burst,
+	)
+
+	mtl.reconfigureRoutes()
+}
+
+// AdjustResource sets the rate and burst of the resource with the given
+// identifier, or of resources matching it as a pattern, as
+// SetResourcePattern does.
+func (mtl *MultiTierLimiter) AdjustResource(id string, rate Rate, burst int) {
+	mtl.SetResourcePattern(id, ResourceConfig{Rate: rate, Burst: burst})
+}
+
+// RoutePatterns returns a copy of the current route patterns.
+func (mtl *MultiTierLimiter) RoutePatterns() map[string]RouteConfig {
+	mtl.mu.RLock()
+	defer mtl.mu.RUnlock()
+
+	patterns := make(map[string]RouteConfig, len(mtl.routePatterns))
+	for pattern, rc := range mtl.routePatterns {
+		patterns[pattern] = rc
+	}
+	return patterns
+}
+
+// adjust sets the rate and burst of tb where they differ.
+func adjust(tb *TokenBucket, rate Rate, burst int) {
+	if tb.Rate() != rate {
+		tb.SetRate(rate)
 	}
+	if tb.Burst() != burst {
+		tb.SetBurst(burst)
+	}
+}
+
+// reconfigureRoutes applies the current route patterns to existing route
+// limiters.
+func (mtl *MultiTierLimiter) reconfigureRoutes() {
+	mtl.routes.Range(func(_, value any) bool {
+		entry := value.(*bucketEntry)
+
+		mtl.mu.RLock()
+		_, rc := mtl.findRouteLocked(entry.method, entry.endpoint)
+		mtl.mu.RUnlock()
+
+		adjust(entry.limiter, rc.Rate, rc.Burst)
+		return true
+	})
+}
+
+// reconfigureResources applies the current resource patterns to existing
+// resource limiters.
+func (mtl *MultiTierLimiter) reconfigureResources() {
+	mtl.resources.Range(func(key, value interface{}) bool {
+		tb := value.(*bucketEntry).limiter
+
+		resourceKey := key.(string)
+
+		mtl.mu.RLock()
+		rc := mtl.findResourceConfigLocked(resourceKey, resourceIDOf(resourceKey))
+		mtl.mu.RUnlock()
+
+		adjust(tb, rc.Rate, rc.Burst)
+		return true
+	})
+}
+
+// generateRouteKey returns the key of the route limiter of a request.
+func (mtl *MultiTierLimiter) generateRouteKey(req *Request) string {
+	mtl.mu.RLock()
+	route, _ := mtl.findRouteLocked(req.Method, req.Endpoint)
+	mtl.mu.RUnlock()
 
-	return fmt.Sprintf("%s_%x", pattern, h.Sum(nil)[:8])
+	if mtl.config.RouteKeyFunc != nil {
+		return mtl.config.RouteKeyFunc(route, req)
+	}
+	return DefaultRouteKey(route, req)
 }
 
-// normalizeRoute normalizes an API route for pattern matching.
+// digitRuns matches the numeric IDs normalizeRoute replaces.
+var digitRuns = regexp.MustCompile(`\d+`)
+
+// normalizeRoute normalizes an API route that matches no route pattern.
 func (mtl *MultiTierLimiter) normalizeRoute(method, endpoint string) string {
-	idPattern := regexp.MustCompile(`\d+`)
-	normalized := idPattern.ReplaceAllString(endpoint, "{id}")
+	normalized := digitRuns.ReplaceAllString(endpoint, "{id}")
 	normalized = strings.ReplaceAll(normalized, "//", "/")
 	normalized = strings.TrimSuffix(normalized, "/")
 	return method + ":" + normalized
 }
 
-// findRouteConfig finds the configuration for a specific route.
-func (mtl *MultiTierLimiter) findRouteConfig(method, endpoint string) RouteConfig {
-	normalized := mtl.normalizeRoute(method, endpoint)
-
-	if config, ok := mtl.config.RoutePatterns[normalized]; ok {
-		return config
+// findRouteLocked returns the route of a request and its configuration:
+// the most specific route pattern it matches, or its normalized endpoint
+// with the default route limits. Must be called with mtl.mu held.
+func (mtl *MultiTierLimiter) findRouteLocked(method, endpoint string) (string, RouteConfig) {
+	if p := mtl.routeMatcher.match(method, endpoint); p != nil {
+		return p.key, p.config
 	}
 
-	for pattern, config := range mtl.config.RoutePatterns {
-		if mtl.matchesPattern(normalized, pattern) {
-			return config
-		}
+	normalized := mtl.normalizeRoute(method, endpoint)
+	if config, ok := mtl.routePatterns[normalized]; ok {
+		return normalized, config
 	}
 
-	return RouteConfig{
+	return normalized, RouteConfig{
 		Rate:  mtl.config.DefaultRouteRate,
 		Burst: mtl.config.DefaultRouteBurst,
 	}
 }
 
-// matchesPattern checks if an endpoint matches a route pattern.
-func (mtl *MultiTierLimiter) matchesPattern(endpoint, pattern string) bool {
-	endpointParts := strings.Split(endpoint, "/")
-	patternParts := strings.Split(pattern, "/")
+// UpdateRateLimitFromHeaders updates rate limit information from API response headers.
+// This is designed for APIs that provide rate limit information in response headers,
+// parsed by MultiTierConfig.HeaderScheme. A global limit with no requests left
+// pauses the limiter until it resets; a route limit with no requests left holds
+// back the route of req until then.
+func (mtl *MultiTierLimiter) UpdateRateLimitFromHeaders(req *Request, headers map[string]string) error {
+	h := make(http.Header, len(headers))
+	for key, value := range headers {
+		h.Set(key, value)
+	}
+	mtl.applyHeaders(req, h)
+	return nil
+}
 
-	if len(endpointParts) != len(patternParts) {
-		return false
+// applyHeaders parses h with the header scheme and applies the rate limit
+// state it reports.
+func (mtl *MultiTierLimiter) applyHeaders(req *Request, h http.Header) HeaderInfo {
+	scheme := mtl.config.HeaderScheme
+	if scheme == nil {
+		scheme = XRateLimitHeaders
+	}
+
+	info, ok := scheme.ParseHeaders(h, mtl.cfg.clock.Now())
+	if !ok {
+		return info
 	}
 
-	for i, part := range patternParts {
-		if part != "{id}" && part != endpointParts[i] {
-			return false
+	if info.Bucket != "" && !info.Global && mtl.config.EnableBucketMapping {
+		mtl.mapBucket(req, info.Bucket)
+	}
+
+	if info.Global {
+		if info.ResetAfter > 0 && info.Remaining <= 0 {
+			mtl.hitLog.Warn("global rate limit hit",
+				"limiter_name", mtl.cfg.name,
+				"reset_after", info.ResetAfter,
+			)
+			// Schedule auto-resume
+			mtl.PauseUntil(mtl.cfg.clock.Now().Add(info.ResetAfter))
 		}
+	} else if tb, ok := mtl.getOrCreateRouteLimiter(req).(*TokenBucket); ok {
+		adjustBucket(tb, info)
 	}
 
-	return true
+	mtl.cfg.obs.Logger.Debug("rate limit headers processed",
+		"limiter_name", mtl.cfg.name,
+		"limit", info.Limit,
+		"remaining", info.Remaining,
+		"reset_after", info.ResetAfter,
+		"global", info.Global,
+		"bucket", info.Bucket,
+	)
+
+	return info
 }
 
-// UpdateRateLimitFromHeaders updates rate limit information from API response headers.
-// This is designed for APIs that provide rate limit information in response headers.
-func (mtl *MultiTierLimiter) UpdateRateLimitFromHeaders(req *Request, headers map[string]string) error {
-	limit := mtl.parseIntHeader(headers, "X-RateLimit-Limit", 0)
-	remaining := mtl.parseIntHeader(headers, "X-RateLimit-Remaining", 0)
-	resetAfter := mtl.parseFloatHeader(headers, "X-RateLimit-Reset-After", 0)
-	global := headers["X-RateLimit-Global"] == "true"
-	bucket := headers["X-RateLimit-Bucket"]
+// adjustBucket brings a route limiter in line with the state its upstream
+// bucket reports. A reported limit and window set the rate and burst; a
+// limit alone sets the burst. The upstream grants no more than the
+// remaining requests until it resets, so the limiter is capped to them
+// until then.
+func adjustBucket(tb *TokenBucket, info HeaderInfo) {
+	switch {
+	case info.Limit > 0 && info.Window > 0:
+		rate := NewRate(info.Limit, info.Window)
+		if tb.Rate() != rate {
+			tb.SetRate(rate)
+		}
+		if tb.Burst() != info.Limit {
+			tb.SetBurst(info.Limit)
+		}
+	case info.Limit > 0 && tb.Burst() != info.Limit:
+		tb.SetBurst(info.Limit)
+	}
 
-	if bucket != "" && mtl.config.EnableBucketMapping {
-		routeKey := mtl.generateRouteKey(req)
-		mtl.bucketMap.Store(routeKey, bucket)
+	if info.Remaining < 0 {
+		return
+	}
+	if info.Remaining == 0 && info.ResetAfter > 0 {
+		tb.holdFor(info.ResetAfter)
+		return
 	}
+	tb.capUntil(info.Remaining, info.ResetAfter)
+}
 
-	if global && resetAfter > 0 {
-		mtl.cfg.obs.Logger.Warn("global rate limit hit",
-			"limiter_name", mtl.cfg.name,
-			"reset_after", resetAfter,
-		)
-		// Schedule auto-resume
-		resetTime := mtl.cfg.clock.Now().Add(time.Duration(resetAfter * float64(time.Second)))
-		mtl.PauseUntil(resetTime)
+// mapBucket records that the route of req belongs to an upstream bucket.
+// The route's limiter becomes the bucket's limiter if the bucket has none
+// yet; otherwise the route switches to the bucket's limiter.
+func (mtl *MultiTierLimiter) mapBucket(req *Request, bucket string) {
+	routeKey := mtl.generateRouteKey(req)
+	if _, loaded := mtl.bucketMap.Swap(routeKey, bucket); loaded {
+		// Already mapped; a route moved to another bucket uses that
+		// bucket's limiter from now on
+		return
 	}
 
-	mtl.cfg.obs.Logger.Debug("rate limit headers processed",
-		"limiter_name", mtl.cfg.name,
-		"limit", limit,
-		"remaining", remaining,
-		"reset_after", resetAfter,
-		"global", global,
-		"bucket", bucket,
-	)
+	entry, ok := mtl.routes.LoadAndDelete(routeKey)
+	if !ok {
+		return
+	}
+	if _, loaded := mtl.routes.LoadOrStore(bucketKey(bucket), entry); loaded {
+		mtl.updateMetrics(func(m *MultiTierMetrics) {
+			m.BucketsActive--
+		})
+	}
+}
 
-	return nil
+// bucketKey returns the key of the limiter shared by the routes of an
+// upstream bucket.
+func bucketKey(bucket string) string {
+	return "bucket:" + bucket
 }
 
 // GetMetrics returns current rate limiting metrics.
 func (mtl *MultiTierLimiter) GetMetrics() *MultiTierMetrics {
-	mtl.metrics.mu.RLock()
-	defer mtl.metrics.mu.RUnlock()
+	now := mtl.cfg.clock.Now()
+
+	mtl.metrics.mu.Lock()
+	defer mtl.metrics.mu.Unlock()
+
+	mtl.metrics.currentInterval(now)
 
 	return &MultiTierMetrics{
 		TotalRequests:     mtl.metrics.TotalRequests,
@@ -461,62 +1279,57 @@ func (mtl *MultiTierLimiter) GetMetrics() *MultiTierMetrics {
 		AvgWaitTime:       mtl.metrics.AvgWaitTime,
 		MaxWaitTime:       mtl.metrics.MaxWaitTime,
 		BucketsActive:     mtl.metrics.BucketsActive,
+		BucketsEvicted:    mtl.metrics.BucketsEvicted,
+		Intervals:         append([]IntervalMetrics(nil), mtl.metrics.Intervals...),
+		interval:          mtl.metrics.interval,
+		history:           mtl.metrics.history,
 	}
 }
 
-// updateMetrics safely updates metrics using a function.
+// updateMetrics safely updates metrics using a function. Counter changes are
+// also added to the current metrics interval.
 func (mtl *MultiTierLimiter) updateMetrics(fn func(*MultiTierMetrics)) {
+	now := mtl.cfg.clock.Now()
+
 	mtl.metrics.mu.Lock()
 	defer mtl.metrics.mu.Unlock()
-	fn(mtl.metrics)
-}
 
-// parseIntHeader parses an integer header value.
-func (mtl *MultiTierLimiter) parseIntHeader(headers map[string]string, key string, defaultValue int) int {
-	if value, ok := headers[key]; ok {
-		if parsed, err := strconv.Atoi(value); err == nil {
-			return parsed
-		}
-	}
-	return defaultValue
-}
-
-// parseFloatHeader parses a float header value.
-func (mtl *MultiTierLimiter) parseFloatHeader(headers map[string]string, key string, defaultValue float64) float64 {
-	if value, ok := headers[key]; ok {
-		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
-			return parsed
-		}
-	}
-	return defaultValue
+	before := mtl.metrics.totals()
+	fn(mtl.metrics)
+	after := mtl.metrics.totals()
+
+	im := mtl.metrics.currentInterval(now)
+	im.Requests += after.Requests - before.Requests
+	im.GlobalLimitHits += after.GlobalLimitHits - before.GlobalLimitHits
+	im.RouteLimitHits += after.RouteLimitHits - before.RouteLimitHits
+	im.ResourceLimitHits += after.ResourceLimitHits - before.ResourceLimitHits
+	im.DroppedRequests += after.DroppedRequests - before.DroppedRequests
 }
 
 // Reset resets all rate limit buckets (useful for testing).
 func (mtl *MultiTierLimiter) Reset() {
 	if tb, ok := mtl.global.(*TokenBucket); ok {
-		tb.mu.Lock()
+		tb.lock()
 		tb.tokens = float64(tb.burst)
 		tb.lastRefill = mtl.cfg.clock.Now()
-		tb.mu.Unlock()
+		tb.unlock()
 	}
 
 	mtl.routes.Range(func(key, value interface{}) bool {
-		if tb, ok := value.(*TokenBucket); ok {
-			tb.mu.Lock()
-			tb.tokens = float64(tb.burst)
-			tb.lastRefill = mtl.cfg.clock.Now()
-			tb.mu.Unlock()
-		}
+		tb := value.(*bucketEntry).limiter
+		tb.lock()
+		tb.tokens = float64(tb.burst)
+		tb.lastRefill = mtl.cfg.clock.Now()
+		tb.unlock()
 		return true
 	})
 
 	mtl.resources.Range(func(key, value interface{}) bool {
-		if tb, ok := value.(*TokenBucket); ok {
-			tb.mu.Lock()
-			tb.tokens = float64(tb.burst)
-			tb.lastRefill = mtl.cfg.clock.Now()
-			tb.mu.Unlock()
-		}
+		tb := value.(*bucketEntry).limiter
+		tb.lock()
+		tb.tokens = float64(tb.burst)
+		tb.lastRefill = mtl.cfg.clock.Now()
+		tb.unlock()
 		return true
 	})
 
@@ -529,47 +1342,25 @@ func (mtl *MultiTierLimiter) Reset() {
 	mtl.metrics.DroppedRequests = 0
 	mtl.metrics.AvgWaitTime = 0
 	mtl.metrics.MaxWaitTime = 0
-	mtl.metrics.BucketsActive = 0
+	mtl.metrics.BucketsEvicted = 0
+	// BucketsActive is kept: the buckets are refilled, not removed
+	mtl.metrics.Intervals = nil
 	mtl.metrics.mu.Unlock()
 
-	mtl.mu.Lock()
-	if mtl.pauseTimer != nil {
-		mtl.pauseTimer.Stop()
-	}
-	mtl.pausedUntil = time.Time{}
-	mtl.pauseTimer = nil
-	mtl.mu.Unlock()
+	mtl.Resume()
 }
 
 // PauseUntil pauses all requests until the specified time.
 // This is useful for handling global rate limits from APIs.
 func (mtl *MultiTierLimiter) PauseUntil(until time.Time) {
 	mtl.mu.Lock()
-	defer mtl.mu.Unlock()
-
-	if mtl.pauseTimer != nil {
-		mtl.pauseTimer.Stop()
-	}
-
-	mtl.pausedUntil = until
-	duration := time.Until(until)
+	changed := mtl.setPauseLocked(until)
+	until = mtl.pausedUntil
+	mtl.mu.Unlock()
 
-	if duration <= 0 {
-		mtl.pausedUntil = time.Time{}
-		mtl.pauseTimer = nil
-		return
+	if changed {
+		mtl.notifyPause(until)
 	}
-
-	mtl.cfg.obs.Logger.Warn("rate limiter paused",
-		"limiter_name", mtl.cfg.name,
-		"until", until,
-		"duration", duration,
-	)
-
-	// Schedule auto-resume
-	mtl.pauseTimer = mtl.cfg.clock.AfterFunc(duration, func() {
-		mtl.Resume()
-	})
 }
 
 // PauseFor pauses all requests for the specified duration.
@@ -579,21 +1370,67 @@ func (mtl *MultiTierLimiter) PauseFor(duration time.Duration) {
 
 // Resume resumes rate limiting after a pause.
 func (mtl *MultiTierLimiter) Resume() {
+	mtl.PauseUntil(time.Time{})
+}
+
+// endPause resumes once the pause ending at until is over, unless the
+// pause was changed meanwhile.
+func (mtl *MultiTierLimiter) endPause(until time.Time) {
 	mtl.mu.Lock()
-	defer mtl.mu.Unlock()
+	changed := mtl.pausedUntil.Equal(until) && mtl.setPauseLocked(time.Time{})
+	mtl.mu.Unlock()
 
+	if changed {
+		mtl.notifyPause(time.Time{})
+	}
+}
+
+// setPauseLocked sets the end of the pause, scheduling the auto-resume; a
+// time not after now resumes. It reports whether the pause changed, waking
+// callers in waitForPause if so. Must be called with mtl.mu held.
+func (mtl *MultiTierLimiter) setPauseLocked(until time.Time) bool {
 	if mtl.pauseTimer != nil {
 		mtl.pauseTimer.Stop()
 		mtl.pauseTimer = nil
 	}
 
-	if !mtl.pausedUntil.IsZero() {
+	now := mtl.cfg.clock.Now()
+	if until.After(now) {
+		// Schedule auto-resume
+		mtl.pauseTimer = mtl.cfg.clock.AfterFunc(until.Sub(now), func() {
+			mtl.endPause(until)
+		})
+	} else {
+		until = time.Time{}
+	}
+
+	if until.Equal(mtl.pausedUntil) {
+		return false
+	}
+	mtl.pausedUntil = until
+	close(mtl.pauseChanged)
+	mtl.pauseChanged = make(chan struct{})
+	return true
+}
+
+// notifyPause logs a pause change and reports it to OnPauseChange. A zero
+// until means the limiter resumed.
+func (mtl *MultiTierLimiter) notifyPause(until time.Time) {
+	if until.IsZero() {
 		mtl.cfg.obs.Logger.Info("rate limiter resumed",
 			"limiter_name", mtl.cfg.name,
 		)
+	} else {
+		mtl.cfg.obs.Logger.Warn("rate limiter paused",
+			"limiter_name", mtl.cfg.name,
+			"until", until,
+			"duration", until.Sub(mtl.cfg.clock.Now()),
+		)
 	}
 
-	mtl.pausedUntil = time.Time{}
+	if mtl.config.OnPauseChange != nil {
+		mtl.config.OnPauseChange(!until.IsZero(), until)
+	}
 }
 
 // IsPaused returns whether the limiter is currently paused.
@@ -614,30 +1451,35 @@ func (mtl *MultiTierLimiter) PausedUntil() time.Time {
 	return mtl.pausedUntil
 }
 
-// waitForPause waits for the pause to end or context to be canceled.
+// waitForPause waits for the pause to end or context to be canceled. A
+// pause extended or lifted meanwhile is waited for anew.
 func (mtl *MultiTierLimiter) waitForPause(ctx context.Context) error {
-	mtl.mu.RLock()
-	pausedUntil := mtl.pausedUntil
-	mtl.mu.RUnlock()
-
-	if pausedUntil.IsZero() || mtl.cfg.clock.Now().After(pausedUntil) {
-		return nil
-	}
+	for {
+		mtl.mu.RLock()
+		pausedUntil, changed := mtl.pausedUntil, mtl.pauseChanged
+		mtl.mu.RUnlock()
 
-	duration := time.Until(pausedUntil)
-	if duration <= 0 {
-		return nil
-	}
+		if pausedUntil.IsZero() {
+			return nil
+		}
+		duration := pausedUntil.Sub(mtl.cfg.clock.Now())
+		if duration <= 0 {
+			return nil
+		}
 
-	mtl.cfg.obs.Logger.Debug("waiting for pause to end",
-		"limiter_name", mtl.cfg.name,
-		"duration", duration,
-	)
+		mtl.cfg.obs.WithContext(ctx).Logger.Debug("waiting for pause to end",
+			"limiter_name", mtl.cfg.name,
+			"duration", duration,
+		)
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(duration):
-		return nil
+		timer := mtl.cfg.clock.NewTimer(duration)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C():
+		}
 	}
 }
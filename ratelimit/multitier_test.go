@@ -2,10 +2,23 @@ package ratelimit_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/kolosys/ion/clock"
 	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/sim"
 )
 
 func TestMultiTierLimiter_Basic(t *testing.T) {
@@ -143,6 +156,352 @@ func TestMultiTierLimiter_RoutePatterns(t *testing.T) {
 	}
 }
 
+func TestMultiTierLimiter_RouteMatching(t *testing.T) {
+	newLimiter := func() *ratelimit.MultiTierLimiter {
+		config := ratelimit.DefaultMultiTierConfig()
+		config.DefaultRouteBurst = 1
+		config.RoutePatterns = map[string]ratelimit.RouteConfig{
+			"GET:/orgs/{org}/repos/{repo}":   {Rate: ratelimit.PerMinute(1), Burst: 2},
+			"GET:/orgs/{org}/repos/settings": {Rate: ratelimit.PerMinute(1), Burst: 3},
+			"GET:/files/**":                  {Rate: ratelimit.PerMinute(1), Burst: 4},
+			"GET:/files/*/meta":              {Rate: ratelimit.PerMinute(1), Burst: 5},
+			"*:/health":                      {Rate: ratelimit.PerMinute(1), Burst: 6},
+			"POST:/health":                   {Rate: ratelimit.PerMinute(1), Burst: 7},
+		}
+		return ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(newTestClock(time.Unix(0, 0))))
+	}
+
+	allowed := func(limiter *ratelimit.MultiTierLimiter, method, endpoint string) int {
+		req := &ratelimit.Request{Method: method, Endpoint: endpoint}
+		n := 0
+		for i := 0; i < 10; i++ {
+			if limiter.Allow(req) {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		endpoint string
+		want     int
+	}{
+		{"path params", "GET", "/orgs/acme/repos/3f2b6c1e-9a7d-4e0f-b1c2-5d8e7f6a9b0c", 2},
+		{"literal beats param", "GET", "/orgs/acme/repos/settings", 3},
+		{"trailing wildcard", "GET", "/files/a/b/c.txt", 4},
+		{"trailing wildcard matches nothing", "GET", "/files", 4},
+		{"wildcard segment beats trailing wildcard", "GET", "/files/report.pdf/meta", 5},
+		{"any method", "DELETE", "/health", 6},
+		{"method beats any method", "POST", "/health/", 7},
+		{"no match", "GET", "/orgs/acme/members", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed(newLimiter(), tt.method, tt.endpoint); got != tt.want {
+				t.Errorf("expected %d requests allowed, got %d", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("requests matching a pattern share its limiter", func(t *testing.T) {
+		limiter := newLimiter()
+		if got := allowed(limiter, "GET", "/orgs/acme/repos/api"); got != 2 {
+			t.Fatalf("expected 2 requests allowed, got %d", got)
+		}
+		if got := allowed(limiter, "GET", "/orgs/globex/repos/web"); got != 0 {
+			t.Errorf("expected the pattern's limiter to be exhausted, got %d allowed", got)
+		}
+	})
+}
+
+func TestMultiTierLimiter_RouteKey(t *testing.T) {
+	t.Run("default key is deterministic", func(t *testing.T) {
+		params := map[string]string{"org_id": "1", "project_id": "2", "env": "prod"}
+		want := ratelimit.DefaultRouteKey("GET:/orgs/{id}", &ratelimit.Request{MajorParameters: params})
+		for range 20 {
+			// A new map each time, so iteration order varies
+			copied := make(map[string]string, len(params))
+			for k, v := range params {
+				copied[k] = v
+			}
+			if got := ratelimit.DefaultRouteKey("GET:/orgs/{id}", &ratelimit.Request{MajorParameters: copied}); got != want {
+				t.Fatalf("expected key %q, got %q", want, got)
+			}
+		}
+
+		other := ratelimit.DefaultRouteKey("GET:/orgs/{id}", &ratelimit.Request{
+			MajorParameters: map[string]string{"org_id": "12", "project_id": "", "env": "prod"},
+		})
+		if other == want {
+			t.Error("expected different parameters to give a different key")
+		}
+		if got := ratelimit.DefaultRouteKey("GET:/items", &ratelimit.Request{}); got != "GET:/items" {
+			t.Errorf("expected the route without parameters, got %q", got)
+		}
+	})
+
+	t.Run("custom key func", func(t *testing.T) {
+		config := ratelimit.DefaultMultiTierConfig()
+		config.DefaultRouteBurst = 2
+		config.RouteKeyFunc = func(route string, req *ratelimit.Request) string {
+			return req.MajorParameters["tenant"]
+		}
+		limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(newTestClock(time.Unix(0, 0))))
+
+		// Different routes of one tenant share a limiter
+		a := &ratelimit.Request{Method: "GET", Endpoint: "/a", MajorParameters: map[string]string{"tenant": "acme"}}
+		b := &ratelimit.Request{Method: "POST", Endpoint: "/b", MajorParameters: map[string]string{"tenant": "acme"}}
+		if !limiter.Allow(a) || !limiter.Allow(b) {
+			t.Fatal("expected the tenant's burst to be allowed")
+		}
+		if limiter.Allow(a) {
+			t.Error("expected the tenant's shared limiter to be exhausted")
+		}
+	})
+}
+
+func TestMultiTierLimiter_Adjust(t *testing.T) {
+	clk := newTestClock(time.Unix(0, 0))
+	config := ratelimit.DefaultMultiTierConfig()
+	config.DefaultRouteRate = ratelimit.PerMinute(1)
+	config.DefaultRouteBurst = 2
+	config.DefaultResourceRate = ratelimit.PerMinute(1)
+	config.DefaultResourceBurst = 2
+	config.RoutePatterns = map[string]ratelimit.RouteConfig{
+		"GET:/orgs/{id}": {Rate: ratelimit.PerMinute(1), Burst: 2, MajorParameters: []string{"org"}},
+		"GET:/items":     {Rate: ratelimit.PerSecond(100), Burst: 100},
+	}
+
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"), ratelimit.WithClock(clk))
+
+	allowed := func(req *ratelimit.Request) int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			if limiter.Allow(req) {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("route", func(t *testing.T) {
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/orgs/42"}
+		other := &ratelimit.Request{Method: "GET", Endpoint: "/users/42"}
+		allowed(req)
+		allowed(other)
+
+		limiter.AdjustRoute("GET:/orgs/{id}", ratelimit.PerSecond(5), 5)
+		clk.Advance(time.Second)
+		if got := allowed(req); got != 5 {
+			t.Errorf("expected the existing route limiter to allow 5, got %d", got)
+		}
+		if got := allowed(other); got != 0 {
+			t.Errorf("expected other routes to keep their limit, got %d", got)
+		}
+		if rc := limiter.RoutePatterns()["GET:/orgs/{id}"]; rc.Burst != 5 || len(rc.MajorParameters) != 1 {
+			t.Errorf("expected the pattern updated with its major parameters, got %+v", rc)
+		}
+	})
+
+	t.Run("new route pattern", func(t *testing.T) {
+		req := &ratelimit.Request{Method: "POST", Endpoint: "/jobs"}
+		allowed(req)
+
+		limiter.AdjustRoute("POST:/jobs", ratelimit.PerSecond(3), 3)
+		clk.Advance(time.Second)
+		if got := allowed(req); got != 3 {
+			t.Errorf("expected the route limiter to allow 3, got %d", got)
+		}
+	})
+
+	t.Run("resource", func(t *testing.T) {
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/items", ResourceID: "org:7"}
+		allowed(req)
+
+		limiter.AdjustResource("org:7", ratelimit.PerSecond(4), 4)
+		clk.Advance(time.Second)
+		if got := allowed(req); got != 4 {
+			t.Errorf("expected the resource limiter to allow 4, got %d", got)
+		}
+	})
+}
+
+func TestMultiTierLimiter_ExportRestore(t *testing.T) {
+	clk := newTestClock(time.Unix(0, 0))
+	newLimiter := func() *ratelimit.MultiTierLimiter {
+		config := ratelimit.DefaultMultiTierConfig()
+		config.DefaultResourceRate = ratelimit.PerMinute(1)
+		config.DefaultResourceBurst = 2
+		config.RoutePatterns = map[string]ratelimit.RouteConfig{
+			"GET:/orgs/{id}": {Rate: ratelimit.PerMinute(1), Burst: 2},
+		}
+		return ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(clk))
+	}
+
+	limiter := newLimiter()
+	limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/orgs/1"})
+	limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/orgs/2"})
+	limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/users", UserID: "7"})
+	limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/users", UserID: "7"})
+	limiter.PauseFor(time.Minute)
+
+	data, err := json.Marshal(limiter.Export())
+	if err != nil {
+		t.Fatalf("marshal state: %v", err)
+	}
+	var state ratelimit.MultiTierState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("unmarshal state: %v", err)
+	}
+
+	restored := newLimiter()
+	restored.Restore(state)
+	if !restored.PausedUntil().Equal(clk.Now().Add(time.Minute)) {
+		t.Errorf("expected the pause restored, got %v", restored.PausedUntil())
+	}
+	restored.Resume()
+
+	if restored.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/orgs/3"}) {
+		t.Error("expected the restored route limiter to be exhausted")
+	}
+	if restored.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/items", UserID: "7"}) {
+		t.Error("expected the restored resource limiter to be exhausted")
+	}
+	if !restored.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/items"}) {
+		t.Error("expected routes without state to start full")
+	}
+}
+
+func TestMultiTierLimiter_ResourcePatterns(t *testing.T) {
+	clk := newTestClock(time.Unix(0, 0))
+	config := ratelimit.DefaultMultiTierConfig()
+	config.GlobalRate = ratelimit.PerSecond(100)
+	config.GlobalBurst = 100
+	config.DefaultResourceRate = ratelimit.PerSecond(1)
+	config.DefaultResourceBurst = 2
+	config.ResourcePatterns = map[string]ratelimit.ResourceConfig{
+		"org:":     {Rate: ratelimit.PerSecond(1), Burst: 4},
+		"org:hot":  {Rate: ratelimit.PerSecond(1), Burst: 1},
+		"user:":    {Rate: ratelimit.PerSecond(1), Burst: 3},
+		"org:hot7": {Rate: ratelimit.PerSecond(1), Burst: 6},
+	}
+
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"), ratelimit.WithClock(clk))
+
+	allowed := func(req *ratelimit.Request) int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			if limiter.Allow(req) {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name string
+		req  *ratelimit.Request
+		want int
+	}{
+		{"resource class", &ratelimit.Request{Method: "GET", Endpoint: "/a", ResourceID: "org:42"}, 4},
+		{"longest prefix", &ratelimit.Request{Method: "GET", Endpoint: "/b", ResourceID: "org:hot1"}, 1},
+		{"exact match", &ratelimit.Request{Method: "GET", Endpoint: "/c", ResourceID: "org:hot7"}, 6},
+		{"resource key", &ratelimit.Request{Method: "GET", Endpoint: "/d", UserID: "7"}, 3},
+		{"default", &ratelimit.Request{Method: "GET", Endpoint: "/e", ResourceID: "project:1"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed(tt.req); got != tt.want {
+				t.Errorf("expected %d requests allowed, got %d", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("runtime setters", func(t *testing.T) {
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/f", ResourceID: "shard:9"}
+		if got := allowed(req); got != 2 {
+			t.Fatalf("expected the default burst of 2, got %d", got)
+		}
+
+		limiter.SetResourcePattern("shard:9", ratelimit.ResourceConfig{Rate: ratelimit.PerSecond(10), Burst: 10})
+		clk.Advance(time.Second)
+		if got := allowed(req); got != 10 {
+			t.Errorf("expected the existing limiter to pick up the new burst, got %d", got)
+		}
+
+		limiter.RemoveResourcePattern("shard:9")
+		clk.Advance(5 * time.Second)
+		if got := allowed(req); got != 2 {
+			t.Errorf("expected the default burst after removal, got %d", got)
+		}
+		if _, ok := limiter.ResourcePatterns()["shard:9"]; ok {
+			t.Error("expected the pattern to be removed")
+		}
+	})
+}
+
+func TestMultiTierLimiter_UserOverrides(t *testing.T) {
+	clk := newTestClock(time.Unix(0, 0))
+	config := ratelimit.DefaultMultiTierConfig()
+	config.DefaultResourceRate = ratelimit.PerSecond(1)
+	config.DefaultResourceBurst = 2
+	config.ResourcePatterns = map[string]ratelimit.ResourceConfig{
+		"org:": {Rate: ratelimit.PerSecond(1), Burst: 3},
+	}
+	config.UserOverrides = map[string]ratelimit.ResourceConfig{
+		"premium": {Rate: ratelimit.PerSecond(1), Burst: 8},
+	}
+
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"), ratelimit.WithClock(clk))
+
+	allowed := func(req *ratelimit.Request) int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			if limiter.Allow(req) {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("override replaces the resource limit", func(t *testing.T) {
+		premium := &ratelimit.Request{Method: "GET", Endpoint: "/a", ResourceID: "org:1", UserID: "premium"}
+		if got := allowed(premium); got != 8 {
+			t.Errorf("expected the override burst of 8, got %d", got)
+		}
+
+		// Other users of the organization still share its bucket
+		basic := &ratelimit.Request{Method: "GET", Endpoint: "/a", ResourceID: "org:1", UserID: "basic"}
+		if got := allowed(basic); got != 3 {
+			t.Errorf("expected the organization burst of 3, got %d", got)
+		}
+	})
+
+	t.Run("runtime setters", func(t *testing.T) {
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/b", UserID: "trial"}
+		if got := allowed(req); got != 2 {
+			t.Fatalf("expected the default burst of 2, got %d", got)
+		}
+
+		limiter.SetUserOverride("trial", ratelimit.ResourceConfig{Rate: ratelimit.PerSecond(5), Burst: 5})
+		clk.Advance(time.Second)
+		if got := allowed(req); got != 5 {
+			t.Errorf("expected the existing limiter to pick up the override, got %d", got)
+		}
+
+		limiter.RemoveUserOverride("trial")
+		clk.Advance(5 * time.Second)
+		if got := allowed(req); got != 2 {
+			t.Errorf("expected the default burst after removal, got %d", got)
+		}
+		if _, ok := limiter.UserOverrides()["trial"]; ok {
+			t.Error("expected the override to be removed")
+		}
+	})
+}
+
 func TestMultiTierLimiter_Wait(t *testing.T) {
 	config := ratelimit.DefaultMultiTierConfig()
 	config.GlobalRate = ratelimit.PerSecond(2)
@@ -230,6 +589,62 @@ func TestMultiTierLimiter_Metrics(t *testing.T) {
 	}
 }
 
+func TestMultiTierLimiter_IntervalMetrics(t *testing.T) {
+	clock := newTestClock(time.Unix(0, 0))
+	config := ratelimit.DefaultMultiTierConfig()
+	config.GlobalRate = ratelimit.Rate{TokensPerSec: 0}
+	config.GlobalBurst = 3
+	config.MetricsInterval = 10 * time.Second
+	config.MetricsHistory = 3
+
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(clock))
+	req := &ratelimit.Request{Method: "GET", Endpoint: "/test"}
+
+	limiter.Allow(req)
+	limiter.Allow(req)
+	clock.Advance(10 * time.Second)
+	limiter.Allow(req)
+	limiter.Allow(req) // global limit hit
+
+	intervals := limiter.GetMetrics().Intervals
+	if len(intervals) != 2 {
+		t.Fatalf("expected 2 intervals, got %d", len(intervals))
+	}
+	if intervals[0].Requests != 2 || intervals[0].LimitHits() != 0 {
+		t.Errorf("unexpected first interval: %+v", intervals[0])
+	}
+	if intervals[1].Requests != 1 || intervals[1].GlobalLimitHits != 1 {
+		t.Errorf("unexpected second interval: %+v", intervals[1])
+	}
+	if rps := intervals[0].RequestsPerSecond(); rps != 0.2 {
+		t.Errorf("expected 0.2 requests per second, got %v", rps)
+	}
+
+	t.Run("quiet intervals are kept up to the history", func(t *testing.T) {
+		clock.Advance(35 * time.Second)
+
+		intervals := limiter.GetMetrics().Intervals
+		if len(intervals) != 3 {
+			t.Fatalf("expected history of 3 intervals, got %d", len(intervals))
+		}
+		if !intervals[0].Start.Equal(time.Unix(20, 0)) {
+			t.Errorf("expected oldest interval to start at 20s, got %v", intervals[0].Start)
+		}
+		for _, im := range intervals {
+			if im.Requests != 0 || im.LimitHits() != 0 {
+				t.Errorf("expected empty interval, got %+v", im)
+			}
+		}
+	})
+
+	t.Run("reset clears intervals", func(t *testing.T) {
+		limiter.Reset()
+		if n := len(limiter.GetMetrics().Intervals); n != 1 {
+			t.Errorf("expected only the current interval after reset, got %d", n)
+		}
+	})
+}
+
 func TestMultiTierLimiter_Reset(t *testing.T) {
 	config := ratelimit.DefaultMultiTierConfig()
 	config.GlobalRate = ratelimit.PerSecond(5)
@@ -313,6 +728,42 @@ func TestMultiTierLimiter_AllowN(t *testing.T) {
 	}
 }
 
+func TestMultiTierLimiter_CostFunc(t *testing.T) {
+	config := ratelimit.DefaultMultiTierConfig()
+	config.GlobalRate = ratelimit.PerMinute(1)
+	config.GlobalBurst = 12
+	config.DefaultRouteBurst = 20
+	config.CostFunc = func(req *ratelimit.Request) int {
+		switch req.Endpoint {
+		case "/search":
+			return 10
+		case "/health":
+			return 0
+		}
+		return 1
+	}
+
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"),
+		ratelimit.WithClock(newTestClock(time.Unix(0, 0))))
+
+	search := &ratelimit.Request{Method: "GET", Endpoint: "/search"}
+	read := &ratelimit.Request{Method: "GET", Endpoint: "/items"}
+	health := &ratelimit.Request{Method: "GET", Endpoint: "/health"}
+
+	if !limiter.Allow(search) {
+		t.Error("expected the first search to be allowed")
+	}
+	if limiter.Allow(search) {
+		t.Error("expected a second search to exceed the global burst")
+	}
+	if !limiter.Allow(read) || !limiter.Allow(health) {
+		t.Error("expected reads to cost one token")
+	}
+	if limiter.Allow(read) {
+		t.Error("expected the global burst to be spent")
+	}
+}
+
 func TestMultiTierLimiter_WaitN(t *testing.T) {
 	config := ratelimit.DefaultMultiTierConfig()
 	config.GlobalRate = ratelimit.PerSecond(4)
@@ -630,6 +1081,58 @@ func TestMultiTierLimiter_PausedUntil(t *testing.T) {
 	}
 }
 
+func TestMultiTierLimiter_PauseClock(t *testing.T) {
+	clk := newTestClock(time.Unix(0, 0))
+
+	var mu sync.Mutex
+	var changes []bool
+	config := ratelimit.DefaultMultiTierConfig()
+	config.OnPauseChange = func(paused bool, until time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, paused)
+	}
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(clk))
+	req := &ratelimit.Request{Method: "GET", Endpoint: "/test", Context: context.Background()}
+
+	limiter.PauseFor(10 * time.Second)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.Wait(req)
+	}()
+	clk.BlockUntil(2) // the auto-resume and the waiting caller
+
+	// Extending the pause keeps the caller waiting until the new end
+	limiter.PauseFor(20 * time.Second)
+	clk.BlockUntil(2)
+	clk.Advance(10 * time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned during the extended pause: %v", err)
+	default:
+	}
+
+	clk.Advance(10 * time.Second)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait should have completed once the pause ended")
+	}
+
+	if limiter.IsPaused() {
+		t.Error("limiter should have resumed on the fake clock")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []bool{true, true, false}; !slices.Equal(changes, want) {
+		t.Errorf("expected pause changes %v, got %v", want, changes)
+	}
+}
+
 func TestMultiTierLimiter_ResetClearsPause(t *testing.T) {
 	config := ratelimit.DefaultMultiTierConfig()
 	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"))
@@ -648,3 +1151,689 @@ func TestMultiTierLimiter_ResetClearsPause(t *testing.T) {
 		t.Error("Reset should clear pause state")
 	}
 }
+
+func TestMultiTierLimiter_UpdateFromResponse(t *testing.T) {
+	newResponse := func(status int, body string, header http.Header) *http.Response {
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    httptest.NewRequest("GET", "/channels/123/messages", nil),
+		}
+	}
+
+	t.Run("global body pauses the limiter", func(t *testing.T) {
+		limiter := ratelimit.NewMultiTierLimiter(ratelimit.DefaultMultiTierConfig())
+
+		body := `{"message": "You are being rate limited.", "retry_after": 2.5, "global": true}`
+		resp := newResponse(http.StatusTooManyRequests, body, nil)
+		if err := limiter.UpdateFromResponse(nil, resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !limiter.IsPaused() {
+			t.Fatal("expected a global 429 to pause the limiter")
+		}
+		if d := time.Until(limiter.PausedUntil()); d < 2*time.Second || d > 3*time.Second {
+			t.Errorf("expected a pause of about 2.5s, got %v", d)
+		}
+
+		rest, _ := io.ReadAll(resp.Body)
+		if string(rest) != body {
+			t.Errorf("expected the body to stay readable, got %q", rest)
+		}
+	})
+
+	t.Run("route body holds the route", func(t *testing.T) {
+		limiter := ratelimit.NewMultiTierLimiter(ratelimit.DefaultMultiTierConfig())
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/channels/123/messages"}
+		other := &ratelimit.Request{Method: "GET", Endpoint: "/guilds/1"}
+
+		resp := newResponse(http.StatusTooManyRequests, `{"error": {"retry_after_ms": 60000}}`, nil)
+		if err := limiter.UpdateFromResponse(req, resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if limiter.IsPaused() {
+			t.Error("expected a route 429 not to pause the limiter")
+		}
+		if limiter.Allow(req) {
+			t.Error("expected the limited route to be held")
+		}
+		if !limiter.Allow(other) {
+			t.Error("expected other routes to be allowed")
+		}
+	})
+
+	t.Run("header fallbacks", func(t *testing.T) {
+		limiter := ratelimit.NewMultiTierLimiter(ratelimit.DefaultMultiTierConfig())
+
+		header := http.Header{}
+		header.Set("Retry-After", "30")
+		header.Set("X-RateLimit-Scope", "global")
+		if err := limiter.UpdateFromResponse(nil, newResponse(http.StatusTooManyRequests, "Too Many Requests", header)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if d := time.Until(limiter.PausedUntil()); d < 29*time.Second || d > 30*time.Second {
+			t.Errorf("expected a pause of about 30s from Retry-After, got %v", d)
+		}
+	})
+
+	t.Run("successful responses", func(t *testing.T) {
+		limiter := ratelimit.NewMultiTierLimiter(ratelimit.DefaultMultiTierConfig())
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/channels/123/messages"}
+
+		resp := newResponse(http.StatusOK, `{"retry_after": 10, "global": true}`, nil)
+		if err := limiter.UpdateFromResponse(req, resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if limiter.IsPaused() || !limiter.Allow(req) {
+			t.Error("expected the body of a successful response to be ignored")
+		}
+	})
+}
+
+func TestMultiTierLimiter_Priority(t *testing.T) {
+	newLimiter := func(clk *clock.FakeClock, every time.Duration, queueSize int) *ratelimit.MultiTierLimiter {
+		config := ratelimit.DefaultMultiTierConfig()
+		config.GlobalRate = ratelimit.Per(1, every)
+		config.GlobalBurst = 1
+		config.DefaultRouteRate = ratelimit.PerSecond(100)
+		config.DefaultRouteBurst = 100
+		config.QueueSize = queueSize
+		config.PriorityAging = time.Second
+		return ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"), ratelimit.WithClock(clk))
+	}
+
+	// wait starts a WaitN at the given priority and sends it on done once
+	// it returns
+	wait := func(limiter *ratelimit.MultiTierLimiter, priority int, done chan<- int) {
+		go func() {
+			req := &ratelimit.Request{Method: "GET", Endpoint: "/test", Priority: priority}
+			if err := limiter.Wait(req); err != nil {
+				t.Errorf("priority %d: unexpected error: %v", priority, err)
+			}
+			done <- priority
+		}()
+	}
+
+	// queued waits until n callers are queued behind the head
+	queued := func(limiter *ratelimit.MultiTierLimiter, n int64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for limiter.GetMetrics().QueuedRequests != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d queued requests, got %d", n, limiter.GetMetrics().QueuedRequests)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	req := &ratelimit.Request{Method: "GET", Endpoint: "/test"}
+
+	t.Run("higher priority is served first", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		limiter := newLimiter(clk, time.Second, 10)
+		if !limiter.Allow(req) {
+			t.Fatal("expected the burst to be allowed")
+		}
+
+		done := make(chan int, 3)
+		wait(limiter, 0, done)
+		clk.BlockUntil(1)
+		wait(limiter, 1, done)
+		queued(limiter, 1)
+		wait(limiter, 5, done)
+		queued(limiter, 2)
+
+		if limiter.Allow(req) {
+			t.Error("expected Allow to fail while requests are queued")
+		}
+
+		for _, want := range []int{0, 5, 1} {
+			clk.BlockUntil(1)
+			clk.Advance(time.Second)
+			if got := <-done; got != want {
+				t.Errorf("expected priority %d to be served, got %d", want, got)
+			}
+		}
+	})
+
+	t.Run("aging prevents starvation", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		limiter := newLimiter(clk, 3*time.Second, 10)
+		limiter.Allow(req)
+
+		done := make(chan int, 3)
+		wait(limiter, 0, done)
+		clk.BlockUntil(1)
+		wait(limiter, 1, done)
+		queued(limiter, 1)
+
+		// When the head is served at 3s, priority 1 has aged to 4 while
+		// priority 2, queued at 2s, has only aged to 3
+		clk.Advance(2 * time.Second)
+		wait(limiter, 2, done)
+		queued(limiter, 2)
+
+		for i, want := range []int{0, 1, 2} {
+			clk.BlockUntil(1)
+			if i == 0 {
+				clk.Advance(time.Second)
+			} else {
+				clk.Advance(3 * time.Second)
+			}
+			if got := <-done; got != want {
+				t.Errorf("expected priority %d to be served, got %d", want, got)
+			}
+		}
+	})
+
+	t.Run("full queue rejects", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		limiter := newLimiter(clk, time.Second, 1)
+		limiter.Allow(req)
+
+		done := make(chan int, 2)
+		wait(limiter, 0, done)
+		clk.BlockUntil(1)
+		wait(limiter, 0, done)
+		queued(limiter, 1)
+
+		var rlErr *ratelimit.RateLimitError
+		if err := limiter.Wait(req); !errors.As(err, &rlErr) {
+			t.Fatalf("expected a RateLimitError, got %v", err)
+		}
+		if got := limiter.GetMetrics().DroppedRequests; got != 1 {
+			t.Errorf("expected 1 dropped request, got %d", got)
+		}
+
+		for range 2 {
+			clk.BlockUntil(1)
+			clk.Advance(time.Second)
+			<-done
+		}
+	})
+}
+
+func TestMultiTierLimiter_Preemptive(t *testing.T) {
+	newLimiter := func(clk *clock.FakeClock, globalBurst int, preemptive bool) *ratelimit.MultiTierLimiter {
+		config := ratelimit.DefaultMultiTierConfig()
+		config.GlobalRate = ratelimit.Per(1, time.Minute)
+		config.GlobalBurst = globalBurst
+		config.DefaultRouteRate = ratelimit.Per(1, 10*time.Second)
+		config.DefaultRouteBurst = 1
+		config.EnablePreemptive = preemptive
+		return ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"), ratelimit.WithClock(clk))
+	}
+	route := func(endpoint string) *ratelimit.Request {
+		return &ratelimit.Request{Method: "GET", Endpoint: endpoint}
+	}
+
+	t.Run("denied requests return global tokens", func(t *testing.T) {
+		limiter := newLimiter(newTestClock(time.Unix(0, 0)), 2, true)
+
+		if !limiter.Allow(route("/a")) {
+			t.Fatal("expected the first request to be allowed")
+		}
+		if limiter.Allow(route("/a")) {
+			t.Fatal("expected the route to deny the second request")
+		}
+		if !limiter.Allow(route("/b")) {
+			t.Error("expected the global token to be returned by the denied request")
+		}
+		if limiter.Allow(route("/c")) {
+			t.Error("expected the global tier to be empty")
+		}
+		if got := limiter.GetMetrics().RouteLimitHits; got != 1 {
+			t.Errorf("expected 1 route limit hit, got %d", got)
+		}
+	})
+
+	t.Run("denied requests are not recorded as allowed", func(t *testing.T) {
+		rec := sim.NewRecorder()
+		config := ratelimit.DefaultMultiTierConfig()
+		config.DefaultRouteBurst = 1
+		limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"),
+			ratelimit.WithClock(newTestClock(time.Unix(0, 0))), ratelimit.WithMetrics(rec))
+
+		limiter.Allow(route("/a"))
+		limiter.Allow(route("/a"))
+
+		if got := rec.Count("ion_ratelimit_requests_total", "limiter_name", "test_global", "result", "allowed"); got != 1 {
+			t.Errorf("expected 1 allowed global request, got %v", got)
+		}
+		if got := rec.Count("ion_ratelimit_tokens_returned_total", "limiter_name", "test_global"); got != 0 {
+			t.Errorf("expected canceled reservations not to count as returned, got %v", got)
+		}
+	})
+
+	t.Run("sequential mode spends global tokens on denied requests", func(t *testing.T) {
+		limiter := newLimiter(newTestClock(time.Unix(0, 0)), 2, false)
+
+		limiter.Allow(route("/a"))
+		limiter.Allow(route("/a"))
+		if limiter.Allow(route("/b")) {
+			t.Error("expected the denied request to have spent a global token")
+		}
+	})
+
+	t.Run("route waits do not hold the queue", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		limiter := newLimiter(clk, 10, true)
+		limiter.Allow(route("/a"))
+
+		done := make(chan error, 1)
+		go func() {
+			done <- limiter.Wait(route("/a"))
+		}()
+		clk.BlockUntil(1)
+
+		if err := limiter.Wait(route("/b")); err != nil {
+			t.Fatalf("expected another route to proceed, got %v", err)
+		}
+
+		clk.Advance(10 * time.Second)
+		if err := <-done; err != nil {
+			t.Fatalf("expected the route wait to succeed, got %v", err)
+		}
+		if got := limiter.GetMetrics().TotalRequests; got != 3 {
+			t.Errorf("expected 3 requests, got %d", got)
+		}
+	})
+}
+
+func TestMultiTierLimiter_BucketTTL(t *testing.T) {
+	clk := newTestClock(time.Unix(0, 0))
+	rec := sim.NewRecorder()
+	config := ratelimit.DefaultMultiTierConfig()
+	config.DefaultRouteRate = ratelimit.PerSecond(1)
+	config.DefaultRouteBurst = 10
+	config.BucketTTL = time.Minute
+	config.RoutePatterns = map[string]ratelimit.RouteConfig{
+		"GET:/c": {Rate: ratelimit.PerMinute(1), Burst: 10},
+	}
+
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"),
+		ratelimit.WithClock(clk), ratelimit.WithMetrics(rec))
+
+	for _, req := range []*ratelimit.Request{
+		{Method: "GET", Endpoint: "/a"},
+		{Method: "GET", Endpoint: "/b", UserID: "7"},
+		{Method: "GET", Endpoint: "/c"},
+	} {
+		if !limiter.Allow(req) {
+			t.Fatalf("expected %s to be allowed", req.Endpoint)
+		}
+	}
+	if got := limiter.GetMetrics().BucketsActive; got != 4 {
+		t.Fatalf("expected 4 active buckets, got %d", got)
+	}
+
+	// Drain /c so that it has not refilled by the time it expires
+	for limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/c"}) {
+	}
+	clk.Advance(30 * time.Second)
+	limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/a"})
+	clk.Advance(30 * time.Second)
+	limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/a"})
+
+	m := limiter.GetMetrics()
+	if m.BucketsActive != 2 || m.BucketsEvicted != 2 {
+		t.Errorf("expected /b and user:7 evicted, got %d active, %d evicted", m.BucketsActive, m.BucketsEvicted)
+	}
+	if got := rec.Count("ion_ratelimit_buckets_evicted_total", "limiter_name", "test", "tier", "resource"); got != 1 {
+		t.Errorf("expected 1 resource eviction, got %v", got)
+	}
+
+	// An evicted resource starts over with a full bucket
+	if !limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/a", UserID: "7"}) {
+		t.Error("expected the evicted resource to be allowed again")
+	}
+}
+
+func TestHeaderSchemes(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+
+	tests := []struct {
+		name   string
+		scheme ratelimit.HeaderScheme
+		header http.Header
+		want   ratelimit.HeaderInfo
+		found  bool
+	}{
+		{
+			name:   "x-ratelimit delay reset",
+			scheme: ratelimit.XRateLimitHeaders,
+			header: header("X-RateLimit-Limit", "10", "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "30"),
+			want:   ratelimit.HeaderInfo{Limit: 10, Remaining: 0, ResetAfter: 30 * time.Second},
+			found:  true,
+		},
+		{
+			name:   "x-ratelimit unix reset and scope",
+			scheme: ratelimit.XRateLimitHeaders,
+			header: header("X-RateLimit-Reset", "1700000012", "X-RateLimit-Scope", "global"),
+			want:   ratelimit.HeaderInfo{Remaining: -1, ResetAfter: 12 * time.Second, Global: true},
+			found:  true,
+		},
+		{
+			name:   "discord",
+			scheme: ratelimit.DiscordHeaders,
+			header: header("X-RateLimit-Limit", "5", "X-RateLimit-Remaining", "1",
+				"X-RateLimit-Reset-After", "1.5", "X-RateLimit-Bucket", "abcd1234"),
+			want:  ratelimit.HeaderInfo{Limit: 5, Remaining: 1, ResetAfter: 1500 * time.Millisecond, Bucket: "abcd1234"},
+			found: true,
+		},
+		{
+			name:   "github",
+			scheme: ratelimit.GitHubHeaders,
+			header: header("x-ratelimit-limit", "5000", "x-ratelimit-remaining", "4999",
+				"x-ratelimit-reset", "1700000600", "x-ratelimit-resource", "core"),
+			want:  ratelimit.HeaderInfo{Limit: 5000, Remaining: 4999, ResetAfter: 10 * time.Minute, Global: true, Bucket: "core"},
+			found: true,
+		},
+		{
+			name:   "stripe",
+			scheme: ratelimit.StripeHeaders,
+			header: header("Stripe-Rate-Limited-Reason", "global-rate"),
+			want:   ratelimit.HeaderInfo{Remaining: 0, Global: true},
+			found:  true,
+		},
+		{
+			name:   "aws",
+			scheme: ratelimit.AWSHeaders,
+			header: header("x-amzn-ErrorType", "ThrottlingException:http://internal.amazon.com/", "Retry-After", "2"),
+			want:   ratelimit.HeaderInfo{Remaining: 0, ResetAfter: 2 * time.Second},
+			found:  true,
+		},
+		{
+			name:   "ietf structured",
+			scheme: ratelimit.IETFHeaders,
+			header: header("RateLimit", `"default";r=50;t=30`, "RateLimit-Policy", `"default";q=100;w=60`),
+			want:   ratelimit.HeaderInfo{Limit: 100, Window: time.Minute, Remaining: 50, ResetAfter: 30 * time.Second, Bucket: "default"},
+			found:  true,
+		},
+		{
+			name:   "ietf separate fields",
+			scheme: ratelimit.IETFHeaders,
+			header: header("RateLimit-Limit", "100", "RateLimit-Remaining", "0", "RateLimit-Reset", "5",
+				"RateLimit-Policy", "100;w=60"),
+			want:  ratelimit.HeaderInfo{Limit: 100, Window: time.Minute, Remaining: 0, ResetAfter: 5 * time.Second},
+			found: true,
+		},
+		{
+			name:   "no headers",
+			scheme: ratelimit.GitHubHeaders,
+			header: header("Content-Type", "application/json"),
+			found:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := tt.scheme.ParseHeaders(tt.header, now)
+			if found != tt.found {
+				t.Fatalf("expected found %v, got %v", tt.found, found)
+			}
+			if found && got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("exhausted limits hold the limiter", func(t *testing.T) {
+		clk := newTestClock(now)
+		config := ratelimit.DefaultMultiTierConfig()
+		config.HeaderScheme = ratelimit.IETFHeaders
+		limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(clk))
+
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/search"}
+		if err := limiter.UpdateRateLimitFromHeaders(req, map[string]string{"RateLimit": `"search";r=0;t=10`}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if limiter.Allow(req) {
+			t.Error("expected the route to be held until the reset")
+		}
+		if !limiter.Allow(&ratelimit.Request{Method: "GET", Endpoint: "/other"}) {
+			t.Error("expected other routes to be allowed")
+		}
+
+		config.HeaderScheme = ratelimit.GitHubHeaders
+		limiter = ratelimit.NewMultiTierLimiter(config)
+		reset := time.Now().Add(time.Minute).Unix()
+		limiter.UpdateRateLimitFromHeaders(req, map[string]string{
+			"x-ratelimit-remaining": "0",
+			"x-ratelimit-reset":     strconv.FormatInt(reset, 10),
+		})
+		if got := limiter.PausedUntil().Sub(time.Unix(reset, 0)); got < -time.Second || got > time.Second {
+			t.Errorf("expected a pause until the reset, off by %v", got)
+		}
+	})
+}
+
+func TestMultiTierLimiter_BucketAdjustment(t *testing.T) {
+	newLimiter := func(clk *clock.FakeClock, scheme ratelimit.HeaderScheme) *ratelimit.MultiTierLimiter {
+		config := ratelimit.DefaultMultiTierConfig()
+		config.DefaultRouteRate = ratelimit.PerSecond(10)
+		config.DefaultRouteBurst = 10
+		config.HeaderScheme = scheme
+		return ratelimit.NewMultiTierLimiter(config, ratelimit.WithClock(clk))
+	}
+	allowed := func(limiter *ratelimit.MultiTierLimiter, req *ratelimit.Request) int {
+		n := 0
+		for limiter.Allow(req) {
+			n++
+		}
+		return n
+	}
+
+	t.Run("policy sets rate and burst", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		limiter := newLimiter(clk, ratelimit.IETFHeaders)
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/items"}
+
+		limiter.UpdateRateLimitFromHeaders(req, map[string]string{"RateLimit-Policy": "4;w=2"})
+		if got := allowed(limiter, req); got != 4 {
+			t.Errorf("expected a burst of 4, got %d", got)
+		}
+		clk.Advance(time.Second)
+		if got := allowed(limiter, req); got != 2 {
+			t.Errorf("expected 2 requests per second, got %d", got)
+		}
+	})
+
+	t.Run("remaining caps the route until reset", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		limiter := newLimiter(clk, ratelimit.DiscordHeaders)
+		req := &ratelimit.Request{Method: "GET", Endpoint: "/items"}
+
+		limiter.UpdateRateLimitFromHeaders(req, map[string]string{
+			"X-RateLimit-Remaining":   "2",
+			"X-RateLimit-Reset-After": "5",
+		})
+		if got := allowed(limiter, req); got != 2 {
+			t.Errorf("expected the 2 remaining requests, got %d", got)
+		}
+		clk.Advance(5 * time.Second)
+		if got := allowed(limiter, req); got != 0 {
+			t.Errorf("expected no refill before the reset, got %d", got)
+		}
+		clk.Advance(time.Second)
+		if got := allowed(limiter, req); got != 10 {
+			t.Errorf("expected a full refill a second after the reset, got %d", got)
+		}
+	})
+
+	t.Run("routes in one bucket share a limiter", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		limiter := newLimiter(clk, ratelimit.DiscordHeaders)
+		a := &ratelimit.Request{Method: "GET", Endpoint: "/a"}
+		b := &ratelimit.Request{Method: "POST", Endpoint: "/b"}
+
+		limiter.Allow(a)
+		limiter.UpdateRateLimitFromHeaders(a, map[string]string{
+			"X-RateLimit-Bucket":      "abcd",
+			"X-RateLimit-Remaining":   "1",
+			"X-RateLimit-Reset-After": "10",
+		})
+		limiter.UpdateRateLimitFromHeaders(b, map[string]string{"X-RateLimit-Bucket": "abcd"})
+
+		if !limiter.Allow(b) {
+			t.Error("expected the shared bucket to allow its remaining request")
+		}
+		if limiter.Allow(a) {
+			t.Error("expected the shared bucket to be empty")
+		}
+		if got := limiter.GetMetrics().BucketsActive; got != 1 {
+			t.Errorf("expected 1 active bucket, got %d", got)
+		}
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("limits", func(t *testing.T) {
+		config, err := ratelimit.LoadConfig(strings.NewReader(`{
+			"global": {"rate": 100, "burst": 200},
+			"route": {"rate": 1, "per": 60000000000, "burst": 5},
+			"routes": {
+				"GET:/search": {"rate": 5, "burst": 5},
+				"POST:/orgs/{id}/jobs": {"rate": 1, "burst": 2, "major_parameters": ["org_id"]}
+			},
+			"resources": {"org:": {"rate": 200, "burst": 200}},
+			"users": {"premium-7": {"rate": 50, "burst": 50}}
+		}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if config.GlobalRate != ratelimit.PerSecond(100) || config.GlobalBurst != 200 {
+			t.Errorf("unexpected global limit %v, %d", config.GlobalRate, config.GlobalBurst)
+		}
+		if config.DefaultRouteRate != ratelimit.PerMinute(1) || config.DefaultRouteBurst != 5 {
+			t.Errorf("unexpected default route limit %v, %d", config.DefaultRouteRate, config.DefaultRouteBurst)
+		}
+		if config.DefaultResourceBurst != ratelimit.DefaultMultiTierConfig().DefaultResourceBurst {
+			t.Errorf("expected the default resource limit, got burst %d", config.DefaultResourceBurst)
+		}
+		jobs := config.RoutePatterns["POST:/orgs/{id}/jobs"]
+		if jobs.Burst != 2 || len(jobs.MajorParameters) != 1 || jobs.MajorParameters[0] != "org_id" {
+			t.Errorf("unexpected route pattern %+v", jobs)
+		}
+		if config.ResourcePatterns["org:"].Burst != 200 {
+			t.Errorf("unexpected resource patterns %+v", config.ResourcePatterns)
+		}
+		if config.UserOverrides["premium-7"].Burst != 50 {
+			t.Errorf("unexpected user overrides %+v", config.UserOverrides)
+		}
+	})
+
+	t.Run("duration strings", func(t *testing.T) {
+		config, err := ratelimit.LoadConfig(strings.NewReader(`{
+			"route": {"rate": 1, "per": "1m", "burst": 5},
+			"routes": {"POST:/jobs": {"rate": 3, "per": "1h", "burst": 3, "major_parameters": ["org_id"]}},
+			"users": {"premium-7": {"rate": 10, "per": "10s", "burst": 10}}
+		}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if config.DefaultRouteRate != ratelimit.PerMinute(1) {
+			t.Errorf("expected 1 per minute, got %v", config.DefaultRouteRate)
+		}
+		if jobs := config.RoutePatterns["POST:/jobs"]; jobs.Rate != ratelimit.PerHour(3) || len(jobs.MajorParameters) != 1 {
+			t.Errorf("unexpected route pattern %+v", jobs)
+		}
+		if user := config.UserOverrides["premium-7"]; user.Rate != ratelimit.PerSecond(1) {
+			t.Errorf("expected 1 per second, got %v", user.Rate)
+		}
+	})
+
+	t.Run("rejects invalid files", func(t *testing.T) {
+		tests := map[string]string{
+			"unknown field":          `{"globl": {"rate": 1, "burst": 1}}`,
+			"unknown limit field":    `{"global": {"rate": 1, "burst": 1, "brust": 2}}`,
+			"unknown route field":    `{"routes": {"GET:/a": {"rate": 1, "burst": 1, "major_params": ["id"]}}}`,
+			"zero burst":             `{"routes": {"GET:/a": {"rate": 1}}}`,
+			"negative rate":          `{"resources": {"org:": {"rate": -1, "burst": 1}}}`,
+			"malformed duration":     `{"route": {"rate": 1, "per": "1 minute", "burst": 1}}`,
+			"fractional nanoseconds": `{"route": {"rate": 1, "per": 1.5, "burst": 1}}`,
+			"malformed json":         `{"global": `,
+		}
+		for name, data := range tests {
+			if _, err := ratelimit.LoadConfig(strings.NewReader(data)); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
+
+func TestMultiTierLimiter_WatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	write := func(data string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"routes": {"GET:/search": {"rate": 1, "burst": 1}}}`, time.Unix(1, 0))
+
+	clk := newTestClock(time.Unix(0, 0))
+	config := ratelimit.DefaultMultiTierConfig()
+	config.DefaultRouteRate = ratelimit.PerMinute(1)
+	config.DefaultRouteBurst = 1
+	limiter := ratelimit.NewMultiTierLimiter(config, ratelimit.WithName("test"), ratelimit.WithClock(clk))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.WatchConfig(ctx, path, time.Second)
+	}()
+	clk.BlockUntil(1)
+
+	req := &ratelimit.Request{Method: "GET", Endpoint: "/search"}
+	if !limiter.Allow(req) || limiter.Allow(req) {
+		t.Fatal("expected the route burst of 1 from the file")
+	}
+
+	write(`{"routes": {"GET:/search": {"rate": 10, "burst": 10}}, "resources": {"org:": {"rate": 5, "burst": 5}}}`, time.Unix(2, 0))
+	clk.Advance(time.Second)
+
+	deadline := time.Now().Add(time.Second)
+	for limiter.RoutePatterns()["GET:/search"].Burst != 10 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the route pattern to be reloaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if limiter.ResourcePatterns()["org:"].Burst != 5 {
+		t.Error("expected the resource patterns to be reloaded")
+	}
+	clk.Advance(time.Second)
+	if !limiter.Allow(req) || !limiter.Allow(req) {
+		t.Error("expected the existing route limiter to pick up the new burst")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if err := limiter.WatchConfig(context.Background(), filepath.Join(t.TempDir(), "missing.json"), time.Second); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if err := limiter.WatchConfig(context.Background(), path, 0); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// priorityWaiter is a MultiTierLimiter.WaitN caller queued for the global
+// tier.
+type priorityWaiter struct {
+	priority int
+	seq      uint64    // arrival order, to break ties
+	enqueued time.Time // for aging and wait time metrics
+	ready    chan struct{}
+}
+
+// priorityGate admits blocked MultiTierLimiter.WaitN callers to the global
+// tier one at a time, highest priority first. The admitted waiter, the
+// head, waits on the global limiter alone, so a request queued later with
+// a higher priority takes the next global tokens ahead of lower priority
+// ones that were already waiting. A waiter gains one priority level per
+// aging interval spent in the queue, so low priority requests are not
+// starved by a steady stream of high priority ones.
+type priorityGate struct {
+	clock Clock
+	aging time.Duration // zero disables aging
+
+	mu      sync.Mutex
+	waiters []*priorityWaiter
+	head    *priorityWaiter
+	seq     uint64
+}
+
+// busy reports whether any waiter is queued or at the head, in which case
+// non-blocking callers must not take global tokens ahead of them.
+func (g *priorityGate) busy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.head != nil || len(g.waiters) > 0
+}
+
+// push queues a waiter, admitting it at once if the gate is free. It
+// returns nil if limit waiters are already queued.
+func (g *priorityGate) push(priority, limit int) *priorityWaiter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if limit > 0 && len(g.waiters) >= limit {
+		return nil
+	}
+
+	g.seq++
+	w := &priorityWaiter{
+		priority: priority,
+		seq:      g.seq,
+		enqueued: g.clock.Now(),
+		ready:    make(chan struct{}),
+	}
+	g.waiters = append(g.waiters, w)
+	if g.head == nil {
+		g.promoteLocked()
+	}
+	return w
+}
+
+// done releases w, whether it is the head or still queued, and admits the
+// next waiter if w was the head.
+func (g *priorityGate) done(w *priorityWaiter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.head == w {
+		g.head = nil
+		g.promoteLocked()
+		return
+	}
+	for i, qw := range g.waiters {
+		if qw == w {
+			g.waiters = append(g.waiters[:i], g.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// queued returns the number of queued waiters per base priority, not
+// counting the head.
+func (g *priorityGate) queued() map[int]int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	counts := make(map[int]int)
+	for _, w := range g.waiters {
+		counts[w.priority]++
+	}
+	return counts
+}
+
+// promoteLocked makes the waiter with the highest effective priority the
+// head. Must be called with g.mu held and no head.
+func (g *priorityGate) promoteLocked() {
+	if len(g.waiters) == 0 {
+		return
+	}
+
+	now := g.clock.Now()
+	best := 0
+	for i := 1; i < len(g.waiters); i++ {
+		a, b := g.waiters[i], g.waiters[best]
+		pa, pb := g.effectiveLocked(a, now), g.effectiveLocked(b, now)
+		if pa > pb || (pa == pb && a.seq < b.seq) {
+			best = i
+		}
+	}
+
+	g.head = g.waiters[best]
+	g.waiters = append(g.waiters[:best], g.waiters[best+1:]...)
+	close(g.head.ready)
+}
+
+// effectiveLocked returns the priority of w including aging.
+// Must be called with g.mu held.
+func (g *priorityGate) effectiveLocked(w *priorityWaiter, now time.Time) int {
+	if g.aging <= 0 {
+		return w.priority
+	}
+	return w.priority + int(now.Sub(w.enqueued)/g.aging)
+}
+
+// priorityLabel returns the metric label for a priority.
+func priorityLabel(priority int) string {
+	return strconv.Itoa(priority)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/kolosys/ion/clock"
 	"github.com/kolosys/ion/observe"
 )
 
@@ -22,6 +23,40 @@ type Limiter interface {
 	WaitN(ctx context.Context, n int) error
 }
 
+// Decision is the outcome of a limiter's AllowNWithInfo.
+type Decision struct {
+	Allowed    bool          // the requests were admitted
+	Limit      int           // burst of the limiter
+	Remaining  int           // requests that would be admitted now
+	RetryAfter time.Duration // when denied requests may be admitted, negative if never at the current rate and burst
+}
+
+// InfoLimiter is implemented by limiters that report their state with each
+// decision, so that HTTP layers can set accurate rate limit and Retry-After
+// headers. TokenBucket, LeakyBucket, GCRA, SlidingWindow, SlidingLog and
+// FairShareConsumer implement it.
+type InfoLimiter interface {
+	Limiter
+
+	// AllowNWithInfo is AllowN, also reporting the state of the limiter
+	// after the decision. The state is read under the same lock as the
+	// decision, so it is consistent with it.
+	AllowNWithInfo(now time.Time, n int) Decision
+}
+
+// Adjustable is implemented by limiters whose rate and burst can be changed
+// while they are in use, as from an admin API. TokenBucket, LeakyBucket,
+// GCRA, SlidingWindow and SlidingLog implement it. For a LeakyBucket the
+// burst is its capacity, and for a SlidingWindow or SlidingLog the number
+// of requests per window.
+type Adjustable interface {
+	// SetRate changes the rate. Invalid rates are ignored.
+	SetRate(rate Rate)
+
+	// SetBurst changes the burst. Values below one are ignored.
+	SetBurst(burst int)
+}
+
 // Rate represents the rate at which tokens are added to the bucket.
 type Rate struct {
 	TokensPerSec float64
@@ -67,37 +102,32 @@ func (r Rate) String() string {
 }
 
 // Clock abstracts time operations for testability.
-type Clock interface {
-	Now() time.Time
-	Sleep(time.Duration)
-	AfterFunc(time.Duration, func()) Timer
-}
+// It is an alias of clock.Clock so every Ion component shares one clock type.
+type Clock = clock.Clock
 
 // Timer represents a timer that can be stopped.
-type Timer interface {
-	Stop() bool
-}
-
-// realClock implements Clock using the real time functions.
-type realClock struct{}
-
-func (realClock) Now() time.Time                            { return time.Now() }
-func (realClock) Sleep(d time.Duration)                     { time.Sleep(d) }
-func (realClock) AfterFunc(d time.Duration, f func()) Timer { return &realTimer{time.AfterFunc(d, f)} }
-
-// realTimer wraps time.Timer to implement our Timer interface.
-type realTimer struct{ *time.Timer }
-
-func (t *realTimer) Stop() bool { return t.Timer.Stop() }
+type Timer = clock.Timer
 
 // Option configures rate limiter behavior.
 type Option func(*config)
 
 type config struct {
-	name   string
-	clock  Clock
-	jitter float64
-	obs    *observe.Observability
+	name      string
+	clock     Clock
+	jitter    float64
+	jitterFn  JitterFunc
+	leakyMode LeakyMode
+	fairness  Fairness
+	split     bool
+	warmup    time.Duration
+	obs       *observe.Observability
+
+	throttleKeys  []string
+	rejectHandler RejectFunc
+	requestFunc   RequestFunc
+	maxKeys       int
+	keyTTL        time.Duration
+	store         Store
 }
 
 // WithName sets the rate limiter name for observability and error reporting.
@@ -128,6 +158,65 @@ func WithJitter(jitter float64) Option {
 	}
 }
 
+// WithJitterStrategy sets how WaitN operations randomize their waits, such
+// as FullJitter or DecorrelatedJitter for retry storms where many callers
+// wake together. It takes precedence over WithJitter.
+func WithJitterStrategy(jitter JitterFunc) Option {
+	return func(c *config) {
+		c.jitterFn = jitter
+	}
+}
+
+// WithLeakyMode selects how a LeakyBucket admits requests. It has no effect
+// on other limiters. The default is LeakyMeter.
+func WithLeakyMode(mode LeakyMode) Option {
+	return func(c *config) {
+		c.leakyMode = mode
+	}
+}
+
+// WithFairness sets the order in which blocked WaitN callers are served.
+// The default is FIFO. It has no effect on a LeakyBucket in LeakyQueue mode,
+// which is always FIFO.
+func WithFairness(fairness Fairness) Option {
+	return func(c *config) {
+		c.fairness = fairness
+	}
+}
+
+// WithSplitWaits lets WaitN on a TokenBucket or LeakyBucket take requests
+// larger than the burst or capacity in chunks of at most that size, each
+// waiting for the bucket to refill, instead of failing them. It paces work
+// whose unit exceeds the burst, such as large batch jobs. Each chunk counts
+// as a request in metrics; if the wait fails, the chunks already taken are
+// returned. It has no effect on AllowN or on other limiters.
+func WithSplitWaits() Option {
+	return func(c *config) {
+		c.split = true
+	}
+}
+
+// WithWarmup makes a new TokenBucket start with a tenth of its burst and
+// refill at a tenth of its rate, ramping linearly to the full rate over d,
+// so that a freshly deployed instance does not hit downstream services at
+// full speed. The warm-up starts with the first request. It applies to the
+// local bucket only, not to state shared through a Store, and has no effect
+// on other limiters.
+func WithWarmup(d time.Duration) Option {
+	return func(c *config) {
+		c.warmup = max(d, 0)
+	}
+}
+
+// WithThrottleKeys selects the log fields that, along with the message,
+// identify a message key for a ThrottledLogger. By default the key is the
+// message alone. It has no effect on limiters.
+func WithThrottleKeys(fields ...string) Option {
+	return func(c *config) {
+		c.throttleKeys = fields
+	}
+}
+
 // WithLogger sets the logger for observability.
 func WithLogger(logger observe.Logger) Option {
 	return func(c *config) {
@@ -152,15 +241,20 @@ func WithTracer(tracer observe.Tracer) Option {
 // newConfig creates a config with default values.
 func newConfig(opts ...Option) *config {
 	cfg := &config{
-		name:   "",
-		clock:  realClock{},
-		jitter: 0.0,
-		obs:    observe.New(),
+		name:      "",
+		clock:     clock.Real(),
+		jitter:    0.0,
+		leakyMode: LeakyMeter,
+		fairness:  FIFO,
+		obs:       observe.New(),
 	}
 
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	if cfg.jitterFn == nil {
+		cfg.jitterFn = UniformJitter(cfg.jitter)
+	}
 
 	return cfg
 }
@@ -2,12 +2,16 @@ package ratelimit_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/kolosys/ion/observe"
 	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/sim"
 )
 
 func TestRate(t *testing.T) {
@@ -174,12 +178,63 @@ func TestTokenBucketWaitN(t *testing.T) {
 
 	t.Run("request exceeds burst", func(t *testing.T) {
 		err := tb.WaitN(context.Background(), 10) // Burst is 5
-		if err == nil {
-			t.Error("expected error for request exceeding burst")
+		var rlErr *ratelimit.RateLimitError
+		if !errors.As(err, &rlErr) || rlErr.Limit != 5 || rlErr.IsRetryable() {
+			t.Errorf("expected a non-retryable RateLimitError with limit 5, got %v", err)
 		}
 	})
 }
 
+func TestAllowNWithInfo(t *testing.T) {
+	limiters := map[string]func(ratelimit.Clock) ratelimit.InfoLimiter{
+		"token bucket": func(clk ratelimit.Clock) ratelimit.InfoLimiter {
+			return ratelimit.NewTokenBucket(ratelimit.PerSecond(2), 2, ratelimit.WithClock(clk))
+		},
+		"leaky bucket": func(clk ratelimit.Clock) ratelimit.InfoLimiter {
+			return ratelimit.NewLeakyBucket(ratelimit.PerSecond(2), 2, ratelimit.WithClock(clk))
+		},
+		"gcra": func(clk ratelimit.Clock) ratelimit.InfoLimiter {
+			return ratelimit.NewGCRA(ratelimit.PerSecond(2), 2, ratelimit.WithClock(clk))
+		},
+		"sliding window": func(clk ratelimit.Clock) ratelimit.InfoLimiter {
+			return ratelimit.NewSlidingWindow(ratelimit.PerSecond(2), time.Second, ratelimit.WithClock(clk))
+		},
+		"sliding log": func(clk ratelimit.Clock) ratelimit.InfoLimiter {
+			return ratelimit.NewSlidingLog(ratelimit.PerSecond(2), time.Second, ratelimit.WithClock(clk))
+		},
+	}
+
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			clock := newTestClock(time.Unix(0, 0))
+			l := newLimiter(clock)
+
+			d := l.AllowNWithInfo(clock.Now(), 1)
+			if !d.Allowed || d.Limit != 2 || d.Remaining != 1 || d.RetryAfter != 0 {
+				t.Errorf("unexpected first decision %+v", d)
+			}
+			l.AllowNWithInfo(clock.Now(), 1)
+
+			d = l.AllowNWithInfo(clock.Now(), 1)
+			if d.Allowed || d.Remaining != 0 {
+				t.Errorf("expected a denial with nothing left, got %+v", d)
+			}
+			if d.RetryAfter <= 0 || d.RetryAfter > 2*time.Second {
+				t.Errorf("expected a retry within two seconds, got %v", d.RetryAfter)
+			}
+
+			clock.Advance(d.RetryAfter)
+			if !l.AllowN(clock.Now(), 1) {
+				t.Errorf("expected a request to be allowed after %v", d.RetryAfter)
+			}
+
+			if d := l.AllowNWithInfo(clock.Now(), 3); d.Allowed || d.RetryAfter >= 0 {
+				t.Errorf("expected a request over the burst never to be allowed, got %+v", d)
+			}
+		})
+	}
+}
+
 func TestLeakyBucketNew(t *testing.T) {
 	t.Run("valid parameters", func(t *testing.T) {
 		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(10), 5)
@@ -281,6 +336,261 @@ func TestLeakyBucketWaitN(t *testing.T) {
 	})
 }
 
+func TestJitterStrategies(t *testing.T) {
+	const wait = 100 * time.Millisecond
+	strategies := []struct {
+		name     string
+		jitter   ratelimit.JitterFunc
+		min, max time.Duration
+	}{
+		{"uniform", ratelimit.UniformJitter(0.5), wait, 150 * time.Millisecond},
+		{"full", ratelimit.FullJitter(), 0, wait},
+		{"equal", ratelimit.EqualJitter(), wait / 2, wait},
+		{"decorrelated", ratelimit.DecorrelatedJitter(time.Second), wait, time.Second},
+	}
+
+	for _, s := range strategies {
+		t.Run(s.name, func(t *testing.T) {
+			for range 1000 {
+				if d := s.jitter(wait); d < s.min || d > s.max {
+					t.Fatalf("expected wait in [%v, %v], got %v", s.min, s.max, d)
+				}
+			}
+			if d := s.jitter(0); d != 0 {
+				t.Errorf("expected no wait to stay zero, got %v", d)
+			}
+		})
+	}
+
+	t.Run("decorrelated spreads retries", func(t *testing.T) {
+		jitter := ratelimit.DecorrelatedJitter(time.Second)
+		longest := time.Duration(0)
+		for range 100 {
+			longest = max(longest, jitter(wait))
+		}
+		if longest <= 3*wait {
+			t.Errorf("expected waits to grow past 3x the wait, longest %v", longest)
+		}
+	})
+
+	t.Run("limiter waits use the strategy", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		var calls atomic.Int32
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 1, ratelimit.WithClock(clock),
+			ratelimit.WithJitterStrategy(func(d time.Duration) time.Duration {
+				calls.Add(1)
+				return d
+			}))
+		tb.AllowN(clock.Now(), 1)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- tb.WaitN(context.Background(), 1)
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(100 * time.Millisecond)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("WaitN should have completed")
+		}
+		if calls.Load() == 0 {
+			t.Error("expected the jitter strategy to be called")
+		}
+	})
+}
+
+func TestSplitWaits(t *testing.T) {
+	t.Run("token bucket takes large requests in chunks", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 5, ratelimit.WithClock(clock),
+			ratelimit.WithLogger(logger), ratelimit.WithSplitWaits())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- tb.WaitN(context.Background(), 12)
+		}()
+
+		// 5 now, 5 after 500ms, 2 after another 200ms
+		<-logger.queued
+		clock.Advance(500 * time.Millisecond)
+		<-logger.queued
+		clock.Advance(100 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatal("WaitN should wait for the last chunk")
+		case <-time.After(10 * time.Millisecond):
+		}
+		clock.Advance(100 * time.Millisecond)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("WaitN should have completed")
+		}
+		if tokens := tb.Tokens(); tokens != 0 {
+			t.Errorf("expected all tokens taken, got %v", tokens)
+		}
+	})
+
+	t.Run("failed wait returns taken chunks", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 3, ratelimit.WithClock(clock),
+			ratelimit.WithLogger(logger), ratelimit.WithSplitWaits())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- tb.WaitN(ctx, 9)
+		}()
+		<-logger.queued
+		cancel()
+
+		if err := <-done; err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if tokens := tb.Tokens(); tokens != 3 {
+			t.Errorf("expected the first chunk returned, got %v tokens", tokens)
+		}
+	})
+
+	t.Run("leaky bucket takes large requests in chunks", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(10), 5, ratelimit.WithClock(clock),
+			ratelimit.WithLogger(logger), ratelimit.WithSplitWaits())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- lb.WaitN(context.Background(), 8)
+		}()
+
+		<-logger.queued
+		clock.Advance(300 * time.Millisecond)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("WaitN should have completed")
+		}
+		if level := lb.Level(); level != 5 {
+			t.Errorf("expected a full bucket, got level %v", level)
+		}
+	})
+
+	t.Run("without the option large requests fail", func(t *testing.T) {
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 5)
+		if err := tb.WaitN(context.Background(), 6); err == nil {
+			t.Error("expected error for request exceeding burst")
+		}
+	})
+}
+
+func TestLeakyBucketModes(t *testing.T) {
+	t.Run("meter admits a burst", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(10), 5, ratelimit.WithClock(clock))
+
+		if lb.Mode() != ratelimit.LeakyMeter {
+			t.Errorf("expected meter mode by default, got %v", lb.Mode())
+		}
+		for i := 0; i < 5; i++ {
+			if !lb.AllowN(clock.Now(), 1) {
+				t.Fatalf("request %d should be admitted", i+1)
+			}
+		}
+		if lb.AllowN(clock.Now(), 1) {
+			t.Error("request beyond capacity should be denied")
+		}
+	})
+
+	t.Run("queue admits only when drained", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(10), 5,
+			ratelimit.WithClock(clock), ratelimit.WithLeakyMode(ratelimit.LeakyQueue))
+
+		if !lb.AllowN(clock.Now(), 1) {
+			t.Fatal("first request should drain immediately")
+		}
+		if lb.AllowN(clock.Now(), 1) {
+			t.Error("second request should be queued, not admitted")
+		}
+
+		clock.Advance(100 * time.Millisecond)
+		if !lb.AllowN(clock.Now(), 1) {
+			t.Error("request should be admitted once the queue drained")
+		}
+	})
+
+	t.Run("queue spaces waiters by the rate", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(10), 5,
+			ratelimit.WithClock(clock), ratelimit.WithLeakyMode(ratelimit.LeakyQueue))
+
+		if err := lb.WaitN(context.Background(), 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- lb.WaitN(context.Background(), 1)
+		}()
+
+		clock.BlockUntil(1)
+		clock.Advance(99 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatal("WaitN returned before the request drained")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		clock.Advance(time.Millisecond)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("WaitN should return once the request drained")
+		}
+	})
+
+	t.Run("queue cancel gives up the place", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(10), 5,
+			ratelimit.WithClock(clock), ratelimit.WithLeakyMode(ratelimit.LeakyQueue))
+
+		lb.AllowN(clock.Now(), 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- lb.WaitN(ctx, 2)
+		}()
+
+		clock.BlockUntil(1)
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if level := lb.Level(); level != 1 {
+			t.Errorf("expected level 1 after cancel, got %v", level)
+		}
+	})
+}
+
 func TestConcurrency(t *testing.T) {
 	t.Run("token bucket concurrency", func(t *testing.T) {
 		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(100), 10)
@@ -310,6 +620,41 @@ func TestConcurrency(t *testing.T) {
 		}
 	})
 
+	t.Run("token bucket allows exactly the burst", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(3), 100, ratelimit.WithClock(clock))
+		tb.AllowN(clock.Now(), 0)
+
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if tb.AllowN(clock.Now(), 1) {
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if allowed.Load() != 100 {
+			t.Errorf("expected exactly 100 allowed, got %d", allowed.Load())
+		}
+
+		// Tokens taken without the lock are seen by locked operations
+		clock.Advance(time.Second)
+		if tokens := tb.Tokens(); tokens < 2.99 || tokens > 3 {
+			t.Errorf("expected 3 tokens after 1s, got %v", tokens)
+		}
+		tb.SetBurst(2)
+		if !tb.AllowN(clock.Now(), 2) || tb.AllowN(clock.Now(), 1) {
+			t.Error("expected the new burst of 2 to be allowed and then limited")
+		}
+	})
+
 	t.Run("leaky bucket concurrency", func(t *testing.T) {
 		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(100), 10)
 		const numGoroutines = 50
@@ -373,6 +718,43 @@ func TestZeroRate(t *testing.T) {
 	})
 }
 
+func TestTokenBucketWarmup(t *testing.T) {
+	clock := newTestClock(time.Unix(0, 0))
+	tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 10,
+		ratelimit.WithClock(clock), ratelimit.WithWarmup(10*time.Second))
+
+	t.Run("starts at a tenth of the burst", func(t *testing.T) {
+		if !tb.AllowN(clock.Now(), 1) {
+			t.Error("expected the first token to be allowed")
+		}
+		if tb.AllowN(clock.Now(), 1) {
+			t.Error("expected only a tenth of the burst at start")
+		}
+	})
+
+	t.Run("refills at the ramped rate", func(t *testing.T) {
+		// The rate ramps from 1/s to 1.9/s over the first second
+		clock.Advance(time.Second)
+		if got := tb.Tokens(); got < 1.449 || got > 1.451 {
+			t.Errorf("expected 1.45 tokens, got %v", got)
+		}
+	})
+
+	t.Run("full rate after warm-up", func(t *testing.T) {
+		clock.Advance(20 * time.Second)
+		if !tb.AllowN(clock.Now(), 10) {
+			t.Error("expected the full burst after warm-up")
+		}
+		clock.Advance(500 * time.Millisecond)
+		if !tb.AllowN(clock.Now(), 5) {
+			t.Error("expected 5 tokens after 500ms at the full rate")
+		}
+		if tb.AllowN(clock.Now(), 1) {
+			t.Error("expected an empty bucket")
+		}
+	})
+}
+
 func TestTokenBucketSetRate(t *testing.T) {
 	clock := newTestClock(time.Now())
 	tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 10, ratelimit.WithClock(clock))
@@ -446,6 +828,193 @@ func TestTokenBucketDrainTo(t *testing.T) {
 	}
 }
 
+func TestReturnN(t *testing.T) {
+	t.Run("token bucket", func(t *testing.T) {
+		clock := newTestClock(time.Now())
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 5, ratelimit.WithClock(clock))
+
+		if !tb.AllowN(clock.Now(), 5) {
+			t.Fatal("expected the burst to be allowed")
+		}
+		tb.ReturnN(2)
+		if tb.Tokens() != 2 {
+			t.Errorf("expected 2 tokens after refund, got %v", tb.Tokens())
+		}
+		if !tb.AllowN(clock.Now(), 2) {
+			t.Error("expected refunded tokens to be usable")
+		}
+
+		// Refunds never exceed the burst
+		tb.ReturnN(100)
+		if tb.Tokens() != 5 {
+			t.Errorf("expected 5 tokens (capped at burst), got %v", tb.Tokens())
+		}
+	})
+
+	t.Run("leaky bucket", func(t *testing.T) {
+		clock := newTestClock(time.Now())
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 5, ratelimit.WithClock(clock))
+
+		if !lb.AllowN(clock.Now(), 5) {
+			t.Fatal("expected the capacity to be allowed")
+		}
+		lb.ReturnN(3)
+		if lb.Level() != 2 {
+			t.Errorf("expected level 2 after refund, got %v", lb.Level())
+		}
+
+		// Refunds never take the level below empty
+		lb.ReturnN(100)
+		if lb.Level() != 0 {
+			t.Errorf("expected an empty bucket, got %v", lb.Level())
+		}
+	})
+}
+
+func TestWaitQueue(t *testing.T) {
+	// start queues WaitN callers one by one and returns the order in which
+	// they are served.
+	start := func(l ratelimit.Limiter, logger *queueLogger, ctxs ...context.Context) <-chan int {
+		order := make(chan int, len(ctxs))
+		for i, ctx := range ctxs {
+			go func() {
+				if err := l.WaitN(ctx, 1); err == nil {
+					order <- i
+				}
+			}()
+			<-logger.queued
+		}
+		return order
+	}
+	next := func(t *testing.T, order <-chan int, want int) {
+		t.Helper()
+		select {
+		case got := <-order:
+			if got != want {
+				t.Errorf("expected waiter %d to be served, got %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("waiter %d was not served", want)
+		}
+		select {
+		case got := <-order:
+			t.Errorf("expected one waiter per grant, waiter %d was also served", got)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	bg := context.Background()
+
+	t.Run("serves waiters in FIFO order", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 1,
+			ratelimit.WithClock(clock), ratelimit.WithLogger(logger))
+		tb.AllowN(clock.Now(), 1)
+
+		order := start(tb, logger, bg, bg, bg)
+		for i := 0; i < 3; i++ {
+			clock.Advance(time.Second)
+			next(t, order, i)
+		}
+	})
+
+	t.Run("serves waiters in LIFO order", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 1,
+			ratelimit.WithClock(clock), ratelimit.WithLogger(logger),
+			ratelimit.WithFairness(ratelimit.LIFO))
+		tb.AllowN(clock.Now(), 1)
+
+		order := start(tb, logger, bg, bg, bg)
+		for i := 2; i >= 0; i-- {
+			clock.Advance(time.Second)
+			next(t, order, i)
+		}
+	})
+
+	t.Run("canceled waiter gives up its turn", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 1,
+			ratelimit.WithClock(clock), ratelimit.WithLogger(logger))
+		tb.AllowN(clock.Now(), 1)
+
+		ctx, cancel := context.WithCancel(bg)
+		order := start(tb, logger, ctx, bg)
+		cancel()
+
+		clock.Advance(time.Second)
+		next(t, order, 1)
+	})
+
+	t.Run("AllowN does not jump the queue", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 2,
+			ratelimit.WithClock(clock), ratelimit.WithLogger(logger))
+		tb.AllowN(clock.Now(), 2)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- tb.WaitN(bg, 2)
+		}()
+		<-logger.queued
+
+		clock.Advance(time.Second)
+		if tb.AllowN(clock.Now(), 1) {
+			t.Error("AllowN should not take tokens owed to a queued waiter")
+		}
+
+		clock.Advance(time.Second)
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("refund wakes the next waiter", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerHour(1), 1,
+			ratelimit.WithClock(clock), ratelimit.WithLogger(logger))
+		tb.AllowN(clock.Now(), 1)
+
+		order := start(tb, logger, bg)
+		tb.ReturnN(1)
+		next(t, order, 0)
+	})
+
+	t.Run("leaky bucket serves waiters in FIFO order", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		logger := newQueueLogger()
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 1,
+			ratelimit.WithClock(clock), ratelimit.WithLogger(logger))
+		lb.AllowN(clock.Now(), 1)
+
+		order := start(lb, logger, bg, bg, bg)
+		for i := 0; i < 3; i++ {
+			clock.Advance(time.Second)
+			next(t, order, i)
+		}
+	})
+}
+
+// queueLogger signals every WaitN caller that joins a wait queue.
+type queueLogger struct {
+	observe.NopLogger
+	queued chan struct{}
+}
+
+func newQueueLogger() *queueLogger {
+	return &queueLogger{queued: make(chan struct{}, 16)}
+}
+
+func (l *queueLogger) Debug(msg string, kv ...any) {
+	if msg == "rate limiter waiting" || msg == "leaky bucket waiting" {
+		l.queued <- struct{}{}
+	}
+}
+
 func TestTokenBucketSetTemporaryLimit(t *testing.T) {
 	clock := newTestClock(time.Now())
 	tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(100), 10, ratelimit.WithClock(clock))
@@ -495,3 +1064,875 @@ func TestTokenBucketClearTemporaryLimit(t *testing.T) {
 		t.Errorf("expected burst 10, got %d", tb.Burst())
 	}
 }
+
+func TestLeakyBucketRuntimeChanges(t *testing.T) {
+	t.Run("set rate", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 10, ratelimit.WithClock(clock))
+		lb.AllowN(clock.Now(), 10)
+
+		lb.SetRate(ratelimit.PerSecond(4))
+		clock.Advance(time.Second)
+		if got := lb.Available(); got != 4 {
+			t.Errorf("expected 4 leaked at the new rate, got %d", got)
+		}
+	})
+
+	t.Run("set capacity", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 10, ratelimit.WithClock(clock))
+		lb.AllowN(clock.Now(), 4)
+
+		lb.SetCapacity(3)
+		if lb.AllowN(clock.Now(), 1) {
+			t.Error("expected no room while the level is above the new capacity")
+		}
+		clock.Advance(2 * time.Second)
+		if !lb.AllowN(clock.Now(), 1) {
+			t.Error("expected room once the level leaked below the capacity")
+		}
+	})
+
+	t.Run("drain to", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 10, ratelimit.WithClock(clock))
+
+		lb.DrainTo(7)
+		if got := lb.Level(); got != 7 {
+			t.Errorf("expected level 7, got %v", got)
+		}
+		lb.DrainTo(100)
+		if got := lb.Level(); got != 10 {
+			t.Errorf("expected level capped at capacity, got %v", got)
+		}
+		lb.DrainTo(-1)
+		if got := lb.Level(); got != 0 {
+			t.Errorf("expected an empty bucket, got %v", got)
+		}
+	})
+
+	t.Run("temporary limit", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(100), 10, ratelimit.WithClock(clock))
+
+		lb.SetTemporaryLimit(ratelimit.PerSecond(1), 2, time.Minute)
+		if lb.Rate().TokensPerSec != 1 || lb.Capacity() != 2 {
+			t.Errorf("expected the temporary limit, got %v and %d", lb.Rate(), lb.Capacity())
+		}
+
+		clock.Advance(time.Minute)
+		time.Sleep(10 * time.Millisecond) // Let timer goroutine run
+		if lb.Rate().TokensPerSec != 100 || lb.Capacity() != 10 {
+			t.Errorf("expected the original limit restored, got %v and %d", lb.Rate(), lb.Capacity())
+		}
+
+		lb.SetTemporaryLimit(ratelimit.PerSecond(1), 2, time.Minute)
+		lb.ClearTemporaryLimit()
+		if lb.Rate().TokensPerSec != 100 || lb.Capacity() != 10 {
+			t.Errorf("expected the original limit after clearing, got %v and %d", lb.Rate(), lb.Capacity())
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("token bucket", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(2), 4, ratelimit.WithName("api"), ratelimit.WithClock(clock))
+
+		tb.AllowN(clock.Now(), 3)
+		tb.AllowN(clock.Now(), 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		tb.WaitN(ctx, 2)
+		clock.Advance(500 * time.Millisecond)
+
+		snap := tb.Snapshot()
+		if snap.Name != "api" || snap.Burst != 4 || snap.Rate.TokensPerSec != 2 {
+			t.Errorf("unexpected config in snapshot: %+v", snap)
+		}
+		if snap.Tokens != 2 {
+			t.Errorf("expected 2 tokens after refill, got %v", snap.Tokens)
+		}
+		// A WaitN call that has to wait is denied once before it queues
+		if snap.Allowed != 1 || snap.Denied != 2 || snap.Canceled != 1 {
+			t.Errorf("expected 1 allowed, 2 denied and 1 canceled, got %d, %d, %d", snap.Allowed, snap.Denied, snap.Canceled)
+		}
+		if !snap.LastRefill.Equal(clock.Now()) {
+			t.Errorf("expected last refill at %v, got %v", clock.Now(), snap.LastRefill)
+		}
+	})
+
+	t.Run("leaky bucket", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 5, ratelimit.WithClock(clock))
+
+		lb.AllowN(clock.Now(), 4)
+		lb.AllowN(clock.Now(), 2)
+		lb.SetTemporaryLimit(ratelimit.PerSecond(2), 5, time.Minute)
+		clock.Advance(time.Second)
+
+		snap := lb.Snapshot()
+		if snap.Level != 2 {
+			t.Errorf("expected level 2 after leaking, got %v", snap.Level)
+		}
+		if snap.Capacity != 5 || snap.Rate.TokensPerSec != 2 || !snap.TemporaryLimit {
+			t.Errorf("expected the temporary limit in snapshot, got %+v", snap)
+		}
+		if snap.Allowed != 1 || snap.Denied != 1 {
+			t.Errorf("expected 1 allowed and 1 denied, got %d, %d", snap.Allowed, snap.Denied)
+		}
+	})
+}
+
+func TestExportRestore(t *testing.T) {
+	t.Run("token bucket", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		tb := ratelimit.NewTokenBucket(ratelimit.PerSecond(2), 10, ratelimit.WithClock(clock))
+		tb.AllowN(clock.Now(), 9)
+		state := tb.Export()
+
+		// A restarted bucket keeps the drained tokens, refilled for the downtime
+		clock.Advance(time.Second)
+		restored := ratelimit.NewTokenBucket(ratelimit.PerSecond(2), 10, ratelimit.WithClock(clock))
+		restored.Restore(state)
+		if got := restored.Tokens(); got != 3 {
+			t.Errorf("expected 3 tokens after restore, got %v", got)
+		}
+		if restored.AllowN(clock.Now(), 4) {
+			t.Error("expected the restored bucket not to grant a fresh burst")
+		}
+	})
+
+	t.Run("leaky bucket", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		lb := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 5, ratelimit.WithClock(clock))
+		lb.AllowN(clock.Now(), 5)
+		state := lb.Export()
+
+		clock.Advance(2 * time.Second)
+		restored := ratelimit.NewLeakyBucket(ratelimit.PerSecond(1), 4, ratelimit.WithClock(clock))
+		restored.Restore(state)
+		// The level is capped to the new capacity, then leaked
+		if got := restored.Snapshot().Level; got != 2 {
+			t.Errorf("expected level 2 after restore, got %v", got)
+		}
+	})
+}
+
+func TestCompose(t *testing.T) {
+	t.Run("all is all or nothing", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		user := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clock))
+		global := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 5, ratelimit.WithClock(clock))
+		l := ratelimit.Chain(user, global)
+
+		if !l.AllowN(clock.Now(), 1) {
+			t.Fatal("expected the first event to be allowed")
+		}
+		if l.AllowN(clock.Now(), 1) {
+			t.Fatal("expected the user limiter to deny the second event")
+		}
+		if got := global.Tokens(); got != 4 {
+			t.Errorf("expected the global limiter untouched by the denial, got %v tokens", got)
+		}
+
+		other := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clock))
+		global.DrainTo(0)
+		if ratelimit.All(other, global).AllowN(clock.Now(), 1) {
+			t.Fatal("expected the global limiter to deny")
+		}
+		if got := other.Tokens(); got != 1 {
+			t.Errorf("expected the user limiter untouched by the denial, got %v tokens", got)
+		}
+	})
+
+	t.Run("all refunds on failed wait", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		user := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clock))
+		global := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clock))
+		global.DrainTo(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- ratelimit.All(user, global).WaitN(ctx, 1)
+		}()
+		clock.BlockUntil(1)
+		cancel()
+
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if got := user.Tokens(); got != 1 {
+			t.Errorf("expected the user token to be returned, got %v tokens", got)
+		}
+	})
+
+	t.Run("any", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		quota := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 1, ratelimit.WithClock(clock))
+		overflow := ratelimit.NewTokenBucket(ratelimit.Per(1, 10*time.Second), 1, ratelimit.WithClock(clock))
+		l := ratelimit.Any(quota, overflow)
+
+		if !l.AllowN(clock.Now(), 1) || !l.AllowN(clock.Now(), 1) {
+			t.Fatal("expected the quota and then the overflow to allow")
+		}
+		if l.AllowN(clock.Now(), 1) {
+			t.Fatal("expected both limiters to be empty")
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- l.WaitN(context.Background(), 1)
+		}()
+		clock.BlockUntil(2)
+		clock.Advance(time.Second)
+
+		if err := <-done; err != nil {
+			t.Fatalf("expected the quota to grant, got %v", err)
+		}
+		if got := overflow.Tokens(); got < 0.09 || got > 0.11 {
+			t.Errorf("expected the overflow limiter untouched, got %v tokens", got)
+		}
+	})
+}
+
+// captureLogger records the messages and fields of warnings.
+type captureLogger struct {
+	observe.NopLogger
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *captureLogger) Warn(msg string, kv ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, fmt.Sprint(msg, kv))
+}
+
+func (l *captureLogger) Entries() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.entries...)
+}
+
+func TestThrottledLogger(t *testing.T) {
+	t.Run("throttles per key", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		base := &captureLogger{}
+		logger := ratelimit.NewThrottledLogger(base, ratelimit.Per(1, 10*time.Second), 1,
+			ratelimit.WithClock(clk),
+			ratelimit.WithThrottleKeys("name"),
+		)
+
+		for i := 0; i < 5; i++ {
+			logger.Warn("circuit open", "name", "payments", "attempt", i)
+		}
+		logger.Warn("circuit open", "name", "search")
+
+		if got := logger.Suppressed("circuit open", "name", "payments"); got != 4 {
+			t.Errorf("expected 4 suppressed messages, got %d", got)
+		}
+
+		clk.Advance(10 * time.Second)
+		logger.Warn("circuit open", "name", "payments", "attempt", 5)
+
+		want := []string{
+			"circuit open[name payments attempt 0]",
+			"circuit open[name search]",
+			"circuit open[name payments attempt 5 suppressed 4]",
+		}
+		if got := base.Entries(); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("keys on message by default", func(t *testing.T) {
+		clk := newTestClock(time.Unix(0, 0))
+		base := &captureLogger{}
+		logger := ratelimit.NewThrottledLogger(base, ratelimit.Per(1, time.Second), 2,
+			ratelimit.WithClock(clk))
+
+		logger.Warn("a", "name", "x")
+		logger.Warn("a", "name", "y")
+		logger.Warn("a", "name", "z")
+		logger.Warn("b")
+
+		if got := len(base.Entries()); got != 3 {
+			t.Errorf("expected 3 entries within the burst, got %d", got)
+		}
+	})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Run("limit per window", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sw := ratelimit.NewSlidingWindow(ratelimit.PerSecond(10), time.Second, ratelimit.WithClock(clock))
+
+		if sw.Limit() != 10 {
+			t.Fatalf("expected limit 10, got %d", sw.Limit())
+		}
+		if !sw.AllowN(clock.Now(), 10) {
+			t.Error("expected the full limit to be allowed")
+		}
+		if sw.AllowN(clock.Now(), 1) {
+			t.Error("expected request over the limit to be denied")
+		}
+	})
+
+	t.Run("no double burst at window boundary", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sw := ratelimit.NewSlidingWindow(ratelimit.PerSecond(10), time.Second, ratelimit.WithClock(clock))
+
+		sw.AllowN(clock.Now(), 1)
+		clock.Advance(900 * time.Millisecond)
+		if !sw.AllowN(clock.Now(), 9) {
+			t.Fatal("expected late burst to be allowed")
+		}
+
+		// 100ms into the next window, 90% of the previous one still counts
+		clock.Advance(200 * time.Millisecond)
+		if !sw.AllowN(clock.Now(), 1) {
+			t.Error("expected one request to fit")
+		}
+		if sw.AllowN(clock.Now(), 1) {
+			t.Error("expected a second burst at the boundary to be denied")
+		}
+
+		// 600ms in, 40% of the previous window counts: 4 + 1 used
+		clock.Advance(500 * time.Millisecond)
+		if got := sw.Remaining(); got != 5 {
+			t.Errorf("expected 5 remaining, got %d", got)
+		}
+	})
+
+	t.Run("wait for window to slide", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sw := ratelimit.NewSlidingWindow(ratelimit.PerSecond(10), time.Second, ratelimit.WithClock(clock))
+		sw.AllowN(clock.Now(), 10)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- sw.WaitN(context.Background(), 1)
+		}()
+
+		// The window rolls over after 1s, then 10% of it must slide out
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		select {
+		case <-done:
+			t.Fatal("WaitN returned before the window slid")
+		default:
+		}
+		clock.Advance(100 * time.Millisecond)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("WaitN should have completed")
+		}
+	})
+
+	t.Run("request exceeds limit", func(t *testing.T) {
+		sw := ratelimit.NewSlidingWindow(ratelimit.PerSecond(10), time.Second)
+		if err := sw.WaitN(context.Background(), 11); err == nil {
+			t.Error("expected error for request exceeding the window limit")
+		}
+	})
+
+	t.Run("panics without room for a request", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for a rate allowing no requests per window")
+			}
+		}()
+		ratelimit.NewSlidingWindow(ratelimit.PerMinute(1), time.Second)
+	})
+}
+
+func TestSlidingLog(t *testing.T) {
+	t.Run("exact limit per window", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sl := ratelimit.NewSlidingLog(ratelimit.PerSecond(10), time.Second, ratelimit.WithClock(clock))
+
+		sl.AllowN(clock.Now(), 1)
+		clock.Advance(900 * time.Millisecond)
+		if !sl.AllowN(clock.Now(), 9) {
+			t.Fatal("expected late burst to be allowed")
+		}
+
+		// Only the first grant has left the window
+		clock.Advance(100 * time.Millisecond)
+		if !sl.AllowN(clock.Now(), 1) {
+			t.Error("expected the expired request's room to be reused")
+		}
+		if sl.AllowN(clock.Now(), 1) {
+			t.Error("expected the window to be full")
+		}
+		if got := sl.Remaining(); got != 0 {
+			t.Errorf("expected 0 remaining, got %d", got)
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sl := ratelimit.NewSlidingLog(ratelimit.PerSecond(2), time.Second, ratelimit.WithClock(clock))
+
+		for range 4 {
+			sl.AllowN(clock.Now(), 1)
+			clock.Advance(500 * time.Millisecond)
+		}
+
+		got := sl.History(1500 * time.Millisecond)
+		want := []ratelimit.Grant{
+			{Time: time.Unix(1, 0), N: 1},
+			{Time: time.Unix(1, 5e8), N: 1},
+		}
+		if len(got) != len(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		for i := range want {
+			if !got[i].Time.Equal(want[i].Time) || got[i].N != want[i].N {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		}
+
+		// Grants past the window are kept until their room is needed
+		if all := sl.History(time.Minute); len(all) != 2 {
+			t.Errorf("expected the 2 grants the log has room for, got %v", all)
+		}
+	})
+
+	t.Run("wait for oldest grant to expire", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sl := ratelimit.NewSlidingLog(ratelimit.PerSecond(2), time.Second, ratelimit.WithClock(clock))
+		sl.AllowN(clock.Now(), 1)
+		clock.Advance(400 * time.Millisecond)
+		sl.AllowN(clock.Now(), 1)
+
+		d := sl.AllowNWithInfo(clock.Now(), 1)
+		if d.Allowed || d.RetryAfter != 600*time.Millisecond {
+			t.Errorf("expected a 600ms retry after, got %+v", d)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- sl.WaitN(context.Background(), 1)
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(600 * time.Millisecond)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("WaitN should have completed")
+		}
+	})
+
+	t.Run("shrinking the limit keeps grants in the window", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sl := ratelimit.NewSlidingLog(ratelimit.PerSecond(4), time.Second, ratelimit.WithClock(clock))
+		sl.AllowN(clock.Now(), 1)
+		sl.AllowN(clock.Now(), 1)
+		sl.AllowN(clock.Now(), 1)
+
+		sl.SetBurst(2)
+		if sl.AllowN(clock.Now(), 1) {
+			t.Error("expected the window to be over the new limit")
+		}
+		if got := len(sl.History(time.Second)); got != 3 {
+			t.Errorf("expected 3 grants kept, got %d", got)
+		}
+
+		clock.Advance(time.Second)
+		if !sl.AllowN(clock.Now(), 2) {
+			t.Error("expected the new limit once the window slid")
+		}
+	})
+}
+
+func TestFairShareGroup(t *testing.T) {
+	newGroup := func(clock ratelimit.Clock) *ratelimit.FairShareGroup {
+		return ratelimit.NewFairShareGroup(ratelimit.PerSecond(4), 4, map[string]float64{
+			"interactive": 3,
+			"background":  1,
+		}, ratelimit.WithClock(clock))
+	}
+
+	t.Run("borrows unused capacity", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		background := newGroup(clock).Consumer("background")
+
+		if !background.AllowN(clock.Now(), 1) {
+			t.Fatal("expected the background reserve to be available")
+		}
+		if background.AllowN(clock.Now(), 1) {
+			t.Error("expected the interactive reserve to be held back")
+		}
+
+		// While interactive traffic is idle, background runs at the full rate
+		for i := range 8 {
+			clock.Advance(250 * time.Millisecond)
+			if !background.AllowN(clock.Now(), 1) {
+				t.Fatalf("expected request %d to borrow the idle share", i)
+			}
+		}
+	})
+
+	t.Run("guarantees shares under contention", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		group := newGroup(clock)
+		interactive, background := group.Consumer("interactive"), group.Consumer("background")
+		interactive.AllowN(clock.Now(), 3)
+		background.AllowN(clock.Now(), 1)
+
+		var gotInteractive, gotBackground int
+		for range 16 {
+			clock.Advance(250 * time.Millisecond)
+			for interactive.AllowN(clock.Now(), 1) {
+				gotInteractive++
+			}
+			for background.AllowN(clock.Now(), 1) {
+				gotBackground++
+			}
+		}
+		if gotInteractive != 12 || gotBackground != 4 {
+			t.Errorf("expected 12 interactive and 4 background requests, got %d and %d",
+				gotInteractive, gotBackground)
+		}
+	})
+
+	t.Run("wait for tokens", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		background := newGroup(clock).Consumer("background")
+		background.AllowN(clock.Now(), 1)
+
+		d := background.AllowNWithInfo(clock.Now(), 1)
+		if d.Allowed || d.Limit != 1 || d.RetryAfter != 250*time.Millisecond {
+			t.Errorf("expected a 250ms retry after with limit 1, got %+v", d)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- background.WaitN(context.Background(), 1)
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(250 * time.Millisecond)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("WaitN should have completed")
+		}
+	})
+
+	t.Run("request exceeds share of burst", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		err := newGroup(clock).Consumer("background").WaitN(context.Background(), 2)
+		var rlErr *ratelimit.RateLimitError
+		if !errors.As(err, &rlErr) || rlErr.Limit != 1 {
+			t.Errorf("expected a RateLimitError with limit 1, got %v", err)
+		}
+	})
+
+	t.Run("panics on unknown consumer", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for an unknown consumer")
+			}
+		}()
+		newGroup(newTestClock(time.Unix(0, 0))).Consumer("batch")
+	})
+}
+
+func TestAdjustable(t *testing.T) {
+	limiters := map[string]func(ratelimit.Clock) ratelimit.Limiter{
+		"token bucket": func(clk ratelimit.Clock) ratelimit.Limiter {
+			return ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clk))
+		},
+		"leaky bucket": func(clk ratelimit.Clock) ratelimit.Limiter {
+			return ratelimit.NewLeakyBucket(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clk))
+		},
+		"gcra": func(clk ratelimit.Clock) ratelimit.Limiter {
+			return ratelimit.NewGCRA(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clk))
+		},
+		"sliding window": func(clk ratelimit.Clock) ratelimit.Limiter {
+			return ratelimit.NewSlidingWindow(ratelimit.PerMinute(1), time.Minute, ratelimit.WithClock(clk))
+		},
+		"sliding log": func(clk ratelimit.Clock) ratelimit.Limiter {
+			return ratelimit.NewSlidingLog(ratelimit.PerMinute(1), time.Minute, ratelimit.WithClock(clk))
+		},
+	}
+
+	for name, newLimiter := range limiters {
+		t.Run(name+" set rate", func(t *testing.T) {
+			clock := newTestClock(time.Unix(0, 0))
+			l := newLimiter(clock)
+			a, ok := l.(ratelimit.Adjustable)
+			if !ok {
+				t.Fatal("expected limiter to implement Adjustable")
+			}
+
+			l.AllowN(clock.Now(), 1)
+			if l.AllowN(clock.Now(), 1) {
+				t.Fatal("expected the limiter to be exhausted")
+			}
+			a.SetRate(ratelimit.PerSecond(10))
+			clock.Advance(100 * time.Millisecond)
+			if !l.AllowN(clock.Now(), 1) {
+				t.Error("expected a request after 100ms at the new rate")
+			}
+		})
+	}
+
+	t.Run("gcra set burst", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		g := ratelimit.NewGCRA(ratelimit.PerMinute(1), 1, ratelimit.WithClock(clock))
+		g.AllowN(clock.Now(), 1)
+
+		g.SetBurst(3)
+		if !g.AllowN(clock.Now(), 2) {
+			t.Error("expected the raised burst to be allowed")
+		}
+		if g.AllowN(clock.Now(), 1) {
+			t.Error("expected the raised burst to be spent")
+		}
+	})
+
+	t.Run("sliding window set burst", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		sw := ratelimit.NewSlidingWindow(ratelimit.PerMinute(1), time.Minute, ratelimit.WithClock(clock))
+		sw.AllowN(clock.Now(), 1)
+
+		sw.SetBurst(3)
+		if sw.Limit() != 3 || sw.Rate() != ratelimit.PerMinute(3) {
+			t.Errorf("expected a limit of 3 per minute, got %d at %v", sw.Limit(), sw.Rate())
+		}
+		if !sw.AllowN(clock.Now(), 2) {
+			t.Error("expected the raised limit to be allowed")
+		}
+	})
+}
+
+func TestGCRA(t *testing.T) {
+	t.Run("burst then rate", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		g := ratelimit.NewGCRA(ratelimit.PerSecond(10), 3, ratelimit.WithClock(clock))
+
+		if g.EmissionInterval() != 100*time.Millisecond {
+			t.Fatalf("expected 100ms emission interval, got %v", g.EmissionInterval())
+		}
+		if !g.AllowN(clock.Now(), 3) {
+			t.Error("expected the burst to be allowed")
+		}
+		if g.AllowN(clock.Now(), 1) {
+			t.Error("expected request over the burst to be denied")
+		}
+
+		clock.Advance(99 * time.Millisecond)
+		if g.AllowN(clock.Now(), 1) {
+			t.Error("expected request before one emission interval to be denied")
+		}
+		clock.Advance(time.Millisecond)
+		if !g.AllowN(clock.Now(), 1) {
+			t.Error("expected request after one emission interval to be allowed")
+		}
+
+		clock.Advance(time.Second)
+		if got := g.Remaining(); got != 3 {
+			t.Errorf("expected the full burst to be restored, got %d", got)
+		}
+	})
+
+	t.Run("no drift at high rates", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		g := ratelimit.NewGCRA(ratelimit.PerSecond(1_000_000), 1, ratelimit.WithClock(clock))
+
+		allowed := 0
+		for range 1_000_000 {
+			if g.AllowN(clock.Now(), 1) {
+				allowed++
+			}
+			clock.Advance(time.Microsecond)
+		}
+		if allowed != 1_000_000 {
+			t.Errorf("expected every paced request to be allowed, got %d", allowed)
+		}
+	})
+
+	t.Run("waiters are paced", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		g := ratelimit.NewGCRA(ratelimit.PerSecond(10), 1, ratelimit.WithClock(clock))
+		g.AllowN(clock.Now(), 1)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- g.WaitN(context.Background(), 1)
+		}()
+
+		clock.BlockUntil(1)
+		clock.Advance(100 * time.Millisecond)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("WaitN should have completed")
+		}
+	})
+
+	t.Run("request exceeds burst", func(t *testing.T) {
+		g := ratelimit.NewGCRA(ratelimit.PerSecond(10), 2)
+		if err := g.WaitN(context.Background(), 3); err == nil {
+			t.Error("expected error for request exceeding burst")
+		}
+	})
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	newBucket := func(string) ratelimit.Limiter {
+		return ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1)
+	}
+
+	t.Run("one limiter per key", func(t *testing.T) {
+		kl := ratelimit.NewKeyedLimiter(newBucket)
+
+		if !kl.AllowKey("a", 1) || !kl.AllowKey("b", 1) {
+			t.Error("expected the first request of each key to be allowed")
+		}
+		if kl.AllowKey("a", 1) {
+			t.Error("expected the second request of a key to be denied")
+		}
+		if kl.Limiter("a") != kl.Limiter("a") {
+			t.Error("expected the same limiter for the same key")
+		}
+		if err := kl.WaitKey(context.Background(), "c", 1); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("LRU eviction", func(t *testing.T) {
+		rec := sim.NewRecorder()
+		kl := ratelimit.NewKeyedLimiter(newBucket, ratelimit.WithName("clients"),
+			ratelimit.WithMaxKeys(2), ratelimit.WithMetrics(rec))
+
+		kl.AllowKey("a", 1)
+		kl.AllowKey("b", 1)
+		kl.Limiter("a") // a is now more recently used than b
+		kl.AllowKey("c", 1)
+
+		if kl.Len() != 2 {
+			t.Errorf("expected 2 keys, got %d", kl.Len())
+		}
+		if kl.AllowKey("a", 1) {
+			t.Error("expected a to be kept with its exhausted limiter")
+		}
+		if got := rec.Count("ion_ratelimit_key_evictions_total", "limiter_name", "clients", "reason", "capacity"); got != 1 {
+			t.Errorf("expected b to be the only eviction, got %v", got)
+		}
+		if got, _ := rec.GaugeValue("ion_ratelimit_active_keys", "limiter_name", "clients"); got != 2 {
+			t.Errorf("expected 2 active keys, got %v", got)
+		}
+	})
+
+	t.Run("TTL eviction", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		kl := ratelimit.NewKeyedLimiter(newBucket, ratelimit.WithClock(clock),
+			ratelimit.WithKeyTTL(time.Minute))
+
+		kl.AllowKey("a", 1)
+		clock.Advance(30 * time.Second)
+		kl.AllowKey("b", 1)
+		clock.Advance(45 * time.Second)
+
+		if kl.Len() != 1 {
+			t.Errorf("expected only b to remain, got %d keys", kl.Len())
+		}
+		if !kl.AllowKey("a", 1) {
+			t.Error("expected an expired key to start over with a fresh limiter")
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		kl := ratelimit.NewKeyedLimiter(newBucket)
+		kl.AllowKey("a", 1)
+		kl.Remove("a")
+		if kl.Len() != 0 || !kl.AllowKey("a", 1) {
+			t.Error("expected a removed key to start over")
+		}
+	})
+}
+
+// failingStore is a Store that is always unreachable.
+type failingStore struct{}
+
+func (failingStore) TakeN(context.Context, string, ratelimit.Rate, int, int, time.Time) (ratelimit.StoreResult, error) {
+	return ratelimit.StoreResult{}, errors.New("connection refused")
+}
+
+func TestStore(t *testing.T) {
+	t.Run("instances share one bucket", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		store := ratelimit.NewMemoryStore()
+		a := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 2,
+			ratelimit.WithName("api"), ratelimit.WithStore(store), ratelimit.WithClock(clock))
+		b := ratelimit.NewTokenBucket(ratelimit.PerSecond(1), 2,
+			ratelimit.WithName("api"), ratelimit.WithStore(store), ratelimit.WithClock(clock))
+
+		if !a.AllowN(clock.Now(), 1) || !b.AllowN(clock.Now(), 1) {
+			t.Fatal("expected the shared burst to be allowed")
+		}
+		if a.AllowN(clock.Now(), 1) || b.AllowN(clock.Now(), 1) {
+			t.Error("expected the shared bucket to be empty")
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- b.WaitN(context.Background(), 1)
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("WaitN should have completed")
+		}
+		if a.AllowN(clock.Now(), 1) {
+			t.Error("expected the refilled token to have gone to the waiter")
+		}
+	})
+
+	t.Run("falls back to local limiting", func(t *testing.T) {
+		clock := newTestClock(time.Unix(0, 0))
+		rec := sim.NewRecorder()
+		tb := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 2, ratelimit.WithName("api"),
+			ratelimit.WithStore(failingStore{}), ratelimit.WithClock(clock), ratelimit.WithMetrics(rec))
+
+		if !tb.AllowN(clock.Now(), 2) {
+			t.Error("expected the local burst to be allowed")
+		}
+		if tb.AllowN(clock.Now(), 1) {
+			t.Error("expected the local bucket to limit")
+		}
+		if err := tb.WaitN(context.Background(), 3); err == nil {
+			t.Error("expected error for request exceeding burst")
+		}
+		if got := rec.Count("ion_ratelimit_store_errors_total", "limiter_name", "api"); got != 2 {
+			t.Errorf("expected 2 store errors, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+// Package redisstore provides a Redis backed ratelimit.Store, so that token
+// buckets in several service instances enforce one shared limit. Each take
+// runs as a Lua script, refilling and consuming the bucket atomically on the
+// server. It is a separate module so that the core ion module does not
+// depend on a Redis client.
+//
+// Usage:
+//
+//	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	limiter := ratelimit.NewTokenBucket(ratelimit.PerSecond(100), 200,
+//		ratelimit.WithName("partner-api"),
+//		ratelimit.WithStore(redisstore.New(client)),
+//	)
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a token bucket stored as a hash of
+// tokens and the time of the last refill in microseconds. It returns
+// whether the tokens were taken, the tokens left as a string, to keep the
+// fraction, and the microseconds until n tokens are available, or -1 if
+// the rate is zero. Idle buckets expire once they would have refilled.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) / 1e6 * rate)
+	ts = now
+end
+
+local allowed = 0
+local retry = 0
+if n <= tokens then
+	tokens = tokens - n
+	allowed = 1
+elseif rate > 0 then
+	retry = math.ceil((n - tokens) / rate * 1e6)
+else
+	retry = -1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+if rate > 0 then
+	redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+end
+
+return {allowed, tostring(tokens), retry}
+`)
+
+// Store is a ratelimit.Store that keeps token buckets in Redis.
+type Store struct {
+	client redis.Scripter
+	prefix string
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithPrefix sets the prefix of the Redis keys that hold buckets. The
+// default is "ion:ratelimit:".
+func WithPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// New creates a store that runs its script on client, which may be a
+// *redis.Client, *redis.ClusterClient or *redis.Ring. Client timeouts bound
+// how long a limiter waits for Redis before falling back to local limiting.
+func New(client redis.Scripter, opts ...Option) *Store {
+	s := &Store{
+		client: client,
+		prefix: "ion:ratelimit:",
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// TakeN implements ratelimit.Store.TakeN
+func (s *Store) TakeN(ctx context.Context, key string, rate ratelimit.Rate, burst, n int, now time.Time) (ratelimit.StoreResult, error) {
+	res, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		rate.TokensPerSec, burst, n, now.UnixMicro()).Slice()
+	if err != nil {
+		return ratelimit.StoreResult{}, err
+	}
+	if len(res) != 3 {
+		return ratelimit.StoreResult{}, fmt.Errorf("redisstore: unexpected script result %v", res)
+	}
+
+	allowed, _ := res[0].(int64)
+	retry, _ := res[2].(int64)
+	tokens, _ := res[1].(string)
+	remaining, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return ratelimit.StoreResult{}, fmt.Errorf("redisstore: parse remaining tokens: %w", err)
+	}
+
+	result := ratelimit.StoreResult{
+		Allowed:    allowed == 1,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(retry) * time.Microsecond,
+	}
+	if retry < 0 {
+		result.RetryAfter = -1
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package redisstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/ratelimit/redisstore"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStore(t *testing.T) {
+	t.Run("instances share one bucket", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		store := redisstore.New(redis.NewClient(&redis.Options{Addr: srv.Addr()}))
+		clk := clock.NewFake(time.Unix(1_700_000_000, 0))
+
+		newBucket := func() *ratelimit.TokenBucket {
+			return ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 2,
+				ratelimit.WithName("partner-api"), ratelimit.WithStore(store), ratelimit.WithClock(clk))
+		}
+		a, b := newBucket(), newBucket()
+
+		if !a.AllowN(clk.Now(), 1) || !b.AllowN(clk.Now(), 1) {
+			t.Fatal("expected the shared burst to be allowed")
+		}
+		if a.AllowN(clk.Now(), 1) {
+			t.Error("expected the shared bucket to be empty")
+		}
+		if !srv.Exists("ion:ratelimit:partner-api") {
+			t.Error("expected the bucket under the prefixed limiter name")
+		}
+
+		clk.Advance(100 * time.Millisecond)
+		if !b.AllowN(clk.Now(), 1) {
+			t.Error("expected one token after 100ms at 10/s")
+		}
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		store := redisstore.New(redis.NewClient(&redis.Options{Addr: srv.Addr()}), redisstore.WithPrefix("test:"))
+		now := time.Unix(1_700_000_000, 0)
+
+		res, err := store.TakeN(context.Background(), "k", ratelimit.PerSecond(4), 1, 1, now)
+		if err != nil || !res.Allowed || res.Remaining != 0 {
+			t.Fatalf("expected first take to be allowed, got %+v, %v", res, err)
+		}
+		res, err = store.TakeN(context.Background(), "k", ratelimit.PerSecond(4), 1, 1, now.Add(100*time.Millisecond))
+		if err != nil || res.Allowed {
+			t.Fatalf("expected second take to be denied, got %+v, %v", res, err)
+		}
+		if res.RetryAfter != 150*time.Millisecond {
+			t.Errorf("expected 150ms retry after, got %v", res.RetryAfter)
+		}
+		if res.Remaining != 0.4 {
+			t.Errorf("expected 0.4 tokens left, got %v", res.Remaining)
+		}
+	})
+
+	t.Run("falls back when unreachable", func(t *testing.T) {
+		srv := miniredis.RunT(t)
+		store := redisstore.New(redis.NewClient(&redis.Options{Addr: srv.Addr(), MaxRetries: -1}))
+		srv.Close()
+
+		tb := ratelimit.NewTokenBucket(ratelimit.PerMinute(1), 1,
+			ratelimit.WithName("partner-api"), ratelimit.WithStore(store))
+		if !tb.AllowN(time.Now(), 1) {
+			t.Error("expected the local bucket to allow its burst")
+		}
+		if tb.AllowN(time.Now(), 1) {
+			t.Error("expected the local bucket to limit")
+		}
+	})
+}
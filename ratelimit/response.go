@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRateLimitBody bounds how much of a 429 response body is read for retry
+// information.
+const maxRateLimitBody = 64 << 10
+
+// rateLimitBody holds the retry fields commonly found in the JSON body of
+// 429 responses. Some APIs nest them under "error".
+type rateLimitBody struct {
+	RetryAfter      *float64       `json:"retry_after"`    // seconds, e.g. Discord
+	RetryAfterMs    *float64       `json:"retry_after_ms"` // milliseconds
+	RetryAfterCamel *float64       `json:"retryAfter"`     // seconds
+	Global          bool           `json:"global"`
+	Error           *rateLimitBody `json:"error"`
+}
+
+// retryAfter returns the retry delay found in the body, if any.
+func (b *rateLimitBody) retryAfter() (time.Duration, bool) {
+	switch {
+	case b.RetryAfter != nil:
+		return secondsToDuration(*b.RetryAfter), true
+	case b.RetryAfterMs != nil:
+		return time.Duration(*b.RetryAfterMs * float64(time.Millisecond)), true
+	case b.RetryAfterCamel != nil:
+		return secondsToDuration(*b.RetryAfterCamel), true
+	case b.Error != nil:
+		return b.Error.retryAfter()
+	}
+	return 0, false
+}
+
+func (b *rateLimitBody) global() bool {
+	return b.Global || (b.Error != nil && b.Error.global())
+}
+
+// UpdateFromResponse updates the limiter from an API response. Rate limit
+// headers are processed as by UpdateRateLimitFromHeaders. For 429 responses
+// the retry delay is also taken from the JSON body (retry_after,
+// retry_after_ms or retryAfter, at the top level or under "error"), falling
+// back to the reset time reported by the header scheme when no requests are
+// left, then to the Retry-After header. A global limit, flagged by a "global"
+// body field or by the header scheme, pauses the whole limiter with
+// PauseUntil; any other 429 holds back the route of the request until the
+// delay has passed.
+//
+// req identifies the route and may be nil, in which case it is derived from
+// the method and path of resp.Request. The body is left readable for the
+// caller.
+func (mtl *MultiTierLimiter) UpdateFromResponse(req *Request, resp *http.Response) error {
+	if resp == nil {
+		return nil
+	}
+	if req == nil {
+		req = &Request{}
+		if resp.Request != nil {
+			req.Method = resp.Request.Method
+			if resp.Request.URL != nil {
+				req.Endpoint = resp.Request.URL.Path
+			}
+		}
+	}
+
+	info := mtl.applyHeaders(req, resp.Header)
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	var body rateLimitBody
+	if resp.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxRateLimitBody))
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		if err != nil {
+			return fmt.Errorf("ratelimit: reading 429 response body: %w", err)
+		}
+		// Bodies that are not JSON, or not in a known format, carry no
+		// retry information; the headers still apply.
+		_ = json.Unmarshal(data, &body)
+	}
+
+	retryAfter, ok := body.retryAfter()
+	if !ok && info.ResetAfter > 0 && info.Remaining <= 0 {
+		retryAfter, ok = info.ResetAfter, true
+	}
+	if !ok {
+		retryAfter, ok = headerRetryAfter(resp.Header, mtl.cfg.clock.Now())
+	}
+	if !ok || retryAfter <= 0 {
+		mtl.cfg.obs.Logger.Debug("rate limited without a retry delay",
+			"limiter_name", mtl.cfg.name,
+			"endpoint", req.Endpoint,
+		)
+		return nil
+	}
+
+	if body.global() || info.Global {
+		mtl.updateMetrics(func(m *MultiTierMetrics) {
+			m.GlobalLimitHits++
+		})
+		mtl.PauseUntil(mtl.cfg.clock.Now().Add(retryAfter))
+		return nil
+	}
+
+	mtl.updateMetrics(func(m *MultiTierMetrics) {
+		m.RouteLimitHits++
+	})
+	if tb, ok := mtl.getOrCreateRouteLimiter(req).(*TokenBucket); ok {
+		tb.holdFor(retryAfter)
+	}
+
+	mtl.hitLog.Warn("route rate limit hit",
+		"limiter_name", mtl.cfg.name,
+		"endpoint", req.Endpoint,
+		"retry_after", retryAfter,
+	)
+
+	return nil
+}
+
+// headerRetryAfter returns the retry delay from the standard Retry-After
+// header, in seconds or as an HTTP date.
+func headerRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return secondsToDuration(seconds), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return at.Sub(now), true
+	}
+	return 0, false
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// readCloser reads from a replayed body while closing the original one.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
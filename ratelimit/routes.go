@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"sort"
+	"strings"
+)
+
+// segmentKind is the kind of a route pattern segment, in increasing order
+// of precedence.
+type segmentKind int
+
+const (
+	segmentRest    segmentKind = iota // "**"
+	segmentParam                      // "{name}" or "*"
+	segmentEnd                        // past the last segment
+	segmentLiteral                    // matches itself
+)
+
+// routePattern is a compiled route pattern.
+type routePattern struct {
+	key      string // the pattern as configured
+	method   string
+	segments []string
+	kinds    []segmentKind
+	config   RouteConfig
+}
+
+// routeMatcher finds the route pattern of a request. The patterns are
+// kept most specific first, so the first match wins.
+type routeMatcher []*routePattern
+
+// compileRoutes compiles route patterns into a matcher.
+func compileRoutes(patterns map[string]RouteConfig) routeMatcher {
+	m := make(routeMatcher, 0, len(patterns))
+	for key, rc := range patterns {
+		m = append(m, compileRoute(key, rc))
+	}
+	sort.Slice(m, func(i, j int) bool {
+		return m[i].before(m[j])
+	})
+	return m
+}
+
+// compileRoute compiles one route pattern.
+func compileRoute(key string, rc RouteConfig) *routePattern {
+	method, path := splitMethod(key)
+	p := &routePattern{
+		key:      key,
+		method:   method,
+		segments: splitPath(path),
+		config:   rc,
+	}
+	p.kinds = make([]segmentKind, len(p.segments))
+	for i, s := range p.segments {
+		switch {
+		case s == "**" && i == len(p.segments)-1:
+			p.kinds[i] = segmentRest
+		case s == "*" || (strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")):
+			p.kinds[i] = segmentParam
+		default:
+			p.kinds[i] = segmentLiteral
+		}
+	}
+	return p
+}
+
+// match returns the most specific pattern matching a request, or nil.
+func (m routeMatcher) match(method, endpoint string) *routePattern {
+	if len(m) == 0 {
+		return nil
+	}
+	segments := splitPath(endpoint)
+	for _, p := range m {
+		if p.matches(method, segments) {
+			return p
+		}
+	}
+	return nil
+}
+
+// matches reports whether p matches a request with the path segments.
+func (p *routePattern) matches(method string, segments []string) bool {
+	if p.method != "*" && p.method != method {
+		return false
+	}
+	for i, kind := range p.kinds {
+		if kind == segmentRest {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if kind == segmentLiteral && p.segments[i] != segments[i] {
+			return false
+		}
+	}
+	return len(segments) == len(p.kinds)
+}
+
+// before reports whether p is more specific than q.
+func (p *routePattern) before(q *routePattern) bool {
+	for i := 0; i < max(len(p.kinds), len(q.kinds)); i++ {
+		if pk, qk := p.kind(i), q.kind(i); pk != qk {
+			return pk > qk
+		}
+	}
+	if (p.method == "*") != (q.method == "*") {
+		return q.method == "*"
+	}
+	return p.key < q.key
+}
+
+// kind returns the kind of segment i, segmentEnd past the last one.
+func (p *routePattern) kind(i int) segmentKind {
+	if i < len(p.kinds) {
+		return p.kinds[i]
+	}
+	return segmentEnd
+}
+
+// splitMethod splits a route pattern into its method and path. A pattern
+// without a method matches any.
+func splitMethod(pattern string) (method, path string) {
+	method, path, ok := strings.Cut(pattern, ":")
+	if !ok || strings.Contains(method, "/") {
+		return "*", pattern
+	}
+	return method, path
+}
+
+// splitPath splits a path into its non-empty segments.
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/'
+	})
+}
@@ -0,0 +1,367 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Grant is one admission recorded by a SlidingLog.
+type Grant struct {
+	Time time.Time // when the requests were admitted
+	N    int       // requests admitted together
+}
+
+// SlidingLog implements a sliding log rate limiter. It allows at most
+// rate × window requests in any window-long span, counted exactly from a
+// log of the times requests were admitted rather than estimated as by
+// SlidingWindow. The log also serves as an audit trail: History returns
+// the admissions of a recent span.
+//
+// The log is a ring buffer of one entry per grant, holding at least as
+// many entries as the limit, so its memory grows with the limit.
+type SlidingLog struct {
+	// Configuration
+	rate   Rate
+	window time.Duration
+	limit  int
+	cfg    *config
+
+	// State
+	mu      sync.Mutex
+	log     []Grant // ring buffer, oldest grant at head
+	head    int
+	size    int
+	expired int // grants at the head that left the window
+	count   int // requests of the grants still in the window
+	waiters waitQueue
+}
+
+// NewSlidingLog creates a new sliding log rate limiter.
+// rate determines how many requests are allowed per window on average.
+// window is the span over which requests are counted; the limit is
+// rate × window requests and must be at least one.
+func NewSlidingLog(rate Rate, window time.Duration, opts ...Option) *SlidingLog {
+	if window <= 0 {
+		panic("ratelimit: window must be positive")
+	}
+	if rate.TokensPerSec < 0 {
+		panic("ratelimit: rate cannot be negative")
+	}
+	limit := int(rate.TokensPerSec * window.Seconds())
+	if limit <= 0 {
+		panic("ratelimit: rate allows no requests per window")
+	}
+
+	cfg := newConfig(opts...)
+
+	sl := &SlidingLog{
+		rate:   rate,
+		window: window,
+		limit:  limit,
+		cfg:    cfg,
+		log:    make([]Grant, limit),
+	}
+	sl.waiters = waitQueue{
+		fairness: cfg.fairness,
+		clock:    cfg.clock,
+		jitter:   cfg.jitterFn,
+		take:     sl.takeLocked,
+		wake: func() {
+			sl.mu.Lock()
+			defer sl.mu.Unlock()
+			sl.waiters.dispatchLocked()
+		},
+	}
+
+	sl.cfg.obs.Logger.Info("sliding log created",
+		"name", cfg.name,
+		"rate", rate.String(),
+		"window", window,
+		"limit", limit,
+	)
+
+	return sl
+}
+
+// AllowN reports whether n requests fit in the window at time now.
+// It returns true if the requests were logged, false otherwise. Requests
+// are never admitted ahead of callers blocked in WaitN, so AllowN fails
+// while any are queued.
+func (sl *SlidingLog) AllowN(now time.Time, n int) bool {
+	return sl.AllowNWithInfo(now, n).Allowed
+}
+
+// AllowNWithInfo is AllowN, also reporting the limit, the requests that
+// still fit and, if the requests were not logged, how long until they fit.
+func (sl *SlidingLog) AllowNWithInfo(now time.Time, n int) Decision {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.expireLocked(now)
+
+	d := Decision{Allowed: true, Limit: sl.limit}
+	switch {
+	case n <= 0:
+	case sl.waiters.len() == 0 && sl.count+n <= sl.limit:
+		sl.appendLocked(now, n)
+		sl.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sl.cfg.name, "result", "allowed")
+	default:
+		sl.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sl.cfg.name, "result", "denied")
+		d.Allowed = false
+		d.RetryAfter = -1
+		if n <= sl.limit {
+			// Queued waiters are counted first
+			d.RetryAfter = sl.waitLocked(now, min(n+sl.waiters.tokens(), sl.limit))
+		}
+	}
+	d.Remaining = max(sl.limit-sl.count, 0)
+	return d
+}
+
+// WaitN blocks until n requests fit in the window or the context is
+// canceled. Blocked callers are queued and served one at a time in the
+// order set by WithFairness, FIFO by default. A caller whose context is
+// canceled just as its requests are admitted stays in the log.
+func (sl *SlidingLog) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	// Fast path: try to fit the requests immediately
+	now := sl.cfg.clock.Now()
+	if sl.AllowN(now, n) {
+		return nil
+	}
+
+	// Slow path: wait for grants to leave the window
+	return sl.waitSlow(ctx, n)
+}
+
+// waitSlow queues the request and blocks until the queue grants it.
+func (sl *SlidingLog) waitSlow(ctx context.Context, n int) error {
+	obs := sl.cfg.obs.WithContext(ctx)
+
+	sl.mu.Lock()
+	if n > sl.limit {
+		sl.mu.Unlock()
+		return NewBurstExceededError(sl.cfg.name, n, sl.limit)
+	}
+
+	w := sl.waiters.push(n)
+	sl.waiters.dispatchLocked()
+	queued := sl.waiters.len()
+	sl.mu.Unlock()
+
+	obs.Logger.Debug("sliding log waiting",
+		"limiter_name", sl.cfg.name,
+		"requested", n,
+		"queued", queued,
+	)
+
+	start := sl.cfg.clock.Now()
+
+	select {
+	case <-ctx.Done():
+		sl.mu.Lock()
+		sl.waiters.remove(w)
+		sl.waiters.dispatchLocked()
+		sl.mu.Unlock()
+
+		obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sl.cfg.name, "result", "canceled")
+		return ctx.Err()
+
+	case <-w.ready:
+		if w.err != nil {
+			return w.err
+		}
+		obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
+			sl.cfg.clock.Since(start).Seconds(), "limiter_name", sl.cfg.name)
+		return nil
+	}
+}
+
+// takeLocked logs n requests for a queued waiter. See takeFunc.
+// Must be called with sl.mu held.
+func (sl *SlidingLog) takeLocked(n int) (time.Duration, error) {
+	if n > sl.limit {
+		// The limit shrank while the request was queued
+		return 0, NewBurstExceededError(sl.cfg.name, n, sl.limit)
+	}
+
+	now := sl.cfg.clock.Now()
+	sl.expireLocked(now)
+
+	if sl.count+n <= sl.limit {
+		sl.appendLocked(now, n)
+		sl.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sl.cfg.name, "result", "allowed")
+		return 0, nil
+	}
+
+	return sl.waitLocked(now, n), nil
+}
+
+// waitLocked returns how long until n more requests fit in the window,
+// assuming no others are logged meanwhile. Must be called with sl.mu held,
+// after expireLocked.
+func (sl *SlidingLog) waitLocked(now time.Time, n int) time.Duration {
+	count := sl.count
+	for i := sl.expired; i < sl.size; i++ {
+		g := sl.at(i)
+		count -= g.N
+		if count+n <= sl.limit {
+			return max(g.Time.Add(sl.window).Sub(now), 1)
+		}
+	}
+	return 1 // Only after SetBurst raced the caller
+}
+
+// expireLocked moves the grants that left the window ending at now out of
+// the count. They stay in the log for History until overwritten.
+// Must be called with sl.mu held.
+func (sl *SlidingLog) expireLocked(now time.Time) {
+	cutoff := now.Add(-sl.window)
+	for sl.expired < sl.size {
+		g := sl.at(sl.expired)
+		if g.Time.After(cutoff) {
+			return
+		}
+		sl.count -= g.N
+		sl.expired++
+	}
+}
+
+// appendLocked logs a grant of n requests at now, overwriting the oldest
+// grant if the log is full. Must be called with sl.mu held, after
+// expireLocked.
+func (sl *SlidingLog) appendLocked(now time.Time, n int) {
+	if sl.size == len(sl.log) {
+		// The count fits the limit, so the oldest grant has expired
+		sl.head = (sl.head + 1) % len(sl.log)
+		sl.size--
+		sl.expired--
+	}
+	sl.log[(sl.head+sl.size)%len(sl.log)] = Grant{Time: now, N: n}
+	sl.size++
+	sl.count += n
+}
+
+// at returns the i-th oldest grant in the log. Must be called with sl.mu
+// held.
+func (sl *SlidingLog) at(i int) Grant {
+	return sl.log[(sl.head+i)%len(sl.log)]
+}
+
+// resizeLocked makes room for limit grants, keeping the newest ones and
+// never dropping those still in the window. Must be called with sl.mu held.
+func (sl *SlidingLog) resizeLocked(limit int) {
+	capacity := max(limit, sl.size-sl.expired)
+	if capacity == len(sl.log) {
+		return
+	}
+
+	keep := min(sl.size, capacity)
+	log := make([]Grant, capacity)
+	for i := range keep {
+		log[i] = sl.at(sl.size - keep + i)
+	}
+	sl.expired = max(sl.expired-(sl.size-keep), 0)
+	sl.log, sl.head, sl.size = log, 0, keep
+}
+
+// History returns the grants logged in the span d before now, oldest
+// first, for answering which requests were admitted during an incident.
+// Grants older than the window are kept only until the log needs their
+// room, so a span longer than the window may be incomplete.
+func (sl *SlidingLog) History(d time.Duration) []Grant {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	cutoff := sl.cfg.clock.Now().Add(-d)
+	var grants []Grant
+	for i := 0; i < sl.size; i++ {
+		if g := sl.at(i); g.Time.After(cutoff) {
+			grants = append(grants, g)
+		}
+	}
+	return grants
+}
+
+// Remaining returns how many requests fit in the window now.
+func (sl *SlidingLog) Remaining() int {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.expireLocked(sl.cfg.clock.Now())
+	return max(sl.limit-sl.count, 0)
+}
+
+// Limit returns the number of requests allowed per window.
+func (sl *SlidingLog) Limit() int {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.limit
+}
+
+// Window returns the span over which requests are counted.
+func (sl *SlidingLog) Window() time.Duration {
+	return sl.window
+}
+
+// Rate returns the average rate the window allows.
+func (sl *SlidingLog) Rate() Rate {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.rate
+}
+
+// SetRate updates the rate dynamically, and with it the limit of
+// rate × window requests. Rates that allow no requests per window are
+// ignored.
+func (sl *SlidingLog) SetRate(rate Rate) {
+	limit := int(rate.TokensPerSec * sl.window.Seconds())
+	if rate.TokensPerSec < 0 || limit <= 0 {
+		return
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.rate = rate
+	sl.limit = limit
+	sl.resizeLocked(limit)
+
+	sl.cfg.obs.Logger.Debug("rate updated",
+		"limiter_name", sl.cfg.name,
+		"new_rate", rate.String(),
+		"limit", limit,
+	)
+
+	sl.waiters.dispatchLocked()
+}
+
+// SetBurst updates the number of requests allowed per window, and with it
+// the rate.
+func (sl *SlidingLog) SetBurst(limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.limit = limit
+	sl.rate = Rate{TokensPerSec: float64(limit) / sl.window.Seconds()}
+	sl.resizeLocked(limit)
+
+	sl.cfg.obs.Logger.Debug("limit updated",
+		"limiter_name", sl.cfg.name,
+		"new_limit", limit,
+	)
+
+	sl.waiters.dispatchLocked()
+}
@@ -0,0 +1,326 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// SlidingWindow implements a sliding window rate limiter. It allows at most
+// rate × window requests in any window-long span, approximated by weighting
+// the count of the previous fixed window by how much of it still overlaps
+// the sliding window. Unlike a fixed window counter, a burst at the end of
+// one window and another at the start of the next are not both allowed.
+type SlidingWindow struct {
+	// Configuration
+	rate   Rate
+	window time.Duration
+	limit  int
+	cfg    *config
+
+	// State
+	mu          sync.Mutex
+	start       time.Time // start of the current fixed window
+	prev        float64   // requests counted in the previous fixed window
+	curr        float64   // requests counted in the current fixed window
+	initialized bool
+	waiters     waitQueue
+}
+
+// NewSlidingWindow creates a new sliding window rate limiter.
+// rate determines how many requests are allowed per window on average.
+// window is the span over which requests are counted; the limit is
+// rate × window requests and must be at least one.
+func NewSlidingWindow(rate Rate, window time.Duration, opts ...Option) *SlidingWindow {
+	if window <= 0 {
+		panic("ratelimit: window must be positive")
+	}
+	if rate.TokensPerSec < 0 {
+		panic("ratelimit: rate cannot be negative")
+	}
+	limit := int(rate.TokensPerSec * window.Seconds())
+	if limit <= 0 {
+		panic("ratelimit: rate allows no requests per window")
+	}
+
+	cfg := newConfig(opts...)
+
+	sw := &SlidingWindow{
+		rate:   rate,
+		window: window,
+		limit:  limit,
+		cfg:    cfg,
+	}
+	sw.waiters = waitQueue{
+		fairness: cfg.fairness,
+		clock:    cfg.clock,
+		jitter:   cfg.jitterFn,
+		take:     sw.takeLocked,
+		wake: func() {
+			sw.mu.Lock()
+			defer sw.mu.Unlock()
+			sw.waiters.dispatchLocked()
+		},
+	}
+
+	sw.cfg.obs.Logger.Info("sliding window created",
+		"name", cfg.name,
+		"rate", rate.String(),
+		"window", window,
+		"limit", limit,
+	)
+
+	return sw
+}
+
+// AllowN reports whether n requests fit in the window at time now.
+// It returns true if the requests were counted, false otherwise. Requests
+// are never admitted ahead of callers blocked in WaitN, so AllowN fails
+// while any are queued.
+func (sw *SlidingWindow) AllowN(now time.Time, n int) bool {
+	return sw.AllowNWithInfo(now, n).Allowed
+}
+
+// AllowNWithInfo is AllowN, also reporting the limit, the requests that
+// still fit and, if the requests were not counted, how long until they
+// fit.
+func (sw *SlidingWindow) AllowNWithInfo(now time.Time, n int) Decision {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.advanceLocked(now)
+
+	d := Decision{Allowed: true, Limit: sw.limit}
+	switch {
+	case n <= 0:
+	case sw.waiters.len() == 0 && sw.countLocked(now)+float64(n) <= float64(sw.limit):
+		sw.curr += float64(n)
+		sw.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sw.cfg.name, "result", "allowed")
+	default:
+		sw.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sw.cfg.name, "result", "denied")
+		d.Allowed = false
+		d.RetryAfter = -1
+		if n <= sw.limit {
+			// Queued waiters are counted first
+			d.RetryAfter = sw.waitLocked(now, min(n+sw.waiters.tokens(), sw.limit))
+		}
+	}
+	d.Remaining = max(sw.limit-int(math.Ceil(sw.countLocked(now))), 0)
+	return d
+}
+
+// WaitN blocks until n requests fit in the window or the context is
+// canceled. Blocked callers are queued and served one at a time in the
+// order set by WithFairness, FIFO by default.
+func (sw *SlidingWindow) WaitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	// Fast path: try to fit the requests immediately
+	now := sw.cfg.clock.Now()
+	if sw.AllowN(now, n) {
+		return nil
+	}
+
+	// Slow path: wait for the window to slide
+	return sw.waitSlow(ctx, n)
+}
+
+// waitSlow queues the request and blocks until the queue grants it.
+func (sw *SlidingWindow) waitSlow(ctx context.Context, n int) error {
+	obs := sw.cfg.obs.WithContext(ctx)
+
+	sw.mu.Lock()
+	if n > sw.limit {
+		sw.mu.Unlock()
+		return NewBurstExceededError(sw.cfg.name, n, sw.limit)
+	}
+
+	w := sw.waiters.push(n)
+	sw.waiters.dispatchLocked()
+	queued := sw.waiters.len()
+	sw.mu.Unlock()
+
+	obs.Logger.Debug("sliding window waiting",
+		"limiter_name", sw.cfg.name,
+		"requested", n,
+		"queued", queued,
+	)
+
+	start := sw.cfg.clock.Now()
+
+	select {
+	case <-ctx.Done():
+		sw.mu.Lock()
+		if !sw.waiters.remove(w) && w.err == nil {
+			// Granted as ctx was canceled; uncount the requests for the next waiter
+			sw.curr = math.Max(sw.curr-float64(n), 0)
+		}
+		sw.waiters.dispatchLocked()
+		sw.mu.Unlock()
+
+		obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sw.cfg.name, "result", "canceled")
+		return ctx.Err()
+
+	case <-w.ready:
+		if w.err != nil {
+			return w.err
+		}
+		obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
+			sw.cfg.clock.Since(start).Seconds(), "limiter_name", sw.cfg.name)
+		return nil
+	}
+}
+
+// takeLocked counts n requests for a queued waiter. See takeFunc.
+// Must be called with sw.mu held.
+func (sw *SlidingWindow) takeLocked(n int) (time.Duration, error) {
+	if n > sw.limit {
+		// The limit shrank while the request was queued
+		return 0, NewBurstExceededError(sw.cfg.name, n, sw.limit)
+	}
+
+	now := sw.cfg.clock.Now()
+	sw.advanceLocked(now)
+
+	if sw.countLocked(now)+float64(n) <= float64(sw.limit) {
+		sw.curr += float64(n)
+		sw.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
+			"limiter_name", sw.cfg.name, "result", "allowed")
+		return 0, nil
+	}
+
+	return sw.waitLocked(now, n), nil
+}
+
+// waitLocked returns how long until n more requests fit in the window,
+// assuming no others are counted meanwhile. Must be called with sw.mu held.
+func (sw *SlidingWindow) waitLocked(now time.Time, n int) time.Duration {
+	elapsed := now.Sub(sw.start)
+	room := float64(sw.limit - n)
+
+	// The previous window's weight shrinks until the current one ends
+	if sw.prev > 0 {
+		excess := sw.countLocked(now) - room
+		if wait := time.Duration(math.Ceil(excess / sw.prev * float64(sw.window))); elapsed+wait <= sw.window {
+			return max(wait, 1)
+		}
+	}
+
+	// Then the current window becomes the previous one and shrinks in turn
+	wait := sw.window - elapsed
+	if sw.curr > room {
+		wait += time.Duration(math.Ceil((1 - room/sw.curr) * float64(sw.window)))
+	}
+	return max(wait, 1)
+}
+
+// countLocked returns the estimated number of requests in the sliding
+// window ending at now. Must be called with sw.mu held, after advanceLocked.
+func (sw *SlidingWindow) countLocked(now time.Time) float64 {
+	overlap := 1 - float64(now.Sub(sw.start))/float64(sw.window)
+	return sw.prev*math.Max(overlap, 0) + sw.curr
+}
+
+// advanceLocked moves the fixed windows forward to the one containing now.
+// Must be called with sw.mu held.
+func (sw *SlidingWindow) advanceLocked(now time.Time) {
+	if !sw.initialized {
+		sw.start = now
+		sw.initialized = true
+		return
+	}
+
+	elapsed := now.Sub(sw.start)
+	if elapsed < sw.window {
+		return // Still in the current window, or time went backwards
+	}
+
+	windows := elapsed / sw.window
+	if windows == 1 {
+		sw.prev = sw.curr
+	} else {
+		sw.prev = 0 // A whole window passed without requests
+	}
+	sw.curr = 0
+	sw.start = sw.start.Add(windows * sw.window)
+}
+
+// Remaining returns how many requests fit in the window now.
+func (sw *SlidingWindow) Remaining() int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := sw.cfg.clock.Now()
+	sw.advanceLocked(now)
+	return max(sw.limit-int(math.Ceil(sw.countLocked(now))), 0)
+}
+
+// Limit returns the number of requests allowed per window.
+func (sw *SlidingWindow) Limit() int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.limit
+}
+
+// Window returns the span over which requests are counted.
+func (sw *SlidingWindow) Window() time.Duration {
+	return sw.window
+}
+
+// Rate returns the average rate the window allows.
+func (sw *SlidingWindow) Rate() Rate {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.rate
+}
+
+// SetRate updates the rate dynamically, and with it the limit of
+// rate × window requests. Rates that allow no requests per window are
+// ignored.
+func (sw *SlidingWindow) SetRate(rate Rate) {
+	limit := int(rate.TokensPerSec * sw.window.Seconds())
+	if rate.TokensPerSec < 0 || limit <= 0 {
+		return
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.rate = rate
+	sw.limit = limit
+
+	sw.cfg.obs.Logger.Debug("rate updated",
+		"limiter_name", sw.cfg.name,
+		"new_rate", rate.String(),
+		"limit", limit,
+	)
+
+	sw.waiters.dispatchLocked()
+}
+
+// SetBurst updates the number of requests allowed per window, and with it
+// the rate.
+func (sw *SlidingWindow) SetBurst(limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.limit = limit
+	sw.rate = Rate{TokensPerSec: float64(limit) / sw.window.Seconds()}
+
+	sw.cfg.obs.Logger.Debug("limit updated",
+		"limiter_name", sw.cfg.name,
+		"new_limit", limit,
+	)
+
+	sw.waiters.dispatchLocked()
+}
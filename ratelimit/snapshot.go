@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// resultCounts counts request outcomes alongside the
+// ion_ratelimit_requests_total metric.
+type resultCounts struct {
+	allowed  atomic.Uint64
+	denied   atomic.Uint64
+	canceled atomic.Uint64
+}
+
+// record counts a request outcome, "allowed", "denied" or "canceled", and
+// reports it to metrics.
+func (c *resultCounts) record(metrics observe.Metrics, name, result string) {
+	switch result {
+	case "allowed":
+		c.allowed.Add(1)
+	case "denied":
+		c.denied.Add(1)
+	case "canceled":
+		c.canceled.Add(1)
+	}
+	metrics.Inc("ion_ratelimit_requests_total", "limiter_name", name, "result", result)
+}
+
+// TokenBucketSnapshot is the state of a TokenBucket at one point in time.
+type TokenBucketSnapshot struct {
+	Name           string
+	Tokens         float64   // tokens available
+	Rate           Rate      // current refill rate
+	Burst          int       // current capacity
+	TemporaryLimit bool      // rate and burst are a temporary limit
+	Waiting        int       // callers blocked in WaitN
+	Allowed        uint64    // requests allowed since creation
+	Denied         uint64    // requests denied since creation, including WaitN calls that had to wait
+	Canceled       uint64    // WaitN calls given up since creation
+	LastRefill     time.Time // when tokens were last added
+}
+
+// Snapshot returns the current state and request counts of the bucket, for
+// dashboards and admin endpoints that poll limiters instead of collecting
+// metrics. Requests decided by a Store are counted too.
+func (tb *TokenBucket) Snapshot() TokenBucketSnapshot {
+	tb.lock()
+	defer tb.unlock()
+
+	tb.refillLocked(tb.cfg.clock.Now())
+
+	return TokenBucketSnapshot{
+		Name:           tb.cfg.name,
+		Tokens:         tb.tokens,
+		Rate:           tb.rate,
+		Burst:          tb.burst,
+		TemporaryLimit: tb.tempLimit != nil,
+		Waiting:        tb.waiters.len(),
+		Allowed:        tb.results.allowed.Load(),
+		Denied:         tb.results.denied.Load(),
+		Canceled:       tb.results.canceled.Load(),
+		LastRefill:     tb.lastRefill,
+	}
+}
+
+// LeakyBucketSnapshot is the state of a LeakyBucket at one point in time.
+type LeakyBucketSnapshot struct {
+	Name           string
+	Level          float64   // requests in the bucket
+	Rate           Rate      // current leak rate
+	Capacity       int       // current capacity
+	Mode           LeakyMode // admission mode
+	TemporaryLimit bool      // rate and capacity are a temporary limit
+	Waiting        int       // LeakyMeter callers blocked in WaitN
+	Allowed        uint64    // requests admitted since creation
+	Denied         uint64    // requests denied since creation, including WaitN calls that had to wait
+	Canceled       uint64    // WaitN calls given up since creation
+	LastLeak       time.Time // when the bucket last leaked
+}
+
+// Snapshot returns the current state and request counts of the bucket, for
+// dashboards and admin endpoints that poll limiters instead of collecting
+// metrics.
+func (lb *LeakyBucket) Snapshot() LeakyBucketSnapshot {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.leakLocked(lb.cfg.clock.Now())
+
+	return LeakyBucketSnapshot{
+		Name:           lb.cfg.name,
+		Level:          lb.level,
+		Rate:           lb.rate,
+		Capacity:       lb.capacity,
+		Mode:           lb.mode,
+		TemporaryLimit: lb.tempLimit != nil,
+		Waiting:        lb.waiters.len(),
+		Allowed:        lb.results.allowed.Load(),
+		Denied:         lb.results.denied.Load(),
+		Canceled:       lb.results.canceled.Load(),
+		LastLeak:       lb.lastLeak,
+	}
+}
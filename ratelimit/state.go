@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucketState is the state of a TokenBucket for persisting across
+// restarts. It encodes to JSON.
+type TokenBucketState struct {
+	Tokens float64   `json:"tokens"` // tokens available at At
+	At     time.Time `json:"at"`
+}
+
+// Export returns the state of the bucket, for Restore after a restart so
+// that a deploy does not hand out a fresh full burst. With a Store, the
+// state lives in the store and Export returns the local bucket only.
+func (tb *TokenBucket) Export() TokenBucketState {
+	tb.lock()
+	defer tb.unlock()
+
+	now := tb.cfg.clock.Now()
+	tb.refillLocked(now)
+	return TokenBucketState{Tokens: tb.tokens, At: now}
+}
+
+// Restore sets the bucket to an exported state, refilled for the time
+// since it was exported. Tokens beyond the current burst are dropped. It
+// is meant to be called before the bucket is used.
+func (tb *TokenBucket) Restore(s TokenBucketState) {
+	tb.lock()
+	defer tb.unlock()
+
+	now := tb.cfg.clock.Now()
+	tb.refillLocked(now)
+
+	at := s.At
+	if at.IsZero() || at.After(now) {
+		at = now
+	}
+	tb.tokens = clampLevel(s.Tokens, tb.burst)
+	tb.lastRefill = at
+	tb.refillLocked(now)
+
+	tb.waiters.dispatchLocked()
+}
+
+// LeakyBucketState is the state of a LeakyBucket for persisting across
+// restarts. It encodes to JSON.
+type LeakyBucketState struct {
+	Level float64   `json:"level"` // requests in the bucket at At
+	At    time.Time `json:"at"`
+}
+
+// Export returns the state of the bucket, for Restore after a restart.
+func (lb *LeakyBucket) Export() LeakyBucketState {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.cfg.clock.Now()
+	lb.leakLocked(now)
+	return LeakyBucketState{Level: lb.level, At: now}
+}
+
+// Restore sets the bucket to an exported state, leaked for the time since
+// it was exported. A level beyond the current capacity is capped. It is
+// meant to be called before the bucket is used.
+func (lb *LeakyBucket) Restore(s LeakyBucketState) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.cfg.clock.Now()
+	lb.leakLocked(now)
+
+	at := s.At
+	if at.IsZero() || at.After(now) {
+		at = now
+	}
+	lb.level = clampLevel(s.Level, lb.capacity)
+	lb.lastLeak = at
+	lb.leakLocked(now)
+
+	lb.waiters.dispatchLocked()
+}
+
+// clampLevel bounds a restored token count or level to [0, limit].
+func clampLevel(v float64, limit int) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return math.Max(0, math.Min(v, float64(limit)))
+}
+
+// MultiTierState is the state of a MultiTierLimiter for persisting across
+// restarts. It encodes to JSON.
+type MultiTierState struct {
+	Global TokenBucketState `json:"global"`
+
+	// Routes and Resources are the route and resource limiters by key
+	Routes    map[string]RouteState       `json:"routes,omitempty"`
+	Resources map[string]TokenBucketState `json:"resources,omitempty"`
+
+	// Buckets maps route keys to the upstream buckets they were reported
+	// in, see EnableBucketMapping
+	Buckets map[string]string `json:"buckets,omitempty"`
+
+	// PausedUntil is when the pause ends, zero if not paused
+	PausedUntil time.Time `json:"paused_until,omitzero"`
+}
+
+// RouteState is the state of a route limiter in a MultiTierState. Method
+// and Endpoint are those of the request it was created for, to find its
+// limits again on Restore.
+type RouteState struct {
+	TokenBucketState
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+}
+
+// Export returns the state of the limiter and of its route and resource
+// limiters, for Restore after a restart.
+func (mtl *MultiTierLimiter) Export() MultiTierState {
+	s := MultiTierState{
+		Global:      mtl.global.(*TokenBucket).Export(),
+		Routes:      make(map[string]RouteState),
+		Resources:   make(map[string]TokenBucketState),
+		Buckets:     make(map[string]string),
+		PausedUntil: mtl.PausedUntil(),
+	}
+
+	mtl.routes.Range(func(key, value any) bool {
+		entry := value.(*bucketEntry)
+		s.Routes[key.(string)] = RouteState{
+			TokenBucketState: entry.limiter.Export(),
+			Method:           entry.method,
+			Endpoint:         entry.endpoint,
+		}
+		return true
+	})
+	mtl.resources.Range(func(key, value any) bool {
+		s.Resources[key.(string)] = value.(*bucketEntry).limiter.Export()
+		return true
+	})
+	mtl.bucketMap.Range(func(key, value any) bool {
+		s.Buckets[key.(string)] = value.(string)
+		return true
+	})
+
+	return s
+}
+
+// Restore sets the limiter to an exported state, creating its route and
+// resource limiters with the limits currently configured for them. It is
+// meant to be called before the limiter is used.
+func (mtl *MultiTierLimiter) Restore(s MultiTierState) {
+	now := mtl.cfg.clock.Now()
+
+	mtl.global.(*TokenBucket).Restore(s.Global)
+	for key, rs := range s.Routes {
+		entry := mtl.routeEntry(key, rs.Method, rs.Endpoint, now)
+		entry.use(now)
+		entry.limiter.Restore(rs.TokenBucketState)
+	}
+	for key, ts := range s.Resources {
+		entry := mtl.resourceEntry(key, resourceIDOf(key), now)
+		entry.use(now)
+		entry.limiter.Restore(ts)
+	}
+	for routeKey, bucket := range s.Buckets {
+		mtl.bucketMap.Store(routeKey, bucket)
+	}
+	if s.PausedUntil.After(now) {
+		mtl.PauseUntil(s.PausedUntil)
+	}
+
+	mtl.cfg.obs.Logger.Info("multi-tier rate limiter restored",
+		"limiter_name", mtl.cfg.name,
+		"routes", len(s.Routes),
+		"resources", len(s.Resources),
+	)
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// storeLogRate bounds how often store failures are logged while a limiter
+// falls back to local limiting.
+var storeLogRate = Per(1, 10*time.Second)
+
+// Store holds token bucket state shared by limiters in several processes,
+// so that service instances enforce one limit together. Implementations
+// must refill and take atomically, as with a Redis Lua script; see the
+// github.com/kolosys/ion/ratelimit/redisstore module.
+type Store interface {
+	// TakeN refills the bucket stored under key at rate, up to burst, as of
+	// now, and takes n tokens if that many are available. A bucket seen
+	// for the first time starts full.
+	TakeN(ctx context.Context, key string, rate Rate, burst, n int, now time.Time) (StoreResult, error)
+}
+
+// StoreResult is the outcome of Store.TakeN.
+type StoreResult struct {
+	Allowed    bool          // the tokens were taken
+	Remaining  float64       // tokens left in the bucket
+	RetryAfter time.Duration // when n tokens may be available if not allowed, negative if never
+}
+
+// WithStore shares the state of a TokenBucket through store, under the key
+// given by WithName, which must be the same across instances. While the
+// store fails, as when Redis is unreachable, the bucket falls back to
+// limiting locally at the same rate and burst, so each instance admits up to
+// the full limit until the store recovers. Blocked WaitN callers poll the
+// store instead of joining the local wait queue, so fairness is not
+// guaranteed across instances. It has no effect on other limiters.
+func WithStore(store Store) Option {
+	return func(c *config) {
+		c.store = store
+	}
+}
+
+// storeTakeN takes n tokens through the store. It reports false if the
+// store failed and the caller should fall back to the local bucket.
+func (tb *TokenBucket) storeTakeN(ctx context.Context, now time.Time, n int) (StoreResult, bool) {
+	tb.lock()
+	rate, burst := tb.rate, tb.burst
+	tb.unlock()
+
+	res, err := tb.cfg.store.TakeN(ctx, tb.cfg.name, rate, burst, n, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			tb.cfg.obs.WithContext(ctx).Metrics.Inc("ion_ratelimit_store_errors_total", "limiter_name", tb.cfg.name)
+			observe.CorrelatedLogger(ctx, tb.storeLog).Warn("rate limit store failed, limiting locally",
+				"limiter_name", tb.cfg.name, "error", err)
+		}
+		return StoreResult{}, false
+	}
+
+	result := "denied"
+	if res.Allowed {
+		result = "allowed"
+	}
+	tb.results.record(tb.cfg.obs.WithContext(ctx).Metrics, tb.cfg.name, result)
+	return res, true
+}
+
+// storeWaitN polls the store until n tokens are taken or ctx is done. It
+// reports false if the store failed and the caller should fall back to the
+// local bucket.
+func (tb *TokenBucket) storeWaitN(ctx context.Context, n int) (bool, error) {
+	if burst := tb.Burst(); n > burst {
+		return true, NewBurstExceededError(tb.cfg.name, n, burst)
+	}
+
+	for {
+		res, ok := tb.storeTakeN(ctx, tb.cfg.clock.Now(), n)
+		if !ok {
+			if err := ctx.Err(); err != nil {
+				return true, err
+			}
+			return false, nil
+		}
+		if res.Allowed {
+			return true, nil
+		}
+
+		// A negative RetryAfter means a zero rate: only ctx ends the wait
+		var timer Timer
+		var wake <-chan time.Time
+		if res.RetryAfter >= 0 {
+			timer = tb.cfg.clock.NewTimer(tb.cfg.jitterFn(max(res.RetryAfter, time.Millisecond)))
+			wake = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			tb.results.record(tb.cfg.obs.WithContext(ctx).Metrics, tb.cfg.name, "canceled")
+			return true, ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+// MemoryStore is a Store that keeps buckets in memory. It only shares state
+// between limiters in the same process; it is meant for tests and as a
+// reference implementation.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*storedBucket
+}
+
+// storedBucket is the state of one bucket in a MemoryStore.
+type storedBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*storedBucket)}
+}
+
+// TakeN implements Store.TakeN
+func (s *MemoryStore) TakeN(ctx context.Context, key string, rate Rate, burst, n int, now time.Time) (StoreResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &storedBucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.tokens+rate.TokensPerSec*elapsed.Seconds(), float64(burst))
+		b.last = now
+	}
+
+	if float64(n) <= b.tokens {
+		b.tokens -= float64(n)
+		return StoreResult{Allowed: true, Remaining: b.tokens}, nil
+	}
+
+	retryAfter := time.Duration(-1)
+	if rate.TokensPerSec > 0 {
+		retryAfter = time.Duration(math.Ceil((float64(n) - b.tokens) / rate.TokensPerSec * float64(time.Second)))
+	}
+	return StoreResult{Remaining: b.tokens, RetryAfter: retryAfter}, nil
+}
@@ -2,16 +2,21 @@ package ratelimit
 
 import (
 	"context"
-	"fmt"
 	"math"
-	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/kolosys/ion/observe"
 )
 
 // TokenBucket implements a token bucket rate limiter.
 // Tokens are added to the bucket at a fixed rate, and requests consume tokens.
 // If no tokens are available, requests must wait or are denied.
+//
+// AllowN takes tokens without locking while no caller is blocked in WaitN
+// and no warm-up, store or upstream hold is in effect, so it scales with
+// the number of cores under contention.
 type TokenBucket struct {
 	// Configuration
 	rate  Rate
@@ -23,9 +28,22 @@ type TokenBucket struct {
 	tokens      float64
 	lastRefill  time.Time
 	initialized bool
+	waiters     waitQueue
+	warmupStart time.Time
+
+	// Lock-free state, see allowFast. Nil until the first unlock that
+	// allows it
+	fast      atomic.Pointer[fastState]
+	published int64 // empty time as last stored by unlock
 
 	// Temporary limit support
 	tempLimit *temporaryLimit
+
+	// Shared state, nil storeLog without a store
+	storeLog observe.Logger
+
+	// Request outcomes, for Snapshot
+	results resultCounts
 }
 
 // temporaryLimit holds state for a temporary rate limit override
@@ -54,6 +72,23 @@ func NewTokenBucket(rate Rate, burst int, opts ...Option) *TokenBucket {
 		cfg:    cfg,
 		tokens: float64(burst), // Start with full bucket
 	}
+	if cfg.warmup > 0 {
+		tb.tokens *= warmupFloor
+	}
+	tb.waiters = waitQueue{
+		fairness: cfg.fairness,
+		clock:    cfg.clock,
+		jitter:   cfg.jitterFn,
+		take:     tb.takeLocked,
+		wake: func() {
+			tb.lock()
+			defer tb.unlock()
+			tb.waiters.dispatchLocked()
+		},
+	}
+	if cfg.store != nil {
+		tb.storeLog = NewThrottledLogger(cfg.obs.Logger, storeLogRate, 1, WithClock(cfg.clock))
+	}
 
 	tb.cfg.obs.Logger.Info("token bucket created",
 		"name", cfg.name,
@@ -65,37 +100,212 @@ func NewTokenBucket(rate Rate, burst int, opts ...Option) *TokenBucket {
 }
 
 // AllowN reports whether n tokens are available at time now.
-// It returns true if the tokens were consumed, false otherwise.
+// It returns true if the tokens were consumed, false otherwise. Tokens are
+// never taken ahead of callers blocked in WaitN, so AllowN fails while any
+// are queued.
 func (tb *TokenBucket) AllowN(now time.Time, n int) bool {
-	if n <= 0 {
-		return true
+	return tb.AllowNWithInfo(now, n).Allowed
+}
+
+// AllowNWithInfo is AllowN, also reporting the burst, the tokens left and,
+// if the tokens were not taken, how long until they may be. With a Store,
+// the state of the shared bucket is reported.
+func (tb *TokenBucket) AllowNWithInfo(now time.Time, n int) Decision {
+	if tb.cfg.store != nil && n > 0 {
+		if res, ok := tb.storeTakeN(context.Background(), now, n); ok {
+			d := Decision{
+				Allowed:   res.Allowed,
+				Limit:     tb.Burst(),
+				Remaining: max(int(res.Remaining), 0),
+			}
+			if !res.Allowed {
+				d.RetryAfter = res.RetryAfter
+			}
+			return d
+		}
 	}
 
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	if n > 0 {
+		if d, ok := tb.allowFast(now, n); ok {
+			return d
+		}
+	}
+
+	tb.lock()
+	defer tb.unlock()
 
 	tb.refillLocked(now)
 
-	if float64(n) <= tb.tokens {
+	d := Decision{Allowed: true, Limit: tb.burst}
+	switch {
+	case n <= 0:
+	case tb.waiters.len() == 0 && float64(n) <= tb.tokens:
 		tb.tokens -= float64(n)
-		tb.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
-			"limiter_name", tb.cfg.name, "result", "allowed")
+		tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "allowed")
 		tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
 			tb.tokens, "limiter_name", tb.cfg.name)
-		return true
+	default:
+		tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "denied")
+		d.Allowed = false
+		d.RetryAfter = tb.retryAfterLocked(n)
 	}
+	d.Remaining = max(int(tb.tokens), 0)
+	return d
+}
 
-	tb.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
-		"limiter_name", tb.cfg.name, "result", "denied")
-	return false
+// lockedState is the empty time of a fastState while the mutex holds the
+// state of the bucket, in its tokens and lastRefill fields.
+const lockedState = math.MinInt64
+
+// fastState is the state allowFast decides AllowN from: the UnixNano time
+// at which the bucket was empty, the tokens available at a time t being
+// the time since then over the interval, at most the burst. A new
+// fastState replaces it when the rate or burst changes, so a
+// compare-and-swap never pairs an empty time with other parameters.
+type fastState struct {
+	empty    atomic.Int64
+	interval int64 // nanoseconds per token, rounded up
+	burst    int
+}
+
+// allowFast decides AllowN by a compare-and-swap on the empty time. It
+// reports false if the mutex holds the state and the caller must lock.
+func (tb *TokenBucket) allowFast(now time.Time, n int) (Decision, bool) {
+	fs := tb.fast.Load()
+	if fs == nil {
+		return Decision{}, false
+	}
+
+	t := now.UnixNano()
+	for {
+		state := fs.empty.Load()
+		if state == lockedState {
+			return Decision{}, false
+		}
+
+		empty := max(state, t-int64(fs.burst)*fs.interval)
+		d := Decision{Limit: fs.burst}
+
+		if n > fs.burst {
+			tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "denied")
+			d.Remaining = max(int((t-empty)/fs.interval), 0)
+			d.RetryAfter = -1
+			return d, true
+		}
+		cost := int64(n) * fs.interval
+		if t-empty < cost {
+			tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "denied")
+			d.Remaining = max(int((t-empty)/fs.interval), 0)
+			d.RetryAfter = time.Duration(cost - (t - empty))
+			return d, true
+		}
+
+		if fs.empty.CompareAndSwap(state, empty+cost) {
+			tokens := float64(t-empty-cost) / float64(fs.interval)
+			tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "allowed")
+			tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
+				tokens, "limiter_name", tb.cfg.name)
+			d.Allowed = true
+			d.Remaining = int(tokens)
+			return d, true
+		}
+	}
+}
+
+// lock takes the mutex and the state from allowFast, bringing tokens and
+// lastRefill up to date with the tokens it took since unlock.
+func (tb *TokenBucket) lock() {
+	tb.mu.Lock()
+
+	fs := tb.fast.Load()
+	if fs == nil {
+		return
+	}
+	state := fs.empty.Swap(lockedState)
+	if state == lockedState || state == tb.published {
+		return
+	}
+
+	// The tokens are exact at any time after both the empty time and the
+	// last refill, so these keep to the times the callers pass in
+	at := max(state, tb.lastRefill.UnixNano())
+	tb.tokens = math.Min(float64(at-state)/float64(fs.interval), float64(fs.burst))
+	tb.lastRefill = time.Unix(0, at)
+}
+
+// unlock hands the state to allowFast, if AllowN can be decided lock-free,
+// and releases the mutex.
+func (tb *TokenBucket) unlock() {
+	if tb.fastLocked() {
+		// Rounding the interval up slows the rate by under a nanosecond
+		// per token, but never admits more than it or the burst
+		interval := int64(math.Ceil(float64(time.Second) / tb.rate.TokensPerSec))
+		fs := tb.fast.Load()
+		if fs == nil || fs.interval != interval || fs.burst != tb.burst {
+			fs = &fastState{interval: interval, burst: tb.burst}
+			fs.empty.Store(lockedState)
+			tb.fast.Store(fs)
+		}
+		tb.published = tb.lastRefill.UnixNano() - int64(math.Ceil(tb.tokens*float64(interval)))
+		fs.empty.Store(tb.published)
+	}
+	tb.mu.Unlock()
+}
+
+// fastLocked reports whether the bucket refills linearly from lastRefill
+// with no caller queued, so that allowFast can decide AllowN exactly.
+// Must be called with tb.mu held.
+func (tb *TokenBucket) fastLocked() bool {
+	switch {
+	case !tb.initialized || tb.cfg.store != nil || tb.waiters.len() > 0:
+		return false
+	case tb.rate.TokensPerSec <= 0 || tb.rate.TokensPerSec > float64(time.Second):
+		// No refill, or under a nanosecond per token
+		return false
+	case float64(tb.burst)/tb.rate.TokensPerSec > 1<<32:
+		// Filling the bucket takes too many nanoseconds for an int64
+		return false
+	case tb.cfg.warmup > 0 && tb.lastRefill.Before(tb.warmupStart.Add(tb.cfg.warmup)):
+		return false
+	}
+	// A refill time ahead of the clock holds the bucket, see capUntil
+	return !tb.lastRefill.After(tb.cfg.clock.Now())
+}
+
+// retryAfterLocked returns how long until n tokens are available behind
+// the queued waiters, or -1 if never at the current rate and burst.
+// Must be called with tb.mu held.
+func (tb *TokenBucket) retryAfterLocked(n int) time.Duration {
+	if n > tb.burst || tb.rate.TokensPerSec <= 0 {
+		return -1
+	}
+	deficit := float64(n+tb.waiters.tokens()) - tb.tokens
+	return time.Duration(math.Ceil(max(deficit, 0) / tb.rate.TokensPerSec * float64(time.Second)))
 }
 
 // WaitN blocks until n tokens are available or the context is canceled.
+// Blocked callers are queued and served one at a time in the order set by
+// WithFairness, FIFO by default. Requests larger than the burst fail unless
+// WithSplitWaits is set.
 func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if tb.cfg.split && n > tb.Burst() {
+		return waitSplit(ctx, n, tb.Burst, tb.waitN, tb.ReturnN)
+	}
+	return tb.waitN(ctx, n)
+}
+
+// waitN waits for n tokens at once.
+func (tb *TokenBucket) waitN(ctx context.Context, n int) error {
 	if n <= 0 {
 		return nil
 	}
 
+	if tb.cfg.store != nil {
+		if handled, err := tb.storeWaitN(ctx, n); handled {
+			return err
+		}
+	}
+
 	// Fast path: try to get tokens immediately
 	now := tb.cfg.clock.Now()
 	if tb.AllowN(now, n) {
@@ -106,64 +316,145 @@ func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
 	return tb.waitSlow(ctx, n, now)
 }
 
-// waitSlow handles the blocking wait for tokens.
+// waitSlow queues the request and blocks until the queue grants it.
 func (tb *TokenBucket) waitSlow(ctx context.Context, n int, now time.Time) error {
-	tb.mu.Lock()
+	obs := tb.cfg.obs.WithContext(ctx)
+
+	tb.lock()
 	tb.refillLocked(now)
 
 	if n > tb.burst {
-		tb.mu.Unlock()
-		return fmt.Errorf("ratelimit: requested %d tokens exceeds burst limit %d", n, tb.burst)
-	}
-
-	// Calculate wait time
-	deficit := float64(n) - tb.tokens
-	var waitDuration time.Duration
-	if tb.rate.TokensPerSec > 0 {
-		waitDuration = time.Duration(deficit / tb.rate.TokensPerSec * float64(time.Second))
-	} else {
-		tb.mu.Unlock()
-		<-ctx.Done()
-		return ctx.Err()
-	}
-
-	if tb.cfg.jitter > 0 {
-		jitter := rand.Float64() * tb.cfg.jitter * waitDuration.Seconds()
-		waitDuration += time.Duration(jitter * float64(time.Second))
+		tb.unlock()
+		return NewBurstExceededError(tb.cfg.name, n, tb.burst)
 	}
 
-	tb.mu.Unlock()
+	w := tb.waiters.push(n)
+	tb.waiters.dispatchLocked()
+	queued := tb.waiters.len()
+	tb.unlock()
 
-	tb.cfg.obs.Logger.Debug("rate limiter waiting",
+	obs.Logger.Debug("rate limiter waiting",
 		"limiter_name", tb.cfg.name,
 		"requested", n,
-		"wait_duration", waitDuration,
+		"queued", queued,
 	)
 
 	start := tb.cfg.clock.Now()
 
-	timer := tb.cfg.clock.AfterFunc(waitDuration, func() {})
-	defer timer.Stop()
-
 	select {
 	case <-ctx.Done():
-		tb.cfg.obs.Metrics.Inc("ion_ratelimit_requests_total",
-			"limiter_name", tb.cfg.name, "result", "canceled")
+		tb.lock()
+		if !tb.waiters.remove(w) && w.err == nil {
+			// Granted as ctx was canceled; hand the tokens to the next waiter
+			tb.tokens = math.Min(tb.tokens+float64(n), float64(tb.burst))
+		}
+		tb.waiters.dispatchLocked()
+		tb.unlock()
+
+		tb.results.record(obs.Metrics, tb.cfg.name, "canceled")
 		return ctx.Err()
 
-	case <-time.After(waitDuration):
-		// Try to acquire tokens again
-		now = tb.cfg.clock.Now()
-		if tb.AllowN(now, n) {
-			duration := tb.cfg.clock.Now().Sub(start)
-			tb.cfg.obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
-				duration.Seconds(), "limiter_name", tb.cfg.name)
-			return nil
+	case <-w.ready:
+		if w.err != nil {
+			return w.err
+		}
+		obs.Metrics.Histogram("ion_ratelimit_wait_duration_seconds",
+			tb.cfg.clock.Since(start).Seconds(), "limiter_name", tb.cfg.name)
+		return nil
+	}
+}
+
+// takeLocked takes n tokens for a queued waiter. See takeFunc.
+// Must be called with tb.mu held.
+func (tb *TokenBucket) takeLocked(n int) (time.Duration, error) {
+	tb.refillLocked(tb.cfg.clock.Now())
+
+	if n > tb.burst {
+		// The burst shrank while the request was queued
+		return 0, NewBurstExceededError(tb.cfg.name, n, tb.burst)
+	}
+
+	if float64(n) <= tb.tokens {
+		tb.tokens -= float64(n)
+		tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "allowed")
+		tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
+			tb.tokens, "limiter_name", tb.cfg.name)
+		return 0, nil
+	}
+
+	if tb.rate.TokensPerSec <= 0 {
+		return -1, nil
+	}
+	deficit := float64(n) - tb.tokens
+	return time.Duration(math.Ceil(deficit / tb.rate.TokensPerSec * float64(time.Second))), nil
+}
+
+// delayN returns how long until reserveN can take n tokens, without taking
+// them, or a negative duration if it never will at the current rate.
+// Queued waiters are served first, so the delay covers their tokens too and
+// lasts at least until the queue dispatches its next waiter.
+func (tb *TokenBucket) delayN(n int) (time.Duration, error) {
+	tb.lock()
+	defer tb.unlock()
+
+	now := tb.cfg.clock.Now()
+	tb.refillLocked(now)
+
+	if n > tb.burst {
+		return 0, NewBurstExceededError(tb.cfg.name, n, tb.burst)
+	}
+
+	var delay time.Duration
+	if deficit := float64(n+tb.waiters.tokens()) - tb.tokens; deficit > 0 {
+		if tb.rate.TokensPerSec <= 0 {
+			return -1, nil
 		}
+		delay = time.Duration(math.Ceil(deficit / tb.rate.TokensPerSec * float64(time.Second)))
+	}
+	if tb.waiters.len() > 0 {
+		delay = max(delay, tb.waiters.untilDispatch(now))
+	}
+	return delay, nil
+}
+
+// reserveN takes n tokens at time now if available, for a caller taking
+// tokens from several limiters at once. The caller must then call commitN
+// once the other limiters allowed the request, or cancelN otherwise. Only
+// a failed reservation is recorded here.
+func (tb *TokenBucket) reserveN(now time.Time, n int) bool {
+	tb.lock()
+	defer tb.unlock()
 
-		// Shouldn't happen with correct implementation, but handle gracefully
-		return fmt.Errorf("ratelimit: tokens not available after wait")
+	tb.refillLocked(now)
+
+	if tb.waiters.len() == 0 && float64(n) <= tb.tokens {
+		tb.tokens -= float64(n)
+		return true
 	}
+
+	tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "denied")
+	return false
+}
+
+// commitN records n tokens reserved by reserveN as allowed.
+func (tb *TokenBucket) commitN(n int) {
+	tb.lock()
+	defer tb.unlock()
+
+	tb.results.record(tb.cfg.obs.Metrics, tb.cfg.name, "allowed")
+	tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
+		tb.tokens, "limiter_name", tb.cfg.name)
+}
+
+// cancelN gives back n tokens reserved by reserveN. Unlike ReturnN, the
+// tokens were never used, so nothing is recorded.
+func (tb *TokenBucket) cancelN(n int) {
+	tb.lock()
+	defer tb.unlock()
+
+	tb.refillLocked(tb.cfg.clock.Now())
+	tb.tokens = math.Min(tb.tokens+float64(n), float64(tb.burst))
+	tb.waiters.dispatchLocked()
 }
 
 // refillLocked adds tokens to the bucket based on elapsed time.
@@ -171,6 +462,7 @@ func (tb *TokenBucket) waitSlow(ctx context.Context, n int, now time.Time) error
 func (tb *TokenBucket) refillLocked(now time.Time) {
 	if !tb.initialized {
 		tb.lastRefill = now
+		tb.warmupStart = now
 		tb.initialized = true
 		return
 	}
@@ -185,7 +477,7 @@ func (tb *TokenBucket) refillLocked(now time.Time) {
 	}
 
 	// Calculate tokens to add
-	tokensToAdd := tb.rate.TokensPerSec * elapsed.Seconds()
+	tokensToAdd := tb.rate.TokensPerSec * tb.rampedSeconds(tb.lastRefill, now)
 	tb.tokens = math.Min(tb.tokens+tokensToAdd, float64(tb.burst))
 	tb.lastRefill = now
 
@@ -193,10 +485,59 @@ func (tb *TokenBucket) refillLocked(now time.Time) {
 		tb.tokens, "limiter_name", tb.cfg.name)
 }
 
+// warmupFloor is the fraction of the rate and burst a TokenBucket starts
+// at with WithWarmup.
+const warmupFloor = 0.1
+
+// rampedSeconds returns the seconds from from to to, weighted by the
+// warm-up ramp, so that multiplied by the rate they give the tokens added.
+func (tb *TokenBucket) rampedSeconds(from, to time.Time) float64 {
+	warmup := tb.cfg.warmup
+	end := tb.warmupStart.Add(warmup)
+	if warmup <= 0 || !from.Before(end) {
+		return to.Sub(from).Seconds()
+	}
+
+	factor := func(t time.Time) float64 {
+		return warmupFloor + (1-warmupFloor)*t.Sub(tb.warmupStart).Seconds()/warmup.Seconds()
+	}
+	mid := to
+	if to.After(end) {
+		mid = end
+	}
+	// The ramp is linear, so its mean over [from, mid] is the mean of its ends
+	ramped := mid.Sub(from).Seconds() * (factor(from) + factor(mid)) / 2
+	return ramped + to.Sub(mid).Seconds()
+}
+
+// ReturnN gives back n tokens taken by AllowN or WaitN for an operation that
+// failed before consuming the guarded resource, for example a connection
+// refused immediately. Without refunds an error storm is penalized twice:
+// once by the errors and once by the tokens they burned. The bucket never
+// grows beyond its burst.
+func (tb *TokenBucket) ReturnN(n int) {
+	if n <= 0 {
+		return
+	}
+
+	tb.lock()
+	defer tb.unlock()
+
+	tb.refillLocked(tb.cfg.clock.Now())
+	tb.tokens = math.Min(tb.tokens+float64(n), float64(tb.burst))
+
+	tb.cfg.obs.Metrics.Add("ion_ratelimit_tokens_returned_total",
+		float64(n), "limiter_name", tb.cfg.name)
+	tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
+		tb.tokens, "limiter_name", tb.cfg.name)
+
+	tb.waiters.dispatchLocked()
+}
+
 // Tokens returns the current number of available tokens.
 func (tb *TokenBucket) Tokens() float64 {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 
 	tb.refillLocked(tb.cfg.clock.Now())
 	return tb.tokens
@@ -204,15 +545,15 @@ func (tb *TokenBucket) Tokens() float64 {
 
 // Rate returns the current token refill rate.
 func (tb *TokenBucket) Rate() Rate {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 	return tb.rate
 }
 
 // Burst returns the bucket capacity.
 func (tb *TokenBucket) Burst() int {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 	return tb.burst
 }
 
@@ -222,8 +563,8 @@ func (tb *TokenBucket) SetRate(rate Rate) {
 		return
 	}
 
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 
 	tb.refillLocked(tb.cfg.clock.Now())
 	tb.rate = rate
@@ -232,6 +573,8 @@ func (tb *TokenBucket) SetRate(rate Rate) {
 		"limiter_name", tb.cfg.name,
 		"new_rate", rate.String(),
 	)
+
+	tb.waiters.dispatchLocked()
 }
 
 // SetBurst updates the bucket capacity dynamically.
@@ -241,8 +584,8 @@ func (tb *TokenBucket) SetBurst(burst int) {
 		return
 	}
 
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 
 	tb.burst = burst
 	if tb.tokens > float64(burst) {
@@ -253,6 +596,8 @@ func (tb *TokenBucket) SetBurst(burst int) {
 		"limiter_name", tb.cfg.name,
 		"new_burst", burst,
 	)
+
+	tb.waiters.dispatchLocked()
 }
 
 // SetTemporaryLimit applies a temporary rate limit that reverts after duration.
@@ -262,8 +607,8 @@ func (tb *TokenBucket) SetTemporaryLimit(rate Rate, burst int, duration time.Dur
 		return
 	}
 
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 
 	if tb.tempLimit != nil && tb.tempLimit.timer != nil {
 		tb.tempLimit.timer.Stop()
@@ -292,12 +637,14 @@ func (tb *TokenBucket) SetTemporaryLimit(rate Rate, burst int, duration time.Dur
 	tb.tempLimit.timer = tb.cfg.clock.AfterFunc(duration, func() {
 		tb.revertTemporaryLimit()
 	})
+
+	tb.waiters.dispatchLocked()
 }
 
 // revertTemporaryLimit restores the original rate and burst.
 func (tb *TokenBucket) revertTemporaryLimit() {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 
 	if tb.tempLimit == nil {
 		return
@@ -312,13 +659,15 @@ func (tb *TokenBucket) revertTemporaryLimit() {
 		"rate", tb.rate.String(),
 		"burst", tb.burst,
 	)
+
+	tb.waiters.dispatchLocked()
 }
 
 // DrainTo sets the token count to a specific value.
 // This is useful for syncing with external rate limit state (e.g., API remaining count).
 func (tb *TokenBucket) DrainTo(tokens int) {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+	tb.lock()
+	defer tb.unlock()
 
 	if tokens < 0 {
 		tokens = 0
@@ -336,16 +685,60 @@ func (tb *TokenBucket) DrainTo(tokens int) {
 	)
 	tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
 		tb.tokens, "limiter_name", tb.cfg.name)
+
+	tb.waiters.dispatchLocked()
+}
+
+// holdFor empties the bucket so that the next token becomes available once d
+// has passed, as after an upstream rate limit response.
+func (tb *TokenBucket) holdFor(d time.Duration) {
+	tb.lock()
+	defer tb.unlock()
+
+	now := tb.cfg.clock.Now()
+	tb.refillLocked(now)
+	if tb.rate.TokensPerSec > 0 {
+		tb.tokens = math.Min(tb.tokens, 1-tb.rate.TokensPerSec*d.Seconds())
+	} else {
+		tb.tokens = 0
+	}
+	tb.lastRefill = now
+
+	tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
+		tb.tokens, "limiter_name", tb.cfg.name)
+
+	tb.waiters.dispatchLocked()
+}
+
+// capUntil lowers the bucket to at most n tokens and stops it refilling
+// until d has passed, as when an upstream reports n requests left until its
+// window resets. The bucket is never raised: its own count may include
+// requests the upstream has not seen yet.
+func (tb *TokenBucket) capUntil(n int, d time.Duration) {
+	tb.lock()
+	defer tb.unlock()
+
+	now := tb.cfg.clock.Now()
+	tb.refillLocked(now)
+	tb.tokens = math.Min(tb.tokens, float64(n))
+	if until := now.Add(d); until.After(tb.lastRefill) {
+		tb.lastRefill = until
+	}
+
+	tb.cfg.obs.Metrics.Gauge("ion_ratelimit_tokens_available",
+		tb.tokens, "limiter_name", tb.cfg.name)
+
+	tb.waiters.dispatchLocked()
 }
 
 // ClearTemporaryLimit cancels any active temporary limit and restores original values.
 func (tb *TokenBucket) ClearTemporaryLimit() {
-	tb.mu.Lock()
+	tb.lock()
 
 	if tb.tempLimit != nil && tb.tempLimit.timer != nil {
 		tb.tempLimit.timer.Stop()
 	}
-	tb.mu.Unlock()
+	tb.unlock()
 
 	tb.revertTemporaryLimit()
 }
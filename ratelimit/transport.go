@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"net/http"
+)
+
+// RequestFunc maps an outbound HTTP request to the Request a
+// MultiTierLimiter limits it as, naming its route and resources.
+type RequestFunc func(r *http.Request) *Request
+
+// WithRequestFunc sets how a Transport maps HTTP requests to limiter
+// requests. The default limits each method and URL path as a route. It has
+// no effect on limiters.
+func WithRequestFunc(fn RequestFunc) Option {
+	return func(c *config) {
+		c.requestFunc = fn
+	}
+}
+
+// Transport is an http.RoundTripper that waits on a MultiTierLimiter
+// before sending each request and updates it from each response, so an API
+// client is rate limited by setting it as the client's transport.
+//
+// Usage:
+//
+//	limiter := ratelimit.NewMultiTierLimiter(config)
+//	client := &http.Client{
+//		Transport: ratelimit.NewTransport(limiter, nil),
+//	}
+type Transport struct {
+	limiter *MultiTierLimiter
+	base    http.RoundTripper
+	request RequestFunc
+}
+
+// NewTransport creates a transport that sends requests through base, or
+// http.DefaultTransport if base is nil, once limiter allows them. Requests
+// wait on the limiter until their context is done. Each response is passed
+// to UpdateFromResponse, so rate limit headers and 429 responses pause the
+// limiter or hold back the route. Only the WithRequestFunc option applies.
+func NewTransport(limiter *MultiTierLimiter, base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := newConfig(opts...)
+	request := cfg.requestFunc
+	if request == nil {
+		request = requestOf
+	}
+
+	return &Transport{
+		limiter: limiter,
+		base:    base,
+		request: request,
+	}
+}
+
+// RoundTrip implements http.RoundTripper. It returns the limiter's error,
+// such as the context's, if the request is not allowed.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	req := t.request(r)
+	if req.Context == nil {
+		req.Context = r.Context()
+	}
+
+	if err := t.limiter.Wait(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.limiter.UpdateFromResponse(req, resp); err != nil {
+		// The response is still usable; only its retry information was lost
+		t.limiter.cfg.obs.WithContext(r.Context()).Logger.Warn("rate limit response not applied",
+			"limiter_name", t.limiter.cfg.name,
+			"endpoint", req.Endpoint,
+			"error", err,
+		)
+	}
+	return resp, nil
+}
+
+// requestOf is the default RequestFunc.
+func requestOf(r *http.Request) *Request {
+	return &Request{
+		Method:   r.Method,
+		Endpoint: r.URL.Path,
+		Context:  r.Context(),
+	}
+}
@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Fairness defines the order in which blocked WaitN callers are served.
+type Fairness int
+
+const (
+	// FIFO serves waiters in first-in-first-out order (default)
+	FIFO Fairness = iota
+	// LIFO serves waiters in last-in-first-out order, favoring fresh
+	// requests over ones that may have already given up
+	LIFO
+)
+
+// String returns a string representation of the fairness mode.
+func (f Fairness) String() string {
+	switch f {
+	case FIFO:
+		return "FIFO"
+	case LIFO:
+		return "LIFO"
+	default:
+		return fmt.Sprintf("Fairness(%d)", int(f))
+	}
+}
+
+// waiter is a WaitN caller blocked in a waitQueue.
+type waiter struct {
+	n     int
+	ready chan struct{} // closed once the request is granted or failed
+	err   error         // set before ready is closed if the request failed
+}
+
+// takeFunc tries to take n tokens from a limiter. It returns 0 and a nil
+// error if they were taken, how long until they may be available if not, or
+// a negative duration if that cannot be known, as with a zero rate. An error
+// fails the waiter. It is called with the limiter mutex held.
+type takeFunc func(n int) (time.Duration, error)
+
+// waitQueue hands tokens to blocked WaitN callers one at a time, in the
+// order given by its fairness. Only the waiter at the front of the queue is
+// considered: one timer tracks when it can be served, and exactly that
+// waiter wakes when it is, instead of every waiter sleeping on its own and
+// racing for the tokens on wake. All methods must be called with the
+// limiter mutex held.
+type waitQueue struct {
+	fairness Fairness
+	clock    Clock
+	jitter   JitterFunc
+	take     takeFunc
+	wake     func() // timer callback; locks the limiter and calls dispatchLocked
+
+	waiters []*waiter
+	timer   Timer
+	at      time.Time // when timer fires
+}
+
+// push queues a request for n tokens and returns its waiter. The caller
+// should call dispatchLocked afterwards.
+func (q *waitQueue) push(n int) *waiter {
+	w := &waiter{n: n, ready: make(chan struct{})}
+	q.waiters = append(q.waiters, w)
+	return w
+}
+
+// next returns the index of the waiter to serve next.
+func (q *waitQueue) next() int {
+	if q.fairness == LIFO {
+		return len(q.waiters) - 1
+	}
+	return 0
+}
+
+// remove takes w out of the queue and reports whether it was queued. A
+// waiter that is no longer queued has been granted or failed.
+func (q *waitQueue) remove(w *waiter) bool {
+	for i, qw := range q.waiters {
+		if qw == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// tokens returns the number of tokens requested by queued waiters.
+func (q *waitQueue) tokens() int {
+	total := 0
+	for _, w := range q.waiters {
+		total += w.n
+	}
+	return total
+}
+
+// len returns the number of queued waiters.
+func (q *waitQueue) len() int {
+	return len(q.waiters)
+}
+
+// untilDispatch returns how long until the timer serves the next waiter, or
+// 0 if none is armed.
+func (q *waitQueue) untilDispatch(now time.Time) time.Duration {
+	if q.timer == nil {
+		return 0
+	}
+	return max(q.at.Sub(now), 0)
+}
+
+// waitSplit waits for n tokens in chunks of at most the current burst, for
+// WithSplitWaits. If a chunk fails, the chunks already taken are returned.
+func waitSplit(ctx context.Context, n int, burst func() int, wait func(context.Context, int) error, refund func(int)) error {
+	taken := 0
+	for taken < n {
+		// A zero burst makes a chunk of one fail as too large
+		chunk := min(n-taken, max(burst(), 1))
+		if err := wait(ctx, chunk); err != nil {
+			refund(taken)
+			return err
+		}
+		taken += chunk
+	}
+	return nil
+}
+
+// dispatchLocked grants queued requests in order while the limiter can
+// satisfy them, then arms the timer for the next one. Call it whenever
+// tokens may have become available ahead of schedule, as after a refund or
+// a rate change.
+func (q *waitQueue) dispatchLocked() {
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+
+	for len(q.waiters) > 0 {
+		i := q.next()
+		w := q.waiters[i]
+
+		wait, err := q.take(w.n)
+		if err == nil && wait > 0 {
+			wait = q.jitter(wait)
+			q.timer = q.clock.AfterFunc(wait, q.wake)
+			q.at = q.clock.Now().Add(wait)
+			return
+		}
+		if err == nil && wait < 0 {
+			// No telling when tokens arrive; wait for the next dispatch
+			return
+		}
+
+		q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+		w.err = err
+		close(w.ready)
+	}
+}
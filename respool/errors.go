@@ -0,0 +1,64 @@
+package respool
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPoolClosed is returned (wrapped) by Get after Close has been called.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// PoolError represents resource pool errors with context
+type PoolError struct {
+	Op       string // operation that failed
+	PoolName string // name of the pool
+	Err      error  // underlying error
+}
+
+func (e *PoolError) Error() string {
+	if e.PoolName != "" {
+		return fmt.Sprintf("ion: respool %q %s: %v", e.PoolName, e.Op, e.Err)
+	}
+	return fmt.Sprintf("ion: respool %s: %v", e.Op, e.Err)
+}
+
+func (e *PoolError) Unwrap() error {
+	return e.Err
+}
+
+// NewPoolClosedError creates an error indicating the pool is closed
+func NewPoolClosedError(poolName string) error {
+	return &PoolError{
+		Op:       "get",
+		PoolName: poolName,
+		Err:      ErrPoolClosed,
+	}
+}
+
+// NewDestroyError creates an error for a failure to destroy a resource
+func NewDestroyError(poolName string, err error) error {
+	return &PoolError{
+		Op:       "destroy",
+		PoolName: poolName,
+		Err:      err,
+	}
+}
+
+// NewCloseTimeoutError creates an error indicating close gave up waiting for
+// borrowed resources to be returned
+func NewCloseTimeoutError(poolName string, inUse int, err error) error {
+	return &PoolError{
+		Op:       "close",
+		PoolName: poolName,
+		Err:      fmt.Errorf("timed out with %d resources in use: %w", inUse, err),
+	}
+}
+
+// NewFactoryError creates an error for a failure to create a resource
+func NewFactoryError(poolName string, err error) error {
+	return &PoolError{
+		Op:       "create",
+		PoolName: poolName,
+		Err:      err,
+	}
+}
@@ -0,0 +1,674 @@
+// Package respool provides a generic pool of reusable resources.
+//
+// Where workerpool bounds how many tasks run at once, respool bounds how many
+// expensive resources (connections, sessions, large buffers) exist at once and
+// hands them out for reuse. The pool keeps at least a minimum number of
+// resources warm, never creates more than a maximum, reaps resources that sit
+// idle or exceed their lifetime, and discards resources that fail a health
+// check. Get waits for a resource with context cancellation.
+//
+// Usage:
+//
+//	pool := respool.New(func(ctx context.Context) (*Conn, error) {
+//		return Dial(ctx, addr)
+//	},
+//		respool.WithMaxSize(16),
+//		respool.WithDestroy(func(c *Conn) error { return c.Close() }),
+//	)
+//	defer pool.Close(context.Background())
+//
+//	res, err := pool.Get(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer res.Release()
+//	return res.Value().Do(req)
+package respool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+)
+
+// Factory creates a new resource.
+type Factory[T any] func(ctx context.Context) (T, error)
+
+// Metrics holds a snapshot of pool counters.
+type Metrics struct {
+	Total               int           // resources currently owned by the pool (idle + in use)
+	Idle                int           // resources waiting to be borrowed
+	InUse               int           // resources currently borrowed
+	Waiting             int64         // callers blocked in Get
+	Created             uint64        // resources created
+	Destroyed           uint64        // resources destroyed
+	Acquired            uint64        // successful Get calls
+	WaitCount           uint64        // Get calls that had to wait for a resource
+	WaitDuration        time.Duration // total time spent waiting in Get
+	HealthCheckFailures uint64        // resources discarded by a failed health check
+}
+
+// Option configures pool behavior.
+type Option func(*config)
+
+type config struct {
+	name          string
+	minSize       int
+	maxSize       int
+	maxIdleTime   time.Duration
+	maxLifetime   time.Duration
+	reapInterval  time.Duration
+	checkOnGet    bool
+	destroy       func(any) error
+	healthCheck   func(context.Context, any) error
+	healthTimeout time.Duration
+	clock         clock.Clock
+	obs           *observe.Observability
+}
+
+// WithName sets the pool name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithMinSize sets the number of resources the pool keeps warm. The reaper
+// creates resources in the background until the pool holds at least this
+// many. The default is 0.
+func WithMinSize(n int) Option {
+	return func(c *config) {
+		c.minSize = n
+	}
+}
+
+// WithMaxSize sets the maximum number of resources the pool will own. Get
+// blocks once this many are in use. The default is 10.
+func WithMaxSize(n int) Option {
+	return func(c *config) {
+		c.maxSize = n
+	}
+}
+
+// WithMaxIdleTime destroys resources that have not been borrowed for d, as
+// long as the pool stays at or above its minimum size. Zero disables idle
+// reaping. The default is 5 minutes.
+func WithMaxIdleTime(d time.Duration) Option {
+	return func(c *config) {
+		c.maxIdleTime = d
+	}
+}
+
+// WithMaxLifetime destroys resources older than d when they are returned or
+// found idle. Zero (the default) means resources live forever.
+func WithMaxLifetime(d time.Duration) Option {
+	return func(c *config) {
+		c.maxLifetime = d
+	}
+}
+
+// WithReapInterval sets how often idle resources are reaped, health checked
+// and the minimum size is restored. The default is 30 seconds.
+func WithReapInterval(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.reapInterval = d
+		}
+	}
+}
+
+// WithDestroy sets the function that releases a resource when the pool
+// discards it. T must match the resource type of the pool.
+func WithDestroy[T any](destroy func(T) error) Option {
+	return func(c *config) {
+		c.destroy = func(v any) error { return destroy(v.(T)) }
+	}
+}
+
+// WithHealthCheck sets a function that reports whether a resource is still
+// usable. It runs on idle resources every reap interval and, with
+// WithCheckOnGet, before a resource is handed out. Resources that fail are
+// destroyed. T must match the resource type of the pool.
+func WithHealthCheck[T any](check func(ctx context.Context, v T) error) Option {
+	return func(c *config) {
+		c.healthCheck = func(ctx context.Context, v any) error { return check(ctx, v.(T)) }
+	}
+}
+
+// WithCheckOnGet runs the health check on every idle resource before Get
+// returns it.
+func WithCheckOnGet(enabled bool) Option {
+	return func(c *config) {
+		c.checkOnGet = enabled
+	}
+}
+
+// WithHealthCheckTimeout bounds each health check. The default is 5 seconds.
+func WithHealthCheckTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.healthTimeout = d
+	}
+}
+
+// WithClock sets the clock used for idle and lifetime expiry, reaping, wait
+// durations and health check timeouts.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// Resource is a borrowed resource. It must be returned with Release or
+// Discard exactly once.
+type Resource[T any] struct {
+	pool      *Pool[T]
+	value     T
+	createdAt time.Time
+	idleSince time.Time
+	returned  bool
+}
+
+// Value returns the underlying resource.
+func (r *Resource[T]) Value() T {
+	return r.value
+}
+
+// CreatedAt returns when the resource was created.
+func (r *Resource[T]) CreatedAt() time.Time {
+	return r.createdAt
+}
+
+// Release returns the resource to the pool for reuse. Calls after the first
+// Release or Discard have no effect.
+func (r *Resource[T]) Release() {
+	r.pool.put(r, false)
+}
+
+// Discard destroys the resource instead of returning it to the pool, for
+// example after a connection error. Calls after the first Release or Discard
+// have no effect.
+func (r *Resource[T]) Discard() {
+	r.pool.put(r, true)
+}
+
+// Pool is a bounded pool of reusable resources.
+type Pool[T any] struct {
+	name          string
+	factory       Factory[T]
+	minSize       int
+	maxIdleTime   time.Duration
+	maxLifetime   time.Duration
+	checkOnGet    bool
+	destroyFn     func(any) error
+	healthCheck   func(context.Context, any) error
+	healthTimeout time.Duration
+	clock         clock.Clock
+	obs           *observe.Observability
+
+	// slots holds one token per resource that is borrowed or being created,
+	// which keeps the number of resources at or below the maximum size.
+	slots chan struct{}
+
+	mu      sync.Mutex
+	idle    []*Resource[T] // LIFO, most recently used last
+	total   int
+	closed  bool
+	drained chan struct{} // closed once the pool is closed and empty
+	metrics Metrics
+
+	closeCh chan struct{}
+	reaper  sync.WaitGroup
+}
+
+// New creates a resource pool that creates resources with factory.
+func New[T any](factory Factory[T], opts ...Option) *Pool[T] {
+	if factory == nil {
+		panic("respool: factory must not be nil")
+	}
+
+	cfg := &config{
+		name:          "",
+		maxSize:       10,
+		maxIdleTime:   5 * time.Minute,
+		reapInterval:  30 * time.Second,
+		healthTimeout: 5 * time.Second,
+		clock:         clock.Real(),
+		obs:           observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.maxSize <= 0 {
+		cfg.maxSize = 10
+	}
+	if cfg.minSize < 0 {
+		cfg.minSize = 0
+	}
+	if cfg.minSize > cfg.maxSize {
+		cfg.minSize = cfg.maxSize
+	}
+
+	p := &Pool[T]{
+		name:          cfg.name,
+		factory:       factory,
+		minSize:       cfg.minSize,
+		maxIdleTime:   cfg.maxIdleTime,
+		maxLifetime:   cfg.maxLifetime,
+		checkOnGet:    cfg.checkOnGet,
+		destroyFn:     cfg.destroy,
+		healthCheck:   cfg.healthCheck,
+		healthTimeout: cfg.healthTimeout,
+		clock:         cfg.clock,
+		obs:           cfg.obs,
+		slots:         make(chan struct{}, cfg.maxSize),
+		drained:       make(chan struct{}),
+		closeCh:       make(chan struct{}),
+	}
+
+	p.reaper.Add(1)
+	go p.reap(cfg.reapInterval)
+
+	p.obs.Logger.Info("respool created",
+		"name", p.name,
+		"min_size", cfg.minSize,
+		"max_size", cfg.maxSize,
+	)
+
+	return p
+}
+
+// Get borrows a resource, creating one if none is idle and the pool is below
+// its maximum size. It blocks while the pool is exhausted until a resource is
+// returned, ctx is done or the pool is closed.
+func (p *Pool[T]) Get(ctx context.Context) (*Resource[T], error) {
+	if err := p.acquireSlot(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			<-p.slots
+			return nil, NewPoolClosedError(p.name)
+		}
+
+		n := len(p.idle)
+		if n == 0 {
+			p.total++
+			p.mu.Unlock()
+			return p.create(ctx)
+		}
+
+		r := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		if p.expired(r, p.clock.Now()) {
+			p.destroy(r, "expired")
+			continue
+		}
+		if p.checkOnGet && !p.healthy(ctx, r) {
+			continue
+		}
+
+		p.mu.Lock()
+		r.returned = false
+		p.metrics.Acquired++
+		p.mu.Unlock()
+		return r, nil
+	}
+}
+
+// acquireSlot takes a slot token, waiting if the pool is exhausted.
+func (p *Pool[T]) acquireSlot(ctx context.Context) error {
+	obs := p.obs.WithContext(ctx)
+
+	select {
+	case <-p.closeCh:
+		return NewPoolClosedError(p.name)
+	default:
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	p.mu.Lock()
+	p.metrics.Waiting++
+	p.mu.Unlock()
+	obs.Metrics.Inc("ion_respool_waits_total", "pool_name", p.name)
+
+	start := p.clock.Now()
+	var err error
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-p.closeCh:
+		err = NewPoolClosedError(p.name)
+	}
+	waited := p.clock.Since(start)
+
+	p.mu.Lock()
+	p.metrics.Waiting--
+	p.metrics.WaitCount++
+	p.metrics.WaitDuration += waited
+	p.mu.Unlock()
+	obs.Metrics.Histogram("ion_respool_wait_duration_seconds", waited.Seconds(), "pool_name", p.name)
+
+	return err
+}
+
+// create builds a new resource for a caller that already holds a slot and
+// has reserved it in total.
+func (p *Pool[T]) create(ctx context.Context) (*Resource[T], error) {
+	v, err := p.factory(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.total--
+		p.signalDrainedLocked()
+		p.mu.Unlock()
+		<-p.slots
+
+		obs := p.obs.WithContext(ctx)
+		obs.Logger.Error("failed to create resource", err, "pool_name", p.name)
+		obs.Metrics.Inc("ion_respool_create_errors_total", "pool_name", p.name)
+		return nil, NewFactoryError(p.name, err)
+	}
+
+	r := &Resource[T]{pool: p, value: v, createdAt: p.clock.Now()}
+
+	p.mu.Lock()
+	p.metrics.Created++
+	p.metrics.Acquired++
+	p.mu.Unlock()
+	p.obs.WithContext(ctx).Metrics.Inc("ion_respool_created_total", "pool_name", p.name)
+
+	return r, nil
+}
+
+// put returns a borrowed resource and frees its slot.
+func (p *Pool[T]) put(r *Resource[T], discard bool) {
+	p.mu.Lock()
+	if r.returned {
+		p.mu.Unlock()
+		return
+	}
+	r.returned = true
+
+	now := p.clock.Now()
+	if discard || p.closed || p.expired(r, now) {
+		p.mu.Unlock()
+		<-p.slots
+		p.destroy(r, "released")
+		return
+	}
+
+	r.idleSince = now
+	p.idle = append(p.idle, r)
+	p.mu.Unlock()
+	<-p.slots
+}
+
+// expired reports whether r has outlived its maximum lifetime.
+func (p *Pool[T]) expired(r *Resource[T], now time.Time) bool {
+	return p.maxLifetime > 0 && now.Sub(r.createdAt) >= p.maxLifetime
+}
+
+// healthy runs the health check on r and destroys it if the check fails.
+func (p *Pool[T]) healthy(ctx context.Context, r *Resource[T]) bool {
+	if p.healthCheck == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := p.clock.AfterFunc(p.healthTimeout, func() { cancel(context.DeadlineExceeded) })
+	defer timer.Stop()
+
+	if err := p.healthCheck(ctx, r.value); err != nil {
+		p.mu.Lock()
+		p.metrics.HealthCheckFailures++
+		p.mu.Unlock()
+		p.obs.WithContext(ctx).Logger.Warn("resource failed health check", "pool_name", p.name, "error", err)
+		p.destroy(r, "unhealthy")
+		return false
+	}
+	return true
+}
+
+// destroy releases a resource that is no longer owned by any caller. It
+// returns the error from the destroy function, if any.
+func (p *Pool[T]) destroy(r *Resource[T], reason string) error {
+	var err error
+	if p.destroyFn != nil {
+		if err = p.destroyFn(r.value); err != nil {
+			p.obs.Logger.Warn("failed to destroy resource", "pool_name", p.name, "error", err)
+			err = NewDestroyError(p.name, err)
+		}
+	}
+
+	p.mu.Lock()
+	p.total--
+	p.metrics.Destroyed++
+	p.signalDrainedLocked()
+	p.mu.Unlock()
+
+	p.obs.Metrics.Inc("ion_respool_destroyed_total", "pool_name", p.name, "reason", reason)
+	return err
+}
+
+// signalDrainedLocked closes drained once a closed pool owns no resources.
+// Must be called with p.mu held.
+func (p *Pool[T]) signalDrainedLocked() {
+	if p.closed && p.total == 0 {
+		select {
+		case <-p.drained:
+		default:
+			close(p.drained)
+		}
+	}
+}
+
+// reap periodically removes idle and expired resources, health checks the
+// rest and restores the minimum size.
+func (p *Pool[T]) reap(interval time.Duration) {
+	defer p.reaper.Done()
+
+	p.fill()
+
+	ticker := p.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closeCh:
+			return
+		case <-ticker.C():
+			p.reapIdle()
+			p.fill()
+		}
+	}
+}
+
+// reapIdle removes idle resources that are expired or idle too long, then
+// health checks the rest.
+func (p *Pool[T]) reapIdle() {
+	now := p.clock.Now()
+
+	p.mu.Lock()
+	var stale []*Resource[T]
+	keep := p.idle[:0]
+	for _, r := range p.idle {
+		switch {
+		case p.expired(r, now):
+			stale = append(stale, r)
+		case p.maxIdleTime > 0 && now.Sub(r.idleSince) >= p.maxIdleTime &&
+			p.total-len(stale) > p.minSize:
+			stale = append(stale, r)
+		default:
+			keep = append(keep, r)
+		}
+	}
+	clear(p.idle[len(keep):])
+	p.idle = keep
+	checks := len(keep)
+	p.mu.Unlock()
+
+	for _, r := range stale {
+		p.destroy(r, "idle")
+	}
+
+	if p.healthCheck == nil {
+		return
+	}
+
+	// Each resource under check holds a slot, like a borrowed one, so the
+	// pool never exceeds its maximum size while checks run. Checks stop as
+	// soon as callers need the slots.
+	for ; checks > 0; checks-- {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		p.mu.Lock()
+		if p.closed || len(p.idle) == 0 {
+			p.mu.Unlock()
+			<-p.slots
+			return
+		}
+		r := p.idle[0] // least recently used
+		p.idle = p.idle[1:]
+		p.mu.Unlock()
+
+		if p.healthy(context.Background(), r) {
+			p.mu.Lock()
+			if p.closed {
+				p.mu.Unlock()
+				p.destroy(r, "closed")
+			} else {
+				p.idle = append([]*Resource[T]{r}, p.idle...)
+				p.mu.Unlock()
+			}
+		}
+		<-p.slots
+	}
+}
+
+// fill creates idle resources until the pool reaches its minimum size. It
+// only uses free slots, so it never competes with waiting callers.
+func (p *Pool[T]) fill() {
+	for {
+		p.mu.Lock()
+		if p.closed || p.total >= p.minSize {
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		p.mu.Lock()
+		p.total++
+		p.mu.Unlock()
+
+		r, err := p.create(context.Background())
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		p.metrics.Acquired--
+		p.mu.Unlock()
+		r.Release()
+	}
+}
+
+// Name returns the pool name.
+func (p *Pool[T]) Name() string {
+	return p.name
+}
+
+// Metrics returns a snapshot of the pool counters.
+func (p *Pool[T]) Metrics() Metrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := p.metrics
+	m.Total = p.total
+	m.Idle = len(p.idle)
+	m.InUse = p.total - len(p.idle)
+	return m
+}
+
+// Close stops handing out resources, destroys idle ones and waits until every
+// borrowed resource has been returned (and destroyed) or ctx is done.
+//
+// The returned error joins the failures to destroy idle resources with a
+// timeout waiting for borrowed ones.
+func (p *Pool[T]) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closeCh)
+	idle := p.idle
+	p.idle = nil
+	p.signalDrainedLocked()
+	p.mu.Unlock()
+
+	p.reaper.Wait()
+
+	var errs []error
+	for _, r := range idle {
+		if err := p.destroy(r, "closed"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	p.obs.WithContext(ctx).Logger.Info("respool closing", "name", p.name)
+
+	select {
+	case <-p.drained:
+	case <-ctx.Done():
+		errs = append(errs, NewCloseTimeoutError(p.name, p.Metrics().InUse, ctx.Err()))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,283 @@
+package respool_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/respool"
+)
+
+type conn struct {
+	id      int64
+	healthy atomic.Bool
+	closed  atomic.Bool
+}
+
+type factory struct {
+	next    atomic.Int64
+	mu      sync.Mutex
+	created []*conn
+	fail    error
+}
+
+func (f *factory) new(ctx context.Context) (*conn, error) {
+	if f.fail != nil {
+		return nil, f.fail
+	}
+	c := &conn{id: f.next.Add(1)}
+	c.healthy.Store(true)
+	f.mu.Lock()
+	f.created = append(f.created, c)
+	f.mu.Unlock()
+	return c, nil
+}
+
+func closeConn(c *conn) error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	t.Run("reuses resources", func(t *testing.T) {
+		f := &factory{}
+		p := respool.New(f.new, respool.WithDestroy(closeConn))
+		defer p.Close(context.Background())
+
+		r1, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		id := r1.Value().id
+		r1.Release()
+		r1.Release() // second release is a no-op
+
+		r2, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if r2.Value().id != id {
+			t.Errorf("expected resource %d to be reused, got %d", id, r2.Value().id)
+		}
+		r2.Release()
+
+		if m := p.Metrics(); m.Created != 1 || m.Acquired != 2 || m.Idle != 1 {
+			t.Errorf("unexpected metrics: %+v", m)
+		}
+	})
+
+	t.Run("max size blocks until release", func(t *testing.T) {
+		f := &factory{}
+		p := respool.New(f.new, respool.WithMaxSize(2))
+		defer p.Close(context.Background())
+
+		a, _ := p.Get(context.Background())
+		b, _ := p.Get(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := p.Get(ctx); err != context.DeadlineExceeded {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+
+		got := make(chan *respool.Resource[*conn])
+		go func() {
+			r, _ := p.Get(context.Background())
+			got <- r
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		a.Release()
+
+		select {
+		case r := <-got:
+			r.Release()
+		case <-time.After(time.Second):
+			t.Fatal("waiter was not woken by release")
+		}
+		b.Release()
+
+		if m := p.Metrics(); m.Created != 2 || m.WaitCount != 2 {
+			t.Errorf("unexpected metrics: %+v", m)
+		}
+	})
+
+	t.Run("discard destroys", func(t *testing.T) {
+		f := &factory{}
+		p := respool.New(f.new, respool.WithDestroy(closeConn))
+		defer p.Close(context.Background())
+
+		r, _ := p.Get(context.Background())
+		r.Discard()
+		if !r.Value().closed.Load() {
+			t.Error("expected discarded resource to be destroyed")
+		}
+		if m := p.Metrics(); m.Total != 0 || m.Destroyed != 1 {
+			t.Errorf("unexpected metrics: %+v", m)
+		}
+	})
+
+	t.Run("min size and idle reaping", func(t *testing.T) {
+		f := &factory{}
+		p := respool.New(f.new,
+			respool.WithMinSize(2),
+			respool.WithMaxIdleTime(20*time.Millisecond),
+			respool.WithReapInterval(5*time.Millisecond),
+			respool.WithDestroy(closeConn),
+		)
+		defer p.Close(context.Background())
+
+		waitFor(t, func() bool { return p.Metrics().Idle == 2 })
+
+		var held []*respool.Resource[*conn]
+		for i := 0; i < 4; i++ {
+			r, _ := p.Get(context.Background())
+			held = append(held, r)
+		}
+		for _, r := range held {
+			r.Release()
+		}
+
+		// Idle resources above the minimum are reaped.
+		waitFor(t, func() bool { return p.Metrics().Total == 2 })
+	})
+
+	t.Run("health checks", func(t *testing.T) {
+		f := &factory{}
+		p := respool.New(f.new,
+			respool.WithHealthCheck(func(ctx context.Context, c *conn) error {
+				if !c.healthy.Load() {
+					return errors.New("broken")
+				}
+				return nil
+			}),
+			respool.WithCheckOnGet(true),
+			respool.WithDestroy(closeConn),
+		)
+		defer p.Close(context.Background())
+
+		r, _ := p.Get(context.Background())
+		bad := r.Value()
+		bad.healthy.Store(false)
+		r.Release()
+
+		r, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if r.Value() == bad {
+			t.Error("expected unhealthy resource to be replaced")
+		}
+		if !bad.closed.Load() {
+			t.Error("expected unhealthy resource to be destroyed")
+		}
+		r.Release()
+
+		if m := p.Metrics(); m.HealthCheckFailures != 1 {
+			t.Errorf("expected 1 health check failure, got %d", m.HealthCheckFailures)
+		}
+	})
+
+	t.Run("max lifetime on the pool clock", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		f := &factory{}
+		p := respool.New(f.new,
+			respool.WithClock(clk),
+			respool.WithMaxLifetime(time.Hour),
+			respool.WithReapInterval(24*time.Hour),
+			respool.WithDestroy(closeConn),
+		)
+		defer p.Close(context.Background())
+
+		r, _ := p.Get(context.Background())
+		old := r.Value()
+		r.Release()
+
+		clk.Advance(time.Hour)
+		r, _ = p.Get(context.Background())
+		defer r.Release()
+		if r.Value() == old || !old.closed.Load() {
+			t.Error("expected the expired resource to be destroyed and replaced")
+		}
+	})
+
+	t.Run("factory error", func(t *testing.T) {
+		boom := errors.New("dial failed")
+		f := &factory{fail: boom}
+		p := respool.New(f.new, respool.WithMaxSize(1))
+		defer p.Close(context.Background())
+
+		for i := 0; i < 3; i++ {
+			_, err := p.Get(context.Background())
+			if !errors.Is(err, boom) {
+				t.Fatalf("expected factory error, got %v", err)
+			}
+		}
+		if m := p.Metrics(); m.Total != 0 {
+			t.Errorf("expected failed creations to free their slot, got %+v", m)
+		}
+	})
+
+	t.Run("close waits for borrowed resources", func(t *testing.T) {
+		f := &factory{}
+		p := respool.New(f.new, respool.WithDestroy(closeConn))
+
+		idle, _ := p.Get(context.Background())
+		busy, _ := p.Get(context.Background())
+		idle.Release()
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			busy.Release()
+		}()
+
+		if err := p.Close(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !idle.Value().closed.Load() || !busy.Value().closed.Load() {
+			t.Error("expected all resources to be destroyed")
+		}
+
+		if _, err := p.Get(context.Background()); !errors.Is(err, respool.ErrPoolClosed) {
+			t.Errorf("expected ErrPoolClosed, got %v", err)
+		}
+	})
+	t.Run("close joins destroy failures and timeout", func(t *testing.T) {
+		f := &factory{}
+		boom := errors.New("boom")
+		p := respool.New(f.new, respool.WithDestroy(func(c *conn) error { return boom }))
+
+		a, _ := p.Get(context.Background())
+		b, _ := p.Get(context.Background())
+		_, _ = p.Get(context.Background()) // never returned
+		a.Release()
+		b.Release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := p.Close(ctx)
+
+		if !errors.Is(err, boom) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected destroy failures and the timeout, got %v", err)
+		}
+		if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 3 {
+			t.Errorf("expected 3 joined errors, got %d: %v", n, err)
+		}
+	})
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
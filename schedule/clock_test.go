@@ -0,0 +1,12 @@
+package schedule_test
+
+import (
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+// newFakeClock creates a controllable clock for tests.
+func newFakeClock() *clock.FakeClock {
+	return clock.NewFake(time.Unix(0, 0))
+}
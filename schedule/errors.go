@@ -0,0 +1,58 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SchedulerError represents scheduler-specific errors with context
+type SchedulerError struct {
+	Op            string // operation that failed
+	SchedulerName string // name of the scheduler
+	Job           string // job involved, if any
+	Err           error  // underlying error
+}
+
+func (e *SchedulerError) Error() string {
+	op := e.Op
+	if e.Job != "" {
+		op = fmt.Sprintf("%s %q", e.Op, e.Job)
+	}
+	if e.SchedulerName != "" {
+		return fmt.Sprintf("ion: scheduler %q %s: %v", e.SchedulerName, op, e.Err)
+	}
+	return fmt.Sprintf("ion: scheduler %s: %v", op, e.Err)
+}
+
+func (e *SchedulerError) Unwrap() error {
+	return e.Err
+}
+
+// NewSchedulerClosedError creates an error indicating the scheduler is closed
+func NewSchedulerClosedError(schedulerName string) error {
+	return &SchedulerError{
+		Op:            "schedule",
+		SchedulerName: schedulerName,
+		Err:           errors.New("scheduler is closed"),
+	}
+}
+
+// NewCloseTimeoutError creates an error indicating close gave up waiting for
+// runs in progress
+func NewCloseTimeoutError(schedulerName string, err error) error {
+	return &SchedulerError{
+		Op:            "close",
+		SchedulerName: schedulerName,
+		Err:           fmt.Errorf("timed out waiting for runs: %w", err),
+	}
+}
+
+// NewNoRunsError creates an error indicating a schedule never fires
+func NewNoRunsError(schedulerName, job string) error {
+	return &SchedulerError{
+		Op:            "schedule",
+		SchedulerName: schedulerName,
+		Job:           job,
+		Err:           errors.New("schedule has no future runs"),
+	}
+}
@@ -0,0 +1,163 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Schedule computes the run times of a job.
+type Schedule interface {
+	// Next returns the first run time strictly after the given time, or the
+	// zero time if the schedule has no further runs.
+	Next(after time.Time) time.Time
+}
+
+// ScheduleFunc adapts a function to the Schedule interface.
+type ScheduleFunc func(after time.Time) time.Time
+
+// Next calls f(after).
+func (f ScheduleFunc) Next(after time.Time) time.Time {
+	return f(after)
+}
+
+// At returns a one-shot schedule that fires once at t.
+func At(t time.Time) Schedule {
+	return ScheduleFunc(func(after time.Time) time.Time {
+		if after.Before(t) {
+			return t
+		}
+		return time.Time{}
+	})
+}
+
+// Every returns a fixed-interval schedule. Runs are spaced from the previous
+// scheduled time rather than from when the previous run finished, so the
+// schedule does not drift.
+func Every(interval time.Duration) Schedule {
+	if interval <= 0 {
+		panic("schedule: interval must be positive")
+	}
+	return ScheduleFunc(func(after time.Time) time.Time {
+		return after.Add(interval)
+	})
+}
+
+// MisfirePolicy controls what happens when a job cannot run at its scheduled
+// time, either because the scheduler fired it late (by more than the misfire
+// threshold) or because its previous run is still in progress.
+type MisfirePolicy int
+
+const (
+	// MisfireRunOnce runs the job once as soon as possible and then resumes
+	// the schedule from the current time (default).
+	MisfireRunOnce MisfirePolicy = iota
+	// MisfireSkip drops the missed run and resumes the schedule from the
+	// current time.
+	MisfireSkip
+	// MisfireCatchUp runs every missed occurrence, one after another, before
+	// resuming the regular schedule.
+	MisfireCatchUp
+)
+
+// String returns the string representation of the misfire policy.
+func (p MisfirePolicy) String() string {
+	switch p {
+	case MisfireRunOnce:
+		return "RunOnce"
+	case MisfireSkip:
+		return "Skip"
+	case MisfireCatchUp:
+		return "CatchUp"
+	default:
+		return fmt.Sprintf("MisfirePolicy(%d)", int(p))
+	}
+}
+
+// JobOption configures a single job.
+type JobOption func(*jobConfig)
+
+type jobConfig struct {
+	name    string
+	misfire MisfirePolicy
+}
+
+// Named sets the job name for observability and error reporting.
+func Named(name string) JobOption {
+	return func(c *jobConfig) {
+		c.name = name
+	}
+}
+
+// OnMisfire overrides the scheduler's misfire policy for the job.
+func OnMisfire(policy MisfirePolicy) JobOption {
+	return func(c *jobConfig) {
+		c.misfire = policy
+	}
+}
+
+// Job is a task registered with a Scheduler. All mutable fields are guarded
+// by the scheduler's mutex.
+type Job struct {
+	s        *Scheduler
+	name     string
+	schedule Schedule
+	task     workerpool.Task
+	misfire  MisfirePolicy
+
+	next     time.Time
+	slot     int
+	inWheel  bool
+	running  bool
+	owed     int // runs to start once the current run completes
+	canceled bool
+	runs     uint64
+	misfires uint64
+}
+
+// Name returns the job name.
+func (j *Job) Name() string {
+	return j.name
+}
+
+// Next returns the next scheduled run time, or the zero time if the job is
+// not scheduled to run again.
+func (j *Job) Next() time.Time {
+	j.s.mu.Lock()
+	defer j.s.mu.Unlock()
+
+	if !j.inWheel {
+		return time.Time{}
+	}
+	return j.next
+}
+
+// Runs returns the number of completed runs.
+func (j *Job) Runs() uint64 {
+	j.s.mu.Lock()
+	defer j.s.mu.Unlock()
+	return j.runs
+}
+
+// Misfires returns the number of runs that were missed, skipped or deferred.
+func (j *Job) Misfires() uint64 {
+	j.s.mu.Lock()
+	defer j.s.mu.Unlock()
+	return j.misfires
+}
+
+// Cancel removes the job from the scheduler. A run already in progress is not
+// interrupted. It reports whether the job was still active.
+func (j *Job) Cancel() bool {
+	j.s.mu.Lock()
+	defer j.s.mu.Unlock()
+
+	if j.canceled {
+		return false
+	}
+	j.canceled = true
+	j.owed = 0
+	j.s.removeLocked(j)
+	return true
+}
@@ -0,0 +1,522 @@
+// Package schedule provides a scheduler for delayed and recurring jobs.
+//
+// Jobs are kept in a hashed timing wheel, so registering, firing and
+// canceling a job costs O(1) regardless of how many jobs are scheduled. When
+// a job is due it is submitted to a workerpool, which bounds how many jobs
+// run at once. Schedules can be one-shot (After, At), fixed-interval (Every)
+// or cron expressions (Cron). A misfire policy decides what happens when a
+// run is late or its previous run is still in progress, and Close drains
+// in-flight runs before returning.
+//
+// Usage:
+//
+//	s := schedule.New(schedule.WithName("maintenance"))
+//	defer s.Close(context.Background())
+//
+//	s.Every(time.Minute, refreshCache)
+//	s.Cron("0 3 * * *", compactDatabase, schedule.Named("compaction"))
+//	s.After(10*time.Second, warmUp)
+package schedule
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Metrics holds a snapshot of scheduler counters.
+type Metrics struct {
+	Scheduled int    // jobs waiting in the wheel
+	Running   int    // jobs currently executing
+	Runs      uint64 // total completed runs
+	Failures  uint64 // runs that returned an error
+	Misfires  uint64 // runs that were missed, skipped or deferred
+}
+
+// Option configures scheduler behavior.
+type Option func(*config)
+
+type config struct {
+	name             string
+	pool             *workerpool.Pool
+	tick             time.Duration
+	wheelSize        int
+	misfire          MisfirePolicy
+	misfireThreshold time.Duration
+	clock            clock.Clock
+	obs              *observe.Observability
+}
+
+// WithName sets the scheduler name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithPool runs jobs on the given pool. The caller keeps ownership of the
+// pool; Close waits for the scheduler's own runs but does not close it. By
+// default the scheduler creates and owns a pool with one worker per CPU.
+func WithPool(pool *workerpool.Pool) Option {
+	return func(c *config) {
+		c.pool = pool
+	}
+}
+
+// WithTick sets the resolution of the timing wheel. Jobs fire up to one tick
+// after their scheduled time. The default is 10ms.
+func WithTick(tick time.Duration) Option {
+	return func(c *config) {
+		if tick > 0 {
+			c.tick = tick
+		}
+	}
+}
+
+// WithWheelSize sets the number of slots in the timing wheel. The default
+// is 512.
+func WithWheelSize(size int) Option {
+	return func(c *config) {
+		if size > 0 {
+			c.wheelSize = size
+		}
+	}
+}
+
+// WithMisfirePolicy sets the default misfire policy for jobs.
+func WithMisfirePolicy(policy MisfirePolicy) Option {
+	return func(c *config) {
+		c.misfire = policy
+	}
+}
+
+// WithMisfireThreshold sets how late a run may fire before it counts as a
+// misfire. The default is one second.
+func WithMisfireThreshold(d time.Duration) Option {
+	return func(c *config) {
+		c.misfireThreshold = d
+	}
+}
+
+// WithClock sets a custom clock implementation (useful for testing).
+func WithClock(clock clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// Scheduler runs jobs at their scheduled times on a workerpool.
+type Scheduler struct {
+	name             string
+	obs              *observe.Observability
+	clock            clock.Clock
+	tick             time.Duration
+	misfire          MisfirePolicy
+	misfireThreshold time.Duration
+	pool             *workerpool.Pool
+	ownsPool         bool
+
+	mu       sync.Mutex
+	epoch    time.Time
+	slots    []map[*Job]struct{}
+	lastTick int64 // last wheel tick that was processed
+	count    int   // jobs in the wheel
+	timer    clock.Timer
+	gen      uint64
+	closed   bool
+	running  int
+	runs     uint64
+	failures uint64
+	misfires uint64
+
+	inflight sync.WaitGroup
+}
+
+// New creates a scheduler.
+func New(opts ...Option) *Scheduler {
+	cfg := &config{
+		name:             "",
+		tick:             10 * time.Millisecond,
+		wheelSize:        512,
+		misfire:          MisfireRunOnce,
+		misfireThreshold: time.Second,
+		clock:            clock.Real(),
+		obs:              observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	s := &Scheduler{
+		name:             cfg.name,
+		obs:              cfg.obs,
+		clock:            cfg.clock,
+		tick:             cfg.tick,
+		misfire:          cfg.misfire,
+		misfireThreshold: cfg.misfireThreshold,
+		pool:             cfg.pool,
+		slots:            make([]map[*Job]struct{}, cfg.wheelSize),
+	}
+	for i := range s.slots {
+		s.slots[i] = make(map[*Job]struct{})
+	}
+	s.epoch = s.clock.Now()
+
+	if s.pool == nil {
+		s.pool = workerpool.New(runtime.GOMAXPROCS(0), cfg.wheelSize,
+			workerpool.WithName(cfg.name),
+			workerpool.WithLogger(cfg.obs.Logger),
+			workerpool.WithMetrics(cfg.obs.Metrics),
+			workerpool.WithTracer(cfg.obs.Tracer),
+		)
+		s.ownsPool = true
+	}
+
+	s.obs.Logger.Info("scheduler created",
+		"name", s.name,
+		"tick", s.tick,
+		"wheel_size", len(s.slots),
+	)
+
+	return s
+}
+
+// Schedule registers task to run according to sched.
+func (s *Scheduler) Schedule(sched Schedule, task workerpool.Task, opts ...JobOption) (*Job, error) {
+	cfg := &jobConfig{misfire: s.misfire}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	j := &Job{
+		s:        s,
+		name:     cfg.name,
+		schedule: sched,
+		task:     task,
+		misfire:  cfg.misfire,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, NewSchedulerClosedError(s.name)
+	}
+
+	next := sched.Next(s.clock.Now())
+	if next.IsZero() {
+		return nil, NewNoRunsError(s.name, j.name)
+	}
+	s.insertLocked(j, next)
+
+	return j, nil
+}
+
+// After runs task once after delay.
+func (s *Scheduler) After(delay time.Duration, task workerpool.Task, opts ...JobOption) (*Job, error) {
+	return s.Schedule(At(s.clock.Now().Add(delay)), task, opts...)
+}
+
+// Every runs task every interval, starting one interval from now.
+func (s *Scheduler) Every(interval time.Duration, task workerpool.Task, opts ...JobOption) (*Job, error) {
+	return s.Schedule(Every(interval), task, opts...)
+}
+
+// Cron runs task according to a cron expression. See ParseCron for the
+// supported syntax.
+func (s *Scheduler) Cron(expr string, task workerpool.Task, opts ...JobOption) (*Job, error) {
+	sched, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	return s.Schedule(sched, task, opts...)
+}
+
+// Name returns the scheduler name.
+func (s *Scheduler) Name() string {
+	return s.name
+}
+
+// Metrics returns a snapshot of the scheduler counters.
+func (s *Scheduler) Metrics() Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Metrics{
+		Scheduled: s.count,
+		Running:   s.running,
+		Runs:      s.runs,
+		Failures:  s.failures,
+		Misfires:  s.misfires,
+	}
+}
+
+// Close stops firing jobs and waits for runs already in progress to finish or
+// for ctx to be done. If the scheduler owns its pool, the pool is closed too,
+// and the returned error joins the timeout with any error from closing it.
+func (s *Scheduler) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.gen++
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	for _, slot := range s.slots {
+		for j := range slot {
+			j.inWheel = false
+			j.owed = 0
+			delete(slot, j)
+		}
+	}
+	s.count = 0
+	s.mu.Unlock()
+
+	s.obs.WithContext(ctx).Logger.Info("scheduler closing", "name", s.name)
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = NewCloseTimeoutError(s.name, ctx.Err())
+	}
+
+	if s.ownsPool {
+		err = errors.Join(err, s.pool.Close(ctx))
+	}
+
+	return err
+}
+
+// tickOf returns the wheel tick containing t, rounded up.
+func (s *Scheduler) tickOf(t time.Time) int64 {
+	d := t.Sub(s.epoch)
+	n := int64(d / s.tick)
+	if d%s.tick > 0 {
+		n++
+	}
+	return n
+}
+
+// insertLocked places j in the wheel slot for deadline. Must be called with s.mu held.
+func (s *Scheduler) insertLocked(j *Job, deadline time.Time) {
+	if s.timer == nil {
+		// The wheel was idle; skip the ticks that passed without work.
+		s.lastTick = int64(s.clock.Now().Sub(s.epoch) / s.tick)
+	}
+
+	tick := s.tickOf(deadline)
+	if tick <= s.lastTick {
+		tick = s.lastTick + 1
+	}
+
+	j.next = deadline
+	j.slot = int(tick % int64(len(s.slots)))
+	j.inWheel = true
+	s.slots[j.slot][j] = struct{}{}
+	s.count++
+
+	if s.timer == nil {
+		s.armLocked()
+	}
+}
+
+// removeLocked takes j out of the wheel. Must be called with s.mu held.
+func (s *Scheduler) removeLocked(j *Job) {
+	if !j.inWheel {
+		return
+	}
+	delete(s.slots[j.slot], j)
+	j.inWheel = false
+	s.count--
+}
+
+// armLocked schedules the next wheel tick. Must be called with s.mu held.
+func (s *Scheduler) armLocked() {
+	s.gen++
+	gen := s.gen
+	at := s.epoch.Add(time.Duration(s.lastTick+1) * s.tick)
+	s.timer = s.clock.AfterFunc(at.Sub(s.clock.Now()), func() { s.advance(gen) })
+}
+
+// advance processes every wheel tick up to now and fires due jobs.
+func (s *Scheduler) advance(gen uint64) {
+	s.mu.Lock()
+	if s.closed || gen != s.gen {
+		s.mu.Unlock()
+		return
+	}
+
+	now := s.clock.Now()
+	current := int64(now.Sub(s.epoch) / s.tick)
+	size := int64(len(s.slots))
+
+	var due []*Job
+	for t := s.lastTick + 1; t <= current && t <= s.lastTick+size; t++ {
+		for j := range s.slots[t%size] {
+			if !j.next.After(now) {
+				s.removeLocked(j)
+				due = append(due, j)
+			}
+		}
+	}
+	s.lastTick = current
+
+	s.timer = nil
+	if s.count > 0 {
+		s.armLocked()
+	}
+
+	for _, j := range due {
+		s.fireLocked(j, now)
+	}
+	s.mu.Unlock()
+}
+
+// fireLocked handles a due job: it applies the misfire policy, reschedules
+// the job and starts a run if one is warranted. Must be called with s.mu held.
+func (s *Scheduler) fireLocked(j *Job, now time.Time) {
+	if j.canceled {
+		return
+	}
+
+	scheduled := j.next
+	from := scheduled
+	run := true
+
+	switch {
+	case j.running:
+		// The previous run has not finished; runs never overlap.
+		s.misfireLocked(j, "overlap")
+		run = false
+		switch j.misfire {
+		case MisfireRunOnce:
+			j.owed = 1
+			from = now
+		case MisfireSkip:
+			from = now
+		case MisfireCatchUp:
+			j.owed++
+		}
+
+	case now.Sub(scheduled) > s.misfireThreshold:
+		s.misfireLocked(j, "late")
+		switch j.misfire {
+		case MisfireRunOnce:
+			from = now
+		case MisfireSkip:
+			from = now
+			run = false
+		}
+	}
+
+	if next := j.schedule.Next(from); !next.IsZero() {
+		s.insertLocked(j, next)
+	}
+
+	if run {
+		s.startLocked(j)
+	}
+}
+
+func (s *Scheduler) misfireLocked(j *Job, reason string) {
+	j.misfires++
+	s.misfires++
+	s.obs.Metrics.Inc("ion_schedule_misfires_total", "scheduler_name", s.name, "job", j.name, "reason", reason)
+	s.obs.Logger.Warn("scheduled job misfired",
+		"scheduler", s.name,
+		"job", j.name,
+		"reason", reason,
+		"policy", j.misfire.String(),
+	)
+}
+
+// startLocked submits a run of j to the pool without blocking the wheel. If
+// the pool cannot accept it, the run counts as a misfire. Must be called with
+// s.mu held.
+func (s *Scheduler) startLocked(j *Job) {
+	j.running = true
+	s.running++
+	s.inflight.Add(1)
+
+	if err := s.pool.TrySubmit(func(ctx context.Context) error { return s.run(ctx, j) }); err != nil {
+		j.running = false
+		s.running--
+		s.inflight.Done()
+		s.misfireLocked(j, "pool")
+		s.obs.Logger.Error("failed to submit scheduled job", err, "scheduler", s.name, "job", j.name)
+	}
+}
+
+// run executes one run of j and starts an owed run, if any, when it finishes.
+func (s *Scheduler) run(ctx context.Context, j *Job) error {
+	obs := s.obs.WithContext(ctx)
+	spanCtx, finish := obs.Tracer.Start(ctx, "schedule.run", "scheduler_name", s.name, "job", j.name)
+	start := s.clock.Now()
+	err := j.task(spanCtx)
+	finish(err)
+
+	result := "success"
+	if err != nil {
+		result = "error"
+		obs.Logger.Error("scheduled job failed", err, "scheduler", s.name, "job", j.name)
+	}
+	obs.Metrics.Inc("ion_schedule_runs_total", "scheduler_name", s.name, "job", j.name, "result", result)
+	obs.Metrics.Histogram("ion_schedule_run_duration_seconds", s.clock.Now().Sub(start).Seconds(),
+		"scheduler_name", s.name, "job", j.name)
+
+	s.mu.Lock()
+	j.runs++
+	s.runs++
+	if err != nil {
+		s.failures++
+	}
+	j.running = false
+	s.running--
+	if j.owed > 0 && !j.canceled && !s.closed {
+		j.owed--
+		s.startLocked(j)
+	}
+	s.mu.Unlock()
+
+	s.inflight.Done()
+	return err
+}
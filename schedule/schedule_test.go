@@ -0,0 +1,218 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/schedule"
+)
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("one-shot", func(t *testing.T) {
+		clock := newFakeClock()
+		s := schedule.New(schedule.WithClock(clock))
+		defer s.Close(context.Background())
+
+		var runs atomic.Int64
+		job, err := s.After(time.Second, func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}, schedule.Named("once"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		clock.Advance(500 * time.Millisecond)
+		if runs.Load() != 0 {
+			t.Fatal("job ran early")
+		}
+
+		clock.Advance(600 * time.Millisecond)
+		waitFor(t, func() bool { return job.Runs() == 1 })
+
+		clock.Advance(10 * time.Second)
+		if !job.Next().IsZero() {
+			t.Errorf("expected one-shot job to be done, next %v", job.Next())
+		}
+		if s.Metrics().Scheduled != 0 {
+			t.Errorf("expected empty wheel, got %d", s.Metrics().Scheduled)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		clock := newFakeClock()
+		s := schedule.New(schedule.WithClock(clock))
+		defer s.Close(context.Background())
+
+		job, err := s.Every(100*time.Millisecond, func(ctx context.Context) error { return nil })
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for i := 1; i <= 5; i++ {
+			clock.Advance(100 * time.Millisecond)
+			waitFor(t, func() bool { return job.Runs() == uint64(i) })
+		}
+
+		if !job.Cancel() {
+			t.Error("expected cancel to succeed")
+		}
+		clock.Advance(time.Second)
+		if job.Runs() != 5 {
+			t.Errorf("expected no runs after cancel, got %d", job.Runs())
+		}
+	})
+
+	t.Run("misfire skip on overlap", func(t *testing.T) {
+		clock := newFakeClock()
+		s := schedule.New(schedule.WithClock(clock), schedule.WithMisfirePolicy(schedule.MisfireSkip))
+		defer s.Close(context.Background())
+
+		release := make(chan struct{})
+		job, _ := s.Every(100*time.Millisecond, func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+
+		clock.Advance(100 * time.Millisecond)
+		waitFor(t, func() bool { return s.Metrics().Running == 1 })
+
+		clock.Advance(100 * time.Millisecond)
+		clock.Advance(100 * time.Millisecond)
+		if job.Misfires() != 2 {
+			t.Errorf("expected 2 misfires, got %d", job.Misfires())
+		}
+
+		close(release)
+		waitFor(t, func() bool { return s.Metrics().Running == 0 })
+		if job.Runs() != 1 {
+			t.Errorf("expected skipped runs not to execute, got %d runs", job.Runs())
+		}
+	})
+
+	t.Run("misfire run once after overlap", func(t *testing.T) {
+		clock := newFakeClock()
+		s := schedule.New(schedule.WithClock(clock))
+		defer s.Close(context.Background())
+
+		release := make(chan struct{})
+		job, _ := s.Every(100*time.Millisecond, func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+
+		clock.Advance(100 * time.Millisecond)
+		waitFor(t, func() bool { return s.Metrics().Running == 1 })
+		clock.Advance(100 * time.Millisecond)
+		clock.Advance(100 * time.Millisecond)
+
+		close(release)
+		waitFor(t, func() bool { return job.Runs() == 2 })
+	})
+
+	t.Run("close drains running jobs", func(t *testing.T) {
+		clock := newFakeClock()
+		s := schedule.New(schedule.WithClock(clock))
+
+		var finished atomic.Bool
+		s.After(time.Millisecond, func(ctx context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			finished.Store(true)
+			return nil
+		})
+		clock.Advance(10 * time.Millisecond)
+		waitFor(t, func() bool { return s.Metrics().Running == 1 })
+
+		if err := s.Close(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !finished.Load() {
+			t.Error("expected close to wait for the running job")
+		}
+
+		if _, err := s.After(time.Second, func(ctx context.Context) error { return nil }); err == nil {
+			t.Error("expected error scheduling on closed scheduler")
+		}
+	})
+
+	t.Run("past one-shot is rejected", func(t *testing.T) {
+		clock := newFakeClock()
+		s := schedule.New(schedule.WithClock(clock))
+		defer s.Close(context.Background())
+
+		_, err := s.Schedule(schedule.At(clock.Now().Add(-time.Second)), func(ctx context.Context) error { return nil })
+		var se *schedule.SchedulerError
+		if !errors.As(err, &se) {
+			t.Errorf("expected SchedulerError, got %v", err)
+		}
+	})
+
+	t.Run("real clock", func(t *testing.T) {
+		s := schedule.New(schedule.WithTick(time.Millisecond))
+		defer s.Close(context.Background())
+
+		done := make(chan struct{})
+		s.After(5*time.Millisecond, func(ctx context.Context) error {
+			close(done)
+			return nil
+		})
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("job did not run")
+		}
+	})
+}
+
+func TestCron(t *testing.T) {
+	base := time.Date(2024, time.January, 15, 10, 30, 0, 0, time.UTC) // a Monday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 1, 16, 3, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2024, 1, 20, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 feb *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 5", time.Date(2024, 1, 19, 12, 0, 0, 0, time.UTC)}, // day-of-month OR Friday
+		{"@hourly", time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := schedule.ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := s.Next(base); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", base, got, tt.want)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * * mon-", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := schedule.ParseCron(expr); !errors.Is(err, schedule.ErrInvalidCron) {
+			t.Errorf("ParseCron(%q): expected ErrInvalidCron, got %v", expr, err)
+		}
+	}
+}
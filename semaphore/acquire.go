@@ -2,7 +2,10 @@ package semaphore
 
 import (
 	"context"
+	"runtime"
 	"time"
+
+	"github.com/kolosys/ion/observe"
 )
 
 // Acquire blocks until n permits are available or the context is canceled.
@@ -16,10 +19,12 @@ func (s *weightedSemaphore) Acquire(ctx context.Context, n int64) error {
 		return NewWeightExceedsCapacityError(s.name, n, s.capacity)
 	}
 
-	// Fast path: try to acquire without blocking
-	if s.tryAcquireFast(n) {
-		s.obs.Metrics.Inc("ion_semaphore_acquisitions_total",
+	// Fast path: try to acquire without blocking, spinning if configured
+	if s.tryAcquireFast(n) || s.spinAcquire(n) {
+		obs := s.obs.WithContext(ctx)
+		obs.Metrics.Inc("ion_semaphore_acquisitions_total",
 			"semaphore_name", s.name, "result", "success")
+		s.observeWait(obs, 0, n, "success")
 		return nil
 	}
 
@@ -53,6 +58,11 @@ func (s *weightedSemaphore) TryAcquire(n int64) bool {
 
 // tryAcquireFast attempts to acquire permits without blocking
 func (s *weightedSemaphore) tryAcquireFast(n int64) bool {
+	if s.spin > 0 && s.avail.Load() < n {
+		// Clearly unavailable; don't contend for the lock
+		return false
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -62,6 +72,7 @@ func (s *weightedSemaphore) tryAcquireFast(n int64) bool {
 
 	if s.current >= n {
 		s.current -= n
+		s.avail.Store(s.current)
 		s.obs.Metrics.Gauge("ion_semaphore_current_permits", float64(s.current), "semaphore_name", s.name)
 		return true
 	}
@@ -69,13 +80,39 @@ func (s *weightedSemaphore) tryAcquireFast(n int64) bool {
 	return false
 }
 
-// acquireSlow handles the blocking acquisition path
-func (s *weightedSemaphore) acquireSlow(ctx context.Context, n int64) error {
+// spinAcquire retries the fast path up to the configured spin count,
+// yielding between attempts, before the caller parks in the waiter queue.
+func (s *weightedSemaphore) spinAcquire(n int64) bool {
+	for i := 0; i < s.spin; i++ {
+		runtime.Gosched()
+		if s.tryAcquireFast(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireSlow handles the blocking acquisition path. The queue wait is
+// traced as a span, so traces show the time spent waiting for permits
+// instead of an unexplained gap; the span ends with the acquire error, if any.
+func (s *weightedSemaphore) acquireSlow(ctx context.Context, n int64) (err error) {
+	obs := s.obs.WithContext(ctx)
+
+	_, finish := obs.Tracer.Start(ctx, "semaphore.acquire_wait",
+		"semaphore_name", s.name,
+		"weight", n,
+		"fairness", s.fairness.String(),
+	)
+	defer func() { finish(err) }()
+
 	// Apply timeout if configured
 	if s.acquireTimeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, s.acquireTimeout)
-		defer cancel()
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		timer := s.clock.AfterFunc(s.acquireTimeout, func() { cancel(context.DeadlineExceeded) })
+		defer timer.Stop()
 	}
 
 	// Create waiter
@@ -93,26 +130,32 @@ func (s *weightedSemaphore) acquireSlow(ctx context.Context, n int64) error {
 	}
 
 	s.waiters.push(w)
+	// Permits may have been released since the fast path failed, with
+	// nobody queued yet to hand them to
+	s.notifyWaiters()
 	waitingCount := s.waiters.len()
 	s.mu.Unlock()
 
-	s.obs.Metrics.Gauge("ion_semaphore_waiting_goroutines", float64(waitingCount), "semaphore_name", s.name)
-	s.obs.Logger.Debug("semaphore acquire waiting",
+	obs.Metrics.Gauge("ion_semaphore_waiting_goroutines", float64(waitingCount), "semaphore_name", s.name)
+	obs.Metrics.Histogram("ion_semaphore_queue_depth", float64(waitingCount),
+		"semaphore_name", s.name, "fairness", s.fairness.String())
+	obs.Logger.Debug("semaphore acquire waiting",
 		"semaphore_name", s.name,
 		"weight", n,
 		"waiting_count", waitingCount,
 	)
 
-	start := time.Now()
+	start := s.clock.Now()
 
 	// Wait for either ready signal or context cancellation
 	select {
 	case <-w.ready:
 		if w.acquired {
-			duration := time.Since(start)
-			s.obs.Metrics.Histogram("ion_semaphore_acquire_duration_seconds", duration.Seconds(), "semaphore_name", s.name)
-			s.obs.Metrics.Inc("ion_semaphore_acquisitions_total",
+			duration := s.clock.Since(start)
+			obs.Metrics.Histogram("ion_semaphore_acquire_duration_seconds", duration.Seconds(), "semaphore_name", s.name)
+			obs.Metrics.Inc("ion_semaphore_acquisitions_total",
 				"semaphore_name", s.name, "result", "success")
+			s.observeWait(obs, duration, n, "success")
 			return nil
 		}
 		// waiter was notified but couldn't acquire (shouldn't happen with current impl)
@@ -122,33 +165,76 @@ func (s *weightedSemaphore) acquireSlow(ctx context.Context, n int64) error {
 		// Remove waiter from queue on cancellation
 		s.mu.Lock()
 		removed := s.waiters.removeWaiter(w)
+		if !removed && w.acquired {
+			// Granted as ctx was done; hand the permits to the next waiter
+			s.current += n
+			s.notifyWaiters()
+		}
 		waitingCount := s.waiters.len()
 		s.mu.Unlock()
 
 		if removed {
-			s.obs.Metrics.Gauge("ion_semaphore_waiting_goroutines", float64(waitingCount), "semaphore_name", s.name)
-			s.obs.Logger.Debug("semaphore acquire canceled",
+			obs.Metrics.Gauge("ion_semaphore_waiting_goroutines", float64(waitingCount), "semaphore_name", s.name)
+			obs.Logger.Debug("semaphore acquire canceled",
 				"semaphore_name", s.name,
 				"weight", n,
 			)
 		}
 
 		// Determine the appropriate error based on context
-		if ctx.Err() == context.DeadlineExceeded {
-			s.obs.Metrics.Inc("ion_semaphore_acquisitions_total",
+		if context.Cause(ctx) == context.DeadlineExceeded {
+			obs.Metrics.Inc("ion_semaphore_acquisitions_total",
 				"semaphore_name", s.name, "result", "timeout")
+			s.observeWait(obs, s.clock.Since(start), n, "timeout")
 			return NewAcquireTimeoutError(s.name)
 		}
 
-		s.obs.Metrics.Inc("ion_semaphore_acquisitions_total",
+		obs.Metrics.Inc("ion_semaphore_acquisitions_total",
 			"semaphore_name", s.name, "result", "canceled")
+		s.observeWait(obs, s.clock.Since(start), n, "canceled")
 		return ctx.Err()
 	}
 }
 
-// notifyWaiters attempts to satisfy waiting acquire requests
+// observeWait records how long an Acquire of n permits waited, tagged by
+// fairness mode and weight bucket so the cost of each mode can be compared.
+// Acquisitions that did not wait are recorded as zero.
+func (s *weightedSemaphore) observeWait(obs *observe.Observability, d time.Duration, n int64, result string) {
+	obs.Metrics.Histogram("ion_semaphore_wait_duration_seconds", d.Seconds(),
+		"semaphore_name", s.name,
+		"fairness", s.fairness.String(),
+		"weight", weightBucket(n),
+		"result", result,
+	)
+}
+
+// weightBucket groups acquire weights into a few label values to keep
+// metric cardinality bounded.
+func weightBucket(n int64) string {
+	switch {
+	case n <= 1:
+		return "1"
+	case n <= 4:
+		return "2-4"
+	case n <= 16:
+		return "5-16"
+	case n <= 64:
+		return "17-64"
+	default:
+		return "65+"
+	}
+}
+
+// notifyWaiters attempts to satisfy waiting acquire requests. With a wake
+// batch configured, waiters are left parked until enough permits are free.
 // Must be called with s.mu held
 func (s *weightedSemaphore) notifyWaiters() {
+	if s.current < s.wakeBatch {
+		s.avail.Store(s.current)
+		s.obs.Metrics.Gauge("ion_semaphore_current_permits", float64(s.current), "semaphore_name", s.name)
+		return
+	}
+
 	for s.current > 0 && s.waiters.len() > 0 {
 		w := s.waiters.popReady(s.current)
 		if w == nil {
@@ -169,14 +255,14 @@ func (s *weightedSemaphore) notifyWaiters() {
 			s.current -= w.weight
 			w.acquired = true
 
-			// Signal the waiter (non-blocking)
-			select {
-			case w.ready <- struct{}{}:
-			default:
-			}
+			// Signal the waiter. Closing rather than sending cannot be
+			// missed by a waiter that has not reached its select yet
+			close(w.ready)
 		}
 	}
 
+	s.avail.Store(s.current)
+
 	// Update metrics
 	s.obs.Metrics.Gauge("ion_semaphore_current_permits", float64(s.current), "semaphore_name", s.name)
 	s.obs.Metrics.Gauge("ion_semaphore_waiting_goroutines", float64(s.waiters.len()), "semaphore_name", s.name)
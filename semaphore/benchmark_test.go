@@ -0,0 +1,79 @@
+package semaphore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kolosys/ion/semaphore"
+)
+
+// contentionModes are the tuning options compared by the benchmarks. The
+// default takes the lock on every call and parks waiters at once.
+var contentionModes = []struct {
+	name string
+	opts []semaphore.Option
+}{
+	{"Default", nil},
+	{"Spin", []semaphore.Option{semaphore.WithSpin(8)}},
+	{"WakeBatch", []semaphore.Option{semaphore.WithWakeBatch(4)}},
+	{"SpinWakeBatch", []semaphore.Option{semaphore.WithSpin(8), semaphore.WithWakeBatch(4)}},
+}
+
+// BenchmarkTryAcquire_Exhausted measures TryAcquire on a semaphore with no
+// permits left, the hot path of load shedding under overload.
+func BenchmarkTryAcquire_Exhausted(b *testing.B) {
+	for _, mode := range contentionModes {
+		b.Run(mode.name, func(b *testing.B) {
+			sem := semaphore.NewWeighted(1, mode.opts...)
+			sem.TryAcquire(1)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					sem.TryAcquire(1)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkTryAcquire_Contended measures TryAcquire and Release pairs on a
+// semaphore with fewer permits than goroutines.
+func BenchmarkTryAcquire_Contended(b *testing.B) {
+	for _, mode := range contentionModes {
+		b.Run(mode.name, func(b *testing.B) {
+			sem := semaphore.NewWeighted(4, mode.opts...)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if sem.TryAcquire(1) {
+						sem.Release(1)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkAcquire_Contended measures blocking Acquire and Release pairs
+// with short hold times, where parking and waking dominate.
+func BenchmarkAcquire_Contended(b *testing.B) {
+	ctx := context.Background()
+	for _, mode := range contentionModes {
+		b.Run(mode.name, func(b *testing.B) {
+			sem := semaphore.NewWeighted(4, mode.opts...)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := sem.Acquire(ctx, 1); err != nil {
+						b.Error(err)
+						return
+					}
+					sem.Release(1)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package semaphore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config declares a semaphore, as an alternative to functional options for
+// semaphores loaded from configuration files. Zero values select the same
+// defaults as the corresponding options.
+type Config struct {
+	// Name identifies the semaphore in logs, metrics and errors
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Capacity is the number of permits. It must be positive
+	Capacity int64 `json:"capacity" yaml:"capacity"`
+
+	// Fairness is the order in which waiters are served, "FIFO", "LIFO" or
+	// "None". Default: FIFO
+	Fairness Fairness `json:"fairness,omitempty" yaml:"fairness,omitempty"`
+
+	// AcquireTimeout is the default timeout for Acquire. Default: none
+	AcquireTimeout time.Duration `json:"acquire_timeout,omitempty" yaml:"acquire_timeout,omitempty"`
+
+	// ReservationTTL is how long a Reservation holds its permits before it
+	// expires. Default: 30 seconds
+	ReservationTTL time.Duration `json:"reservation_ttl,omitempty" yaml:"reservation_ttl,omitempty"`
+
+	// Spin is the number of fast path retries before Acquire parks.
+	// Default: 0, no spinning
+	Spin int `json:"spin,omitempty" yaml:"spin,omitempty"`
+
+	// WakeBatch is the number of free permits required to wake waiters.
+	// Default: 1
+	WakeBatch int64 `json:"wake_batch,omitempty" yaml:"wake_batch,omitempty"`
+}
+
+// Validate checks if the configuration is valid and returns an error if not.
+func (c *Config) Validate() error {
+	if c.Capacity <= 0 {
+		return fmt.Errorf("capacity must be positive, got %d", c.Capacity)
+	}
+
+	switch c.Fairness {
+	case FIFO, LIFO, None:
+	default:
+		return fmt.Errorf("unknown fairness %v", c.Fairness)
+	}
+
+	if c.AcquireTimeout < 0 {
+		return fmt.Errorf("acquire timeout cannot be negative, got %v", c.AcquireTimeout)
+	}
+
+	if c.ReservationTTL < 0 {
+		return fmt.Errorf("reservation TTL cannot be negative, got %v", c.ReservationTTL)
+	}
+
+	if c.Spin < 0 {
+		return fmt.Errorf("spin cannot be negative, got %d", c.Spin)
+	}
+
+	if c.WakeBatch < 0 {
+		return fmt.Errorf("wake batch cannot be negative, got %d", c.WakeBatch)
+	}
+
+	return nil
+}
+
+// options returns the options equivalent to the configuration.
+func (c *Config) options() []Option {
+	opts := []Option{
+		WithName(c.Name),
+		WithFairness(c.Fairness),
+		WithAcquireTimeout(c.AcquireTimeout),
+		WithSpin(c.Spin),
+		WithWakeBatch(c.WakeBatch),
+	}
+	if c.ReservationTTL > 0 {
+		opts = append(opts, WithReservationTTL(c.ReservationTTL))
+	}
+	return opts
+}
+
+// NewFromConfig creates a semaphore from cfg. Options are applied after the
+// configuration, so they can supply what a configuration file cannot, such
+// as a clock or observability hooks, or override configured values.
+func NewFromConfig(cfg Config, opts ...Option) (Semaphore, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, &SemaphoreError{Op: "config", Name: cfg.Name, Err: err}
+	}
+	return NewWeighted(cfg.Capacity, append(cfg.options(), opts...)...), nil
+}
+
+// MarshalText encodes the fairness mode as its name.
+func (f Fairness) MarshalText() ([]byte, error) {
+	switch f {
+	case FIFO, LIFO, None:
+		return []byte(f.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown fairness %v", f)
+	}
+}
+
+// UnmarshalText decodes a fairness mode from its name, ignoring case.
+func (f *Fairness) UnmarshalText(text []byte) error {
+	for _, mode := range []Fairness{FIFO, LIFO, None} {
+		if strings.EqualFold(string(text), mode.String()) {
+			*f = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown fairness %q", text)
+}
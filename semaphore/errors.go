@@ -9,6 +9,12 @@ import (
 var (
 	// ErrInvalidWeight is returned when a negative or zero weight is provided to semaphore operations
 	ErrInvalidWeight = errors.New("ion: invalid weight, must be positive")
+
+	// ErrReservationExpired is returned when confirming a reservation whose deadline has passed
+	ErrReservationExpired = errors.New("ion: reservation expired")
+
+	// ErrReservationCanceled is returned when confirming a reservation that was canceled
+	ErrReservationCanceled = errors.New("ion: reservation canceled")
 )
 
 // SemaphoreError represents semaphore-specific errors with context
@@ -46,3 +52,12 @@ func NewAcquireTimeoutError(semaphoreName string) error {
 		Err:  errors.New("acquire timeout"),
 	}
 }
+
+// NewReservationError creates an error for a reservation that can no longer be confirmed
+func NewReservationError(semaphoreName string, err error) error {
+	return &SemaphoreError{
+		Op:   "confirm",
+		Name: semaphoreName,
+		Err:  err,
+	}
+}
@@ -0,0 +1,131 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+// reservationState tracks the lifecycle of a Reservation
+type reservationState int
+
+const (
+	reservationPending reservationState = iota
+	reservationConfirmed
+	reservationCanceled
+	reservationExpired
+)
+
+// Reservation holds permits tentatively until it is confirmed or canceled.
+// It supports coordinator patterns where several resources must be secured
+// before committing to use any of them: reserve each one, then confirm all
+// of them or cancel the ones already reserved.
+//
+// A pending reservation that is neither confirmed nor canceled by its
+// deadline expires and its permits are returned to the semaphore.
+type Reservation struct {
+	sem      *weightedSemaphore
+	n        int64
+	deadline time.Time
+	timer    clock.Timer
+
+	mu    sync.Mutex
+	state reservationState
+}
+
+// Reserve acquires n permits tentatively, blocking like Acquire. The
+// reservation expires after the configured reservation TTL unless it is
+// confirmed first.
+func (s *weightedSemaphore) Reserve(ctx context.Context, n int64) (*Reservation, error) {
+	if err := s.Acquire(ctx, n); err != nil {
+		return nil, err
+	}
+
+	r := &Reservation{
+		sem:      s,
+		n:        n,
+		deadline: s.clock.Now().Add(s.reservationTTL),
+	}
+	// Hold the lock so an immediate expiry sees the timer
+	r.mu.Lock()
+	r.timer = s.clock.AfterFunc(s.reservationTTL, r.expire)
+	r.mu.Unlock()
+
+	s.obs.WithContext(ctx).Logger.Debug("semaphore permits reserved",
+		"semaphore_name", s.name,
+		"permits", n,
+		"ttl", s.reservationTTL,
+	)
+
+	return r, nil
+}
+
+// Confirm turns the reservation into a regular acquisition. The permits are
+// then held until released with Release(r.N()). It fails with an error
+// wrapping ErrReservationExpired or ErrReservationCanceled if the
+// reservation is no longer pending; confirming twice is a no-op.
+func (r *Reservation) Confirm() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.state {
+	case reservationConfirmed:
+		return nil
+	case reservationCanceled:
+		return NewReservationError(r.sem.name, ErrReservationCanceled)
+	case reservationExpired:
+		return NewReservationError(r.sem.name, ErrReservationExpired)
+	}
+
+	r.timer.Stop()
+	r.state = reservationConfirmed
+	r.sem.obs.Metrics.Inc("ion_semaphore_reservations_total",
+		"semaphore_name", r.sem.name, "result", "confirmed")
+	return nil
+}
+
+// Cancel releases the reserved permits. It is a no-op if the reservation was
+// already confirmed, canceled or expired.
+func (r *Reservation) Cancel() {
+	r.finish(reservationCanceled, "canceled")
+}
+
+// expire releases the permits of a reservation that reached its deadline.
+func (r *Reservation) expire() {
+	if r.finish(reservationExpired, "expired") {
+		r.sem.obs.Logger.Warn("semaphore reservation expired",
+			"semaphore_name", r.sem.name,
+			"permits", r.n,
+		)
+	}
+}
+
+// finish moves a pending reservation to state and releases its permits. It
+// reports whether the reservation was pending.
+func (r *Reservation) finish(state reservationState, result string) bool {
+	r.mu.Lock()
+	if r.state != reservationPending {
+		r.mu.Unlock()
+		return false
+	}
+	r.state = state
+	r.timer.Stop()
+	r.mu.Unlock()
+
+	r.sem.Release(r.n)
+	r.sem.obs.Metrics.Inc("ion_semaphore_reservations_total",
+		"semaphore_name", r.sem.name, "result", result)
+	return true
+}
+
+// N returns the number of permits reserved.
+func (r *Reservation) N() int64 {
+	return r.n
+}
+
+// Deadline returns when the reservation expires unless confirmed.
+func (r *Reservation) Deadline() time.Time {
+	return r.deadline
+}
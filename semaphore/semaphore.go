@@ -5,8 +5,10 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/kolosys/ion/clock"
 	"github.com/kolosys/ion/observe"
 )
 
@@ -53,6 +55,11 @@ type Semaphore interface {
 
 	// Current returns the number of permits currently available.
 	Current() int64
+
+	// Reserve acquires n permits tentatively, blocking like Acquire. The
+	// returned Reservation must be confirmed or canceled before its deadline,
+	// after which the permits are released automatically.
+	Reserve(ctx context.Context, n int64) (*Reservation, error)
 }
 
 // weightedSemaphore implements the Semaphore interface with weighted permits and fairness
@@ -62,6 +69,10 @@ type weightedSemaphore struct {
 	capacity       int64
 	fairness       Fairness
 	acquireTimeout time.Duration
+	reservationTTL time.Duration
+	clock          clock.Clock
+	spin           int
+	wakeBatch      int64
 
 	// Observability
 	obs *observe.Observability
@@ -71,6 +82,10 @@ type weightedSemaphore struct {
 	current int64
 	waiters waiterQueue
 	closed  bool
+
+	// avail mirrors current for lock-free checks when spinning. It is only
+	// written with mu held.
+	avail atomic.Int64
 }
 
 // waiter represents a goroutine waiting to acquire permits
@@ -160,6 +175,10 @@ type config struct {
 	name           string
 	fairness       Fairness
 	acquireTimeout time.Duration
+	reservationTTL time.Duration
+	clock          clock.Clock
+	spin           int
+	wakeBatch      int64
 	obs            *observe.Observability
 }
 
@@ -184,6 +203,45 @@ func WithAcquireTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithReservationTTL sets how long a Reservation holds its permits before it
+// expires unless confirmed. The default is 30 seconds.
+func WithReservationTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.reservationTTL = ttl
+	}
+}
+
+// WithSpin makes Acquire retry the fast path up to iterations times,
+// yielding the processor between attempts, before parking in the waiter
+// queue. Under very high contention with short hold times this avoids the
+// cost of parking and waking goroutines, at the price of CPU spent spinning
+// and weaker fairness, as spinning callers may take permits ahead of queued
+// waiters. It also lets TryAcquire fail without taking the lock when the
+// permits are clearly unavailable. The default is 0, no spinning
+func WithSpin(iterations int) Option {
+	return func(c *config) {
+		c.spin = max(iterations, 0)
+	}
+}
+
+// WithWakeBatch delays waking waiters until at least n permits are free,
+// or the semaphore is fully released if n exceeds its capacity. Waiters are
+// then woken together in one pass, so a stream of single-permit releases
+// does not wake one goroutine at a time. This trades wakeup latency for
+// throughput. The default is 1, waking waiters on every release
+func WithWakeBatch(n int64) Option {
+	return func(c *config) {
+		c.wakeBatch = max(n, 1)
+	}
+}
+
+// WithClock sets a custom clock implementation (useful for testing)
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
 // WithLogger sets the logger for observability
 func WithLogger(logger observe.Logger) Option {
 	return func(c *config) {
@@ -216,6 +274,9 @@ func NewWeighted(capacity int64, opts ...Option) Semaphore {
 		name:           "",
 		fairness:       FIFO,
 		acquireTimeout: 0, // no default timeout
+		reservationTTL: 30 * time.Second,
+		clock:          clock.Real(),
+		wakeBatch:      1,
 		obs:            observe.New(),
 	}
 
@@ -229,6 +290,10 @@ func NewWeighted(capacity int64, opts ...Option) Semaphore {
 		current:        capacity,
 		fairness:       cfg.fairness,
 		acquireTimeout: cfg.acquireTimeout,
+		reservationTTL: cfg.reservationTTL,
+		clock:          cfg.clock,
+		spin:           cfg.spin,
+		wakeBatch:      min(cfg.wakeBatch, capacity),
 		obs:            cfg.obs,
 		waiters: waiterQueue{
 			fairness: cfg.fairness,
@@ -236,6 +301,8 @@ func NewWeighted(capacity int64, opts ...Option) Semaphore {
 		},
 	}
 
+	s.avail.Store(capacity)
+
 	s.obs.Logger.Info("semaphore created",
 		"name", s.name,
 		"capacity", capacity,
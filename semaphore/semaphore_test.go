@@ -3,12 +3,15 @@ package semaphore_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/kolosys/ion/clock"
 	"github.com/kolosys/ion/semaphore"
+	"github.com/kolosys/ion/sim"
 )
 
 func TestNewWeighted(t *testing.T) {
@@ -481,3 +484,307 @@ func TestConcurrency(t *testing.T) {
 		}
 	})
 }
+
+func TestContentionTuning(t *testing.T) {
+	// churn runs short Acquire/Release pairs from many goroutines and fails
+	// if any acquisition is lost.
+	churn := func(t *testing.T, sem semaphore.Semaphore) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 500; j++ {
+					if err := sem.Acquire(ctx, 1); err != nil {
+						t.Errorf("acquire failed: %v", err)
+						return
+					}
+					sem.Release(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if sem.Current() != 2 {
+			t.Errorf("expected all permits returned, got %d", sem.Current())
+		}
+	}
+
+	t.Run("no lost wakeups", func(t *testing.T) {
+		churn(t, semaphore.NewWeighted(2))
+	})
+
+	t.Run("spin", func(t *testing.T) {
+		sem := semaphore.NewWeighted(2, semaphore.WithSpin(16))
+		churn(t, sem)
+
+		sem.TryAcquire(2)
+		if sem.TryAcquire(1) {
+			t.Error("TryAcquire should fail when no permits are left")
+		}
+		sem.Release(2)
+		if !sem.TryAcquire(1) {
+			t.Error("TryAcquire should succeed after a release")
+		}
+	})
+
+	t.Run("wake batch", func(t *testing.T) {
+		rec := sim.NewRecorder()
+		sem := semaphore.NewWeighted(4, semaphore.WithWakeBatch(2), semaphore.WithMetrics(rec))
+		sem.TryAcquire(4)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- sem.Acquire(context.Background(), 1)
+		}()
+
+		// Wait for the waiter to park
+		for len(rec.Values("ion_semaphore_queue_depth")) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		sem.Release(1)
+		select {
+		case <-done:
+			t.Fatal("waiter woken before the batch filled")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		sem.Release(1)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("waiter not woken once the batch filled")
+		}
+		if sem.Current() != 1 {
+			t.Errorf("expected 1 permit left, got %d", sem.Current())
+		}
+
+		churn(t, semaphore.NewWeighted(2, semaphore.WithWakeBatch(2)))
+	})
+}
+
+func TestAcquireTimeoutWithClock(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	sem := semaphore.NewWeighted(1,
+		semaphore.WithAcquireTimeout(time.Minute),
+		semaphore.WithClock(clk),
+	)
+	sem.TryAcquire(1)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- sem.Acquire(context.Background(), 1)
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+
+	select {
+	case err := <-errCh:
+		var semErr *semaphore.SemaphoreError
+		if !errors.As(err, &semErr) {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire did not time out when the clock advanced")
+	}
+}
+
+func TestWaitMetrics(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	rec := sim.NewRecorder()
+	sem := semaphore.NewWeighted(4,
+		semaphore.WithName("db"),
+		semaphore.WithFairness(semaphore.LIFO),
+		semaphore.WithClock(clk),
+		semaphore.WithMetrics(rec),
+	)
+
+	if err := sem.Acquire(context.Background(), 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := rec.Values("ion_semaphore_wait_duration_seconds",
+		"fairness", "LIFO", "weight", "1", "result", "success"); len(got) != 1 || got[0] != 0 {
+		t.Errorf("expected one zero wait for the fast path, got %v", got)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sem.Acquire(context.Background(), 4)
+	}()
+
+	// Wait for the acquire to queue
+	for len(rec.Values("ion_semaphore_queue_depth", "fairness", "LIFO")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(2 * time.Second)
+	sem.Release(1)
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := rec.Values("ion_semaphore_wait_duration_seconds",
+		"fairness", "LIFO", "weight", "2-4", "result", "success"); len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected one 2s wait for weight 4, got %v", got)
+	}
+	if got := rec.Values("ion_semaphore_queue_depth", "semaphore_name", "db"); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected a queue depth of 1, got %v", got)
+	}
+}
+
+// spanRecorder records finished spans as "name kv -> err".
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string, kv ...any) (context.Context, func(error)) {
+	return ctx, func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.spans = append(r.spans, fmt.Sprint(name, " ", kv, " -> ", err))
+	}
+}
+
+func (r *spanRecorder) Spans() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.spans...)
+}
+
+func TestAcquireTracing(t *testing.T) {
+	tracer := &spanRecorder{}
+	rec := sim.NewRecorder()
+	sem := semaphore.NewWeighted(2,
+		semaphore.WithName("db-permits"),
+		semaphore.WithTracer(tracer),
+		semaphore.WithMetrics(rec),
+	)
+
+	// The fast path is not traced
+	if err := sem.Acquire(context.Background(), 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spans := tracer.Spans(); len(spans) != 0 {
+		t.Fatalf("expected no span for the fast path, got %v", spans)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sem.Acquire(context.Background(), 1)
+	}()
+	// Wait for the acquire to queue
+	for len(rec.Values("ion_semaphore_queue_depth")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release(1)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(ctx, 2); err == nil {
+		t.Fatal("expected the acquire to fail")
+	}
+
+	want := []string{
+		"semaphore.acquire_wait [semaphore_name db-permits weight 1 fairness FIFO] -> <nil>",
+		"semaphore.acquire_wait [semaphore_name db-permits weight 2 fairness FIFO] -> ion: semaphore \"db-permits\" acquire: acquire timeout",
+	}
+	if got := tracer.Spans(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected spans %q, got %q", want, got)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	newSem := func() (*clock.FakeClock, semaphore.Semaphore) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		return clk, semaphore.NewWeighted(3,
+			semaphore.WithReservationTTL(time.Second),
+			semaphore.WithClock(clk),
+		)
+	}
+
+	t.Run("confirm", func(t *testing.T) {
+		clk, sem := newSem()
+
+		r, err := sem.Reserve(context.Background(), 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sem.Current() != 1 {
+			t.Errorf("expected 1 permit left, got %d", sem.Current())
+		}
+		if !r.Deadline().Equal(clk.Now().Add(time.Second)) {
+			t.Errorf("unexpected deadline %v", r.Deadline())
+		}
+		if err := r.Confirm(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Confirmed permits no longer expire
+		clk.Advance(time.Minute)
+		if sem.Current() != 1 {
+			t.Errorf("expected confirmed permits to stay held, got %d available", sem.Current())
+		}
+		r.Cancel()
+		if sem.Current() != 1 {
+			t.Error("expected cancel after confirm to be a no-op")
+		}
+		sem.Release(r.N())
+		if sem.Current() != 3 {
+			t.Errorf("expected all permits back, got %d", sem.Current())
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		_, sem := newSem()
+
+		r, _ := sem.Reserve(context.Background(), 3)
+		r.Cancel()
+		if sem.Current() != 3 {
+			t.Errorf("expected permits back after cancel, got %d", sem.Current())
+		}
+		if err := r.Confirm(); !errors.Is(err, semaphore.ErrReservationCanceled) {
+			t.Errorf("expected ErrReservationCanceled, got %v", err)
+		}
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		clk, sem := newSem()
+
+		r, _ := sem.Reserve(context.Background(), 3)
+		clk.Advance(time.Second)
+		if sem.Current() != 3 {
+			t.Errorf("expected permits back after expiry, got %d", sem.Current())
+		}
+
+		err := r.Confirm()
+		var semErr *semaphore.SemaphoreError
+		if !errors.As(err, &semErr) || !errors.Is(err, semaphore.ErrReservationExpired) {
+			t.Errorf("expected ErrReservationExpired, got %v", err)
+		}
+	})
+
+	t.Run("coordinator", func(t *testing.T) {
+		_, db := newSem()
+		_, cache := newSem()
+
+		first, _ := db.Reserve(context.Background(), 2)
+		if _, err := cache.Reserve(context.Background(), 4); err == nil {
+			t.Fatal("expected the second reservation to fail")
+		}
+		first.Cancel()
+		if db.Current() != 3 {
+			t.Errorf("expected the first reservation to be rolled back, got %d", db.Current())
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package shed
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded is returned when a call is shed because the concurrency limit is saturated
+var ErrLimitExceeded = errors.New("concurrency limit exceeded")
+
+// ShedError represents load shedding errors with context
+type ShedError struct {
+	Op          string // operation that failed
+	LimiterName string // name of the limiter
+	Limit       int    // concurrency limit at the time of rejection
+	Err         error  // underlying error
+}
+
+func (e *ShedError) Error() string {
+	if e.LimiterName != "" {
+		return fmt.Sprintf("ion: shed %q %s: %v (limit: %d)", e.LimiterName, e.Op, e.Err, e.Limit)
+	}
+	return fmt.Sprintf("ion: shed %s: %v (limit: %d)", e.Op, e.Err, e.Limit)
+}
+
+func (e *ShedError) Unwrap() error {
+	return e.Err
+}
+
+// NewLimitExceededError creates an error indicating a call was shed
+func NewLimitExceededError(limiterName string, limit int) error {
+	return &ShedError{
+		Op:          "acquire",
+		LimiterName: limiterName,
+		Limit:       limit,
+		Err:         ErrLimitExceeded,
+	}
+}
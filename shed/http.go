@@ -0,0 +1,67 @@
+package shed
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Middleware returns HTTP middleware that sheds requests when the limiter is
+// saturated. Shed requests receive 503 Service Unavailable, except those whose
+// context is already done, which get no response. Handler responses with a
+// 5xx status other than 501 are recorded as drops so that a struggling backend
+// shrinks the limit, and a handler panic is recorded as a failure before the
+// panic resumes.
+func Middleware(l *Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, err := l.Acquire(r.Context())
+			if err != nil {
+				if r.Context().Err() != nil {
+					// The client is gone, there is nobody to answer
+					return
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(1))
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				if p := recover(); p != nil {
+					release(errPanicked)
+					panic(p)
+				}
+				if sw.status >= 500 && sw.status != http.StatusNotImplemented {
+					release(errServerError)
+					return
+				}
+				release(nil)
+			}()
+
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// errServerError marks a 5xx handler response as an overload signal.
+var errServerError = errors.New("handler returned server error")
+
+// statusWriter records the status code written by the wrapped handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
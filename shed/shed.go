@@ -0,0 +1,424 @@
+// Package shed provides adaptive concurrency limiting for overload protection.
+//
+// A static concurrency limit goes stale as soon as the latency profile of a
+// dependency changes. The Limiter in this package continuously adjusts its
+// limit from observed latency using a gradient algorithm: while recent
+// latency stays close to the long-term baseline the limit grows, and when
+// latency inflates (a sign of queuing downstream) the limit shrinks. Calls
+// that arrive while the limit is saturated are shed immediately instead of
+// piling up.
+//
+// Usage:
+//
+//	l := shed.New(shed.WithName("search"), shed.WithMaxLimit(200))
+//
+//	err := l.Do(ctx, func(ctx context.Context) error {
+//		return search.Query(ctx, q)
+//	})
+//	if errors.Is(err, shed.ErrLimitExceeded) {
+//		// fail fast, e.g. return 503
+//	}
+package shed
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+)
+
+// Limiter is an adaptive concurrency limiter. It admits calls while the number
+// of in-flight calls is below the current limit and adjusts the limit after
+// every completed call based on the measured round-trip time.
+type Limiter struct {
+	// Configuration
+	name       string
+	minLimit   float64
+	maxLimit   float64
+	smoothing  float64
+	tolerance  float64
+	longWindow float64
+	isDrop     func(error) bool
+	clock      clock.Clock
+
+	// Observability
+	obs *observe.Observability
+
+	// State
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	longRTT  float64 // exponentially weighted long-term RTT in seconds
+	minRTT   float64 // lowest RTT observed, in seconds
+
+	// Counters
+	accepted uint64
+	rejected uint64
+	dropped  uint64
+}
+
+// Metrics holds a snapshot of limiter state.
+type Metrics struct {
+	Limit    int           // current concurrency limit
+	InFlight int           // calls currently executing
+	Accepted uint64        // total admitted calls
+	Rejected uint64        // total shed calls
+	Dropped  uint64        // admitted calls that ended in a drop (error or timeout)
+	LongRTT  time.Duration // long-term latency baseline
+	MinRTT   time.Duration // lowest observed latency
+}
+
+// Option configures limiter behavior.
+type Option func(*config)
+
+type config struct {
+	name         string
+	initialLimit int
+	minLimit     int
+	maxLimit     int
+	smoothing    float64
+	tolerance    float64
+	longWindow   int
+	isDrop       func(error) bool
+	clock        clock.Clock
+	obs          *observe.Observability
+}
+
+// WithName sets the limiter name for observability and error reporting.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithInitialLimit sets the concurrency limit used before any samples are observed.
+func WithInitialLimit(limit int) Option {
+	return func(c *config) {
+		c.initialLimit = limit
+	}
+}
+
+// WithMinLimit sets the lower bound for the concurrency limit.
+func WithMinLimit(limit int) Option {
+	return func(c *config) {
+		c.minLimit = limit
+	}
+}
+
+// WithMaxLimit sets the upper bound for the concurrency limit.
+func WithMaxLimit(limit int) Option {
+	return func(c *config) {
+		c.maxLimit = limit
+	}
+}
+
+// WithSmoothing sets how quickly the limit moves toward a newly computed value
+// (0.0 to 1.0). Lower values react more slowly but are more stable.
+func WithSmoothing(smoothing float64) Option {
+	return func(c *config) {
+		if smoothing <= 0 {
+			smoothing = 0.01
+		}
+		if smoothing > 1 {
+			smoothing = 1
+		}
+		c.smoothing = smoothing
+	}
+}
+
+// WithTolerance sets how much latency inflation relative to the long-term
+// baseline is accepted before the limit starts shrinking. A tolerance of 1.5
+// allows recent latency to reach 150% of the baseline.
+func WithTolerance(tolerance float64) Option {
+	return func(c *config) {
+		if tolerance < 1 {
+			tolerance = 1
+		}
+		c.tolerance = tolerance
+	}
+}
+
+// WithLongWindow sets the number of samples averaged into the long-term
+// latency baseline.
+func WithLongWindow(samples int) Option {
+	return func(c *config) {
+		c.longWindow = samples
+	}
+}
+
+// WithDropPredicate sets a predicate that decides whether an error returned by
+// the protected function indicates overload. Drops shrink the limit
+// multiplicatively. If not set, context deadline errors are treated as drops
+// and all other errors are ignored for limit calculation.
+func WithDropPredicate(isDrop func(error) bool) Option {
+	return func(c *config) {
+		c.isDrop = isDrop
+	}
+}
+
+// WithClock sets the clock used to measure call latency.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithLogger sets the logger for observability.
+func WithLogger(logger observe.Logger) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithLogger(logger)
+	}
+}
+
+// WithMetrics sets the metrics recorder for observability.
+func WithMetrics(metrics observe.Metrics) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithMetrics(metrics)
+	}
+}
+
+// WithTracer sets the tracer for observability.
+func WithTracer(tracer observe.Tracer) Option {
+	return func(c *config) {
+		c.obs = c.obs.WithTracer(tracer)
+	}
+}
+
+// New creates a new adaptive concurrency limiter.
+func New(opts ...Option) *Limiter {
+	cfg := &config{
+		name:         "",
+		initialLimit: 20,
+		minLimit:     1,
+		maxLimit:     1000,
+		smoothing:    0.2,
+		tolerance:    1.5,
+		longWindow:   600,
+		isDrop:       defaultIsDrop,
+		clock:        clock.Real(),
+		obs:          observe.New(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.minLimit <= 0 {
+		cfg.minLimit = 1
+	}
+	if cfg.maxLimit < cfg.minLimit {
+		cfg.maxLimit = cfg.minLimit
+	}
+	if cfg.longWindow <= 0 {
+		cfg.longWindow = 600
+	}
+	if cfg.isDrop == nil {
+		cfg.isDrop = defaultIsDrop
+	}
+
+	l := &Limiter{
+		name:       cfg.name,
+		minLimit:   float64(cfg.minLimit),
+		maxLimit:   float64(cfg.maxLimit),
+		smoothing:  cfg.smoothing,
+		tolerance:  cfg.tolerance,
+		longWindow: float64(cfg.longWindow),
+		isDrop:     cfg.isDrop,
+		clock:      cfg.clock,
+		obs:        cfg.obs,
+	}
+	l.limit = l.clamp(float64(cfg.initialLimit))
+
+	l.obs.Logger.Info("load shedder created",
+		"name", l.name,
+		"initial_limit", int(l.limit),
+		"min_limit", cfg.minLimit,
+		"max_limit", cfg.maxLimit,
+	)
+
+	return l
+}
+
+// errPanicked marks a call that panicked, so that it is not recorded as a
+// successful latency sample.
+var errPanicked = errors.New("call panicked")
+
+// defaultIsDrop treats deadline expiry as a sign of overload.
+func defaultIsDrop(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// Do runs fn if the limiter has spare capacity, otherwise it returns a
+// *ShedError wrapping ErrLimitExceeded without calling fn. The latency of
+// admitted calls is fed back into the limit calculation. If fn panics, the
+// call is recorded as a failure and the panic resumes.
+func (l *Limiter) Do(ctx context.Context, fn func(context.Context) error) error {
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	spanCtx, finish := l.obs.WithContext(ctx).Tracer.Start(ctx, "shed.do", "name", l.name)
+
+	var fnErr error
+	defer func() {
+		if r := recover(); r != nil {
+			finish(errPanicked)
+			release(errPanicked)
+			panic(r)
+		}
+		finish(fnErr)
+		release(fnErr)
+	}()
+
+	fnErr = fn(spanCtx)
+	return fnErr
+}
+
+// Acquire reserves a concurrency slot for callers that cannot express their
+// work as a single function. The returned release function must be called
+// exactly once with the outcome of the work; it records the latency sample
+// and frees the slot.
+func (l *Limiter) Acquire(ctx context.Context) (release func(err error), err error) {
+	obs := l.obs.WithContext(ctx)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	if float64(l.inFlight) >= l.limit {
+		l.rejected++
+		limit := int(l.limit)
+		l.mu.Unlock()
+
+		obs.Metrics.Inc("ion_shed_requests_total", "name", l.name, "result", "rejected")
+		return nil, NewLimitExceededError(l.name, limit)
+	}
+	l.inFlight++
+	l.accepted++
+	inFlight := l.inFlight
+	l.mu.Unlock()
+
+	obs.Metrics.Inc("ion_shed_requests_total", "name", l.name, "result", "accepted")
+	obs.Metrics.Gauge("ion_shed_in_flight", float64(inFlight), "name", l.name)
+
+	start := l.clock.Now()
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			l.onSample(l.clock.Since(start), inFlight, err)
+		})
+	}, nil
+}
+
+// onSample releases a slot and updates the limit from a completed call.
+func (l *Limiter) onSample(rtt time.Duration, inFlight int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	old := l.limit
+
+	switch {
+	case err != nil && (err == errServerError || l.isDrop(err)):
+		l.dropped++
+		l.limit = l.clamp(l.limit * 0.9)
+
+	case err != nil:
+		// Non-overload errors carry no useful latency signal.
+
+	default:
+		l.updateLocked(rtt.Seconds(), inFlight)
+	}
+
+	if int(l.limit) != int(old) {
+		l.obs.Logger.Debug("load shedder limit changed",
+			"name", l.name,
+			"from", int(old),
+			"to", int(l.limit),
+		)
+	}
+	l.obs.Metrics.Gauge("ion_shed_limit", l.limit, "name", l.name)
+	l.obs.Metrics.Gauge("ion_shed_in_flight", float64(l.inFlight), "name", l.name)
+	l.obs.Metrics.Histogram("ion_shed_rtt_seconds", rtt.Seconds(), "name", l.name)
+}
+
+// updateLocked applies the gradient algorithm for a successful sample.
+// Must be called with l.mu held.
+func (l *Limiter) updateLocked(rtt float64, inFlight int) {
+	if rtt <= 0 {
+		return
+	}
+
+	if l.minRTT == 0 || rtt < l.minRTT {
+		l.minRTT = rtt
+	}
+
+	if l.longRTT == 0 {
+		l.longRTT = rtt
+	} else {
+		l.longRTT += (rtt - l.longRTT) / l.longWindow
+	}
+
+	// Recover quickly from a baseline that was inflated by a past incident.
+	if l.longRTT/rtt > 2 {
+		l.longRTT *= 0.95
+	}
+
+	// The application is not using the available concurrency, so there is no
+	// evidence that a higher limit is safe.
+	if float64(inFlight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, l.tolerance*l.longRTT/rtt))
+	queueSize := math.Sqrt(l.limit)
+	target := l.limit*gradient + queueSize
+
+	l.limit = l.clamp(l.limit*(1-l.smoothing) + target*l.smoothing)
+}
+
+// clamp bounds a limit to the configured range.
+func (l *Limiter) clamp(limit float64) float64 {
+	return math.Max(l.minLimit, math.Min(l.maxLimit, limit))
+}
+
+// Limit returns the current concurrency limit.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of calls currently executing.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Name returns the limiter name.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Metrics returns a snapshot of the limiter state.
+func (l *Limiter) Metrics() Metrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Metrics{
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		Accepted: l.accepted,
+		Rejected: l.rejected,
+		Dropped:  l.dropped,
+		LongRTT:  time.Duration(l.longRTT * float64(time.Second)),
+		MinRTT:   time.Duration(l.minRTT * float64(time.Second)),
+	}
+}
@@ -0,0 +1,227 @@
+package shed_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/shed"
+)
+
+func TestLimiterDo(t *testing.T) {
+	t.Run("admits calls below limit", func(t *testing.T) {
+		l := shed.New(shed.WithInitialLimit(2))
+
+		called := false
+		err := l.Do(context.Background(), func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !called {
+			t.Error("expected function to be called")
+		}
+		if l.InFlight() != 0 {
+			t.Errorf("expected 0 in flight after return, got %d", l.InFlight())
+		}
+	})
+
+	t.Run("sheds calls at limit", func(t *testing.T) {
+		l := shed.New(shed.WithName("test"), shed.WithInitialLimit(1), shed.WithMaxLimit(1))
+
+		started := make(chan struct{})
+		block := make(chan struct{})
+		go l.Do(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-block
+			return nil
+		})
+		<-started
+
+		err := l.Do(context.Background(), func(ctx context.Context) error {
+			t.Error("shed call should not run")
+			return nil
+		})
+		close(block)
+
+		if !errors.Is(err, shed.ErrLimitExceeded) {
+			t.Fatalf("expected ErrLimitExceeded, got %v", err)
+		}
+		var shedErr *shed.ShedError
+		if !errors.As(err, &shedErr) || shedErr.Limit != 1 {
+			t.Errorf("expected ShedError with limit 1, got %v", err)
+		}
+		if m := l.Metrics(); m.Rejected != 1 {
+			t.Errorf("expected 1 rejected, got %d", m.Rejected)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		l := shed.New()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := l.Do(ctx, func(ctx context.Context) error { return nil })
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestLimiterWrappedDeadlineIsDrop(t *testing.T) {
+	l := shed.New()
+	l.Do(context.Background(), func(ctx context.Context) error {
+		return fmt.Errorf("query: %w", context.DeadlineExceeded)
+	})
+	if m := l.Metrics(); m.Dropped != 1 {
+		t.Errorf("expected 1 drop, got %d", m.Dropped)
+	}
+}
+
+func TestLimiterClock(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	l := shed.New(shed.WithClock(clk))
+
+	l.Do(context.Background(), func(ctx context.Context) error {
+		clk.Advance(10 * time.Millisecond)
+		return nil
+	})
+	if m := l.Metrics(); m.MinRTT != 10*time.Millisecond {
+		t.Errorf("expected min RTT of 10ms on the fake clock, got %v", m.MinRTT)
+	}
+}
+
+func TestLimiterAdapts(t *testing.T) {
+	t.Run("drops shrink the limit", func(t *testing.T) {
+		l := shed.New(shed.WithInitialLimit(100))
+
+		for i := 0; i < 10; i++ {
+			_ = l.Do(context.Background(), func(ctx context.Context) error {
+				return context.DeadlineExceeded
+			})
+		}
+
+		if got := l.Limit(); got >= 100 {
+			t.Errorf("expected limit to shrink below 100, got %d", got)
+		}
+		if m := l.Metrics(); m.Dropped != 10 {
+			t.Errorf("expected 10 drops, got %d", m.Dropped)
+		}
+	})
+
+	t.Run("saturated fast calls grow the limit", func(t *testing.T) {
+		l := shed.New(shed.WithInitialLimit(4), shed.WithMaxLimit(50))
+
+		for round := 0; round < 20; round++ {
+			var wg sync.WaitGroup
+			for i := 0; i < l.Limit(); i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_ = l.Do(context.Background(), func(ctx context.Context) error {
+						time.Sleep(time.Millisecond)
+						return nil
+					})
+				}()
+			}
+			wg.Wait()
+		}
+
+		if got := l.Limit(); got <= 4 {
+			t.Errorf("expected limit to grow above 4, got %d", got)
+		}
+	})
+
+	t.Run("limit stays within bounds", func(t *testing.T) {
+		l := shed.New(shed.WithInitialLimit(500), shed.WithMinLimit(3), shed.WithMaxLimit(10))
+		if got := l.Limit(); got != 10 {
+			t.Errorf("expected initial limit clamped to 10, got %d", got)
+		}
+
+		for i := 0; i < 50; i++ {
+			_ = l.Do(context.Background(), func(ctx context.Context) error {
+				return context.DeadlineExceeded
+			})
+		}
+		if got := l.Limit(); got != 3 {
+			t.Errorf("expected limit clamped to 3, got %d", got)
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	l := shed.New(shed.WithInitialLimit(1), shed.WithMaxLimit(1))
+
+	started := make(chan struct{})
+	block := make(chan struct{})
+	handler := shed.Middleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-block
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	close(block)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	l := shed.New()
+	handler := shed.Middleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected panic to resume, got %v", r)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	m := l.Metrics()
+	if m.InFlight != 0 {
+		t.Errorf("expected 0 in flight, got %d", m.InFlight)
+	}
+	if m.MinRTT != 0 {
+		t.Errorf("expected no latency sample from a panic, got min RTT %v", m.MinRTT)
+	}
+}
+
+func TestMiddlewareCanceledRequest(t *testing.T) {
+	l := shed.New()
+	handler := shed.Middleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	if rec.Header().Get("Retry-After") != "" || rec.Body.Len() != 0 {
+		t.Errorf("expected no response for a canceled request, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,191 @@
+package sim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Recorder is an observe.Metrics implementation that keeps every recorded
+// value in memory so a simulation can assert on it. Counters and gauges are
+// kept per label set; queries match any series whose labels include the
+// given key-value pairs.
+type Recorder struct {
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	name    string
+	labels  map[string]string
+	count   float64
+	gauge   float64
+	isGauge bool
+	values  []float64
+}
+
+// NewRecorder creates an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{series: make(map[string]*series)}
+}
+
+// Inc adds one to a counter.
+func (r *Recorder) Inc(name string, kv ...any) {
+	r.Add(name, 1, kv...)
+}
+
+// Add adds v to a counter.
+func (r *Recorder) Add(name string, v float64, kv ...any) {
+	r.mu.Lock()
+	r.get(name, kv).count += v
+	r.mu.Unlock()
+}
+
+// Gauge sets a gauge.
+func (r *Recorder) Gauge(name string, v float64, kv ...any) {
+	r.mu.Lock()
+	s := r.get(name, kv)
+	s.gauge, s.isGauge = v, true
+	r.mu.Unlock()
+}
+
+// Histogram records an observation.
+func (r *Recorder) Histogram(name string, v float64, kv ...any) {
+	r.mu.Lock()
+	s := r.get(name, kv)
+	s.values = append(s.values, v)
+	r.mu.Unlock()
+}
+
+// Count returns the sum of the counters named name whose labels include kv.
+func (r *Recorder) Count(name string, kv ...any) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total float64
+	for _, s := range r.match(name, kv) {
+		total += s.count
+	}
+	return total
+}
+
+// GaugeValue returns the last value of the gauge named name whose labels
+// include kv, or false if none was set. If several series match, the one
+// with the lexically smallest label set is returned.
+func (r *Recorder) GaugeValue(name string, kv ...any) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.match(name, kv) {
+		if s.isGauge {
+			return s.gauge, true
+		}
+	}
+	return 0, false
+}
+
+// Values returns the histogram observations named name whose labels include
+// kv, in recording order per series.
+func (r *Recorder) Values(name string, kv ...any) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var values []float64
+	for _, s := range r.match(name, kv) {
+		values = append(values, s.values...)
+	}
+	return values
+}
+
+// Names returns the names of every recorded metric, sorted.
+func (r *Recorder) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range r.series {
+		if !seen[s.name] {
+			seen[s.name] = true
+			names = append(names, s.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reset discards everything recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series = make(map[string]*series)
+}
+
+// get returns the series for name and kv, creating it. Must be called with
+// r.mu held.
+func (r *Recorder) get(name string, kv []any) *series {
+	labels := toLabels(kv)
+	key := seriesKey(name, labels)
+	s, ok := r.series[key]
+	if !ok {
+		s = &series{name: name, labels: labels}
+		r.series[key] = s
+	}
+	return s
+}
+
+// match returns the series named name whose labels include kv, ordered by
+// series key. Must be called with r.mu held.
+func (r *Recorder) match(name string, kv []any) []*series {
+	want := toLabels(kv)
+
+	var keys []string
+	for key, s := range r.series {
+		if s.name == name && hasLabels(s.labels, want) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	matched := make([]*series, len(keys))
+	for i, key := range keys {
+		matched[i] = r.series[key]
+	}
+	return matched
+}
+
+func toLabels(kv []any) map[string]string {
+	labels := make(map[string]string, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		labels[fmt.Sprint(kv[i])] = fmt.Sprint(kv[i+1])
+	}
+	return labels
+}
+
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString("|")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
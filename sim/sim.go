@@ -0,0 +1,360 @@
+// Package sim runs Ion components against a fake clock with scripted
+// workloads, so a configuration can be validated deterministically in CI.
+//
+// A Sim owns a clock.FakeClock and a Recorder. Components under test are
+// built with the simulation clock and recorder, a workload is scripted with
+// At, Every and Phase, and Run moves simulated time forward from one event to
+// the next: scheduled workload steps, component timers and simulated work
+// completing. Between events the simulation waits for the components to
+// react before moving on, so minutes of traffic run in seconds and the
+// resulting metrics (throughput, drops, state transitions) can be asserted
+// on exactly.
+//
+// Usage:
+//
+//	s := sim.New()
+//	pool := workerpool.New(4, 8,
+//		workerpool.WithClock(s.Clock()),
+//		workerpool.WithMetrics(s.Metrics()),
+//	)
+//
+//	// 200 requests per second, each taking 25ms of simulated time
+//	s.Every(5*time.Millisecond, func() {
+//		pool.TrySubmit(s.Work(25 * time.Millisecond))
+//	})
+//	s.Run(10 * time.Second)
+//
+//	completed := s.Metrics().Count("ion_workerpool_tasks_completed_total", "status", "success")
+//
+// Workload functions run on the goroutine calling Run and must not block on
+// the simulated clock; use Go for steps that do, such as a limiter Wait.
+// Simulated work should sleep with Work or on Clock rather than real time.
+//
+// After each event Run waits for the Work tasks woken by it to return, and
+// then until the Go scheduler reports every other goroutine in the process as
+// blocked, so whatever the components started in reaction to the event, such
+// as a worker picking up the next queued task, has reached the clock before
+// time moves on. No real-time delay is involved, so a loaded machine only
+// makes the simulation slower, never different. Goroutines doing unrelated
+// work in the same process hold Run up until they block.
+package sim
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+// Option configures a simulation.
+type Option func(*config)
+
+type config struct {
+	start time.Time
+}
+
+// WithStart sets the simulated start time. The default is the Unix epoch.
+func WithStart(t time.Time) Option {
+	return func(c *config) {
+		c.start = t
+	}
+}
+
+// event is a scripted workload step.
+type event struct {
+	at time.Time
+	fn func()
+}
+
+// Sim is a deterministic simulation. Scripting methods may be called before
+// and during Run, from workload steps included; Run must not be called
+// concurrently.
+type Sim struct {
+	clock   *clock.FakeClock
+	metrics *Recorder
+	start   time.Time
+
+	mu     sync.Mutex
+	events []event
+	woken  int        // Work tasks whose time has elapsed but that have not returned
+	idle   *sync.Cond // broadcast when woken drops to zero
+
+	wg     sync.WaitGroup
+	stacks []byte
+}
+
+// New creates a simulation.
+func New(opts ...Option) *Sim {
+	cfg := &config{
+		start: time.Unix(0, 0),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	s := &Sim{
+		clock:   clock.NewFake(cfg.start),
+		metrics: NewRecorder(),
+		start:   cfg.start,
+	}
+	s.idle = sync.NewCond(&s.mu)
+	return s
+}
+
+// Clock returns the simulation clock, to be passed to components with their
+// WithClock option.
+func (s *Sim) Clock() *clock.FakeClock {
+	return s.clock
+}
+
+// Metrics returns the simulation recorder, to be passed to components with
+// their WithMetrics option.
+func (s *Sim) Metrics() *Recorder {
+	return s.metrics
+}
+
+// Now returns the simulated time.
+func (s *Sim) Now() time.Time {
+	return s.clock.Now()
+}
+
+// Elapsed returns the simulated time since the start of the simulation.
+func (s *Sim) Elapsed() time.Duration {
+	return s.clock.Since(s.start)
+}
+
+// Rate returns the counters named name whose labels include kv, per
+// simulated second elapsed.
+func (s *Sim) Rate(name string, kv ...any) float64 {
+	elapsed := s.Elapsed().Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return s.metrics.Count(name, kv...) / elapsed
+}
+
+// At schedules fn to run once, offset after the current simulated time.
+func (s *Sim) At(offset time.Duration, fn func()) {
+	s.schedule(s.clock.Now().Add(offset), fn)
+}
+
+// Every schedules fn to run now and then every interval, for as long as the
+// simulation runs.
+func (s *Sim) Every(interval time.Duration, fn func()) {
+	s.Phase(0, 0, interval, fn)
+}
+
+// Phase schedules fn to run every interval from offset from until offset to,
+// both relative to the current simulated time. A zero to means no end.
+// Consecutive phases script changing load, such as a ramp or a burst.
+func (s *Sim) Phase(from, to, interval time.Duration, fn func()) {
+	if interval <= 0 {
+		panic("sim: non-positive interval")
+	}
+
+	now := s.clock.Now()
+	end := time.Time{}
+	if to > 0 {
+		end = now.Add(to)
+	}
+
+	var step func()
+	next := now.Add(from)
+	step = func() {
+		fn()
+		next = next.Add(interval)
+		if end.IsZero() || next.Before(end) {
+			s.schedule(next, step)
+		}
+	}
+	if end.IsZero() || next.Before(end) {
+		s.schedule(next, step)
+	}
+}
+
+// Go runs fn on its own goroutine, for workload steps that block on the
+// simulated clock. Run waits for such goroutines only until they block;
+// Wait waits for them to return.
+func (s *Sim) Go(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until every goroutine started with Go has returned. Goroutines
+// still waiting on the clock only return once Run has advanced it far enough.
+func (s *Sim) Wait() {
+	s.wg.Wait()
+}
+
+// Work returns a task that takes d of simulated time, or returns the context
+// error if its context is done first. It fits workerpool.Task and any other
+// func(context.Context) error.
+func (s *Sim) Work(d time.Duration) func(context.Context) error {
+	return func(ctx context.Context) error {
+		elapsed := make(chan struct{})
+		// The callback runs during Advance, so Run counts the task as
+		// woken before it waits for the components to react.
+		timer := s.clock.AfterFunc(d, func() {
+			s.wake(1)
+			close(elapsed)
+		})
+
+		select {
+		case <-elapsed:
+			s.wake(-1)
+			return nil
+		case <-ctx.Done():
+			if !timer.Stop() {
+				<-elapsed
+				s.wake(-1)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// wake adjusts the number of woken Work tasks.
+func (s *Sim) wake(delta int) {
+	s.mu.Lock()
+	s.woken += delta
+	if s.woken == 0 {
+		s.idle.Broadcast()
+	}
+	s.mu.Unlock()
+}
+
+// Run moves the simulation forward by d. Each step advances the clock to the
+// next scheduled workload step or component timer, whichever comes first,
+// fires the timers due at that time, runs the workload steps due at that
+// time in the order they were scheduled, and waits for the components to go
+// quiet. Workload steps scheduled exactly at the end are left for the next
+// call to Run.
+func (s *Sim) Run(d time.Duration) {
+	end := s.clock.Now().Add(d)
+
+	for {
+		s.quiesce()
+
+		next, ok := s.next()
+		if !ok || !next.Before(end) {
+			break
+		}
+
+		// Let components react to the timers before the workload moves on.
+		timer, hasTimer := s.clock.Next()
+		s.clock.Advance(next.Sub(s.clock.Now()))
+		if hasTimer && !timer.After(next) {
+			s.quiesce()
+		}
+		s.runDue(next)
+	}
+
+	s.clock.Advance(end.Sub(s.clock.Now()))
+	s.quiesce()
+}
+
+// schedule adds a workload step, keeping events sorted by time and then by
+// scheduling order.
+func (s *Sim) schedule(at time.Time, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := event{at: at, fn: fn}
+
+	i := sort.Search(len(s.events), func(i int) bool {
+		return s.events[i].at.After(at)
+	})
+	s.events = append(s.events, event{})
+	copy(s.events[i+1:], s.events[i:])
+	s.events[i] = e
+}
+
+// next returns the time of the earliest workload step or component timer.
+func (s *Sim) next() (time.Time, bool) {
+	next, ok := s.clock.Next()
+
+	s.mu.Lock()
+	if len(s.events) > 0 && (!ok || s.events[0].at.Before(next)) {
+		next, ok = s.events[0].at, true
+	}
+	s.mu.Unlock()
+
+	return next, ok
+}
+
+// runDue runs the workload steps scheduled at or before now.
+func (s *Sim) runDue(now time.Time) {
+	for {
+		s.mu.Lock()
+		if len(s.events) == 0 || s.events[0].at.After(now) {
+			s.mu.Unlock()
+			return
+		}
+		e := s.events[0]
+		s.events = s.events[1:]
+		s.mu.Unlock()
+
+		e.fn()
+	}
+}
+
+// quiesce waits until the Work tasks woken by the last event have returned
+// and every other goroutine is blocked.
+func (s *Sim) quiesce() {
+	s.mu.Lock()
+	for s.woken > 0 {
+		s.idle.Wait()
+	}
+	s.mu.Unlock()
+
+	for !s.othersBlocked() {
+		runtime.Gosched()
+	}
+}
+
+// quiesceFrame identifies goroutines of other simulations waiting in quiesce,
+// which are running but waiting just like the caller.
+var quiesceFrame = []byte(reflect.TypeFor[Sim]().PkgPath() + ".(*Sim).quiesce(")
+
+// othersBlocked reports whether the scheduler shows every goroutine other
+// than the caller, and other simulations in quiesce, as blocked.
+func (s *Sim) othersBlocked() bool {
+	if s.stacks == nil {
+		s.stacks = make([]byte, 64<<10)
+	}
+	for {
+		n := runtime.Stack(s.stacks[:cap(s.stacks)], true)
+		if n < cap(s.stacks) {
+			s.stacks = s.stacks[:n]
+			break
+		}
+		s.stacks = make([]byte, 2*cap(s.stacks))
+	}
+
+	// Goroutines are separated by blank lines and the caller comes first.
+	// Each starts with a header such as "goroutine 7 [chan receive]:".
+	for i, g := range bytes.Split(s.stacks, []byte("\n\n")) {
+		if i == 0 {
+			continue
+		}
+		_, state, _ := bytes.Cut(g, []byte("["))
+		state, _, _ = bytes.Cut(state, []byte("]"))
+		state, _, _ = bytes.Cut(state, []byte(","))
+		switch string(state) {
+		case "running", "runnable":
+			if !bytes.Contains(g, quiesceFrame) {
+				return false
+			}
+		}
+	}
+	return true
+}
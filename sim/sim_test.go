@@ -0,0 +1,226 @@
+package sim_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/circuit"
+	"github.com/kolosys/ion/ratelimit"
+	"github.com/kolosys/ion/semaphore"
+	"github.com/kolosys/ion/sim"
+	"github.com/kolosys/ion/workerpool"
+)
+
+func TestSchedule(t *testing.T) {
+	s := sim.New()
+
+	var times []time.Duration
+	record := func() { times = append(times, s.Elapsed()) }
+
+	s.At(25*time.Millisecond, record)
+	s.Phase(10*time.Millisecond, 40*time.Millisecond, 10*time.Millisecond, record)
+	s.Run(100 * time.Millisecond)
+
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond, 30 * time.Millisecond}
+	if len(times) != len(want) {
+		t.Fatalf("expected %v, got %v", want, times)
+	}
+	for i := range want {
+		if times[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, times)
+			break
+		}
+	}
+	if s.Elapsed() != 100*time.Millisecond {
+		t.Errorf("expected 100ms elapsed, got %v", s.Elapsed())
+	}
+}
+
+func TestQuiescence(t *testing.T) {
+	s := sim.New()
+
+	finished := make(chan time.Duration, 1)
+	s.At(10*time.Millisecond, func() {
+		go func() {
+			// Real-time work the simulation cannot see, before the task
+			// reaches the clock.
+			for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+			}
+			s.Work(20 * time.Millisecond)(context.Background())
+			finished <- s.Elapsed()
+		}()
+	})
+	s.Run(100 * time.Millisecond)
+
+	if got := <-finished; got != 30*time.Millisecond {
+		t.Errorf("expected the work to finish at 30ms, got %v", got)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := sim.NewRecorder()
+	r.Inc("requests", "result", "ok", "route", "a")
+	r.Inc("requests", "result", "ok", "route", "b")
+	r.Add("requests", 2, "result", "error", "route", "a")
+	r.Gauge("queue", 3)
+	r.Histogram("latency", 0.5, "route", "a")
+	r.Histogram("latency", 1.5, "route", "a")
+
+	if got := r.Count("requests"); got != 4 {
+		t.Errorf("expected 4 requests, got %v", got)
+	}
+	if got := r.Count("requests", "result", "ok"); got != 2 {
+		t.Errorf("expected 2 ok requests, got %v", got)
+	}
+	if got, ok := r.GaugeValue("queue"); !ok || got != 3 {
+		t.Errorf("expected gauge 3, got %v, %v", got, ok)
+	}
+	if got := r.Values("latency", "route", "a"); len(got) != 2 || got[1] != 1.5 {
+		t.Errorf("expected two latency values, got %v", got)
+	}
+	if names := r.Names(); len(names) != 3 || names[0] != "latency" {
+		t.Errorf("unexpected names %v", names)
+	}
+}
+
+// poolScenario offers 100 requests per second of 30ms tasks to a pool that
+// can serve about 67 per second.
+func poolScenario() (accepted, rejected int, completed float64) {
+	s := sim.New()
+	pool := workerpool.New(2, 2,
+		workerpool.WithClock(s.Clock()),
+		workerpool.WithMetrics(s.Metrics()),
+	)
+
+	s.Every(10*time.Millisecond, func() {
+		if err := pool.TrySubmit(s.Work(30 * time.Millisecond)); err != nil {
+			rejected++
+		} else {
+			accepted++
+		}
+	})
+	s.Run(time.Second)
+
+	completed = s.Metrics().Count("ion_workerpool_tasks_completed_total", "status", "success")
+	pool.Close(context.Background())
+	return accepted, rejected, completed
+}
+
+func TestWorkerPool(t *testing.T) {
+	accepted, rejected, completed := poolScenario()
+
+	if accepted+rejected != 100 {
+		t.Fatalf("expected 100 submissions, got %d", accepted+rejected)
+	}
+	if rejected == 0 {
+		t.Error("expected an overloaded pool to reject work")
+	}
+	if completed < 60 || completed > 67 {
+		t.Errorf("expected about 67 completions per second, got %v", completed)
+	}
+
+	for i := 0; i < 3; i++ {
+		a, r, c := poolScenario()
+		if a != accepted || r != rejected || c != completed {
+			t.Fatalf("run %d diverged: %d/%d/%v accepted/rejected/completed, want %d/%d/%v",
+				i, a, r, c, accepted, rejected, completed)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	s := sim.New()
+	limiter := ratelimit.NewTokenBucket(ratelimit.PerSecond(10), 5,
+		ratelimit.WithClock(s.Clock()),
+		ratelimit.WithMetrics(s.Metrics()),
+	)
+
+	s.Every(20*time.Millisecond, func() {
+		limiter.AllowN(s.Now(), 1)
+	})
+	s.Run(time.Second)
+
+	// The burst plus one token per 100ms of the 980ms until the last request.
+	allowed := s.Metrics().Count("ion_ratelimit_requests_total", "result", "allowed")
+	denied := s.Metrics().Count("ion_ratelimit_requests_total", "result", "denied")
+	if allowed != 14 || allowed+denied != 50 {
+		t.Errorf("expected 14 of 50 requests allowed, got %v allowed, %v denied", allowed, denied)
+	}
+	if rate := s.Rate("ion_ratelimit_requests_total", "result", "allowed"); rate != 14 {
+		t.Errorf("expected 14 allowed per second, got %v", rate)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	s := sim.New()
+	cb := circuit.New("upstream",
+		circuit.WithFailureThreshold(3),
+		circuit.WithRecoveryTimeout(100*time.Millisecond),
+		circuit.WithHalfOpenSuccessThreshold(1),
+		circuit.WithClock(s.Clock()),
+		circuit.WithMetrics(s.Metrics()),
+	)
+
+	// The dependency is down for the first 200ms.
+	down := true
+	s.At(200*time.Millisecond, func() { down = false })
+	s.Every(10*time.Millisecond, func() {
+		cb.Call(context.Background(), func(ctx context.Context) error {
+			if down {
+				return errors.New("unavailable")
+			}
+			return nil
+		})
+	})
+	s.Run(time.Second)
+
+	transitions := map[[2]string]float64{
+		{"Closed", "Open"}:     1,
+		{"Open", "HalfOpen"}:   2,
+		{"HalfOpen", "Open"}:   1,
+		{"HalfOpen", "Closed"}: 1,
+	}
+	for tr, want := range transitions {
+		if got := s.Metrics().Count("circuit.state_changes", "from", tr[0], "to", tr[1]); got != want {
+			t.Errorf("expected %v transitions from %s to %s, got %v", want, tr[0], tr[1], got)
+		}
+	}
+	if cb.State() != circuit.Closed {
+		t.Errorf("expected the circuit to recover, got %v", cb.State())
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	s := sim.New()
+	sem := semaphore.NewWeighted(2,
+		semaphore.WithClock(s.Clock()),
+		semaphore.WithMetrics(s.Metrics()),
+	)
+
+	var acquired, timedOut atomic.Int32
+	s.Phase(0, time.Second, 10*time.Millisecond, func() {
+		s.Go(func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stop := s.Clock().AfterFunc(15*time.Millisecond, cancel)
+			defer stop.Stop()
+
+			if err := sem.Acquire(ctx, 1); err != nil {
+				timedOut.Add(1)
+				return
+			}
+			acquired.Add(1)
+			s.Work(50 * time.Millisecond)(context.Background())
+			sem.Release(1)
+		})
+	})
+	s.Run(1100 * time.Millisecond) // the last holders finish after the load stops
+	s.Wait()
+
+	if acquired.Load()+timedOut.Load() != 100 || timedOut.Load() == 0 {
+		t.Errorf("expected some of 100 acquisitions to time out, got %d acquired, %d timed out", acquired.Load(), timedOut.Load())
+	}
+}
@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+// RollingCounter counts events over a sliding time window. The window is
+// split into buckets; each bucket expires as a whole once it falls out of the
+// window, so the window slides with the granularity of one bucket.
+type RollingCounter struct {
+	clock  clock.Clock
+	window time.Duration
+	width  time.Duration
+
+	mu     sync.Mutex
+	counts []int64
+	epochs []int64 // bucket epoch each count belongs to
+}
+
+// NewRollingCounter creates a counter over window split into buckets. More
+// buckets make the window slide more smoothly at the cost of memory.
+func NewRollingCounter(window time.Duration, buckets int, opts ...Option) *RollingCounter {
+	cfg := newConfig(opts)
+	buckets = max(buckets, 1)
+	width := max(window/time.Duration(buckets), 1)
+
+	return &RollingCounter{
+		clock:  cfg.clock,
+		window: width * time.Duration(buckets),
+		width:  width,
+		counts: make([]int64, buckets),
+		epochs: make([]int64, buckets),
+	}
+}
+
+// Inc counts one event.
+func (c *RollingCounter) Inc() {
+	c.Add(1)
+}
+
+// Add counts n events.
+func (c *RollingCounter) Add(n int64) {
+	i, epoch := bucketIndex(c.clock.Now(), c.width, len(c.counts))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epochs[i] != epoch {
+		c.epochs[i] = epoch
+		c.counts[i] = 0
+	}
+	c.counts[i] += n
+}
+
+// Sum returns the number of events counted within the window.
+func (c *RollingCounter) Sum() int64 {
+	_, epoch := bucketIndex(c.clock.Now(), c.width, len(c.counts))
+	oldest := epoch - int64(len(c.counts)) + 1
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var sum int64
+	for i, e := range c.epochs {
+		if e >= oldest && e <= epoch {
+			sum += c.counts[i]
+		}
+	}
+	return sum
+}
+
+// Rate returns the events per second over the window.
+func (c *RollingCounter) Rate() float64 {
+	return float64(c.Sum()) / c.window.Seconds()
+}
+
+// Window returns the length of the window.
+func (c *RollingCounter) Window() time.Duration {
+	return c.window
+}
+
+// Reset discards all counts.
+func (c *RollingCounter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.counts)
+}
@@ -0,0 +1,52 @@
+package stats
+
+import "sync"
+
+// EWMA is an exponentially weighted moving average. Each update moves the
+// average towards the new value by the smoothing factor alpha, so recent
+// values weigh more than old ones. The first update sets the average
+// directly.
+type EWMA struct {
+	alpha float64
+
+	mu    sync.Mutex
+	value float64
+	set   bool
+}
+
+// NewEWMA creates an average with smoothing factor alpha in (0, 1]. Larger
+// values react faster; 2/(N+1) approximates an N-sample moving average.
+func NewEWMA(alpha float64) *EWMA {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.1
+	}
+	return &EWMA{alpha: alpha}
+}
+
+// Update folds v into the average.
+func (e *EWMA) Update(v float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.set {
+		e.value = v
+		e.set = true
+		return
+	}
+	e.value += e.alpha * (v - e.value)
+}
+
+// Value returns the current average, or 0 before the first update.
+func (e *EWMA) Value() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.value
+}
+
+// Reset clears the average.
+func (e *EWMA) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.value = 0
+	e.set = false
+}
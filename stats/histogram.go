@@ -0,0 +1,237 @@
+package stats
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Histogram estimates quantiles of a stream of non-negative values. Values
+// are counted in logarithmically sized buckets, so every quantile is within
+// the configured relative accuracy of the true value while memory stays
+// bounded regardless of how many values are recorded. Values of zero or less
+// are counted as zero.
+type Histogram struct {
+	mu         sync.Mutex
+	gamma      float64
+	logGamma   float64
+	maxBuckets int
+
+	counts []uint64 // counts[i] is the bucket with index offset+i
+	offset int
+	zeros  uint64
+	count  uint64
+	sum    float64
+	min    float64
+	max    float64
+}
+
+// NewHistogram creates an empty histogram.
+func NewHistogram(opts ...Option) *Histogram {
+	cfg := newConfig(opts)
+	return newHistogram(cfg)
+}
+
+func newHistogram(cfg *config) *Histogram {
+	gamma := (1 + cfg.accuracy) / (1 - cfg.accuracy)
+	return &Histogram{
+		gamma:      gamma,
+		logGamma:   math.Log(gamma),
+		maxBuckets: cfg.maxBuckets,
+	}
+}
+
+// Record adds a value.
+func (h *Histogram) Record(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recordLocked(v)
+}
+
+// RecordDuration adds a duration, in seconds.
+func (h *Histogram) RecordDuration(d time.Duration) {
+	h.Record(d.Seconds())
+}
+
+func (h *Histogram) recordLocked(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+
+	if v <= 0 {
+		h.zeros++
+		return
+	}
+	h.add(int(math.Ceil(math.Log(v)/h.logGamma)), 1)
+}
+
+// add counts n values in bucket idx, growing or collapsing the buckets.
+func (h *Histogram) add(idx int, n uint64) {
+	switch {
+	case len(h.counts) == 0:
+		h.counts = append(h.counts, 0)
+		h.offset = idx
+	case idx < h.offset:
+		grow := h.offset - idx
+		h.counts = append(make([]uint64, grow, grow+len(h.counts)), h.counts...)
+		h.offset = idx
+	case idx >= h.offset+len(h.counts):
+		h.counts = append(h.counts, make([]uint64, idx-h.offset-len(h.counts)+1)...)
+	}
+	h.counts[idx-h.offset] += n
+
+	if excess := len(h.counts) - h.maxBuckets; excess > 0 {
+		// Fold the lowest buckets into the lowest one kept.
+		var folded uint64
+		for _, c := range h.counts[:excess] {
+			folded += c
+		}
+		h.counts = h.counts[excess:]
+		h.counts[0] += folded
+		h.offset += excess
+	}
+}
+
+// Quantile returns an estimate of the q-quantile (0 <= q <= 1) of the
+// recorded values, or 0 if nothing has been recorded.
+func (h *Histogram) Quantile(q float64) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.quantileLocked(q)
+}
+
+// QuantileDuration returns Quantile as a duration, for histograms of
+// durations recorded with RecordDuration.
+func (h *Histogram) QuantileDuration(q float64) time.Duration {
+	return time.Duration(math.Round(h.Quantile(q) * float64(time.Second)))
+}
+
+func (h *Histogram) quantileLocked(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.min
+	}
+	if q >= 1 {
+		return h.max
+	}
+
+	rank := uint64(q * float64(h.count-1))
+	seen := h.zeros
+	if rank < seen {
+		return max(h.min, 0)
+	}
+	for i, c := range h.counts {
+		seen += c
+		if rank < seen {
+			// The midpoint of the bucket in relative terms.
+			v := 2 * math.Pow(h.gamma, float64(h.offset+i)) / (h.gamma + 1)
+			return math.Min(math.Max(v, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Sum returns the sum of the recorded values.
+func (h *Histogram) Sum() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sum
+}
+
+// Mean returns the mean of the recorded values, or 0 if there are none.
+func (h *Histogram) Mean() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / float64(h.count)
+}
+
+// Min returns the smallest recorded value, or 0 if there are none.
+func (h *Histogram) Min() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.min
+}
+
+// Max returns the largest recorded value, or 0 if there are none.
+func (h *Histogram) Max() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+// Merge adds the values recorded in other. Both histograms should use the
+// same relative accuracy.
+func (h *Histogram) Merge(other *Histogram) {
+	if h == other {
+		return
+	}
+
+	other.mu.Lock()
+	counts := append([]uint64(nil), other.counts...)
+	offset, zeros, count := other.offset, other.zeros, other.count
+	sum, minV, maxV := other.sum, other.min, other.max
+	other.mu.Unlock()
+
+	if count == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mergeLocked(counts, offset, zeros, count, sum, minV, maxV)
+}
+
+func (h *Histogram) mergeLocked(counts []uint64, offset int, zeros, count uint64, sum, minV, maxV float64) {
+	if h.count == 0 || minV < h.min {
+		h.min = minV
+	}
+	if h.count == 0 || maxV > h.max {
+		h.max = maxV
+	}
+	h.count += count
+	h.sum += sum
+	h.zeros += zeros
+	for i, c := range counts {
+		if c > 0 {
+			h.add(offset+i, c)
+		}
+	}
+}
+
+// Reset discards all recorded values.
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resetLocked()
+}
+
+func (h *Histogram) resetLocked() {
+	h.counts = h.counts[:0]
+	h.offset = 0
+	h.zeros = 0
+	h.count = 0
+	h.sum = 0
+	h.min = 0
+	h.max = 0
+}
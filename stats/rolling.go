@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+// RollingHistogram estimates quantiles of the values recorded within a
+// sliding time window. Like RollingCounter it keeps one Histogram per bucket
+// and drops whole buckets as they fall out of the window.
+type RollingHistogram struct {
+	clock  clock.Clock
+	cfg    *config
+	window time.Duration
+	width  time.Duration
+
+	mu      sync.Mutex
+	buckets []*Histogram
+	epochs  []int64
+}
+
+// NewRollingHistogram creates a histogram over window split into buckets.
+func NewRollingHistogram(window time.Duration, buckets int, opts ...Option) *RollingHistogram {
+	cfg := newConfig(opts)
+	buckets = max(buckets, 1)
+	width := max(window/time.Duration(buckets), 1)
+
+	h := &RollingHistogram{
+		clock:   cfg.clock,
+		cfg:     cfg,
+		window:  width * time.Duration(buckets),
+		width:   width,
+		buckets: make([]*Histogram, buckets),
+		epochs:  make([]int64, buckets),
+	}
+	for i := range h.buckets {
+		h.buckets[i] = newHistogram(cfg)
+	}
+	return h
+}
+
+// Record adds a value.
+func (h *RollingHistogram) Record(v float64) {
+	i, epoch := bucketIndex(h.clock.Now(), h.width, len(h.buckets))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b := h.buckets[i]
+	if h.epochs[i] != epoch {
+		h.epochs[i] = epoch
+		b.resetLocked()
+	}
+	b.recordLocked(v)
+}
+
+// RecordDuration adds a duration, in seconds.
+func (h *RollingHistogram) RecordDuration(d time.Duration) {
+	h.Record(d.Seconds())
+}
+
+// Snapshot returns a Histogram of the values recorded within the window.
+func (h *RollingHistogram) Snapshot() *Histogram {
+	_, epoch := bucketIndex(h.clock.Now(), h.width, len(h.buckets))
+	oldest := epoch - int64(len(h.buckets)) + 1
+
+	merged := newHistogram(h.cfg)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.buckets {
+		if e := h.epochs[i]; e < oldest || e > epoch || b.count == 0 {
+			continue
+		}
+		merged.mergeLocked(b.counts, b.offset, b.zeros, b.count, b.sum, b.min, b.max)
+	}
+	return merged
+}
+
+// Quantile returns an estimate of the q-quantile of the values recorded
+// within the window.
+func (h *RollingHistogram) Quantile(q float64) float64 {
+	return h.Snapshot().Quantile(q)
+}
+
+// QuantileDuration returns Quantile as a duration.
+func (h *RollingHistogram) QuantileDuration(q float64) time.Duration {
+	return h.Snapshot().QuantileDuration(q)
+}
+
+// Count returns the number of values recorded within the window.
+func (h *RollingHistogram) Count() uint64 {
+	return h.Snapshot().Count()
+}
+
+// Window returns the length of the window.
+func (h *RollingHistogram) Window() time.Duration {
+	return h.window
+}
+
+// Reset discards all recorded values.
+func (h *RollingHistogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, b := range h.buckets {
+		b.resetLocked()
+	}
+}
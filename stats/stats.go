@@ -0,0 +1,94 @@
+// Package stats provides rolling-window counters and streaming quantile
+// estimators shared by Ion components.
+//
+// Resilience primitives keep needing the same few statistics: how many
+// failures happened in the last minute, what the request rate is, what the
+// p99 latency looks like. This package provides them once, safe for
+// concurrent use and driven by an injectable clock:
+//
+//   - RollingCounter counts events over a sliding time window and reports
+//     their sum and rate.
+//   - Histogram estimates quantiles of a stream of values with bounded
+//     relative error in constant memory, in the style of DDSketch.
+//   - RollingHistogram applies a Histogram to a sliding time window.
+//   - SampleWindow keeps the last N samples for exact quantiles.
+//   - EWMA tracks an exponentially weighted moving average.
+//
+// Usage:
+//
+//	failures := stats.NewRollingCounter(time.Minute, 60)
+//	latency := stats.NewRollingHistogram(time.Minute, 6)
+//
+//	failures.Inc()
+//	latency.RecordDuration(elapsed)
+//
+//	if failures.Sum() > 50 || latency.Quantile(0.99) > 0.5 {
+//		// degrade
+//	}
+package stats
+
+import (
+	"time"
+
+	"github.com/kolosys/ion/clock"
+)
+
+// Option configures a statistic.
+type Option func(*config)
+
+type config struct {
+	clock      clock.Clock
+	accuracy   float64
+	maxBuckets int
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		clock:      clock.Real(),
+		accuracy:   0.01,
+		maxBuckets: 2048,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.accuracy <= 0 || cfg.accuracy >= 1 {
+		cfg.accuracy = 0.01
+	}
+	if cfg.maxBuckets < 16 {
+		cfg.maxBuckets = 16
+	}
+
+	return cfg
+}
+
+// WithClock sets the clock that drives window rotation.
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
+// WithRelativeAccuracy sets the relative error bound of histogram quantiles,
+// e.g. 0.01 for 1%. The default is 0.01.
+func WithRelativeAccuracy(a float64) Option {
+	return func(c *config) {
+		c.accuracy = a
+	}
+}
+
+// WithMaxBuckets caps the memory used by a histogram. When the recorded range
+// needs more buckets, the lowest buckets are merged, trading accuracy for the
+// smallest values. The default is 2048.
+func WithMaxBuckets(n int) Option {
+	return func(c *config) {
+		c.maxBuckets = n
+	}
+}
+
+// bucketIndex returns the ring bucket for time t, given the bucket width.
+func bucketIndex(t time.Time, width time.Duration, buckets int) (int, int64) {
+	epoch := t.UnixNano() / int64(width)
+	return int(epoch % int64(buckets)), epoch
+}
@@ -0,0 +1,177 @@
+package stats_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/stats"
+)
+
+// within reports whether got is within the relative error of want.
+func within(got, want time.Duration, relErr float64) bool {
+	return math.Abs(float64(got-want)) <= relErr*float64(want)
+}
+
+func TestRollingCounter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	c := stats.NewRollingCounter(10*time.Second, 10, stats.WithClock(clk))
+
+	c.Add(5)
+	clk.Advance(5 * time.Second)
+	c.Inc()
+	if got := c.Sum(); got != 6 {
+		t.Errorf("expected 6, got %d", got)
+	}
+	if got := c.Rate(); got != 0.6 {
+		t.Errorf("expected rate 0.6/s, got %v", got)
+	}
+
+	clk.Advance(5 * time.Second)
+	if got := c.Sum(); got != 1 {
+		t.Errorf("expected first bucket to expire, got %d", got)
+	}
+
+	clk.Advance(time.Minute)
+	if got := c.Sum(); got != 0 {
+		t.Errorf("expected everything to expire, got %d", got)
+	}
+
+	c.Add(3)
+	c.Reset()
+	if got := c.Sum(); got != 0 {
+		t.Errorf("expected 0 after reset, got %d", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	t.Run("relative accuracy", func(t *testing.T) {
+		h := stats.NewHistogram(stats.WithRelativeAccuracy(0.01))
+		rng := rand.New(rand.NewPCG(1, 2))
+
+		values := make([]float64, 10000)
+		for i := range values {
+			values[i] = rng.ExpFloat64() * 0.1
+			h.Record(values[i])
+		}
+		slices.Sort(values)
+
+		for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+			want := values[int(q*float64(len(values)-1))]
+			got := h.Quantile(q)
+			if math.Abs(got-want)/want > 0.011 {
+				t.Errorf("p%v: expected about %v, got %v", q*100, want, got)
+			}
+		}
+
+		if h.Count() != 10000 {
+			t.Errorf("expected 10000 values, got %d", h.Count())
+		}
+		if h.Min() != values[0] || h.Max() != values[len(values)-1] {
+			t.Errorf("unexpected min/max %v/%v", h.Min(), h.Max())
+		}
+	})
+
+	t.Run("durations and zeros", func(t *testing.T) {
+		h := stats.NewHistogram()
+		h.Record(0)
+		h.RecordDuration(100 * time.Millisecond)
+		h.RecordDuration(100 * time.Millisecond)
+
+		if got := h.Quantile(0.1); got != 0 {
+			t.Errorf("expected zero quantile, got %v", got)
+		}
+		if got := h.QuantileDuration(0.9); !within(got, 100*time.Millisecond, 0.01) {
+			t.Errorf("expected about 100ms, got %v", got)
+		}
+		if mean := h.Mean(); math.Abs(mean-0.2/3) > 1e-9 {
+			t.Errorf("unexpected mean %v", mean)
+		}
+	})
+
+	t.Run("bounded buckets", func(t *testing.T) {
+		h := stats.NewHistogram(stats.WithMaxBuckets(16))
+		for v := 1e-6; v < 1e6; v *= 1.5 {
+			h.Record(v)
+		}
+		if got := h.Quantile(1); got < 1e5 {
+			t.Errorf("expected max to be kept, got %v", got)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		a := stats.NewHistogram()
+		b := stats.NewHistogram()
+		for i := 1; i <= 50; i++ {
+			a.Record(float64(i))
+			b.Record(float64(i + 50))
+		}
+		a.Merge(b)
+
+		if a.Count() != 100 || a.Max() != 100 {
+			t.Errorf("unexpected merged histogram: count %d max %v", a.Count(), a.Max())
+		}
+		if got := a.Quantile(0.5); math.Abs(got-50) > 1 {
+			t.Errorf("expected median about 50, got %v", got)
+		}
+	})
+}
+
+func TestRollingHistogram(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	h := stats.NewRollingHistogram(time.Minute, 6, stats.WithClock(clk))
+
+	for i := 0; i < 100; i++ {
+		h.RecordDuration(time.Second)
+	}
+	clk.Advance(30 * time.Second)
+	for i := 0; i < 100; i++ {
+		h.RecordDuration(10 * time.Millisecond)
+	}
+
+	if got := h.Count(); got != 200 {
+		t.Errorf("expected 200 values, got %d", got)
+	}
+	if got := h.QuantileDuration(0.99); !within(got, time.Second, 0.01) {
+		t.Errorf("expected p99 of about 1s, got %v", got)
+	}
+
+	clk.Advance(40 * time.Second)
+	if got := h.QuantileDuration(0.99); !within(got, 10*time.Millisecond, 0.01) {
+		t.Errorf("expected slow values to expire, got p99 %v", got)
+	}
+}
+
+func TestSampleWindow(t *testing.T) {
+	w := stats.NewSampleWindow(4)
+	for _, v := range []float64{100, 1, 2, 3, 4} {
+		w.Record(v)
+	}
+
+	if w.Len() != 4 {
+		t.Errorf("expected 4 samples, got %d", w.Len())
+	}
+	if got := w.Quantile(1); got != 4 {
+		t.Errorf("expected oldest sample to be evicted, got max %v", got)
+	}
+	if got := w.Quantile(0.5); got != 2 {
+		t.Errorf("expected median 2, got %v", got)
+	}
+
+	w.Reset()
+	if w.Quantile(0.5) != 0 {
+		t.Error("expected empty window after reset")
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	e := stats.NewEWMA(0.5)
+	e.Update(10)
+	e.Update(20)
+	if got := e.Value(); got != 15 {
+		t.Errorf("expected 15, got %v", got)
+	}
+}
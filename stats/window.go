@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SampleWindow keeps the most recent samples in a ring buffer and answers
+// exact quantile queries over them. It suits small windows where exact
+// answers matter more than memory; use Histogram for unbounded streams.
+type SampleWindow struct {
+	mu      sync.Mutex
+	samples []float64
+	next    int
+	full    bool
+
+	// sorted is rebuilt lazily, once enough new samples have arrived.
+	sorted []float64
+	stale  int
+}
+
+// NewSampleWindow creates a window holding the last size samples.
+func NewSampleWindow(size int) *SampleWindow {
+	return &SampleWindow{
+		samples: make([]float64, max(size, 1)),
+		stale:   -1,
+	}
+}
+
+// Record adds a sample, evicting the oldest once the window is full.
+func (w *SampleWindow) Record(v float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples[w.next] = v
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+	if w.stale >= 0 {
+		w.stale++
+	}
+}
+
+// RecordDuration adds a duration sample, in seconds.
+func (w *SampleWindow) RecordDuration(d time.Duration) {
+	w.Record(d.Seconds())
+}
+
+// Len returns the number of samples held.
+func (w *SampleWindow) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lenLocked()
+}
+
+func (w *SampleWindow) lenLocked() int {
+	if w.full {
+		return len(w.samples)
+	}
+	return w.next
+}
+
+// Quantile returns the q-quantile (0 <= q <= 1) of the samples using the
+// nearest-rank method, or 0 if there are none. To amortize sorting, the
+// answer may lag behind the last few samples, up to 5% of the window.
+func (w *SampleWindow) Quantile(q float64) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := w.lenLocked()
+	if n == 0 {
+		return 0
+	}
+
+	if w.stale < 0 || w.stale > max(1, n/20) {
+		w.sorted = append(w.sorted[:0], w.samples[:n]...)
+		slices.Sort(w.sorted)
+		w.stale = 0
+	}
+
+	i := int(q*float64(len(w.sorted))+0.5) - 1
+	i = min(max(i, 0), len(w.sorted)-1)
+	return w.sorted[i]
+}
+
+// QuantileDuration returns Quantile as a duration, for windows of durations
+// recorded with RecordDuration.
+func (w *SampleWindow) QuantileDuration(q float64) time.Duration {
+	return time.Duration(math.Round(w.Quantile(q) * float64(time.Second)))
+}
+
+// Reset discards all samples.
+func (w *SampleWindow) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.next = 0
+	w.full = false
+	w.stale = -1
+}
@@ -0,0 +1,209 @@
+package workerpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// AutoscalePolicy decides when an autoscaling pool adds or removes workers,
+// see WithAutoscale. Zero values select the defaults.
+type AutoscalePolicy struct {
+	// Interval is how often the pool is evaluated. Default: 1 second
+	Interval time.Duration
+
+	// QueuePerWorker is the number of queued tasks per worker above which
+	// workers are added. Default: 1
+	QueuePerWorker float64
+
+	// MaxWait is the mean time tasks started in the last interval waited to
+	// start, from submission, above which workers are added. It catches
+	// pressure on pools with a short queue. Default: 0, disabled
+	MaxWait time.Duration
+
+	// IdleTime is how long workers must have been idle, with nothing
+	// queued, before they are removed. Default: 30 seconds
+	IdleTime time.Duration
+
+	// Step is the number of workers added or removed at once. Default: 1
+	Step int
+}
+
+// WithAutoscale lets the pool adjust its number of workers between min and
+// max. Workers are added while the queue is deeper than
+// policy.QueuePerWorker per worker or tasks wait longer than
+// policy.MaxWait to start, and removed once some have been idle with
+// nothing queued for policy.IdleTime. Scaling up on pressure but down only
+// after sustained idleness keeps the pool from flapping.
+//
+// The size given to New is the initial number of workers, clamped to
+// [min, max]. A min below 1 is raised to 1 and a max below min is raised to
+// min. Scale events are logged and counted in
+// ion_workerpool_scale_events_total, and the number of workers is reported
+// in ion_workerpool_workers.
+func WithAutoscale(min, max int, policy AutoscalePolicy) Option {
+	return func(c *config) {
+		c.autoscale = &autoscaleConfig{min: min, max: max, policy: policy}
+	}
+}
+
+type autoscaleConfig struct {
+	min, max int
+	policy   AutoscalePolicy
+}
+
+// normalize applies the defaults and bounds of WithAutoscale.
+func (c *autoscaleConfig) normalize() {
+	c.min = max(c.min, 1)
+	c.max = max(c.max, c.min)
+
+	if c.policy.Interval <= 0 {
+		c.policy.Interval = time.Second
+	}
+	if c.policy.QueuePerWorker <= 0 {
+		c.policy.QueuePerWorker = 1
+	}
+	if c.policy.IdleTime <= 0 {
+		c.policy.IdleTime = 30 * time.Second
+	}
+	if c.policy.Step <= 0 {
+		c.policy.Step = 1
+	}
+}
+
+// autoscaler adjusts the number of workers of a pool.
+type autoscaler struct {
+	pool     *Pool
+	min, max int
+	policy   AutoscalePolicy
+
+	// retire holds one token per worker asked to exit. Idle workers take
+	// tokens as they wait for tasks.
+	retire chan struct{}
+
+	// Time tasks waited to start since the last evaluation
+	waitSum   atomic.Int64 // nanoseconds
+	waitCount atomic.Int64
+
+	idleSince time.Time // when spare workers were first seen, zero if none
+}
+
+func newAutoscaler(p *Pool, cfg autoscaleConfig) *autoscaler {
+	return &autoscaler{
+		pool:   p,
+		min:    cfg.min,
+		max:    cfg.max,
+		policy: cfg.policy,
+		retire: make(chan struct{}, cfg.max),
+	}
+}
+
+// observeWait records the time a task waited to start.
+func (a *autoscaler) observeWait(d time.Duration) {
+	a.waitSum.Add(int64(d))
+	a.waitCount.Add(1)
+}
+
+// run evaluates the pool every interval until it is closed. It is counted
+// in the pool's worker group, so workers can be added while it runs.
+func (a *autoscaler) run() {
+	defer a.pool.workerWg.Done()
+
+	timer := a.pool.clock.NewTimer(a.policy.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-a.pool.baseCtx.Done():
+			return
+		case <-timer.C():
+			a.evaluate()
+			timer.Reset(a.policy.Interval)
+		}
+	}
+}
+
+// evaluate scales the pool once if the policy calls for it.
+func (a *autoscaler) evaluate() {
+	p := a.pool
+	now := p.clock.Now()
+	workers := int(p.workers.Load())
+	queued := int64(p.queueLen())
+	running := atomic.LoadInt64(&p.metrics.Running)
+
+	var wait time.Duration
+	if n := a.waitCount.Swap(0); n > 0 {
+		wait = time.Duration(a.waitSum.Swap(0) / n)
+	} else {
+		a.waitSum.Store(0)
+	}
+
+	reason := ""
+	switch {
+	case float64(queued) > a.policy.QueuePerWorker*float64(workers):
+		reason = "queue"
+	case a.policy.MaxWait > 0 && wait > a.policy.MaxWait:
+		reason = "latency"
+	}
+	if reason != "" {
+		a.idleSince = time.Time{}
+		if workers < a.max {
+			a.scale(workers, min(workers+a.policy.Step, a.max), reason)
+		}
+		return
+	}
+
+	idle := workers - int(running)
+	if queued > 0 || idle <= 0 {
+		a.idleSince = time.Time{}
+		return
+	}
+	if a.idleSince.IsZero() {
+		a.idleSince = now
+		return
+	}
+	if now.Sub(a.idleSince) >= a.policy.IdleTime && workers > a.min {
+		// Workers still idle after the next IdleTime are removed in turn
+		a.idleSince = now
+		a.scale(workers, max(workers-min(a.policy.Step, idle), a.min), "idle")
+	}
+}
+
+// scale changes the number of workers from one count to another.
+func (a *autoscaler) scale(from, to int, reason string) {
+	p := a.pool
+	p.workers.Store(int64(to))
+	p.metricsChanged()
+
+	if to > from {
+		add := to - from
+		// Withdraw retirements not yet taken before starting workers
+	withdraw:
+		for add > 0 {
+			select {
+			case <-a.retire:
+				add--
+			default:
+				break withdraw
+			}
+		}
+		p.startWorkers(add)
+	} else {
+		for i := to; i < from; i++ {
+			a.retire <- struct{}{}
+		}
+	}
+
+	direction := "up"
+	if to < from {
+		direction = "down"
+	}
+	p.obs.Metrics.Inc("ion_workerpool_scale_events_total",
+		"pool_name", p.name, "direction", direction, "reason", reason)
+	p.obs.Metrics.Gauge("ion_workerpool_workers", float64(to), "pool_name", p.name)
+	p.obs.Logger.Info("workerpool scaled",
+		"pool", p.name,
+		"from", from,
+		"to", to,
+		"reason", reason,
+	)
+}
@@ -0,0 +1,77 @@
+package workerpool_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/kolosys/ion/workerpool"
+)
+
+func benchmarkSubmit(b *testing.B, opts ...workerpool.Option) {
+	pool := workerpool.New(8, 1024, opts...)
+	defer pool.Close(context.Background())
+
+	var wg sync.WaitGroup
+	task := func(ctx context.Context) error {
+		wg.Done()
+		return nil
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			wg.Add(1)
+			pool.Submit(context.Background(), task)
+		}
+	})
+	wg.Wait()
+}
+
+func BenchmarkSubmit(b *testing.B) {
+	benchmarkSubmit(b)
+}
+
+func BenchmarkSubmit_WorkStealing(b *testing.B) {
+	benchmarkSubmit(b, workerpool.WithWorkStealing())
+}
+
+// BenchmarkExecute measures the cost of running tasks, and reports the
+// goroutines the pool adds for each running task besides its workers.
+func BenchmarkExecute(b *testing.B) {
+	const workers = 8
+	pool := workerpool.New(workers, 1024)
+	defer pool.Close(context.Background())
+
+	idle := runtime.NumGoroutine()
+	var started sync.WaitGroup
+	started.Add(workers)
+	release := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			started.Done()
+			<-release
+			return nil
+		})
+	}
+	started.Wait()
+	busy := runtime.NumGoroutine()
+	close(release)
+
+	var wg sync.WaitGroup
+	task := func(ctx context.Context) error {
+		wg.Done()
+		return nil
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(1)
+		pool.Submit(context.Background(), task)
+	}
+	wg.Wait()
+
+	b.ReportMetric(float64(busy-idle)/workers, "goroutines/task")
+}
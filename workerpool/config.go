@@ -0,0 +1,133 @@
+package workerpool
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config declares a worker pool, as an alternative to functional options
+// for pools loaded from configuration files. Zero values select the same
+// defaults as New and the corresponding options.
+type Config struct {
+	// Name identifies the pool in logs, metrics and errors
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Size is the number of worker goroutines. Default: GOMAXPROCS
+	Size int `json:"size,omitempty" yaml:"size,omitempty"`
+
+	// QueueSize is the maximum number of queued tasks. Default: 0, tasks
+	// are handed to workers directly
+	QueueSize int `json:"queue_size,omitempty" yaml:"queue_size,omitempty"`
+
+	// DrainTimeout is the default timeout for Drain and Close.
+	// Default: 30 seconds
+	DrainTimeout time.Duration `json:"drain_timeout,omitempty" yaml:"drain_timeout,omitempty"`
+
+	// TaskTimeout limits how long each task may run, see WithTaskTimeout.
+	// Default: 0, no timeout
+	TaskTimeout time.Duration `json:"task_timeout,omitempty" yaml:"task_timeout,omitempty"`
+
+	// EDF enables earliest-deadline-first scheduling, see WithEDF.
+	// Default: false
+	EDF bool `json:"edf,omitempty" yaml:"edf,omitempty"`
+
+	// Priority enables priority scheduling with PriorityAging, see
+	// WithPriority. Default: false
+	Priority      bool          `json:"priority,omitempty" yaml:"priority,omitempty"`
+	PriorityAging time.Duration `json:"priority_aging,omitempty" yaml:"priority_aging,omitempty"`
+
+	// Overflow is what submissions do when the queue is full: "default",
+	// "reject", "block", "drop_oldest" or "caller_runs", see
+	// WithOverflowPolicy. Default: "default"
+	Overflow OverflowPolicy `json:"overflow,omitempty" yaml:"overflow,omitempty"`
+}
+
+// Validate checks if the configuration is valid and returns an error if not.
+func (c *Config) Validate() error {
+	if c.Size < 0 {
+		return fmt.Errorf("size cannot be negative, got %d", c.Size)
+	}
+
+	if c.QueueSize < 0 {
+		return fmt.Errorf("queue size cannot be negative, got %d", c.QueueSize)
+	}
+
+	if c.DrainTimeout < 0 {
+		return fmt.Errorf("drain timeout cannot be negative, got %v", c.DrainTimeout)
+	}
+
+	if c.TaskTimeout < 0 {
+		return fmt.Errorf("task timeout cannot be negative, got %v", c.TaskTimeout)
+	}
+
+	if c.PriorityAging < 0 {
+		return fmt.Errorf("priority aging cannot be negative, got %v", c.PriorityAging)
+	}
+
+	switch c.Overflow {
+	case OverflowDefault, OverflowReject, OverflowBlock, OverflowDropOldest, OverflowCallerRuns:
+	default:
+		return fmt.Errorf("unknown overflow policy %v", c.Overflow)
+	}
+
+	return nil
+}
+
+// options returns the options equivalent to the configuration.
+func (c *Config) options() []Option {
+	opts := []Option{WithName(c.Name)}
+	if c.DrainTimeout > 0 {
+		opts = append(opts, WithDrainTimeout(c.DrainTimeout))
+	}
+	if c.TaskTimeout > 0 {
+		opts = append(opts, WithTaskTimeout(c.TaskTimeout))
+	}
+	if c.EDF {
+		opts = append(opts, WithEDF())
+	}
+	if c.Priority {
+		opts = append(opts, WithPriority(c.PriorityAging))
+	}
+	if c.Overflow != OverflowDefault {
+		opts = append(opts, WithOverflowPolicy(c.Overflow))
+	}
+	return opts
+}
+
+// NewFromConfig creates a worker pool from cfg. Options are applied after
+// the configuration, so they can supply what a configuration file cannot,
+// such as a base context, middleware or observability hooks, or override
+// configured values.
+func NewFromConfig(cfg Config, opts ...Option) (*Pool, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, &PoolError{Op: "config", PoolName: cfg.Name, Err: err}
+	}
+	return New(cfg.Size, cfg.QueueSize, append(cfg.options(), opts...)...), nil
+}
+
+// overflowPolicies lists the overflow policies a configuration may name.
+var overflowPolicies = []OverflowPolicy{
+	OverflowDefault, OverflowReject, OverflowBlock, OverflowDropOldest, OverflowCallerRuns,
+}
+
+// MarshalText encodes the overflow policy as its name.
+func (o OverflowPolicy) MarshalText() ([]byte, error) {
+	for _, policy := range overflowPolicies {
+		if o == policy {
+			return []byte(o.String()), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown overflow policy %v", o)
+}
+
+// UnmarshalText decodes an overflow policy from its name, ignoring case.
+func (o *OverflowPolicy) UnmarshalText(text []byte) error {
+	for _, policy := range overflowPolicies {
+		if strings.EqualFold(string(text), policy.String()) {
+			*o = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown overflow policy %q", text)
+}
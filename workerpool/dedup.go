@@ -0,0 +1,66 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+)
+
+// SubmitDedup submits task unless a task submitted with the same key is
+// still queued or running, in which case it returns the future of that
+// task instead. Concurrent identical submissions, such as refreshes of the
+// same cache entry, thus run once and share the result. The key is released
+// as soon as the future resolves, so later submissions run again.
+//
+// Since every submitter shares it, the task runs with the values of the
+// first submission's context but not its cancellation or deadline: each
+// submitter waits with its own context through Future.Wait, and
+// Future.Cancel cancels the task for all of them. The first submission
+// blocks while the queue is full, like SubmitFunc, and if it fails the
+// future resolves with the error for every submitter. The key becomes the
+// TaskInfo name unless ctx carries a TaskInfo. The task is not retried
+// under WithRetry, and coalesced submissions are counted in
+// ion_workerpool_tasks_deduplicated_total.
+//
+// Usage:
+//
+//	f := pool.SubmitDedup(ctx, "refresh:user:"+id, func(ctx context.Context) error {
+//		return cache.Refresh(ctx, id)
+//	})
+//	if _, err := f.Wait(ctx); err != nil {
+//		return err
+//	}
+func (p *Pool) SubmitDedup(ctx context.Context, key string, task Task) *Future[struct{}] {
+	if task == nil {
+		f := newFuture[struct{}](func() {})
+		f.resolve(struct{}{}, errors.New("ion: nil task"))
+		return f
+	}
+
+	p.dedupMu.Lock()
+	if f, ok := p.dedup[key]; ok {
+		p.dedupMu.Unlock()
+		p.obs.WithContext(ctx).Metrics.Inc("ion_workerpool_tasks_deduplicated_total", "pool_name", p.name)
+		return f
+	}
+
+	if _, ok := TaskInfoFromContext(ctx); !ok {
+		ctx = ContextWithTaskInfo(ctx, TaskInfo{Name: key})
+	}
+	taskCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f := newFuture[struct{}](cancel)
+	f.onDone = func() {
+		p.dedupMu.Lock()
+		delete(p.dedup, key)
+		p.dedupMu.Unlock()
+	}
+	if p.dedup == nil {
+		p.dedup = make(map[string]*Future[struct{}])
+	}
+	p.dedup[key] = f
+	p.dedupMu.Unlock()
+
+	submitFuture(p, ctx, taskCtx, f, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, task(ctx)
+	})
+	return f
+}
@@ -0,0 +1,245 @@
+package workerpool
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Job is a serialized unit of work run by a Durable pool. Unlike a Task it
+// holds no closure, so it can be persisted and replayed by another process.
+type Job struct {
+	ID         string            // unique identifier assigned on Enqueue
+	Kind       string            // selects the registered handler
+	Payload    []byte            // handler input, encoded by the caller
+	Metadata   map[string]string // free-form attributes, e.g. a tenant or trace ID
+	EnqueuedAt time.Time         // when the job was first enqueued
+	Attempts   int               // number of times the job was started, including replays
+}
+
+// JobHandler runs jobs of one kind.
+type JobHandler func(ctx context.Context, job Job) error
+
+// TaskStore persists the jobs of a Durable pool until they complete.
+// Implementations backed by BoltDB, SQLite or Redis turn the pool into a
+// lightweight durable job runner. All methods must be safe for concurrent use.
+type TaskStore interface {
+	// Save stores job, replacing any job with the same ID.
+	Save(ctx context.Context, job Job) error
+
+	// Delete removes the job with the given ID. Deleting a missing job is not
+	// an error.
+	Delete(ctx context.Context, id string) error
+
+	// Pending returns every stored job, in the order they were enqueued.
+	Pending(ctx context.Context) ([]Job, error)
+}
+
+// Durable runs jobs on a pool and keeps them in a TaskStore from the time
+// they are enqueued until their handler returns. Jobs still in the store
+// after a crash, or after the pool was closed with jobs queued, are run
+// again by Recover.
+//
+// Delivery is at least once: a job whose handler was interrupted by a crash
+// runs again, so handlers should be idempotent.
+//
+// Usage:
+//
+//	jobs := workerpool.NewDurable(pool, store)
+//	jobs.Handle("email", sendEmail)
+//	if _, err := jobs.Recover(ctx); err != nil {
+//		return err
+//	}
+//	id, err := jobs.Enqueue(ctx, "email", payload, nil)
+type Durable struct {
+	pool  *Pool
+	store TaskStore
+
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+// NewDurable creates a durable job runner that executes on pool and
+// persists jobs in store.
+func NewDurable(pool *Pool, store TaskStore) *Durable {
+	return &Durable{
+		pool:     pool,
+		store:    store,
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+// Handle registers the handler for jobs of the given kind, replacing any
+// previous one. Handlers must be registered before Recover or Enqueue are
+// called for their kind.
+func (d *Durable) Handle(kind string, h JobHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[kind] = h
+}
+
+// Enqueue persists a new job and submits it to the pool, blocking like
+// Submit while the queue is full. It returns the job ID. The job is removed
+// from the store again if it cannot be submitted. The job runs detached from
+// ctx: canceling ctx after Enqueue returns does not cancel the job.
+func (d *Durable) Enqueue(ctx context.Context, kind string, payload []byte, metadata map[string]string) (string, error) {
+	if _, ok := d.handler(kind); !ok {
+		return "", NewUnknownJobKindError(d.pool.name, "enqueue", kind)
+	}
+
+	job := Job{
+		ID:         newJobID(),
+		Kind:       kind,
+		Payload:    payload,
+		Metadata:   metadata,
+		EnqueuedAt: d.pool.clock.Now(),
+	}
+	if err := d.store.Save(ctx, job); err != nil {
+		return "", NewStoreError(d.pool.name, "enqueue", err)
+	}
+
+	if err := d.submit(ctx, job); err != nil {
+		_ = d.store.Delete(context.WithoutCancel(ctx), job.ID)
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// Recover submits every job left in the store and returns how many were
+// submitted. Call it once at startup, before Enqueue, as it cannot tell jobs
+// left over from a previous run from jobs already queued by this one. Jobs of a kind without a handler are left
+// in the store and reported in the returned error along with any submission
+// failure.
+func (d *Durable) Recover(ctx context.Context) (int, error) {
+	jobs, err := d.store.Pending(ctx)
+	if err != nil {
+		return 0, NewStoreError(d.pool.name, "recover", err)
+	}
+
+	var errs []error
+	recovered := 0
+	for _, job := range jobs {
+		if _, ok := d.handler(job.Kind); !ok {
+			errs = append(errs, NewUnknownJobKindError(d.pool.name, "recover", job.Kind))
+			continue
+		}
+		if err := d.submit(ctx, job); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		recovered++
+	}
+
+	obs := d.pool.obs.WithContext(ctx)
+	obs.Logger.Info("durable jobs recovered",
+		"pool", d.pool.name,
+		"recovered", recovered,
+		"pending", len(jobs),
+	)
+	obs.Metrics.Add("ion_workerpool_jobs_recovered_total",
+		float64(recovered), "pool_name", d.pool.name)
+
+	return recovered, errors.Join(errs...)
+}
+
+// submit queues job on the pool. The job is deleted from the store once its
+// handler returns, even if it fails or panics; a job that never starts
+// because the pool closes stays in the store for Recover.
+func (d *Durable) submit(ctx context.Context, job Job) error {
+	return d.pool.submit(ctx, taskSubmission{
+		task: func(ctx context.Context) error {
+			h, _ := d.handler(job.Kind)
+
+			job.Attempts++
+			if err := d.store.Save(ctx, job); err != nil {
+				return NewStoreError(d.pool.name, "start", err)
+			}
+			defer func() {
+				if err := d.store.Delete(context.WithoutCancel(ctx), job.ID); err != nil {
+					d.pool.obs.WithContext(ctx).Logger.Warn("failed to delete completed job",
+						"pool", d.pool.name, "job_id", job.ID, "error", err)
+				}
+			}()
+
+			return h(ctx, job)
+		},
+		ctx: context.WithoutCancel(ctx),
+	})
+}
+
+// handler returns the handler registered for kind.
+func (d *Durable) handler(kind string) (JobHandler, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	h, ok := d.handlers[kind]
+	return h, ok
+}
+
+// newJobID returns a random 128-bit job ID.
+func newJobID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// MemoryStore is a TaskStore that keeps jobs in memory. It does not survive
+// a crash; it is meant for tests and as a reference implementation.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+	seq  map[string]uint64 // enqueue order
+	next uint64
+}
+
+// NewMemoryStore creates an empty in-memory task store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs: make(map[string]Job),
+		seq:  make(map[string]uint64),
+	}
+}
+
+// Save implements TaskStore.Save
+func (s *MemoryStore) Save(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.seq[job.ID]; !ok {
+		s.seq[job.ID] = s.next
+		s.next++
+	}
+	job.Metadata = maps.Clone(job.Metadata)
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// Delete implements TaskStore.Delete
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, id)
+	delete(s.seq, id)
+	return nil
+}
+
+// Pending implements TaskStore.Pending
+func (s *MemoryStore) Pending(ctx context.Context) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	slices.SortFunc(jobs, func(a, b Job) int {
+		return cmp.Compare(s.seq[a.ID], s.seq[b.ID])
+	})
+	return jobs, nil
+}
@@ -1,10 +1,49 @@
 package workerpool
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 )
 
+// ErrDeadlineMissed indicates a task whose deadline passed before it could
+// start. It wraps context.DeadlineExceeded
+var ErrDeadlineMissed = fmt.Errorf("task deadline missed: %w", context.DeadlineExceeded)
+
+// ErrPoolClosed indicates a pool that is closed, or draining for a
+// submission
+var ErrPoolClosed = errors.New("pool is closed")
+
+// ErrQuotaExceeded indicates a submission rejected because its submitter
+// already holds as many tasks as its quota allows, see WithQuota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrQueueFull indicates a submission rejected because the queue was full,
+// at once or after the wait allowed by TrySubmitTimeout
+var ErrQueueFull = errors.New("queue is full")
+
+// ErrTaskDropped indicates a queued task dropped to make room for a newer
+// one under OverflowDropOldest
+var ErrTaskDropped = errors.New("task dropped")
+
+// ErrTaskTimeout is the cause of the cancellation of a task context when the
+// task runs longer than its timeout, see context.Cause. It wraps
+// context.DeadlineExceeded
+var ErrTaskTimeout = fmt.Errorf("task timed out: %w", context.DeadlineExceeded)
+
+// ErrTasksAbandoned indicates queued tasks that never ran because the pool
+// was closed
+var ErrTasksAbandoned = errors.New("tasks abandoned")
+
+// ErrTaskPanicked indicates a task that panicked. It is matched by every
+// *PanicError
+var ErrTaskPanicked = errors.New("task panicked")
+
+// ErrUnknownJobKind indicates a durable job whose kind has no registered
+// handler
+var ErrUnknownJobKind = errors.New("unknown job kind")
+
 // PoolError represents workerpool-specific errors with context
 type PoolError struct {
 	Op       string // operation that failed
@@ -23,12 +62,39 @@ func (e *PoolError) Unwrap() error {
 	return e.Err
 }
 
+// PanicError is the error of a task that panicked. It matches
+// ErrTaskPanicked, and unwraps to the panic value if it is an error.
+type PanicError struct {
+	Value any    // value passed to panic
+	Stack []byte // stack of the task at the panic, see WithPanicErrors
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrTaskPanicked, e.Value)
+}
+
+// Is reports whether target is ErrTaskPanicked.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrTaskPanicked
+}
+
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
 // NewPoolClosedError creates an error indicating the pool is closed
 func NewPoolClosedError(poolName string) error {
+	return NewClosedError(poolName, "submit")
+}
+
+// NewClosedError creates an error indicating an operation on a pool that
+// is closed
+func NewClosedError(poolName, op string) error {
 	return &PoolError{
-		Op:       "submit",
+		Op:       op,
 		PoolName: poolName,
-		Err:      errors.New("pool is closed"),
+		Err:      ErrPoolClosed,
 	}
 }
 
@@ -37,6 +103,94 @@ func NewQueueFullError(poolName string, queueSize int) error {
 	return &PoolError{
 		Op:       "submit",
 		PoolName: poolName,
-		Err:      fmt.Errorf("queue is full (size: %d)", queueSize),
+		Err:      fmt.Errorf("%w (size: %d)", ErrQueueFull, queueSize),
+	}
+}
+
+// NewQuotaExceededError creates an error indicating a submitter holds its
+// whole quota of limit tasks
+func NewQuotaExceededError(poolName, key string, limit int) error {
+	return &PoolError{
+		Op:       "submit",
+		PoolName: poolName,
+		Err:      fmt.Errorf("%w for %q (limit: %d)", ErrQuotaExceeded, key, limit),
+	}
+}
+
+// NewSubmitTimeoutError creates an error indicating the queue stayed full
+// for the whole wait allowed to a submission
+func NewSubmitTimeoutError(poolName string, queueSize int, timeout time.Duration) error {
+	return &PoolError{
+		Op:       "submit",
+		PoolName: poolName,
+		Err:      fmt.Errorf("%w (size: %d) after waiting %v", ErrQueueFull, queueSize, timeout),
+	}
+}
+
+// NewTaskDroppedError creates an error for a queued task dropped to make
+// room for a newer one
+func NewTaskDroppedError(poolName string) error {
+	return &PoolError{
+		Op:       "execute",
+		PoolName: poolName,
+		Err:      fmt.Errorf("%w: queue full", ErrTaskDropped),
+	}
+}
+
+// NewResultsClosedError creates an error indicating a results stream is closed
+func NewResultsClosedError(poolName string) error {
+	return &PoolError{
+		Op:       "submit",
+		PoolName: poolName,
+		Err:      errors.New("results stream is closed"),
+	}
+}
+
+// NewShutdownTimeoutError creates an error indicating a close or drain
+// operation gave up waiting when its context was done
+func NewShutdownTimeoutError(poolName, op string, err error) error {
+	return &PoolError{
+		Op:       op,
+		PoolName: poolName,
+		Err:      fmt.Errorf("timed out waiting for tasks: %w", err),
+	}
+}
+
+// NewTasksAbandonedError creates an error indicating that n queued tasks
+// were discarded by close
+func NewTasksAbandonedError(poolName string, n int64) error {
+	return &PoolError{
+		Op:       "close",
+		PoolName: poolName,
+		Err:      fmt.Errorf("%w: %d queued tasks never ran", ErrTasksAbandoned, n),
+	}
+}
+
+// NewUnknownJobKindError creates an error for a durable job whose kind has
+// no registered handler
+func NewUnknownJobKindError(poolName, op, kind string) error {
+	return &PoolError{
+		Op:       op,
+		PoolName: poolName,
+		Err:      fmt.Errorf("%w %q", ErrUnknownJobKind, kind),
+	}
+}
+
+// NewStoreError creates an error for a task store operation that failed
+func NewStoreError(poolName, op string, err error) error {
+	return &PoolError{
+		Op:       op,
+		PoolName: poolName,
+		Err:      fmt.Errorf("task store: %w", err),
+	}
+}
+
+// NewDeadlineMissedError creates an error for a task that was late by the
+// given duration when it was submitted or reached a worker
+func NewDeadlineMissedError(poolName, op string, late time.Duration) error {
+	return &PoolError{
+		Op:       op,
+		PoolName: poolName,
+		Err:      fmt.Errorf("%w (late by %v)", ErrDeadlineMissed, late),
 	}
 }
@@ -0,0 +1,191 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Future is the pending result of a function submitted with SubmitFunc.
+//
+// Usage:
+//
+//	user := workerpool.SubmitFunc(pool, ctx, func(ctx context.Context) (*User, error) {
+//		return loadUser(ctx, id)
+//	})
+//	orders := workerpool.SubmitFunc(pool, ctx, func(ctx context.Context) ([]Order, error) {
+//		return loadOrders(ctx, id)
+//	})
+//	u, err := user.Wait(ctx)
+//	...
+//	o, err := orders.Wait(ctx)
+type Future[T any] struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	onDone func() // called once resolved, before done is closed
+
+	mu       sync.Mutex
+	started  bool
+	resolved bool
+	value    T
+	err      error
+	unwatch  func() bool // stops watching the pool, nil once resolved
+}
+
+// SubmitFunc submits fn to pool and returns a future for its result. It
+// blocks while the pool queue is full, like Submit. If the submission
+// fails, the future is already resolved with the error.
+//
+// The context passed to fn is canceled when ctx is done or the future is
+// canceled. If the pool is closed before fn runs, the future resolves with a
+// pool closed error, and if fn misses its deadline in EDF mode, with an
+// error wrapping ErrDeadlineMissed. If fn panics, the future resolves with
+// a *PanicError and the panic is then handled by the pool as usual.
+func SubmitFunc[T any](pool *Pool, ctx context.Context, fn func(context.Context) (T, error)) *Future[T] {
+	taskCtx, cancel := context.WithCancel(ctx)
+	f := newFuture[T](cancel)
+	submitFuture(pool, ctx, taskCtx, f, fn)
+	return f
+}
+
+func newFuture[T any](cancel context.CancelFunc) *Future[T] {
+	return &Future[T]{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+}
+
+// submitFuture submits fn to pool, running it with taskCtx, to resolve f.
+// It blocks while the pool queue is full and ctx is not done.
+func submitFuture[T any](pool *Pool, ctx, taskCtx context.Context, f *Future[T], fn func(context.Context) (T, error)) {
+	err := pool.submit(ctx, taskSubmission{
+		task: func(ctx context.Context) error {
+			return f.run(ctx, pool, fn)
+		},
+		ctx:      taskCtx,
+		deadline: pool.deadlineOf(taskCtx),
+		onMiss: func(err error) {
+			f.resolve(*new(T), err)
+		},
+		noRetry: true,
+	})
+	if err != nil {
+		f.resolve(*new(T), err)
+		return
+	}
+
+	f.watch(pool)
+}
+
+// Done returns a channel that is closed once the result is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the result is available or ctx is done, and returns
+// the value and error of the function, or the context error. The result
+// stays available after ctx is done.
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return *new(T), ctx.Err()
+	}
+}
+
+// Cancel cancels the context passed to the function. If the function has
+// not started, it will not run and the future resolves with
+// context.Canceled at once; otherwise the future resolves with whatever the
+// function returns. Cancel has no effect on a resolved future.
+func (f *Future[T]) Cancel() {
+	f.cancel()
+
+	f.mu.Lock()
+	if f.started || !f.settleLocked(*new(T), context.Canceled) {
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+	f.finish()
+}
+
+// run executes fn on pool unless the future was canceled first, and records
+// its result.
+func (f *Future[T]) run(ctx context.Context, pool *Pool, fn func(context.Context) (T, error)) error {
+	f.mu.Lock()
+	if f.resolved {
+		f.mu.Unlock()
+		return context.Canceled
+	}
+	f.started = true
+	f.mu.Unlock()
+
+	defer func() {
+		if p := recover(); p != nil {
+			f.resolve(*new(T), pool.panicError(p))
+			panic(p)
+		}
+	}()
+
+	v, err := fn(ctx)
+	f.resolve(v, err)
+	return err
+}
+
+// resolve records the result once and wakes waiters. Later calls are
+// ignored.
+func (f *Future[T]) resolve(v T, err error) {
+	f.mu.Lock()
+	settled := f.settleLocked(v, err)
+	f.mu.Unlock()
+
+	if settled {
+		f.finish()
+		f.cancel()
+	}
+}
+
+// finish wakes waiters once the result is recorded.
+func (f *Future[T]) finish() {
+	f.mu.Lock()
+	unwatch := f.unwatch
+	f.unwatch = nil
+	f.mu.Unlock()
+	if unwatch != nil {
+		unwatch()
+	}
+
+	if f.onDone != nil {
+		f.onDone()
+	}
+	close(f.done)
+}
+
+// settleLocked records the result unless one was recorded already, and
+// reports whether it did.
+func (f *Future[T]) settleLocked(v T, err error) bool {
+	if f.resolved {
+		return false
+	}
+	f.resolved = true
+	f.value, f.err = v, err
+	return true
+}
+
+// watch resolves the future with a pool closed error if every worker exits
+// before the function runs, which drops it from the queue. The watch is
+// stopped once the future resolves, so it holds no goroutine meanwhile.
+func (f *Future[T]) watch(pool *Pool) {
+	unwatch := context.AfterFunc(pool.stopCtx, func() {
+		f.resolve(*new(T), NewPoolClosedError(pool.name))
+	})
+
+	f.mu.Lock()
+	if f.resolved {
+		f.mu.Unlock()
+		unwatch()
+		return
+	}
+	f.unwatch = unwatch
+	f.mu.Unlock()
+}
@@ -0,0 +1,187 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// TaskGroup is a set of related tasks run on a pool, canceled and awaited
+// as a unit, like an errgroup whose goroutines are the pool's bounded
+// workers. Create one with Pool.Group.
+//
+// Usage:
+//
+//	g := pool.Group("checkout")
+//	g.Submit(ctx, reserveStock)
+//	g.Submit(ctx, chargeCard)
+//	if err := g.Wait(ctx); err != nil {
+//		g.CancelAll()
+//		return err
+//	}
+type TaskGroup struct {
+	pool   *Pool
+	name   string
+	ctx    context.Context // canceled by CancelAll
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	pending int
+	idle    chan struct{} // closed when pending drops to zero, nil if not awaited
+	err     error         // first task error
+}
+
+// Group returns a new, empty task group running on the pool. The name
+// identifies the group's tasks: it becomes their TaskInfo name unless the
+// submission context carries a TaskInfo. Every call returns a distinct
+// group, whatever the name.
+func (p *Pool) Group(name string) *TaskGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TaskGroup{
+		pool:   p,
+		name:   name,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Name returns the name of the group.
+func (g *TaskGroup) Name() string {
+	return g.name
+}
+
+// Submit submits a task to the group's pool, blocking while the queue is
+// full like Pool.Submit. The task context is canceled when ctx is done or
+// CancelAll is called; a task not yet started then does not run and fails
+// with the context error. The task is not retried under WithRetry, since
+// Wait reports its error.
+func (g *TaskGroup) Submit(ctx context.Context, task Task) error {
+	if task == nil {
+		return errors.New("ion: nil task")
+	}
+	if _, ok := TaskInfoFromContext(ctx); !ok {
+		ctx = ContextWithTaskInfo(ctx, TaskInfo{Name: g.name})
+	}
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(g.ctx, cancel)
+	release := func() {
+		stop()
+		cancel()
+	}
+
+	g.add()
+	err := g.pool.submit(ctx, taskSubmission{
+		task: func(ctx context.Context) error {
+			defer release()
+			return g.run(ctx, task)
+		},
+		ctx:      taskCtx,
+		deadline: g.pool.deadlineOf(ctx),
+		onMiss: func(err error) {
+			release()
+			g.done(err)
+		},
+		noRetry: true,
+	})
+	if err != nil {
+		release()
+		g.remove()
+	}
+	return err
+}
+
+// run executes a task of the group unless it was canceled first, and
+// records its result.
+func (g *TaskGroup) run(ctx context.Context, task Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			g.done(g.pool.panicError(r))
+			panic(r)
+		}
+		g.done(err)
+	}()
+
+	// The task context is canceled asynchronously after CancelAll
+	if err := g.ctx.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return task(ctx)
+}
+
+// CancelAll cancels the context of every task submitted to the group, and
+// of those submitted later. Queued tasks do not run.
+func (g *TaskGroup) CancelAll() {
+	g.cancel()
+}
+
+// Wait blocks until every task submitted to the group has finished, and
+// returns the first error a task returned, if any. It returns the context
+// error if ctx is done first, and a pool closed error if the pool stops
+// with group tasks still queued. The group can be reused after Wait.
+func (g *TaskGroup) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.pending == 0 {
+		err := g.err
+		g.mu.Unlock()
+		return err
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.mu.Unlock()
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-g.pool.stopped:
+		select {
+		case <-idle:
+		default:
+			// The tasks still queued were dropped
+			return NewPoolClosedError(g.pool.name)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// add counts a task about to be submitted.
+func (g *TaskGroup) add() {
+	g.mu.Lock()
+	g.pending++
+	g.mu.Unlock()
+}
+
+// done records the end of a task, which failed with err if not nil.
+func (g *TaskGroup) done(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err != nil && g.err == nil {
+		g.err = err
+	}
+	g.removeLocked()
+}
+
+// remove uncounts a task that could not be submitted.
+func (g *TaskGroup) remove() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.removeLocked()
+}
+
+func (g *TaskGroup) removeLocked() {
+	g.pending--
+	if g.pending == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
@@ -2,93 +2,214 @@ package workerpool
 
 import (
 	"context"
-	"time"
+	"errors"
+	"fmt"
+	"sync/atomic"
 )
 
+// State is the lifecycle state of a pool. A pool goes from StateRunning to
+// StateDraining, when Drain or ShutdownOnSignal is called, and to
+// StateClosed, when Close is called or a drain completes; it never goes
+// back.
+type State int32
+
+const (
+	// StateRunning accepts and runs tasks
+	StateRunning State = iota
+	// StateDraining rejects new tasks but runs the queued ones. A drain
+	// that timed out leaves the pool draining, so Drain can be called again
+	// with a longer deadline, or Close to give up
+	StateDraining
+	// StateClosed rejects new tasks and abandons the queued ones. Running
+	// tasks see their context canceled and may still be finishing
+	StateClosed
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// State returns the lifecycle state of the pool.
+func (p *Pool) State() State {
+	switch {
+	case p.IsClosed():
+		return StateClosed
+	case p.draining.Load():
+		return StateDraining
+	default:
+		return StateRunning
+	}
+}
+
 // Close immediately stops accepting new tasks and signals all workers to stop.
 // It waits for currently running tasks to complete unless the provided context
 // is canceled or times out. If the context expires, workers are asked to stop
 // via task context cancellation.
+//
+// The returned error joins every problem encountered: a timeout waiting for
+// running tasks and queued tasks that never ran (ErrTasksAbandoned). A Close
+// that timed out can be called again to keep waiting for the running tasks;
+// once they have all finished, Close returns an error wrapping
+// ErrPoolClosed.
 func (p *Pool) Close(ctx context.Context) error {
-	var err error
+	select {
+	case <-p.stopped:
+		return NewClosedError(p.name, "close")
+	default:
+	}
+	return p.close(ctx)
+}
 
+// close closes the pool if it is not already, then waits for the workers to
+// exit or ctx to be done.
+func (p *Pool) close(ctx context.Context) error {
+	obs := p.obs.WithContext(ctx)
 	p.closeOnce.Do(func() {
-		p.obs.Logger.Info("closing workerpool", "pool", p.name)
+		obs.Logger.Info("closing workerpool", "pool", p.name)
 		close(p.closed)
 		p.cancel()
 		p.taskMu.Lock()
 		close(p.taskCh)
 		p.taskMu.Unlock()
+		// Wake drains, whose tasks may never complete now
+		p.broadcastIdle()
 
-		// Wait for workers to finish with timeout
-		done := make(chan struct{})
 		go func() {
 			p.workerWg.Wait()
-			close(done)
+			p.stop()
 		}()
+	})
 
-		select {
-		case <-done:
-			p.obs.Logger.Info("workerpool closed gracefully", "pool", p.name)
+	var errs []error
+	select {
+	case <-p.stopped:
+		obs.Logger.Info("workerpool closed gracefully", "pool", p.name)
 
-		case <-ctx.Done():
-			p.obs.Logger.Warn("workerpool close timed out, some tasks may have been interrupted",
-				"pool", p.name, "error", ctx.Err())
-			err = ctx.Err()
-		}
-	})
+	case <-ctx.Done():
+		obs.Logger.Warn("workerpool close timed out, some tasks may have been interrupted",
+			"pool", p.name, "error", ctx.Err())
+		errs = append(errs, NewShutdownTimeoutError(p.name, "close", ctx.Err()))
+	}
 
-	return err
+	if queued := p.queueLen(); queued > 0 {
+		errs = append(errs, NewTasksAbandonedError(p.name, int64(queued)))
+	}
+	return errors.Join(errs...)
 }
 
 // Drain prevents new task submissions and waits for the queue to empty and all
 // currently running tasks to complete. Unlike Close, Drain allows queued tasks
-// to continue being processed until the queue is empty.
+// to continue being processed until the queue is empty. Submissions already
+// blocked on a full queue and tasks waiting to be retried are waited for
+// too. Drain returns as soon as the last task completes, and closes the pool.
+//
+// If ctx is done first, Drain returns a timeout error and leaves the pool
+// draining: queued tasks keep running, and Drain can be called again with a
+// longer deadline, or Close to give up on them. Drain returns an error
+// wrapping ErrPoolClosed if the pool is closed, before or during the drain.
 func (p *Pool) Drain(ctx context.Context) error {
-	var err error
-
-	p.drainOnce.Do(func() {
-		p.obs.Logger.Info("draining workerpool", "pool", p.name)
-
-		p.draining.Store(true)
-
-		ticker := time.NewTicker(100 * time.Millisecond)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				p.obs.Logger.Warn("workerpool drain timed out",
-					"pool", p.name, "error", ctx.Err())
-				err = ctx.Err()
-				// Still need to close after timeout
-				p.Close(context.Background())
-				return
-
-			case <-ticker.C:
-				metrics := p.Metrics()
-				if metrics.Queued == 0 && metrics.Running == 0 {
-					// Queue is empty and no tasks running, safe to close
-					closeCtx, cancel := context.WithTimeout(context.Background(), p.drainTimeout)
-					defer cancel()
-
-					err = p.Close(closeCtx)
-					p.obs.Logger.Info("workerpool drained successfully", "pool", p.name)
-					return
-				}
-
-				p.obs.Logger.Debug("waiting for drain to complete",
-					"pool", p.name,
-					"queued", metrics.Queued,
-					"running", metrics.Running,
-				)
-			}
+	if p.IsClosed() {
+		return NewClosedError(p.name, "drain")
+	}
+
+	obs := p.obs.WithContext(ctx)
+	if !p.draining.Swap(true) {
+		obs.Logger.Info("draining workerpool", "pool", p.name)
+	}
+
+	if err := p.waitIdle(ctx); err != nil {
+		if errors.Is(err, ErrPoolClosed) {
+			return NewClosedError(p.name, "drain")
 		}
-	})
+		obs.Logger.Warn("workerpool drain timed out",
+			"pool", p.name, "error", err)
+		return NewShutdownTimeoutError(p.name, "drain", err)
+	}
+
+	// Queue is empty and no tasks running, safe to close
+	closeCtx, cancel := context.WithTimeout(context.Background(), p.drainTimeout)
+	defer cancel()
 
+	err := p.close(closeCtx)
+	obs.Logger.Info("workerpool drained successfully", "pool", p.name)
 	return err
 }
 
+// begin counts a task the pool is responsible for, from its submission
+// until it completes for good, so that Drain knows when the pool is idle.
+func (p *Pool) begin() {
+	p.active.Add(1)
+}
+
+// end uncounts a task counted by begin, waking Drain once none is left.
+func (p *Pool) end() {
+	if p.active.Add(-1) == 0 {
+		p.broadcastIdle()
+	}
+	p.metricsChanged()
+}
+
+// broadcastIdle wakes every waitIdle.
+func (p *Pool) broadcastIdle() {
+	p.idleMu.Lock()
+	p.idle.Broadcast()
+	p.idleMu.Unlock()
+}
+
+// waitIdle waits until no task is being submitted, queued, running or
+// waiting to be retried, or ctx is done. It returns as soon as the last task
+// completes, or ErrPoolClosed once the pool is closed, since queued tasks
+// are then abandoned.
+func (p *Pool) waitIdle(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, p.broadcastIdle)
+	defer stop()
+
+	p.idleMu.Lock()
+	defer p.idleMu.Unlock()
+
+	if p.active.Load() > 0 {
+		p.obs.WithContext(ctx).Logger.Debug("waiting for drain to complete",
+			"pool", p.name,
+			"queued", p.queueLen(),
+			"running", atomic.LoadInt64(&p.metrics.Running),
+		)
+	}
+	for p.active.Load() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p.IsClosed() {
+			return ErrPoolClosed
+		}
+		p.idle.Wait()
+	}
+	return nil
+}
+
+// queueLen returns the number of submissions waiting for a worker. A
+// submission handed directly to a worker, with a queueSize of 0, is never
+// queued.
+func (p *Pool) queueLen() int {
+	switch {
+	case p.shards != nil:
+		return p.shards.len()
+	case p.queue != nil:
+		return p.queue.size()
+	default:
+		return len(p.taskCh)
+	}
+}
+
 // IsClosed returns true if the pool has been closed or is in the process of closing
 func (p *Pool) IsClosed() bool {
 	select {
@@ -0,0 +1,180 @@
+package workerpool
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/stats"
+)
+
+// latencyWindow is the window over which DetailedMetrics summarizes wait
+// and execution times.
+const latencyWindow = time.Minute
+
+// DetailedMetrics is a snapshot of the pool metrics with latency
+// distributions and utilization, see Pool.DetailedMetrics.
+type DetailedMetrics struct {
+	PoolMetrics
+
+	Wait      LatencyStats // from being queued to starting, last minute
+	Execution LatencyStats // running time, last minute
+
+	Utilization    float64 // percentage of workers running a task, 0 to 100
+	QueueHighWater int     // most submissions ever queued at once
+}
+
+// LatencyStats summarizes a distribution of durations. Quantiles are
+// estimates within 1% of the true value.
+type LatencyStats struct {
+	Count uint64
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// detailTracker records the wait and execution times of tasks and the queue
+// high-water mark.
+type detailTracker struct {
+	wait      *stats.RollingHistogram
+	execution *stats.RollingHistogram
+	highWater atomic.Int64
+}
+
+func newDetailTracker(clk clock.Clock) *detailTracker {
+	return &detailTracker{
+		wait:      stats.NewRollingHistogram(latencyWindow, 6, stats.WithClock(clk)),
+		execution: stats.NewRollingHistogram(latencyWindow, 6, stats.WithClock(clk)),
+	}
+}
+
+// DetailedMetrics returns a snapshot of the pool metrics along with the
+// distributions of the time tasks waited to start and ran over the last
+// minute, the current utilization of the workers and the queue high-water
+// mark. The same figures are reported as they change through the Metrics
+// interface, as the ion_workerpool_task_wait_seconds and
+// ion_workerpool_task_duration_seconds histograms and the
+// ion_workerpool_utilization_percent and ion_workerpool_queue_high_water
+// gauges.
+func (p *Pool) DetailedMetrics() DetailedMetrics {
+	return DetailedMetrics{
+		PoolMetrics:    p.Metrics(),
+		Wait:           summarize(p.detail.wait.Snapshot()),
+		Execution:      summarize(p.detail.execution.Snapshot()),
+		Utilization:    p.utilization(),
+		QueueHighWater: int(p.detail.highWater.Load()),
+	}
+}
+
+// summarize converts a histogram of seconds to LatencyStats.
+func summarize(h *stats.Histogram) LatencyStats {
+	if h.Count() == 0 {
+		return LatencyStats{}
+	}
+	seconds := func(v float64) time.Duration {
+		return time.Duration(v * float64(time.Second))
+	}
+	return LatencyStats{
+		Count: h.Count(),
+		Mean:  seconds(h.Mean()),
+		P50:   h.QuantileDuration(0.5),
+		P90:   h.QuantileDuration(0.9),
+		P99:   h.QuantileDuration(0.99),
+		Max:   seconds(h.Max()),
+	}
+}
+
+// utilization returns the percentage of workers running a task. Tasks run
+// by their submitter under OverflowCallerRuns may push it over 100, which
+// is reported as 100.
+func (p *Pool) utilization() float64 {
+	workers := p.workers.Load()
+	if workers <= 0 {
+		return 0
+	}
+	running := atomic.LoadInt64(&p.metrics.Running)
+	return min(float64(running)/float64(workers)*100, 100)
+}
+
+// recordWait records a task starting after waiting for d.
+func (p *Pool) recordWait(d time.Duration) {
+	p.detail.wait.RecordDuration(d)
+	p.obs.Metrics.Histogram("ion_workerpool_task_wait_seconds", d.Seconds(), "pool_name", p.name)
+}
+
+// recordExecution records a task that ran for d.
+func (p *Pool) recordExecution(d time.Duration) {
+	p.detail.execution.RecordDuration(d)
+	p.obs.Metrics.Histogram("ion_workerpool_task_duration_seconds", d.Seconds(), "pool_name", p.name)
+}
+
+// recordUtilization reports the utilization after a task started or
+// finished.
+func (p *Pool) recordUtilization() {
+	p.obs.Metrics.Gauge("ion_workerpool_utilization_percent", p.utilization(), "pool_name", p.name)
+}
+
+// recordQueueLen raises the queue high-water mark to n if it is higher.
+func (p *Pool) recordQueueLen(n int) {
+	for {
+		high := p.detail.highWater.Load()
+		if int64(n) <= high {
+			return
+		}
+		if p.detail.highWater.CompareAndSwap(high, int64(n)) {
+			p.obs.Metrics.Gauge("ion_workerpool_queue_high_water", float64(n), "pool_name", p.name)
+			return
+		}
+	}
+}
+
+// WaitMetrics blocks until the pool metrics satisfy cond, or ctx is done.
+// cond is called with a new snapshot every time the pool updates the counts
+// of Metrics, rather than on a timer, and must be fast. WaitMetrics returns
+// the last snapshot, and the context error if ctx ended the wait.
+//
+// Usage:
+//
+//	// Wait for the queued tasks to start
+//	_, err := pool.WaitMetrics(ctx, func(m workerpool.PoolMetrics) bool {
+//		return m.Queued == 0
+//	})
+func (p *Pool) WaitMetrics(ctx context.Context, cond func(PoolMetrics) bool) (PoolMetrics, error) {
+	p.metricWaiters.Add(1)
+	defer p.metricWaiters.Add(-1)
+
+	stop := context.AfterFunc(ctx, p.broadcastMetrics)
+	defer stop()
+
+	p.metricMu.Lock()
+	defer p.metricMu.Unlock()
+
+	for {
+		m := p.Metrics()
+		if cond(m) {
+			return m, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return m, err
+		}
+		p.metricCond.Wait()
+	}
+}
+
+// metricsChanged wakes WaitMetrics after a count of Metrics changed. It
+// costs an atomic load when nothing waits.
+func (p *Pool) metricsChanged() {
+	if p.metricWaiters.Load() > 0 {
+		p.broadcastMetrics()
+	}
+}
+
+// broadcastMetrics wakes every WaitMetrics.
+func (p *Pool) broadcastMetrics() {
+	p.metricMu.Lock()
+	p.metricCond.Broadcast()
+	p.metricMu.Unlock()
+}
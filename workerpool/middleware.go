@@ -0,0 +1,162 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+)
+
+// Middleware wraps a task with cross-cutting behavior such as logging,
+// tracing, timeouts or retries, like HTTP middleware wraps a handler.
+type Middleware func(Task) Task
+
+// Chain composes middlewares into one. The first middleware is the
+// outermost: it sees the task first on the way in and last on the way out.
+func Chain(mws ...Middleware) Middleware {
+	return func(task Task) Task {
+		for i := len(mws) - 1; i >= 0; i-- {
+			task = mws[i](task)
+		}
+		return task
+	}
+}
+
+// clockKey is the context key for the clock of the pool running a task.
+type clockKey struct{}
+
+// clockOf returns the clock of the pool running a task, see WithClock, or
+// the real clock for a task run outside a pool.
+func clockOf(ctx context.Context) clock.Clock {
+	if clk, ok := ctx.Value(clockKey{}).(clock.Clock); ok {
+		return clk
+	}
+	return clock.Real()
+}
+
+// WithMiddleware appends middlewares to the chain applied to every task.
+// Middlewares run in the order they are registered, across repeated
+// WithMiddleware and WithTaskWrapper options, the first being outermost.
+// Logging, Timeout and Retry measure and wait with the pool clock, so they
+// follow a fake clock given to WithClock.
+//
+// Usage:
+//
+//	pool := workerpool.New(8, 64, workerpool.WithMiddleware(
+//		workerpool.RecoverPanics(),
+//		workerpool.Tracing(tracer, "job"),
+//		workerpool.Timeout(5*time.Second),
+//		workerpool.Retry(3, backoff.Exponential(100*time.Millisecond)),
+//	))
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *config) {
+		c.middleware = append(c.middleware, mws...)
+	}
+}
+
+// Logging logs the outcome and duration of every task at debug level, and
+// failures at error level.
+func Logging(logger observe.Logger) Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			clk := clockOf(ctx)
+			start := clk.Now()
+			err := next(ctx)
+			if err != nil {
+				logger.Error("task failed", err, "duration", clk.Since(start))
+			} else {
+				logger.Debug("task completed", "duration", clk.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// Tracing runs every task in a span with the given name.
+func Tracing(tracer observe.Tracer, name string) Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			ctx, finish := tracer.Start(ctx, name)
+			err := next(ctx)
+			finish(err)
+			return err
+		}
+	}
+}
+
+// Timeout cancels the context of every task after d. Under a fake pool
+// clock the context has no deadline: it is canceled with cause
+// ErrTaskTimeout once the clock has advanced by d.
+func Timeout(d time.Duration) Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			clk := clockOf(ctx)
+			if clk == clock.Real() {
+				ctx, cancel := context.WithTimeout(ctx, d)
+				defer cancel()
+				return next(ctx)
+			}
+
+			ctx, cancel := context.WithCancelCause(ctx)
+			defer cancel(nil)
+			timer := clk.AfterFunc(d, func() { cancel(ErrTaskTimeout) })
+			defer timer.Stop()
+			return next(ctx)
+		}
+	}
+}
+
+// errNilStrategy fails the tasks of a Retry middleware given no strategy.
+var errNilStrategy = errors.New("ion: nil retry strategy")
+
+// Retry runs a failing task again, up to attempts times in total, waiting
+// between attempts as given by strategy. It stops early when the task
+// context is done. Place Timeout inside Retry to bound each attempt, or
+// outside to bound all of them. With a nil strategy, every task fails
+// without running.
+func Retry(attempts int, strategy backoff.Strategy) Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			if strategy == nil {
+				return errNilStrategy
+			}
+
+			clk := clockOf(ctx)
+			var prev time.Duration
+			var err error
+			for attempt := 1; ; attempt++ {
+				if err = next(ctx); err == nil || attempt >= attempts {
+					return err
+				}
+
+				prev = strategy(attempt, prev)
+				timer := clk.NewTimer(prev)
+				select {
+				case <-timer.C():
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				}
+			}
+		}
+	}
+}
+
+// RecoverPanics turns a panic in a task into a *PanicError, which matches
+// ErrTaskPanicked, so it is counted and reported as a failure rather than
+// handled by the pool panic handler.
+func RecoverPanics() Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r}
+				}
+			}()
+			return next(ctx)
+		}
+	}
+}
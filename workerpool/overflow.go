@@ -0,0 +1,164 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// OverflowPolicy is what a submission does when the queue is full, see
+// WithOverflowPolicy.
+type OverflowPolicy int
+
+const (
+	// OverflowDefault makes Submit wait for room and TrySubmit fail with
+	// an error wrapping ErrQueueFull (default)
+	OverflowDefault OverflowPolicy = iota
+	// OverflowReject makes Submit fail like TrySubmit instead of waiting
+	OverflowReject
+	// OverflowBlock makes TrySubmit wait for room like Submit, until the
+	// pool closes
+	OverflowBlock
+	// OverflowDropOldest drops the oldest queued task to make room. The
+	// dropped task fails with an error wrapping ErrTaskDropped
+	OverflowDropOldest
+	// OverflowCallerRuns runs the task on the submitting goroutine, so
+	// submitters slow down to the pace of the pool without dropping or
+	// failing anything
+	OverflowCallerRuns
+)
+
+// String returns the name of the overflow policy.
+func (o OverflowPolicy) String() string {
+	switch o {
+	case OverflowDefault:
+		return "default"
+	case OverflowReject:
+		return "reject"
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowCallerRuns:
+		return "caller_runs"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(o))
+	}
+}
+
+// callerWorker is the worker ID of tasks run by their submitter under
+// OverflowCallerRuns.
+const callerWorker = -1
+
+// WithOverflowPolicy sets what Submit and TrySubmit do when the queue is
+// full. TrySubmitTimeout always waits up to its timeout.
+//
+// With OverflowDropOldest, the dropped task is counted as failed, passed to
+// the dead letter handler and reported in
+// ion_workerpool_tasks_dropped_total; without a queue, a queue size of 0,
+// there is nothing to drop and submissions fail as with OverflowReject. In
+// EDF and priority mode the oldest task is dropped whatever its urgency.
+//
+// With OverflowCallerRuns, the task runs before Submit returns, with
+// worker ID -1 and no WorkerState; Submit then returns nil whatever the
+// task returns, which the pool handles as usual.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(c *config) {
+		c.overflow = policy
+	}
+}
+
+// place queues a checked submission under the overflow policy. wait tells
+// whether the caller waits for room by default, as Submit does.
+func (p *Pool) place(ctx context.Context, submission taskSubmission, wait bool) error {
+	policy := p.overflow
+	if policy == OverflowDefault {
+		policy = OverflowReject
+		if wait {
+			policy = OverflowBlock
+		}
+	}
+	if policy == OverflowBlock || p.inline {
+		return p.enqueue(ctx, submission, nil)
+	}
+
+	p.begin()
+	err := p.tryEnqueue(submission)
+	if errors.Is(err, ErrQueueFull) {
+		switch policy {
+		case OverflowDropOldest:
+			err = p.replaceOldest(submission, err)
+		case OverflowCallerRuns:
+			// executeTask ends the task
+			p.executeTask(submission, callerWorker, nil)
+			return nil
+		}
+	}
+	if err != nil {
+		p.end()
+		if errors.Is(err, ErrQueueFull) {
+			p.obs.WithContext(ctx).Metrics.Inc("ion_workerpool_tasks_rejected_total",
+				"pool_name", p.name, "reason", "queue_full")
+		}
+		return err
+	}
+	p.queued(submission)
+	return nil
+}
+
+// replaceOldest drops queued submissions until submission fits in the
+// queue. It returns err, the queue full error, if there is nothing to drop.
+func (p *Pool) replaceOldest(submission taskSubmission, err error) error {
+	for errors.Is(err, ErrQueueFull) {
+		// Room is not signaled to blocked submitters, since it is taken
+		// at once
+		dropped, ok := p.dropOldest()
+		if !ok {
+			return err
+		}
+		p.drop(dropped)
+		err = p.tryEnqueue(submission)
+	}
+	return err
+}
+
+// dropOldest removes the oldest queued submission, if any.
+func (p *Pool) dropOldest() (taskSubmission, bool) {
+	switch {
+	case p.shards != nil:
+		return p.shards.dropOldest()
+	case p.queue != nil:
+		return p.queue.dropOldest()
+	}
+
+	// Close closes taskCh under the write lock
+	p.taskMu.RLock()
+	defer p.taskMu.RUnlock()
+
+	select {
+	case submission, ok := <-p.taskCh:
+		return submission, ok
+	default:
+		return taskSubmission{}, false
+	}
+}
+
+// drop fails a submission removed from the queue to make room.
+func (p *Pool) drop(submission taskSubmission) {
+	defer p.end()
+	p.releaseQuota(submission)
+
+	err := NewTaskDroppedError(p.name)
+	if p.priority {
+		p.recordPriorityQueued(submission.priority)
+	}
+	p.obs.WithContext(submission.ctx).Metrics.Inc("ion_workerpool_tasks_dropped_total", "pool_name", p.name)
+	p.taskLog.Warn("task dropped, queue full",
+		"pool", p.name, "queued_for", p.clock.Since(submission.enqueued))
+
+	p.onFinish(submission, TaskEvent{Err: err})
+	p.fail(submission, err)
+	if submission.onMiss != nil {
+		submission.onMiss(err)
+	}
+}
@@ -0,0 +1,22 @@
+package pipeline
+
+import "fmt"
+
+// StageError reports the failure of an item in a pipeline stage.
+type StageError struct {
+	Stage string // name of the stage
+	Err   error  // underlying error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("ion: pipeline stage %q: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// NewStageError creates an error for a failure inside a stage
+func NewStageError(stage string, err error) error {
+	return &StageError{Stage: stage, Err: err}
+}
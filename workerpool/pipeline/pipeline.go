@@ -0,0 +1,291 @@
+// Package pipeline connects typed processing stages with channels and runs
+// their work on a shared workerpool.Pool.
+//
+// Each stage reads a channel and returns its output channel, so stages
+// compose like ordinary functions. Stages bound the number of items they
+// have in flight on the pool, and the output channels are bounded, so a slow
+// consumer applies backpressure all the way to the input. The first failure
+// cancels the pipeline and is returned by Wait.
+//
+// This package is not a replacement for ion/pipeline; the two solve
+// different problems and behave differently:
+//
+//   - Execution: ion/pipeline creates a workerpool per stage and owns it for
+//     the duration of Run. Here every stage submits to the caller's pool, so
+//     a pipeline competes for the same bounded workers as the rest of the
+//     service, and Workers only bounds a stage's items in flight on it.
+//   - Composition: ion/pipeline is a builder (From, Then, To, Run) that
+//     passes items between stages as any. Here stages are generic functions
+//     from channel to channel, and the caller reads the last channel itself.
+//   - Errors: ion/pipeline offers StopOnError and ContinueOnError with an
+//     error handler. Here the first failure always cancels the pipeline and
+//     Wait returns it as a *StageError; a stage that should tolerate bad
+//     items has to handle them in its own function.
+//   - Filtering: any ion/pipeline stage can drop an item by returning
+//     ErrSkip, which is counted separately from failures. Here only Filter
+//     drops items, and there is no skip sentinel.
+//   - Ordering: ion/pipeline stages emit in completion order. Here the
+//     Ordered option keeps a stage's output in input order.
+//   - Buffering: in ion/pipeline Buffer sizes the queue in front of a stage
+//     and defaults to 1. Here it sizes a stage's output channel and defaults
+//     to 0, an unbuffered channel.
+//   - Branching: ion/pipeline is linear. Here FanOut copies a stream to
+//     several consumers.
+//   - Metrics: ion/pipeline reports per-stage counters through Metrics and
+//     ion_pipeline_items_total. This package records nothing of its own;
+//     its work shows up only in the shared pool's metrics.
+//
+// Use ion/pipeline for a self-contained job with its own concurrency and
+// error policy, and this package to stream typed items through a pool that
+// is shared with other work.
+//
+// Usage:
+//
+//	p := pipeline.New(ctx, pool)
+//	rows := pipeline.Map(p, "parse", lines, parseRow, pipeline.Workers(8))
+//	valid := pipeline.Filter(p, "valid", rows, isValid)
+//	for row := range valid {
+//		write(row)
+//	}
+//	if err := p.Wait(); err != nil {
+//		return err
+//	}
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Pipeline tracks the stages of a pipeline, cancels them on the first
+// failure and waits for them to finish.
+type Pipeline struct {
+	pool   *workerpool.Pool
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+// New creates a pipeline whose stages run on pool. The pipeline is canceled
+// when ctx is done.
+func New(ctx context.Context, pool *workerpool.Pool) *Pipeline {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Pipeline{
+		pool:   pool,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Context returns the context of the pipeline, which is canceled on the
+// first failure. Producers feeding the first stage should stop sending once
+// it is done.
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Wait blocks until every stage has finished and returns the first
+// failure, a *StageError, which wraps the context error if the parent
+// context was done first. Stages finish once their input is closed and
+// their output consumed, or once the pipeline is canceled, so the output of
+// the last stage must be read to completion before calling Wait.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.cancel(nil)
+	return p.err
+}
+
+// fail records the first failure and cancels the pipeline.
+func (p *Pipeline) fail(stage string, err error) {
+	p.errOnce.Do(func() {
+		p.err = NewStageError(stage, err)
+		p.cancel(p.err)
+	})
+}
+
+// StageOption configures a stage.
+type StageOption func(*stageConfig)
+
+type stageConfig struct {
+	workers int
+	buffer  int
+	ordered bool
+}
+
+// Workers sets the number of items a stage may have in flight on the pool
+// at once. Default: 1
+func Workers(n int) StageOption {
+	return func(c *stageConfig) {
+		c.workers = n
+	}
+}
+
+// Buffer sets the size of the output channel of a stage. Default: 0
+func Buffer(n int) StageOption {
+	return func(c *stageConfig) {
+		c.buffer = n
+	}
+}
+
+// Ordered makes a stage emit its items in input order. Items that finish
+// early wait for the earlier ones, within the Workers limit.
+func Ordered() StageOption {
+	return func(c *stageConfig) {
+		c.ordered = true
+	}
+}
+
+func newStageConfig(opts []StageOption) stageConfig {
+	cfg := stageConfig{workers: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.workers = max(cfg.workers, 1)
+	cfg.buffer = max(cfg.buffer, 0)
+	return cfg
+}
+
+// Map runs fn on the pool for every item of in and sends the results on the
+// returned channel, which is closed once in is closed and every item is
+// processed, or the pipeline is canceled. An error from fn fails the
+// pipeline.
+func Map[In, Out any](p *Pipeline, name string, in <-chan In, fn func(ctx context.Context, item In) (Out, error), opts ...StageOption) <-chan Out {
+	return stage(p, name, in, func(ctx context.Context, item In) (Out, bool, error) {
+		out, err := fn(ctx, item)
+		return out, true, err
+	}, opts)
+}
+
+// Filter runs keep on the pool for every item of in and sends the items for
+// which it returns true on the returned channel, which is closed like
+// Map's.
+func Filter[T any](p *Pipeline, name string, in <-chan T, keep func(ctx context.Context, item T) bool, opts ...StageOption) <-chan T {
+	return stage(p, name, in, func(ctx context.Context, item T) (T, bool, error) {
+		return item, keep(ctx, item), nil
+	}, opts)
+}
+
+// FanOut sends every item of in to each of n returned channels, so several
+// branches can consume the same stream. An item is sent to the next branch
+// only once the previous one took it, so the slowest branch sets the pace;
+// use Buffer to absorb bursts. The channels are closed once in is closed or
+// the pipeline is canceled. FanOut does not use the pool.
+func FanOut[T any](p *Pipeline, name string, in <-chan T, n int, opts ...StageOption) []<-chan T {
+	cfg := newStageConfig(opts)
+
+	outs := make([]chan T, max(n, 1))
+	result := make([]<-chan T, len(outs))
+	for i := range outs {
+		outs[i] = make(chan T, cfg.buffer)
+		result[i] = outs[i]
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+
+		for {
+			item, ok := receive(p, name, in)
+			if !ok {
+				return
+			}
+			for _, out := range outs {
+				select {
+				case out <- item:
+				case <-p.ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return result
+}
+
+// output is the result of a stage function for one item.
+type output[T any] struct {
+	value T
+	keep  bool
+}
+
+// stage runs fn on the pool for every item of in, through a Results stream
+// whose window bounds the items in flight.
+func stage[In, Out any](p *Pipeline, name string, in <-chan In, fn func(ctx context.Context, item In) (Out, bool, error), opts []StageOption) <-chan Out {
+	cfg := newStageConfig(opts)
+
+	resultsOpts := []workerpool.ResultsOption{workerpool.WithResultWindow(cfg.workers)}
+	if cfg.ordered {
+		resultsOpts = append(resultsOpts, workerpool.WithOrderedResults())
+	}
+	results := workerpool.NewResults[output[Out]](p.pool, resultsOpts...)
+	out := make(chan Out, cfg.buffer)
+
+	p.wg.Add(2)
+
+	// Submit the items
+	go func() {
+		defer p.wg.Done()
+		defer results.Close()
+
+		for {
+			item, ok := receive(p, name, in)
+			if !ok {
+				return
+			}
+			_, err := results.Submit(p.ctx, func(ctx context.Context) (output[Out], error) {
+				value, keep, err := fn(ctx, item)
+				return output[Out]{value, keep}, err
+			})
+			if err != nil {
+				p.fail(name, err)
+				return
+			}
+		}
+	}()
+
+	// Forward the results. The stream is read to the end even once the
+	// pipeline is canceled, so the tasks in flight can complete.
+	go func() {
+		defer p.wg.Done()
+		defer close(out)
+
+		for r := range results.C() {
+			if r.Err != nil {
+				p.fail(name, r.Err)
+				continue
+			}
+			if !r.Value.keep {
+				continue
+			}
+			select {
+			case out <- r.Value.value:
+			case <-p.ctx.Done():
+			}
+		}
+	}()
+
+	return out
+}
+
+// receive returns the next item of a stage's input, or false once it is
+// closed or the pipeline is canceled. A cancellation from the parent context
+// is recorded as the stage's failure.
+func receive[T any](p *Pipeline, stage string, in <-chan T) (T, bool) {
+	select {
+	case item, ok := <-in:
+		return item, ok
+	case <-p.ctx.Done():
+		p.fail(stage, context.Cause(p.ctx))
+		return *new(T), false
+	}
+}
@@ -0,0 +1,186 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/workerpool"
+	"github.com/kolosys/ion/workerpool/pipeline"
+)
+
+// source sends items on a channel until done, then closes it.
+func source[T any](ctx context.Context, items ...T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for _, item := range items {
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func TestPipeline(t *testing.T) {
+	t.Run("map and filter in order", func(t *testing.T) {
+		pool := workerpool.New(4, 8)
+		defer pool.Close(context.Background())
+
+		p := pipeline.New(context.Background(), pool)
+		squares := pipeline.Map(p, "square", source(p.Context(), 1, 2, 3, 4, 5, 6),
+			func(ctx context.Context, n int) (int, error) {
+				// Finish out of order
+				time.Sleep(time.Duration(6-n) * time.Millisecond)
+				return n * n, nil
+			}, pipeline.Workers(4), pipeline.Ordered())
+		even := pipeline.Filter(p, "even", squares, func(ctx context.Context, n int) bool {
+			return n%2 == 0
+		}, pipeline.Ordered())
+		formatted := pipeline.Map(p, "format", even, func(ctx context.Context, n int) (string, error) {
+			return strconv.Itoa(n), nil
+		}, pipeline.Ordered(), pipeline.Buffer(4))
+
+		var got []string
+		for s := range formatted {
+			got = append(got, s)
+		}
+		if err := p.Wait(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []string{"4", "16", "36"}; !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("bounds the items in flight", func(t *testing.T) {
+		pool := workerpool.New(8, 8)
+		defer pool.Close(context.Background())
+
+		var inflight, peak atomic.Int32
+		p := pipeline.New(context.Background(), pool)
+		out := pipeline.Map(p, "work", source(p.Context(), 1, 2, 3, 4, 5, 6, 7, 8, 9, 10),
+			func(ctx context.Context, n int) (int, error) {
+				cur := inflight.Add(1)
+				for {
+					old := peak.Load()
+					if cur <= old || peak.CompareAndSwap(old, cur) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				inflight.Add(-1)
+				return n, nil
+			}, pipeline.Workers(2))
+
+		var n int
+		for range out {
+			n++
+		}
+		if err := p.Wait(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != 10 {
+			t.Errorf("expected 10 items, got %d", n)
+		}
+		if got := peak.Load(); got > 2 {
+			t.Errorf("expected at most 2 items in flight, got %d", got)
+		}
+	})
+
+	t.Run("first error cancels the pipeline", func(t *testing.T) {
+		pool := workerpool.New(2, 2)
+		defer pool.Close(context.Background())
+
+		errBoom := errors.New("boom")
+		items := make([]int, 100)
+		for i := range items {
+			items[i] = i
+		}
+
+		p := pipeline.New(context.Background(), pool)
+		out := pipeline.Map(p, "fail", source(p.Context(), items...),
+			func(ctx context.Context, n int) (int, error) {
+				if n == 3 {
+					return 0, errBoom
+				}
+				return n, nil
+			})
+
+		var n int
+		for range out {
+			n++
+		}
+		err := p.Wait()
+		if !errors.Is(err, errBoom) {
+			t.Fatalf("expected the stage error, got %v", err)
+		}
+		var stageErr *pipeline.StageError
+		if !errors.As(err, &stageErr) || stageErr.Stage != "fail" {
+			t.Errorf("expected a StageError for stage fail, got %v", err)
+		}
+		if n >= len(items) {
+			t.Errorf("expected the pipeline to stop early, got %d items", n)
+		}
+	})
+
+	t.Run("parent context canceled", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		p := pipeline.New(ctx, pool)
+		in := make(chan int)
+		out := pipeline.Map(p, "idle", in, func(ctx context.Context, n int) (int, error) {
+			return n, nil
+		})
+
+		cancel()
+		for range out {
+		}
+		if err := p.Wait(); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("fan out", func(t *testing.T) {
+		pool := workerpool.New(2, 2)
+		defer pool.Close(context.Background())
+
+		p := pipeline.New(context.Background(), pool)
+		branches := pipeline.FanOut(p, "tee", source(p.Context(), 1, 2, 3), 2, pipeline.Buffer(3))
+		doubled := pipeline.Map(p, "double", branches[0], func(ctx context.Context, n int) (int, error) {
+			return n * 2, nil
+		}, pipeline.Ordered())
+
+		done := make(chan []int)
+		go func() {
+			var got []int
+			for n := range branches[1] {
+				got = append(got, n)
+			}
+			done <- got
+		}()
+
+		var got []int
+		for n := range doubled {
+			got = append(got, n)
+		}
+		if want := []int{2, 4, 6}; !slices.Equal(got, want) {
+			t.Errorf("expected %v on the first branch, got %v", want, got)
+		}
+		if got, want := <-done, []int{1, 2, 3}; !slices.Equal(got, want) {
+			t.Errorf("expected %v on the second branch, got %v", want, got)
+		}
+		if err := p.Wait(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -6,13 +6,21 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/clock"
 	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/ratelimit"
 )
 
+// logThrottleRate bounds how often the same per-task warning is logged, so a
+// failing dependency cannot flood the logs through a busy pool.
+var logThrottleRate = ratelimit.Per(1, 10*time.Second)
+
 // Task represents a unit of work to be executed by the worker pool.
 // Tasks receive a context that will be canceled if either the submission
 // context or the pool's base context is canceled.
@@ -26,29 +34,75 @@ type Pool struct {
 	size         int
 	queueSize    int
 	drainTimeout time.Duration
+	taskTimeout  time.Duration
+	clock        clock.Clock
 
 	// Observability
-	obs *observe.Observability
+	obs     *observe.Observability
+	taskLog observe.Logger // per-task warnings, throttled per message
 
 	// Lifecycle management
 	baseCtx   context.Context
 	cancel    context.CancelFunc
 	closed    chan struct{}
+	stopped   <-chan struct{}    // closed once every worker has exited
+	stopCtx   context.Context    // done when stopped is closed
+	stop      context.CancelFunc // closes stopped
 	draining  atomic.Bool
 	closeOnce sync.Once
-	drainOnce sync.Once
 
 	// Task management
 	taskCh   chan taskSubmission
+	queue    *taskQueue    // replaces taskCh in EDF and priority mode
+	shards   *shardedQueue // replaces taskCh with WithWorkStealing
+	edf      bool
+	priority bool
+	inline   bool // tasks run on their submitter, see WithInline
 	taskMu   sync.RWMutex
 	workerWg sync.WaitGroup
 
+	// Deduplicated submissions by key, see SubmitDedup
+	dedupMu sync.Mutex
+	dedup   map[string]*Future[struct{}]
+
+	// Tasks submitted and not yet completed for good, see begin and end
+	active atomic.Int64
+	idleMu sync.Mutex
+	idle   *sync.Cond // broadcast when active drops to zero
+
+	// Goroutines in WaitMetrics, woken by metricsChanged
+	metricWaiters atomic.Int32
+	metricMu      sync.Mutex
+	metricCond    *sync.Cond
+
+	// Workers
+	workers    atomic.Int64 // current number of workers
+	nextWorker atomic.Int64 // ID of the next worker started
+	scaler     *autoscaler  // nil unless autoscaling
+	retire     chan struct{}
+
 	// Metrics
 	metrics PoolMetrics
+	detail  *detailTracker
 
 	// Panic recovery
 	panicHandler func(any)
+	panicErrors  bool
 	taskWrapper  func(Task) Task
+
+	// Retries
+	retryAttempts int
+	retryBackoff  backoff.Strategy
+	deadLetter    func(Task, error)
+
+	hooks TaskHooks
+
+	// Worker state
+	workerInit    func(int) (any, error)
+	workerCleanup func(int, any)
+
+	overflow OverflowPolicy
+	quotas   *quotas // nil unless WithQuota
 }
 
 // GetName returns the name of the pool
@@ -56,9 +110,10 @@ func (p *Pool) GetName() string {
 	return p.name
 }
 
-// GetSize returns the size of the pool
+// GetSize returns the size of the pool, which changes over time with
+// WithAutoscale
 func (p *Pool) GetSize() int {
-	return p.size
+	return int(p.workers.Load())
 }
 
 // GetQueueSize returns the queue size of the pool
@@ -66,20 +121,40 @@ func (p *Pool) GetQueueSize() int {
 	return p.queueSize
 }
 
+// GetOverflowPolicy returns the overflow policy of the pool
+func (p *Pool) GetOverflowPolicy() OverflowPolicy {
+	return p.overflow
+}
+
 // taskSubmission wraps a task with its submission context
 type taskSubmission struct {
-	task Task
-	ctx  context.Context
+	task     Task
+	ctx      context.Context
+	deadline time.Time     // latest start time, zero if none
+	onMiss   func(error)   // called instead of task when it misses its deadline or is dropped
+	priority int           // higher runs first in priority mode
+	timeout  time.Duration // overrides the pool's task timeout if positive
+	enqueued time.Time     // when it was queued, for aging and wait metrics
+
+	attempt int           // number of earlier attempts
+	backoff time.Duration // delay before the current attempt
+	noRetry bool          // exempt from WithRetry and WithDeadLetter
+
+	info     TaskInfo // from the submission context, for TaskHooks
+	quotaKey string   // submitter holding a quota slot, see WithQuota
 }
 
 // PoolMetrics holds runtime metrics for the pool
 type PoolMetrics struct {
-	Size      int    // configured pool size
-	Queued    int64  // current queue length
+	Size      int    // current number of workers
+	Queued    int64  // submissions waiting for a worker
 	Running   int64  // currently running tasks
 	Completed uint64 // total completed tasks
 	Failed    uint64 // total failed tasks
 	Panicked  uint64 // total panicked tasks
+
+	Retried      uint64 // total failed attempts that were retried
+	DeadLettered uint64 // total failed tasks passed to the dead letter handler
 }
 
 // Option configures pool behavior
@@ -89,9 +164,34 @@ type config struct {
 	name         string
 	baseCtx      context.Context
 	drainTimeout time.Duration
+	taskTimeout  time.Duration
+	clock        clock.Clock
 	obs          *observe.Observability
 	panicHandler func(any)
-	taskWrapper  func(Task) Task
+	panicErrors  bool
+	middleware   []Middleware
+	edf          bool
+
+	priority      bool
+	priorityAging time.Duration
+
+	workStealing bool
+	autoscale    *autoscaleConfig
+	inline       bool
+
+	retryAttempts int
+	retryBackoff  backoff.Strategy
+	deadLetter    func(Task, error)
+
+	hooks TaskHooks
+
+	workerInit    func(int) (any, error)
+	workerCleanup func(int, any)
+
+	overflow OverflowPolicy
+
+	quotaLimit int
+	quotaKey   func(context.Context) string
 }
 
 // WithName sets the pool name for observability and error reporting
@@ -116,6 +216,24 @@ func WithDrainTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithTaskTimeout limits how long each task may run, from when a worker
+// starts it. A task still running when its timeout expires has its context
+// canceled with cause ErrTaskTimeout and is counted as failed, whatever it
+// returns. SubmitWithTimeout overrides
+// it per task. Zero, the default, means no timeout.
+func WithTaskTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.taskTimeout = timeout
+	}
+}
+
+// WithClock sets a custom clock implementation (useful for testing)
+func WithClock(clk clock.Clock) Option {
+	return func(c *config) {
+		c.clock = clk
+	}
+}
+
 // WithLogger sets the logger for observability
 func WithLogger(logger observe.Logger) Option {
 	return func(c *config) {
@@ -145,11 +263,83 @@ func WithPanicRecovery(handler func(any)) Option {
 	}
 }
 
-// WithTaskWrapper sets a function to wrap tasks for instrumentation.
-// The wrapper is applied to every submitted task.
+// WithPanicErrors captures the stack of tasks that panic and handles a
+// panic as a failure: the task fails with a *PanicError carrying the
+// recovered value and the stack, so it is counted as failed as well as
+// panicked, retried under WithRetry and passed to the dead letter handler.
+// Futures, Results streams and task groups report the same error. Without
+// a WithPanicRecovery handler, the stack is also logged with the panic.
+func WithPanicErrors() Option {
+	return func(c *config) {
+		c.panicErrors = true
+	}
+}
+
+// panicError returns the error of a task that panicked with r. It is called
+// by the deferred function that recovered r, while the stack still shows
+// the panic.
+func (p *Pool) panicError(r any) *PanicError {
+	err := &PanicError{Value: r}
+	if p.panicErrors {
+		err.Stack = debug.Stack()
+	}
+	return err
+}
+
+// WithTaskWrapper adds a function to wrap tasks for instrumentation.
+// The wrapper is applied to every submitted task. It is equivalent to
+// WithMiddleware(wrapper).
 func WithTaskWrapper(wrapper func(Task) Task) Option {
+	return WithMiddleware(wrapper)
+}
+
+// WithEDF enables earliest-deadline-first scheduling. Queued tasks are run
+// in order of their deadline rather than submission order: the deadline of
+// the Submit context, or the one given to SubmitWithDeadline. Tasks without a
+// deadline run after every task with one, in submission order. In EDF mode a
+// queueSize of 0 holds a single task.
+func WithEDF() Option {
+	return func(c *config) {
+		c.edf = true
+	}
+}
+
+// WithPriority enables priority scheduling. Queued tasks run in order of
+// the priority given to SubmitWithPriority, highest first, other tasks
+// having priority 0. Every aging interval a task waits raises its priority
+// by one, so bulk work still runs under a sustained stream of urgent tasks;
+// zero disables aging. Combined with WithEDF, tasks of equal priority run
+// earliest deadline first. In priority mode a queueSize of 0 holds a single
+// task.
+func WithPriority(aging time.Duration) Option {
+	return func(c *config) {
+		c.priority = true
+		c.priorityAging = aging
+	}
+}
+
+// WithWorkStealing splits the queue into one shard per worker to cut the
+// contention of submitters and workers on a single queue at very high
+// submission rates. Submissions are spread over the shards and a worker
+// whose shard is empty steals from the others. Submit and TrySubmit behave
+// as without it, but tasks may start out of submission order, and a
+// queueSize of 0 holds a single task. It has no effect in EDF or priority
+// mode, which keep a single ordered queue.
+func WithWorkStealing() Option {
 	return func(c *config) {
-		c.taskWrapper = wrapper
+		c.workStealing = true
+	}
+}
+
+// WithInline makes the pool run every task on the submitting goroutine
+// before Submit returns, with no workers and no queue, so tests of code
+// using a pool are deterministic; see the workerpooltest package. Retries
+// run on the goroutine that waited for their backoff. Tasks get worker ID
+// -1 and no WorkerState, and the size, the queue size, autoscaling,
+// scheduling and overflow options are ignored.
+func WithInline() Option {
+	return func(c *config) {
+		c.inline = true
 	}
 }
 
@@ -168,6 +358,7 @@ func New(size, queueSize int, opts ...Option) *Pool {
 		name:         "",
 		baseCtx:      context.Background(),
 		drainTimeout: 30 * time.Second,
+		clock:        clock.Real(),
 		obs:          observe.New(),
 	}
 
@@ -175,64 +366,190 @@ func New(size, queueSize int, opts ...Option) *Pool {
 		opt(cfg)
 	}
 
+	if cfg.inline {
+		size, queueSize = 0, 0
+		cfg.edf, cfg.priority, cfg.workStealing, cfg.autoscale = false, false, false, nil
+	}
+
+	if cfg.autoscale != nil {
+		cfg.autoscale.normalize()
+		size = min(max(size, cfg.autoscale.min), cfg.autoscale.max)
+	}
+
 	ctx, cancel := context.WithCancel(cfg.baseCtx)
+	stopCtx, stop := context.WithCancel(context.Background())
 
 	p := &Pool{
-		name:         cfg.name,
-		size:         size,
-		queueSize:    queueSize,
-		drainTimeout: cfg.drainTimeout,
-		obs:          cfg.obs,
-		baseCtx:      ctx,
-		cancel:       cancel,
-		closed:       make(chan struct{}),
-		taskCh:       make(chan taskSubmission, queueSize),
-		panicHandler: cfg.panicHandler,
-		taskWrapper:  cfg.taskWrapper,
-		metrics: PoolMetrics{
-			Size: size,
-		},
+		name:          cfg.name,
+		size:          size,
+		queueSize:     queueSize,
+		drainTimeout:  cfg.drainTimeout,
+		taskTimeout:   cfg.taskTimeout,
+		clock:         cfg.clock,
+		obs:           cfg.obs,
+		baseCtx:       ctx,
+		cancel:        cancel,
+		closed:        make(chan struct{}),
+		stopped:       stopCtx.Done(),
+		stopCtx:       stopCtx,
+		stop:          stop,
+		taskCh:        make(chan taskSubmission, queueSize),
+		edf:           cfg.edf,
+		priority:      cfg.priority,
+		inline:        cfg.inline,
+		panicHandler:  cfg.panicHandler,
+		panicErrors:   cfg.panicErrors,
+		retryAttempts: cfg.retryAttempts,
+		retryBackoff:  cfg.retryBackoff,
+		deadLetter:    cfg.deadLetter,
+		hooks:         cfg.hooks,
+		workerInit:    cfg.workerInit,
+		workerCleanup: cfg.workerCleanup,
+		overflow:      cfg.overflow,
+	}
+	if p.retryBackoff == nil {
+		p.retryBackoff = defaultRetryBackoff
+	}
+
+	p.idle = sync.NewCond(&p.idleMu)
+	p.metricCond = sync.NewCond(&p.metricMu)
+	p.detail = newDetailTracker(p.clock)
+	p.taskLog = ratelimit.NewThrottledLogger(p.obs.Logger, logThrottleRate, 1,
+		ratelimit.WithClock(p.clock))
+
+	if len(cfg.middleware) > 0 {
+		p.taskWrapper = Chain(cfg.middleware...)
+	}
+
+	if cfg.edf || cfg.priority {
+		p.queue = newTaskQueue(queueSize, cfg, p.clock.Now())
+	} else if cfg.workStealing {
+		p.shards = newShardedQueue(size, queueSize)
+	}
+
+	if cfg.quotaLimit > 0 && cfg.quotaKey != nil {
+		p.quotas = newQuotas(cfg.quotaLimit, cfg.quotaKey)
+	}
+
+	if cfg.autoscale != nil {
+		p.scaler = newAutoscaler(p, *cfg.autoscale)
+		p.retire = p.scaler.retire
 	}
 
 	// Start workers
-	p.workerWg.Add(size)
-	for i := 0; i < size; i++ {
-		go p.worker(i)
+	p.workers.Store(int64(size))
+	p.startWorkers(size)
+	if p.scaler != nil {
+		p.workerWg.Add(1)
+		go p.scaler.run()
 	}
 
 	p.obs.Logger.Info("workerpool started",
 		"name", p.name,
 		"size", size,
 		"queue_size", queueSize,
+		"edf", cfg.edf,
+		"priority", cfg.priority,
+		"work_stealing", p.shards != nil,
+		"overflow", cfg.overflow.String(),
+		"autoscale", cfg.autoscale != nil,
+		"inline", cfg.inline,
 	)
 
 	return p
 }
 
+// startWorkers starts n more workers.
+func (p *Pool) startWorkers(n int) {
+	p.workerWg.Add(n)
+	for i := 0; i < n; i++ {
+		go p.worker(int(p.nextWorker.Add(1) - 1))
+	}
+}
+
 // worker runs the main worker loop
 func (p *Pool) worker(id int) {
 	defer p.workerWg.Done()
 
+	var state any
+	if p.workerInit != nil {
+		var ok bool
+		if state, ok = p.initWorker(id); !ok {
+			return
+		}
+	}
+	if p.workerCleanup != nil {
+		defer p.workerCleanup(id, state)
+	}
+
 	p.obs.Logger.Debug("worker started", "worker_id", id, "pool", p.name)
 
 	for {
-		select {
-		case submission := <-p.taskCh:
-			atomic.AddInt64(&p.metrics.Queued, -1)
-			p.executeTask(submission, id)
-
-		case <-p.baseCtx.Done():
-			p.obs.Logger.Debug("worker stopping due to context cancellation",
+		submission, ok := p.next(id)
+		if !ok {
+			p.obs.Logger.Debug("worker stopping",
 				"worker_id", id, "pool", p.name)
 			return
 		}
+		if p.scaler != nil {
+			p.scaler.observeWait(p.clock.Since(submission.enqueued))
+		}
+		p.executeTask(submission, id, state)
+	}
+}
+
+// next waits for the next queued submission for the worker with the given
+// ID. It returns false once the pool context is canceled or the worker is
+// retired by the autoscaler.
+func (p *Pool) next(id int) (taskSubmission, bool) {
+	if p.shards != nil {
+		return p.shards.pop(id, p.baseCtx.Done(), p.retire)
+	}
+	if p.queue != nil {
+		submission, ok := p.queue.pop(p.baseCtx.Done(), p.retire)
+		if ok && p.priority {
+			p.dequeued(submission)
+		}
+		return submission, ok
+	}
+
+	select {
+	case submission, ok := <-p.taskCh:
+		// Close closes taskCh as it cancels the pool context
+		return submission, ok
+	case <-p.baseCtx.Done():
+		return taskSubmission{}, false
+	case <-p.retire:
+		return taskSubmission{}, false
 	}
 }
 
 // executeTask executes a single task with proper error handling and metrics
-func (p *Pool) executeTask(submission taskSubmission, workerID int) {
+func (p *Pool) executeTask(submission taskSubmission, workerID int, state any) {
+	retried := false
+	defer func() {
+		if !retried {
+			p.releaseQuota(submission)
+			p.end()
+		}
+	}()
+
+	if !submission.deadline.IsZero() {
+		if now := p.clock.Now(); !now.Before(submission.deadline) {
+			err := p.missDeadline(submission, "execute", now.Sub(submission.deadline))
+			p.onFinish(submission, TaskEvent{Err: err})
+			return
+		}
+	}
+
 	atomic.AddInt64(&p.metrics.Running, 1)
-	defer atomic.AddInt64(&p.metrics.Running, -1)
+	p.recordUtilization()
+	p.metricsChanged()
+	defer func() {
+		atomic.AddInt64(&p.metrics.Running, -1)
+		p.recordUtilization()
+		p.metricsChanged()
+	}()
 
 	// Create task context that cancels when either submission context or pool context is done
 	// Handle case where submission context might be nil
@@ -240,17 +557,42 @@ func (p *Pool) executeTask(submission taskSubmission, workerID int) {
 	if submissionCtx == nil {
 		submissionCtx = context.Background()
 	}
-	taskCtx, taskCancel := context.WithCancel(submissionCtx)
-	defer taskCancel()
+	if p.workerInit != nil && workerID != callerWorker {
+		submissionCtx = context.WithValue(submissionCtx, workerStateKey{}, workerState{state})
+	}
+	if p.taskWrapper != nil {
+		// Middlewares such as Retry wait on the pool clock
+		submissionCtx = context.WithValue(submissionCtx, clockKey{}, p.clock)
+	}
+	taskCtx, taskCancel := context.WithCancelCause(submissionCtx)
+	defer taskCancel(nil)
 
-	// Monitor for pool context cancellation
-	go func() {
-		select {
-		case <-p.baseCtx.Done():
-			taskCancel()
-		case <-taskCtx.Done():
-		}
-	}()
+	timeout := submission.timeout
+	if timeout <= 0 {
+		timeout = p.taskTimeout
+	}
+	// settled is set by whichever comes first of the timeout and the task
+	// returning, so a timeout firing as the task returns cannot replace its
+	// result
+	var settled atomic.Bool
+	var timer clock.Timer
+	if timeout > 0 {
+		timer = p.clock.AfterFunc(timeout, func() {
+			if settled.CompareAndSwap(false, true) {
+				taskCancel(ErrTaskTimeout)
+			}
+		})
+	}
+
+	obs := p.obs.WithContext(submissionCtx)
+	taskLog := observe.CorrelatedLogger(submissionCtx, p.taskLog)
+
+	// Cancel the task with the pool context. The callback is registered on
+	// the pool context, without a goroutine per task
+	stop := context.AfterFunc(p.baseCtx, func() {
+		taskCancel(context.Cause(p.baseCtx))
+	})
+	defer stop()
 
 	task := submission.task
 	if p.taskWrapper != nil {
@@ -258,53 +600,118 @@ func (p *Pool) executeTask(submission taskSubmission, workerID int) {
 	}
 
 	// Record metrics
-	p.obs.Metrics.Inc("ion_workerpool_tasks_started_total",
+	obs.Metrics.Inc("ion_workerpool_tasks_started_total",
 		"pool_name", p.name, "worker_id", workerID)
 
+	wait := p.clock.Since(submission.enqueued)
+	p.recordWait(wait)
+	p.onStart(submission, workerID, wait)
+	start := p.clock.Now()
+
 	// Execute with panic recovery
 	var err error
+	var panicErr *PanicError
 	func() {
 		defer func() {
 			if r := recover(); r != nil {
+				panicErr = p.panicError(r)
 				atomic.AddUint64(&p.metrics.Panicked, 1)
-				p.obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
+				obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
 					"pool_name", p.name, "status", "panic")
 
 				if p.panicHandler != nil {
 					p.panicHandler(r)
 				} else {
-					p.obs.Logger.Error("task panicked",
-						fmt.Errorf("panic: %v", r),
-						"pool", p.name, "worker_id", workerID)
+					kv := []any{"pool", p.name, "worker_id", workerID}
+					if panicErr.Stack != nil {
+						kv = append(kv, "stack", string(panicErr.Stack))
+					}
+					taskLog.Error("task panicked", fmt.Errorf("panic: %v", r), kv...)
 				}
 			}
 		}()
 
 		err = task(taskCtx)
 	}()
-
-	// Update completion metrics
-	if err != nil {
-		atomic.AddUint64(&p.metrics.Failed, 1)
-		p.obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
+	timedOut := !settled.CompareAndSwap(false, true)
+	if timer != nil {
+		timer.Stop()
+	}
+	duration := p.clock.Since(start)
+	p.recordExecution(duration)
+
+	// Update completion metrics. A task that panicked was counted as such
+	if timedOut && panicErr == nil {
+		err = ErrTaskTimeout
+		obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
+			"pool_name", p.name, "status", "timeout")
+		taskLog.Warn("task timed out",
+			"pool", p.name, "worker_id", workerID, "timeout", timeout)
+	} else if err != nil {
+		obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
 			"pool_name", p.name, "status", "error")
-		p.obs.Logger.Error("task failed", err,
+		taskLog.Error("task failed", err,
 			"pool", p.name, "worker_id", workerID)
+	}
+
+	finish := TaskEvent{
+		Worker:   workerID,
+		Wait:     wait,
+		Duration: duration,
+		Err:      err,
+	}
+	if panicErr != nil {
+		finish.Err = panicErr
+		if p.panicErrors {
+			err = panicErr
+		}
+	}
+	if err != nil {
+		finish.Retry = p.canRetry(submission)
+	}
+	p.onFinish(submission, finish)
+
+	if err != nil {
+		if retried = finish.Retry; retried {
+			p.retry(submission, err)
+		} else {
+			p.fail(submission, err)
+		}
 	} else {
 		atomic.AddUint64(&p.metrics.Completed, 1)
-		p.obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
+		obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
 			"pool_name", p.name, "status", "success")
 	}
 }
 
+// missDeadline fails a submission whose deadline has passed without running
+// it.
+func (p *Pool) missDeadline(submission taskSubmission, op string, late time.Duration) error {
+	err := NewDeadlineMissedError(p.name, op, late)
+
+	p.fail(submission, err)
+	p.obs.Metrics.Inc("ion_workerpool_tasks_completed_total",
+		"pool_name", p.name, "status", "deadline_missed")
+	p.taskLog.Warn("task deadline missed",
+		"pool", p.name, "op", op, "late", late)
+
+	if submission.onMiss != nil {
+		submission.onMiss(err)
+	}
+	return err
+}
+
 // Metrics returns a snapshot of the current pool metrics
 func (p *Pool) Metrics() PoolMetrics {
 	return PoolMetrics{
-		Size:      p.metrics.Size,
-		Queued:    atomic.LoadInt64(&p.metrics.Queued),
+		Size:      int(p.workers.Load()),
+		Queued:    int64(p.queueLen()),
 		Running:   atomic.LoadInt64(&p.metrics.Running),
 		Completed: atomic.LoadUint64(&p.metrics.Completed),
 		Failed:    atomic.LoadUint64(&p.metrics.Failed),
 		Panicked:  atomic.LoadUint64(&p.metrics.Panicked),
+
+		Retried:      atomic.LoadUint64(&p.metrics.Retried),
+		DeadLettered: atomic.LoadUint64(&p.metrics.DeadLettered),
 	}
 }
@@ -3,12 +3,21 @@ package workerpool_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"os/signal"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/clock"
+	"github.com/kolosys/ion/observe"
+	"github.com/kolosys/ion/sim"
 	"github.com/kolosys/ion/workerpool"
 )
 
@@ -59,6 +68,85 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestPresets(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+
+	t.Run("io bound", func(t *testing.T) {
+		pool := workerpool.NewIOBound(0, workerpool.WithName("io"))
+		defer pool.Close(context.Background())
+
+		if pool.GetSize() != 8*procs {
+			t.Errorf("expected size %d, got %d", 8*procs, pool.GetSize())
+		}
+		if pool.GetQueueSize() != 4*pool.GetSize() {
+			t.Errorf("expected default queue size %d, got %d", 4*pool.GetSize(), pool.GetQueueSize())
+		}
+		if pool.GetName() != "io" {
+			t.Errorf("expected options to apply, got name %q", pool.GetName())
+		}
+		if got := pool.GetOverflowPolicy(); got != workerpool.OverflowReject {
+			t.Errorf("expected the reject overflow policy, got %v", got)
+		}
+	})
+
+	t.Run("io bound with queue size", func(t *testing.T) {
+		pool := workerpool.NewIOBound(100)
+		defer pool.Close(context.Background())
+
+		if pool.GetQueueSize() != 100 {
+			t.Errorf("expected queue size 100, got %d", pool.GetQueueSize())
+		}
+	})
+
+	t.Run("cpu bound", func(t *testing.T) {
+		pool := workerpool.NewCPUBound()
+		defer pool.Close(context.Background())
+
+		if pool.GetSize() != procs {
+			t.Errorf("expected size %d, got %d", procs, pool.GetSize())
+		}
+		if pool.GetQueueSize() != 2*procs {
+			t.Errorf("expected queue size %d, got %d", 2*procs, pool.GetQueueSize())
+		}
+		if got := pool.GetOverflowPolicy(); got != workerpool.OverflowBlock {
+			t.Errorf("expected the block overflow policy, got %v", got)
+		}
+	})
+
+	t.Run("options override the overflow policy", func(t *testing.T) {
+		pool := workerpool.NewCPUBound(workerpool.WithOverflowPolicy(workerpool.OverflowCallerRuns))
+		defer pool.Close(context.Background())
+
+		if got := pool.GetOverflowPolicy(); got != workerpool.OverflowCallerRuns {
+			t.Errorf("expected the caller runs overflow policy, got %v", got)
+		}
+	})
+
+	t.Run("io bound submissions fail fast when saturated", func(t *testing.T) {
+		pool := workerpool.NewIOBound(1)
+		defer pool.Close(context.Background())
+
+		block := make(chan struct{})
+		defer close(block)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		// Workers and queue fill up until a submission is turned away
+		var err error
+		for range pool.GetSize() + 2 {
+			if err = pool.Submit(ctx, func(ctx context.Context) error {
+				<-block
+				return nil
+			}); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, workerpool.ErrQueueFull) {
+			t.Errorf("expected Submit to fail with a full queue, got %v", err)
+		}
+	})
+}
+
 func TestSubmit(t *testing.T) {
 	t.Run("successful submission", func(t *testing.T) {
 		pool := workerpool.New(2, 5, workerpool.WithName("test-pool"))
@@ -205,10 +293,333 @@ func TestTrySubmit(t *testing.T) {
 		if !errors.As(err3, &poolErr) {
 			t.Errorf("expected PoolError, got %T", err3)
 		}
+		if !errors.Is(err3, workerpool.ErrQueueFull) {
+			t.Errorf("expected ErrQueueFull, got %v", err3)
+		}
 
 		// Unblock the first task to allow cleanup
 		close(block)
 	})
+
+	t.Run("with timeout", func(t *testing.T) {
+		for _, edf := range []bool{false, true} {
+			clk := clock.NewFake(time.Unix(0, 0))
+			opts := []workerpool.Option{workerpool.WithClock(clk)}
+			if edf {
+				opts = append(opts, workerpool.WithEDF())
+			}
+			pool := workerpool.New(1, 1, opts...)
+			release := blockWorker(t, pool)
+
+			quickTask := func(ctx context.Context) error { return nil }
+			if err := pool.TrySubmitTimeout(quickTask, time.Second); err != nil {
+				t.Fatalf("expected room in the queue, got %v", err)
+			}
+
+			// The queue stays full for the whole wait
+			errs := make(chan error, 1)
+			go func() { errs <- pool.TrySubmitTimeout(quickTask, time.Second) }()
+			clk.BlockUntil(1)
+			clk.Advance(time.Second)
+			err := <-errs
+			if !errors.Is(err, workerpool.ErrQueueFull) || errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected ErrQueueFull, got %v", err)
+			}
+
+			// Room is made during the wait
+			go func() { errs <- pool.TrySubmitTimeout(quickTask, time.Second) }()
+			clk.BlockUntil(1)
+			release()
+			if err := <-errs; err != nil {
+				t.Errorf("expected the task to be queued, got %v", err)
+			}
+
+			pool.Close(context.Background())
+		}
+	})
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+
+	t.Run("reject", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithOverflowPolicy(workerpool.OverflowReject))
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+		defer release()
+		if err := pool.Submit(context.Background(), noop); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := pool.Submit(context.Background(), noop); !errors.Is(err, workerpool.ErrQueueFull) {
+			t.Errorf("expected Submit to fail with ErrQueueFull, got %v", err)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithOverflowPolicy(workerpool.OverflowBlock))
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+		if err := pool.TrySubmit(noop); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- pool.TrySubmit(noop) }()
+		select {
+		case err := <-done:
+			t.Fatalf("expected TrySubmit to wait for room, got %v", err)
+		default:
+		}
+
+		release()
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	modes := []struct {
+		name string
+		opts []workerpool.Option
+	}{
+		{"channel", nil},
+		{"priority", []workerpool.Option{workerpool.WithPriority(0)}},
+		{"work stealing", []workerpool.Option{workerpool.WithWorkStealing()}},
+	}
+	for _, mode := range modes {
+		t.Run("drop oldest "+mode.name, func(t *testing.T) {
+			dead := make(chan error, 1)
+			opts := append([]workerpool.Option{
+				workerpool.WithOverflowPolicy(workerpool.OverflowDropOldest),
+				workerpool.WithDeadLetter(func(task workerpool.Task, err error) { dead <- err }),
+			}, mode.opts...)
+			pool := workerpool.New(1, 2, opts...)
+			defer pool.Close(context.Background())
+
+			var mu sync.Mutex
+			var ran []string
+			task := func(name string) workerpool.Task {
+				return func(ctx context.Context) error {
+					mu.Lock()
+					ran = append(ran, name)
+					mu.Unlock()
+					return nil
+				}
+			}
+
+			release := blockWorker(t, pool)
+			for _, name := range []string{"a", "b", "c"} {
+				if err := pool.Submit(context.Background(), task(name)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if err := <-dead; !errors.Is(err, workerpool.ErrTaskDropped) {
+				t.Errorf("expected the oldest task dropped, got %v", err)
+			}
+
+			release()
+			pool.Drain(context.Background())
+			if want := []string{"b", "c"}; !slices.Equal(ran, want) {
+				t.Errorf("expected %v to run, got %v", want, ran)
+			}
+			if m := pool.Metrics(); m.Failed != 1 || m.Completed != 3 {
+				t.Errorf("expected 1 failed and 3 completed tasks, got %+v", m)
+			}
+		})
+	}
+
+	t.Run("drop oldest resolves futures", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithOverflowPolicy(workerpool.OverflowDropOldest))
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+		defer release()
+		dropped := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		pool.Submit(context.Background(), noop)
+
+		if _, err := dropped.Wait(context.Background()); !errors.Is(err, workerpool.ErrTaskDropped) {
+			t.Errorf("expected ErrTaskDropped, got %v", err)
+		}
+	})
+
+	t.Run("drop oldest without a queue", func(t *testing.T) {
+		pool := workerpool.New(1, 0, workerpool.WithOverflowPolicy(workerpool.OverflowDropOldest))
+		defer pool.Close(context.Background())
+
+		// Without a queue, a submission only succeeds once the worker waits
+		release := make(chan struct{})
+		defer close(release)
+		blocker := func(ctx context.Context) error {
+			<-release
+			return nil
+		}
+		for pool.Submit(context.Background(), blocker) != nil {
+			runtime.Gosched()
+		}
+
+		if err := pool.TrySubmit(noop); !errors.Is(err, workerpool.ErrQueueFull) {
+			t.Errorf("expected ErrQueueFull, got %v", err)
+		}
+	})
+
+	t.Run("caller runs", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithOverflowPolicy(workerpool.OverflowCallerRuns))
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+		defer release()
+		if err := pool.Submit(context.Background(), noop); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, submit := range []func(workerpool.Task) error{
+			func(task workerpool.Task) error { return pool.Submit(context.Background(), task) },
+			pool.TrySubmit,
+		} {
+			var ran bool
+			err := submit(func(ctx context.Context) error {
+				ran = true
+				return errors.New("boom")
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !ran {
+				t.Error("expected the task to run before the submission returned")
+			}
+		}
+		if m := pool.Metrics(); m.Failed != 2 {
+			t.Errorf("expected the failures to be counted, got %+v", m)
+		}
+	})
+}
+
+func TestQuota(t *testing.T) {
+	tenant := func(ctx context.Context) string {
+		info, _ := workerpool.TaskInfoFromContext(ctx)
+		return info.Name
+	}
+	ctxFor := func(name string) context.Context {
+		return workerpool.ContextWithTaskInfo(context.Background(), workerpool.TaskInfo{Name: name})
+	}
+	noop := func(ctx context.Context) (int, error) { return 0, nil }
+	// submitEventually submits until the quota of a finished task is freed,
+	// just after its result is reported
+	submitEventually := func(t *testing.T, pool *workerpool.Pool, name string) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for pool.Submit(ctxFor(name), func(ctx context.Context) error { return nil }) != nil {
+			select {
+			case <-timeout:
+				t.Fatalf("expected the quota of %s to be freed", name)
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	t.Run("caps each submitter", func(t *testing.T) {
+		rec := sim.NewRecorder()
+		pool := workerpool.New(1, 10, workerpool.WithName("quota"),
+			workerpool.WithQuota(2, tenant), workerpool.WithMetrics(rec))
+		defer pool.Close(context.Background())
+
+		// Submissions without a key have no quota
+		release := blockWorker(t, pool)
+		first := workerpool.SubmitFunc(pool, ctxFor("noisy"), noop)
+		second := workerpool.SubmitFunc(pool, ctxFor("noisy"), noop)
+
+		err := pool.Submit(ctxFor("noisy"), func(ctx context.Context) error { return nil })
+		if !errors.Is(err, workerpool.ErrQuotaExceeded) {
+			t.Fatalf("expected the quota to be exceeded, got %v", err)
+		}
+		var poolErr *workerpool.PoolError
+		if !errors.As(err, &poolErr) || poolErr.PoolName != "quota" {
+			t.Errorf("expected a typed pool error, got %v", err)
+		}
+		if err := pool.Submit(ctxFor("quiet"), func(ctx context.Context) error { return nil }); err != nil {
+			t.Errorf("expected other submitters to be unaffected, got %v", err)
+		}
+		if n := rec.Count("ion_workerpool_tasks_rejected_total", "reason", "quota_exceeded"); n != 1 {
+			t.Errorf("expected 1 rejection, got %v", n)
+		}
+
+		release()
+		first.Wait(context.Background())
+		second.Wait(context.Background())
+		submitEventually(t, pool, "noisy")
+	})
+
+	t.Run("held while waiting to be retried", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 10, workerpool.WithClock(clk),
+			workerpool.WithQuota(1, tenant),
+			workerpool.WithRetry(2, backoff.Constant(time.Second)))
+		defer pool.Close(context.Background())
+
+		failed := make(chan struct{}, 2)
+		fail := func(ctx context.Context) error {
+			failed <- struct{}{}
+			return errors.New("boom")
+		}
+		if err := pool.Submit(ctxFor("a"), fail); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		<-failed
+
+		err := pool.Submit(ctxFor("a"), func(ctx context.Context) error { return nil })
+		if !errors.Is(err, workerpool.ErrQuotaExceeded) {
+			t.Errorf("expected the retrying task to hold the quota, got %v", err)
+		}
+
+		for len(failed) == 0 {
+			clk.Advance(time.Second)
+			time.Sleep(time.Millisecond)
+		}
+		submitEventually(t, pool, "a")
+	})
+
+	t.Run("drain waits for a submitter checking its quota", func(t *testing.T) {
+		checking := make(chan struct{})
+		release := make(chan struct{})
+		pool := workerpool.New(1, 10, workerpool.WithQuota(1, func(ctx context.Context) string {
+			close(checking)
+			<-release
+			return "a"
+		}))
+		defer pool.Close(context.Background())
+
+		var ran atomic.Bool
+		submitted := make(chan error, 1)
+		go func() {
+			submitted <- pool.Submit(context.Background(), func(ctx context.Context) error {
+				ran.Store(true)
+				return nil
+			})
+		}()
+		<-checking
+
+		// The pool is not idle while the submission is under way
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := pool.Drain(canceled); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the drain to wait for the submission, got %v", err)
+		}
+
+		close(release)
+		if err := <-submitted; err != nil {
+			t.Fatalf("expected the submission to be accepted, got %v", err)
+		}
+		if err := pool.Drain(context.Background()); err != nil {
+			t.Fatalf("unexpected drain error: %v", err)
+		}
+		if !ran.Load() {
+			t.Error("expected the task to run before the drain returned")
+		}
+	})
 }
 
 func TestPoolLifecycle(t *testing.T) {
@@ -282,6 +693,133 @@ func TestPoolLifecycle(t *testing.T) {
 			t.Error("drain returned too quickly, should have waited for all tasks")
 		}
 	})
+	t.Run("close joins timeout and abandoned tasks", func(t *testing.T) {
+		pool := workerpool.New(1, 2, workerpool.WithName("joined"))
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		block := func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}
+		_ = pool.Submit(context.Background(), block)
+		<-started
+		_ = pool.Submit(context.Background(), func(ctx context.Context) error { return nil })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := pool.Close(ctx)
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the timeout in %v", err)
+		}
+		if !errors.Is(err, workerpool.ErrTasksAbandoned) {
+			t.Errorf("expected abandoned tasks in %v", err)
+		}
+		var poolErr *workerpool.PoolError
+		if !errors.As(err, &poolErr) || poolErr.PoolName != "joined" {
+			t.Errorf("expected typed pool errors, got %v", err)
+		}
+	})
+
+	t.Run("drain can be retried after a timeout", func(t *testing.T) {
+		pool := workerpool.New(1, 2)
+		release := blockWorker(t, pool)
+		var ran atomic.Bool
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			ran.Store(true)
+			return nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := pool.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a drain timeout, got %v", err)
+		}
+		if state := pool.State(); state != workerpool.StateDraining {
+			t.Errorf("expected the pool to keep draining, got %v", state)
+		}
+		err := pool.Submit(context.Background(), func(ctx context.Context) error { return nil })
+		if !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("expected submissions to fail while draining, got %v", err)
+		}
+
+		release()
+		if err := pool.Drain(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ran.Load() {
+			t.Error("expected the queued task to run")
+		}
+		if state := pool.State(); state != workerpool.StateClosed {
+			t.Errorf("expected the pool to be closed, got %v", state)
+		}
+	})
+
+	t.Run("repeated calls return closed errors", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		if state := pool.State(); state != workerpool.StateRunning {
+			t.Errorf("expected a running pool, got %v", state)
+		}
+		if err := pool.Drain(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err := pool.Drain(context.Background())
+		var poolErr *workerpool.PoolError
+		if !errors.Is(err, workerpool.ErrPoolClosed) || !errors.As(err, &poolErr) || poolErr.Op != "drain" {
+			t.Errorf("expected a closed error from drain, got %v", err)
+		}
+		if err := pool.Close(context.Background()); !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("expected a closed error from close, got %v", err)
+		}
+	})
+
+	t.Run("close can be retried after a timeout", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		release := blockWorker(t, pool)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := pool.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a close timeout, got %v", err)
+		}
+
+		release()
+		if err := pool.Close(context.Background()); err != nil {
+			t.Fatalf("expected the retry to wait for the running task, got %v", err)
+		}
+		if err := pool.Close(context.Background()); !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("expected a closed error, got %v", err)
+		}
+	})
+
+	t.Run("close interrupts a drain", func(t *testing.T) {
+		pool := workerpool.New(1, 2)
+		release := blockWorker(t, pool)
+		defer release()
+		pool.Submit(context.Background(), func(ctx context.Context) error { return nil })
+
+		done := make(chan error, 1)
+		go func() { done <- pool.Drain(context.Background()) }()
+		for !pool.IsDraining() {
+			time.Sleep(time.Millisecond)
+		}
+
+		closeCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		pool.Close(closeCtx)
+		select {
+		case err := <-done:
+			if !errors.Is(err, workerpool.ErrPoolClosed) {
+				t.Errorf("expected a closed error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("drain did not return after close")
+		}
+	})
 }
 
 func TestMetrics(t *testing.T) {
@@ -323,50 +861,186 @@ func TestMetrics(t *testing.T) {
 	}
 }
 
-func TestTaskPanicRecovery(t *testing.T) {
-	var panicValue any
-	var panicMutex sync.Mutex
-	var panicReceived bool
+func TestQueuedMetric(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		queueSize int
+		opts      []workerpool.Option
+	}{
+		{name: "direct handoff", queueSize: 0},
+		{name: "channel", queueSize: 2},
+		{name: "edf", queueSize: 2, opts: []workerpool.Option{workerpool.WithEDF()}},
+		{name: "work stealing", queueSize: 2, opts: []workerpool.Option{workerpool.WithWorkStealing()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := workerpool.New(1, tt.queueSize, tt.opts...)
+			defer pool.Close(context.Background())
+			release := blockWorker(t, pool)
 
-	pool := workerpool.New(1, 1, workerpool.WithPanicRecovery(func(r any) {
-		panicMutex.Lock()
-		panicValue = r
-		panicReceived = true
-		panicMutex.Unlock()
-	}))
-	defer pool.Close(context.Background())
+			quickTask := func(ctx context.Context) error { return nil }
+			for i := 0; i < tt.queueSize; i++ {
+				if err := pool.TrySubmit(quickTask); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			// A submission blocked on a full queue is not queued yet
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			pool.Submit(ctx, quickTask)
 
-	task := func(ctx context.Context) error {
-		panic("test panic")
-	}
+			if m := pool.Metrics(); m.Queued != int64(tt.queueSize) || m.Running != 1 {
+				t.Errorf("expected %d queued and 1 running, got %+v", tt.queueSize, m)
+			}
 
-	err := pool.Submit(context.Background(), task)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+			release()
+			if err := pool.Drain(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m := pool.Metrics(); m.Queued != 0 || m.Running != 0 || m.Completed != uint64(tt.queueSize)+1 {
+				t.Errorf("expected every task to complete, got %+v", m)
+			}
+		})
 	}
+}
 
-	// Wait for panic recovery with proper synchronization
-	timeout := time.After(5 * time.Second)
-	ticker := time.NewTicker(10 * time.Millisecond)
-	defer ticker.Stop()
+func TestWaitMetrics(t *testing.T) {
+	t.Run("wakes on every update", func(t *testing.T) {
+		pool := workerpool.New(1, 4)
+		defer pool.Close(context.Background())
+		release := blockWorker(t, pool)
+
+		done := make(chan workerpool.PoolMetrics)
+		go func() {
+			m, _ := pool.WaitMetrics(context.Background(), func(m workerpool.PoolMetrics) bool {
+				return m.Completed == 3 && m.Running == 0
+			})
+			done <- m
+		}()
+
+		for i := 0; i < 2; i++ {
+			pool.Submit(context.Background(), func(ctx context.Context) error { return nil })
+		}
+		release()
 
-	for {
-		select {
-		case <-timeout:
-			t.Fatal("timeout waiting for panic recovery")
-		case <-ticker.C:
-			panicMutex.Lock()
-			if panicReceived {
-				expected := "test panic"
-				if panicValue != expected {
-					t.Errorf("expected panic value %q, got %v", expected, panicValue)
-				}
-				panicMutex.Unlock()
-				goto checkMetrics
-			}
-			panicMutex.Unlock()
+		if m := <-done; m.Completed != 3 || m.Queued != 0 {
+			t.Errorf("expected 3 completed tasks, got %+v", m)
 		}
-	}
+	})
+
+	t.Run("returns at once if satisfied", func(t *testing.T) {
+		pool := workerpool.New(2, 0)
+		defer pool.Close(context.Background())
+
+		m, err := pool.WaitMetrics(context.Background(), func(m workerpool.PoolMetrics) bool { return m.Size == 2 })
+		if err != nil || m.Size != 2 {
+			t.Errorf("expected size 2, got %+v, %v", m, err)
+		}
+	})
+
+	t.Run("honors the context", func(t *testing.T) {
+		pool := workerpool.New(1, 0)
+		defer pool.Close(context.Background())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := pool.WaitMetrics(ctx, func(m workerpool.PoolMetrics) bool { return m.Completed > 0 }); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestDetailedMetrics(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	rec := sim.NewRecorder()
+	pool := workerpool.New(1, 4, workerpool.WithClock(clk), workerpool.WithMetrics(rec))
+	defer pool.Close(context.Background())
+
+	release := blockWorker(t, pool)
+	for i := 0; i < 3; i++ {
+		pool.Submit(context.Background(), func(ctx context.Context) error { return nil })
+	}
+
+	m := pool.DetailedMetrics()
+	if m.Utilization != 100 || m.QueueHighWater != 3 || m.Queued != 3 {
+		t.Errorf("expected full utilization and 3 queued, got %+v", m)
+	}
+
+	clk.Advance(time.Second)
+	release()
+	pool.Drain(context.Background())
+
+	m = pool.DetailedMetrics()
+	if m.Utilization != 0 || m.QueueHighWater != 3 {
+		t.Errorf("expected no utilization and a high-water mark of 3, got %+v", m)
+	}
+	near := func(d, want time.Duration) bool {
+		return d > want*98/100 && d < want*102/100
+	}
+	if m.Wait.Count != 4 || !near(m.Wait.Max, time.Second) {
+		t.Errorf("expected 4 waits of up to 1s, got %+v", m.Wait)
+	}
+	if m.Execution.Count != 4 || !near(m.Execution.Max, time.Second) || m.Execution.P50 != 0 {
+		t.Errorf("expected 1 execution of 1s and 3 instant ones, got %+v", m.Execution)
+	}
+
+	if n := len(rec.Values("ion_workerpool_task_wait_seconds", "pool_name", "")); n != 4 {
+		t.Errorf("expected 4 recorded waits, got %d", n)
+	}
+	if n := len(rec.Values("ion_workerpool_task_duration_seconds", "pool_name", "")); n != 4 {
+		t.Errorf("expected 4 recorded durations, got %d", n)
+	}
+	if v, _ := rec.GaugeValue("ion_workerpool_queue_high_water", "pool_name", ""); v != 3 {
+		t.Errorf("expected a high-water gauge of 3, got %v", v)
+	}
+	if v, ok := rec.GaugeValue("ion_workerpool_utilization_percent", "pool_name", ""); !ok || v != 0 {
+		t.Errorf("expected a utilization gauge of 0, got %v", v)
+	}
+}
+
+func TestTaskPanicRecovery(t *testing.T) {
+	var panicValue any
+	var panicMutex sync.Mutex
+	var panicReceived bool
+
+	pool := workerpool.New(1, 1, workerpool.WithPanicRecovery(func(r any) {
+		panicMutex.Lock()
+		panicValue = r
+		panicReceived = true
+		panicMutex.Unlock()
+	}))
+	defer pool.Close(context.Background())
+
+	task := func(ctx context.Context) error {
+		panic("test panic")
+	}
+
+	err := pool.Submit(context.Background(), task)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Wait for panic recovery with proper synchronization
+	timeout := time.After(5 * time.Second)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("timeout waiting for panic recovery")
+		case <-ticker.C:
+			panicMutex.Lock()
+			if panicReceived {
+				expected := "test panic"
+				if panicValue != expected {
+					t.Errorf("expected panic value %q, got %v", expected, panicValue)
+				}
+				panicMutex.Unlock()
+				goto checkMetrics
+			}
+			panicMutex.Unlock()
+		}
+	}
 
 checkMetrics:
 	metrics := pool.Metrics()
@@ -374,3 +1048,1801 @@ checkMetrics:
 		t.Error("expected panic count > 0")
 	}
 }
+
+// errorLogger records the fields of errors logged with a message.
+type errorLogger struct {
+	observe.NopLogger
+	msg    string
+	fields chan []any
+}
+
+func (l *errorLogger) Error(msg string, err error, kv ...any) {
+	if msg == l.msg {
+		l.fields <- kv
+	}
+}
+
+func TestPanicErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	t.Run("fails the task with its stack", func(t *testing.T) {
+		logger := &errorLogger{msg: "task panicked", fields: make(chan []any, 1)}
+		deadLetters := make(chan error, 1)
+		pool := workerpool.New(1, 1,
+			workerpool.WithPanicErrors(),
+			workerpool.WithLogger(logger),
+			workerpool.WithDeadLetter(func(task workerpool.Task, err error) {
+				deadLetters <- err
+			}))
+		defer pool.Close(context.Background())
+
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			panic("test panic")
+		})
+
+		err := <-deadLetters
+		var panicErr *workerpool.PanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "test panic" {
+			t.Fatalf("expected a PanicError, got %v", err)
+		}
+		if !errors.Is(err, workerpool.ErrTaskPanicked) {
+			t.Errorf("expected the error to match ErrTaskPanicked, got %v", err)
+		}
+		if !strings.Contains(string(panicErr.Stack), "TestPanicErrors") {
+			t.Errorf("expected the stack of the panic, got %s", panicErr.Stack)
+		}
+
+		kv := <-logger.fields
+		if i := slices.Index(kv, any("stack")); i < 0 || !strings.Contains(kv[i+1].(string), "TestPanicErrors") {
+			t.Errorf("expected the stack in the log, got %v", kv)
+		}
+
+		pool.Drain(context.Background())
+		if m := pool.Metrics(); m.Panicked != 1 || m.Failed != 1 {
+			t.Errorf("expected the panic to count as a failure, got %+v", m)
+		}
+	})
+
+	t.Run("futures", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithPanicErrors(), workerpool.WithPanicRecovery(func(any) {}))
+		defer pool.Close(context.Background())
+
+		f := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			panic(errBoom)
+		})
+		_, err := f.Wait(context.Background())
+		var panicErr *workerpool.PanicError
+		if !errors.As(err, &panicErr) || len(panicErr.Stack) == 0 {
+			t.Fatalf("expected a PanicError with a stack, got %v", err)
+		}
+		if !errors.Is(err, errBoom) || !errors.Is(err, workerpool.ErrTaskPanicked) {
+			t.Errorf("expected the error to match the panic value and ErrTaskPanicked, got %v", err)
+		}
+	})
+
+	t.Run("no stack by default", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithPanicRecovery(func(any) {}))
+		defer pool.Close(context.Background())
+
+		f := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			panic("test panic")
+		})
+		_, err := f.Wait(context.Background())
+		var panicErr *workerpool.PanicError
+		if !errors.As(err, &panicErr) || panicErr.Stack != nil {
+			t.Errorf("expected a PanicError without a stack, got %v", err)
+		}
+
+		pool.Drain(context.Background())
+		if m := pool.Metrics(); m.Panicked != 1 || m.Failed != 0 {
+			t.Errorf("expected the panic not to count as a failure, got %+v", m)
+		}
+	})
+}
+
+func TestWorkerState(t *testing.T) {
+	t.Run("tasks get the state of their worker", func(t *testing.T) {
+		var mu sync.Mutex
+		cleaned := map[int]any{}
+		pool := workerpool.New(2, 4,
+			workerpool.WithWorkerInit(func(id int) (any, error) {
+				return fmt.Sprintf("conn-%d", id), nil
+			}),
+			workerpool.WithWorkerCleanup(func(id int, state any) {
+				mu.Lock()
+				cleaned[id] = state
+				mu.Unlock()
+			}),
+		)
+
+		states := make(chan any, 4)
+		for i := 0; i < 4; i++ {
+			pool.Submit(context.Background(), func(ctx context.Context) error {
+				state, ok := workerpool.WorkerState(ctx)
+				if !ok {
+					t.Error("expected a worker state")
+				}
+				states <- state
+				return nil
+			})
+		}
+		pool.Drain(context.Background())
+		close(states)
+
+		for state := range states {
+			if state != "conn-0" && state != "conn-1" {
+				t.Errorf("unexpected worker state %v", state)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(cleaned) != 2 || cleaned[0] != "conn-0" || cleaned[1] != "conn-1" {
+			t.Errorf("expected both workers cleaned up with their state, got %v", cleaned)
+		}
+	})
+
+	t.Run("retries a failing init", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		var attempts atomic.Int32
+		pool := workerpool.New(1, 1,
+			workerpool.WithWorkerInit(func(id int) (any, error) {
+				if attempts.Add(1) == 1 {
+					return nil, errors.New("database unavailable")
+				}
+				return "conn", nil
+			}),
+			workerpool.WithClock(clk),
+		)
+		defer pool.Close(context.Background())
+
+		done := make(chan any)
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			state, _ := workerpool.WorkerState(ctx)
+			done <- state
+			return nil
+		})
+
+		clk.BlockUntil(1)
+		clk.Advance(100 * time.Millisecond)
+		if state := <-done; state != "conn" {
+			t.Errorf("expected state conn, got %v", state)
+		}
+		if n := attempts.Load(); n != 2 {
+			t.Errorf("expected 2 init attempts, got %d", n)
+		}
+	})
+
+	t.Run("without init", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		found := make(chan bool, 1)
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			_, ok := workerpool.WorkerState(ctx)
+			found <- ok
+			return nil
+		})
+		if <-found {
+			t.Error("expected no worker state")
+		}
+	})
+}
+
+func TestPoolDrainWithClock(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	pool := workerpool.New(1, 1, workerpool.WithClock(clk))
+
+	release := make(chan struct{})
+	pool.Submit(context.Background(), func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	pool.Submit(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.Drain(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("drain finished before the tasks")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Drain is woken by the last task to complete, without polling, so it
+	// finishes although the clock never moves.
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !pool.IsClosed() {
+			t.Error("expected pool to be closed after drain")
+		}
+		if m := pool.Metrics(); m.Completed != 2 || m.Queued != 0 {
+			t.Errorf("expected both tasks to complete, got %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("drain did not finish")
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	// runBlocked submits a task that waits for its context and returns the
+	// cause of its cancellation.
+	runBlocked := func(t *testing.T, clk *clock.FakeClock, submit func(workerpool.Task) error, advance time.Duration) error {
+		causes := make(chan error, 1)
+		if err := submit(func(ctx context.Context) error {
+			<-ctx.Done()
+			causes <- context.Cause(ctx)
+			return nil
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		clk.BlockUntil(1)
+		clk.Advance(advance)
+		return <-causes
+	}
+
+	waitFailed := func(t *testing.T, pool *workerpool.Pool, want uint64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for pool.Metrics().Failed != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d failed tasks, got %d", want, pool.Metrics().Failed)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("pool timeout", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 1, workerpool.WithTaskTimeout(time.Second), workerpool.WithClock(clk))
+		defer pool.Close(context.Background())
+
+		cause := runBlocked(t, clk, func(task workerpool.Task) error {
+			return pool.Submit(context.Background(), task)
+		}, time.Second)
+		if !errors.Is(cause, workerpool.ErrTaskTimeout) || !errors.Is(cause, context.DeadlineExceeded) {
+			t.Errorf("expected ErrTaskTimeout, got %v", cause)
+		}
+		// Counted as failed even though the task returned nil
+		waitFailed(t, pool, 1)
+	})
+
+	t.Run("per task timeout", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 1, workerpool.WithTaskTimeout(time.Hour), workerpool.WithClock(clk))
+		defer pool.Close(context.Background())
+
+		cause := runBlocked(t, clk, func(task workerpool.Task) error {
+			return pool.SubmitWithTimeout(context.Background(), task, time.Second)
+		}, time.Second)
+		if !errors.Is(cause, workerpool.ErrTaskTimeout) {
+			t.Errorf("expected ErrTaskTimeout, got %v", cause)
+		}
+		waitFailed(t, pool, 1)
+	})
+
+	t.Run("tasks within their timeout", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 1, workerpool.WithTaskTimeout(time.Second), workerpool.WithClock(clk))
+
+		for i := 0; i < 3; i++ {
+			if err := pool.Submit(context.Background(), func(ctx context.Context) error {
+				return ctx.Err()
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		pool.Close(context.Background())
+
+		if m := pool.Metrics(); m.Completed != 3 || m.Failed != 0 {
+			t.Errorf("expected 3 completed tasks, got %+v", m)
+		}
+		if n := clk.Waiters(); n != 0 {
+			t.Errorf("expected timeout timers to be stopped, %d pending", n)
+		}
+	})
+
+	t.Run("panic after the timeout", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		rec := sim.NewRecorder()
+		pool := workerpool.New(1, 1,
+			workerpool.WithTaskTimeout(time.Second),
+			workerpool.WithClock(clk),
+			workerpool.WithMetrics(rec),
+			workerpool.WithPanicRecovery(func(any) {}),
+		)
+
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			clk.Advance(time.Second)
+			panic("boom")
+		})
+		pool.WaitMetrics(context.Background(), func(m workerpool.PoolMetrics) bool {
+			return m.Panicked == 1 && m.Running == 0
+		})
+		pool.Close(context.Background())
+
+		// Counted as a panic only, not as a timeout too
+		if n := rec.Count("ion_workerpool_tasks_completed_total", "status", "timeout"); n != 0 {
+			t.Errorf("expected no timeout, got %v", n)
+		}
+	})
+}
+
+func TestRetry(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	t.Run("retries until the task succeeds", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 1,
+			workerpool.WithRetry(3, backoff.Constant(time.Second)),
+			workerpool.WithClock(clk),
+		)
+		defer pool.Close(context.Background())
+
+		var attempts atomic.Int32
+		done := make(chan struct{})
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			if attempts.Add(1) < 3 {
+				return errBoom
+			}
+			close(done)
+			return nil
+		})
+
+		for i := 0; i < 2; i++ {
+			clk.BlockUntil(1)
+			clk.Advance(time.Second)
+		}
+		<-done
+		pool.Close(context.Background())
+
+		if m := pool.Metrics(); m.Completed != 1 || m.Retried != 2 || m.Failed != 0 {
+			t.Errorf("expected 1 completed task after 2 retries, got %+v", m)
+		}
+	})
+
+	t.Run("dead letters after the last attempt", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		type deadLetter struct {
+			task workerpool.Task
+			err  error
+		}
+		dead := make(chan deadLetter, 1)
+		pool := workerpool.New(1, 1,
+			workerpool.WithRetry(2, backoff.Constant(time.Second)),
+			workerpool.WithDeadLetter(func(task workerpool.Task, err error) {
+				dead <- deadLetter{task, err}
+			}),
+			workerpool.WithClock(clk),
+		)
+		defer pool.Close(context.Background())
+
+		var attempts atomic.Int32
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			attempts.Add(1)
+			return errBoom
+		})
+
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+
+		d := <-dead
+		if !errors.Is(d.err, errBoom) {
+			t.Errorf("expected the task error, got %v", d.err)
+		}
+		if n := attempts.Load(); n != 2 {
+			t.Errorf("expected 2 attempts, got %d", n)
+		}
+		// The dead-lettered task can be replayed
+		if err := d.task(context.Background()); !errors.Is(err, errBoom) {
+			t.Errorf("expected the task to run again, got %v", err)
+		}
+		if m := pool.Metrics(); m.Retried != 1 || m.Failed != 1 || m.DeadLettered != 1 {
+			t.Errorf("expected 1 retry and 1 dead-lettered task, got %+v", m)
+		}
+	})
+
+	t.Run("gives up when the pool closes", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		dead := make(chan error, 1)
+		pool := workerpool.New(1, 1,
+			workerpool.WithRetry(5, backoff.Constant(time.Minute)),
+			workerpool.WithDeadLetter(func(task workerpool.Task, err error) {
+				dead <- err
+			}),
+			workerpool.WithClock(clk),
+		)
+
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			return errBoom
+		})
+
+		clk.BlockUntil(1)
+		pool.Close(context.Background())
+
+		if err := <-dead; !errors.Is(err, errBoom) {
+			t.Errorf("expected the task error, got %v", err)
+		}
+	})
+
+	t.Run("futures are not retried", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithRetry(3, backoff.Constant(time.Millisecond)))
+		defer pool.Close(context.Background())
+
+		var attempts atomic.Int32
+		f := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			attempts.Add(1)
+			return 0, errBoom
+		})
+		if _, err := f.Wait(context.Background()); !errors.Is(err, errBoom) {
+			t.Errorf("expected the task error, got %v", err)
+		}
+		pool.Drain(context.Background())
+		if n := attempts.Load(); n != 1 {
+			t.Errorf("expected 1 attempt, got %d", n)
+		}
+	})
+}
+
+// hookRecorder records task lifecycle events as strings.
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *hookRecorder) record(kind string, ev workerpool.TaskEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := fmt.Sprintf("%s %s #%d", kind, ev.Info.ID, ev.Attempt)
+	if kind == "finish" {
+		e += fmt.Sprintf(" err=%v retry=%t", ev.Err, ev.Retry)
+	}
+	r.events = append(r.events, e)
+}
+
+func (r *hookRecorder) hooks() workerpool.TaskHooks {
+	return workerpool.TaskHooks{
+		OnEnqueue: func(ctx context.Context, ev workerpool.TaskEvent) { r.record("enqueue", ev) },
+		OnStart:   func(ctx context.Context, ev workerpool.TaskEvent) { r.record("start", ev) },
+		OnFinish:  func(ctx context.Context, ev workerpool.TaskEvent) { r.record("finish", ev) },
+	}
+}
+
+func (r *hookRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+func TestTaskHooks(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	t.Run("reports the lifecycle with the task info", func(t *testing.T) {
+		var rec hookRecorder
+		pool := workerpool.New(1, 1, workerpool.WithTaskHooks(rec.hooks()))
+		defer pool.Close(context.Background())
+
+		info := workerpool.TaskInfo{ID: "order-42", Name: "send-invoice", Labels: map[string]string{"tenant": "acme"}}
+		var got workerpool.TaskInfo
+		var correlationID string
+		err := pool.SubmitWithInfo(context.Background(), func(ctx context.Context) error {
+			got, _ = workerpool.TaskInfoFromContext(ctx)
+			correlationID, _ = observe.CorrelationID(ctx)
+			return nil
+		}, info)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pool.Drain(context.Background())
+
+		if got.ID != info.ID || got.Name != info.Name || got.Labels["tenant"] != "acme" {
+			t.Errorf("expected the task to see %+v, got %+v", info, got)
+		}
+		if correlationID != info.ID {
+			t.Errorf("expected correlation ID %q, got %q", info.ID, correlationID)
+		}
+		want := []string{"enqueue order-42 #1", "start order-42 #1", "finish order-42 #1 err=<nil> retry=false"}
+		if events := rec.get(); !slices.Equal(events, want) {
+			t.Errorf("expected events %q, got %q", want, events)
+		}
+	})
+
+	t.Run("keeps an existing correlation ID", func(t *testing.T) {
+		ctx := observe.WithCorrelationID(context.Background(), "req-1")
+		ctx = workerpool.ContextWithTaskInfo(ctx, workerpool.TaskInfo{ID: "order-42"})
+		if id, _ := observe.CorrelationID(ctx); id != "req-1" {
+			t.Errorf("expected correlation ID req-1, got %q", id)
+		}
+	})
+
+	t.Run("reports each attempt of a retried task", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		var rec hookRecorder
+		pool := workerpool.New(1, 1,
+			workerpool.WithRetry(2, backoff.Constant(time.Second)),
+			workerpool.WithTaskHooks(rec.hooks()),
+			workerpool.WithClock(clk),
+		)
+		defer pool.Close(context.Background())
+
+		pool.SubmitWithInfo(context.Background(), func(ctx context.Context) error {
+			return errBoom
+		}, workerpool.TaskInfo{ID: "a"})
+
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+		pool.Drain(context.Background())
+
+		want := []string{
+			"enqueue a #1", "start a #1", "finish a #1 err=boom retry=true",
+			"enqueue a #2", "start a #2", "finish a #2 err=boom retry=false",
+		}
+		if events := rec.get(); !slices.Equal(events, want) {
+			t.Errorf("expected events %q, got %q", want, events)
+		}
+	})
+
+	t.Run("reports tasks that could not be queued", func(t *testing.T) {
+		var rec hookRecorder
+		pool := workerpool.New(1, 0, workerpool.WithTaskHooks(rec.hooks()))
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+		defer release()
+
+		if err := pool.TrySubmit(func(ctx context.Context) error { return nil }); !errors.Is(err, workerpool.ErrQueueFull) {
+			t.Fatalf("expected a queue full error, got %v", err)
+		}
+
+		events := rec.get()
+		if n := len(events); n < 2 || events[n-2] != "enqueue  #1" || !strings.HasPrefix(events[n-1], "finish  #1 err=") {
+			t.Errorf("expected an enqueue and a finish with the error, got %q", events)
+		}
+	})
+
+	t.Run("reports panics as errors", func(t *testing.T) {
+		finished := make(chan error, 1)
+		pool := workerpool.New(1, 1,
+			workerpool.WithPanicRecovery(func(any) {}),
+			workerpool.WithTaskHooks(workerpool.TaskHooks{
+				OnFinish: func(ctx context.Context, ev workerpool.TaskEvent) { finished <- ev.Err },
+			}),
+		)
+		defer pool.Close(context.Background())
+
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			panic("boom")
+		})
+		if err := <-finished; !errors.Is(err, workerpool.ErrTaskPanicked) {
+			t.Errorf("expected an error wrapping ErrTaskPanicked, got %v", err)
+		}
+	})
+}
+
+func TestResults(t *testing.T) {
+	t.Run("unordered", func(t *testing.T) {
+		pool := workerpool.New(4, 4)
+		defer pool.Close(context.Background())
+
+		results := workerpool.NewResults[int](pool)
+		go func() {
+			defer results.Close()
+			for i := 0; i < 20; i++ {
+				results.Submit(context.Background(), func(ctx context.Context) (int, error) {
+					return i * i, nil
+				})
+			}
+		}()
+
+		seen := make(map[uint64]bool)
+		for r := range results.C() {
+			if r.Err != nil || r.Value != int(r.Seq*r.Seq) {
+				t.Errorf("unexpected result %+v", r)
+			}
+			seen[r.Seq] = true
+		}
+		if len(seen) != 20 {
+			t.Errorf("expected 20 results, got %d", len(seen))
+		}
+	})
+
+	t.Run("ordered", func(t *testing.T) {
+		pool := workerpool.New(4, 4)
+		defer pool.Close(context.Background())
+
+		results := workerpool.NewResults[int](pool, workerpool.WithOrderedResults())
+		go func() {
+			defer results.Close()
+			for i := 0; i < 12; i++ {
+				results.Submit(context.Background(), func(ctx context.Context) (int, error) {
+					// Earlier tasks finish later
+					time.Sleep(time.Duration(12-i) * time.Millisecond)
+					if i == 5 {
+						return 0, errors.New("boom")
+					}
+					return i, nil
+				})
+			}
+		}()
+
+		var next uint64
+		for r := range results.C() {
+			if r.Seq != next {
+				t.Fatalf("expected result %d, got %d", next, r.Seq)
+			}
+			if r.Seq == 5 {
+				if r.Err == nil {
+					t.Error("expected the task error to be delivered")
+				}
+			} else if r.Value != int(r.Seq) {
+				t.Errorf("expected value %d, got %d", r.Seq, r.Value)
+			}
+			next++
+		}
+		if next != 12 {
+			t.Errorf("expected 12 results, got %d", next)
+		}
+	})
+
+	t.Run("submit after close", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		results := workerpool.NewResults[int](pool)
+		results.Close()
+
+		_, err := results.Submit(context.Background(), func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		var poolErr *workerpool.PoolError
+		if !errors.As(err, &poolErr) {
+			t.Errorf("expected a pool error, got %v", err)
+		}
+		if _, ok := <-results.C(); ok {
+			t.Error("expected no results")
+		}
+	})
+
+	t.Run("pool closed with queued tasks", func(t *testing.T) {
+		pool := workerpool.New(1, 4)
+
+		results := workerpool.NewResults[int](pool, workerpool.WithOrderedResults())
+		started := make(chan struct{})
+		results.Submit(context.Background(), func(ctx context.Context) (int, error) {
+			close(started)
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+		for i := 0; i < 3; i++ {
+			results.Submit(context.Background(), func(ctx context.Context) (int, error) {
+				return 0, ctx.Err()
+			})
+		}
+		results.Close()
+
+		<-started
+		pool.Close(context.Background())
+
+		// Queued tasks either still run or are dropped with a pool closed
+		// error, but every one of them delivers a result.
+		var n int
+		for range results.C() {
+			n++
+		}
+		if n != 4 {
+			t.Errorf("expected 4 results, got %d", n)
+		}
+	})
+}
+
+func TestFuture(t *testing.T) {
+	t.Run("returns the result", func(t *testing.T) {
+		pool := workerpool.New(2, 2)
+		defer pool.Close(context.Background())
+
+		square := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			return 7 * 7, nil
+		})
+		failed := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (string, error) {
+			return "", errors.New("boom")
+		})
+
+		if v, err := square.Wait(context.Background()); err != nil || v != 49 {
+			t.Errorf("expected 49, got %d, %v", v, err)
+		}
+		if _, err := failed.Wait(context.Background()); err == nil || err.Error() != "boom" {
+			t.Errorf("expected the task error, got %v", err)
+		}
+		select {
+		case <-square.Done():
+		default:
+			t.Error("expected Done to be closed after Wait")
+		}
+	})
+
+	t.Run("wait gives up when its context is done", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		release := make(chan struct{})
+		f := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			<-release
+			return 1, nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := f.Wait(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+
+		close(release)
+		if v, err := f.Wait(context.Background()); err != nil || v != 1 {
+			t.Errorf("expected 1, got %d, %v", v, err)
+		}
+	})
+
+	t.Run("cancel before the task runs", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+		release := blockWorker(t, pool)
+
+		var ran atomic.Bool
+		f := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			ran.Store(true)
+			return 1, nil
+		})
+		f.Cancel()
+
+		if _, err := f.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+
+		release()
+		pool.Drain(context.Background())
+		if ran.Load() {
+			t.Error("expected the canceled task not to run")
+		}
+	})
+
+	t.Run("cancel a running task", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		started := make(chan struct{})
+		f := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			close(started)
+			<-ctx.Done()
+			return 2, errors.New("stopped")
+		})
+
+		<-started
+		f.Cancel()
+		if v, err := f.Wait(context.Background()); v != 2 || err == nil || err.Error() != "stopped" {
+			t.Errorf("expected the task result, got %d, %v", v, err)
+		}
+	})
+
+	t.Run("pool closed", func(t *testing.T) {
+		pool := workerpool.New(1, 2)
+
+		started := make(chan struct{})
+		running := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			close(started)
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+		queued := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			return 0, ctx.Err()
+		})
+
+		<-started
+		pool.Close(context.Background())
+
+		if _, err := running.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		// The queued task either still runs or is dropped with a pool
+		// closed error, but its future resolves.
+		<-queued.Done()
+
+		late := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		var poolErr *workerpool.PoolError
+		if _, err := late.Wait(context.Background()); !errors.As(err, &poolErr) {
+			t.Errorf("expected a pool error, got %v", err)
+		}
+	})
+
+	t.Run("pending futures hold no goroutine", func(t *testing.T) {
+		const n = 100
+		pool := workerpool.New(1, n)
+		release := blockWorker(t, pool)
+
+		before := runtime.NumGoroutine()
+		futures := make([]*workerpool.Future[int], n)
+		for i := range futures {
+			futures[i] = workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+				return 0, nil
+			})
+		}
+		if after := runtime.NumGoroutine(); after > before {
+			t.Errorf("expected no goroutine per pending future, got %d more", after-before)
+		}
+
+		release()
+		pool.Close(context.Background())
+		for _, f := range futures {
+			<-f.Done()
+		}
+	})
+}
+
+// blockWorker occupies the single worker of pool until the returned
+// function is called.
+func TestSubmitDedup(t *testing.T) {
+	t.Run("coalesces concurrent submissions", func(t *testing.T) {
+		rec := sim.NewRecorder()
+		pool := workerpool.New(1, 4, workerpool.WithMetrics(rec))
+		defer pool.Close(context.Background())
+
+		errRefresh := errors.New("refresh failed")
+		var runs atomic.Int32
+		refresh := func(ctx context.Context) error {
+			runs.Add(1)
+			return errRefresh
+		}
+
+		release := blockWorker(t, pool)
+		first := pool.SubmitDedup(context.Background(), "user:1", refresh)
+		second := pool.SubmitDedup(context.Background(), "user:1", refresh)
+		other := pool.SubmitDedup(context.Background(), "user:2", refresh)
+		if first != second {
+			t.Error("expected the same future for the same key")
+		}
+		if first == other {
+			t.Error("expected distinct futures for distinct keys")
+		}
+		release()
+
+		for _, f := range []*workerpool.Future[struct{}]{first, second, other} {
+			if _, err := f.Wait(context.Background()); !errors.Is(err, errRefresh) {
+				t.Errorf("expected the shared error, got %v", err)
+			}
+		}
+		if n := runs.Load(); n != 2 {
+			t.Errorf("expected 2 runs, got %d", n)
+		}
+		if n := rec.Count("ion_workerpool_tasks_deduplicated_total", "pool_name", ""); n != 1 {
+			t.Errorf("expected 1 deduplicated submission, got %v", n)
+		}
+
+		// The key is released once the task completes
+		f := pool.SubmitDedup(context.Background(), "user:1", refresh)
+		f.Wait(context.Background())
+		if n := runs.Load(); n != 3 {
+			t.Errorf("expected a new run after completion, got %d runs", n)
+		}
+	})
+
+	t.Run("outlives the first submitter", func(t *testing.T) {
+		pool := workerpool.New(1, 4)
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+		ctx, cancel := context.WithCancel(context.Background())
+		var ran atomic.Bool
+		f := pool.SubmitDedup(ctx, "key", func(ctx context.Context) error {
+			ran.Store(true)
+			return ctx.Err()
+		})
+		cancel()
+		release()
+
+		if _, err := f.Wait(context.Background()); err != nil || !ran.Load() {
+			t.Errorf("expected the task to run despite the canceled submitter, got %v", err)
+		}
+	})
+
+	t.Run("cancel releases the key", func(t *testing.T) {
+		pool := workerpool.New(1, 4)
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+		defer release()
+		noop := func(ctx context.Context) error { return nil }
+		f := pool.SubmitDedup(context.Background(), "key", noop)
+		f.Cancel()
+		if _, err := f.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if pool.SubmitDedup(context.Background(), "key", noop) == f {
+			t.Error("expected a new future after cancel")
+		}
+	})
+
+	t.Run("nil task", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		if _, err := pool.SubmitDedup(context.Background(), "key", nil).Wait(context.Background()); err == nil {
+			t.Error("expected an error for a nil task")
+		}
+	})
+}
+
+func TestTaskGroup(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	t.Run("waits for every task and returns the first error", func(t *testing.T) {
+		pool := workerpool.New(2, 10)
+		defer pool.Close(context.Background())
+
+		g := pool.Group("batch")
+		var ran atomic.Int32
+		for i := 0; i < 5; i++ {
+			err := g.Submit(context.Background(), func(ctx context.Context) error {
+				ran.Add(1)
+				if info, _ := workerpool.TaskInfoFromContext(ctx); info.Name != "batch" {
+					t.Errorf("expected task name batch, got %q", info.Name)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		g.Submit(context.Background(), func(ctx context.Context) error { return errBoom })
+
+		if err := g.Wait(context.Background()); !errors.Is(err, errBoom) {
+			t.Errorf("expected the task error, got %v", err)
+		}
+		if n := ran.Load(); n != 5 {
+			t.Errorf("expected 5 tasks to run, got %d", n)
+		}
+	})
+
+	t.Run("returns at once when empty", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		if err := pool.Group("empty").Wait(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("cancel all", func(t *testing.T) {
+		pool := workerpool.New(1, 10)
+		defer pool.Close(context.Background())
+
+		g := pool.Group("cancel")
+		started := make(chan struct{})
+		g.Submit(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		var queuedRan atomic.Bool
+		g.Submit(context.Background(), func(ctx context.Context) error {
+			queuedRan.Store(true)
+			return nil
+		})
+
+		<-started
+		g.CancelAll()
+		if err := g.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if queuedRan.Load() {
+			t.Error("expected the queued task not to run")
+		}
+	})
+
+	t.Run("wait respects its context", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Close(context.Background())
+
+		g := pool.Group("slow")
+		release := make(chan struct{})
+		defer close(release)
+		g.Submit(context.Background(), func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := g.Wait(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("pool closed with tasks queued", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+
+		g := pool.Group("dropped")
+		started := make(chan struct{})
+		g.Submit(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return nil
+		})
+		g.Submit(context.Background(), func(ctx context.Context) error { return nil })
+
+		<-started
+		pool.Close(context.Background())
+
+		// The queued task either still runs or is dropped, but Wait returns
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := g.Wait(ctx); errors.Is(err, context.DeadlineExceeded) {
+			t.Error("expected Wait to return once the pool closed")
+		}
+	})
+}
+
+func blockWorker(t *testing.T, pool *workerpool.Pool) func() {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := pool.Submit(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-started
+	return func() { close(release) }
+}
+
+func TestEDF(t *testing.T) {
+	t.Run("runs the earliest deadline first", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 10, workerpool.WithEDF(), workerpool.WithClock(clk))
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+
+		var mu sync.Mutex
+		var order []string
+		done := make(chan struct{}, 4)
+		record := func(name string) workerpool.Task {
+			return func(ctx context.Context) error {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				done <- struct{}{}
+				return nil
+			}
+		}
+
+		pool.Submit(context.Background(), record("none"))
+		pool.SubmitWithDeadline(context.Background(), record("5s"), clk.Now().Add(5*time.Second))
+		pool.SubmitWithDeadline(context.Background(), record("1s"), clk.Now().Add(time.Second))
+		pool.SubmitWithDeadline(context.Background(), record("3s"), clk.Now().Add(3*time.Second))
+
+		release()
+		for i := 0; i < 4; i++ {
+			<-done
+		}
+
+		want := []string{"1s", "3s", "5s", "none"}
+		for i := range want {
+			if order[i] != want[i] {
+				t.Fatalf("expected order %v, got %v", want, order)
+			}
+		}
+	})
+
+	t.Run("rejects late submissions", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(10, 0))
+		pool := workerpool.New(1, 1, workerpool.WithEDF(), workerpool.WithClock(clk))
+		defer pool.Close(context.Background())
+
+		err := pool.SubmitWithDeadline(context.Background(), func(ctx context.Context) error {
+			t.Error("late task should not run")
+			return nil
+		}, clk.Now().Add(-time.Second))
+
+		var poolErr *workerpool.PoolError
+		if !errors.As(err, &poolErr) || !errors.Is(err, workerpool.ErrDeadlineMissed) {
+			t.Errorf("expected a deadline missed error, got %v", err)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("expected the error to wrap context.DeadlineExceeded")
+		}
+	})
+
+	t.Run("drops tasks that expire in the queue", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		pool := workerpool.New(1, 2, workerpool.WithEDF(), workerpool.WithClock(clk))
+		defer pool.Close(context.Background())
+
+		release := blockWorker(t, pool)
+
+		var ran atomic.Bool
+		pool.SubmitWithDeadline(context.Background(), func(ctx context.Context) error {
+			ran.Store(true)
+			return nil
+		}, clk.Now().Add(time.Second))
+
+		// The context deadline is the task deadline in EDF mode. The fake
+		// clock starts at the real time so the context itself does not
+		// expire during the test.
+		ctx, cancel := context.WithDeadline(context.Background(), clk.Now().Add(time.Second))
+		defer cancel()
+		results := workerpool.NewResults[int](pool)
+		results.Submit(ctx, func(ctx context.Context) (int, error) {
+			ran.Store(true)
+			return 1, nil
+		})
+		results.Close()
+
+		clk.Advance(2 * time.Second)
+		release()
+
+		r := <-results.C()
+		if !errors.Is(r.Err, workerpool.ErrDeadlineMissed) {
+			t.Errorf("expected a deadline missed result, got %+v", r)
+		}
+		if ran.Load() {
+			t.Error("expected late tasks not to run")
+		}
+		if failed := pool.Metrics().Failed; failed != 2 {
+			t.Errorf("expected 2 failed tasks, got %d", failed)
+		}
+	})
+}
+
+func TestPriority(t *testing.T) {
+	// runOrder submits named tasks to a pool whose single worker is busy,
+	// then releases the worker and returns the order the tasks ran in.
+	runOrder := func(t *testing.T, pool *workerpool.Pool, submit func(record func(name string) workerpool.Task)) []string {
+		release := blockWorker(t, pool)
+
+		var mu sync.Mutex
+		var order []string
+		var wg sync.WaitGroup
+		submit(func(name string) workerpool.Task {
+			wg.Add(1)
+			return func(ctx context.Context) error {
+				defer wg.Done()
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, name)
+				return nil
+			}
+		})
+
+		release()
+		wg.Wait()
+		return order
+	}
+
+	t.Run("runs the highest priority first", func(t *testing.T) {
+		pool := workerpool.New(1, 10, workerpool.WithPriority(0))
+		defer pool.Close(context.Background())
+
+		order := runOrder(t, pool, func(record func(string) workerpool.Task) {
+			ctx := context.Background()
+			pool.Submit(ctx, record("bulk 1"))
+			pool.SubmitWithPriority(ctx, record("urgent"), 10)
+			pool.SubmitWithPriority(ctx, record("bulk 2"), 0)
+			pool.SubmitWithPriority(ctx, record("normal"), 5)
+		})
+
+		want := []string{"urgent", "normal", "bulk 1", "bulk 2"}
+		if !slices.Equal(order, want) {
+			t.Errorf("expected order %v, got %v", want, order)
+		}
+	})
+
+	t.Run("ages waiting tasks", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 10, workerpool.WithPriority(time.Second), workerpool.WithClock(clk))
+		defer pool.Close(context.Background())
+
+		order := runOrder(t, pool, func(record func(string) workerpool.Task) {
+			ctx := context.Background()
+			pool.Submit(ctx, record("bulk"))
+			clk.Advance(5 * time.Second)
+			// The bulk task has aged to priority 5
+			pool.SubmitWithPriority(ctx, record("priority 3"), 3)
+			pool.SubmitWithPriority(ctx, record("priority 10"), 10)
+		})
+
+		want := []string{"priority 10", "bulk", "priority 3"}
+		if !slices.Equal(order, want) {
+			t.Errorf("expected order %v, got %v", want, order)
+		}
+	})
+
+	t.Run("orders equal priorities by deadline with EDF", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 10, workerpool.WithPriority(0), workerpool.WithEDF(), workerpool.WithClock(clk))
+		defer pool.Close(context.Background())
+
+		order := runOrder(t, pool, func(record func(string) workerpool.Task) {
+			ctx := context.Background()
+			pool.SubmitWithDeadline(ctx, record("5s"), clk.Now().Add(5*time.Second))
+			pool.SubmitWithDeadline(ctx, record("1s"), clk.Now().Add(time.Second))
+			pool.SubmitWithPriority(ctx, record("urgent"), 1)
+		})
+
+		want := []string{"urgent", "1s", "5s"}
+		if !slices.Equal(order, want) {
+			t.Errorf("expected order %v, got %v", want, order)
+		}
+	})
+}
+
+func TestWorkStealing(t *testing.T) {
+	t.Run("runs every task", func(t *testing.T) {
+		pool := workerpool.New(4, 16, workerpool.WithWorkStealing())
+		defer pool.Close(context.Background())
+
+		var ran atomic.Int64
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					if err := pool.Submit(context.Background(), func(ctx context.Context) error {
+						ran.Add(1)
+						return nil
+					}); err != nil {
+						t.Errorf("unexpected error: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if err := pool.Drain(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := ran.Load(); n != 4000 {
+			t.Errorf("expected 4000 tasks to run, got %d", n)
+		}
+	})
+
+	t.Run("idle workers steal queued tasks", func(t *testing.T) {
+		pool := workerpool.New(2, 8, workerpool.WithWorkStealing())
+		defer pool.Close(context.Background())
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		// Half of these land in the shard of the blocked worker
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			pool.Submit(context.Background(), func(ctx context.Context) error {
+				wg.Done()
+				return nil
+			})
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("expected the free worker to run every queued task")
+		}
+		close(release)
+	})
+
+	t.Run("bounded queue", func(t *testing.T) {
+		pool := workerpool.New(1, 2, workerpool.WithWorkStealing())
+		defer pool.Close(context.Background())
+		release := blockWorker(t, pool)
+		defer release()
+
+		quickTask := func(ctx context.Context) error { return nil }
+		for i := 0; i < 2; i++ {
+			if err := pool.TrySubmit(quickTask); err != nil {
+				t.Fatalf("expected room in the queue, got %v", err)
+			}
+		}
+		if err := pool.TrySubmit(quickTask); !errors.Is(err, workerpool.ErrQueueFull) {
+			t.Errorf("expected ErrQueueFull, got %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := pool.Submit(ctx, quickTask); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the submit to time out, got %v", err)
+		}
+	})
+}
+
+func TestAutoscale(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	pool := workerpool.New(1, 10,
+		workerpool.WithAutoscale(1, 3, workerpool.AutoscalePolicy{
+			Interval: time.Second,
+			IdleTime: 5 * time.Second,
+		}),
+		workerpool.WithClock(clk),
+	)
+	defer pool.Close(context.Background())
+
+	// tick advances the clock by one interval and waits for the autoscaler
+	// to evaluate the pool and rearm its timer.
+	tick := func() {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+		clk.BlockUntil(1)
+	}
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		if err := pool.Submit(context.Background(), func(ctx context.Context) error {
+			defer wg.Done()
+			<-release
+			return nil
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	t.Run("scales up under queue pressure", func(t *testing.T) {
+		for _, want := range []int{2, 3, 3} {
+			tick()
+			if size := pool.GetSize(); size != want {
+				t.Fatalf("expected %d workers, got %d", want, size)
+			}
+		}
+		if size := pool.Metrics().Size; size != 3 {
+			t.Errorf("expected metrics to report 3 workers, got %d", size)
+		}
+	})
+
+	close(release)
+	wg.Wait()
+
+	t.Run("scales down after idle time", func(t *testing.T) {
+		// The first evaluation notices idle workers, which are removed one
+		// at a time every IdleTime
+		tick()
+		for _, want := range []int{2, 1} {
+			for i := 0; i < 4; i++ {
+				tick()
+			}
+			if size := pool.GetSize(); size != want+1 {
+				t.Fatalf("expected %d workers before IdleTime, got %d", want+1, size)
+			}
+			tick()
+			if size := pool.GetSize(); size != want {
+				t.Fatalf("expected %d workers, got %d", want, size)
+			}
+		}
+
+		// Never below min
+		for i := 0; i < 10; i++ {
+			tick()
+		}
+		if size := pool.GetSize(); size != 1 {
+			t.Fatalf("expected 1 worker, got %d", size)
+		}
+	})
+
+	t.Run("remaining workers still run tasks", func(t *testing.T) {
+		done := make(chan struct{})
+		if err := pool.Submit(context.Background(), func(ctx context.Context) error {
+			close(done)
+			return nil
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		<-done
+	})
+}
+
+func TestDurable(t *testing.T) {
+	t.Run("runs and deletes jobs", func(t *testing.T) {
+		pool := workerpool.New(2, 4)
+		defer pool.Close(context.Background())
+
+		store := workerpool.NewMemoryStore()
+		jobs := workerpool.NewDurable(pool, store)
+
+		got := make(chan workerpool.Job, 1)
+		jobs.Handle("echo", func(ctx context.Context, job workerpool.Job) error {
+			got <- job
+			return nil
+		})
+
+		id, err := jobs.Enqueue(context.Background(), "echo", []byte("hello"), map[string]string{"tenant": "a"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		job := <-got
+		if job.ID != id || string(job.Payload) != "hello" || job.Metadata["tenant"] != "a" || job.Attempts != 1 {
+			t.Errorf("unexpected job %+v", job)
+		}
+
+		pool.Drain(context.Background())
+		if pending, _ := store.Pending(context.Background()); len(pending) != 0 {
+			t.Errorf("expected completed jobs to be deleted, got %d", len(pending))
+		}
+
+		if _, err := jobs.Enqueue(context.Background(), "missing", nil, nil); !errors.Is(err, workerpool.ErrUnknownJobKind) {
+			t.Errorf("expected ErrUnknownJobKind, got %v", err)
+		}
+	})
+
+	t.Run("recovers jobs abandoned by close", func(t *testing.T) {
+		store := workerpool.NewMemoryStore()
+
+		first := workerpool.New(1, 4)
+		release := make(chan struct{})
+		defer close(release)
+		started := make(chan struct{})
+		_ = first.Submit(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		jobs := workerpool.NewDurable(first, store)
+		jobs.Handle("work", func(ctx context.Context, job workerpool.Job) error {
+			return nil
+		})
+		for _, payload := range []string{"a", "b"} {
+			if _, err := jobs.Enqueue(context.Background(), "work", []byte(payload), nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_ = first.Close(ctx)
+
+		second := workerpool.New(1, 4)
+		defer second.Close(context.Background())
+
+		var mu sync.Mutex
+		var order []string
+		jobs = workerpool.NewDurable(second, store)
+		jobs.Handle("work", func(ctx context.Context, job workerpool.Job) error {
+			mu.Lock()
+			order = append(order, string(job.Payload))
+			mu.Unlock()
+			return nil
+		})
+
+		n, err := jobs.Recover(context.Background())
+		if err != nil || n != 2 {
+			t.Fatalf("expected 2 recovered jobs, got %d (%v)", n, err)
+		}
+
+		second.Drain(context.Background())
+		if fmt.Sprint(order) != "[a b]" {
+			t.Errorf("expected jobs replayed in order, got %v", order)
+		}
+		if pending, _ := store.Pending(context.Background()); len(pending) != 0 {
+			t.Errorf("expected the store to be empty, got %d", len(pending))
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("runs the chain in order", func(t *testing.T) {
+		var mu sync.Mutex
+		var calls []string
+		record := func(name string) workerpool.Middleware {
+			return func(next workerpool.Task) workerpool.Task {
+				return func(ctx context.Context) error {
+					mu.Lock()
+					calls = append(calls, name)
+					mu.Unlock()
+					return next(ctx)
+				}
+			}
+		}
+
+		pool := workerpool.New(1, 1,
+			workerpool.WithMiddleware(record("first"), record("second")),
+			workerpool.WithTaskWrapper(record("third")),
+		)
+		defer pool.Close(context.Background())
+
+		done := make(chan struct{})
+		_ = pool.Submit(context.Background(), func(ctx context.Context) error {
+			close(done)
+			return nil
+		})
+		<-done
+
+		mu.Lock()
+		defer mu.Unlock()
+		if fmt.Sprint(calls) != "[first second third]" {
+			t.Errorf("unexpected middleware order %v", calls)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		var attempts int
+		task := workerpool.Retry(3, backoff.Constant(time.Millisecond))(func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("transient")
+			}
+			return nil
+		})
+
+		if err := task(context.Background()); err != nil || attempts != 3 {
+			t.Errorf("expected success on the third attempt, got %v after %d", err, attempts)
+		}
+
+		attempts = 0
+		boom := errors.New("boom")
+		task = workerpool.Retry(2, backoff.Constant(time.Millisecond))(func(ctx context.Context) error {
+			attempts++
+			return boom
+		})
+		if err := task(context.Background()); !errors.Is(err, boom) || attempts != 2 {
+			t.Errorf("expected the last error after 2 attempts, got %v after %d", err, attempts)
+		}
+	})
+
+	t.Run("retry waits on the pool clock", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 1,
+			workerpool.WithClock(clk),
+			workerpool.WithMiddleware(workerpool.Retry(2, backoff.Constant(time.Hour))),
+		)
+		defer pool.Close(context.Background())
+
+		var attempts atomic.Int32
+		done := make(chan struct{})
+		_ = pool.Submit(context.Background(), func(ctx context.Context) error {
+			if attempts.Add(1) == 1 {
+				return errors.New("transient")
+			}
+			close(done)
+			return nil
+		})
+
+		clk.BlockUntil(1)
+		clk.Advance(time.Hour)
+		<-done
+		if n := attempts.Load(); n != 2 {
+			t.Errorf("expected success on the second attempt, got %d attempts", n)
+		}
+	})
+
+	t.Run("retry without strategy", func(t *testing.T) {
+		ran := false
+		err := workerpool.Retry(3, nil)(func(ctx context.Context) error {
+			ran = true
+			return nil
+		})(context.Background())
+		if err == nil || ran {
+			t.Errorf("expected an error without running the task, got %v (ran: %v)", err, ran)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		task := workerpool.Timeout(10 * time.Millisecond)(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if err := task(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a deadline error, got %v", err)
+		}
+	})
+
+	t.Run("timeout on the pool clock", func(t *testing.T) {
+		clk := clock.NewFake(time.Unix(0, 0))
+		pool := workerpool.New(1, 1,
+			workerpool.WithClock(clk),
+			workerpool.WithMiddleware(workerpool.Timeout(time.Minute)),
+		)
+		defer pool.Close(context.Background())
+
+		cause := make(chan error, 1)
+		_ = pool.Submit(context.Background(), func(ctx context.Context) error {
+			<-ctx.Done()
+			cause <- context.Cause(ctx)
+			return nil
+		})
+
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+		if err := <-cause; !errors.Is(err, workerpool.ErrTaskTimeout) {
+			t.Errorf("expected ErrTaskTimeout, got %v", err)
+		}
+	})
+
+	t.Run("recover panics", func(t *testing.T) {
+		err := workerpool.RecoverPanics()(func(ctx context.Context) error {
+			panic("boom")
+		})(context.Background())
+		if !errors.Is(err, workerpool.ErrTaskPanicked) {
+			t.Errorf("expected ErrTaskPanicked, got %v", err)
+		}
+
+		pool := workerpool.New(1, 1, workerpool.WithMiddleware(workerpool.RecoverPanics()))
+		_ = pool.Submit(context.Background(), func(ctx context.Context) error {
+			panic("boom")
+		})
+
+		pool.Drain(context.Background())
+		if m := pool.Metrics(); m.Panicked != 0 || m.Failed != 1 {
+			t.Errorf("expected the panic to count as a failure, got %+v", m)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("drains when the context is done", func(t *testing.T) {
+		pool := workerpool.New(1, 4)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- pool.Run(ctx) }()
+
+		for i := 0; i < 3; i++ {
+			pool.Submit(context.Background(), func(ctx context.Context) error {
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			})
+		}
+		cancel()
+
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if m := pool.Metrics(); m.Completed != 3 {
+			t.Errorf("expected the queued tasks to complete, got %+v", m)
+		}
+		if !pool.IsClosed() {
+			t.Error("expected the pool to be closed")
+		}
+	})
+
+	t.Run("drain timeout", func(t *testing.T) {
+		pool := workerpool.New(1, 1, workerpool.WithDrainTimeout(20*time.Millisecond))
+		started := make(chan struct{})
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		<-started
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := pool.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a drain timeout, got %v", err)
+		}
+		if !pool.IsClosed() {
+			t.Error("expected the pool to be closed")
+		}
+	})
+
+	t.Run("returns when the pool is closed", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		done := make(chan error, 1)
+		go func() { done <- pool.Run(context.Background()) }()
+
+		pool.Close(context.Background())
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after Close")
+		}
+	})
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("drains queued tasks", func(t *testing.T) {
+		pool := workerpool.New(1, 4)
+		for i := 0; i < 3; i++ {
+			pool.Submit(context.Background(), func(ctx context.Context) error {
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			})
+		}
+
+		report, err := pool.ShutdownOnSignal(canceled, time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !report.Drained || report.Completed != 3 || report.Abandoned != 0 || report.Signal != nil {
+			t.Errorf("unexpected report: %+v", report)
+		}
+		if err := pool.Submit(context.Background(), func(ctx context.Context) error { return nil }); err == nil {
+			t.Error("expected submissions to fail after shutdown")
+		}
+	})
+
+	t.Run("forces close after grace period", func(t *testing.T) {
+		pool := workerpool.New(1, 2)
+		started := make(chan struct{})
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		<-started
+
+		report, err := pool.ShutdownOnSignal(canceled, 50*time.Millisecond)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a grace period timeout, got %v", err)
+		}
+		if report.Drained {
+			t.Error("expected the shutdown to be forced")
+		}
+		if !pool.IsClosed() {
+			t.Error("expected the pool to be closed")
+		}
+	})
+
+	t.Run("shuts down on signal", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("sending signals is not supported on windows")
+		}
+
+		// Keep the test process alive should the signal arrive before
+		// ShutdownOnSignal listens for it
+		guard := make(chan os.Signal, 1)
+		signal.Notify(guard, os.Interrupt)
+		defer signal.Stop(guard)
+
+		pool := workerpool.New(1, 1)
+		done := make(chan workerpool.ShutdownReport, 1)
+		go func() {
+			report, _ := pool.ShutdownOnSignal(context.Background(), time.Second)
+			done <- report
+		}()
+
+		proc, _ := os.FindProcess(os.Getpid())
+		timeout := time.After(time.Second)
+		for {
+			proc.Signal(os.Interrupt)
+			select {
+			case report := <-done:
+				if report.Signal != os.Interrupt {
+					t.Errorf("expected the report to name the signal, got %v", report.Signal)
+				}
+				return
+			case <-timeout:
+				t.Fatal("shutdown was not triggered by the signal")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package workerpool
+
+import "runtime"
+
+const (
+	// ioWorkersPerProc is the number of workers per GOMAXPROCS for I/O-bound
+	// pools. I/O-bound tasks spend most of their time blocked, so many more
+	// workers than CPUs are needed to keep the CPUs busy.
+	ioWorkersPerProc = 8
+
+	// ioQueuePerWorker sizes the default queue of I/O-bound pools.
+	ioQueuePerWorker = 4
+
+	// cpuQueuePerWorker sizes the queue of CPU-bound pools. The queue is kept
+	// short so producers feel backpressure instead of piling up work the CPUs
+	// cannot catch up with.
+	cpuQueuePerWorker = 2
+)
+
+// NewIOBound creates a pool sized for I/O-bound tasks such as network calls,
+// disk access or database queries. It runs 8 workers per GOMAXPROCS. A
+// queueSize of zero or less selects a queue of 4 tasks per worker.
+//
+// I/O-bound work usually comes from request handlers that should not stall
+// when the pool is saturated, so the pool uses OverflowReject: Submit and
+// TrySubmit fail fast with an error wrapping ErrQueueFull when the queue is
+// full. Pass WithOverflowPolicy to choose another policy.
+func NewIOBound(queueSize int, opts ...Option) *Pool {
+	size := ioWorkersPerProc * runtime.GOMAXPROCS(0)
+	if queueSize <= 0 {
+		queueSize = ioQueuePerWorker * size
+	}
+	return New(size, queueSize, append([]Option{WithOverflowPolicy(OverflowReject)}, opts...)...)
+}
+
+// NewCPUBound creates a pool sized for CPU-bound tasks such as encoding,
+// compression or hashing. It runs exactly GOMAXPROCS workers, as more would
+// only add scheduling overhead, with a short queue of 2 tasks per worker.
+//
+// CPU-bound work is usually produced in batches that should slow down to
+// the pace of the pool, so the pool uses OverflowBlock: Submit and TrySubmit
+// wait for room in the queue. Unlike OverflowCallerRuns, this keeps no more
+// than GOMAXPROCS tasks running. Pass WithOverflowPolicy to choose another
+// policy.
+func NewCPUBound(opts ...Option) *Pool {
+	size := runtime.GOMAXPROCS(0)
+	return New(size, cpuQueuePerWorker*size, append([]Option{WithOverflowPolicy(OverflowBlock)}, opts...)...)
+}
@@ -0,0 +1,244 @@
+package workerpool
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	// errQueueClosed is returned by push when the pool closes while waiting.
+	errQueueClosed = errors.New("queue closed")
+
+	// errSubmitExpired is returned by push and enqueue when the wait allowed
+	// for room in the queue expires.
+	errSubmitExpired = errors.New("submit expired")
+)
+
+// taskQueue is a bounded queue that hands out the most urgent submission
+// first, replacing the task channel in EDF and priority mode. In priority
+// mode the highest aged priority comes first; in EDF mode, among equal
+// priorities, the earliest deadline. Submissions without a deadline come
+// after every submission with one, and ties are broken in submission order.
+type taskQueue struct {
+	mu       sync.Mutex
+	items    taskHeap
+	capacity int
+	seq      uint64
+	queued   map[int]int // submissions per priority
+
+	// Ordering
+	edf      bool
+	priority bool
+	aging    time.Duration // zero disables aging
+	epoch    time.Time     // enqueue times are ranked relative to it
+
+	// notEmpty and notFull wake one waiting worker or submitter. A waiter
+	// that leaves the queue in the same state passes the signal on.
+	notEmpty chan struct{}
+	notFull  chan struct{}
+}
+
+func newTaskQueue(capacity int, cfg *config, epoch time.Time) *taskQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &taskQueue{
+		capacity: capacity,
+		queued:   make(map[int]int),
+		edf:      cfg.edf,
+		priority: cfg.priority,
+		aging:    cfg.priorityAging,
+		epoch:    epoch,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+	}
+	q.items.less = q.less
+	return q
+}
+
+// tryPush adds sub to the queue and reports whether there was room.
+func (q *taskQueue) tryPush(sub taskSubmission) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items.items) >= q.capacity {
+		return false
+	}
+
+	heap.Push(&q.items, queueItem{sub: sub, rank: q.rank(sub), seq: q.seq})
+	q.seq++
+	q.queued[sub.priority]++
+	wake(q.notEmpty)
+	if len(q.items.items) < q.capacity {
+		wake(q.notFull)
+	}
+	return true
+}
+
+// push adds sub to the queue, waiting for room until ctx or closed is done
+// or expired fires.
+func (q *taskQueue) push(ctx context.Context, sub taskSubmission, closed <-chan struct{}, expired <-chan time.Time) error {
+	for {
+		if q.tryPush(sub) {
+			return nil
+		}
+
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+			return errQueueClosed
+		case <-expired:
+			return errSubmitExpired
+		}
+	}
+}
+
+// pop removes the most urgent submission, waiting until one is available,
+// done is closed or a token is received from retire.
+func (q *taskQueue) pop(done, retire <-chan struct{}) (taskSubmission, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items.items) > 0 {
+			item := heap.Pop(&q.items).(queueItem)
+			if q.queued[item.sub.priority]--; q.queued[item.sub.priority] == 0 {
+				delete(q.queued, item.sub.priority)
+			}
+			wake(q.notFull)
+			if len(q.items.items) > 0 {
+				wake(q.notEmpty)
+			}
+			q.mu.Unlock()
+			return item.sub, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notEmpty:
+		case <-done:
+			return taskSubmission{}, false
+		case <-retire:
+			return taskSubmission{}, false
+		}
+	}
+}
+
+// dropOldest removes the submission queued first, whatever its urgency.
+func (q *taskQueue) dropOldest() (taskSubmission, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items.items) == 0 {
+		return taskSubmission{}, false
+	}
+	oldest := 0
+	for i, item := range q.items.items {
+		if item.seq < q.items.items[oldest].seq {
+			oldest = i
+		}
+	}
+	item := heap.Remove(&q.items, oldest).(queueItem)
+	if q.queued[item.sub.priority]--; q.queued[item.sub.priority] == 0 {
+		delete(q.queued, item.sub.priority)
+	}
+	return item.sub, true
+}
+
+// size returns the number of queued submissions.
+func (q *taskQueue) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items.items)
+}
+
+// len returns the number of queued submissions with the given priority.
+func (q *taskQueue) len(priority int) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued[priority]
+}
+
+// rank returns the aged priority of sub, higher first. With aging, a
+// submission that has waited k aging intervals ranks with one of priority
+// k higher enqueued now. Ranking by the priority less the enqueue time in
+// intervals keeps the order fixed as submissions age, so the heap stays
+// valid.
+func (q *taskQueue) rank(sub taskSubmission) int64 {
+	if q.aging <= 0 {
+		return int64(sub.priority)
+	}
+	// Saturate rather than overflow for extreme priorities
+	bound := math.MaxInt64 / 4 / int64(q.aging)
+	priority := min(max(int64(sub.priority), -bound), bound)
+	return priority*int64(q.aging) - int64(sub.enqueued.Sub(q.epoch))
+}
+
+// less orders submissions by rank in priority mode, then by deadline in
+// EDF mode, then in submission order.
+func (q *taskQueue) less(a, b queueItem) bool {
+	if q.priority && a.rank != b.rank {
+		return a.rank > b.rank
+	}
+	if q.edf {
+		da, db := a.sub.deadline, b.sub.deadline
+		switch {
+		case da.IsZero() != db.IsZero():
+			return !da.IsZero()
+		case !da.Equal(db):
+			return da.Before(db)
+		}
+	}
+	return a.seq < b.seq
+}
+
+// wake signals ch without blocking.
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+type queueItem struct {
+	sub  taskSubmission
+	rank int64
+	seq  uint64
+}
+
+// taskHeap implements heap.Interface in the order of taskQueue.less.
+type taskHeap struct {
+	items []queueItem
+	less  func(a, b queueItem) bool
+}
+
+func (h taskHeap) Len() int { return len(h.items) }
+
+func (h taskHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+
+func (h taskHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *taskHeap) Push(x any) { h.items = append(h.items, x.(queueItem)) }
+
+func (h *taskHeap) Pop() any {
+	old := h.items
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = queueItem{}
+	h.items = old[:n-1]
+	return item
+}
+
+// taskDeadline returns the deadline of a submission made with ctx in EDF
+// mode, which is the context deadline if it has one.
+func taskDeadline(ctx context.Context) time.Time {
+	if ctx == nil {
+		return time.Time{}
+	}
+	deadline, _ := ctx.Deadline()
+	return deadline
+}
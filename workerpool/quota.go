@@ -0,0 +1,96 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+)
+
+// WithQuota caps at limit the tasks a single submitter may hold in the
+// pool, queued, running or waiting to be retried, so that one noisy tenant
+// cannot take the whole queue. key returns the submitter of a submission
+// from its context, such as a tenant or an endpoint; submissions with an
+// empty key have no quota. TrySubmit and TrySubmitTimeout, which take no
+// context, pass context.Background to key.
+//
+// A submission over its submitter's quota fails at once, whatever the
+// overflow policy, with an error wrapping ErrQuotaExceeded, and is counted
+// in ion_workerpool_tasks_rejected_total with reason quota_exceeded. A
+// limit of zero or less disables quotas.
+//
+// Usage:
+//
+//	pool := workerpool.New(16, 256, workerpool.WithQuota(32, func(ctx context.Context) string {
+//		return tenantFromContext(ctx)
+//	}))
+func WithQuota(limit int, key func(ctx context.Context) string) Option {
+	return func(c *config) {
+		c.quotaLimit = limit
+		c.quotaKey = key
+	}
+}
+
+// quotas counts the tasks held by each submitter under WithQuota.
+type quotas struct {
+	limit int
+	key   func(context.Context) string
+
+	mu   sync.Mutex
+	held map[string]int
+}
+
+func newQuotas(limit int, key func(context.Context) string) *quotas {
+	return &quotas{
+		limit: limit,
+		key:   key,
+		held:  make(map[string]int),
+	}
+}
+
+// acquire takes a slot for key unless it holds its limit already.
+func (q *quotas) acquire(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.held[key] >= q.limit {
+		return false
+	}
+	q.held[key]++
+	return true
+}
+
+// release returns a slot taken by acquire.
+func (q *quotas) release(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.held[key]--; q.held[key] <= 0 {
+		delete(q.held, key)
+	}
+}
+
+// acquireQuota takes a quota slot for the submitter of a submission, which
+// then holds it until releaseQuota.
+func (p *Pool) acquireQuota(ctx context.Context, submission *taskSubmission) error {
+	if p.quotas == nil {
+		return nil
+	}
+	key := p.quotas.key(ctx)
+	if key == "" {
+		return nil
+	}
+	if !p.quotas.acquire(key) {
+		p.obs.WithContext(ctx).Metrics.Inc("ion_workerpool_tasks_rejected_total",
+			"pool_name", p.name, "reason", "quota_exceeded")
+		return NewQuotaExceededError(p.name, key, p.quotas.limit)
+	}
+	submission.quotaKey = key
+	return nil
+}
+
+// releaseQuota returns the quota slot of a submission that was rejected or
+// completed for good.
+func (p *Pool) releaseQuota(submission taskSubmission) {
+	if submission.quotaKey != "" {
+		p.quotas.release(submission.quotaKey)
+	}
+}
@@ -0,0 +1,280 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Result is the outcome of a task submitted through a Results stream.
+type Result[T any] struct {
+	Seq   uint64 // submission sequence number, starting at 0
+	Value T
+	Err   error
+}
+
+// ResultsOption configures a Results stream.
+type ResultsOption func(*resultsConfig)
+
+type resultsConfig struct {
+	ordered bool
+	window  int
+}
+
+// WithOrderedResults delivers results in submission order. Tasks that finish
+// early are buffered until every earlier result has been delivered, which is
+// required when results feed an ordered downstream such as an output file.
+func WithOrderedResults() ResultsOption {
+	return func(c *resultsConfig) {
+		c.ordered = true
+	}
+}
+
+// WithResultWindow bounds how many submitted tasks may be pending or waiting
+// for delivery at once. Submit blocks while the window is full, so a slow
+// consumer, or a slow task holding back later ones in ordered mode, slows
+// down submission instead of growing the buffer. The default is the pool
+// size plus its queue size.
+func WithResultWindow(n int) ResultsOption {
+	return func(c *resultsConfig) {
+		c.window = n
+	}
+}
+
+// Results runs functions on a pool and streams their results on a channel.
+// By default results are delivered as tasks complete; see
+// WithOrderedResults for submission order.
+//
+// Usage:
+//
+//	results := workerpool.NewResults[Row](pool, workerpool.WithOrderedResults())
+//	go func() {
+//		defer results.Close()
+//		for _, id := range ids {
+//			results.Submit(ctx, func(ctx context.Context) (Row, error) {
+//				return fetch(ctx, id)
+//			})
+//		}
+//	}()
+//	for r := range results.C() {
+//		write(r.Value)
+//	}
+type Results[T any] struct {
+	pool    *Pool
+	ordered bool
+	window  chan struct{}
+	out     chan Result[T]
+	notify  chan struct{}
+
+	submitMu sync.Mutex // serializes Submit so sequence numbers stay dense
+
+	mu       sync.Mutex
+	seq      uint64
+	closed   bool
+	inflight map[uint64]struct{}  // submitted and not yet completed
+	ready    map[uint64]Result[T] // completed, waiting for delivery (ordered)
+	next     uint64               // next sequence number to deliver (ordered)
+	queue    []Result[T]          // completed, waiting for delivery (unordered)
+}
+
+// NewResults creates a results stream that runs tasks on pool. The stream
+// must be closed with Close once every task has been submitted; the channel
+// returned by C is closed after the last result has been delivered.
+func NewResults[T any](pool *Pool, opts ...ResultsOption) *Results[T] {
+	cfg := &resultsConfig{
+		window: pool.size + pool.queueSize,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.window <= 0 {
+		cfg.window = 1
+	}
+
+	r := &Results[T]{
+		pool:     pool,
+		ordered:  cfg.ordered,
+		window:   make(chan struct{}, cfg.window),
+		out:      make(chan Result[T]),
+		notify:   make(chan struct{}, 1),
+		inflight: make(map[uint64]struct{}),
+		ready:    make(map[uint64]Result[T]),
+	}
+
+	go r.deliver()
+
+	return r
+}
+
+// C returns the channel on which results are delivered.
+func (r *Results[T]) C() <-chan Result[T] {
+	return r.out
+}
+
+// Submit submits fn to the pool and returns the sequence number of its
+// result. It blocks while the result window is full and while the pool
+// queue is full, and fails if ctx is done first, if the pool is closed or if
+// the stream has been closed. No result is delivered for a failed Submit.
+//
+// If the pool is closed before a submitted task runs, its result carries a
+// pool closed error, and if it misses its deadline in EDF mode, an error
+// wrapping ErrDeadlineMissed. A task that panics delivers a *PanicError and the
+// panic is then handled by the pool as usual.
+func (r *Results[T]) Submit(ctx context.Context, fn func(context.Context) (T, error)) (uint64, error) {
+	select {
+	case r.window <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	r.submitMu.Lock()
+	defer r.submitMu.Unlock()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		<-r.window
+		return 0, NewResultsClosedError(r.pool.name)
+	}
+	seq := r.seq
+	r.inflight[seq] = struct{}{}
+	r.mu.Unlock()
+
+	err := r.pool.submit(ctx, taskSubmission{
+		task: func(ctx context.Context) error {
+			return r.run(ctx, seq, fn)
+		},
+		ctx:      ctx,
+		deadline: r.pool.deadlineOf(ctx),
+		onMiss: func(err error) {
+			r.complete(Result[T]{Seq: seq, Err: err})
+		},
+		noRetry: true,
+	})
+
+	r.mu.Lock()
+	if err != nil {
+		delete(r.inflight, seq)
+	} else {
+		r.seq++
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		<-r.window
+		r.signal()
+		return 0, err
+	}
+	return seq, nil
+}
+
+// Close stops accepting submissions. Results of tasks already submitted are
+// still delivered before the channel returned by C is closed.
+func (r *Results[T]) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.signal()
+}
+
+// run executes fn and records its result.
+func (r *Results[T]) run(ctx context.Context, seq uint64, fn func(context.Context) (T, error)) error {
+	defer func() {
+		if p := recover(); p != nil {
+			r.complete(Result[T]{Seq: seq, Err: r.pool.panicError(p)})
+			panic(p)
+		}
+	}()
+
+	v, err := fn(ctx)
+	r.complete(Result[T]{Seq: seq, Value: v, Err: err})
+	return err
+}
+
+// complete records a finished result for delivery.
+func (r *Results[T]) complete(res Result[T]) {
+	r.mu.Lock()
+	delete(r.inflight, res.Seq)
+	if r.ordered {
+		r.ready[res.Seq] = res
+	} else {
+		r.queue = append(r.queue, res)
+	}
+	r.mu.Unlock()
+	r.signal()
+}
+
+// signal wakes the delivery goroutine.
+func (r *Results[T]) signal() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliver forwards results to the output channel until the stream is closed
+// and drained.
+func (r *Results[T]) deliver() {
+	defer close(r.out)
+
+	stopped := r.pool.stopped
+	for {
+		res, ok, done := r.take()
+		if done {
+			return
+		}
+		if ok {
+			r.out <- res
+			<-r.window
+			continue
+		}
+
+		select {
+		case <-r.notify:
+		case <-stopped:
+			// Every worker has exited, so tasks still in flight were
+			// dropped from the queue and will never complete.
+			stopped = nil
+			r.failInflight()
+		}
+	}
+}
+
+// take returns the next deliverable result, if any, and whether the stream
+// is finished.
+func (r *Results[T]) take() (res Result[T], ok, done bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ordered {
+		if res, ok = r.ready[r.next]; ok {
+			delete(r.ready, r.next)
+			r.next++
+			return res, true, false
+		}
+	} else if len(r.queue) > 0 {
+		res = r.queue[0]
+		r.queue[0] = Result[T]{}
+		r.queue = r.queue[1:]
+		return res, true, false
+	}
+
+	return res, false, r.closed && len(r.inflight) == 0
+}
+
+// failInflight completes every in-flight task with a pool closed error.
+// A Submit still in progress has not taken its sequence number yet and
+// cleans up after itself.
+func (r *Results[T]) failInflight() {
+	r.mu.Lock()
+	seqs := make([]uint64, 0, len(r.inflight))
+	for seq := range r.inflight {
+		if seq < r.seq {
+			seqs = append(seqs, seq)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, seq := range seqs {
+		r.complete(Result[T]{Seq: seq, Err: NewPoolClosedError(r.pool.name)})
+	}
+}
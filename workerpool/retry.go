@@ -0,0 +1,117 @@
+package workerpool
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+)
+
+// defaultRetryBackoff is the backoff of WithRetry when none is given.
+var defaultRetryBackoff = backoff.Exponential(100 * time.Millisecond)
+
+// WithRetry runs a failed task again, up to maxAttempts times in total.
+// Unlike the Retry middleware, which waits on the worker, a failed task
+// releases its worker and is queued again once the delay given by strategy
+// has passed, exponential from 100ms if strategy is nil. A task that has
+// timed out is retried; one that panicked is not, unless RecoverPanics turns
+// the panic into an error.
+//
+// A task is not retried once its submission context is done, and tasks
+// waiting to be retried when the pool closes give up. Drain waits for
+// pending retries. Tasks of Results streams, futures and task groups are
+// never retried, since their callers get the error; retry within their
+// functions instead.
+func WithRetry(maxAttempts int, strategy backoff.Strategy) Option {
+	return func(c *config) {
+		c.retryAttempts = maxAttempts
+		c.retryBackoff = strategy
+	}
+}
+
+// WithDeadLetter sets a handler called with every task that failed for the
+// last time and its last error: after its last attempt under WithRetry, when
+// it gave up waiting to be retried, or when it missed its deadline. The
+// handler runs on the worker or retry goroutine and can log the task, alert,
+// or park it for manual replay. Tasks of Results streams, futures and task
+// groups are not dead-lettered.
+func WithDeadLetter(handler func(task Task, err error)) Option {
+	return func(c *config) {
+		c.deadLetter = handler
+	}
+}
+
+// canRetry reports whether a submission that failed gets another attempt.
+func (p *Pool) canRetry(submission taskSubmission) bool {
+	if submission.noRetry || submission.attempt+1 >= p.retryAttempts {
+		return false
+	}
+	return submission.context().Err() == nil && !p.IsClosed()
+}
+
+// retry schedules another attempt of a submission that failed with err,
+// which canRetry allowed.
+func (p *Pool) retry(submission taskSubmission, err error) {
+	submission.ctx = submission.context()
+	submission.attempt++
+	submission.backoff = p.retryBackoff(submission.attempt, submission.backoff)
+
+	atomic.AddUint64(&p.metrics.Retried, 1)
+	p.obs.WithContext(submission.ctx).Metrics.Inc("ion_workerpool_task_retries_total", "pool_name", p.name)
+	p.taskLog.Warn("task failed, retrying",
+		"pool", p.name,
+		"attempt", submission.attempt,
+		"delay", submission.backoff,
+		"error", err,
+	)
+
+	p.onEnqueue(submission)
+	go p.requeue(submission, err)
+}
+
+// requeue queues a submission again after its backoff. If the submission
+// context is done or the pool closes first, the task fails with err, the
+// error of its last attempt.
+func (p *Pool) requeue(submission taskSubmission, err error) {
+	// The task stays counted while it waits, and until enqueue counts it
+	// again, so Drain waits for it
+	defer p.end()
+
+	timer := p.clock.NewTimer(submission.backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+	case <-submission.ctx.Done():
+		p.giveUp(submission, err)
+		return
+	case <-p.closed:
+		p.giveUp(submission, err)
+		return
+	}
+
+	submission.enqueued = p.clock.Now()
+	if p.enqueue(submission.ctx, submission, nil) != nil {
+		p.giveUp(submission, err)
+	}
+}
+
+// giveUp fails a submission that was waiting to be retried.
+func (p *Pool) giveUp(submission taskSubmission, err error) {
+	p.releaseQuota(submission)
+	p.onFinish(submission, TaskEvent{Err: err})
+	p.fail(submission, err)
+}
+
+// fail records a submission that failed for the last time with err and
+// hands it to the dead letter handler.
+func (p *Pool) fail(submission taskSubmission, err error) {
+	atomic.AddUint64(&p.metrics.Failed, 1)
+	if p.deadLetter == nil || submission.noRetry {
+		return
+	}
+
+	atomic.AddUint64(&p.metrics.DeadLettered, 1)
+	p.obs.WithContext(submission.ctx).Metrics.Inc("ion_workerpool_tasks_dead_lettered_total", "pool_name", p.name)
+	p.deadLetter(submission.task, err)
+}
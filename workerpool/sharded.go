@@ -0,0 +1,231 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shardedQueue is a bounded queue split into one shard per worker, replacing
+// the task channel with WithWorkStealing. Submissions are spread over the
+// shards round-robin, so submitters and workers rarely contend on the same
+// lock; a worker takes from its own shard first and steals from the others
+// when it is empty. Each shard is FIFO, but tasks in different shards may
+// start out of submission order.
+type shardedQueue struct {
+	shards   []queueShard
+	capacity int64
+
+	size  atomic.Int64  // reserved slots, including pushes in progress
+	ready atomic.Int64  // submissions in the shards
+	next  atomic.Uint64 // shard of the next push
+
+	// Waiting workers and submitters. Whoever changes ready or size checks
+	// these after the change, and waiters check ready or size again after
+	// registering, so no wakeup is lost.
+	idle     atomic.Int64
+	blocked  atomic.Int64
+	notEmpty chan struct{}
+	notFull  chan struct{}
+}
+
+// queueShard is a FIFO of submissions guarded by its own lock.
+type queueShard struct {
+	mu    sync.Mutex
+	items []taskSubmission
+	head  int
+}
+
+func newShardedQueue(shards, capacity int) *shardedQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &shardedQueue{
+		shards:   make([]queueShard, max(shards, 1)),
+		capacity: int64(capacity),
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+	}
+}
+
+// tryPush adds sub to the next shard and reports whether there was room.
+func (q *shardedQueue) tryPush(sub taskSubmission) bool {
+	for {
+		n := q.size.Load()
+		if n >= q.capacity {
+			return false
+		}
+		if q.size.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+
+	q.shards[q.next.Add(1)%uint64(len(q.shards))].pushBack(sub)
+
+	q.ready.Add(1)
+	if q.idle.Load() > 0 {
+		wake(q.notEmpty)
+	}
+	if q.blocked.Load() > 0 && q.size.Load() < q.capacity {
+		// Pass the signal on to another submitter
+		wake(q.notFull)
+	}
+	return true
+}
+
+// push adds sub to the queue, waiting for room until ctx or closed is done
+// or expired fires.
+func (q *shardedQueue) push(ctx context.Context, sub taskSubmission, closed <-chan struct{}, expired <-chan time.Time) error {
+	for {
+		if q.tryPush(sub) {
+			return nil
+		}
+
+		q.blocked.Add(1)
+		if q.size.Load() < q.capacity {
+			q.blocked.Add(-1)
+			continue
+		}
+
+		var err error
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-closed:
+			err = errQueueClosed
+		case <-expired:
+			err = errSubmitExpired
+		}
+		q.blocked.Add(-1)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pop removes a submission for the worker with the given ID, from its own
+// shard or else stolen from another, waiting until one is available, done
+// is closed or a token is received from retire.
+func (q *shardedQueue) pop(id int, done, retire <-chan struct{}) (taskSubmission, bool) {
+	for {
+		if sub, ok := q.take(id); ok {
+			return sub, true
+		}
+
+		q.idle.Add(1)
+		if q.ready.Load() > 0 {
+			q.idle.Add(-1)
+			continue
+		}
+
+		select {
+		case <-q.notEmpty:
+			q.idle.Add(-1)
+		case <-done:
+			q.idle.Add(-1)
+			return taskSubmission{}, false
+		case <-retire:
+			q.idle.Add(-1)
+			return taskSubmission{}, false
+		}
+	}
+}
+
+// take removes the oldest submission of the worker's shard, or of the first
+// other shard that has one.
+func (q *shardedQueue) take(id int) (taskSubmission, bool) {
+	n := len(q.shards)
+	own := id % n
+	for i := 0; i < n; i++ {
+		sub, ok := q.shards[(own+i)%n].popFront()
+		if !ok {
+			continue
+		}
+
+		if q.ready.Add(-1) > 0 && q.idle.Load() > 0 {
+			// Pass the signal on to another worker
+			wake(q.notEmpty)
+		}
+		q.size.Add(-1)
+		if q.blocked.Load() > 0 {
+			wake(q.notFull)
+		}
+		return sub, true
+	}
+	return taskSubmission{}, false
+}
+
+// dropOldest removes the submission queued first among the shards.
+func (q *shardedQueue) dropOldest() (taskSubmission, bool) {
+	for {
+		oldest := -1
+		var at time.Time
+		for i := range q.shards {
+			if t, ok := q.shards[i].front(); ok && (oldest < 0 || t.Before(at)) {
+				oldest, at = i, t
+			}
+		}
+		if oldest < 0 {
+			return taskSubmission{}, false
+		}
+
+		// The shard may have changed since, which at worst drops a newer
+		// submission, or none if a worker emptied it
+		if sub, ok := q.shards[oldest].popFront(); ok {
+			q.ready.Add(-1)
+			q.size.Add(-1)
+			return sub, true
+		}
+	}
+}
+
+// len returns the number of queued submissions.
+func (q *shardedQueue) len() int {
+	return int(max(q.ready.Load(), 0))
+}
+
+// pushBack appends sub to the shard, moving the submissions down over the
+// removed ones first if that avoids growing it.
+func (s *queueShard) pushBack(sub taskSubmission) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.head > 0 && len(s.items) == cap(s.items) {
+		n := copy(s.items, s.items[s.head:])
+		clear(s.items[n:])
+		s.items = s.items[:n]
+		s.head = 0
+	}
+	s.items = append(s.items, sub)
+}
+
+// front returns the enqueue time of the oldest submission of the shard.
+func (s *queueShard) front() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.head == len(s.items) {
+		return time.Time{}, false
+	}
+	return s.items[s.head].enqueued, true
+}
+
+// popFront removes the oldest submission of the shard.
+func (s *queueShard) popFront() (taskSubmission, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.head == len(s.items) {
+		return taskSubmission{}, false
+	}
+	sub := s.items[s.head]
+	s.items[s.head] = taskSubmission{}
+	s.head++
+	if s.head == len(s.items) {
+		s.items = s.items[:0]
+		s.head = 0
+	}
+	return sub, true
+}
@@ -0,0 +1,154 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Run blocks until ctx is done, then drains the pool for up to the drain
+// timeout set with WithDrainTimeout, 30s by default, and closes it, by force
+// if the drain timed out. It returns nil once every task finished, or the
+// drain and close errors, so a pool fits the service skeletons built on
+// errgroup and similar run groups. Run returns nil at once if the pool is
+// closed by other means first.
+//
+// For a shutdown on SIGINT or SIGTERM, pass a context from
+// signal.NotifyContext, or use ShutdownOnSignal for a separate grace period
+// and a report.
+//
+// Usage:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+//	defer stop()
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.Go(func() error { return pool.Run(ctx) })
+//	g.Go(func() error { return serve(ctx, pool) })
+//	return g.Wait()
+func (p *Pool) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-p.closed:
+		return nil
+	}
+
+	p.obs.WithContext(ctx).Logger.Info("context done, stopping workerpool",
+		"pool", p.name, "cause", context.Cause(ctx))
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), p.drainTimeout)
+	defer cancel()
+	err := p.Drain(drainCtx)
+	if err == nil || p.IsClosed() {
+		return err
+	}
+
+	// The drain timed out and left the pool draining
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), p.drainTimeout)
+	defer closeCancel()
+	return errors.Join(err, p.close(closeCtx))
+}
+
+// ShutdownReport describes a shutdown performed by ShutdownOnSignal.
+type ShutdownReport struct {
+	Signal    os.Signal     // signal that triggered the shutdown, nil if ctx was done first
+	Drained   bool          // every queued and running task finished within the grace period
+	Duration  time.Duration // time from the shutdown trigger until the pool was closed
+	Completed uint64        // tasks completed during the shutdown
+	Failed    uint64        // tasks failed during the shutdown
+	Abandoned int64         // queued tasks that never ran
+}
+
+// ShutdownOnSignal blocks until one of signals is received, SIGINT or
+// SIGTERM by default, or until ctx is done. It then stops accepting new
+// tasks and lets queued and running tasks finish for up to grace. Once the
+// grace period expires, or a second signal arrives, the pool is closed by
+// force: running tasks see their context canceled and queued tasks are
+// abandoned. Closing waits for running tasks for at most the drain timeout.
+//
+// The returned error joins a grace period timeout with any error from
+// Close; the report is filled in either way.
+//
+// In an errgroup, pass the group's context so the pool also shuts down when
+// another member fails.
+//
+// Usage:
+//
+//	go server.ListenAndServe()
+//	report, err := pool.ShutdownOnSignal(context.Background(), 30*time.Second)
+//	log.Printf("shutdown: drained=%v abandoned=%d in %v", report.Drained, report.Abandoned, report.Duration)
+func (p *Pool) ShutdownOnSignal(ctx context.Context, grace time.Duration, signals ...os.Signal) (ShutdownReport, error) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, signals...)
+	defer signal.Stop(sigCh)
+
+	var report ShutdownReport
+	select {
+	case report.Signal = <-sigCh:
+	case <-ctx.Done():
+	}
+
+	start := p.clock.Now()
+	before := p.Metrics()
+	obs := p.obs.WithContext(ctx)
+	obs.Logger.Info("shutting down workerpool",
+		"pool", p.name,
+		"signal", report.Signal,
+		"grace", grace,
+		"queued", before.Queued,
+		"running", before.Running,
+	)
+
+	p.draining.Store(true)
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-sigCh:
+			obs.Logger.Warn("second signal received, forcing shutdown",
+				"pool", p.name, "signal", sig)
+			cancel()
+		case <-graceCtx.Done():
+		}
+	}()
+
+	var errs []error
+	report.Drained = true
+	if err := p.waitIdle(graceCtx); err != nil {
+		// Close reports a pool closed by other means
+		if !errors.Is(err, ErrPoolClosed) {
+			errs = append(errs, NewShutdownTimeoutError(p.name, "shutdown", err))
+		}
+		report.Drained = false
+	}
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), p.drainTimeout)
+	defer closeCancel()
+	if err := p.Close(closeCtx); err != nil {
+		errs = append(errs, err)
+	}
+
+	after := p.Metrics()
+	report.Duration = p.clock.Since(start)
+	report.Completed = after.Completed - before.Completed
+	report.Failed = after.Failed - before.Failed
+	report.Abandoned = after.Queued
+
+	obs.Logger.Info("workerpool shut down",
+		"pool", p.name,
+		"drained", report.Drained,
+		"duration", report.Duration,
+		"completed", report.Completed,
+		"failed", report.Failed,
+		"abandoned", report.Abandoned,
+	)
+
+	return report, errors.Join(errs...)
+}
@@ -3,18 +3,90 @@ package workerpool
 import (
 	"context"
 	"errors"
-	"sync/atomic"
+	"strconv"
+	"time"
 )
 
 // Submit submits a task to the pool for execution. It respects the provided context
 // for cancellation and timeouts. If the context is canceled before the task can be
 // queued, it returns the context error wrapped. If the pool is closed or draining,
 // it returns an appropriate error.
+//
+// In EDF mode the context deadline is also the task deadline; see
+// SubmitWithDeadline.
 func (p *Pool) Submit(ctx context.Context, task Task) error {
-	if task == nil {
+	return p.submit(ctx, taskSubmission{
+		task:     task,
+		ctx:      ctx,
+		deadline: p.deadlineOf(ctx),
+	})
+}
+
+// SubmitWithDeadline submits a task that must start by deadline. A task
+// whose deadline has already passed is rejected with an error wrapping
+// ErrDeadlineMissed, and a queued task whose deadline passes before a worker
+// picks it up is dropped and counted as failed instead of being run late. In
+// EDF mode the most urgent queued task runs next.
+func (p *Pool) SubmitWithDeadline(ctx context.Context, task Task, deadline time.Time) error {
+	return p.submit(ctx, taskSubmission{
+		task:     task,
+		ctx:      ctx,
+		deadline: deadline,
+	})
+}
+
+// SubmitWithPriority submits a task with a priority. In priority mode, see
+// WithPriority, queued tasks with a higher priority run first; otherwise
+// the priority is ignored.
+func (p *Pool) SubmitWithPriority(ctx context.Context, task Task, priority int) error {
+	return p.submit(ctx, taskSubmission{
+		task:     task,
+		ctx:      ctx,
+		deadline: p.deadlineOf(ctx),
+		priority: priority,
+	})
+}
+
+// SubmitWithTimeout submits a task that may run for at most timeout once a
+// worker starts it, overriding the pool's WithTaskTimeout. A task still
+// running when the timeout expires has its context canceled with cause
+// ErrTaskTimeout and is counted as failed. A timeout of zero or less uses
+// the pool's.
+func (p *Pool) SubmitWithTimeout(ctx context.Context, task Task, timeout time.Duration) error {
+	return p.submit(ctx, taskSubmission{
+		task:     task,
+		ctx:      ctx,
+		deadline: p.deadlineOf(ctx),
+		timeout:  timeout,
+	})
+}
+
+// SubmitWithInfo submits a task identified by info, reported to the pool's
+// TaskHooks and available to the task through TaskInfoFromContext. It is
+// equivalent to Submit with ContextWithTaskInfo(ctx, info).
+func (p *Pool) SubmitWithInfo(ctx context.Context, task Task, info TaskInfo) error {
+	return p.Submit(ContextWithTaskInfo(ctx, info), task)
+}
+
+// deadlineOf returns the task deadline implied by a submission context.
+func (p *Pool) deadlineOf(ctx context.Context) time.Time {
+	if !p.edf {
+		return time.Time{}
+	}
+	return taskDeadline(ctx)
+}
+
+// submit queues a submission, blocking until there is room.
+func (p *Pool) submit(ctx context.Context, submission taskSubmission) (err error) {
+	if submission.task == nil {
 		return errors.New("ion: nil task")
 	}
 
+	// Counted before the draining check, so that Drain waits for a
+	// submission that gets past it; enqueue counts the task itself
+	p.begin()
+	defer p.end()
+
 	// Check if pool is closed
 	select {
 	case <-p.closed:
@@ -27,12 +99,62 @@ func (p *Pool) Submit(ctx context.Context, task Task) error {
 		return NewPoolClosedError(p.name)
 	}
 
-	submission := taskSubmission{
-		task: task,
-		ctx:  ctx,
+	if err := p.checkDeadline(submission); err != nil {
+		return err
 	}
 
-	p.obs.Metrics.Inc("ion_workerpool_tasks_submitted_total", "pool_name", p.name)
+	if err := p.acquireQuota(ctx, &submission); err != nil {
+		return err
+	}
+
+	p.obs.WithContext(ctx).Metrics.Inc("ion_workerpool_tasks_submitted_total", "pool_name", p.name)
+
+	submission.info, _ = TaskInfoFromContext(ctx)
+	p.onEnqueue(submission)
+	defer func() {
+		if err != nil {
+			p.releaseQuota(submission)
+			p.onFinish(submission, TaskEvent{Err: err})
+		}
+	}()
+
+	submission.enqueued = p.clock.Now()
+	return p.place(ctx, submission, true)
+}
+
+// enqueue queues a checked submission, blocking until there is room or
+// expired fires. The task is counted by begin from then on, until it
+// completes for good.
+func (p *Pool) enqueue(ctx context.Context, submission taskSubmission, expired <-chan time.Time) (err error) {
+	p.begin()
+	defer func() {
+		if err != nil {
+			p.end()
+		}
+	}()
+
+	if p.inline {
+		// executeTask ends the task
+		p.executeTask(submission, callerWorker, nil)
+		return nil
+	}
+
+	if p.queue != nil || p.shards != nil {
+		var err error
+		if p.shards != nil {
+			err = p.shards.push(ctx, submission, p.closed, expired)
+		} else {
+			err = p.queue.push(ctx, submission, p.closed, expired)
+		}
+		if err != nil {
+			if err == errQueueClosed {
+				return NewPoolClosedError(p.name)
+			}
+			return err
+		}
+		p.queued(submission)
+		return nil
+	}
 
 	// Acquire read lock to prevent Close() from closing taskCh while we're sending
 	p.taskMu.RLock()
@@ -48,8 +170,7 @@ func (p *Pool) Submit(ctx context.Context, task Task) error {
 	// Try to submit the task, respecting context cancellation and pool closure
 	select {
 	case p.taskCh <- submission:
-		atomic.AddInt64(&p.metrics.Queued, 1)
-		p.obs.Metrics.Gauge("ion_workerpool_queue_size", float64(atomic.LoadInt64(&p.metrics.Queued)), "pool_name", p.name)
+		p.queued(submission)
 		return nil
 
 	case <-ctx.Done():
@@ -57,18 +178,78 @@ func (p *Pool) Submit(ctx context.Context, task Task) error {
 
 	case <-p.closed:
 		return NewPoolClosedError(p.name)
+
+	case <-expired:
+		return errSubmitExpired
 	}
 }
 
+// checkDeadline rejects a submission whose deadline has already passed.
+func (p *Pool) checkDeadline(submission taskSubmission) error {
+	if submission.deadline.IsZero() {
+		return nil
+	}
+	if now := p.clock.Now(); !now.Before(submission.deadline) {
+		p.obs.Metrics.Inc("ion_workerpool_tasks_rejected_total",
+			"pool_name", p.name, "reason", "deadline_missed")
+		return NewDeadlineMissedError(p.name, "submit", now.Sub(submission.deadline))
+	}
+	return nil
+}
+
+// queued records a submission entering the queue.
+func (p *Pool) queued(submission taskSubmission) {
+	n := p.queueLen()
+	p.obs.Metrics.Gauge("ion_workerpool_queue_size", float64(n), "pool_name", p.name)
+	p.recordQueueLen(n)
+	if p.priority {
+		p.recordPriorityQueued(submission.priority)
+	}
+	p.metricsChanged()
+}
+
+// dequeued records a submission leaving the queue in priority mode.
+func (p *Pool) dequeued(submission taskSubmission) {
+	p.recordPriorityQueued(submission.priority)
+	p.obs.WithContext(submission.ctx).Metrics.Histogram("ion_workerpool_priority_wait_seconds",
+		p.clock.Since(submission.enqueued).Seconds(),
+		"pool_name", p.name, "priority", strconv.Itoa(submission.priority))
+}
+
+// recordPriorityQueued reports the number of tasks queued at priority.
+func (p *Pool) recordPriorityQueued(priority int) {
+	p.obs.Metrics.Gauge("ion_workerpool_priority_queued", float64(p.queue.len(priority)),
+		"pool_name", p.name, "priority", strconv.Itoa(priority))
+}
+
 // TrySubmit attempts to submit a task to the pool without blocking.
 // It returns true if the task was successfully queued, false if the queue is full
 // or the pool is closed/draining. It does not respect context cancellation since
 // it returns immediately.
 func (p *Pool) TrySubmit(task Task) error {
+	return p.trySubmit(task, 0)
+}
+
+// TrySubmitTimeout attempts to submit a task, waiting up to timeout for room
+// in the queue. If the queue stays full it returns an error wrapping
+// ErrQueueFull, never a context error, so backpressure is told apart from
+// cancellation without a context per submission. A timeout of zero or less
+// does not wait, like TrySubmit.
+func (p *Pool) TrySubmitTimeout(task Task, timeout time.Duration) error {
+	return p.trySubmit(task, timeout)
+}
+
+// trySubmit queues a task if there is room, or else waits up to timeout for
+// room if it is positive.
+func (p *Pool) trySubmit(task Task, timeout time.Duration) (err error) {
 	if task == nil {
 		return errors.New("ion: nil task")
 	}
 
+	// Counted like in submit, so that Drain waits for it
+	p.begin()
+	defer p.end()
+
 	// Check if pool is closed
 	select {
 	case <-p.closed:
@@ -82,8 +263,70 @@ func (p *Pool) TrySubmit(task Task) error {
 	}
 
 	submission := taskSubmission{
-		task: task,
-		ctx:  context.Background(), // TrySubmit uses background context
+		task:     task,
+		ctx:      context.Background(), // TrySubmit uses background context
+		enqueued: p.clock.Now(),
+	}
+	if err := p.acquireQuota(submission.ctx, &submission); err != nil {
+		return err
+	}
+
+	p.onEnqueue(submission)
+	defer func() {
+		if err != nil {
+			p.releaseQuota(submission)
+			p.onFinish(submission, TaskEvent{Err: err})
+		}
+	}()
+
+	if timeout <= 0 {
+		if err = p.place(submission.ctx, submission, false); err != nil {
+			return err
+		}
+		p.obs.Metrics.Inc("ion_workerpool_tasks_submitted_total", "pool_name", p.name)
+		return nil
+	}
+
+	p.begin()
+	err = p.tryEnqueue(submission)
+	if err == nil {
+		p.obs.Metrics.Inc("ion_workerpool_tasks_submitted_total", "pool_name", p.name)
+		p.queued(submission)
+		return nil
+	}
+	p.end()
+	if !errors.Is(err, ErrQueueFull) {
+		return err
+	}
+
+	timer := p.clock.NewTimer(timeout)
+	defer timer.Stop()
+
+	if err := p.enqueue(submission.ctx, submission, timer.C()); err != nil {
+		if err == errSubmitExpired {
+			p.obs.Metrics.Inc("ion_workerpool_tasks_rejected_total",
+				"pool_name", p.name, "reason", "queue_full")
+			return NewSubmitTimeoutError(p.name, p.queueSize, timeout)
+		}
+		return err
+	}
+	p.obs.Metrics.Inc("ion_workerpool_tasks_submitted_total", "pool_name", p.name)
+	return nil
+}
+
+// tryEnqueue queues a checked submission if there is room.
+func (p *Pool) tryEnqueue(submission taskSubmission) error {
+	if p.queue != nil || p.shards != nil {
+		var ok bool
+		if p.shards != nil {
+			ok = p.shards.tryPush(submission)
+		} else {
+			ok = p.queue.tryPush(submission)
+		}
+		if !ok {
+			return NewQueueFullError(p.name, p.queueSize)
+		}
+		return nil
 	}
 
 	// Acquire read lock to prevent Close() from closing taskCh while we're sending
@@ -100,9 +343,6 @@ func (p *Pool) TrySubmit(task Task) error {
 	// Try to submit without blocking
 	select {
 	case p.taskCh <- submission:
-		atomic.AddInt64(&p.metrics.Queued, 1)
-		p.obs.Metrics.Inc("ion_workerpool_tasks_submitted_total", "pool_name", p.name)
-		p.obs.Metrics.Gauge("ion_workerpool_queue_size", float64(atomic.LoadInt64(&p.metrics.Queued)), "pool_name", p.name)
 		return nil
 
 	default:
@@ -0,0 +1,124 @@
+package workerpool
+
+import (
+	"context"
+	"time"
+
+	"github.com/kolosys/ion/observe"
+)
+
+// TaskInfo identifies the business operation a task performs, for logs,
+// traces and lifecycle hooks.
+type TaskInfo struct {
+	ID     string            // e.g. an order or request ID
+	Name   string            // kind of operation, e.g. "send-invoice"
+	Labels map[string]string // free-form attributes, e.g. a tenant
+}
+
+// taskInfoKey is the context key for the TaskInfo.
+type taskInfoKey struct{}
+
+// ContextWithTaskInfo returns a copy of ctx carrying info. A task submitted
+// with the returned context, with any Submit variant, is reported to the
+// lifecycle hooks with info, and its own context carries info for
+// TaskInfoFromContext. If ctx carries no correlation ID, info.ID becomes
+// the correlation ID, so pool log lines and spans for the task carry it.
+func ContextWithTaskInfo(ctx context.Context, info TaskInfo) context.Context {
+	if _, ok := observe.CorrelationID(ctx); !ok && info.ID != "" {
+		ctx = observe.WithCorrelationID(ctx, info.ID)
+	}
+	return context.WithValue(ctx, taskInfoKey{}, info)
+}
+
+// TaskInfoFromContext returns the TaskInfo carried by ctx, if any.
+func TaskInfoFromContext(ctx context.Context) (TaskInfo, bool) {
+	if ctx == nil {
+		return TaskInfo{}, false
+	}
+	info, ok := ctx.Value(taskInfoKey{}).(TaskInfo)
+	return info, ok
+}
+
+// TaskEvent describes a step in the lifecycle of a task, see TaskHooks.
+type TaskEvent struct {
+	Info    TaskInfo // zero if the task was submitted without one
+	Attempt int      // 1 for the first attempt, more when retried
+
+	// Set on start and finish, for tasks that ran
+	Worker int
+	Wait   time.Duration // from being queued to starting
+
+	// Set on finish
+	Duration time.Duration // running time
+	Err      error         // nil on success
+	Retry    bool          // whether the task will be retried
+}
+
+// TaskHooks are called as tasks move through the pool, for correlating a
+// business operation with its execution. Hooks run synchronously on the
+// submitting or worker goroutine and must be fast. Nil hooks are skipped.
+//
+// Every OnEnqueue is followed by exactly one OnFinish: after the task ran,
+// or with the error if it could not be queued, missed its deadline or gave
+// up waiting to be retried. OnStart comes in between for tasks that run.
+type TaskHooks struct {
+	OnEnqueue func(ctx context.Context, ev TaskEvent)
+	OnStart   func(ctx context.Context, ev TaskEvent)
+	OnFinish  func(ctx context.Context, ev TaskEvent)
+}
+
+// WithTaskHooks sets hooks called on the lifecycle events of every task.
+//
+// Usage:
+//
+//	pool := workerpool.New(8, 64, workerpool.WithTaskHooks(workerpool.TaskHooks{
+//		OnFinish: func(ctx context.Context, ev workerpool.TaskEvent) {
+//			log.Printf("task %s (%s) finished in %v: %v",
+//				ev.Info.ID, ev.Info.Name, ev.Duration, ev.Err)
+//		},
+//	}))
+//	pool.SubmitWithInfo(ctx, sendInvoice, workerpool.TaskInfo{ID: orderID, Name: "send-invoice"})
+func WithTaskHooks(hooks TaskHooks) Option {
+	return func(c *config) {
+		c.hooks = hooks
+	}
+}
+
+// event returns the base event of a submission.
+func (s *taskSubmission) event() TaskEvent {
+	return TaskEvent{Info: s.info, Attempt: s.attempt + 1}
+}
+
+// onEnqueue reports a submission about to be queued.
+func (p *Pool) onEnqueue(submission taskSubmission) {
+	if p.hooks.OnEnqueue != nil {
+		p.hooks.OnEnqueue(submission.context(), submission.event())
+	}
+}
+
+// onStart reports a submission starting on a worker.
+func (p *Pool) onStart(submission taskSubmission, worker int, wait time.Duration) {
+	if p.hooks.OnStart != nil {
+		ev := submission.event()
+		ev.Worker, ev.Wait = worker, wait
+		p.hooks.OnStart(submission.context(), ev)
+	}
+}
+
+// onFinish reports the end of an attempt. ev is completed with the
+// submission's info and attempt.
+func (p *Pool) onFinish(submission taskSubmission, ev TaskEvent) {
+	if p.hooks.OnFinish != nil {
+		ev.Info, ev.Attempt = submission.info, submission.attempt+1
+		p.hooks.OnFinish(submission.context(), ev)
+	}
+}
+
+// context returns the submission context, or the background context if it
+// has none.
+func (s *taskSubmission) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
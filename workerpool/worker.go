@@ -0,0 +1,98 @@
+package workerpool
+
+import (
+	"context"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+)
+
+// workerInitBackoff spaces out the attempts of a worker whose init fails.
+var workerInitBackoff = backoff.Cap(backoff.Exponential(100*time.Millisecond), 10*time.Second)
+
+// WithWorkerInit sets a function called by every worker as it starts,
+// including workers added by WithAutoscale, to create the state it owns,
+// such as a database connection or a CGO handle that must stay on one
+// goroutine. Tasks get the state of the worker running them with
+// WorkerState.
+//
+// A worker whose init fails logs the error and tries again with a backoff
+// from 100ms up to 10s, taking no tasks until it succeeds, so a failing
+// dependency leaves tasks queued rather than running without their state.
+func WithWorkerInit(init func(workerID int) (any, error)) Option {
+	return func(c *config) {
+		c.workerInit = init
+	}
+}
+
+// WithWorkerCleanup sets a function called by every worker as it exits,
+// when the pool closes or the autoscaler retires it, with the state created
+// by WithWorkerInit, or nil without one. Close waits for it to return.
+func WithWorkerCleanup(cleanup func(workerID int, state any)) Option {
+	return func(c *config) {
+		c.workerCleanup = cleanup
+	}
+}
+
+// workerStateKey is the context key for the state of a worker.
+type workerStateKey struct{}
+
+// WorkerState returns the state created by WithWorkerInit for the worker
+// running the task whose context is ctx. It returns false if the pool has no
+// worker init.
+//
+// Usage:
+//
+//	pool := workerpool.New(4, 64, workerpool.WithWorkerInit(func(id int) (any, error) {
+//		return sql.Open("postgres", dsn)
+//	}), workerpool.WithWorkerCleanup(func(id int, state any) {
+//		state.(*sql.DB).Close()
+//	}))
+//	pool.Submit(ctx, func(ctx context.Context) error {
+//		db, _ := workerpool.WorkerState(ctx)
+//		return insert(ctx, db.(*sql.DB), row)
+//	})
+func WorkerState(ctx context.Context) (any, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	ws, ok := ctx.Value(workerStateKey{}).(workerState)
+	return ws.state, ok
+}
+
+// workerState wraps the state of a worker so a nil state is still found.
+type workerState struct {
+	state any
+}
+
+// initWorker runs the worker init until it succeeds. It returns false if
+// the pool closes or the worker is retired first.
+func (p *Pool) initWorker(id int) (any, bool) {
+	delays := workerInitBackoff.Sequence()
+	for {
+		state, err := p.workerInit(id)
+		if err == nil {
+			return state, true
+		}
+
+		delay := delays.Next()
+		p.obs.Metrics.Inc("ion_workerpool_worker_init_failures_total", "pool_name", p.name)
+		p.taskLog.Error("worker init failed", err,
+			"pool", p.name,
+			"worker_id", id,
+			"attempt", delays.Attempt(),
+			"retry_in", delay,
+		)
+
+		timer := p.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-p.baseCtx.Done():
+			timer.Stop()
+			return nil, false
+		case <-p.retire:
+			timer.Stop()
+			return nil, false
+		}
+	}
+}
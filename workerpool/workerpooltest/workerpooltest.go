@@ -0,0 +1,222 @@
+// Package workerpooltest provides pools and assertions for testing code
+// that uses a workerpool.Pool without sleeping.
+//
+// NewInline returns a pool that runs every task before Submit returns, for
+// tests that only care about the outcome of the tasks. NewControlled returns
+// a pool whose tasks wait until the test releases them, for tests of what
+// happens while tasks are queued or running. The Assert functions wait for
+// the pool metrics to reach the expected values, since workers update them
+// asynchronously; they are woken by the pool on every update, see
+// workerpool.Pool.WaitMetrics, and never sleep.
+//
+// Usage:
+//
+//	pool, ctrl := workerpooltest.NewControlled(1, 10)
+//	defer pool.Close(context.Background())
+//	svc := NewService(pool)
+//	svc.Enqueue(ctx, job)
+//	ctrl.WaitHeld(ctx, 1)
+//	// assert on the service while the job is running
+//	ctrl.ReleaseAll()
+//	workerpooltest.AssertCompleted(t, pool, 1)
+package workerpooltest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/workerpool"
+)
+
+// Timeout is how long the Assert functions wait for the expected metrics
+// before failing the test.
+var Timeout = 5 * time.Second
+
+// NewInline returns a pool that runs every task on the submitting
+// goroutine before Submit returns, see workerpool.WithInline.
+func NewInline(opts ...workerpool.Option) *workerpool.Pool {
+	return workerpool.New(1, 0, append(opts, workerpool.WithInline())...)
+}
+
+// Controller holds the tasks of a pool created by NewControlled once a
+// worker starts them, until the test releases them.
+type Controller struct {
+	mu      sync.Mutex
+	held    int
+	tokens  int
+	open    bool
+	changed chan struct{} // closed and replaced on every change
+}
+
+// NewControlled returns a pool of size workers and queueSize queued tasks
+// whose tasks wait for their release by the returned Controller before
+// running. A held task occupies its worker, so at most size tasks are held
+// at once and the others stay queued. A held task whose context is done
+// returns the context error without running.
+func NewControlled(size, queueSize int, opts ...workerpool.Option) (*workerpool.Pool, *Controller) {
+	c := &Controller{changed: make(chan struct{})}
+	opts = append(opts, workerpool.WithMiddleware(c.middleware))
+	return workerpool.New(size, queueSize, opts...), c
+}
+
+// middleware holds every task until it is released.
+func (c *Controller) middleware(next workerpool.Task) workerpool.Task {
+	return func(ctx context.Context) error {
+		if err := c.hold(ctx); err != nil {
+			return err
+		}
+		return next(ctx)
+	}
+}
+
+// hold waits for a release or for ctx to be done.
+func (c *Controller) hold(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.held++
+	c.notifyLocked()
+	defer func() {
+		c.held--
+		c.notifyLocked()
+	}()
+
+	for !c.open && c.tokens == 0 {
+		changed := c.changed
+		c.mu.Unlock()
+		select {
+		case <-changed:
+			c.mu.Lock()
+		case <-ctx.Done():
+			c.mu.Lock()
+			return ctx.Err()
+		}
+	}
+	if !c.open {
+		c.tokens--
+	}
+	return nil
+}
+
+// notifyLocked wakes the goroutines waiting for a change.
+func (c *Controller) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Held returns the number of tasks waiting for their release.
+func (c *Controller) Held() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.held
+}
+
+// WaitHeld blocks until at least n tasks wait for their release, or ctx is
+// done.
+func (c *Controller) WaitHeld(ctx context.Context, n int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.held < n {
+		changed := c.changed
+		c.mu.Unlock()
+		select {
+		case <-changed:
+			c.mu.Lock()
+		case <-ctx.Done():
+			c.mu.Lock()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Release lets n tasks run, held ones first and then the next ones to
+// start.
+func (c *Controller) Release(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens += n
+	c.notifyLocked()
+}
+
+// ReleaseAll lets every held and future task run.
+func (c *Controller) ReleaseAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.open = true
+	c.notifyLocked()
+}
+
+// AssertMetrics waits up to Timeout for the metrics of pool to satisfy
+// cond, and fails the test with the last metrics otherwise. It reports
+// whether cond was satisfied.
+func AssertMetrics(t testing.TB, pool *workerpool.Pool, cond func(m workerpool.PoolMetrics) bool) bool {
+	t.Helper()
+
+	m, ok := wait(pool, cond)
+	if ok {
+		return true
+	}
+	t.Errorf("pool metrics did not reach the expected values within %v, got %+v", Timeout, m)
+	return false
+}
+
+// AssertCompleted waits for pool to have completed n tasks.
+func AssertCompleted(t testing.TB, pool *workerpool.Pool, n uint64) bool {
+	t.Helper()
+	return expect(t, pool, "completed", n, func(m workerpool.PoolMetrics) uint64 { return m.Completed })
+}
+
+// AssertFailed waits for pool to have failed n tasks.
+func AssertFailed(t testing.TB, pool *workerpool.Pool, n uint64) bool {
+	t.Helper()
+	return expect(t, pool, "failed", n, func(m workerpool.PoolMetrics) uint64 { return m.Failed })
+}
+
+// AssertPanicked waits for n tasks of pool to have panicked.
+func AssertPanicked(t testing.TB, pool *workerpool.Pool, n uint64) bool {
+	t.Helper()
+	return expect(t, pool, "panicked", n, func(m workerpool.PoolMetrics) uint64 { return m.Panicked })
+}
+
+// AssertQueued waits for pool to have n tasks queued.
+func AssertQueued(t testing.TB, pool *workerpool.Pool, n int64) bool {
+	t.Helper()
+	return expect(t, pool, "queued", n, func(m workerpool.PoolMetrics) int64 { return m.Queued })
+}
+
+// AssertRunning waits for pool to have n tasks running.
+func AssertRunning(t testing.TB, pool *workerpool.Pool, n int64) bool {
+	t.Helper()
+	return expect(t, pool, "running", n, func(m workerpool.PoolMetrics) int64 { return m.Running })
+}
+
+// expect waits up to Timeout for a metric of pool to equal want.
+func expect[N comparable](t testing.TB, pool *workerpool.Pool, name string, want N, metric func(workerpool.PoolMetrics) N) bool {
+	t.Helper()
+
+	m, ok := wait(pool, func(m workerpool.PoolMetrics) bool {
+		return metric(m) == want
+	})
+	if ok {
+		return true
+	}
+	got := metric(m)
+	t.Errorf("expected %v %s tasks within %v, got %v", want, name, Timeout, got)
+	return false
+}
+
+// wait waits up to Timeout for the metrics of pool to satisfy cond. It
+// returns the last metrics and whether cond was satisfied.
+func wait(pool *workerpool.Pool, cond func(workerpool.PoolMetrics) bool) (workerpool.PoolMetrics, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	m, err := pool.WaitMetrics(ctx, cond)
+	return m, err == nil
+}
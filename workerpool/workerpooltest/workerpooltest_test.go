@@ -0,0 +1,166 @@
+package workerpooltest_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolosys/ion/backoff"
+	"github.com/kolosys/ion/workerpool"
+	"github.com/kolosys/ion/workerpool/workerpooltest"
+)
+
+func TestNewInline(t *testing.T) {
+	t.Run("runs tasks before submit returns", func(t *testing.T) {
+		pool := workerpooltest.NewInline()
+		defer pool.Close(context.Background())
+
+		var ran bool
+		if err := pool.Submit(context.Background(), func(ctx context.Context) error {
+			ran = true
+			return nil
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ran {
+			t.Error("expected the task to run before Submit returned")
+		}
+		if err := pool.TrySubmit(func(ctx context.Context) error { return errors.New("boom") }); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if m := pool.Metrics(); m.Completed != 1 || m.Failed != 1 || m.Size != 0 {
+			t.Errorf("unexpected metrics: %+v", m)
+		}
+	})
+
+	t.Run("futures resolve at once", func(t *testing.T) {
+		pool := workerpooltest.NewInline()
+		defer pool.Close(context.Background())
+
+		f := workerpool.SubmitFunc(pool, context.Background(), func(ctx context.Context) (int, error) {
+			return 42, nil
+		})
+		select {
+		case <-f.Done():
+		default:
+			t.Fatal("expected the future to be resolved")
+		}
+		if v, err := f.Wait(context.Background()); v != 42 || err != nil {
+			t.Errorf("expected 42, got %v, %v", v, err)
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		pool := workerpooltest.NewInline(workerpool.WithRetry(3, backoff.Constant(time.Millisecond)))
+		defer pool.Close(context.Background())
+
+		var attempts atomic.Int32
+		pool.Submit(context.Background(), func(ctx context.Context) error {
+			if attempts.Add(1) < 3 {
+				return errors.New("boom")
+			}
+			return nil
+		})
+		workerpooltest.AssertCompleted(t, pool, 1)
+		if n := attempts.Load(); n != 3 {
+			t.Errorf("expected 3 attempts, got %d", n)
+		}
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		pool := workerpooltest.NewInline()
+		pool.Submit(context.Background(), func(ctx context.Context) error { return nil })
+		if err := pool.Drain(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestNewControlled(t *testing.T) {
+	t.Run("holds tasks until released", func(t *testing.T) {
+		pool, ctrl := workerpooltest.NewControlled(2, 10)
+		defer pool.Close(context.Background())
+
+		var ran atomic.Int32
+		for i := 0; i < 3; i++ {
+			pool.Submit(context.Background(), func(ctx context.Context) error {
+				ran.Add(1)
+				return nil
+			})
+		}
+
+		if err := ctrl.WaitHeld(context.Background(), 2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		workerpooltest.AssertQueued(t, pool, 1)
+		workerpooltest.AssertRunning(t, pool, 2)
+		if n := ran.Load(); n != 0 {
+			t.Errorf("expected no task to run, got %d", n)
+		}
+
+		ctrl.Release(1)
+		workerpooltest.AssertCompleted(t, pool, 1)
+		if err := ctrl.WaitHeld(context.Background(), 2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		workerpooltest.AssertQueued(t, pool, 0)
+
+		ctrl.ReleaseAll()
+		workerpooltest.AssertCompleted(t, pool, 3)
+		if n := ctrl.Held(); n != 0 {
+			t.Errorf("expected no held task, got %d", n)
+		}
+	})
+
+	t.Run("close cancels held tasks", func(t *testing.T) {
+		pool, ctrl := workerpooltest.NewControlled(1, 1)
+		pool.Submit(context.Background(), func(ctx context.Context) error { return nil })
+		ctrl.WaitHeld(context.Background(), 1)
+
+		if err := pool.Close(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		workerpooltest.AssertFailed(t, pool, 1)
+	})
+
+	t.Run("wait held honors the context", func(t *testing.T) {
+		_, ctrl := workerpooltest.NewControlled(1, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := ctrl.WaitHeld(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the context error, got %v", err)
+		}
+	})
+}
+
+func TestAssertMetrics(t *testing.T) {
+	pool := workerpooltest.NewInline()
+	defer pool.Close(context.Background())
+
+	pool.Submit(context.Background(), func(ctx context.Context) error { panic("boom") })
+	workerpooltest.AssertPanicked(t, pool, 1)
+	workerpooltest.AssertMetrics(t, pool, func(m workerpool.PoolMetrics) bool {
+		return m.Panicked == 1 && m.Failed == 0
+	})
+
+	workerpooltest.Timeout = 10 * time.Millisecond
+	defer func() { workerpooltest.Timeout = 5 * time.Second }()
+	ft := &fakeT{TB: t}
+	if workerpooltest.AssertFailed(ft, pool, 1) || !ft.failed {
+		t.Error("expected the assertion to fail")
+	}
+}
+
+// fakeT records failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.failed = true
+}